@@ -0,0 +1,270 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+// 确认模式发送: 独立通道开启publisher confirms并以mandatory发送, broker确认后返回
+// 无法路由的消息先收到basic.return再收到ack, 按消息头中的投递序号关联后返回ErrPublishReturned并回调OnReturn
+// 消息Nonce可由调用方指定且可能重复(幂等重发), 不作为关联依据
+
+const confirmTag = "x-confirm-tag" // 确认模式投递序号消息头
+
+var (
+	ErrPublishNack     = utils.Error("rabbitmq publish nack by broker")
+	ErrPublishReturned = utils.Error("rabbitmq publish returned: unroutable")
+	ErrConfirmTimeout  = utils.Error("rabbitmq publish confirm timeout")
+)
+
+// ReturnedMessage 无法路由被退回的消息
+type ReturnedMessage struct {
+	Exchange string
+	Router   string
+	Code     int
+	Reason   string
+	Headers  amqp.Table
+	Body     []byte
+}
+
+type confirmState struct {
+	mu       sync.Mutex
+	channel  *confirmChannel
+	onReturn func(ret ReturnedMessage)
+}
+
+type confirmChannel struct {
+	mu      sync.Mutex
+	channel *amqp.Channel
+	seq     uint64
+	pending map[uint64]*confirmCall // 投递序号 -> 等待确认的发送
+}
+
+type confirmCall struct {
+	done     chan error
+	returned bool
+}
+
+// OnReturn 注册无法路由消息的回调, 回调在通道监听协程中执行, 不应阻塞
+func (self *PublishManager) OnReturn(callback func(ret ReturnedMessage)) {
+	self.confirm.mu.Lock()
+	defer self.confirm.mu.Unlock()
+	self.confirm.onReturn = callback
+}
+
+// PublishConfirm 确认模式发送消息, broker确认且消息已路由至队列时返回nil
+// 超时返回ErrConfirmTimeout, 此时消息是否送达不确定, 调用方应按幂等重发处理
+func (self *PublishManager) PublishConfirm(ctx context.Context, data *MsgData) error {
+	return self.PublishConfirmBatch(ctx, data)[0]
+}
+
+// PublishConfirmBatch 确认模式批量发送消息, 全部发送后统一等待确认, 返回与消息顺序一致的结果
+func (self *PublishManager) PublishConfirmBatch(ctx context.Context, data ...*MsgData) []error {
+	result := make([]error, len(data))
+	if len(data) == 0 {
+		return result
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := self.conf.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = 10000
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+	calls := make([]*confirmCall, len(data))
+	spans := make([]trace.Span, len(data))
+	for i, v := range data {
+		if v == nil {
+			result[i] = utils.Error("publish data empty")
+			continue
+		}
+		if v.ctx == nil {
+			v.WithContext(ctx)
+		}
+		var spanCtx context.Context
+		spanCtx, spans[i] = startSpan(v.Context(), v.Option, trace.SpanKindProducer)
+		calls[i], result[i] = self.publishConfirm(spanCtx, v)
+	}
+	for i, call := range calls {
+		if call != nil {
+			result[i] = call.wait(ctx)
+		}
+		if data[i] != nil {
+			endSpan(spans[i], result[i])
+			promx.ObservePublish(data[i].Option.Exchange, data[i].Option.Router, result[i])
+		}
+	}
+	return result
+}
+
+func (self *PublishManager) publishConfirm(ctx context.Context, data *MsgData) (*confirmCall, error) {
+	pub, err := self.initQueue(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := data.sign(self.conf.Payload); err != nil {
+		return nil, err
+	}
+	msg, err := newPublishing(ctx, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	msg.MessageId = data.Nonce
+	channel, err := self.confirmChannel()
+	if err != nil {
+		return nil, err
+	}
+	return channel.publish(pub.option.Exchange, pub.option.Router, msg)
+}
+
+// 获取确认模式通道, 通道关闭后重新创建
+func (self *PublishManager) confirmChannel() (*confirmChannel, error) {
+	self.confirm.mu.Lock()
+	defer self.confirm.mu.Unlock()
+	if self.confirm.channel != nil {
+		return self.confirm.channel, nil
+	}
+	channel, err := self.openChannel()
+	if err != nil {
+		return nil, err
+	}
+	if err := channel.Confirm(false); err != nil {
+		_ = channel.Close()
+		return nil, utils.Error("rabbitmq confirm mode failed: ", err)
+	}
+	c := &confirmChannel{channel: channel, pending: make(map[uint64]*confirmCall)}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1024))
+	returns := channel.NotifyReturn(make(chan amqp.Return, 128))
+	closes := channel.NotifyClose(make(chan *amqp.Error, 1))
+	go self.listenConfirm(c, confirms, returns, closes)
+	self.confirm.channel = c
+	return c, nil
+}
+
+func (self *PublishManager) listenConfirm(c *confirmChannel, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, closes <-chan *amqp.Error) {
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			self.returned(c, ret)
+		case conf, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			// 退回消息在ack之前写入returns, 确认前先处理已到达的退回消息
+			for drained := false; !drained; {
+				select {
+				case ret := <-returns:
+					self.returned(c, ret)
+				default:
+					drained = true
+				}
+			}
+			c.done(conf)
+		case err := <-closes:
+			zlog.Error("rabbitmq confirm channel closed", 0, zlog.AddError(err))
+			self.confirm.mu.Lock()
+			if self.confirm.channel == c {
+				self.confirm.channel = nil
+			}
+			self.confirm.mu.Unlock()
+			c.fail(utils.Error("rabbitmq confirm channel closed: ", err))
+			return
+		}
+	}
+}
+
+func (self *PublishManager) returned(c *confirmChannel, ret amqp.Return) {
+	if tag, b := ret.Headers[confirmTag].(int64); b {
+		c.mu.Lock()
+		if call, b := c.pending[uint64(tag)]; b {
+			call.returned = true
+		}
+		c.mu.Unlock()
+		delete(ret.Headers, confirmTag)
+	}
+	zlog.Warn("rabbitmq publish message returned", 0, zlog.String("exchange", ret.Exchange), zlog.String("router", ret.RoutingKey), zlog.String("reason", ret.ReplyText))
+	self.confirm.mu.Lock()
+	callback := self.confirm.onReturn
+	self.confirm.mu.Unlock()
+	if callback == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Error("rabbitmq return callback panic", 0, zlog.Any("error", r))
+		}
+	}()
+	callback(ReturnedMessage{Exchange: ret.Exchange, Router: ret.RoutingKey, Code: int(ret.ReplyCode), Reason: ret.ReplyText, Headers: ret.Headers, Body: ret.Body})
+}
+
+// publish 串行发送以保证投递序号与broker确认序号一致, 投递序号写入消息头用于关联退回消息
+func (self *confirmChannel) publish(exchange, router string, msg amqp.Publishing) (*confirmCall, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.pending == nil {
+		return nil, utils.Error("rabbitmq confirm channel closed")
+	}
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers[confirmTag] = int64(self.seq + 1)
+	if err := self.channel.Publish(exchange, router, true, false, msg); err != nil {
+		return nil, err
+	}
+	self.seq++
+	call := &confirmCall{done: make(chan error, 1)}
+	self.pending[self.seq] = call
+	return call, nil
+}
+
+func (self *confirmChannel) done(conf amqp.Confirmation) {
+	self.mu.Lock()
+	call, b := self.pending[conf.DeliveryTag]
+	if b {
+		delete(self.pending, conf.DeliveryTag)
+	}
+	self.mu.Unlock()
+	if !b {
+		return
+	}
+	switch {
+	case !conf.Ack:
+		call.done <- ErrPublishNack
+	case call.returned:
+		call.done <- ErrPublishReturned
+	default:
+		call.done <- nil
+	}
+}
+
+func (self *confirmChannel) fail(err error) {
+	self.mu.Lock()
+	pending := self.pending
+	self.pending = nil
+	self.mu.Unlock()
+	for _, call := range pending {
+		call.done <- err
+	}
+}
+
+func (self *confirmCall) wait(ctx context.Context) error {
+	select {
+	case err := <-self.done:
+		return err
+	case <-ctx.Done():
+		return ErrConfirmTimeout
+	}
+}
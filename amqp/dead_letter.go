@@ -0,0 +1,205 @@
+package rabbitmq
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const parkConfirmTimeout = 10 * time.Second
+
+// 死信转发及失败重投的确认模式通道, 串行发送并等待确认
+type parkChannel struct {
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+// 死信处理: 回调累计失败达到MaxRetries次后, 携带失败信息转发至死信交换机并确认原消息, 避免无限重试阻塞队列
+// 累计失败次数包含历史投递: 失败重投消息头x-dead-letter-retries及broker死信头x-death中当前队列的count, 进程重启后不重置
+// 死信转发及失败重投使用独立的确认模式通道, broker确认后才确认原消息, 隔离(Quarantine)达到上限同样转入死信队列
+// 死信队列中的消息可通过Browse/Replay(队列名DeadLetterQueue)查看及重放, 重放时清除死信及失败计数消息头
+
+const (
+	deadLetterPrefix   = "x-dead-letter-"
+	deadLetterError    = "x-dead-letter-error"
+	deadLetterRetries  = "x-dead-letter-retries"
+	deadLetterTime     = "x-dead-letter-time"
+	deadLetterQueue    = "x-dead-letter-queue"
+	originalExchange   = "x-dead-letter-original-exchange"
+	originalRoutingKey = "x-dead-letter-original-routing-key"
+)
+
+// DeadLetterExchangeName 死信交换机名称, 未配置时为{queue}.dlx
+func (self *Config) DeadLetterExchangeName() string {
+	if len(self.DeadLetterExchange) > 0 {
+		return self.DeadLetterExchange
+	}
+	return utils.AddStr(self.Option.Queue, ".dlx")
+}
+
+// DeadLetterQueueName 死信队列名称, 未配置时为{queue}.dlq
+func (self *Config) DeadLetterQueueName() string {
+	if len(self.DeadLetterQueue) > 0 {
+		return self.DeadLetterQueue
+	}
+	return utils.AddStr(self.Option.Queue, ".dlq")
+}
+
+// 声明死信交换机及队列, 按原队列名路由
+func (self *PullReceiver) declareDeadLetter(channel *amqp.Channel) error {
+	if atomic.LoadInt32(&self.deadLetter) == 1 {
+		return nil
+	}
+	exchange := self.Config.DeadLetterExchangeName()
+	queue := self.Config.DeadLetterQueueName()
+	if err := channel.ExchangeDeclare(exchange, direct, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := channel.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if err := channel.QueueBind(queue, self.Config.Option.Queue, exchange, false, nil); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&self.deadLetter, 1)
+	return nil
+}
+
+// settle 回调失败后处理, 优先按累计失败次数判断是否转入死信队列, 其次按隔离配置重投, 返回true表示原消息已转移, 可直接确认
+func (self *PullReceiver) settle(channel *amqp.Channel, d amqp.Delivery, retries int, cause error) bool {
+	if cause == nil {
+		return false
+	}
+	failures := deliveryFailures(d, self.Config.Option.Queue) + retries
+	if self.Config.MaxRetries > 0 && failures >= self.Config.MaxRetries {
+		if err := self.declareDeadLetter(channel); err != nil {
+			zlog.Error("rabbitmq pull dead letter declare failed", 0, zlog.String("queue", self.Config.Option.Queue), zlog.AddError(err))
+			return false
+		}
+		return self.parkDeadLetter(d, failures, cause)
+	}
+	if self.Config.Quarantine == nil {
+		return false
+	}
+	if err := self.declareDeadLetter(channel); err != nil {
+		zlog.Error("rabbitmq pull dead letter declare failed", 0, zlog.String("queue", self.Config.Option.Queue), zlog.AddError(err))
+		return false
+	}
+	return self.quarantine(d, failures, cause)
+}
+
+// 历史失败次数: 失败重投记录的次数及broker死信头x-death中当前队列的count
+func deliveryFailures(d amqp.Delivery, queue string) int {
+	failures := 0
+	if v, b := d.Headers[deadLetterRetries]; b {
+		if n, err := utils.StrToInt(utils.AnyToStr(v)); err == nil {
+			failures = n
+		}
+	}
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	for _, v := range deaths {
+		death, ok := v.(amqp.Table)
+		if !ok || utils.AnyToStr(death["queue"]) != queue {
+			continue
+		}
+		if n, ok := death["count"].(int64); ok {
+			failures += int(n)
+		}
+	}
+	return failures
+}
+
+// 复制消息头, 首次转移时记录原始交换机及路由
+func originHeaders(d amqp.Delivery) amqp.Table {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	if _, b := headers[originalExchange]; !b {
+		headers[originalExchange] = d.Exchange
+		headers[originalRoutingKey] = d.RoutingKey
+	}
+	return headers
+}
+
+// parkDeadLetter 转发至死信交换机并等待broker确认, 返回true表示原消息已转移, 可直接确认
+func (self *PullReceiver) parkDeadLetter(d amqp.Delivery, failures int, cause error) bool {
+	queue := self.Config.Option.Queue
+	headers := originHeaders(d)
+	headers[deadLetterError] = cause.Error()
+	headers[deadLetterRetries] = int32(failures)
+	headers[deadLetterTime] = utils.UnixMilli()
+	headers[deadLetterQueue] = queue
+	data := amqp.Publishing{ContentType: d.ContentType, Headers: headers, Timestamp: time.Now(), Body: d.Body}
+	exchange := self.Config.DeadLetterExchangeName()
+	if err := self.publishConfirm(exchange, queue, data); err != nil {
+		zlog.Error("rabbitmq pull dead letter publish failed", 0, zlog.String("queue", queue), zlog.String("exchange", exchange), zlog.AddError(err))
+		return false
+	}
+	zlog.Error("rabbitmq pull message parked to dead letter queue", 0, zlog.String("queue", queue), zlog.String("dlq", self.Config.DeadLetterQueueName()), zlog.Int("failures", failures), zlog.AddError(cause))
+	return true
+}
+
+// publishConfirm 经确认模式通道发送, 超时或通道异常时关闭通道, 下次发送重新创建, 避免确认序号错位
+func (self *PullReceiver) publishConfirm(exchange, router string, data amqp.Publishing) error {
+	self.parkMu.Lock()
+	defer self.parkMu.Unlock()
+	if self.park == nil {
+		if self.mgr == nil {
+			return utils.Error("rabbitmq pull receiver not started")
+		}
+		channel, err := self.mgr.openChannel()
+		if err != nil {
+			return err
+		}
+		if err := channel.Confirm(false); err != nil {
+			_ = channel.Close()
+			return utils.Error("rabbitmq confirm mode failed: ", err)
+		}
+		self.park = &parkChannel{channel: channel, confirms: channel.NotifyPublish(make(chan amqp.Confirmation, 1))}
+	}
+	if err := self.park.channel.Publish(exchange, router, false, false, data); err != nil {
+		self.closePark()
+		return err
+	}
+	select {
+	case conf, ok := <-self.park.confirms:
+		if !ok {
+			self.closePark()
+			return utils.Error("rabbitmq confirm channel closed")
+		}
+		if !conf.Ack {
+			return ErrPublishNack
+		}
+		return nil
+	case <-time.After(parkConfirmTimeout):
+		self.closePark()
+		return ErrConfirmTimeout
+	}
+}
+
+func (self *PullReceiver) closePark() {
+	if self.park == nil {
+		return
+	}
+	_ = self.park.channel.Close()
+	self.park = nil
+}
+
+// BrowseDeadLetter 浏览消费者死信队列中的消息, 消息保留在队列中, 返回下一页offset, 已扫描完时返回-1
+func (self *PublishManager) BrowseDeadLetter(config *Config, offset, limit int, filter ReplayFilter) ([]ReplayMessage, int, error) {
+	return self.Browse(config.DeadLetterQueueName(), offset, limit, filter)
+}
+
+// ReplayDeadLetter 将消费者死信队列中符合条件的消息重放至原始交换机, 返回重放数量
+func (self *PublishManager) ReplayDeadLetter(config *Config, req ReplayRequest) (int, error) {
+	req.Queue = config.DeadLetterQueueName()
+	return self.Replay(req)
+}
+
+func isDeadLetterHeader(key string) bool {
+	return strings.HasPrefix(key, deadLetterPrefix)
+}
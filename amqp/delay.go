@@ -0,0 +1,201 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+// 延迟消息: 优先使用rabbitmq_delayed_message_exchange插件, 未安装时使用TTL+死信队列
+// plugin: 声明{exchange}.delayed延迟交换机并绑定至原交换机, 消息头x-delay指定延迟毫秒
+// ttl: 按延迟秒数声明{exchange}.{router}.delay.{ms}队列, 过期后经死信转发至原交换机
+// ttl队列设置x-expires(延迟时间+1分钟), 闲置后由服务端删除, 发送时按间隔重新声明以刷新闲置时间, 避免队列数量无限增长
+// 自动检测时仅在服务端明确拒绝延迟交换机类型时使用ttl, 其他探测错误返回错误并在下次发送时重新探测, ttl模式定时重新探测插件
+
+const (
+	DelayPlugin = "plugin"
+	DelayTTL    = "ttl"
+
+	delayedKind     = "x-delayed-message"
+	delayProbe      = "freego.delayed.probe"
+	maxDelay        = int64(4294967295) // 插件最大延迟/毫秒
+	delayTTLStepMil = int64(1000)       // TTL模式延迟按秒向上取整, 减少延迟队列数量
+	delayExpireMil  = int64(60000)      // TTL队列闲置过期时间超出延迟时间的部分/毫秒
+	delayRedeclare  = 30 * time.Second  // TTL队列重新声明间隔, 须小于delayExpireMil
+	delayReprobe    = 10 * time.Minute  // TTL模式重新探测插件间隔
+)
+
+type delayState struct {
+	mu       sync.Mutex
+	mode     string
+	probed   time.Time            // 自动检测为ttl模式的时间, 为零表示配置指定或插件可用
+	declared map[string]time.Time // 声明时间
+}
+
+// PublishDelayed 延迟发送消息, delay<=0时立即发送
+func (self *PublishManager) PublishDelayed(ctx context.Context, data *MsgData, delay time.Duration) (err error) {
+	if data == nil {
+		return utils.Error("publish data empty")
+	}
+	if ctx != nil {
+		data.WithContext(ctx)
+	}
+	if delay <= 0 {
+		return self.PublishMsgData(data)
+	}
+	ms := delay.Milliseconds()
+	if ms > maxDelay {
+		return utils.Error("rabbitmq publish delay [", delay, "] exceeds max delay")
+	}
+	ctx, span := startSpan(data.Context(), data.Option, trace.SpanKindProducer)
+	defer func() {
+		endSpan(span, err)
+		promx.ObservePublish(data.Option.Exchange, data.Option.Router, err)
+	}()
+	pub, err := self.initQueue(data)
+	if err != nil {
+		return err
+	}
+	if len(pub.option.Exchange) == 0 {
+		return utils.Error("rabbitmq publish delay exchange is nil")
+	}
+	mode, err := self.delayMode()
+	if err != nil {
+		return err
+	}
+	if mode == DelayTTL {
+		ms = (ms + delayTTLStepMil - 1) / delayTTLStepMil * delayTTLStepMil
+	}
+	data.Delay = ms
+	if err := data.sign(self.conf.Payload); err != nil {
+		return err
+	}
+	if mode == DelayPlugin {
+		exchange, err := self.declareDelayedExchange(pub)
+		if err != nil {
+			return err
+		}
+		_, err = pub.publish(ctx, data, exchange, pub.option.Router, amqp.Table{"x-delay": ms})
+		return err
+	}
+	queue, err := self.declareDelayQueue(pub, ms)
+	if err != nil {
+		return err
+	}
+	_, err = pub.publish(ctx, data, "", queue, nil)
+	return err
+}
+
+// PublishAt 定时发送消息, at早于当前时间时立即发送
+func (self *PublishManager) PublishAt(ctx context.Context, data *MsgData, at time.Time) error {
+	return self.PublishDelayed(ctx, data, time.Until(at))
+}
+
+// 获取延迟消息实现方式, 未配置时声明探测交换机检测插件是否可用
+func (self *PublishManager) delayMode() (string, error) {
+	self.delay.mu.Lock()
+	defer self.delay.mu.Unlock()
+	if len(self.delay.mode) > 0 && (self.delay.probed.IsZero() || time.Since(self.delay.probed) < delayReprobe) {
+		return self.delay.mode, nil
+	}
+	switch self.conf.Delayed {
+	case DelayPlugin, DelayTTL:
+		self.delay.mode = self.conf.Delayed
+		return self.delay.mode, nil
+	case "":
+	default:
+		return "", utils.Error("rabbitmq delayed mode [", self.conf.Delayed, "] invalid")
+	}
+	channel, err := self.openChannel()
+	if err != nil {
+		return self.probeFailed(err)
+	}
+	// 插件未安装时服务端以COMMAND_INVALID关闭通道, 无需再次关闭
+	if err := channel.ExchangeDeclare(delayProbe, delayedKind, false, true, false, false, amqp.Table{"x-delayed-type": direct}); err != nil {
+		if e, b := err.(*amqp.Error); !b || e.Code != amqp.CommandInvalid {
+			_ = channel.Close()
+			return self.probeFailed(err)
+		}
+		if self.delay.mode != DelayTTL {
+			zlog.Printf("rabbitmq delayed message mode [%s] detected", DelayTTL)
+		}
+		self.delay.mode = DelayTTL
+		self.delay.probed = time.Now()
+		return self.delay.mode, nil
+	}
+	if err := channel.ExchangeDelete(delayProbe, false, false); err != nil {
+		zlog.Warn("rabbitmq delayed probe exchange delete failed", 0, zlog.AddError(err))
+	}
+	if err := channel.Close(); err != nil {
+		zlog.Error("rabbitmq channel close failed", 0, zlog.AddError(err))
+	}
+	self.delay.mode = DelayPlugin
+	self.delay.probed = time.Time{}
+	zlog.Printf("rabbitmq delayed message mode [%s] detected", self.delay.mode)
+	return self.delay.mode, nil
+}
+
+// 探测失败时已检测过的模式继续使用, 否则返回错误, 下次发送时重新探测
+func (self *PublishManager) probeFailed(err error) (string, error) {
+	if len(self.delay.mode) > 0 {
+		zlog.Warn("rabbitmq delayed plugin reprobe failed", 0, zlog.AddError(err))
+		self.delay.probed = time.Now()
+		return self.delay.mode, nil
+	}
+	return "", utils.Error("rabbitmq delayed plugin probe failed: ", err)
+}
+
+// declared 声明时间未超过interval时跳过, interval为0表示仅声明一次
+func (self *PublishManager) declared(key string, interval time.Duration, declare func() error) error {
+	self.delay.mu.Lock()
+	defer self.delay.mu.Unlock()
+	if t, b := self.delay.declared[key]; b && (interval == 0 || time.Since(t) < interval) {
+		return nil
+	}
+	if err := declare(); err != nil {
+		return err
+	}
+	if self.delay.declared == nil {
+		self.delay.declared = make(map[string]time.Time)
+	}
+	self.delay.declared[key] = time.Now()
+	return nil
+}
+
+// 声明延迟交换机并按原路由绑定至原交换机
+func (self *PublishManager) declareDelayedExchange(pub *PublishMQ) (string, error) {
+	name := utils.AddStr(pub.option.Exchange, ".delayed")
+	err := self.declared(utils.AddStr(name, ":", pub.option.Router), 0, func() error {
+		if err := pub.channel.ExchangeDeclare(name, delayedKind, true, false, false, false, amqp.Table{"x-delayed-type": direct}); err != nil {
+			return utils.Error("rabbitmq delayed exchange [", name, "] declare failed: ", err)
+		}
+		if err := pub.channel.ExchangeBind(pub.option.Exchange, pub.option.Router, name, false, nil); err != nil {
+			return utils.Error("rabbitmq delayed exchange [", name, "] bind failed: ", err)
+		}
+		return nil
+	})
+	return name, err
+}
+
+// 声明固定TTL的延迟队列, 过期消息转发至原交换机及路由, 重新声明刷新闲置时间, 保证队列在最后一条消息到期前不被删除
+func (self *PublishManager) declareDelayQueue(pub *PublishMQ, ms int64) (string, error) {
+	name := utils.AddStr(pub.option.Exchange, ".", pub.option.Router, ".delay.", ms)
+	err := self.declared(name, delayRedeclare, func() error {
+		args := amqp.Table{
+			"x-message-ttl":             ms,
+			"x-expires":                 ms + delayExpireMil,
+			"x-dead-letter-exchange":    pub.option.Exchange,
+			"x-dead-letter-routing-key": pub.option.Router,
+		}
+		if _, err := pub.channel.QueueDeclare(name, true, false, false, false, args); err != nil {
+			return utils.Error("rabbitmq delay queue [", name, "] declare failed: ", err)
+		}
+		return nil
+	})
+	return name, err
+}
@@ -0,0 +1,94 @@
+package rabbitmq
+
+import (
+	"github.com/streadway/amqp"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+const entityKey = "x-entity-key"
+
+// laneGroup 消费工作池
+// 有序模式按key哈希分配到固定通道, 同一key的消息在同一通道内顺序处理; 无序模式多个工作协程共享同一通道
+type laneGroup struct {
+	index  uint32
+	key    func(d amqp.Delivery) string
+	shared chan amqp.Delivery
+	lanes  []chan amqp.Delivery
+	wg     sync.WaitGroup
+}
+
+// 按实体key有序处理, 无实体key的消息轮询分配
+func newLaneGroup(receiver *PullReceiver, channel *amqp.Channel, size int) *laneGroup {
+	return newOrderedGroup(receiver, channel, size, func(d amqp.Delivery) string {
+		key, _ := d.Headers[entityKey].(string)
+		return key
+	})
+}
+
+// 按路由key有序处理
+func newRouterGroup(receiver *PullReceiver, channel *amqp.Channel, size int) *laneGroup {
+	return newOrderedGroup(receiver, channel, size, func(d amqp.Delivery) string {
+		return d.RoutingKey
+	})
+}
+
+func newOrderedGroup(receiver *PullReceiver, channel *amqp.Channel, size int, key func(d amqp.Delivery) string) *laneGroup {
+	group := &laneGroup{key: key, lanes: make([]chan amqp.Delivery, size)}
+	for i := 0; i < size; i++ {
+		lane := make(chan amqp.Delivery, 1)
+		group.lanes[i] = lane
+		group.work(receiver, channel, lane)
+	}
+	return group
+}
+
+// 无序并发处理, 处理中消息数受通道预取数量限制
+func newWorkerGroup(receiver *PullReceiver, channel *amqp.Channel, size int) *laneGroup {
+	group := &laneGroup{shared: make(chan amqp.Delivery, size)}
+	for i := 0; i < size; i++ {
+		group.work(receiver, channel, group.shared)
+	}
+	return group
+}
+
+func (self *laneGroup) work(receiver *PullReceiver, channel *amqp.Channel, lane chan amqp.Delivery) {
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		for d := range lane {
+			receiver.handle(channel, d)
+		}
+	}()
+}
+
+// dispatch 无有序key的消息轮询分配
+func (self *laneGroup) dispatch(d amqp.Delivery) {
+	if self.shared != nil {
+		self.shared <- d
+		return
+	}
+	var index uint32
+	if key := self.key(d); len(key) > 0 {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		index = h.Sum32()
+	} else {
+		index = atomic.AddUint32(&self.index, 1)
+	}
+	self.lanes[index%uint32(len(self.lanes))] <- d
+}
+
+// close 停止分配, wait为true时等待已分配的消息处理完成
+func (self *laneGroup) close(wait bool) {
+	if self.shared != nil {
+		close(self.shared)
+	}
+	for _, lane := range self.lanes {
+		close(lane)
+	}
+	if wait {
+		self.wg.Wait()
+	}
+}
@@ -0,0 +1,361 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fanout = "fanout"
+	topic  = "topic"
+)
+
+// Publisher 消息发布接口, PublishManager与MemoryBroker均已实现
+type Publisher interface {
+	Publish(exchange, queue string, dataType int64, content interface{}) error
+	PublishMsgData(data *MsgData) error
+}
+
+// ConfirmPublisher 确认模式消息发布接口, PublishManager与MemoryBroker均已实现
+type ConfirmPublisher interface {
+	Publisher
+	PublishConfirm(ctx context.Context, data *MsgData) error
+	PublishConfirmBatch(ctx context.Context, data ...*MsgData) []error
+	OnReturn(callback func(ret ReturnedMessage))
+}
+
+// MemoryBroker 进程内消息代理, 用于单元测试替代RabbitMQ
+// 消息经过与RabbitMQ一致的签名/加密流程, 支持direct/fanout/topic路由
+// 确认模式与RabbitMQ语义一致: 无法路由返回ErrPublishReturned并回调OnReturn, 队列已满等待至超时返回ErrConfirmTimeout
+// 可通过OnConfirm模拟broker拒绝(ErrPublishNack)或确认超时
+type MemoryBroker struct {
+	mu       sync.RWMutex
+	conf     AmqpConfig
+	size     int
+	queues   map[string]*memoryQueue
+	bindings map[string][]*memoryBinding
+	closed   chan struct{}
+	wg       sync.WaitGroup
+	onReturn func(ret ReturnedMessage)
+	confirm  func(data *MsgData) error
+}
+
+type memoryBinding struct {
+	kind   string
+	router string
+	queue  *memoryQueue
+}
+
+type memoryQueue struct {
+	name    string
+	pending sync.WaitGroup
+	ch      chan []byte
+}
+
+// NewMemoryBroker 创建进程内消息代理, size为单队列缓冲消息数
+func NewMemoryBroker(conf AmqpConfig, size ...int) *MemoryBroker {
+	if len(conf.SecretKey) == 0 {
+		panic("memory broker SecretKey is nil")
+	}
+	capacity := 1024
+	if len(size) > 0 && size[0] > 0 {
+		capacity = size[0]
+	}
+	return &MemoryBroker{
+		conf:     conf,
+		size:     capacity,
+		queues:   make(map[string]*memoryQueue),
+		bindings: make(map[string][]*memoryBinding),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (self *MemoryBroker) sigKey() string {
+	return utils.HMAC_SHA512(self.conf.SecretKey, utils.GetLocalSecretKey())
+}
+
+// declare 声明队列并绑定到交换机
+func (self *MemoryBroker) declare(option Option) *memoryQueue {
+	if len(option.Kind) == 0 {
+		option.Kind = direct
+	}
+	if len(option.Router) == 0 {
+		option.Router = option.Queue
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	queue, b := self.queues[option.Queue]
+	if !b {
+		queue = &memoryQueue{name: option.Queue, ch: make(chan []byte, self.size)}
+		self.queues[option.Queue] = queue
+	}
+	for _, v := range self.bindings[option.Exchange] {
+		if v.queue == queue && v.router == option.Router {
+			return queue
+		}
+	}
+	self.bindings[option.Exchange] = append(self.bindings[option.Exchange], &memoryBinding{kind: option.Kind, router: option.Router, queue: queue})
+	return queue
+}
+
+func (self *MemoryBroker) Publish(exchange, queue string, dataType int64, content interface{}) error {
+	msg := &MsgData{
+		Option: Option{
+			Exchange: exchange,
+			Queue:    queue,
+		},
+		Type:    dataType,
+		Content: content,
+	}
+	return self.PublishMsgData(msg)
+}
+
+func (self *MemoryBroker) PublishMsgData(data *MsgData) error {
+	_, _, err := self.deliver(nil, data)
+	return err
+}
+
+// deliver 签名后投递至匹配的队列, 返回消息体及是否已路由, ctx取消时停止等待已满的队列
+func (self *MemoryBroker) deliver(ctx context.Context, data *MsgData) ([]byte, bool, error) {
+	if data == nil {
+		return nil, false, utils.Error("publish data empty")
+	}
+	if len(data.Option.Router) == 0 {
+		data.Option.Router = data.Option.Queue
+	}
+	if !utils.CheckInt(data.Option.SigTyp, 0, 1) {
+		data.Option.SigTyp = 1
+	}
+	if len(data.Nonce) == 0 {
+		data.Nonce = utils.RandNonce()
+	}
+	if len(data.Option.Queue) > 0 {
+		self.declare(data.Option)
+	}
+	data.Option.SigKey = self.sigKey()
+	if err := data.sign(self.conf.Payload); err != nil {
+		return nil, false, err
+	}
+	body, err := utils.JsonMarshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	self.mu.RLock()
+	bindings := self.bindings[data.Option.Exchange]
+	self.mu.RUnlock()
+	var routed bool
+	for _, v := range bindings {
+		if !matchRouter(v.kind, v.router, data.Option.Router) {
+			continue
+		}
+		routed = true
+		v.queue.pending.Add(1)
+		select {
+		case v.queue.ch <- body:
+		case <-done:
+			v.queue.pending.Done()
+			return body, routed, ctx.Err()
+		case <-self.closed:
+			v.queue.pending.Done()
+			return body, routed, utils.Error("memory broker closed")
+		}
+	}
+	return body, routed, nil
+}
+
+// OnReturn 注册无法路由消息的回调
+func (self *MemoryBroker) OnReturn(callback func(ret ReturnedMessage)) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.onReturn = callback
+}
+
+// OnConfirm 注册确认模式发送前的回调, 返回错误时消息不投递并作为发送结果, 用于模拟ErrPublishNack/ErrConfirmTimeout
+func (self *MemoryBroker) OnConfirm(callback func(data *MsgData) error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.confirm = callback
+}
+
+// PublishConfirm 确认模式发送消息, 消息已投递至队列时返回nil
+func (self *MemoryBroker) PublishConfirm(ctx context.Context, data *MsgData) error {
+	return self.PublishConfirmBatch(ctx, data)[0]
+}
+
+// PublishConfirmBatch 确认模式批量发送消息, 返回与消息顺序一致的结果
+func (self *MemoryBroker) PublishConfirmBatch(ctx context.Context, data ...*MsgData) []error {
+	result := make([]error, len(data))
+	if len(data) == 0 {
+		return result
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := self.conf.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = 10000
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+	self.mu.RLock()
+	confirm, onReturn := self.confirm, self.onReturn
+	self.mu.RUnlock()
+	for i, v := range data {
+		if v == nil {
+			result[i] = utils.Error("publish data empty")
+			continue
+		}
+		if confirm != nil {
+			if err := confirm(v); err != nil {
+				result[i] = err
+				continue
+			}
+		}
+		body, routed, err := self.deliver(ctx, v)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ErrConfirmTimeout
+			}
+			result[i] = err
+			continue
+		}
+		if !routed {
+			result[i] = ErrPublishReturned
+			if onReturn != nil {
+				onReturn(ReturnedMessage{Exchange: v.Option.Exchange, Router: v.Option.Router, Code: 312, Reason: "NO_ROUTE", Body: body})
+			}
+		}
+	}
+	return result
+}
+
+// PublishDelayed 延迟发送消息, 到期前Wait不等待该消息, 代理关闭后未到期消息丢弃
+func (self *MemoryBroker) PublishDelayed(ctx context.Context, data *MsgData, delay time.Duration) error {
+	if data == nil {
+		return utils.Error("publish data empty")
+	}
+	if ctx != nil {
+		data.WithContext(ctx)
+	}
+	if delay <= 0 {
+		return self.PublishMsgData(data)
+	}
+	data.Delay = delay.Milliseconds()
+	time.AfterFunc(delay, func() {
+		select {
+		case <-self.closed:
+			return
+		default:
+		}
+		if err := self.PublishMsgData(data); err != nil {
+			zlog.Error("memory broker delayed publish failed", 0, zlog.String("exchange", data.Option.Exchange), zlog.AddError(err))
+		}
+	})
+	return nil
+}
+
+// PublishAt 定时发送消息
+func (self *MemoryBroker) PublishAt(ctx context.Context, data *MsgData, at time.Time) error {
+	return self.PublishDelayed(ctx, data, time.Until(at))
+}
+
+// AddPullReceiver 注册消费者, 回调逻辑与PullManager一致
+func (self *MemoryBroker) AddPullReceiver(receivers ...*PullReceiver) {
+	for _, receiver := range receivers {
+		if !utils.CheckInt(receiver.Config.Option.SigTyp, 0, 1) {
+			receiver.Config.Option.SigTyp = 1
+		}
+		receiver.Config.Option.SigKey = self.sigKey()
+		queue := self.declare(receiver.Config.Option)
+		self.wg.Add(1)
+		go self.consume(receiver, queue)
+	}
+}
+
+func (self *MemoryBroker) consume(receiver *PullReceiver, queue *memoryQueue) {
+	defer self.wg.Done()
+	for {
+		select {
+		case body := <-queue.ch:
+			for !receiver.OnReceive(body) {
+				delay := receiver.Delay
+				if delay == 0 {
+					delay = 5
+				}
+				select {
+				case <-time.After(time.Duration(delay) * time.Second):
+				case <-self.closed:
+					queue.pending.Done()
+					return
+				}
+			}
+			queue.pending.Done()
+		case <-self.closed:
+			return
+		}
+	}
+}
+
+// Wait 等待指定队列中已发布的消息全部消费完成
+func (self *MemoryBroker) Wait(queue string) {
+	self.mu.RLock()
+	q, b := self.queues[queue]
+	self.mu.RUnlock()
+	if !b {
+		return
+	}
+	q.pending.Wait()
+}
+
+// Close 停止全部消费者
+func (self *MemoryBroker) Close() {
+	select {
+	case <-self.closed:
+		return
+	default:
+		close(self.closed)
+	}
+	self.wg.Wait()
+	zlog.Println("memory broker has been closed")
+}
+
+// matchRouter 按交换机类型匹配路由键, topic支持*与#通配符
+func matchRouter(kind, pattern, key string) bool {
+	switch kind {
+	case fanout:
+		return true
+	case topic:
+		return matchTopic(strings.Split(pattern, "."), strings.Split(key, "."))
+	default:
+		return pattern == key
+	}
+}
+
+func matchTopic(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	if pattern[0] == "#" {
+		for i := 0; i <= len(key); i++ {
+			if matchTopic(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(key) == 0 {
+		return false
+	}
+	if pattern[0] != "*" && pattern[0] != key[0] {
+		return false
+	}
+	return matchTopic(pattern[1:], key[1:])
+}
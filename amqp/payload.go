@@ -0,0 +1,140 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+)
+
+const (
+	GZIP = "gzip"
+	ZSTD = "zstd"
+
+	maxDecompressSize = 64 << 20 // 解压后内容最大字节数, 防止压缩炸弹耗尽内存
+)
+
+var (
+	payloadStats   = &PayloadStat{}
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressSize))
+)
+
+// PayloadOption 消息内容压缩与大小限制
+type PayloadOption struct {
+	CompressType      string // 压缩算法 gzip/zstd, 为空则不压缩
+	CompressThreshold int    // 内容超过该字节数时压缩, 默认1024
+	MaxSize           int    // 内容最大字节数(压缩后), 0则不限制
+}
+
+// PayloadStat 消息内容大小统计
+type PayloadStat struct {
+	Count      int64 // 发送消息数
+	TotalBytes int64 // 原始内容累计字节数
+	SentBytes  int64 // 实际发送内容累计字节数
+	MaxBytes   int64 // 原始内容最大字节数
+	Compressed int64 // 压缩消息数
+	Rejected   int64 // 超出大小限制被拒绝的消息数
+}
+
+// GetPayloadStats 获取消息内容大小统计
+func GetPayloadStats() PayloadStat {
+	return PayloadStat{
+		Count:      atomic.LoadInt64(&payloadStats.Count),
+		TotalBytes: atomic.LoadInt64(&payloadStats.TotalBytes),
+		SentBytes:  atomic.LoadInt64(&payloadStats.SentBytes),
+		MaxBytes:   atomic.LoadInt64(&payloadStats.MaxBytes),
+		Compressed: atomic.LoadInt64(&payloadStats.Compressed),
+		Rejected:   atomic.LoadInt64(&payloadStats.Rejected),
+	}
+}
+
+func (self *PayloadStat) record(raw, sent int, compressed, rejected bool) {
+	atomic.AddInt64(&self.Count, 1)
+	atomic.AddInt64(&self.TotalBytes, int64(raw))
+	atomic.AddInt64(&self.SentBytes, int64(sent))
+	if compressed {
+		atomic.AddInt64(&self.Compressed, 1)
+	}
+	if rejected {
+		atomic.AddInt64(&self.Rejected, 1)
+	}
+	for {
+		max := atomic.LoadInt64(&self.MaxBytes)
+		if int64(raw) <= max || atomic.CompareAndSwapInt64(&self.MaxBytes, max, int64(raw)) {
+			break
+		}
+	}
+}
+
+// encode 按配置压缩内容并校验大小, 返回实际使用的压缩算法
+func (self PayloadOption) encode(b []byte) ([]byte, string, error) {
+	raw := len(b)
+	encoding := ""
+	threshold := self.CompressThreshold
+	if threshold <= 0 {
+		threshold = 1024
+	}
+	if len(self.CompressType) > 0 && raw > threshold {
+		c, err := compress(self.CompressType, b)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(c) < raw {
+			b = c
+			encoding = self.CompressType
+		}
+	}
+	if self.MaxSize > 0 && len(b) > self.MaxSize {
+		payloadStats.record(raw, 0, false, true)
+		return nil, "", utils.Error("rabbitmq publish content size [", len(b), "] exceeds max size [", self.MaxSize, "]")
+	}
+	payloadStats.record(raw, len(b), len(encoding) > 0, false)
+	return b, encoding, nil
+}
+
+func compress(typ string, b []byte) ([]byte, error) {
+	switch typ {
+	case GZIP:
+		buf := bytes.Buffer{}
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case ZSTD:
+		return zstdEncoder.EncodeAll(b, make([]byte, 0, len(b))), nil
+	}
+	return nil, utils.Error("rabbitmq content encoding [", typ, "] not supported")
+}
+
+// decompress 解压消息内容, 解压后超过maxDecompressSize时返回错误
+func decompress(typ string, b []byte) ([]byte, error) {
+	switch typ {
+	case "":
+		return b, nil
+	case GZIP:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		result, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(result) > maxDecompressSize {
+			return nil, utils.Error("rabbitmq decompressed content exceeds max size [", maxDecompressSize, "]")
+		}
+		return result, nil
+	case ZSTD:
+		return zstdDecoder.DecodeAll(b, nil)
+	}
+	return nil, utils.Error("rabbitmq content encoding [", typ, "] not supported")
+}
@@ -1,12 +1,16 @@
 package rabbitmq
 
 import (
+	"context"
 	"fmt"
 	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/promx"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/zlog"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,11 +24,16 @@ type PublishManager struct {
 	conf     AmqpConfig
 	conn     *amqp.Connection
 	channels map[string]*PublishMQ
+	rpc      *rpcClient
+	delay    delayState
+	confirm  confirmState
+	closed   int32 // 已关闭, 通道断开后不再重连
 }
 
 type PublishMQ struct {
 	mu      sync.Mutex
 	ready   bool
+	ds      string // 数据源名称
 	option  *Option
 	channel *amqp.Channel
 	queue   *amqp.Queue
@@ -95,20 +104,12 @@ func (self *PublishManager) openChannel() (*amqp.Channel, error) {
 }
 
 func (self *PublishManager) getChannel() *amqp.Channel {
-	index := 0
-	for {
-		if index > 0 {
-			zlog.Warn("rabbitmq publish trying to connect again", 0, zlog.Int("tried", index))
-		}
-		channel, err := self.openChannel()
-		if err != nil {
-			zlog.Error("rabbitmq publish init Connection/Channel failed: ", 0, zlog.AddError(err))
-			time.Sleep(2500 * time.Millisecond)
-			index++
-			continue
-		}
-		return channel
-	}
+	var channel *amqp.Channel
+	_ = utils.Retry(context.Background(), channelRetry, func(ctx context.Context) (err error) {
+		channel, err = self.openChannel()
+		return err
+	})
+	return channel
 }
 
 func (self *PublishManager) Queue(data *MsgData) (*QueueData, error) {
@@ -148,6 +149,9 @@ func (self *PublishManager) initQueue(data *MsgData) (*PublishMQ, error) {
 	defer self.mu0.Unlock()
 	pub, ok = self.channels[chanKey]
 	if !ok {
+		if err := checkTopic(data.Option); err != nil {
+			return nil, err
+		}
 		if len(data.Option.Kind) == 0 {
 			data.Option.Kind = direct
 		}
@@ -161,7 +165,7 @@ func (self *PublishManager) initQueue(data *MsgData) (*PublishMQ, error) {
 			Router:   data.Option.Router,
 			SigTyp:   data.Option.SigTyp,
 		}
-		pub = &PublishMQ{channel: self.getChannel(), option: opt}
+		pub = &PublishMQ{channel: self.getChannel(), option: opt, ds: self.conf.DsName}
 		if err := pub.prepareExchange(); err != nil {
 			return nil, err
 		}
@@ -195,6 +199,9 @@ func (self *PublishManager) listen(pub *PublishMQ) {
 			select {
 			case <-closeChan:
 				pub.ready = false
+				if atomic.LoadInt32(&self.closed) == 1 {
+					return
+				}
 				self.listen(pub)
 				zlog.Warn("rabbitmq publish received channel exception, successful reconnected", 0, zlog.String("exchange", pub.option.Exchange), zlog.String("queue", pub.option.Queue))
 				return
@@ -215,24 +222,49 @@ func (self *PublishManager) Publish(exchange, queue string, dataType int64, cont
 	return self.PublishMsgData(msg)
 }
 
-func (self *PublishManager) PublishMsgData(data *MsgData) error {
+func (self *PublishManager) PublishMsgData(data *MsgData) (err error) {
 	if data == nil {
 		return utils.Error("publish data empty")
 	}
+	ctx, span := startSpan(data.Context(), data.Option, trace.SpanKindProducer)
+	defer func() {
+		endSpan(span, err)
+		promx.ObservePublish(data.Option.Exchange, data.Option.Router, err)
+	}()
 	pub, err := self.initQueue(data)
 	if err != nil {
 		return err
 	}
+	if err := data.sign(self.conf.Payload); err != nil {
+		return err
+	}
+	if _, err := pub.sendMessage(ctx, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sign 按签名模式加密并签名消息内容
+func (self *MsgData) sign(option PayloadOption) error {
 	// 数据加密模式
-	sigTyp := data.Option.SigTyp
-	sigKey := data.Option.SigKey
+	sigTyp := self.Option.SigTyp
+	sigKey := self.Option.SigKey
 	if len(sigKey) == 0 {
 		return utils.Error("rabbitmq publish data key is nil")
 	}
-	content, err := utils.ToJsonBase64(data.Content)
+	if self.Content == nil {
+		self.Content = map[string]string{}
+	}
+	body, err := utils.JsonMarshal(self.Content)
 	if err != nil {
 		return err
 	}
+	body, encoding, err := option.encode(body)
+	if err != nil {
+		return err
+	}
+	self.Encoding = encoding
+	content := utils.Base64Encode(body)
 	if len(content) == 0 {
 		return utils.Error("rabbitmq publish content is nil")
 	}
@@ -243,29 +275,50 @@ func (self *PublishManager) PublishMsgData(data *MsgData) error {
 		}
 		content = aesContent
 	}
-	data.Content = content
-	data.Signature = utils.HMAC_SHA256(utils.AddStr(content, data.Nonce), sigKey, true)
-	data.Option.SigKey = ""
-	if _, err := pub.sendMessage(data); err != nil {
-		return err
-	}
+	self.Content = content
+	self.Signature = utils.HMAC_SHA256(utils.AddStr(content, self.Nonce), sigKey, true)
+	self.Option.SigKey = ""
 	return nil
 }
 
-func (self *PublishMQ) sendMessage(msg *MsgData) (bool, error) {
-	body, err := utils.JsonMarshal(msg)
+func (self *PublishMQ) sendMessage(ctx context.Context, msg *MsgData) (bool, error) {
+	return self.publish(ctx, msg, self.option.Exchange, self.option.Router, nil)
+}
+
+// publish 发送消息至指定交换机及路由, headers为附加消息头
+func (self *PublishMQ) publish(ctx context.Context, msg *MsgData, exchange, router string, headers amqp.Table) (bool, error) {
+	data, err := newPublishing(ctx, msg, headers)
 	if err != nil {
 		return false, err
 	}
-	data := amqp.Publishing{ContentType: "text/plain", Body: body}
-	if err := self.channel.Publish(self.option.Exchange, self.option.Router, false, false, data); err != nil {
+	if err := self.channel.Publish(exchange, router, false, false, data); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// newPublishing 序列化已签名消息, 写入实体key及trace上下文消息头
+func newPublishing(ctx context.Context, msg *MsgData, headers amqp.Table) (amqp.Publishing, error) {
+	body, err := utils.JsonMarshal(msg)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	data := amqp.Publishing{ContentType: "text/plain", Timestamp: time.Now(), Body: body, Headers: headers}
+	if len(msg.Key) > 0 {
+		if data.Headers == nil {
+			data.Headers = amqp.Table{}
+		}
+		data.Headers[entityKey] = msg.Key
+	}
+	data.Headers = injectHeaders(ctx, data.Headers)
+	return data, nil
+}
+
 func (self *PublishMQ) prepareExchange() error {
 	zlog.Println(fmt.Sprintf("rabbitmq publish init [%s - %s] successful", self.option.Kind, self.option.Exchange))
+	if topologyExchange(self.ds, self.option.Exchange) {
+		return nil
+	}
 	return self.channel.ExchangeDeclare(self.option.Exchange, self.option.Kind, true, false, false, false, nil)
 }
 
@@ -273,7 +326,13 @@ func (self *PublishMQ) prepareQueue() error {
 	if len(self.option.Queue) == 0 {
 		return nil
 	}
-	if q, err := self.channel.QueueDeclare(self.option.Queue, true, false, false, false, nil); err != nil {
+	if topologyQueue(self.ds, self.option.Queue) {
+		q, err := self.channel.QueueInspect(self.option.Queue)
+		if err != nil {
+			return err
+		}
+		self.queue = &q
+	} else if q, err := self.channel.QueueDeclare(self.option.Queue, true, false, false, false, nil); err != nil {
 		return err
 	} else {
 		self.queue = &q
@@ -283,3 +342,48 @@ func (self *PublishMQ) prepareQueue() error {
 	}
 	return nil
 }
+
+// PingPublish 检测所有已初始化的发布连接能否打开channel, 返回数据源名称对应的检测结果
+func PingPublish() map[string]error {
+	result := make(map[string]error, len(publishMgrs))
+	for k, v := range publishMgrs {
+		channel, err := v.openChannel()
+		if err != nil {
+			result[k] = utils.Error("rabbitmq [", k, "] open channel failed: ", err)
+			continue
+		}
+		if err := channel.Close(); err != nil {
+			zlog.Error("rabbitmq channel close failed", 0, zlog.AddError(err))
+		}
+		result[k] = nil
+	}
+	return result
+}
+
+// ClosePublish 关闭全部发布通道及连接
+func ClosePublish() map[string]error {
+	result := make(map[string]error, len(publishMgrs))
+	for k, v := range publishMgrs {
+		atomic.StoreInt32(&v.closed, 1)
+		v.mu0.Lock()
+		for _, pub := range v.channels {
+			if pub.channel == nil {
+				continue
+			}
+			if err := pub.channel.Close(); err != nil {
+				zlog.Warn("rabbitmq publish channel close failed", 0, zlog.String("queue", pub.option.Queue), zlog.AddError(err))
+			}
+		}
+		v.mu0.Unlock()
+		if v.conn == nil || v.conn.IsClosed() {
+			result[k] = nil
+			continue
+		}
+		if err := v.conn.Close(); err != nil {
+			result[k] = utils.Error("rabbitmq publish [", k, "] close failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
@@ -1,17 +1,31 @@
 package rabbitmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/godaddy-x/freego/cache"
 	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/promx"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/zlog"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	dedupPrefix     = "amqp:dedup:"
+	dedupProcessing = "processing"
+	dedupDone       = "done"
+)
+
 var (
 	pullMgrs = make(map[string]*PullManager)
+
+	errDedupProcessing = errors.New("rabbitmq pull message is processing")
 )
 
 type PullManager struct {
@@ -19,6 +33,7 @@ type PullManager struct {
 	conf      AmqpConfig
 	conn      *amqp.Connection
 	receivers []*PullReceiver
+	closed    int32 // 已关闭, 通道断开后不再重连
 }
 
 func (self *PullManager) InitConfig(input ...AmqpConfig) (*PullManager, error) {
@@ -61,7 +76,9 @@ func (self *PullManager) AddPullReceiver(receivers ...*PullReceiver) {
 }
 
 func (self *PullManager) start(receiver *PullReceiver) {
+	self.mu.Lock()
 	self.receivers = append(self.receivers, receiver)
+	self.mu.Unlock()
 	self.listen(receiver)
 	time.Sleep(100 * time.Millisecond)
 }
@@ -92,25 +109,21 @@ func (self *PullManager) openChannel() (*amqp.Channel, error) {
 }
 
 func (self *PullManager) getChannel() *amqp.Channel {
-	index := 0
-	for {
-		if index > 0 {
-			zlog.Warn("rabbitmq pull trying to connect again", 0, zlog.Int("tried", index))
-		}
-		channel, err := self.openChannel()
-		if err != nil {
-			zlog.Error("rabbitmq pull init Connection/Channel failed", 0, zlog.AddError(err))
-			time.Sleep(2500 * time.Millisecond)
-			index++
-			continue
-		}
-		return channel
-	}
+	var channel *amqp.Channel
+	_ = utils.Retry(context.Background(), channelRetry, func(ctx context.Context) (err error) {
+		channel, err = self.openChannel()
+		return err
+	})
+	return channel
 }
 
 func (self *PullManager) listen(receiver *PullReceiver) {
+	if err := checkTopic(receiver.Config.Option); err != nil {
+		receiver.OnError(err)
+		return
+	}
 	channel := self.getChannel()
-	receiver.channel = channel
+	receiver.mgr = self
 	exchange := receiver.Config.Option.Exchange
 	queue := receiver.Config.Option.Queue
 	kind := receiver.Config.Option.Kind
@@ -131,6 +144,11 @@ func (self *PullManager) listen(receiver *PullReceiver) {
 	}
 	if prefetchCount == 0 {
 		prefetchCount = 1
+		if receiver.Config.Lanes > 0 {
+			prefetchCount = receiver.Config.Lanes
+		} else if receiver.Config.Concurrency > 0 {
+			prefetchCount = receiver.Config.Concurrency
+		}
 	}
 	zlog.Println(fmt.Sprintf("rabbitmq pull init queue [%s - %s - %s - %s] successful...", kind, exchange, router, queue))
 	if err := self.prepareExchange(channel, exchange, kind); err != nil {
@@ -144,11 +162,25 @@ func (self *PullManager) listen(receiver *PullReceiver) {
 	if err := channel.Qos(prefetchCount, prefetchSize, false); err != nil {
 		receiver.OnError(fmt.Errorf("rabbitmq pull queue %s qos failed failed: %s", queue, err.Error()))
 	}
-	// 开启消费数据
-	msgs, err := channel.Consume(queue, "", false, false, false, false, nil)
+	// 开启消费数据, 已停止时不再重新订阅
+	tag := utils.AddStr(queue, "-", utils.NextSID())
+	drained := make(chan struct{})
+	if !receiver.setConsumer(channel, tag, drained) {
+		_ = channel.Close()
+		return
+	}
+	msgs, err := channel.Consume(queue, tag, false, false, false, false, nil)
 	if err != nil {
 		receiver.OnError(fmt.Errorf("rabbitmq pull get queue %s failed: %s", queue, err.Error()))
 	}
+	var lanes *laneGroup
+	if receiver.Config.Lanes > 0 {
+		lanes = newLaneGroup(receiver, channel, receiver.Config.Lanes)
+	} else if receiver.Config.Concurrency > 0 && receiver.Config.OrderByRouter {
+		lanes = newRouterGroup(receiver, channel, receiver.Config.Concurrency)
+	} else if receiver.Config.Concurrency > 0 {
+		lanes = newWorkerGroup(receiver, channel, receiver.Config.Concurrency)
+	}
 	closeChan := make(chan bool, 1)
 	go func(chan<- bool) {
 		mqErr := make(chan *amqp.Error)
@@ -160,18 +192,30 @@ func (self *PullManager) listen(receiver *PullReceiver) {
 	go func(<-chan bool) {
 		for {
 			select {
-			case d := <-msgs:
-				for !receiver.OnReceive(d.Body) {
-					delay := receiver.Delay
-					if delay == 0 {
-						delay = 5
+			case d, ok := <-msgs:
+				if !ok {
+					if atomic.LoadInt32(&receiver.stopped) == 1 { // 已取消消费, 等待处理中的消息完成
+						if lanes != nil {
+							lanes.close(true)
+						}
+						close(drained)
+						return
 					}
-					time.Sleep(time.Duration(delay) * time.Second)
+					msgs = nil // 通道已关闭, 等待重连信号
+					continue
 				}
-				if err := d.Ack(false); err != nil {
-					zlog.Error("rabbitmq pull received ack failed", 0, zlog.AddError(err))
+				if lanes != nil {
+					lanes.dispatch(d)
+					continue
 				}
+				receiver.handle(channel, d)
 			case <-closeChan:
+				if lanes != nil {
+					lanes.close(false)
+				}
+				if atomic.LoadInt32(&self.closed) == 1 || atomic.LoadInt32(&receiver.stopped) == 1 {
+					return
+				}
 				self.listen(receiver)
 				zlog.Warn("rabbitmq pull received channel exception, successful reconnected", 0, zlog.String("exchange", exchange), zlog.String("queue", queue))
 				return
@@ -180,11 +224,58 @@ func (self *PullManager) listen(receiver *PullReceiver) {
 	}(closeChan)
 }
 
+// handle 处理单条消息, 失败时按Delay间隔重试, 累计失败达到上限转入死信队列或按隔离配置重投, 完成后确认
+func (self *PullReceiver) handle(channel *amqp.Channel, d amqp.Delivery) {
+	ctx := extractHeaders(d.Headers)
+	redelivered := d.Redelivered
+	delay := self.Delay
+	if delay == 0 {
+		delay = 5
+	}
+	var dedupKey string
+	var waited int
+	for retries := 1; ; retries++ {
+		key, ok, err := self.receive(ctx, d.Body)
+		if err == errDedupProcessing { // 其他消费者处理中或处理中断, 等待完成标记或处理中标记过期后重新判断, 不计入重试次数
+			if waited >= self.dedupProcess() || atomic.LoadInt32(&self.stopped) == 1 {
+				// 等待超过处理中标记有效期或已停止消费时退回消息, 由服务端重新投递, 避免阻塞消费协程
+				zlog.Warn("rabbitmq pull message processing wait abandoned, requeued", 0, zlog.String("queue", self.Config.Option.Queue), zlog.Int("waited", waited))
+				if err := d.Nack(false, true); err != nil {
+					zlog.Error("rabbitmq pull received nack failed", 0, zlog.AddError(err))
+				}
+				return
+			}
+			retries--
+			waited += delay
+			time.Sleep(time.Duration(delay) * time.Second)
+			continue
+		}
+		dedupKey = key
+		promx.ObserveConsume(self.Config.Option.Exchange, self.Config.Option.Queue, redelivered, err)
+		redelivered = false // 本地重试不计入重复投递
+		if ok || self.settle(channel, d, retries, err) {
+			break
+		}
+		time.Sleep(time.Duration(delay) * time.Second)
+	}
+	if err := d.Ack(false); err != nil {
+		zlog.Error("rabbitmq pull received ack failed", 0, zlog.AddError(err))
+		return // 确认失败时消息将重新投递, 保留处理中标记至过期后再次消费
+	}
+	self.dedupDone(dedupKey)
+}
+
 func (self *PullManager) prepareExchange(channel *amqp.Channel, exchange, kind string) error {
+	if topologyExchange(self.conf.DsName, exchange) {
+		return nil
+	}
 	return channel.ExchangeDeclare(exchange, kind, true, false, false, false, nil)
 }
 
 func (self *PullManager) prepareQueue(channel *amqp.Channel, exchange, queue, router string) error {
+	if topologyQueue(self.conf.DsName, queue) {
+		return channel.QueueBind(queue, router, exchange, false, nil)
+	}
 	if _, err := channel.QueueDeclare(queue, true, false, false, false, nil); err != nil {
 		return err
 	}
@@ -194,22 +285,85 @@ func (self *PullManager) prepareQueue(channel *amqp.Channel, exchange, queue, ro
 	return nil
 }
 
+// Stop 停止消费: 取消订阅后等待已接收的消息处理完成再关闭通道, 未确认的预取消息由服务端重新投递
+// ctx控制最长等待时间, 超时后直接关闭通道
+func (self *PullReceiver) Stop(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&self.stopped, 0, 1) {
+		return nil
+	}
+	channel, tag, drained := self.consumer()
+	if channel == nil {
+		return nil
+	}
+	if err := channel.Cancel(tag, false); err != nil {
+		zlog.Warn("rabbitmq pull consumer cancel failed", 0, zlog.String("queue", self.Config.Option.Queue), zlog.AddError(err))
+	} else if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			zlog.Warn("rabbitmq pull consumer drain timeout", 0, zlog.String("queue", self.Config.Option.Queue))
+		}
+	}
+	self.parkMu.Lock()
+	self.closePark()
+	self.parkMu.Unlock()
+	return channel.Close()
+}
+
+// setConsumer 记录当前订阅的通道、消费者标识及完成信号, 已停止时返回false
+func (self *PullReceiver) setConsumer(channel *amqp.Channel, tag string, drained chan struct{}) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if atomic.LoadInt32(&self.stopped) == 1 {
+		return false
+	}
+	self.channel, self.tag, self.drained = channel, tag, drained
+	return true
+}
+
+// consumer 当前订阅的通道、消费者标识及完成信号
+func (self *PullReceiver) consumer() (*amqp.Channel, string, chan struct{}) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.channel, self.tag, self.drained
+}
+
 func (self *PullReceiver) OnError(err error) {
 	zlog.Error("rabbitmq pull receiver data failed", 0, zlog.AddError(err))
 }
 
 type PullReceiver struct {
+	mgr          *PullManager
+	mu           sync.Mutex // 保护channel/tag/drained, 重连协程与Stop/ClosePull并发访问
 	channel      *amqp.Channel
+	parkMu       sync.Mutex
+	park         *parkChannel  // 死信转发及失败重投的确认模式通道
+	tag          string        // 消费者标识
+	drained      chan struct{} // 取消消费后处理中的消息已完成
+	stopped      int32
+	deadLetter   int32 // 死信交换机及队列已声明
 	Config       *Config
 	ContentInter func(typ int64) interface{}
 	Callback     func(msg *MsgData) error
-	Debug        bool // 是否打印具体pull数据实体
-	Delay        int  // pull失败重试间隔
+	Debug        bool                        // 是否打印具体pull数据实体
+	Delay        int                         // pull失败重试间隔
+	DedupCache   func() (cache.Cache, error) // 消费去重缓存, 为空则不去重
+	DedupExpire  int                         // 去重有效期/秒, 默认86400
+	DedupProcess int                         // 处理中标记有效期/秒, 默认300, 应大于回调最长执行时间, 处理中断后标记过期可重新消费
 }
 
 func (self *PullReceiver) OnReceive(b []byte) bool {
+	key, ok, _ := self.receive(context.Background(), b)
+	if ok {
+		self.dedupDone(key)
+	}
+	return ok
+}
+
+// receive 返回false时携带回调错误, 用于毒消息识别, 回调成功时返回去重标记key, 确认后由dedupDone标记为已完成
+func (self *PullReceiver) receive(ctx context.Context, b []byte) (string, bool, error) {
 	if b == nil || len(b) == 0 || string(b) == "{}" || string(b) == "[]" {
-		return true
+		return "", true, nil
 	}
 	if self.Debug {
 		defer zlog.Debug("rabbitmq pull consumption data monitoring", utils.UnixMilli(), zlog.String("message", utils.Bytes2Str(b)))
@@ -219,66 +373,247 @@ func (self *PullReceiver) OnReceive(b []byte) bool {
 		zlog.Error("rabbitmq pull consumption data parsing failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg), zlog.AddError(err))
 	}
 	if msg.Content == nil {
-		return true
+		return "", true, nil
 	}
 	sigTyp := self.Config.Option.SigTyp
 	sigKey := self.Config.Option.SigKey
 
 	if len(msg.Signature) == 0 {
 		zlog.Error("rabbitmq pull consumption data signature is nil", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg))
-		return true
+		return "", true, nil
 	}
 	v, ok := msg.Content.(string)
 	if !ok {
 		zlog.Error("rabbitmq consumption data (non string type)", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg))
-		return true
+		return "", true, nil
 	}
 	if len(v) == 0 {
 		zlog.Error("rabbitmq consumption data is nil", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg))
-		return true
+		return "", true, nil
 	}
 	if msg.Signature != utils.HMAC_SHA256(utils.AddStr(v, msg.Nonce), sigKey, true) {
 		zlog.Error("rabbitmq consumption data signature invalid", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg))
-		return true
+		return "", true, nil
 	}
 	if sigTyp == 1 {
 		aesContent, err := utils.AesDecrypt2(v, sigKey)
 		if err != nil {
 			zlog.Error("rabbitmq consumption data aes decrypt failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg))
-			return true
+			return "", true, nil
 		}
 		v = utils.Bytes2Str(aesContent)
 	}
 	btv := utils.Base64Decode(v)
 	if btv == nil || len(btv) == 0 {
 		zlog.Error("rabbitmq pull consumption data Base64 parsing failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg))
-		return true
+		return "", true, nil
+	}
+	btv, err := decompress(msg.Encoding, btv)
+	if err != nil {
+		zlog.Error("rabbitmq pull consumption data decompress failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg), zlog.AddError(err))
+		return "", true, nil
 	}
 	if self.ContentInter == nil {
 		content := map[string]interface{}{}
 		if err := utils.JsonUnmarshal(btv, &content); err != nil {
 			zlog.Error("rabbitmq pull consumption data conversion type(Map) failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg), zlog.AddError(err))
-			return true
+			return "", true, nil
 		}
 		msg.Content = content
 	} else {
 		content := self.ContentInter(msg.Type)
 		if err := utils.JsonUnmarshal(btv, content); err != nil {
 			zlog.Error("rabbitmq pull consumption data conversion type(ContentInter) failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg), zlog.AddError(err))
-			return true
+			return "", true, nil
 		}
 		msg.Content = content
 	}
 
-	if err := self.Callback(msg); err != nil {
+	dedupKey, ok, err := self.dedup(msg)
+	if err != nil {
+		return "", false, err
+	}
+	if !ok {
+		return "", true, nil
+	}
+	ctx, span := startSpan(ctx, self.Config.Option, trace.SpanKindConsumer)
+	msg.ctx = ctx
+	err = self.Callback(msg)
+	endSpan(span, err)
+	if err != nil {
+		self.undedup(dedupKey)
 		if self.Debug {
 			zlog.Error("rabbitmq pull consumption data processing failed", 0, zlog.Any("option", self.Config.Option), zlog.Any("message", msg), zlog.AddError(err))
 		} else {
 			zlog.Error("rabbitmq pull consumption data processing failed", 0, zlog.Any("option", self.Config.Option), zlog.AddError(err))
 		}
 		if self.Config.IsNack {
-			return false
+			return "", false, err
 		}
+		return "", true, nil
 	}
-	return true
+	return dedupKey, true, nil
+}
+
+// dedup 以消息nonce为唯一标识写入短期处理中标记, 确认后标记为已完成, 已完成视为重复投递直接确认
+// 处理中标记存在时返回errDedupProcessing, 等待其他消费者完成或处理中断后标记过期再重新消费, 避免处理中断的消息被当作重复丢弃
+// 去重缓存不可用或读写失败时按正常消费处理, 不阻塞消费
+func (self *PullReceiver) dedup(msg *MsgData) (string, bool, error) {
+	if self.DedupCache == nil || len(msg.Nonce) == 0 {
+		return "", true, nil
+	}
+	c, err := self.DedupCache()
+	if err != nil {
+		zlog.Error("rabbitmq pull dedup cache invalid", 0, zlog.AddError(err))
+		return "", true, nil
+	}
+	key := utils.AddStr(dedupPrefix, self.Config.Option.Queue, ":", msg.Nonce)
+	b, err := c.PutNX(key, dedupProcessing, self.dedupProcess())
+	if err != nil {
+		zlog.Error("rabbitmq pull dedup cache put failed", 0, zlog.String("key", key), zlog.AddError(err))
+		return "", true, nil
+	}
+	if b {
+		return key, true, nil
+	}
+	state, err := c.GetString(key)
+	if err != nil {
+		zlog.Error("rabbitmq pull dedup cache get failed", 0, zlog.String("key", key), zlog.AddError(err))
+		return "", true, nil
+	}
+	if state != dedupDone {
+		return "", false, errDedupProcessing
+	}
+	zlog.Warn("rabbitmq pull duplicate message skipped", 0, zlog.String("queue", self.Config.Option.Queue), zlog.String("nonce", msg.Nonce))
+	return "", false, nil
+}
+
+// dedupProcess 处理中标记有效期/秒, 默认300
+func (self *PullReceiver) dedupProcess() int {
+	if self.DedupProcess <= 0 {
+		return 300
+	}
+	return self.DedupProcess
+}
+
+// dedupDone 消息确认后将处理中标记改为已完成, 按去重有效期保留
+func (self *PullReceiver) dedupDone(key string) {
+	if len(key) == 0 {
+		return
+	}
+	c, err := self.DedupCache()
+	if err != nil {
+		return
+	}
+	expire := self.DedupExpire
+	if expire <= 0 {
+		expire = 86400
+	}
+	if err := c.Put(key, dedupDone, expire); err != nil {
+		zlog.Error("rabbitmq pull dedup cache done failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+}
+
+// undedup 回调失败时释放占位, 保证重试消息可再次消费
+func (self *PullReceiver) undedup(key string) {
+	if len(key) == 0 {
+		return
+	}
+	c, err := self.DedupCache()
+	if err != nil {
+		return
+	}
+	if err := c.Del(key); err != nil {
+		zlog.Error("rabbitmq pull dedup cache del failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+}
+
+// GetConsumerLag 获取所有消费队列的积压消息数及消费者数量
+func GetConsumerLag() map[string][]QueueData {
+	result := make(map[string][]QueueData, len(pullMgrs))
+	for k, v := range pullMgrs {
+		result[k] = v.lag()
+	}
+	return result
+}
+
+func (self *PullManager) lag() []QueueData {
+	self.mu.Lock()
+	receivers := make([]*PullReceiver, len(self.receivers))
+	copy(receivers, self.receivers)
+	self.mu.Unlock()
+	channel, err := self.openChannel()
+	if err != nil {
+		zlog.Error("rabbitmq open channel failed", 0, zlog.AddError(err))
+		return nil
+	}
+	defer func() {
+		if err := channel.Close(); err != nil {
+			zlog.Error("rabbitmq channel close failed", 0, zlog.AddError(err))
+		}
+	}()
+	result := make([]QueueData, 0, len(receivers))
+	for _, v := range receivers {
+		queue, err := channel.QueueInspect(v.Config.Option.Queue)
+		if err != nil {
+			zlog.Error("rabbitmq queue inspect failed", 0, zlog.String("queue", v.Config.Option.Queue), zlog.AddError(err))
+			// QueueInspect失败会关闭channel, 后续队列无法继续检测
+			break
+		}
+		result = append(result, QueueData{Name: queue.Name, Consumers: queue.Consumers, Messages: queue.Messages})
+	}
+	return result
+}
+
+// DrainPull 停止全部消费者并等待处理中的消息完成, ctx控制最长等待时间, 之后应调用ClosePull关闭连接
+func DrainPull(ctx context.Context) map[string]error {
+	result := make(map[string]error, len(pullMgrs))
+	for k, v := range pullMgrs {
+		atomic.StoreInt32(&v.closed, 1)
+		v.mu.Lock()
+		receivers := make([]*PullReceiver, len(v.receivers))
+		copy(receivers, v.receivers)
+		v.mu.Unlock()
+		var errs []error
+		for _, receiver := range receivers {
+			if err := receiver.Stop(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			result[k] = utils.Error("rabbitmq pull [", k, "] drain failed: ", &utils.MultiError{Errors: errs})
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
+
+// ClosePull 停止全部消费者并关闭连接, 未确认的消息由服务端重新投递
+func ClosePull() map[string]error {
+	result := make(map[string]error, len(pullMgrs))
+	for k, v := range pullMgrs {
+		atomic.StoreInt32(&v.closed, 1)
+		v.mu.Lock()
+		for _, receiver := range v.receivers {
+			channel, _, _ := receiver.consumer()
+			if channel == nil || atomic.LoadInt32(&receiver.stopped) == 1 {
+				continue
+			}
+			if err := channel.Close(); err != nil {
+				zlog.Warn("rabbitmq pull channel close failed", 0, zlog.String("queue", receiver.Config.Option.Queue), zlog.AddError(err))
+			}
+		}
+		v.mu.Unlock()
+		if v.conn == nil || v.conn.IsClosed() {
+			result[k] = nil
+			continue
+		}
+		if err := v.conn.Close(); err != nil {
+			result[k] = utils.Error("rabbitmq pull [", k, "] close failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
 }
@@ -0,0 +1,83 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+const (
+	failureCount = "x-failure-count"
+	failureClass = "x-failure-class"
+)
+
+// Quarantine 毒消息隔离配置, 相同错误类别连续失败达到上限后转入死信队列
+// 未达上限时累加消息头失败次数并经确认重投到当前队列队尾, 失败次数随消息保存, 不依赖进程内存
+type Quarantine struct {
+	MaxFailures int                         // 相同错误类别连续失败上限, 默认3
+	ErrorClass  func(err error) string      // 错误分类, 默认按异常code/类型区分
+	Alert       func(event QuarantineEvent) // 隔离告警回调
+}
+
+// QuarantineEvent 毒消息隔离事件
+type QuarantineEvent struct {
+	Queue      string
+	Quarantine string // 转入的死信队列
+	Class      string
+	Failures   int
+	Error      string
+	Body       []byte
+}
+
+func defaultErrorClass(err error) string {
+	if throw, ok := err.(ex.Throw); ok {
+		return utils.AnyToStr(throw.Code)
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// quarantine 回调失败后累加消息头失败次数并重新投递到当前队列队尾, 达到上限则转入死信队列
+// 返回true表示原消息已转移, 可直接确认
+func (self *PullReceiver) quarantine(d amqp.Delivery, failures int, cause error) bool {
+	q := self.Config.Quarantine
+	max := q.MaxFailures
+	if max <= 0 {
+		max = 3
+	}
+	class := defaultErrorClass(cause)
+	if q.ErrorClass != nil {
+		class = q.ErrorClass(cause)
+	}
+	count := 1
+	if v, b := d.Headers[failureClass]; b && utils.AnyToStr(v) == class {
+		if c, err := utils.StrToInt(utils.AnyToStr(d.Headers[failureCount])); err == nil {
+			count = c + 1
+		}
+	}
+	queue := self.Config.Option.Queue
+	if count >= max {
+		if !self.parkDeadLetter(d, failures, cause) {
+			return false
+		}
+		event := QuarantineEvent{Queue: queue, Quarantine: self.Config.DeadLetterQueueName(), Class: class, Failures: count, Error: cause.Error(), Body: d.Body}
+		zlog.Error("rabbitmq pull poison message quarantined", 0, zlog.String("queue", queue), zlog.String("dlq", event.Quarantine), zlog.String("class", class), zlog.Int("failures", count), zlog.AddError(cause))
+		if q.Alert != nil {
+			q.Alert(event)
+		}
+		return true
+	}
+	headers := originHeaders(d)
+	headers[failureCount] = int32(count)
+	headers[failureClass] = class
+	headers[deadLetterRetries] = int32(failures)
+	data := amqp.Publishing{ContentType: d.ContentType, Headers: headers, Timestamp: time.Now(), Body: d.Body}
+	// 经默认交换机直接投递到当前队列, 避免fanout/topic交换机将消息重复投递到其他绑定队列
+	if err := self.publishConfirm("", queue, data); err != nil {
+		zlog.Error("rabbitmq pull failure message republish failed", 0, zlog.String("queue", queue), zlog.AddError(err))
+		return false
+	}
+	return true
+}
@@ -1,8 +1,10 @@
 package rabbitmq
 
 import (
+	"context"
 	"fmt"
 	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
 	"github.com/streadway/amqp"
 	"net"
 	"time"
@@ -19,6 +21,10 @@ type AmqpConfig struct {
 	Username  string
 	Password  string
 	SecretKey string
+	Payload   PayloadOption // 消息内容压缩与大小限制
+	Delayed   string        // 延迟消息实现 plugin/ttl, 为空时自动检测是否安装rabbitmq_delayed_message_exchange插件
+	// 确认模式发送等待broker确认超时/毫秒, 默认10000, ctx设置截止时间时以较早者为准
+	ConfirmTimeout int
 }
 
 type Option struct {
@@ -39,6 +45,13 @@ type MsgData struct {
 	Retries   int64       `json:"rt"`
 	Nonce     string      `json:"no"`
 	Signature string      `json:"sg"`
+	ReplyTo   string      `json:"rp,omitempty"` // RPC回复队列
+	CorrId    string      `json:"ci,omitempty"` // RPC请求关联ID
+	Trace     string      `json:"tc,omitempty"` // 链路追踪ID
+	Error     string      `json:"er,omitempty"` // RPC处理失败信息
+	Encoding  string      `json:"ce,omitempty"` // 内容压缩算法 gzip/zstd
+	Key       string      `json:"-"`            // 实体key, 通过消息头x-entity-key传递, 相同key有序消费
+	ctx       context.Context
 }
 
 type DLX struct {
@@ -57,6 +70,23 @@ type Config struct {
 	PrefetchSize  int
 	IsNack        bool
 	AutoAck       bool
+	Quarantine    *Quarantine // 毒消息隔离, 仅IsNack开启时生效
+	Lanes         int         // 按实体key有序消费的并发通道数, 0则串行消费
+	Concurrency   int         // 并发消费协程数, 0则串行消费, 与Lanes同时设置时Lanes优先
+	OrderByRouter bool        // 并发消费时同一路由key的消息是否顺序处理
+	// 回调累计失败(含历史投递)达到该次数后转入死信队列, 优先于隔离判断, 0则按Delay间隔无限重试, 仅IsNack开启时生效
+	MaxRetries         int
+	DeadLetterExchange string // 死信交换机, 默认{queue}.dlx
+	DeadLetterQueue    string // 死信队列, 默认{queue}.dlq
+}
+
+// channelRetry 连接/通道打开失败时固定间隔无限重试
+var channelRetry = utils.RetryPolicy{
+	InitialInterval: 2500 * time.Millisecond,
+	Multiplier:      1,
+	OnRetry: func(attempt int, delay time.Duration, err error) {
+		zlog.Error("rabbitmq init Connection/Channel failed, trying to connect again", 0, zlog.Int("tried", attempt), zlog.AddError(err))
+	},
 }
 
 func ConnectRabbitMQ(conf AmqpConfig) (*amqp.Connection, error) {
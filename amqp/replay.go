@@ -0,0 +1,227 @@
+package rabbitmq
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+// ReplayFilter 死信/归档消息筛选条件
+type ReplayFilter struct {
+	Headers map[string]interface{} // 消息头需全部匹配
+	Since   int64                  // 消息发送时间下限/毫秒, 0不限制
+	Until   int64                  // 消息发送时间上限/毫秒, 0不限制
+	Match   func(msg *MsgData) bool
+}
+
+// ReplayMessage 浏览结果
+type ReplayMessage struct {
+	Offset    int // 消息在本次扫描中的位置, 从0开始
+	Exchange  string
+	Router    string
+	Headers   amqp.Table
+	Timestamp int64
+	Message   *MsgData
+}
+
+// ReplayRequest 消息重放请求
+type ReplayRequest struct {
+	Queue    string       // 死信或归档队列
+	Limit    int          // 单次最多扫描消息数, 默认100
+	Filter   ReplayFilter // 筛选条件
+	Headers  amqp.Table   // 重放时覆盖/追加的消息头
+	Exchange string       // 为空时使用原始交换机
+	Router   string       // 为空时使用原始路由
+	Operator string       // 操作人, 写入审计记录
+	Audit    string       // 审计队列, 默认freego.replay.audit
+}
+
+// ReplayAudit 消息重放审计记录, 以持久化消息写入审计队列, 先于重放消息写入
+type ReplayAudit struct {
+	Operator string `json:"operator"`
+	Queue    string `json:"queue"`
+	Exchange string `json:"exchange"`
+	Router   string `json:"router"`
+	Nonce    string `json:"nonce"`
+	Time     int64  `json:"time"`
+}
+
+const replayAuditQueue = "freego.replay.audit"
+
+func (self ReplayFilter) match(d amqp.Delivery, msg *MsgData) bool {
+	for k, v := range self.Headers {
+		if hv, b := d.Headers[k]; !b || utils.AnyToStr(hv) != utils.AnyToStr(v) {
+			return false
+		}
+	}
+	ts := d.Timestamp.UnixMilli()
+	if self.Since > 0 && ts < self.Since {
+		return false
+	}
+	if self.Until > 0 && ts > self.Until {
+		return false
+	}
+	if self.Match != nil && !self.Match(msg) {
+		return false
+	}
+	return true
+}
+
+// originRoute 优先读取消息体中的原始路由, 其次读取死信转发头及x-death头
+func originRoute(d amqp.Delivery, msg *MsgData) (string, string) {
+	if len(msg.Option.Exchange) > 0 {
+		router := msg.Option.Router
+		if len(router) == 0 {
+			router = msg.Option.Queue
+		}
+		return msg.Option.Exchange, router
+	}
+	if exchange, b := d.Headers[originalExchange].(string); b {
+		router, _ := d.Headers[originalRoutingKey].(string)
+		return exchange, router
+	}
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) > 0 {
+		if death, b := deaths[0].(amqp.Table); b {
+			exchange, _ := death["exchange"].(string)
+			var router string
+			if keys, b := death["routing-keys"].([]interface{}); b && len(keys) > 0 {
+				router, _ = keys[0].(string)
+			}
+			return exchange, router
+		}
+	}
+	return d.Exchange, d.RoutingKey
+}
+
+// scan 拉取队列消息并逐条回调, 回调返回true则ack, 否则在扫描结束后统一nack回队列, 返回拉取的消息数
+func (self *PublishManager) scan(queue string, limit int, call func(i int, d amqp.Delivery, msg *MsgData) (bool, error)) (int, error) {
+	if len(queue) == 0 {
+		return 0, utils.Error("rabbitmq replay queue is nil")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	channel := self.getChannel()
+	defer channel.Close()
+	var pending []amqp.Delivery
+	defer func() {
+		for _, d := range pending {
+			if err := d.Nack(false, true); err != nil {
+				zlog.Error("rabbitmq replay nack failed", 0, zlog.String("queue", queue), zlog.AddError(err))
+			}
+		}
+	}()
+	for i := 0; i < limit; i++ {
+		d, ok, err := channel.Get(queue, false)
+		if err != nil {
+			return i, err
+		}
+		if !ok {
+			return i, nil
+		}
+		msg := &MsgData{}
+		if err := utils.JsonUnmarshal(d.Body, msg); err != nil {
+			zlog.Error("rabbitmq replay message parsing failed", 0, zlog.String("queue", queue), zlog.AddError(err))
+			pending = append(pending, d)
+			continue
+		}
+		ack, err := call(i, d, msg)
+		if err != nil {
+			pending = append(pending, d)
+			return i + 1, err
+		}
+		if !ack {
+			pending = append(pending, d)
+			continue
+		}
+		if err := d.Ack(false); err != nil {
+			return i + 1, err
+		}
+	}
+	return limit, nil
+}
+
+// Browse 分页浏览死信/归档队列中的消息, 消息保留在队列中
+// 跳过前offset条后最多扫描limit条(默认100), 返回下一页offset, 队列已扫描完时返回-1
+// 扫描期间消息处于未确认状态, 结束后按原顺序回到队列, 并发消费或重放会导致偏移变化
+func (self *PublishManager) Browse(queue string, offset, limit int, filter ReplayFilter) ([]ReplayMessage, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	result := make([]ReplayMessage, 0)
+	scanned, err := self.scan(queue, offset+limit, func(i int, d amqp.Delivery, msg *MsgData) (bool, error) {
+		if i >= offset && filter.match(d, msg) {
+			exchange, router := originRoute(d, msg)
+			result = append(result, ReplayMessage{Offset: i, Exchange: exchange, Router: router, Headers: d.Headers, Timestamp: d.Timestamp.UnixMilli(), Message: msg})
+		}
+		return false, nil
+	})
+	if err != nil {
+		return result, offset, err
+	}
+	if scanned < offset+limit {
+		return result, -1, nil
+	}
+	return result, offset + limit, nil
+}
+
+// Replay 将死信/归档队列中符合条件的消息重新发布到原始交换机, 返回重放数量
+// 每条消息重放前写入持久化审计记录至审计队列, 审计记录写入失败时停止重放
+func (self *PublishManager) Replay(req ReplayRequest) (int, error) {
+	if len(req.Operator) == 0 {
+		return 0, utils.Error("rabbitmq replay operator is nil")
+	}
+	if len(req.Audit) == 0 {
+		req.Audit = replayAuditQueue
+	}
+	count := 0
+	channel := self.getChannel()
+	defer channel.Close()
+	if _, err := channel.QueueDeclare(req.Audit, true, false, false, false, nil); err != nil {
+		return 0, utils.Error("rabbitmq replay audit queue declare failed: ", err)
+	}
+	_, err := self.scan(req.Queue, req.Limit, func(i int, d amqp.Delivery, msg *MsgData) (bool, error) {
+		if !req.Filter.match(d, msg) {
+			return false, nil
+		}
+		exchange, router := originRoute(d, msg)
+		if len(req.Exchange) > 0 {
+			exchange = req.Exchange
+		}
+		if len(req.Router) > 0 {
+			router = req.Router
+		}
+		headers := amqp.Table{}
+		for k, v := range d.Headers {
+			if k == "x-death" || k == failureCount || k == failureClass || isDeadLetterHeader(k) {
+				continue
+			}
+			headers[k] = v
+		}
+		for k, v := range req.Headers {
+			headers[k] = v
+		}
+		headers["x-replay-by"] = req.Operator
+		headers["x-replay-time"] = utils.UnixMilli()
+		audit, err := utils.JsonMarshal(&ReplayAudit{Operator: req.Operator, Queue: req.Queue, Exchange: exchange, Router: router, Nonce: msg.Nonce, Time: utils.UnixMilli()})
+		if err != nil {
+			return false, err
+		}
+		if err := channel.Publish("", req.Audit, false, false, amqp.Publishing{ContentType: "application/json", DeliveryMode: amqp.Persistent, Timestamp: time.Now(), Body: audit}); err != nil {
+			return false, utils.Error("rabbitmq replay audit write failed: ", err)
+		}
+		data := amqp.Publishing{ContentType: d.ContentType, Headers: headers, Timestamp: time.Now(), Body: d.Body}
+		if err := channel.Publish(exchange, router, false, false, data); err != nil {
+			return false, err
+		}
+		count++
+		zlog.Info("rabbitmq replay message", 0, zlog.String("operator", req.Operator), zlog.String("queue", req.Queue), zlog.String("exchange", exchange), zlog.String("router", router), zlog.String("nonce", msg.Nonce))
+		return true, nil
+	})
+	return count, err
+}
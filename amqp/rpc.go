@@ -0,0 +1,175 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+// rpcClient 基于回复队列与关联ID的请求/响应客户端, 每个PublishManager共享一个回复队列消费者
+type rpcClient struct {
+	mu      sync.Mutex
+	channel *amqp.Channel
+	queue   string
+	calls   map[string]chan []byte
+}
+
+func (self *PublishManager) getRpcClient() (*rpcClient, error) {
+	self.mu0.Lock()
+	defer self.mu0.Unlock()
+	if self.rpc != nil {
+		return self.rpc, nil
+	}
+	channel := self.getChannel()
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := channel.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &rpcClient{channel: channel, queue: queue.Name, calls: make(map[string]chan []byte)}
+	go func() {
+		for d := range msgs {
+			client.mu.Lock()
+			call, b := client.calls[d.CorrelationId]
+			delete(client.calls, d.CorrelationId)
+			client.mu.Unlock()
+			if !b {
+				zlog.Warn("rabbitmq rpc reply discarded", 0, zlog.String("corrId", d.CorrelationId))
+				continue
+			}
+			call <- d.Body
+		}
+		// 通道关闭后重建回复队列, 未完成的请求等待超时
+		self.mu0.Lock()
+		if self.rpc == client {
+			self.rpc = nil
+		}
+		self.mu0.Unlock()
+		zlog.Warn("rabbitmq rpc reply channel closed", 0, zlog.String("queue", client.queue))
+	}()
+	self.rpc = client
+	return client, nil
+}
+
+// Call 发送RPC请求并等待响应, result为响应内容的解析对象, timeout默认10s
+func (self *PublishManager) Call(data *MsgData, result interface{}, timeout time.Duration) error {
+	if data == nil {
+		return utils.Error("rabbitmq rpc data empty")
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	client, err := self.getRpcClient()
+	if err != nil {
+		return err
+	}
+	data.ReplyTo = client.queue
+	data.CorrId = utils.NextSID()
+	if len(data.Trace) == 0 {
+		data.Trace = data.CorrId
+	}
+	call := make(chan []byte, 1)
+	client.mu.Lock()
+	client.calls[data.CorrId] = call
+	client.mu.Unlock()
+	defer func() {
+		client.mu.Lock()
+		delete(client.calls, data.CorrId)
+		client.mu.Unlock()
+	}()
+	if err := self.PublishMsgData(data); err != nil {
+		return err
+	}
+	select {
+	case body := <-call:
+		return self.decodeReply(body, result)
+	case <-time.After(timeout):
+		return utils.Error("rabbitmq rpc call [", data.Option.Queue, "] timeout")
+	}
+}
+
+// decodeReply 复用消费者验签/解密流程解析响应
+func (self *PublishManager) decodeReply(body []byte, result interface{}) error {
+	head := &MsgData{}
+	if err := utils.JsonUnmarshal(body, head); err != nil {
+		return err
+	}
+	if len(head.Error) > 0 {
+		return utils.Error(head.Error)
+	}
+	var reply *MsgData
+	receiver := &PullReceiver{
+		Config: &Config{Option: Option{SigTyp: head.Option.SigTyp, SigKey: utils.HMAC_SHA512(self.conf.SecretKey, utils.GetLocalSecretKey())}},
+		Callback: func(msg *MsgData) error {
+			reply = msg
+			return nil
+		},
+	}
+	if result != nil {
+		receiver.ContentInter = func(typ int64) interface{} { return result }
+	}
+	receiver.receive(context.Background(), body)
+	if reply == nil {
+		return utils.Error("rabbitmq rpc reply invalid")
+	}
+	return nil
+}
+
+// Reply 向RPC请求方发送响应, err不为空时响应失败信息
+func (self *PublishManager) Reply(request *MsgData, content interface{}, err error) error {
+	if len(request.ReplyTo) == 0 || len(request.CorrId) == 0 {
+		return utils.Error("rabbitmq rpc request reply queue is nil")
+	}
+	client, e := self.getRpcClient()
+	if e != nil {
+		return e
+	}
+	if len(self.conf.SecretKey) == 0 {
+		return utils.Error("rabbitmq publish SecretKey is nil")
+	}
+	reply := &MsgData{
+		Option:  Option{SigTyp: request.Option.SigTyp, SigKey: utils.HMAC_SHA512(self.conf.SecretKey, utils.GetLocalSecretKey())},
+		Type:    request.Type,
+		Content: content,
+		Nonce:   utils.RandNonce(),
+		CorrId:  request.CorrId,
+		Trace:   request.Trace,
+	}
+	if content == nil {
+		reply.Content = map[string]interface{}{}
+	}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	if err := reply.sign(self.conf.Payload); err != nil {
+		return err
+	}
+	body, e := utils.JsonMarshal(reply)
+	if e != nil {
+		return e
+	}
+	data := amqp.Publishing{ContentType: "text/plain", CorrelationId: request.CorrId, Timestamp: time.Now(), Body: body}
+	data.Headers = injectHeaders(request.Context(), nil)
+	return client.channel.Publish("", request.ReplyTo, false, false, data)
+}
+
+// RpcCallback 包装RPC处理函数为PullReceiver回调, 处理结果自动响应给请求方
+func RpcCallback(publisher *PublishManager, handler func(msg *MsgData) (interface{}, error)) func(msg *MsgData) error {
+	return func(msg *MsgData) error {
+		result, err := handler(msg)
+		if len(msg.ReplyTo) == 0 {
+			return err
+		}
+		if e := publisher.Reply(msg, result, err); e != nil {
+			zlog.Error("rabbitmq rpc reply failed", 0, zlog.String("trace", msg.Trace), zlog.AddError(e))
+			return e
+		}
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package rabbitmq
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const envHolder = "{env}"
+
+var (
+	topicPattern  = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+	topicRegistry = &TopicRegistry{topics: make(map[string]Topic)}
+)
+
+// Topic 消息主题定义, Exchange/Queue/Router支持{env}环境占位符
+type Topic struct {
+	Name     string // 主题名称, 业务代码通过名称发布/订阅
+	Exchange string
+	Queue    string
+	Router   string // 为空时与Queue一致
+	Kind     string // 为空时为direct
+}
+
+// TopicRegistry 主题注册表, 注册后发布/订阅仅允许使用已注册的交换机与队列
+type TopicRegistry struct {
+	mu     sync.RWMutex
+	env    string
+	topics map[string]Topic
+}
+
+func (self *TopicRegistry) resolve(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	if strings.Contains(s, envHolder) {
+		return strings.ReplaceAll(s, envHolder, self.env)
+	}
+	if len(self.env) > 0 {
+		return utils.AddStr(self.env, ".", s)
+	}
+	return s
+}
+
+// RegisterTopics 注册主题并校验命名规范, 任一主题非法则全部不生效
+// env为环境前缀, 例: dev/test/prod, 未使用{env}占位符的名称自动添加前缀
+func RegisterTopics(env string, topics ...Topic) error {
+	if len(env) > 0 && !topicPattern.MatchString(env) {
+		return utils.Error("rabbitmq topic env [", env, "] invalid")
+	}
+	registry := &TopicRegistry{env: env, topics: make(map[string]Topic, len(topics))}
+	queues := make(map[string]string, len(topics))
+	for _, v := range topics {
+		if len(v.Name) == 0 {
+			return utils.Error("rabbitmq topic name is nil")
+		}
+		if _, b := registry.topics[v.Name]; b {
+			return utils.Error("rabbitmq topic [", v.Name, "] duplicate")
+		}
+		if len(v.Exchange) == 0 {
+			return utils.Error("rabbitmq topic [", v.Name, "] exchange is nil")
+		}
+		if len(v.Kind) == 0 {
+			v.Kind = direct
+		}
+		if !utils.CheckStr(v.Kind, direct, fanout, topic) {
+			return utils.Error("rabbitmq topic [", v.Name, "] kind [", v.Kind, "] invalid")
+		}
+		if len(v.Router) == 0 {
+			v.Router = v.Queue
+		}
+		v.Exchange = registry.resolve(v.Exchange)
+		v.Queue = registry.resolve(v.Queue)
+		if v.Kind != topic {
+			v.Router = registry.resolve(v.Router)
+		}
+		for _, name := range []string{v.Exchange, v.Queue} {
+			if len(name) > 0 && !topicPattern.MatchString(name) {
+				return utils.Error("rabbitmq topic [", v.Name, "] name [", name, "] invalid")
+			}
+		}
+		if len(v.Queue) > 0 {
+			if exchange, b := queues[v.Queue]; b && exchange != v.Exchange {
+				return utils.Error("rabbitmq topic [", v.Name, "] queue [", v.Queue, "] bound to multiple exchanges")
+			}
+			queues[v.Queue] = v.Exchange
+		}
+		registry.topics[v.Name] = v
+	}
+	topicRegistry.mu.Lock()
+	topicRegistry.env = registry.env
+	topicRegistry.topics = registry.topics
+	topicRegistry.mu.Unlock()
+	return nil
+}
+
+// GetTopic 根据名称获取已注册主题
+func GetTopic(name string) (Topic, error) {
+	topicRegistry.mu.RLock()
+	defer topicRegistry.mu.RUnlock()
+	v, b := topicRegistry.topics[name]
+	if !b {
+		return Topic{}, utils.Error("rabbitmq topic [", name, "] not registered")
+	}
+	return v, nil
+}
+
+// Option 转换为发布/订阅参数
+func (self Topic) Option() Option {
+	return Option{Exchange: self.Exchange, Queue: self.Queue, Router: self.Router, Kind: self.Kind}
+}
+
+// checkTopic 已注册主题时, 拒绝未注册的交换机/队列, 避免拼写错误产生孤立队列
+func checkTopic(option Option) error {
+	topicRegistry.mu.RLock()
+	defer topicRegistry.mu.RUnlock()
+	if len(topicRegistry.topics) == 0 {
+		return nil
+	}
+	for _, v := range topicRegistry.topics {
+		if v.Exchange != option.Exchange {
+			continue
+		}
+		if len(option.Queue) == 0 || v.Queue == option.Queue {
+			return nil
+		}
+	}
+	return utils.Error("rabbitmq exchange [", option.Exchange, "] queue [", option.Queue, "] not registered")
+}
+
+// PublishTopic 按主题名称发布消息
+func (self *PublishManager) PublishTopic(name string, dataType int64, content interface{}) error {
+	v, err := GetTopic(name)
+	if err != nil {
+		return err
+	}
+	return self.PublishMsgData(&MsgData{Option: v.Option(), Type: dataType, Content: content})
+}
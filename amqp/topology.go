@@ -0,0 +1,252 @@
+package rabbitmq
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/streadway/amqp"
+	"sync"
+)
+
+// 启动时统一声明交换机/队列/绑定, 参数冲突(durable/exclusive/队列类型等)在启动阶段暴露
+// 已声明的交换机/队列在发布/订阅时不再按默认参数重复声明, 避免与声明参数不一致导致通道关闭
+// 声明记录按数据源区分, 同一数据源的发布与订阅共享, 不同broker之间互不影响
+
+const headersKind = "headers"
+
+var (
+	topologyMu sync.RWMutex
+	topologies = make(map[string]*declaredTopology) // 数据源 -> 已声明拓扑
+)
+
+type declaredTopology struct {
+	exchanges map[string]struct{}
+	queues    map[string]struct{}
+}
+
+// Topology 拓扑声明
+type Topology struct {
+	Exchanges []ExchangeSpec
+	Queues    []QueueSpec
+	Bindings  []BindingSpec
+}
+
+// ExchangeSpec 交换机声明
+type ExchangeSpec struct {
+	Name       string
+	Kind       string // direct/fanout/topic/headers/x-delayed-message, 默认direct
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Args       amqp.Table
+}
+
+// QueueSpec 队列声明
+type QueueSpec struct {
+	Name               string
+	Durable            bool
+	AutoDelete         bool
+	Exclusive          bool
+	Quorum             bool   // 仲裁队列, 需Durable且不可Exclusive/AutoDelete
+	MessageTTL         int64  // 消息过期时间/毫秒, x-message-ttl
+	MaxLength          int64  // 最大消息数, x-max-length
+	DeadLetterExchange string // 死信交换机, x-dead-letter-exchange
+	DeadLetterRouter   string // 死信路由, x-dead-letter-routing-key
+	Args               amqp.Table
+}
+
+// BindingSpec 队列绑定声明
+type BindingSpec struct {
+	Queue    string
+	Exchange string
+	Router   string // 为空时与Queue一致
+	Args     amqp.Table
+}
+
+func (self *ExchangeSpec) validate() error {
+	if len(self.Name) == 0 {
+		return utils.Error("rabbitmq topology exchange name is nil")
+	}
+	if len(self.Kind) == 0 {
+		self.Kind = direct
+	}
+	if !utils.CheckStr(self.Kind, direct, fanout, topic, headersKind, delayedKind) {
+		return utils.Error("rabbitmq topology exchange [", self.Name, "] kind [", self.Kind, "] invalid")
+	}
+	if self.Kind == delayedKind {
+		if _, b := self.Args["x-delayed-type"]; !b {
+			return utils.Error("rabbitmq topology exchange [", self.Name, "] x-delayed-type is nil")
+		}
+	}
+	return nil
+}
+
+func (self *QueueSpec) validate() error {
+	if len(self.Name) == 0 {
+		return utils.Error("rabbitmq topology queue name is nil")
+	}
+	if self.Quorum && (!self.Durable || self.Exclusive || self.AutoDelete) {
+		return utils.Error("rabbitmq topology quorum queue [", self.Name, "] must be durable and not exclusive/auto-delete")
+	}
+	if self.Exclusive && self.Durable {
+		zlog.Warn("rabbitmq topology exclusive queue is deleted when connection closed", 0, zlog.String("queue", self.Name))
+	}
+	return nil
+}
+
+func (self *QueueSpec) args() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range self.Args {
+		args[k] = v
+	}
+	if self.Quorum {
+		args["x-queue-type"] = "quorum"
+	}
+	if self.MessageTTL > 0 {
+		args["x-message-ttl"] = self.MessageTTL
+	}
+	if self.MaxLength > 0 {
+		args["x-max-length"] = self.MaxLength
+	}
+	if len(self.DeadLetterExchange) > 0 {
+		args["x-dead-letter-exchange"] = self.DeadLetterExchange
+	}
+	if len(self.DeadLetterRouter) > 0 {
+		args["x-dead-letter-routing-key"] = self.DeadLetterRouter
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// validate 校验拓扑参数及绑定引用, 绑定的交换机/队列需在本次或之前同一数据源的拓扑中声明
+func (self *Topology) validate(ds string) error {
+	exchanges := make(map[string]struct{}, len(self.Exchanges))
+	queues := make(map[string]struct{}, len(self.Queues))
+	for i := range self.Exchanges {
+		v := &self.Exchanges[i]
+		if err := v.validate(); err != nil {
+			return err
+		}
+		if _, b := exchanges[v.Name]; b {
+			return utils.Error("rabbitmq topology exchange [", v.Name, "] duplicate")
+		}
+		exchanges[v.Name] = struct{}{}
+	}
+	for i := range self.Queues {
+		v := &self.Queues[i]
+		if err := v.validate(); err != nil {
+			return err
+		}
+		if _, b := queues[v.Name]; b {
+			return utils.Error("rabbitmq topology queue [", v.Name, "] duplicate")
+		}
+		queues[v.Name] = struct{}{}
+	}
+	for i := range self.Bindings {
+		v := &self.Bindings[i]
+		if len(v.Router) == 0 {
+			v.Router = v.Queue
+		}
+		if _, b := exchanges[v.Exchange]; !b && !topologyExchange(ds, v.Exchange) {
+			return utils.Error("rabbitmq topology binding exchange [", v.Exchange, "] not declared")
+		}
+		if _, b := queues[v.Queue]; !b && !topologyQueue(ds, v.Queue) {
+			return utils.Error("rabbitmq topology binding queue [", v.Queue, "] not declared")
+		}
+	}
+	return nil
+}
+
+// DeclareTopology 校验并声明交换机/队列/绑定, 任一声明失败时继续声明其余项并返回全部错误
+func (self *PublishManager) DeclareTopology(spec Topology) error {
+	if err := spec.validate(self.conf.DsName); err != nil {
+		return err
+	}
+	channel := self.getChannel()
+	var errs []error
+	// 声明失败时服务端关闭通道, 重新打开后继续
+	declare := func(call func(channel *amqp.Channel) error) bool {
+		if err := call(channel); err != nil {
+			errs = append(errs, err)
+			channel = self.getChannel()
+			return false
+		}
+		return true
+	}
+	for _, v := range spec.Exchanges {
+		v := v
+		if declare(func(channel *amqp.Channel) error {
+			if err := channel.ExchangeDeclare(v.Name, v.Kind, v.Durable, v.AutoDelete, v.Internal, false, v.Args); err != nil {
+				return utils.Error("rabbitmq topology exchange [", v.Name, "] declare failed: ", err)
+			}
+			return nil
+		}) {
+			addTopology(self.conf.DsName, v.Name, true)
+		}
+	}
+	for _, v := range spec.Queues {
+		v := v
+		if declare(func(channel *amqp.Channel) error {
+			if _, err := channel.QueueDeclare(v.Name, v.Durable, v.AutoDelete, v.Exclusive, false, v.args()); err != nil {
+				return utils.Error("rabbitmq topology queue [", v.Name, "] declare failed: ", err)
+			}
+			return nil
+		}) {
+			addTopology(self.conf.DsName, v.Name, false)
+		}
+	}
+	for _, v := range spec.Bindings {
+		v := v
+		declare(func(channel *amqp.Channel) error {
+			if err := channel.QueueBind(v.Queue, v.Router, v.Exchange, false, v.Args); err != nil {
+				return utils.Error("rabbitmq topology bind queue [", v.Queue, "] to exchange [", v.Exchange, "] failed: ", err)
+			}
+			return nil
+		})
+	}
+	if err := channel.Close(); err != nil {
+		zlog.Error("rabbitmq channel close failed", 0, zlog.AddError(err))
+	}
+	if len(errs) > 0 {
+		return &utils.MultiError{Errors: errs}
+	}
+	zlog.Printf("rabbitmq topology declared successful: exchanges [%d] queues [%d] bindings [%d]", len(spec.Exchanges), len(spec.Queues), len(spec.Bindings))
+	return nil
+}
+
+// 记录数据源已声明的交换机(exchange为true)或队列
+func addTopology(ds, name string, exchange bool) {
+	topologyMu.Lock()
+	defer topologyMu.Unlock()
+	declared, b := topologies[ds]
+	if !b {
+		declared = &declaredTopology{exchanges: make(map[string]struct{}), queues: make(map[string]struct{})}
+		topologies[ds] = declared
+	}
+	if exchange {
+		declared.exchanges[name] = struct{}{}
+	} else {
+		declared.queues[name] = struct{}{}
+	}
+}
+
+func topologyExchange(ds, name string) bool {
+	topologyMu.RLock()
+	defer topologyMu.RUnlock()
+	if declared, b := topologies[ds]; b {
+		_, b = declared.exchanges[name]
+		return b
+	}
+	return false
+}
+
+func topologyQueue(ds, name string) bool {
+	topologyMu.RLock()
+	defer topologyMu.RUnlock()
+	if declared, b := topologies[ds]; b {
+		_, b = declared.queues[name]
+		return b
+	}
+	return false
+}
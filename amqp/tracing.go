@@ -0,0 +1,92 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/otelx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 消息头trace上下文读写
+type tableCarrier amqp.Table
+
+func (self tableCarrier) Get(key string) string {
+	if v, ok := self[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (self tableCarrier) Set(key, value string) {
+	self[key] = value
+}
+
+func (self tableCarrier) Keys() []string {
+	keys := make([]string, 0, len(self))
+	for k := range self {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// WithContext 设置消息上下文, 发送时透传其中的trace上下文至消费方
+func (self *MsgData) WithContext(ctx context.Context) *MsgData {
+	self.ctx = ctx
+	return self
+}
+
+// Context 消息上下文, 消费回调中携带上游透传的trace上下文
+func (self *MsgData) Context() context.Context {
+	if self.ctx == nil {
+		return context.Background()
+	}
+	return self.ctx
+}
+
+// 创建收发span, 未启用链路追踪时span为nil
+func startSpan(ctx context.Context, option Option, kind trace.SpanKind) (context.Context, trace.Span) {
+	if !otelx.Enabled() {
+		return ctx, nil
+	}
+	operation := "publish"
+	if kind == trace.SpanKindConsumer {
+		operation = "receive"
+	}
+	return otelx.Start(ctx, utils.AddStr(option.Exchange, " ", operation), kind,
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination", option.Exchange),
+		attribute.String("messaging.rabbitmq.routing_key", option.Router),
+		attribute.String("messaging.operation", operation),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if span != nil {
+		otelx.End(span, err)
+	}
+}
+
+// 写入trace上下文至消息头, headers为空时按需创建
+func injectHeaders(ctx context.Context, headers amqp.Table) amqp.Table {
+	if !otelx.Enabled() {
+		return headers
+	}
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	otelx.Inject(ctx, tableCarrier(headers))
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// 读取消息头中的上游trace上下文
+func extractHeaders(headers amqp.Table) context.Context {
+	if !otelx.Enabled() || len(headers) == 0 {
+		return context.Background()
+	}
+	return otelx.Extract(context.Background(), tableCarrier(headers))
+}
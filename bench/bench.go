@@ -0,0 +1,135 @@
+package bench
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+// 性能基准记录, 用于对比两次基准测试结果发现性能退化
+// 基准文件为JSON格式, 可提交到仓库或作为CI产物保存
+
+// Result 单项基准测试结果
+type Result struct {
+	Name        string `json:"name"`
+	N           int    `json:"n"`           // 执行次数
+	NsPerOp     int64  `json:"nsPerOp"`     // 单次耗时/纳秒
+	AllocsPerOp int64  `json:"allocsPerOp"` // 单次内存分配次数
+	BytesPerOp  int64  `json:"bytesPerOp"`  // 单次内存分配字节
+}
+
+// Baseline 基准测试结果集
+type Baseline struct {
+	GoVersion string            `json:"goVersion"`
+	GOOS      string            `json:"goos"`
+	GOARCH    string            `json:"goarch"`
+	CPU       int               `json:"cpu"`
+	Time      int64             `json:"time"`
+	Results   map[string]Result `json:"results"`
+}
+
+// Regression 超出容差的性能退化项
+type Regression struct {
+	Name    string  `json:"name"`
+	Field   string  `json:"field"` // nsPerOp/allocsPerOp/bytesPerOp
+	Base    int64   `json:"base"`
+	Current int64   `json:"current"`
+	Ratio   float64 `json:"ratio"` // current/base
+}
+
+// NewBaseline 创建当前运行环境的结果集
+func NewBaseline() *Baseline {
+	return &Baseline{
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPU:       runtime.NumCPU(),
+		Time:      utils.UnixMilli(),
+		Results:   map[string]Result{},
+	}
+}
+
+// Run 执行基准测试函数并记录结果, 函数内调用b.Skip时不记录
+func (self *Baseline) Run(name string, fn func(b *testing.B)) (Result, bool) {
+	r := testing.Benchmark(fn)
+	if r.N == 0 {
+		return Result{}, false
+	}
+	result := Result{
+		Name:        name,
+		N:           r.N,
+		NsPerOp:     r.NsPerOp(),
+		AllocsPerOp: r.AllocsPerOp(),
+		BytesPerOp:  r.AllocedBytesPerOp(),
+	}
+	self.Results[name] = result
+	return result, true
+}
+
+// Load 读取基准文件, 文件不存在返回nil
+func Load(path string) (*Baseline, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, utils.Error("[Bench] read baseline failed: ", err)
+	}
+	result := &Baseline{}
+	if err := utils.JsonUnmarshal(bs, result); err != nil {
+		return nil, utils.Error("[Bench] parse baseline failed: ", err)
+	}
+	return result, nil
+}
+
+// Save 保存基准文件
+func (self *Baseline) Save(path string) error {
+	bs, err := utils.JsonMarshal(self)
+	if err != nil {
+		return utils.Error("[Bench] marshal baseline failed: ", err)
+	}
+	if err := os.WriteFile(path, bs, 0644); err != nil {
+		return utils.Error("[Bench] write baseline failed: ", err)
+	}
+	return nil
+}
+
+// Compare 对比基准结果, 耗时或内存分配超出tolerance比例(如0.2即20%)视为退化, 仅对比双方均存在的项
+func Compare(base, current *Baseline, tolerance float64) []Regression {
+	if base == nil || current == nil {
+		return nil
+	}
+	names := make([]string, 0, len(current.Results))
+	for k := range current.Results {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var result []Regression
+	for _, name := range names {
+		old, ok := base.Results[name]
+		if !ok {
+			continue
+		}
+		now := current.Results[name]
+		fields := []struct {
+			name      string
+			old, curr int64
+		}{
+			{"nsPerOp", old.NsPerOp, now.NsPerOp},
+			{"allocsPerOp", old.AllocsPerOp, now.AllocsPerOp},
+			{"bytesPerOp", old.BytesPerOp, now.BytesPerOp},
+		}
+		for _, v := range fields {
+			if v.old <= 0 {
+				continue
+			}
+			ratio := float64(v.curr) / float64(v.old)
+			if ratio > 1+tolerance {
+				result = append(result, Regression{Name: name, Field: v.name, Base: v.old, Current: v.curr, Ratio: ratio})
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,324 @@
+package bench
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/amqp"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/testx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/valyala/fasthttp"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 基准测试依赖的外部服务通过testx获取, 与集成测试共用FREEGO_TEST_*环境变量或Docker容器, 不可用时自动跳过
+// BENCH_NODE_URL 已启动的node服务接口地址, 如 http://127.0.0.1:8090/test
+// 执行: go test ./bench -run TestBaseline -bench . -benchmem
+// BENCH_BASELINE 基准文件路径, 存在则对比, BENCH_OUTPUT 本次结果输出路径, BENCH_TOLERANCE 允许退化比例, 默认0.2
+
+type BenchWallet struct {
+	Id      int64  `json:"id" bson:"_id"`
+	AppID   string `json:"appID" bson:"appID"`
+	Alias   string `json:"alias" bson:"alias"`
+	Balance int64  `json:"balance" bson:"balance"`
+	State   int64  `json:"state" bson:"state"`
+	Ctime   int64  `json:"ctime" bson:"ctime"`
+}
+
+func (o *BenchWallet) GetTable() string {
+	return "bench_wallet"
+}
+
+func (o *BenchWallet) NewObject() sqlc.Object {
+	return &BenchWallet{}
+}
+
+func (o *BenchWallet) NewIndex() []sqlc.Index {
+	return nil
+}
+
+func init() {
+	sqld.ModelDriver(&BenchWallet{})
+}
+
+func TestMain(m *testing.M) {
+	testx.Main(m, testx.Config{SyncSchema: true})
+}
+
+func newWallet() *BenchWallet {
+	return &BenchWallet{AppID: utils.RandNonce(), Alias: "bench", Balance: 100, State: 1, Ctime: utils.UnixMilli()}
+}
+
+func requireEnv(b *testing.B, name string) string {
+	v := os.Getenv(name)
+	if len(v) == 0 {
+		b.Skip(name, " not set")
+	}
+	return v
+}
+
+func BenchmarkMysqlSave(b *testing.B) {
+	testx.MySQL(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db, err := sqld.NewMysql(sqld.Option{OpenTx: true})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := db.Save(newWallet()); err != nil {
+			b.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+func BenchmarkMysqlFindList(b *testing.B) {
+	testx.MySQL(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db, err := sqld.NewMysql()
+		if err != nil {
+			b.Fatal(err)
+		}
+		var result []*BenchWallet
+		if err := db.FindList(sqlc.M(&BenchWallet{}).Eq("state", 1).Desc("id").Limit(1, 50), &result); err != nil {
+			b.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+func BenchmarkMongoSave(b *testing.B) {
+	testx.Mongo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db, err := sqld.NewMongo()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := db.Save(newWallet()); err != nil {
+			b.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+func BenchmarkMongoFindList(b *testing.B) {
+	testx.Mongo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db, err := sqld.NewMongo()
+		if err != nil {
+			b.Fatal(err)
+		}
+		var result []*BenchWallet
+		if err := db.FindList(sqlc.M(&BenchWallet{}).Eq("state", 1).Desc("_id").Limit(1, 50), &result); err != nil {
+			b.Fatal(err)
+		}
+		db.Close()
+	}
+}
+
+func benchCache(b *testing.B, c cache.Cache) {
+	value := map[string]interface{}{"id": 1, "alias": "bench", "balance": 100}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := utils.AddStr("bench.cache.", i%1024)
+			if err := c.Put(key, value, 60); err != nil {
+				b.Error(err)
+				return
+			}
+			if _, _, err := c.Get(key, nil); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkLocalCache(b *testing.B) {
+	benchCache(b, cache.NewLocalCache(30, 2))
+}
+
+func BenchmarkRedisCache(b *testing.B) {
+	testx.Redis(b)
+	c, err := cache.NewRedis()
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchCache(b, c)
+}
+
+func BenchmarkNodeRequest(b *testing.B) {
+	url := requireEnv(b, "BENCH_NODE_URL")
+	client := &fasthttp.Client{MaxConnsPerHost: 512, ReadTimeout: 10 * time.Second}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		for pb.Next() {
+			req.SetRequestURI(url)
+			req.Header.SetMethod(fasthttp.MethodGet)
+			if err := client.Do(req, resp); err != nil {
+				b.Error(err)
+				return
+			}
+			if resp.StatusCode() != fasthttp.StatusOK {
+				b.Error("unexpected status: ", resp.StatusCode())
+				return
+			}
+		}
+	})
+}
+
+// 发布N条消息并等待全部消费完成
+func benchPublishConsume(b *testing.B, publisher rabbitmq.Publisher, addReceiver func(receiver *rabbitmq.PullReceiver)) {
+	exchange := "bench.exchange"
+	queue := utils.AddStr("bench.queue.", b.N)
+	received := make(chan struct{}, 1024)
+	addReceiver(&rabbitmq.PullReceiver{
+		Config: &rabbitmq.Config{Option: rabbitmq.Option{Exchange: exchange, Queue: queue}},
+		Callback: func(msg *rabbitmq.MsgData) error {
+			received <- struct{}{}
+			return nil
+		},
+	})
+	content := map[string]interface{}{"id": 1, "alias": "bench"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if err := publisher.Publish(exchange, queue, 1, content); err != nil {
+				fmt.Println("bench publish failed: ", err)
+			}
+		}
+	}()
+	timeout := time.After(time.Minute)
+	for i := 0; i < b.N; i++ {
+		select {
+		case <-received:
+		case <-timeout:
+			b.Fatal("consume timeout: ", i, "/", b.N)
+		}
+	}
+}
+
+func BenchmarkAmqpMemory(b *testing.B) {
+	broker := rabbitmq.NewMemoryBroker(rabbitmq.AmqpConfig{SecretKey: "bench"}, 4096)
+	defer broker.Close()
+	benchPublishConsume(b, broker, func(receiver *rabbitmq.PullReceiver) {
+		broker.AddPullReceiver(receiver)
+	})
+}
+
+func BenchmarkAmqpRabbit(b *testing.B) {
+	testx.RabbitMQ(b)
+	publisher, err := rabbitmq.NewPublish()
+	if err != nil {
+		b.Fatal(err)
+	}
+	puller, err := rabbitmq.NewPull()
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchPublishConsume(b, publisher, func(receiver *rabbitmq.PullReceiver) {
+		puller.AddPullReceiver(receiver)
+		time.Sleep(time.Second) // 等待队列声明完成
+	})
+}
+
+var benchmarks = []struct {
+	name string
+	fn   func(b *testing.B)
+}{
+	{"MysqlSave", BenchmarkMysqlSave},
+	{"MysqlFindList", BenchmarkMysqlFindList},
+	{"MongoSave", BenchmarkMongoSave},
+	{"MongoFindList", BenchmarkMongoFindList},
+	{"LocalCache", BenchmarkLocalCache},
+	{"RedisCache", BenchmarkRedisCache},
+	{"NodeRequest", BenchmarkNodeRequest},
+	{"AmqpMemory", BenchmarkAmqpMemory},
+	{"AmqpRabbit", BenchmarkAmqpRabbit},
+	{"JsonStd", BenchmarkJsonStd},
+	{"JsonIterator", BenchmarkJsonIterator},
+}
+
+// TestBaseline 执行全部基准测试并输出结果, 与BENCH_BASELINE对比, 超出容差时失败
+func TestBaseline(t *testing.T) {
+	basePath := os.Getenv("BENCH_BASELINE")
+	output := os.Getenv("BENCH_OUTPUT")
+	if len(basePath) == 0 && len(output) == 0 {
+		t.Skip("BENCH_BASELINE/BENCH_OUTPUT not set")
+	}
+	tolerance := 0.2
+	if v := os.Getenv("BENCH_TOLERANCE"); len(v) > 0 {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			t.Fatal("BENCH_TOLERANCE invalid: ", v)
+		}
+		tolerance = f
+	}
+	current := NewBaseline()
+	for _, v := range benchmarks {
+		if r, ok := current.Run(v.name, v.fn); ok {
+			t.Logf("%-16s %12d ns/op %8d B/op %6d allocs/op", r.Name, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+		} else {
+			t.Logf("%-16s skipped", v.name)
+		}
+	}
+	if len(output) > 0 {
+		if err := current.Save(output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(basePath) == 0 {
+		return
+	}
+	base, err := Load(basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base == nil {
+		if err := current.Save(basePath); err != nil {
+			t.Fatal(err)
+		}
+		t.Log("baseline created: ", basePath)
+		return
+	}
+	for _, v := range Compare(base, current, tolerance) {
+		t.Errorf("%s %s regression: %d -> %d (%.2fx)", v.Name, v.Field, v.Base, v.Current, v.Ratio)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := NewBaseline()
+	base.Results["a"] = Result{Name: "a", NsPerOp: 100, AllocsPerOp: 2, BytesPerOp: 64}
+	base.Results["b"] = Result{Name: "b", NsPerOp: 100}
+	current := NewBaseline()
+	current.Results["a"] = Result{Name: "a", NsPerOp: 110, AllocsPerOp: 4, BytesPerOp: 64}
+	current.Results["b"] = Result{Name: "b", NsPerOp: 130}
+	current.Results["c"] = Result{Name: "c", NsPerOp: 1000}
+	list := Compare(base, current, 0.2)
+	if len(list) != 2 {
+		t.Fatal("regression count invalid: ", len(list))
+	}
+	if list[0].Name != "a" || list[0].Field != "allocsPerOp" || list[1].Name != "b" || list[1].Field != "nsPerOp" {
+		t.Fatal("regression invalid: ", list)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build sonic
+// +build sonic
+
+package bench
+
+import (
+	"github.com/godaddy-x/freego/utils/jsonsonic"
+	"testing"
+)
+
+// sonic依赖运行时内部实现, 仅在 -tags sonic 时参与基准测试
+
+func init() {
+	benchmarks = append(benchmarks, struct {
+		name string
+		fn   func(b *testing.B)
+	}{"JsonSonic", BenchmarkJsonSonic})
+}
+
+func BenchmarkJsonSonic(b *testing.B) {
+	benchJsonCodec(b, jsonsonic.Codec{})
+}
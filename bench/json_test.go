@@ -0,0 +1,50 @@
+package bench
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"testing"
+)
+
+// 与node.JsonResp结构一致, 避免基准测试依赖node包
+type benchJsonResp struct {
+	Code    int    `json:"c"`
+	Message string `json:"m"`
+	Data    string `json:"d"`
+	Nonce   string `json:"n"`
+	Time    int64  `json:"t"`
+	Plan    int64  `json:"p"`
+	Sign    string `json:"s"`
+}
+
+var jsonBenchObject = &benchJsonResp{
+	Code:    200,
+	Message: "success",
+	Data:    "eyJ1c2VybmFtZSI6ImZyZWVnbyIsInBhc3N3b3JkIjoiMTIzNDU2Iiwibm9uY2UiOiJhYmNkZWYifQ==",
+	Nonce:   "0a4e6e8f7c8a4c0b",
+	Time:    1669192800,
+	Plan:    0,
+	Sign:    "a3d0f0c8b1e94c2f8f5e7b6d9c1a2e3f",
+}
+
+func benchJsonCodec(b *testing.B, codec utils.JsonCodec) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bs, err := codec.Marshal(jsonBenchObject)
+		if err != nil {
+			b.Fatal(err)
+		}
+		result := &benchJsonResp{}
+		if err := codec.Unmarshal(bs, result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJsonStd(b *testing.B) {
+	benchJsonCodec(b, utils.StdJsonCodec{})
+}
+
+func BenchmarkJsonIterator(b *testing.B) {
+	benchJsonCodec(b, utils.IteratorJsonCodec{})
+}
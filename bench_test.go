@@ -1,10 +1,9 @@
 package main
 
 import (
-	"fmt"
 	"github.com/godaddy-x/freego/ormx/sqlc"
 	"github.com/godaddy-x/freego/ormx/sqld"
-	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/testx"
 	"github.com/godaddy-x/freego/utils/crypto"
 	"github.com/godaddy-x/freego/utils/decimal"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -126,22 +125,13 @@ func (o *OwAuth) NewIndex() []sqlc.Index {
 // go tool pprof -http=":8081" .\cpuprofile.out
 // go test bench_test.go -bench .  -benchmem -count=5 -cpuprofile cpuprofile.out -memprofile memprofile.out
 
-func initMysqlDB() {
-	conf := sqld.MysqlConfig{}
-	if err := utils.ReadLocalJsonConfig("resource/mysql.json", &conf); err != nil {
-		panic(utils.AddStr("读取mysql配置失败: ", err.Error()))
-	}
-	new(sqld.MysqlManager).InitConfigAndCache(nil, conf)
-	fmt.Println("init mysql success")
+// 由testx启动或连接测试服务, 仅首次调用初始化, 服务不可用时跳过测试
+func initMysqlDB(tb testing.TB) {
+	testx.MySQL(tb)
 }
 
-func initMongoDB() {
-	conf := sqld.MGOConfig{}
-	if err := utils.ReadLocalJsonConfig("resource/mongo.json", &conf); err != nil {
-		panic(utils.AddStr("读取mongo配置失败: ", err.Error()))
-	}
-	new(sqld.MGOManager).InitConfigAndCache(nil, conf)
-	fmt.Println("init mongo success")
+func initMongoDB(tb testing.TB) {
+	testx.Mongo(tb)
 }
 
 func initDriver() {
@@ -28,6 +28,8 @@ type Cache interface {
 	Put(key string, input interface{}, expire ...int) error
 	// 批量保存/过期时间(秒)
 	PutBatch(objs ...*PutObj) error
+	// key不存在时保存/过期时间(秒), 返回true表示保存成功
+	PutNX(key string, input interface{}, expire int) (bool, error)
 	// 删除
 	Del(input ...string) error
 	// 查询全部key数量
@@ -88,6 +90,10 @@ func (self *CacheManager) PutBatch(objs ...*PutObj) error {
 	return utils.Error("No implementation method [PutBatch] was found")
 }
 
+func (self *CacheManager) PutNX(key string, input interface{}, expire int) (bool, error) {
+	return false, utils.Error("No implementation method [PutNX] was found")
+}
+
 func (self *CacheManager) Del(key ...string) error {
 	return utils.Error("No implementation method [Del] was found")
 }
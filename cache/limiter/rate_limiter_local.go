@@ -4,48 +4,112 @@ import (
 	"github.com/godaddy-x/freego/cache"
 	"github.com/godaddy-x/freego/zlog"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type RateLimiter interface {
 	Allow(resource string) bool // true=接受请求 false=拒绝请求
 }
 
+// StatRateLimiter 可选实现, 输出放行/拒绝计数, 内置限流器均已实现
+type StatRateLimiter interface {
+	RateLimiter
+	Stats() Stat
+}
+
+// GetStats 获取限流器计数, 未实现StatRateLimiter时返回false
+func GetStats(limiter RateLimiter) (Stat, bool) {
+	if v, ok := limiter.(StatRateLimiter); ok {
+		return v.Stats(), true
+	}
+	return Stat{}, false
+}
+
+// Stat 限流器累计放行/拒绝次数
+type Stat struct {
+	Allowed  int64 `json:"allowed"`
+	Rejected int64 `json:"rejected"`
+}
+
+type counter struct {
+	allowed  int64
+	rejected int64
+}
+
+func (self *counter) record(allow bool) bool {
+	if allow {
+		atomic.AddInt64(&self.allowed, 1)
+	} else {
+		atomic.AddInt64(&self.rejected, 1)
+	}
+	return allow
+}
+
+func (self *counter) Stats() Stat {
+	return Stat{Allowed: atomic.LoadInt64(&self.allowed), Rejected: atomic.LoadInt64(&self.rejected)}
+}
+
 type LocalRateLimiter struct {
+	counter
 	mu     sync.Mutex
 	cache  cache.Cache
 	option Option
 }
 
 type Option struct {
-	Limit       float64
-	Bucket      int
+	Limit       float64 // 令牌生成速率/秒, 令牌桶算法使用
+	Bucket      int     // 令牌桶容量, 窗口算法为窗口内最大请求数
 	Expire      int
-	Distributed bool
+	Distributed bool   // 基于redis的分布式限流, 多节点共享限额
+	Algorithm   string // 限流算法 token_bucket(默认)/fixed_window/sliding_window
+	Window      int    // 窗口时长/毫秒, 窗口算法使用, 默认1000
 }
 
 func NewRateLimiter(option Option) RateLimiter {
+	if len(option.Algorithm) == 0 {
+		option.Algorithm = TokenBucket
+	}
+	if option.Window <= 0 {
+		option.Window = 1000
+	}
 	if option.Distributed {
 		return &RedisRateLimiter{option: option}
 	}
 	return &LocalRateLimiter{cache: new(cache.LocalMapManager).NewCache(30, 3), option: option}
 }
 
+// 本地限流器, 按算法创建
+type localLimiter interface {
+	Allow() bool
+}
+
+func (self *LocalRateLimiter) newLimiter() localLimiter {
+	switch self.option.Algorithm {
+	case FixedWindow:
+		return &fixedWindow{limit: self.option.Bucket, window: int64(self.option.Window) * int64(time.Millisecond)}
+	case SlidingWindow:
+		return &slidingWindow{limit: self.option.Bucket, window: int64(self.option.Window) * int64(time.Millisecond)}
+	}
+	return NewLimiter(Limit(self.option.Limit), self.option.Bucket)
+}
+
 // key=过滤关键词 limit=速率 bucket=容量 expire=过期时间/秒
-func (self *LocalRateLimiter) getLimiter(resource string) *Limiter {
+func (self *LocalRateLimiter) getLimiter(resource string) localLimiter {
 	if len(resource) == 0 {
 		return nil
 	}
-	var limiter *Limiter
+	var limiter localLimiter
 	if v, b, _ := self.cache.Get(resource, nil); b {
-		limiter = v.(*Limiter)
+		limiter = v.(localLimiter)
 	}
 	if limiter == nil {
 		self.mu.Lock()
 		if v, b, _ := self.cache.Get(resource, nil); b {
-			limiter = v.(*Limiter)
+			limiter = v.(localLimiter)
 		}
 		if limiter == nil {
-			limiter = NewLimiter(Limit(self.option.Limit), self.option.Bucket)
+			limiter = self.newLimiter()
 			if err := self.cache.Put(resource, limiter, self.option.Expire); err != nil {
 				zlog.Error("cache put failed", 0, zlog.AddError(err))
 			}
@@ -58,7 +122,7 @@ func (self *LocalRateLimiter) getLimiter(resource string) *Limiter {
 func (self *LocalRateLimiter) Allow(resource string) bool {
 	limiter := self.getLimiter(resource)
 	if limiter == nil {
-		return false
+		return self.record(false)
 	}
-	return limiter.Allow()
+	return self.record(limiter.Allow())
 }
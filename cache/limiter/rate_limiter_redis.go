@@ -46,7 +46,34 @@ var limiterScript = redis.NewScript(1, `
 	return status
 `)
 
+var fixedWindowScript = redis.NewScript(1, `
+	-- KEYS = [resource:窗口序号]
+	local count = redis.call('INCR', KEYS[1])
+	if count == 1 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[2]) -- 窗口结束后过期
+	end
+	if count > tonumber(ARGV[1]) then
+		return 0
+	end
+	return 1
+`)
+
+var slidingWindowScript = redis.NewScript(1, `
+	-- KEYS = [resource]
+	local limit = tonumber(ARGV[1]) -- 窗口内最大请求数
+	local window = tonumber(ARGV[2]) -- 窗口时长/毫秒
+	local now = tonumber(ARGV[3]) -- 当前请求时间/毫秒
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window) -- 清除窗口外的请求记录
+	if redis.call('ZCARD', KEYS[1]) >= limit then
+		return 0
+	end
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 1
+`)
+
 type RedisRateLimiter struct {
+	counter
 	option Option
 }
 
@@ -58,17 +85,27 @@ func (self *RedisRateLimiter) Allow(resource string) bool {
 	client, err := cache.NewRedis()
 	if err != nil {
 		zlog.Error("redis rate limiter get client failed", 0, zlog.AddError(err))
-		return false
+		return self.record(false)
 	}
 	rds := client.Pool.Get()
 	defer client.Close(rds)
-	res, err := limiterScript.Do(rds, self.key(resource), self.option.Bucket, self.option.Limit, time.Now().UnixNano()/1e6)
+	now := time.Now().UnixNano() / 1e6
+	var res interface{}
+	switch self.option.Algorithm {
+	case FixedWindow:
+		window := int64(self.option.Window)
+		res, err = fixedWindowScript.Do(rds, utils.AddStr(self.key(resource), ":", now/window), self.option.Bucket, window)
+	case SlidingWindow:
+		res, err = slidingWindowScript.Do(rds, self.key(resource), self.option.Bucket, self.option.Window, now, utils.NextSID())
+	default:
+		res, err = limiterScript.Do(rds, self.key(resource), self.option.Bucket, self.option.Limit, now)
+	}
 	if err != nil {
 		zlog.Error("redis rate limiter client do lua script failed", 0, zlog.AddError(err))
-		return false
+		return self.record(false)
 	}
 	if v, b := res.(int64); b && v == 1 {
-		return true
+		return self.record(true)
 	}
-	return false
+	return self.record(false)
 }
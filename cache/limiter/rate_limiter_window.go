@@ -0,0 +1,66 @@
+package rate
+
+import (
+	"sync"
+	"time"
+)
+
+// 限流算法
+// token_bucket: 令牌桶, 按Limit速率生成令牌, 允许Bucket容量的突发请求
+// fixed_window: 固定窗口计数, 每个Window时长内最多Bucket次请求, 窗口边界可能出现双倍突发
+// sliding_window: 滑动窗口日志, 任意Window时长内最多Bucket次请求
+const (
+	TokenBucket   = "token_bucket"
+	FixedWindow   = "fixed_window"
+	SlidingWindow = "sliding_window"
+)
+
+// 固定窗口计数
+type fixedWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window int64 // 窗口时长/纳秒
+	start  int64
+	count  int
+}
+
+func (self *fixedWindow) Allow() bool {
+	now := time.Now().UnixNano()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if now-self.start >= self.window {
+		self.start = now - now%self.window
+		self.count = 0
+	}
+	if self.count >= self.limit {
+		return false
+	}
+	self.count++
+	return true
+}
+
+// 滑动窗口日志, 记录窗口内每次请求时间
+type slidingWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window int64 // 窗口时长/纳秒
+	logs   []int64
+}
+
+func (self *slidingWindow) Allow() bool {
+	now := time.Now().UnixNano()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	expired := 0
+	for expired < len(self.logs) && now-self.logs[expired] >= self.window {
+		expired++
+	}
+	if expired > 0 {
+		self.logs = append(self.logs[:0], self.logs[expired:]...)
+	}
+	if len(self.logs) >= self.limit {
+		return false
+	}
+	self.logs = append(self.logs, now)
+	return true
+}
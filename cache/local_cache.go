@@ -91,6 +91,17 @@ func (self *LocalMapManager) Put(key string, input interface{}, expire ...int) e
 	return nil
 }
 
+func (self *LocalMapManager) PutNX(key string, input interface{}, expire int) (bool, error) {
+	d := cache.DefaultExpiration
+	if expire > 0 {
+		d = time.Duration(expire) * time.Second
+	}
+	if err := self.c.Add(key, input, d); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
 func (self *LocalMapManager) Del(key ...string) error {
 	if key != nil {
 		for _, v := range key {
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/godaddy-x/freego/utils"
+	"path"
+	"sync"
+	"time"
+)
+
+// LRUOption 本地LRU缓存选项
+type LRUOption struct {
+	MaxEntries int   // 最大条数, 0不限制
+	MaxBytes   int64 // 最大占用字节(按key及值序列化长度估算), 0不限制
+	Expire     int   // 默认过期时间/秒, 0不过期
+}
+
+// LocalCache 进程内LRU缓存, 超出条数或字节限制时淘汰最久未使用的数据, 过期数据在访问时清除
+type LocalCache struct {
+	CacheManager
+	mu     sync.Mutex
+	option LRUOption
+	ll     *list.List
+	items  map[string]*list.Element
+	bytes  int64
+}
+
+type lruEntry struct {
+	key    string
+	value  interface{}
+	size   int64
+	expire int64 // 过期时间/纳秒, 0不过期
+}
+
+func (self *lruEntry) expired(now int64) bool {
+	return self.expire > 0 && now > self.expire
+}
+
+// NewLRUCache 创建本地LRU缓存
+func NewLRUCache(option LRUOption) *LocalCache {
+	return &LocalCache{option: option, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// 读取未过期数据并标记为最近使用
+func (self *LocalCache) load(key string) (interface{}, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	elem, ok := self.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.expired(time.Now().UnixNano()) {
+		self.remove(elem)
+		return nil, false
+	}
+	self.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (self *LocalCache) store(key string, input interface{}, expire int, nx bool) bool {
+	var deadline int64
+	if expire > 0 {
+		deadline = time.Now().Add(time.Duration(expire) * time.Second).UnixNano()
+	}
+	size := int64(len(key) + len(utils.AnyToStr(input)))
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if elem, ok := self.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		if nx && !entry.expired(time.Now().UnixNano()) {
+			return false
+		}
+		self.bytes += size - entry.size
+		entry.value, entry.size, entry.expire = input, size, deadline
+		self.ll.MoveToFront(elem)
+	} else {
+		self.items[key] = self.ll.PushFront(&lruEntry{key: key, value: input, size: size, expire: deadline})
+		self.bytes += size
+	}
+	self.evict()
+	return true
+}
+
+// 超出限制时从最久未使用的数据开始淘汰, 至少保留刚写入的数据
+func (self *LocalCache) evict() {
+	for self.ll.Len() > 1 {
+		if (self.option.MaxEntries <= 0 || self.ll.Len() <= self.option.MaxEntries) && (self.option.MaxBytes <= 0 || self.bytes <= self.option.MaxBytes) {
+			return
+		}
+		self.remove(self.ll.Back())
+	}
+}
+
+func (self *LocalCache) remove(elem *list.Element) {
+	entry := self.ll.Remove(elem).(*lruEntry)
+	delete(self.items, entry.key)
+	self.bytes -= entry.size
+}
+
+func (self *LocalCache) expire(expire []int) int {
+	if len(expire) > 0 && expire[0] > 0 {
+		return expire[0]
+	}
+	return self.option.Expire
+}
+
+func (self *LocalCache) Get(key string, input interface{}) (interface{}, bool, error) {
+	v, b := self.load(key)
+	if !b || v == nil {
+		return nil, false, nil
+	}
+	if input == nil {
+		return v, true, nil
+	}
+	if bs, ok := v.([]byte); ok {
+		return v, true, utils.JsonUnmarshal(bs, input)
+	}
+	return v, true, utils.JsonToAny(v, input)
+}
+
+func (self *LocalCache) GetInt64(key string) (int64, error) {
+	v, b := self.load(key)
+	if !b || v == nil {
+		return 0, nil
+	}
+	return utils.StrToInt64(utils.AnyToStr(v))
+}
+
+func (self *LocalCache) GetFloat64(key string) (float64, error) {
+	v, b := self.load(key)
+	if !b || v == nil {
+		return 0, nil
+	}
+	return utils.StrToFloat(utils.AnyToStr(v))
+}
+
+func (self *LocalCache) GetString(key string) (string, error) {
+	v, b := self.load(key)
+	if !b || v == nil {
+		return "", nil
+	}
+	return utils.AnyToStr(v), nil
+}
+
+func (self *LocalCache) GetBytes(key string) ([]byte, error) {
+	v, b := self.load(key)
+	if !b || v == nil {
+		return nil, nil
+	}
+	if bs, ok := v.([]byte); ok {
+		return bs, nil
+	}
+	return utils.Str2Bytes(utils.AnyToStr(v)), nil
+}
+
+func (self *LocalCache) GetBool(key string) (bool, error) {
+	v, b := self.load(key)
+	if !b || v == nil {
+		return false, nil
+	}
+	return utils.StrToBool(utils.AnyToStr(v))
+}
+
+func (self *LocalCache) Put(key string, input interface{}, expire ...int) error {
+	if len(key) == 0 || input == nil {
+		return nil
+	}
+	self.store(key, input, self.expire(expire), false)
+	return nil
+}
+
+func (self *LocalCache) PutBatch(objs ...*PutObj) error {
+	for _, v := range objs {
+		if v == nil || len(v.Key) == 0 || v.Value == nil {
+			continue
+		}
+		self.store(v.Key, v.Value, self.expire([]int{v.Expire}), false)
+	}
+	return nil
+}
+
+func (self *LocalCache) PutNX(key string, input interface{}, expire int) (bool, error) {
+	if len(key) == 0 || input == nil {
+		return false, nil
+	}
+	return self.store(key, input, self.expire([]int{expire}), true), nil
+}
+
+func (self *LocalCache) Del(key ...string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range key {
+		if elem, ok := self.items[v]; ok {
+			self.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (self *LocalCache) Exists(key string) (bool, error) {
+	_, b := self.load(key)
+	return b, nil
+}
+
+// 按通配符匹配未过期的key, 如 user.*
+func (self *LocalCache) Keys(pattern ...string) ([]string, error) {
+	now := time.Now().UnixNano()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	result := make([]string, 0, len(self.items))
+	for elem := self.ll.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*lruEntry)
+		if entry.expired(now) {
+			self.remove(elem)
+		} else if len(pattern) == 0 || len(pattern[0]) == 0 || pattern[0] == "*" {
+			result = append(result, entry.key)
+		} else if ok, _ := path.Match(pattern[0], entry.key); ok {
+			result = append(result, entry.key)
+		}
+		elem = next
+	}
+	return result, nil
+}
+
+func (self *LocalCache) Size(pattern ...string) (int, error) {
+	keys, err := self.Keys(pattern...)
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+func (self *LocalCache) Values(pattern ...string) ([]interface{}, error) {
+	keys, err := self.Keys(pattern...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, len(keys))
+	for _, v := range keys {
+		if value, ok := self.load(v); ok {
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
+
+func (self *LocalCache) Flush() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.ll.Init()
+	self.items = make(map[string]*list.Element)
+	self.bytes = 0
+	return nil
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"github.com/garyburd/redigo/redis"
 	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/promx"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/zlog"
 	"time"
@@ -21,12 +22,18 @@ type RedisConfig struct {
 	MaxActive   int
 	IdleTimeout int
 	Network     string
+	Mode        string   // 部署模式 single(默认)/sentinel/cluster
+	Addrs       []string // 哨兵或集群节点地址, 如 127.0.0.1:26379
+	MasterName  string   // 哨兵模式主节点名称
+	ReadReplica bool     // 读操作路由到从节点
 }
 
 type RedisManager struct {
 	CacheManager
-	DsName string
-	Pool   *redis.Pool
+	DsName   string
+	Pool     *redis.Pool
+	ReadPool *redis.Pool // 从节点连接池, 未开启ReadReplica时为nil
+	cluster  *redisCluster
 }
 
 func (self *RedisManager) InitConfig(input ...RedisConfig) (*RedisManager, error) {
@@ -38,22 +45,11 @@ func (self *RedisManager) InitConfig(input ...RedisConfig) (*RedisManager, error
 		if _, b := redisSessions[dsName]; b {
 			return nil, utils.Error("init redis pool failed: [", v.DsName, "] exist")
 		}
-		pool := &redis.Pool{MaxIdle: v.MaxIdle, MaxActive: v.MaxActive, IdleTimeout: time.Duration(v.IdleTimeout) * time.Second, Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial(v.Network, utils.AddStr(v.Host, ":", utils.AnyToStr(v.Port)))
-			if err != nil {
-				return nil, err
-			}
-			if len(v.Password) > 0 {
-				if _, err := c.Do("AUTH", v.Password); err != nil {
-					if err := c.Close(); err != nil {
-						zlog.Error("redis close failed", 0, zlog.AddError(err))
-					}
-					return nil, err
-				}
-			}
-			return c, err
-		}}
-		redisSessions[dsName] = &RedisManager{Pool: pool, DsName: dsName}
+		manager, err := newRedisManager(dsName, v)
+		if err != nil {
+			return nil, err
+		}
+		redisSessions[dsName] = manager
 		zlog.Printf("redis service【%s】has been started successful", dsName)
 	}
 	if len(redisSessions) == 0 {
@@ -81,15 +77,18 @@ func NewRedis(ds ...string) (*RedisManager, error) {
 /********************************** redis缓存接口实现 **********************************/
 
 func (self *RedisManager) Get(key string, input interface{}) (interface{}, bool, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	value, err := redis.Bytes(client.Do("GET", key))
 	if err != nil && err != redis.ErrNil {
+		promx.ObserveCache("redis", self.DsName, false, err)
 		return nil, false, err
 	}
 	if value == nil || len(value) == 0 {
+		promx.ObserveCache("redis", self.DsName, false, nil)
 		return nil, false, nil
 	}
+	promx.ObserveCache("redis", self.DsName, true, nil)
 	if input == nil {
 		return value, true, nil
 	}
@@ -97,7 +96,7 @@ func (self *RedisManager) Get(key string, input interface{}) (interface{}, bool,
 }
 
 func (self *RedisManager) GetInt64(key string) (int64, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	value, err := redis.Bytes(client.Do("GET", key))
 	if err != nil && err != redis.ErrNil {
@@ -114,7 +113,7 @@ func (self *RedisManager) GetInt64(key string) (int64, error) {
 }
 
 func (self *RedisManager) GetFloat64(key string) (float64, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	value, err := redis.Bytes(client.Do("GET", key))
 	if err != nil && err != redis.ErrNil {
@@ -131,7 +130,7 @@ func (self *RedisManager) GetFloat64(key string) (float64, error) {
 }
 
 func (self *RedisManager) GetString(key string) (string, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	value, err := redis.Bytes(client.Do("GET", key))
 	if err != nil && err != redis.ErrNil {
@@ -144,7 +143,7 @@ func (self *RedisManager) GetString(key string) (string, error) {
 }
 
 func (self *RedisManager) GetBytes(key string) ([]byte, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	value, err := redis.Bytes(client.Do("GET", key))
 	if err != nil && err != redis.ErrNil {
@@ -156,8 +155,35 @@ func (self *RedisManager) GetBytes(key string) ([]byte, error) {
 	return value, nil
 }
 
+// 读取数据及剩余有效期/毫秒, 未设置有效期时返回-1, 数据不存在时返回nil
+func (self *RedisManager) getBytesWithPTTL(key string) ([]byte, int64, error) {
+	client := self.readConn()
+	defer self.Close(client)
+	if err := client.Send("GET", key); err != nil {
+		return nil, 0, err
+	}
+	if err := client.Send("PTTL", key); err != nil {
+		return nil, 0, err
+	}
+	if err := client.Flush(); err != nil {
+		return nil, 0, err
+	}
+	value, err := redis.Bytes(client.Receive())
+	if err != nil && err != redis.ErrNil {
+		return nil, 0, err
+	}
+	pttl, err := redis.Int64(client.Receive())
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(value) == 0 || pttl == -2 {
+		return nil, 0, nil
+	}
+	return value, pttl, nil
+}
+
 func (self *RedisManager) GetBool(key string) (bool, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	value, err := redis.Bytes(client.Do("GET", key))
 	if err != nil && err != redis.ErrNil {
@@ -199,6 +225,18 @@ func (self *RedisManager) PutBatch(objs ...*PutObj) error {
 	}
 	client := self.Pool.Get()
 	defer self.Close(client)
+	if self.cluster != nil { // 集群模式key分布在不同槽位, 逐条写入不保证原子性
+		for _, v := range objs {
+			args := []interface{}{v.Key, v.Value}
+			if v.Expire > 0 {
+				args = append(args, "EX", v.Expire)
+			}
+			if _, err := client.Do("SET", args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	if err := client.Send("MULTI"); err != nil {
 		return err
 	}
@@ -219,9 +257,42 @@ func (self *RedisManager) PutBatch(objs ...*PutObj) error {
 	return nil
 }
 
+func (self *RedisManager) PutNX(key string, input interface{}, expire int) (bool, error) {
+	if len(key) == 0 || input == nil {
+		return false, nil
+	}
+	var value []byte
+	if v, b := input.([]byte); b {
+		value = v
+	} else {
+		value = utils.Str2Bytes(utils.AnyToStr(input))
+	}
+	client := self.Pool.Get()
+	defer self.Close(client)
+	var reply interface{}
+	var err error
+	if expire > 0 {
+		reply, err = client.Do("SET", key, value, "EX", expire, "NX")
+	} else {
+		reply, err = client.Do("SET", key, value, "NX")
+	}
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
 func (self *RedisManager) Del(key ...string) error {
 	client := self.Pool.Get()
 	defer self.Close(client)
+	if self.cluster != nil { // 集群模式key分布在不同槽位, 逐条删除
+		for _, v := range key {
+			if _, err := client.Do("DEL", v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	if err := client.Send("MULTI"); err != nil {
 		return err
 	}
@@ -329,7 +400,7 @@ func (self *RedisManager) Subscribe(key string, expSecond int, call func(msg str
 	if expSecond <= 0 {
 		expSecond = 5
 	}
-	client := self.Pool.Get()
+	client := self.subscribeConn()
 	defer self.Close(client)
 	c := redis.PubSubConn{Conn: client}
 	if err := c.Subscribe(key); err != nil {
@@ -372,7 +443,7 @@ func (self *RedisManager) Keys(pattern ...string) ([]string, error) {
 	if pattern == nil || len(pattern) == 0 || pattern[0] == "*" {
 		return nil, nil
 	}
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	keys, err := redis.Strings(client.Do("KEYS", pattern[0]))
 	if err != nil {
@@ -394,7 +465,7 @@ func (self *RedisManager) Values(pattern ...string) ([]interface{}, error) {
 }
 
 func (self *RedisManager) Exists(key string) (bool, error) {
-	client := self.Pool.Get()
+	client := self.readConn()
 	defer self.Close(client)
 	ret, err := client.Do("EXISTS", key)
 	if err != nil {
@@ -413,3 +484,56 @@ func (self *RedisManager) Close(conn redis.Conn) {
 		zlog.Error("redis conn close failed", 0, zlog.AddError(err))
 	}
 }
+
+// PingRedis 检测所有已初始化的redis数据源, 返回数据源名称对应的检测结果
+func PingRedis() map[string]error {
+	result := make(map[string]error, len(redisSessions))
+	for k, v := range redisSessions {
+		conn := v.Pool.Get()
+		if _, err := conn.Do("PING"); err != nil {
+			result[k] = utils.Error("redis [", k, "] ping failed: ", err)
+		} else {
+			result[k] = nil
+		}
+		if err := conn.Close(); err != nil {
+			zlog.Error("redis close failed", 0, zlog.AddError(err))
+		}
+	}
+	return result
+}
+
+// CloseRedis 关闭所有redis数据源连接池
+func CloseRedis() map[string]error {
+	result := make(map[string]error, len(redisSessions))
+	for k, v := range redisSessions {
+		var errs []error
+		if err := v.Pool.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if v.ReadPool != nil {
+			if err := v.ReadPool.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if v.cluster != nil {
+			if err := v.cluster.close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			result[k] = utils.Error("redis [", k, "] close failed: ", &utils.MultiError{Errors: errs})
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
+
+// RedisStats 获取所有redis数据源的连接池统计
+func RedisStats() map[string]redis.PoolStats {
+	result := make(map[string]redis.PoolStats, len(redisSessions))
+	for k, v := range redisSessions {
+		result[k] = v.Pool.Stats()
+	}
+	return result
+}
@@ -0,0 +1,597 @@
+package cache
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// redis部署模式, RedisConfig.Mode为空时按单节点处理
+// sentinel: 每次建立连接时通过哨兵获取当前主节点, 借出空闲连接时校验节点角色, 主从切换后自动连接新主节点
+// cluster: 按key计算槽位路由到对应主节点, 收到MOVED/ASK或节点不可用时刷新槽位后重试
+// ReadReplica开启后读操作(Get/Exists/Keys等)路由到从节点, 从节点不可用时使用主节点
+
+const (
+	RedisSingle   = "single"
+	RedisSentinel = "sentinel"
+	RedisCluster  = "cluster"
+
+	redisClusterSlots    = 16384
+	redisClusterRedirect = 5
+	redisCheckIdle       = time.Second
+)
+
+var errClusterMulti = utils.Error("redis cluster conn only supports MULTI ... EXEC by Send/Do with keys in one slot")
+
+// 创建数据源连接池
+func newRedisManager(dsName string, v RedisConfig) (*RedisManager, error) {
+	if len(v.Network) == 0 {
+		v.Network = "tcp"
+	}
+	manager := &RedisManager{DsName: dsName}
+	switch v.Mode {
+	case "", RedisSingle:
+		addr := utils.AddStr(v.Host, ":", utils.AnyToStr(v.Port))
+		manager.Pool = newRedisPool(v, func() (redis.Conn, error) {
+			return dialRedis(v, addr)
+		}, nil)
+	case RedisSentinel:
+		if len(v.Addrs) == 0 || len(v.MasterName) == 0 {
+			return nil, utils.Error("init redis pool failed: [", dsName, "] sentinel addrs/master name is nil")
+		}
+		manager.Pool = newRedisPool(v, func() (redis.Conn, error) {
+			addr, err := sentinelMaster(v)
+			if err != nil {
+				return nil, err
+			}
+			return dialRedis(v, addr)
+		}, testRedisRole("master"))
+		if v.ReadReplica {
+			manager.ReadPool = newRedisPool(v, func() (redis.Conn, error) {
+				addr, err := sentinelReplica(v)
+				if err != nil {
+					zlog.Warn("redis sentinel replica not found, use master", 0, zlog.String("ds", dsName), zlog.AddError(err))
+					if addr, err = sentinelMaster(v); err != nil {
+						return nil, err
+					}
+				}
+				return dialRedis(v, addr)
+			}, testRedisRole(""))
+		}
+	case RedisCluster:
+		if len(v.Addrs) == 0 {
+			return nil, utils.Error("init redis pool failed: [", dsName, "] cluster addrs is nil")
+		}
+		cluster := &redisCluster{config: v, pools: make(map[string]*redis.Pool)}
+		if err := cluster.refresh(); err != nil {
+			return nil, utils.Error("init redis pool failed: [", dsName, "] ", err)
+		}
+		manager.cluster = cluster
+		manager.Pool = newRedisPool(v, func() (redis.Conn, error) {
+			return &clusterConn{cluster: cluster}, nil
+		}, nil)
+	default:
+		return nil, utils.Error("init redis pool failed: [", dsName, "] mode invalid: ", v.Mode)
+	}
+	return manager, nil
+}
+
+// 读操作连接, 开启ReadReplica时使用从节点
+func (self *RedisManager) readConn() redis.Conn {
+	if self.ReadPool != nil {
+		return self.ReadPool.Get()
+	}
+	return self.Pool.Get()
+}
+
+// 订阅连接, 集群模式下直接连接节点
+func (self *RedisManager) subscribeConn() redis.Conn {
+	if self.cluster != nil {
+		return self.cluster.subscribeConn()
+	}
+	return self.Pool.Get()
+}
+
+func newRedisPool(v RedisConfig, dial func() (redis.Conn, error), test func(c redis.Conn, t time.Time) error) *redis.Pool {
+	return &redis.Pool{MaxIdle: v.MaxIdle, MaxActive: v.MaxActive, IdleTimeout: time.Duration(v.IdleTimeout) * time.Second, Dial: dial, TestOnBorrow: test}
+}
+
+func dialRedis(v RedisConfig, addr string) (redis.Conn, error) {
+	c, err := redis.Dial(v.Network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.Password) > 0 {
+		if _, err := c.Do("AUTH", v.Password); err != nil {
+			if err := c.Close(); err != nil {
+				zlog.Error("redis close failed", 0, zlog.AddError(err))
+			}
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// 借出空闲连接时校验节点角色, role为空时仅检测连接可用
+func testRedisRole(role string) func(c redis.Conn, t time.Time) error {
+	return func(c redis.Conn, t time.Time) error {
+		if time.Since(t) < redisCheckIdle {
+			return nil
+		}
+		if len(role) == 0 {
+			_, err := c.Do("PING")
+			return err
+		}
+		reply, err := redis.Values(c.Do("ROLE"))
+		if err != nil {
+			return err
+		}
+		if len(reply) == 0 {
+			return utils.Error("redis role reply is nil")
+		}
+		current, err := redis.String(reply[0], nil)
+		if err != nil {
+			return err
+		}
+		if current != role {
+			return utils.Error("redis role changed: ", current)
+		}
+		return nil
+	}
+}
+
+// 通过哨兵获取主节点地址
+func sentinelMaster(v RedisConfig) (string, error) {
+	var lastErr error
+	for _, addr := range v.Addrs {
+		conn, err := redis.Dial(v.Network, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", v.MasterName))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply) != 2 {
+			continue
+		}
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+	return "", utils.Error("redis sentinel [", v.MasterName, "] master not found: ", lastErr)
+}
+
+// 通过哨兵随机获取一个可用从节点地址
+func sentinelReplica(v RedisConfig) (string, error) {
+	var lastErr error
+	for _, addr := range v.Addrs {
+		conn, err := redis.Dial(v.Network, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := redis.Values(conn.Do("SENTINEL", "slaves", v.MasterName))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var replicas []string
+		for _, r := range reply {
+			info, err := redis.StringMap(r, nil)
+			if err != nil {
+				continue
+			}
+			flags := info["flags"]
+			if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+				continue
+			}
+			replicas = append(replicas, net.JoinHostPort(info["ip"], info["port"]))
+		}
+		if len(replicas) == 0 {
+			return "", utils.Error("redis sentinel [", v.MasterName, "] replica not found")
+		}
+		return replicas[rand.Intn(len(replicas))], nil
+	}
+	return "", utils.Error("redis sentinel [", v.MasterName, "] replica not found: ", lastErr)
+}
+
+// 集群槽位路由
+type redisCluster struct {
+	mu         sync.RWMutex
+	config     RedisConfig
+	slots      [redisClusterSlots]string // 槽位对应主节点地址
+	pools      map[string]*redis.Pool
+	refreshing int32
+}
+
+// 通过CLUSTER SLOTS刷新槽位, 依次尝试已知节点
+func (self *redisCluster) refresh() error {
+	self.mu.RLock()
+	addrs := append([]string{}, self.config.Addrs...)
+	for k := range self.pools {
+		addrs = append(addrs, k)
+	}
+	self.mu.RUnlock()
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := dialRedis(self.config, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var slots [redisClusterSlots]string
+		for _, v := range reply {
+			item, err := redis.Values(v, nil)
+			if err != nil || len(item) < 3 {
+				continue
+			}
+			start, _ := redis.Int(item[0], nil)
+			end, _ := redis.Int(item[1], nil)
+			node, err := redis.Values(item[2], nil)
+			if err != nil || len(node) < 2 {
+				continue
+			}
+			host, _ := redis.String(node[0], nil)
+			port, _ := redis.Int(node[1], nil)
+			if len(host) == 0 {
+				host, _, _ = net.SplitHostPort(addr)
+			}
+			master := net.JoinHostPort(host, strconv.Itoa(port))
+			for i := start; i <= end && i < redisClusterSlots; i++ {
+				slots[i] = master
+			}
+		}
+		self.mu.Lock()
+		self.slots = slots
+		self.mu.Unlock()
+		return nil
+	}
+	return utils.Error("redis cluster slots refresh failed: ", lastErr)
+}
+
+// 异步刷新槽位, 同一时间仅执行一次
+func (self *redisCluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&self.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&self.refreshing, 0)
+		if err := self.refresh(); err != nil {
+			zlog.Error("redis cluster refresh failed", 0, zlog.AddError(err))
+		}
+	}()
+}
+
+func (self *redisCluster) pool(addr string) *redis.Pool {
+	self.mu.RLock()
+	pool, ok := self.pools[addr]
+	self.mu.RUnlock()
+	if ok {
+		return pool
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if pool, ok = self.pools[addr]; ok {
+		return pool
+	}
+	pool = newRedisPool(self.config, func() (redis.Conn, error) {
+		return dialRedis(self.config, addr)
+	}, testRedisRole(""))
+	self.pools[addr] = pool
+	return pool
+}
+
+// 关闭全部节点连接池
+func (self *redisCluster) close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	var errs []error
+	for k, v := range self.pools {
+		if err := v.Close(); err != nil {
+			errs = append(errs, utils.Error("redis cluster node [", k, "] close failed: ", err))
+		}
+	}
+	if len(errs) > 0 {
+		return &utils.MultiError{Errors: errs}
+	}
+	return nil
+}
+
+// 槽位对应节点, 未知槽位随机选择一个主节点
+func (self *redisCluster) node(key string, hasKey bool) string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	if hasKey {
+		if addr := self.slots[redisSlot(key)]; len(addr) > 0 {
+			return addr
+		}
+	}
+	masters := self.masters()
+	if len(masters) == 0 {
+		return self.config.Addrs[rand.Intn(len(self.config.Addrs))]
+	}
+	return masters[rand.Intn(len(masters))]
+}
+
+func (self *redisCluster) masters() []string {
+	var result []string
+	exist := make(map[string]bool)
+	for _, v := range self.slots {
+		if len(v) > 0 && !exist[v] {
+			exist[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// 执行命令, 处理MOVED/ASK重定向及节点故障
+func (self *redisCluster) do(cmd string, args ...interface{}) (interface{}, error) {
+	if strings.EqualFold(cmd, "KEYS") {
+		return self.keys(args...)
+	}
+	key, hasKey := clusterKey(cmd, args)
+	addr := self.node(key, hasKey)
+	var asking bool
+	var lastErr error
+	for i := 0; i < redisClusterRedirect; i++ {
+		conn := self.pool(addr).Get()
+		if asking {
+			if _, err := conn.Do("ASKING"); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			asking = false
+		}
+		reply, err := conn.Do(cmd, args...)
+		connErr := conn.Err()
+		conn.Close()
+		if err == nil {
+			return reply, nil
+		}
+		lastErr = err
+		if rerr, ok := err.(redis.Error); ok {
+			msg := string(rerr)
+			if strings.HasPrefix(msg, "MOVED ") || strings.HasPrefix(msg, "ASK ") {
+				parts := strings.Split(msg, " ")
+				if len(parts) != 3 {
+					return nil, err
+				}
+				addr = parts[2]
+				if parts[0] == "ASK" {
+					asking = true
+				} else {
+					if slot, err := strconv.Atoi(parts[1]); err == nil && slot < redisClusterSlots {
+						self.mu.Lock()
+						self.slots[slot] = addr
+						self.mu.Unlock()
+					}
+					self.refreshAsync()
+				}
+				continue
+			}
+			if strings.HasPrefix(msg, "CLUSTERDOWN") || strings.HasPrefix(msg, "TRYAGAIN") {
+				time.Sleep(time.Duration(100*(i+1)) * time.Millisecond)
+				continue
+			}
+			return nil, err
+		}
+		if connErr == nil { // 非连接错误, 如参数类型错误
+			return nil, err
+		}
+		// 节点不可用, 刷新槽位后重试
+		if err := self.refresh(); err != nil {
+			zlog.Error("redis cluster refresh failed", 0, zlog.AddError(err))
+		}
+		addr = self.node(key, hasKey)
+	}
+	return nil, lastErr
+}
+
+// KEYS在所有主节点执行并合并结果
+func (self *redisCluster) keys(args ...interface{}) (interface{}, error) {
+	self.mu.RLock()
+	masters := self.masters()
+	self.mu.RUnlock()
+	var result []interface{}
+	for _, addr := range masters {
+		conn := self.pool(addr).Get()
+		reply, err := redis.Values(conn.Do("KEYS", args...))
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, reply...)
+	}
+	return result, nil
+}
+
+// 事务命令的key须位于同一槽位, 在槽位所属节点执行MULTI/EXEC
+func (self *redisCluster) exec(cmds []clusterCommand) (interface{}, error) {
+	if len(cmds) == 0 {
+		return []interface{}{}, nil
+	}
+	slot := -1
+	var key string
+	for _, v := range cmds {
+		k, hasKey := clusterKey(v.cmd, v.args)
+		if !hasKey {
+			return nil, utils.Error("redis cluster transaction command [", v.cmd, "] has no key")
+		}
+		if s := redisSlot(k); slot < 0 {
+			slot, key = s, k
+		} else if s != slot {
+			return nil, utils.Error("redis cluster transaction keys [", key, "] and [", k, "] not in the same slot, use {tag} to group keys")
+		}
+	}
+	conn := self.pool(self.node(key, true)).Get()
+	defer conn.Close()
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, v := range cmds {
+		if err := conn.Send(v.cmd, v.args...); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := conn.Do("EXEC")
+	if err != nil {
+		if rerr, ok := err.(redis.Error); ok && strings.HasPrefix(string(rerr), "MOVED ") {
+			self.refreshAsync()
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+// 订阅连接, 集群内发布的消息会广播到所有节点, 任选一个节点订阅
+func (self *redisCluster) subscribeConn() redis.Conn {
+	return self.pool(self.node("", false)).Get()
+}
+
+// 集群连接, 命令按key路由到对应节点执行
+// MULTI/EXEC仅支持同一槽位的key(可使用{tag}指定哈希部分), 在槽位所属节点以事务执行, 跨槽位时拒绝
+type clusterConn struct {
+	cluster *redisCluster
+	pending []clusterCommand
+}
+
+type clusterCommand struct {
+	cmd  string
+	args []interface{}
+}
+
+func (self *clusterConn) Close() error {
+	self.pending = nil
+	return nil
+}
+
+func (self *clusterConn) Err() error {
+	return nil
+}
+
+func (self *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	pending := self.pending
+	self.pending = nil
+	if len(pending) > 0 && strings.EqualFold(pending[0].cmd, "MULTI") {
+		if !strings.EqualFold(cmd, "EXEC") {
+			return nil, utils.Error("redis cluster conn transaction must end with EXEC")
+		}
+		return self.cluster.exec(pending[1:])
+	}
+	var reply interface{}
+	for _, v := range pending {
+		if strings.EqualFold(v.cmd, "MULTI") {
+			return nil, errClusterMulti
+		}
+		r, err := self.cluster.do(v.cmd, v.args...)
+		if err != nil {
+			return nil, err
+		}
+		reply = r
+	}
+	if len(cmd) == 0 {
+		return reply, nil
+	}
+	if strings.EqualFold(cmd, "MULTI") || strings.EqualFold(cmd, "EXEC") {
+		return nil, errClusterMulti
+	}
+	return self.cluster.do(cmd, args...)
+}
+
+func (self *clusterConn) Send(cmd string, args ...interface{}) error {
+	self.pending = append(self.pending, clusterCommand{cmd: cmd, args: args})
+	return nil
+}
+
+func (self *clusterConn) Flush() error {
+	return nil
+}
+
+func (self *clusterConn) Receive() (interface{}, error) {
+	if len(self.pending) == 0 {
+		return nil, utils.Error("redis cluster conn no pending command")
+	}
+	v := self.pending[0]
+	self.pending = self.pending[1:]
+	if strings.EqualFold(v.cmd, "MULTI") || strings.EqualFold(v.cmd, "EXEC") { // 管道模式无法保证事务在同一节点执行
+		return nil, errClusterMulti
+	}
+	return self.cluster.do(v.cmd, v.args...)
+}
+
+// 命令的路由key, EVAL/EVALSHA取第一个KEYS参数
+func clusterKey(cmd string, args []interface{}) (string, bool) {
+	index := 0
+	switch strings.ToUpper(cmd) {
+	case "EVAL", "EVALSHA":
+		index = 2
+	case "XGROUP", "XINFO":
+		index = 1
+	case "XREAD", "XREADGROUP": // 首个key位于STREAMS之后
+		index = -1
+		for i, v := range args {
+			if s, ok := v.(string); ok && strings.ToUpper(s) == "STREAMS" {
+				index = i + 1
+				break
+			}
+		}
+		if index < 0 {
+			return "", false
+		}
+	case "PING", "INFO", "PUBLISH", "SCRIPT":
+		return "", false
+	}
+	if len(args) <= index {
+		return "", false
+	}
+	switch v := args[index].(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return utils.AnyToStr(args[index]), true
+}
+
+// 计算key槽位, 支持{tag}指定哈希部分
+func redisSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % redisClusterSlots)
+}
+
+// CRC16/XMODEM
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,433 @@
+package cache
+
+import (
+	"context"
+	"github.com/garyburd/redigo/redis"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 基于Redis Streams的轻量消息队列, 消费组内每条消息仅投递给一个消费者, 回调成功后XACK确认(至少一次)
+// 消费者宕机未确认的消息空闲超过ClaimIdle后由组内其他消费者通过XAUTOCLAIM接管, 需Redis 6.2+
+// 开启IsNack时按消费组已投递次数限制重试, 达到MaxRetries后携带失败信息转入死信队列并确认原消息
+
+const (
+	streamType    = "ty"
+	streamContent = "co"
+	streamNonce   = "no"
+
+	streamDeadStream  = "x-dead-letter-stream"
+	streamDeadId      = "x-dead-letter-id"
+	streamDeadError   = "x-dead-letter-error"
+	streamDeadRetries = "x-dead-letter-retries"
+)
+
+var (
+	streamMu     sync.Mutex
+	streamQueues []*StreamQueue
+)
+
+// StreamConfig 消费组监听配置参数
+type StreamConfig struct {
+	Group         string // 消费组名称
+	Consumer      string // 消费者名称, 默认主机名-进程号, 重启后沿用同名可先处理自身未确认消息
+	Count         int    // 单次读取消息数, 默认10
+	Block         int    // 阻塞读取超时/毫秒, 默认5000
+	ClaimIdle     int    // 未确认消息空闲超过该时长后被接管/毫秒, 默认60000
+	ClaimInterval int    // 接管检查间隔/秒, 默认30
+	IsNack        bool   // 回调失败时是否保留未确认, 由接管重新投递, 否则确认后丢弃
+	MaxRetries    int    // 消息已投递次数达到该值且回调仍失败时转入死信队列, 0则无限重试, 仅IsNack开启时生效
+	DeadLetter    string // 死信队列key, 默认{stream}.dlq
+}
+
+// StreamMessage 队列消息
+type StreamMessage struct {
+	Id      string      // 消息ID, 由Redis生成
+	Stream  string      // 队列key
+	Type    int64       // 消息类型
+	Content interface{} // 消息内容, 消费时按ContentInter转换, 默认map
+	Nonce   string      // 消息唯一标识
+	ctx     context.Context
+}
+
+// Context 消息上下文
+func (self *StreamMessage) Context() context.Context {
+	if self.ctx == nil {
+		return context.Background()
+	}
+	return self.ctx
+}
+
+// StreamReceiver 消费者, 与rabbitmq.PullReceiver一致使用回调处理消息
+type StreamReceiver struct {
+	Config       *StreamConfig
+	ContentInter func(typ int64) interface{}
+	Callback     func(msg *StreamMessage) error
+	Debug        bool // 是否打印具体消息实体
+}
+
+// StreamQueue Redis Streams队列
+type StreamQueue struct {
+	manager *RedisManager
+	stream  string
+	maxLen  int64
+	wg      sync.WaitGroup
+	closed  int32
+}
+
+type streamEntry struct {
+	id     string
+	fields map[string]string
+}
+
+// NewStreamQueue 创建队列, maxLen>0时发送消息按近似长度裁剪
+func NewStreamQueue(stream string, maxLen int64, ds ...string) (*StreamQueue, error) {
+	if len(stream) == 0 {
+		return nil, utils.Error("redis stream key is nil")
+	}
+	manager, err := NewRedis(ds...)
+	if err != nil {
+		return nil, err
+	}
+	queue := &StreamQueue{manager: manager, stream: stream, maxLen: maxLen}
+	streamMu.Lock()
+	streamQueues = append(streamQueues, queue)
+	streamMu.Unlock()
+	return queue, nil
+}
+
+// Publish 发送消息, 返回消息ID
+func (self *StreamQueue) Publish(dataType int64, content interface{}) (string, error) {
+	if atomic.LoadInt32(&self.closed) == 1 {
+		return "", utils.Error("redis stream [", self.stream, "] closed")
+	}
+	body, err := utils.JsonMarshal(content)
+	if err != nil {
+		return "", err
+	}
+	args := []interface{}{self.stream}
+	if self.maxLen > 0 {
+		args = append(args, "MAXLEN", "~", self.maxLen)
+	}
+	args = append(args, "*", streamType, dataType, streamContent, body, streamNonce, utils.RandNonce())
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	return redis.String(conn.Do("XADD", args...))
+}
+
+// Len 队列消息数
+func (self *StreamQueue) Len() (int64, error) {
+	conn := self.manager.readConn()
+	defer self.manager.Close(conn)
+	return redis.Int64(conn.Do("XLEN", self.stream))
+}
+
+// Pending 消费组已投递未确认的消息数
+func (self *StreamQueue) Pending(group string) (int64, error) {
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	values, err := redis.Values(conn.Do("XPENDING", self.stream, group))
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	return redis.Int64(values[0], nil)
+}
+
+// AddReceiver 添加消费者, 每个消费者独立协程阻塞读取
+func (self *StreamQueue) AddReceiver(receivers ...*StreamReceiver) error {
+	for _, v := range receivers {
+		if v.Config == nil || len(v.Config.Group) == 0 {
+			return utils.Error("redis stream receiver group is nil")
+		}
+		if v.Callback == nil {
+			return utils.Error("redis stream receiver callback is nil")
+		}
+		if len(v.Config.Consumer) == 0 {
+			host, _ := os.Hostname()
+			v.Config.Consumer = utils.AddStr(host, "-", os.Getpid())
+		}
+		if v.Config.Count <= 0 {
+			v.Config.Count = 10
+		}
+		if v.Config.Block <= 0 {
+			v.Config.Block = 5000
+		}
+		if v.Config.ClaimIdle <= 0 {
+			v.Config.ClaimIdle = 60000
+		}
+		if v.Config.ClaimInterval <= 0 {
+			v.Config.ClaimInterval = 30
+		}
+		if err := self.createGroup(v.Config.Group); err != nil {
+			return err
+		}
+		self.wg.Add(1)
+		go self.listen(v)
+		zlog.Printf("redis stream [%s - %s - %s] listen successful", self.stream, v.Config.Group, v.Config.Consumer)
+	}
+	return nil
+}
+
+// 创建消费组, 从最新消息开始消费, 已存在时忽略
+func (self *StreamQueue) createGroup(group string) error {
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	if _, err := conn.Do("XGROUP", "CREATE", self.stream, group, "$", "MKSTREAM"); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return utils.Error("redis stream [", self.stream, "] create group [", group, "] failed: ", err)
+	}
+	return nil
+}
+
+// listen 先处理本消费者历史未确认消息, 再阻塞读取新消息, 并定期接管其他消费者超时未确认的消息
+func (self *StreamQueue) listen(receiver *StreamReceiver) {
+	defer self.wg.Done()
+	id := "0"
+	claimed := time.Now()
+	for atomic.LoadInt32(&self.closed) == 0 {
+		if time.Since(claimed) >= time.Duration(receiver.Config.ClaimInterval)*time.Second {
+			self.claim(receiver)
+			claimed = time.Now()
+		}
+		entries, err := self.read(receiver, id)
+		if err != nil {
+			if atomic.LoadInt32(&self.closed) == 1 {
+				return
+			}
+			zlog.Error("redis stream read failed", 0, zlog.String("stream", self.stream), zlog.String("group", receiver.Config.Group), zlog.AddError(err))
+			time.Sleep(2500 * time.Millisecond)
+			continue
+		}
+		if id != ">" {
+			if len(entries) == 0 { // 历史未确认消息处理完毕
+				id = ">"
+				continue
+			}
+			id = entries[len(entries)-1].id
+		}
+		for _, v := range entries {
+			self.handle(receiver, v)
+		}
+	}
+}
+
+func (self *StreamQueue) read(receiver *StreamReceiver, id string) ([]streamEntry, error) {
+	args := []interface{}{"GROUP", receiver.Config.Group, receiver.Config.Consumer, "COUNT", receiver.Config.Count}
+	if id == ">" {
+		args = append(args, "BLOCK", receiver.Config.Block)
+	}
+	args = append(args, "STREAMS", self.stream, id)
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	values, err := redis.Values(conn.Do("XREADGROUP", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []streamEntry
+	for _, v := range values {
+		stream, err := redis.Values(v, nil)
+		if err != nil || len(stream) < 2 {
+			return nil, utils.Error("redis stream reply invalid: ", err)
+		}
+		entries, err := parseStreamEntries(stream[1])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entries...)
+	}
+	return result, nil
+}
+
+// claim 接管空闲超过ClaimIdle的未确认消息
+func (self *StreamQueue) claim(receiver *StreamReceiver) {
+	start := "0-0"
+	for atomic.LoadInt32(&self.closed) == 0 {
+		conn := self.manager.Pool.Get()
+		values, err := redis.Values(conn.Do("XAUTOCLAIM", self.stream, receiver.Config.Group, receiver.Config.Consumer,
+			receiver.Config.ClaimIdle, start, "COUNT", receiver.Config.Count))
+		self.manager.Close(conn)
+		if err != nil || len(values) < 2 {
+			zlog.Error("redis stream claim failed", 0, zlog.String("stream", self.stream), zlog.String("group", receiver.Config.Group), zlog.AddError(err))
+			return
+		}
+		entries, err := parseStreamEntries(values[1])
+		if err != nil {
+			zlog.Error("redis stream claim reply invalid", 0, zlog.String("stream", self.stream), zlog.AddError(err))
+			return
+		}
+		if len(entries) > 0 {
+			zlog.Warn("redis stream pending messages claimed", 0, zlog.String("stream", self.stream), zlog.String("group", receiver.Config.Group), zlog.String("consumer", receiver.Config.Consumer), zlog.Int("count", len(entries)))
+		}
+		for _, v := range entries {
+			self.handle(receiver, v)
+		}
+		if start, err = redis.String(values[0], nil); err != nil || start == "0-0" {
+			return
+		}
+	}
+}
+
+// handle 处理单条消息, 成功或无需重试时确认, 重试次数耗尽时转入死信队列后确认
+func (self *StreamQueue) handle(receiver *StreamReceiver, entry streamEntry) {
+	ack, cause := receiver.receive(self.stream, entry)
+	if !ack && receiver.Config.MaxRetries > 0 {
+		if deliveries := self.deliveries(receiver.Config.Group, entry.id); deliveries >= int64(receiver.Config.MaxRetries) {
+			ack = self.deadLetter(receiver, entry, deliveries, cause)
+		}
+	}
+	if ack {
+		self.ack(receiver.Config.Group, entry.id)
+	}
+}
+
+// deliveries 消息在消费组内已投递次数(含接管重投), 查询失败时返回0
+func (self *StreamQueue) deliveries(group, id string) int64 {
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	values, err := redis.Values(conn.Do("XPENDING", self.stream, group, id, id, 1))
+	if err != nil || len(values) == 0 {
+		if err != nil {
+			zlog.Error("redis stream pending query failed", 0, zlog.String("stream", self.stream), zlog.String("id", id), zlog.AddError(err))
+		}
+		return 0
+	}
+	entry, err := redis.Values(values[0], nil)
+	if err != nil || len(entry) < 4 {
+		return 0
+	}
+	deliveries, _ := redis.Int64(entry[3], nil)
+	return deliveries
+}
+
+// deadLetter 携带原队列、消息ID、失败原因及投递次数转入死信队列, 返回是否成功, 失败时保留未确认等待下次接管
+func (self *StreamQueue) deadLetter(receiver *StreamReceiver, entry streamEntry, deliveries int64, cause error) bool {
+	dead := receiver.Config.DeadLetter
+	if len(dead) == 0 {
+		dead = utils.AddStr(self.stream, ".dlq")
+	}
+	args := []interface{}{dead, "*"}
+	for k, v := range entry.fields {
+		args = append(args, k, v)
+	}
+	args = append(args, streamDeadStream, self.stream, streamDeadId, entry.id, streamDeadRetries, deliveries)
+	if cause != nil {
+		args = append(args, streamDeadError, cause.Error())
+	}
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	if _, err := conn.Do("XADD", args...); err != nil {
+		zlog.Error("redis stream dead letter failed", 0, zlog.String("stream", self.stream), zlog.String("id", entry.id), zlog.AddError(err))
+		return false
+	}
+	zlog.Warn("redis stream message moved to dead letter", 0, zlog.String("stream", self.stream), zlog.String("group", receiver.Config.Group), zlog.String("id", entry.id), zlog.String("deadLetter", dead), zlog.Int64("deliveries", deliveries))
+	return true
+}
+
+func (self *StreamQueue) ack(group, id string) {
+	conn := self.manager.Pool.Get()
+	defer self.manager.Close(conn)
+	if _, err := conn.Do("XACK", self.stream, group, id); err != nil {
+		zlog.Error("redis stream ack failed", 0, zlog.String("stream", self.stream), zlog.String("id", id), zlog.AddError(err))
+	}
+}
+
+// receive 返回是否确认消息, 回调失败且开启IsNack时保留未确认并返回回调错误
+func (self *StreamReceiver) receive(stream string, entry streamEntry) (bool, error) {
+	if entry.fields == nil { // 消息已被裁剪删除
+		return true, nil
+	}
+	if self.Debug {
+		defer zlog.Debug("redis stream consumption data monitoring", utils.UnixMilli(), zlog.String("id", entry.id), zlog.Any("message", entry.fields))
+	}
+	msg := &StreamMessage{Id: entry.id, Stream: stream, Nonce: entry.fields[streamNonce]}
+	if v, ok := entry.fields[streamType]; ok {
+		typ, err := utils.StrToInt64(v)
+		if err != nil {
+			zlog.Error("redis stream consumption data type invalid", 0, zlog.String("stream", stream), zlog.String("id", entry.id), zlog.AddError(err))
+			return true, nil
+		}
+		msg.Type = typ
+	}
+	var content interface{} = &map[string]interface{}{}
+	if self.ContentInter != nil {
+		content = self.ContentInter(msg.Type)
+	}
+	if err := utils.JsonUnmarshal(utils.Str2Bytes(entry.fields[streamContent]), content); err != nil {
+		zlog.Error("redis stream consumption data parsing failed", 0, zlog.String("stream", stream), zlog.String("id", entry.id), zlog.AddError(err))
+		return true, nil
+	}
+	if v, ok := content.(*map[string]interface{}); ok {
+		msg.Content = *v
+	} else {
+		msg.Content = content
+	}
+	if err := self.call(msg); err != nil {
+		zlog.Error("redis stream consumption data processing failed", 0, zlog.String("stream", stream), zlog.String("group", self.Config.Group), zlog.String("id", entry.id), zlog.AddError(err))
+		return !self.Config.IsNack, err
+	}
+	return true, nil
+}
+
+// 回调异常视为处理失败
+func (self *StreamReceiver) call(msg *StreamMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = utils.Error("redis stream callback panic: ", r)
+		}
+	}()
+	return self.Callback(msg)
+}
+
+// 解析消息列表 [[id, [field, value, ...]], ...]
+func parseStreamEntries(reply interface{}) ([]streamEntry, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]streamEntry, 0, len(values))
+	for _, v := range values {
+		entry, err := redis.Values(v, nil)
+		if err != nil || len(entry) < 2 {
+			return nil, utils.Error("redis stream entry invalid: ", err)
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if entry[1] == nil {
+			result = append(result, streamEntry{id: id})
+			continue
+		}
+		fields, err := redis.StringMap(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, streamEntry{id: id, fields: fields})
+	}
+	return result, nil
+}
+
+// CloseStream 停止全部队列消费, 等待阻塞读取超时及处理中的消息完成
+func CloseStream() error {
+	streamMu.Lock()
+	queues := streamQueues
+	streamQueues = nil
+	streamMu.Unlock()
+	for _, v := range queues {
+		atomic.StoreInt32(&v.closed, 1)
+	}
+	for _, v := range queues {
+		v.wg.Wait()
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/godaddy-x/freego/utils"
+	"time"
+)
+
+// 雪花机器ID租约, 每个机器ID对应一个带过期时间的键, 续约及重新分配由utils.LeaseSnowflakeWorker处理
+
+const (
+	workerLeaseKey = "snowflake:worker:"
+	workerLeaseTTL = 30 * time.Second
+)
+
+var renewLeaseScript = redis.NewScript(1, `
+	if redis.call("get", KEYS[1]) == ARGV[1]
+	then
+		return redis.call("pexpire", KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+var releaseLeaseScript = redis.NewScript(1, `
+	if redis.call("get", KEYS[1]) == ARGV[1]
+	then
+		return redis.call("del", KEYS[1])
+	end
+	return 0
+`)
+
+type workerStore struct {
+	rds   *RedisManager
+	token string
+}
+
+// LeaseSnowflakeWorker 分配数据中心下空闲的机器ID并设置雪花节点, 返回释放函数, 停机时调用释放租约
+func (self *RedisManager) LeaseSnowflakeWorker(datacenter int64) (func() error, error) {
+	return utils.LeaseSnowflakeWorker(&workerStore{rds: self, token: utils.GetUUID()}, datacenter, workerLeaseTTL)
+}
+
+func (self *workerStore) key(datacenter, worker int64) string {
+	return utils.AddStr(workerLeaseKey, datacenter, ":", worker)
+}
+
+func (self *workerStore) Acquire(datacenter, worker int64) (bool, error) {
+	conn := self.rds.Pool.Get()
+	defer self.rds.Close(conn)
+	_, err := redis.String(conn.Do("SET", self.key(datacenter, worker), self.token, "PX", workerLeaseTTL.Milliseconds(), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (self *workerStore) Renew(datacenter, worker int64) (bool, error) {
+	conn := self.rds.Pool.Get()
+	defer self.rds.Close(conn)
+	ok, err := redis.Int(renewLeaseScript.Do(conn, self.key(datacenter, worker), self.token, workerLeaseTTL.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (self *workerStore) Release(datacenter, worker int64) error {
+	conn := self.rds.Pool.Get()
+	defer self.rds.Close(conn)
+	_, err := releaseLeaseScript.Do(conn, self.key(datacenter, worker), self.token)
+	return err
+}
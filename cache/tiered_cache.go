@@ -0,0 +1,323 @@
+package cache
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+	"time"
+)
+
+// 二级缓存, 读取时优先本地缓存(L1), 未命中时读取redis(L2)并写入本地缓存
+// 写入/删除时更新redis并删除本地缓存, 通过redis发布失效消息通知其他实例删除本地缓存
+// 订阅连接断开重连后清空本地缓存, 避免断开期间的失效消息丢失导致读取旧数据
+
+const tieredChannel = "cache.tiered.invalidate"
+
+// TieredOption 二级缓存选项
+type TieredOption struct {
+	Channel string // 失效消息频道, 默认cache.tiered.invalidate
+	Expire  int    // 本地缓存时间/秒, 默认60, 不超过redis剩余有效期
+}
+
+// TieredCache 本地缓存+redis二级缓存
+type TieredCache struct {
+	CacheManager
+	local   Cache
+	remote  *RedisManager
+	option  TieredOption
+	id      string // 实例标识, 忽略本实例发布的失效消息
+	mu      sync.Mutex
+	conn    redis.Conn
+	stopped bool
+}
+
+var (
+	tieredMu     sync.Mutex
+	tieredCaches []*TieredCache
+)
+
+type tieredMessage struct {
+	Id   string   `json:"i"`
+	Keys []string `json:"k"`
+}
+
+// Tiered 创建二级缓存并开始监听失效消息
+func Tiered(local Cache, remote *RedisManager, option ...TieredOption) *TieredCache {
+	tiered := &TieredCache{local: local, remote: remote, id: utils.NextSID()}
+	if len(option) > 0 {
+		tiered.option = option[0]
+	}
+	if len(tiered.option.Channel) == 0 {
+		tiered.option.Channel = tieredChannel
+	}
+	if tiered.option.Expire <= 0 {
+		tiered.option.Expire = 60
+	}
+	tieredMu.Lock()
+	tieredCaches = append(tieredCaches, tiered)
+	tieredMu.Unlock()
+	go tiered.listen()
+	return tiered
+}
+
+// CloseTiered 停止全部二级缓存的失效消息监听, 停机时在关闭redis前调用
+func CloseTiered() {
+	tieredMu.Lock()
+	caches := tieredCaches
+	tieredCaches = nil
+	tieredMu.Unlock()
+	for _, v := range caches {
+		v.Close()
+	}
+}
+
+// Close 停止监听失效消息
+func (self *TieredCache) Close() {
+	tieredMu.Lock()
+	for i, v := range tieredCaches {
+		if v == self {
+			tieredCaches = append(tieredCaches[:i], tieredCaches[i+1:]...)
+			break
+		}
+	}
+	tieredMu.Unlock()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.stopped = true
+	if self.conn != nil {
+		self.conn.Close()
+	}
+}
+
+func (self *TieredCache) listen() {
+	var reconnect bool
+	for {
+		self.mu.Lock()
+		if self.stopped {
+			self.mu.Unlock()
+			return
+		}
+		conn := self.remote.subscribeConn()
+		self.conn = conn
+		self.mu.Unlock()
+		psc := redis.PubSubConn{Conn: conn}
+		if err := psc.Subscribe(self.option.Channel); err != nil {
+			zlog.Error("[TieredCache] subscribe failed", 0, zlog.String("channel", self.option.Channel), zlog.AddError(err))
+			conn.Close()
+			time.Sleep(time.Second)
+			continue
+		}
+		if reconnect {
+			if err := self.local.Flush(); err != nil {
+				zlog.Error("[TieredCache] local flush failed", 0, zlog.AddError(err))
+			}
+		}
+		reconnect = true
+		for {
+			v := psc.Receive()
+			if msg, ok := v.(redis.Message); ok {
+				self.invalidate(msg.Data)
+			} else if err, ok := v.(error); ok {
+				zlog.Warn("[TieredCache] receive failed", 0, zlog.String("channel", self.option.Channel), zlog.AddError(err))
+				break
+			}
+		}
+		conn.Close()
+	}
+}
+
+func (self *TieredCache) invalidate(data []byte) {
+	msg := tieredMessage{}
+	if err := utils.JsonUnmarshal(data, &msg); err != nil {
+		zlog.Error("[TieredCache] invalid message", 0, zlog.String("data", utils.Bytes2Str(data)), zlog.AddError(err))
+		return
+	}
+	if msg.Id == self.id {
+		return
+	}
+	if err := self.local.Del(msg.Keys...); err != nil {
+		zlog.Error("[TieredCache] local delete failed", 0, zlog.AddError(err))
+	}
+}
+
+// 删除本地缓存并通知其他实例
+func (self *TieredCache) evict(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := self.local.Del(keys...); err != nil {
+		zlog.Error("[TieredCache] local delete failed", 0, zlog.AddError(err))
+	}
+	bs, err := utils.JsonMarshal(&tieredMessage{Id: self.id, Keys: keys})
+	if err != nil {
+		zlog.Error("[TieredCache] marshal message failed", 0, zlog.AddError(err))
+		return
+	}
+	if _, err := self.remote.Publish(self.option.Channel, bs, 1); err != nil {
+		zlog.Error("[TieredCache] publish failed", 0, zlog.String("channel", self.option.Channel), zlog.AddError(err))
+	}
+}
+
+// 读取数据, 本地未命中时读取redis并写入本地缓存, 本地缓存时间不超过redis剩余有效期
+func (self *TieredCache) load(key string) ([]byte, error) {
+	bs, err := self.local.GetBytes(key)
+	if err == nil && len(bs) > 0 {
+		return bs, nil
+	}
+	bs, pttl, err := self.remote.getBytesWithPTTL(key)
+	if err != nil || len(bs) == 0 {
+		return nil, err
+	}
+	expire := self.option.Expire
+	if pttl >= 0 && pttl/1000 < int64(expire) {
+		expire = int(pttl / 1000)
+	}
+	if expire <= 0 { // redis即将过期, 不写入本地缓存
+		return bs, nil
+	}
+	if err := self.local.Put(key, bs, expire); err != nil {
+		zlog.Error("[TieredCache] local put failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+	return bs, nil
+}
+
+func (self *TieredCache) Get(key string, input interface{}) (interface{}, bool, error) {
+	bs, err := self.load(key)
+	if err != nil || len(bs) == 0 {
+		return nil, false, err
+	}
+	if input == nil {
+		return bs, true, nil
+	}
+	return bs, true, utils.JsonUnmarshal(bs, input)
+}
+
+func (self *TieredCache) GetInt64(key string) (int64, error) {
+	bs, err := self.load(key)
+	if err != nil || len(bs) == 0 {
+		return 0, err
+	}
+	return utils.StrToInt64(utils.Bytes2Str(bs))
+}
+
+func (self *TieredCache) GetFloat64(key string) (float64, error) {
+	bs, err := self.load(key)
+	if err != nil || len(bs) == 0 {
+		return 0, err
+	}
+	return utils.StrToFloat(utils.Bytes2Str(bs))
+}
+
+func (self *TieredCache) GetString(key string) (string, error) {
+	bs, err := self.load(key)
+	if err != nil || len(bs) == 0 {
+		return "", err
+	}
+	return utils.Bytes2Str(bs), nil
+}
+
+func (self *TieredCache) GetBytes(key string) ([]byte, error) {
+	return self.load(key)
+}
+
+func (self *TieredCache) GetBool(key string) (bool, error) {
+	bs, err := self.load(key)
+	if err != nil || len(bs) == 0 {
+		return false, err
+	}
+	return utils.StrToBool(utils.Bytes2Str(bs))
+}
+
+func (self *TieredCache) Put(key string, input interface{}, expire ...int) error {
+	if err := self.remote.Put(key, input, expire...); err != nil {
+		return err
+	}
+	self.evict(key)
+	return nil
+}
+
+func (self *TieredCache) PutBatch(objs ...*PutObj) error {
+	if err := self.remote.PutBatch(objs...); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(objs))
+	for _, v := range objs {
+		keys = append(keys, v.Key)
+	}
+	self.evict(keys...)
+	return nil
+}
+
+func (self *TieredCache) PutNX(key string, input interface{}, expire int) (bool, error) {
+	ok, err := self.remote.PutNX(key, input, expire)
+	if err != nil || !ok {
+		return ok, err
+	}
+	self.evict(key)
+	return true, nil
+}
+
+func (self *TieredCache) Del(key ...string) error {
+	if err := self.remote.Del(key...); err != nil {
+		return err
+	}
+	self.evict(key...)
+	return nil
+}
+
+func (self *TieredCache) Exists(key string) (bool, error) {
+	if ok, err := self.local.Exists(key); err == nil && ok {
+		return true, nil
+	}
+	return self.remote.Exists(key)
+}
+
+func (self *TieredCache) Size(pattern ...string) (int, error) {
+	return self.remote.Size(pattern...)
+}
+
+func (self *TieredCache) Keys(pattern ...string) ([]string, error) {
+	return self.remote.Keys(pattern...)
+}
+
+// Flush 仅清空本地缓存
+func (self *TieredCache) Flush() error {
+	return self.local.Flush()
+}
+
+func (self *TieredCache) Brpop(key string, expire int64, result interface{}) error {
+	return self.remote.Brpop(key, expire, result)
+}
+
+func (self *TieredCache) BrpopString(key string, expire int64) (string, error) {
+	return self.remote.BrpopString(key, expire)
+}
+
+func (self *TieredCache) BrpopInt64(key string, expire int64) (int64, error) {
+	return self.remote.BrpopInt64(key, expire)
+}
+
+func (self *TieredCache) BrpopFloat64(key string, expire int64) (float64, error) {
+	return self.remote.BrpopFloat64(key, expire)
+}
+
+func (self *TieredCache) BrpopBool(key string, expire int64) (bool, error) {
+	return self.remote.BrpopBool(key, expire)
+}
+
+func (self *TieredCache) Rpush(key string, val interface{}) error {
+	return self.remote.Rpush(key, val)
+}
+
+func (self *TieredCache) Publish(key string, val interface{}, try ...int) (bool, error) {
+	return self.remote.Publish(key, val, try...)
+}
+
+func (self *TieredCache) Subscribe(key string, timeout int, call func(msg string) (bool, error)) error {
+	return self.remote.Subscribe(key, timeout, call)
+}
+
+func (self *TieredCache) LuaScript(script string, key []string, val ...interface{}) (interface{}, error) {
+	return self.remote.LuaScript(script, key, val...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/godaddy-x/freego/utils"
+	"os"
+)
+
+// 配置值加解密工具
+// 加密: FREEGO_CONFIG_KEY=xxx go run ./cmd/encconfig -value 123456
+// 解密: FREEGO_CONFIG_KEY=xxx go run ./cmd/encconfig -d -value enc:xxx
+// 校验配置文件: FREEGO_CONFIG_KEY=xxx go run ./cmd/encconfig -file resource/mysql.json
+func main() {
+	value := flag.String("value", "", "config value")
+	file := flag.String("file", "", "decrypt json config file and print")
+	decrypt := flag.Bool("d", false, "decrypt value")
+	keyEnv := flag.String("env", utils.ConfigKeyEnvName, "config key env name")
+	keyFile := flag.String("keyfile", "", "config key file, takes precedence over env")
+	flag.Parse()
+
+	var provider utils.KeyProvider = utils.EnvKeyProvider{Name: *keyEnv}
+	if len(*keyFile) > 0 {
+		provider = utils.FileKeyProvider{Path: *keyFile}
+	}
+	utils.SetKeyProvider(provider)
+
+	if len(*file) > 0 {
+		data, err := utils.ReadFile(*file)
+		if err != nil {
+			exit(err)
+		}
+		result, err := utils.DecryptConfig(data)
+		if err != nil {
+			exit(err)
+		}
+		fmt.Println(utils.Bytes2Str(result))
+		return
+	}
+	if len(*value) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	key, err := provider.ConfigKey()
+	if err != nil {
+		exit(err)
+	}
+	var result string
+	if *decrypt {
+		result, err = utils.DecryptConfigValue(*value, key)
+	} else {
+		result, err = utils.EncryptConfigValue(*value, key)
+	}
+	if err != nil {
+		exit(err)
+	}
+	fmt.Println(result)
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Go客户端生成, 调用sdk.HttpSDK完成签名/加密及登录, 结构体字段按json名称排序
+
+type goGen struct {
+	names *typeNames
+	defs  []string
+}
+
+func genGo(doc *document, pkg string) ([]byte, error) {
+	endpoints, err := doc.endpoints()
+	if err != nil {
+		return nil, err
+	}
+	self := &goGen{names: newTypeNames(doc)}
+	self.names.used["Client"], self.names.used["NewClient"], self.names.used["HttpSDK"] = true, true, true
+	for _, k := range sortedKeys(doc.Components.Schemas) {
+		if k == "ErrorResp" {
+			continue
+		}
+		self.defs = append(self.defs, self.structDef(exportName(k), doc.Components.Schemas[k]))
+	}
+	var methods []string
+	useURL := false
+	for _, v := range endpoints {
+		methods = append(methods, self.method(v))
+		useURL = useURL || len(v.Params) > 0
+	}
+	var b strings.Builder
+	b.WriteString("// Code generated by freego gen client. DO NOT EDIT.\n")
+	if len(doc.Info.Title) > 0 {
+		fmt.Fprintf(&b, "// %s %s\n", doc.Info.Title, doc.Info.Version)
+	}
+	fmt.Fprintf(&b, "\npackage %s\n\nimport (\n\t\"context\"\n\t\"github.com/godaddy-x/freego/utils/sdk\"\n", pkg)
+	if useURL {
+		b.WriteString("\t\"net/url\"\n")
+	}
+	b.WriteString(")\n\n")
+	b.WriteString("// Client 接口调用客户端, 签名/加密及登录由sdk.HttpSDK处理\ntype Client struct {\n\t*sdk.HttpSDK\n}\n\n")
+	b.WriteString("func NewClient(client *sdk.HttpSDK) *Client {\n\treturn &Client{HttpSDK: client}\n}\n\n")
+	for _, v := range methods {
+		b.WriteString(v)
+	}
+	for _, v := range self.defs {
+		b.WriteString(v)
+	}
+	result, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("format go client failed: %v", err)
+	}
+	return result, nil
+}
+
+func (self *goGen) typeOf(s *schema, hint string) string {
+	if s == nil {
+		return "map[string]interface{}"
+	}
+	if len(s.Ref) > 0 {
+		return "*" + exportName(refName(s.Ref))
+	}
+	if len(s.AllOf) == 1 {
+		return self.typeOf(s.AllOf[0], hint)
+	}
+	switch s.Type {
+	case "boolean":
+		return "bool"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "string":
+		if s.Format == "byte" {
+			return "[]byte"
+		}
+		return "string"
+	case "array":
+		return "[]" + self.typeOf(s.Items, hint+"Item")
+	case "object":
+		if len(s.Properties) > 0 {
+			name := self.names.unique(hint)
+			self.defs = append(self.defs, self.structDef(name, s))
+			return "*" + name
+		}
+		if s.AdditionalProperties != nil {
+			return "map[string]" + self.typeOf(s.AdditionalProperties, hint+"Value")
+		}
+		return "map[string]interface{}"
+	}
+	return "interface{}"
+}
+
+func (self *goGen) structDef(name string, s *schema) string {
+	var b strings.Builder
+	if len(s.Description) > 0 {
+		fmt.Fprintf(&b, "// %s %s\n", name, oneLine(s.Description))
+	}
+	if len(s.Properties) == 0 {
+		fmt.Fprintf(&b, "type %s map[string]interface{}\n\n", name)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "type %s struct {\n", name)
+	fields := map[string]bool{}
+	for _, k := range sortedKeys(s.Properties) {
+		p := s.Properties[k]
+		field := exportName(k)
+		if len(field) == 0 {
+			field = "Field"
+		}
+		for i := 2; fields[field]; i++ {
+			field = fmt.Sprintf("%s%d", exportName(k), i)
+		}
+		fields[field] = true
+		fmt.Fprintf(&b, "\t%s %s `json:%s`", field, self.typeOf(p, name+field), strconv.Quote(k))
+		if desc := schemaDesc(p); len(desc) > 0 {
+			fmt.Fprintf(&b, " // %s", desc)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n\n")
+	return b.String()
+}
+
+// 返回类型名称及是否为结构体
+func (self *goGen) topType(s *schema, hint string) (string, bool) {
+	typ := self.typeOf(s, hint)
+	if strings.HasPrefix(typ, "*") {
+		return typ[1:], true
+	}
+	return typ, false
+}
+
+func (self *goGen) method(ep endpoint) string {
+	reqType, reqNamed := self.topType(ep.Request, ep.Name+"Req")
+	respType, respNamed := self.topType(ep.Response, ep.Name+"Resp")
+	var args, path []string
+	for _, v := range pathSegments(ep.Path) {
+		if strings.HasPrefix(v, "{") {
+			arg := lowerName(exportName(v[1 : len(v)-1]))
+			if token.IsKeyword(arg) || arg == "ctx" || arg == "req" || arg == "resp" || arg == "err" {
+				arg += "Param"
+			}
+			args = append(args, arg+" string")
+			path = append(path, "url.PathEscape("+arg+")")
+		} else {
+			path = append(path, strconv.Quote(v))
+		}
+	}
+	if reqNamed {
+		reqType = "*" + reqType
+	}
+	args = append([]string{"ctx context.Context"}, args...)
+	args = append(args, "req "+reqType)
+	var call string
+	switch {
+	case ep.Mode.Guest:
+		call = "self.PostByGuestContext(ctx, path, req, &resp)"
+	case ep.Mode.Anonymous:
+		call = "self.PostByECCContext(ctx, path, req, &resp)"
+	default:
+		call = fmt.Sprintf("self.PostByAuthContext(ctx, path, req, &resp, %v)", ep.Mode.AesRequest)
+	}
+	var b strings.Builder
+	if len(ep.Summary) > 0 {
+		fmt.Fprintf(&b, "// %s %s\n", ep.Name, oneLine(ep.Summary))
+	}
+	fmt.Fprintf(&b, "// POST %s, %s\n", ep.Path, modeDesc(ep.Mode))
+	if respNamed {
+		fmt.Fprintf(&b, "func (self *Client) %s(%s) (*%s, error) {\n", ep.Name, strings.Join(args, ", "), respType)
+	} else {
+		fmt.Fprintf(&b, "func (self *Client) %s(%s) (%s, error) {\n", ep.Name, strings.Join(args, ", "), respType)
+	}
+	fmt.Fprintf(&b, "\tpath := %s\n\tvar resp %s\n", strings.Join(path, " + "), respType)
+	if respNamed {
+		fmt.Fprintf(&b, "\tif err := %s; err != nil {\n\t\treturn nil, err\n\t}\n\treturn &resp, nil\n}\n\n", call)
+	} else {
+		fmt.Fprintf(&b, "\terr := %s\n\treturn resp, err\n}\n\n", call)
+	}
+	return b.String()
+}
+
+func schemaDesc(s *schema) string {
+	return oneLine(s.Description)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func modeDesc(mode routeMode) string {
+	switch {
+	case mode.Guest:
+		return "游客模式"
+	case mode.Anonymous:
+		return "匿名ECC加密"
+	case mode.AesRequest:
+		return "登录状态AES加密"
+	}
+	return "登录状态"
+}
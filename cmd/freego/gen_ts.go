@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TypeScript客户端生成, 依赖crypto-js实现MD5/HMAC-SHA256/AES-CBC, 与utils.AesEncrypt2/HMAC_SHA256一致
+// 匿名接口的客户端随机密钥ECC加密由ClientConfig.eccEncrypt提供, 需与服务端eccrypto兼容
+// int64字段类型为number | bigint, 超出安全整数范围的值解析为bigint避免精度丢失, 需ES2020及以上
+
+const tsRuntime = `import CryptoJS from 'crypto-js'
+
+export interface AuthToken {
+  token: string
+  secret: string
+  expired: number
+}
+
+export interface ClientConfig {
+  domain: string
+  keyPath?: string // 公钥路径, 默认/key
+  publicKey?: string // 服务端公钥, 设置后不再请求keyPath
+  language?: string
+  timeout?: number // 请求超时/毫秒, 默认30000
+  // ECC加密客户端随机密钥, 返回base64, 匿名接口必须设置
+  eccEncrypt?: (publicKey: string, data: string) => Promise<string>
+}
+
+export class FreegoError extends Error {
+  constructor(public code: number, message: string) {
+    super(message)
+  }
+}
+
+const utf8 = CryptoJS.enc.Utf8
+const b64 = CryptoJS.enc.Base64
+
+function randomHex(n: number): string {
+  const bs = new Uint8Array(n)
+  crypto.getRandomValues(bs)
+  return Array.from(bs, (v) => v.toString(16).padStart(2, '0')).join('')
+}
+
+function aesKey(key: string) {
+  return utf8.parse(CryptoJS.MD5(key).toString())
+}
+
+function aesIv(iv: string) {
+  return utf8.parse(CryptoJS.MD5(iv).toString().substring(0, 16))
+}
+
+function aesEncrypt(data: string, key: string): string {
+  const iv = randomHex(16)
+  const enc = CryptoJS.AES.encrypt(utf8.parse(data), aesKey(key), { iv: aesIv(iv), mode: CryptoJS.mode.CBC, padding: CryptoJS.pad.Pkcs7 })
+  return b64.stringify(utf8.parse(iv).concat(enc.ciphertext))
+}
+
+function aesDecrypt(data: string, key: string): string {
+  const raw = b64.parse(data)
+  if (raw.sigBytes <= 32) {
+    throw new FreegoError(0, 'response data AES decrypt failed')
+  }
+  const iv = CryptoJS.enc.Latin1.stringify(CryptoJS.lib.WordArray.create(raw.words.slice(0, 8), 32))
+  const ciphertext = CryptoJS.lib.WordArray.create(raw.words.slice(8), raw.sigBytes - 32)
+  const dec = CryptoJS.AES.decrypt(CryptoJS.lib.CipherParams.create({ ciphertext }), aesKey(key), { iv: aesIv(iv), mode: CryptoJS.mode.CBC, padding: CryptoJS.pad.Pkcs7 })
+  return utf8.stringify(dec)
+}
+
+const bigMark = '\u0000bigint:'
+
+// 无损解析, 超出安全整数范围的整数解析为bigint
+function parseJson(text: string): any {
+  let out = ''
+  let last = 0
+  let inStr = false
+  for (let i = 0; i < text.length; i++) {
+    const c = text[i]
+    if (inStr) {
+      if (c === '\\') {
+        i++
+      } else if (c === '"') {
+        inStr = false
+      }
+      continue
+    }
+    if (c === '"') {
+      inStr = true
+      continue
+    }
+    if (c === '-' || (c >= '0' && c <= '9')) {
+      let j = i + 1
+      while (j < text.length && '0123456789.eE+-'.indexOf(text[j]) >= 0) {
+        j++
+      }
+      const num = text.substring(i, j)
+      if (/^-?\d+$/.test(num) && !Number.isSafeInteger(Number(num))) {
+        out += text.substring(last, i) + '"\\u0000bigint:' + num + '"'
+        last = j
+      }
+      i = j - 1
+    }
+  }
+  return JSON.parse(out + text.substring(last), (_, v) => (typeof v === 'string' && v.startsWith(bigMark) ? BigInt(v.substring(bigMark.length)) : v))
+}
+
+// bigint按整数原文输出
+function stringifyJson(data: unknown): string {
+  return JSON.stringify(data, (_, v) => (typeof v === 'bigint' ? bigMark + v.toString() : v)).replace(/"\\u0000bigint:(-?\d+)"/g, '$1')
+}
+
+function sign(text: string, key: string): string {
+  return b64.stringify(CryptoJS.HmacSHA256(text, key))
+}
+
+export class Client {
+  private token?: AuthToken
+  private publicKey?: string
+
+  constructor(private config: ClientConfig) {
+    this.publicKey = config.publicKey
+  }
+
+  setToken(token: AuthToken) {
+    this.token = token
+  }
+
+  async getPublicKey(): Promise<string> {
+    if (this.publicKey) {
+      return this.publicKey
+    }
+    const resp = await this.fetch(this.config.keyPath || '/key', { method: 'GET' })
+    const key = await resp.text()
+    if (!resp.ok || !key) {
+      throw new FreegoError(resp.status, 'request public key invalid')
+    }
+    this.publicKey = key
+    return key
+  }
+
+  private async fetch(path: string, init: RequestInit): Promise<Response> {
+    const controller = new AbortController()
+    const timer = setTimeout(() => controller.abort(), this.config.timeout || 30000)
+    try {
+      return await fetch(this.config.domain + path, { ...init, signal: controller.signal })
+    } finally {
+      clearTimeout(timer)
+    }
+  }
+
+  protected async guest<T>(path: string, req: unknown): Promise<T> {
+    const resp = await this.fetch(path, { method: 'POST', headers: { 'Content-Type': 'application/json;charset=UTF-8' }, body: stringifyJson(req) })
+    const text = await resp.text()
+    if (!resp.ok) {
+      throw new FreegoError(resp.status, text)
+    }
+    return parseJson(text) as T
+  }
+
+  // plan 0.Base64 1.AES 2.匿名ECC+AES
+  protected async post<T>(path: string, req: unknown, plan: number): Promise<T> {
+    const headers: Record<string, string> = { 'Content-Type': 'application/json;charset=UTF-8' }
+    let key: string
+    let signKey: string
+    if (plan === 2) {
+      if (!this.config.eccEncrypt) {
+        throw new FreegoError(0, 'eccEncrypt is nil')
+      }
+      signKey = await this.getPublicKey()
+      key = randomHex(32)
+      headers['RandomCode'] = await this.config.eccEncrypt(signKey, key)
+      headers['Authorization'] = ''
+    } else {
+      if (!this.token || !this.token.token || !this.token.secret) {
+        throw new FreegoError(0, "token or secret can't be empty")
+      }
+      key = signKey = this.token.secret
+      headers['Authorization'] = this.token.token
+    }
+    if (this.config.language) {
+      headers['Language'] = this.config.language
+    }
+    const data = stringifyJson(req)
+    const body = {
+      d: plan === 0 ? b64.stringify(utf8.parse(data)) : aesEncrypt(data, key),
+      t: Math.floor(Date.now() / 1000),
+      n: randomHex(16),
+      p: plan,
+      s: '',
+    }
+    body.s = sign(path + body.d + body.n + body.t + body.p, signKey)
+    const resp = await this.fetch(path, { method: 'POST', headers, body: JSON.stringify(body) })
+    const text = await resp.text()
+    let result: { c: number; m: string; d: string; t: number; n: string; p: number; s: string }
+    try {
+      result = JSON.parse(text)
+    } catch (e) {
+      throw new FreegoError(resp.status, text)
+    }
+    if (result.c !== 200) {
+      if (plan === 2 && result.c === 400 && !this.config.publicKey) {
+        this.publicKey = undefined // 服务端公钥可能已更换
+      }
+      throw new FreegoError(result.c || resp.status, result.m)
+    }
+    if (sign(path + result.d + result.n + result.t + result.p, key) !== result.s) {
+      throw new FreegoError(0, 'post response sign verify invalid')
+    }
+    const dec = result.p === 0 ? utf8.stringify(b64.parse(result.d)) : aesDecrypt(result.d, key)
+    return parseJson(dec) as T
+  }
+}
+`
+
+type tsGen struct {
+	names *typeNames
+	defs  []string
+}
+
+func genTs(doc *document) ([]byte, error) {
+	endpoints, err := doc.endpoints()
+	if err != nil {
+		return nil, err
+	}
+	self := &tsGen{names: newTypeNames(doc)}
+	for _, v := range []string{"AuthToken", "ClientConfig", "FreegoError", "Client", "ApiClient"} {
+		self.names.used[v] = true
+	}
+	for _, k := range sortedKeys(doc.Components.Schemas) {
+		if k == "ErrorResp" {
+			continue
+		}
+		self.defs = append(self.defs, self.interfaceDef(exportName(k), doc.Components.Schemas[k]))
+	}
+	var methods []string
+	for _, v := range endpoints {
+		methods = append(methods, self.method(v))
+	}
+	var b strings.Builder
+	b.WriteString("// Code generated by freego gen client. DO NOT EDIT.\n")
+	if len(doc.Info.Title) > 0 {
+		fmt.Fprintf(&b, "// %s %s\n", doc.Info.Title, doc.Info.Version)
+	}
+	b.WriteString(tsRuntime)
+	b.WriteString("\nexport class ApiClient extends Client {\n")
+	b.WriteString(strings.Join(methods, "\n"))
+	b.WriteString("}\n")
+	for _, v := range self.defs {
+		b.WriteString("\n")
+		b.WriteString(v)
+	}
+	return []byte(b.String()), nil
+}
+
+func (self *tsGen) typeOf(s *schema, hint string) string {
+	if s == nil {
+		return "Record<string, any>"
+	}
+	if len(s.Ref) > 0 {
+		return exportName(refName(s.Ref))
+	}
+	if len(s.AllOf) == 1 {
+		return self.typeOf(s.AllOf[0], hint)
+	}
+	switch s.Type {
+	case "boolean":
+		return "boolean"
+	case "integer":
+		if s.Format == "int32" {
+			return "number"
+		}
+		return "number | bigint"
+	case "number":
+		return "number"
+	case "string":
+		return "string"
+	case "array":
+		item := self.typeOf(s.Items, hint+"Item")
+		if strings.ContainsAny(item, "<|") {
+			return "Array<" + item + ">"
+		}
+		return item + "[]"
+	case "object":
+		if len(s.Properties) > 0 {
+			name := self.names.unique(hint)
+			self.defs = append(self.defs, self.interfaceDef(name, s))
+			return name
+		}
+		if s.AdditionalProperties != nil {
+			return "Record<string, " + self.typeOf(s.AdditionalProperties, hint+"Value") + ">"
+		}
+		return "Record<string, any>"
+	}
+	return "any"
+}
+
+func (self *tsGen) interfaceDef(name string, s *schema) string {
+	var b strings.Builder
+	if len(s.Description) > 0 {
+		fmt.Fprintf(&b, "/** %s */\n", oneLine(s.Description))
+	}
+	if len(s.Properties) == 0 {
+		fmt.Fprintf(&b, "export type %s = Record<string, any>\n", name)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "export interface %s {\n", name)
+	for _, k := range sortedKeys(s.Properties) {
+		p := s.Properties[k]
+		if desc := schemaDesc(p); len(desc) > 0 {
+			fmt.Fprintf(&b, "  /** %s */\n", desc)
+		}
+		fmt.Fprintf(&b, "  %s?: %s\n", tsProp(k), self.typeOf(p, name+exportName(k)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (self *tsGen) method(ep endpoint) string {
+	reqType := self.typeOf(ep.Request, ep.Name+"Req")
+	respType := self.typeOf(ep.Response, ep.Name+"Resp")
+	var args, path []string
+	for _, v := range pathSegments(ep.Path) {
+		if strings.HasPrefix(v, "{") {
+			arg := lowerName(exportName(v[1:len(v)-1])) + "Param"
+			args = append(args, arg+": string")
+			path = append(path, "encodeURIComponent("+arg+")")
+		} else {
+			path = append(path, "'"+strings.ReplaceAll(v, "'", "\\'")+"'")
+		}
+	}
+	args = append(args, "req: "+reqType)
+	var call string
+	switch {
+	case ep.Mode.Guest:
+		call = fmt.Sprintf("this.guest<%s>(%s, req)", respType, strings.Join(path, " + "))
+	case ep.Mode.Anonymous:
+		call = fmt.Sprintf("this.post<%s>(%s, req, 2)", respType, strings.Join(path, " + "))
+	default:
+		plan := 0
+		if ep.Mode.AesRequest {
+			plan = 1
+		}
+		call = fmt.Sprintf("this.post<%s>(%s, req, %d)", respType, strings.Join(path, " + "), plan)
+	}
+	var b strings.Builder
+	desc := modeDesc(ep.Mode)
+	if len(ep.Summary) > 0 {
+		desc = oneLine(ep.Summary) + ", " + desc
+	}
+	fmt.Fprintf(&b, "  /** POST %s %s */\n", ep.Path, desc)
+	fmt.Fprintf(&b, "  %s(%s): Promise<%s> {\n    return %s\n  }\n", lowerName(ep.Name), strings.Join(args, ", "), respType, call)
+	return b.String()
+}
+
+// 非标识符属性名加引号
+func tsProp(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return strconv.Quote(name)
+		}
+	}
+	if len(name) == 0 {
+		return `""`
+	}
+	return name
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// freego命令行工具
+// 生成客户端SDK: go run ./cmd/freego gen client --lang go|ts --spec openapi.json --out client.go [--package client]
+// spec为node.ExportOpenAPI/ServeOpenAPI输出的文档(文件路径或http地址), 按路由安全模式(x-freego)生成签名/加密调用代码
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "gen" || os.Args[2] != "client" {
+		usage()
+	}
+	fs := flag.NewFlagSet("gen client", flag.ExitOnError)
+	lang := fs.String("lang", "go", "client language: go|ts")
+	spec := fs.String("spec", "", "openapi document file or url")
+	out := fs.String("out", "", "output file, stdout if empty")
+	pkg := fs.String("package", "client", "go package name")
+	fs.Parse(os.Args[3:])
+	if len(*spec) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	doc, err := loadSpec(*spec)
+	if err != nil {
+		exit(err)
+	}
+	var result []byte
+	switch strings.ToLower(*lang) {
+	case "go":
+		result, err = genGo(doc, *pkg)
+	case "ts":
+		result, err = genTs(doc)
+	default:
+		err = fmt.Errorf("lang [%s] unsupported", *lang)
+	}
+	if err != nil {
+		exit(err)
+	}
+	if len(*out) == 0 {
+		os.Stdout.Write(result)
+		return
+	}
+	if err := os.WriteFile(*out, result, 0644); err != nil {
+		exit(err)
+	}
+	fmt.Println("generate client successful:", *out)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: freego gen client --lang go|ts --spec openapi.json [--out file] [--package name]")
+	os.Exit(2)
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/utils"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// OpenAPI文档解析, 仅解析node.ExportOpenAPI输出的结构, 安全模式下请求/响应数据结构取d字段x-data
+
+type schema struct {
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Ref                  string             `json:"$ref"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	AllOf                []*schema          `json:"allOf"`
+	XData                *schema            `json:"x-data"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type content struct {
+	Content map[string]mediaType `json:"content"`
+}
+
+type parameter struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type routeMode struct {
+	Guest       bool `json:"guest"`
+	Anonymous   bool `json:"anonymous"`
+	AesRequest  bool `json:"aesRequest"`
+	AesResponse bool `json:"aesResponse"`
+}
+
+type operation struct {
+	OperationId string             `json:"operationId"`
+	Summary     string             `json:"summary"`
+	Description string             `json:"description"`
+	Parameters  []parameter        `json:"parameters"`
+	RequestBody *content           `json:"requestBody"`
+	Responses   map[string]content `json:"responses"`
+	XFreego     *routeMode         `json:"x-freego"`
+}
+
+type document struct {
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// 客户端接口, 仅生成POST路由, 非POST路由不使用请求信封
+type endpoint struct {
+	Name     string
+	Path     string
+	Summary  string
+	Params   []string
+	Mode     routeMode
+	Request  *schema
+	Response *schema
+}
+
+func loadSpec(spec string) (*document, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(spec)
+		if err != nil {
+			return nil, utils.Error("fetch openapi document failed: ", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, utils.Error("fetch openapi document failed: status ", resp.StatusCode)
+		}
+		if data, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else if data, err = utils.ReadFile(spec); err != nil {
+		return nil, err
+	}
+	doc := &document{}
+	if err := utils.JsonUnmarshal(data, doc); err != nil {
+		return nil, utils.Error("openapi document unmarshal failed: ", err)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, utils.Error("openapi document paths is nil")
+	}
+	return doc, nil
+}
+
+func (self *document) endpoints() ([]endpoint, error) {
+	paths := make([]string, 0, len(self.Paths))
+	for k := range self.Paths {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	names := map[string]bool{}
+	var result []endpoint
+	for _, path := range paths {
+		op, ok := self.Paths[path]["post"]
+		if !ok {
+			continue
+		}
+		if op.XFreego == nil {
+			return nil, utils.Error("path [", path, "] x-freego is nil, please export document by newer node.ExportOpenAPI")
+		}
+		name := exportName(strings.TrimPrefix(op.OperationId, "post"))
+		if len(name) == 0 {
+			name = "Root"
+		}
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s%d", strings.TrimRight(name, "0123456789"), i)
+		}
+		names[name] = true
+		ep := endpoint{Name: name, Path: path, Summary: op.Summary, Mode: *op.XFreego}
+		for _, v := range op.Parameters {
+			if v.In == "path" {
+				ep.Params = append(ep.Params, v.Name)
+			}
+		}
+		if op.RequestBody != nil {
+			ep.Request = bodySchema(op.RequestBody.Content)
+		}
+		if v, ok := op.Responses["200"]; ok {
+			ep.Response = bodySchema(v.Content)
+		}
+		result = append(result, ep)
+	}
+	return result, nil
+}
+
+// 取application/json数据结构, 请求信封取d字段x-data
+func bodySchema(c map[string]mediaType) *schema {
+	v, ok := c["application/json"]
+	if !ok || v.Schema == nil {
+		return nil
+	}
+	if d, ok := v.Schema.Properties["d"]; ok && d.XData != nil {
+		return d.XData
+	}
+	return v.Schema
+}
+
+// 引用名称 #/components/schemas/User -> User
+func refName(ref string) string {
+	return ref[strings.LastIndexByte(ref, '/')+1:]
+}
+
+// 转换为导出名称, 非字母数字作为分隔符, 如user_detail -> UserDetail
+func exportName(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	if len(name) > 0 && unicode.IsDigit(rune(name[0])) {
+		name = "T" + name
+	}
+	return name
+}
+
+// 首字母小写, 用于ts方法名
+func lowerName(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// 路径分段, {id}为参数
+func pathSegments(path string) []string {
+	var result []string
+	for len(path) > 0 {
+		start := strings.IndexByte(path, '{')
+		if start < 0 {
+			result = append(result, path)
+			break
+		}
+		end := strings.IndexByte(path[start:], '}')
+		if end < 0 {
+			result = append(result, path)
+			break
+		}
+		if start > 0 {
+			result = append(result, path[:start])
+		}
+		result = append(result, path[start:start+end+1])
+		path = path[start+end+1:]
+	}
+	return result
+}
+
+// 类型命名, 内联对象按接口名称生成类型, 与已有类型重名时追加序号
+type typeNames struct {
+	used map[string]bool
+}
+
+func newTypeNames(doc *document) *typeNames {
+	names := &typeNames{used: map[string]bool{}}
+	for k := range doc.Components.Schemas {
+		names.used[exportName(k)] = true
+	}
+	return names
+}
+
+func (self *typeNames) unique(name string) string {
+	result := name
+	for i := 2; self.used[result]; i++ {
+		result = fmt.Sprintf("%s%d", name, i)
+	}
+	self.used[result] = true
+	return result
+}
+
+func sortedKeys(m map[string]*schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
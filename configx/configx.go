@@ -0,0 +1,230 @@
+package configx
+
+import (
+	"bytes"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+)
+
+const (
+	SOURCE_FILE   = "file"
+	SOURCE_CONSUL = "consul"
+	SOURCE_ETCD   = "etcd"
+	SOURCE_NACOS  = "nacos"
+
+	defaultTimeout  = 5000 // 配置中心默认连接超时/毫秒
+	defaultInterval = 10   // 文件默认检查间隔/秒
+)
+
+// Source 配置源, key为文件路径/consul KV键/etcd键/nacos dataId
+type Source interface {
+	// Get 读取配置内容, 不存在时返回nil
+	Get(key string) ([]byte, error)
+	// Watch 监听配置变化, 变化时回调最新内容(删除时为nil), 返回停止监听函数
+	Watch(key string, change func(data []byte)) (func(), error)
+	// Close 关闭配置源连接
+	Close() error
+}
+
+// Config 配置中心参数, Type选择file/consul/etcd/nacos
+type Config struct {
+	Type      string   // 配置源类型, file/consul/etcd/nacos, 默认file
+	Hosts     []string // 配置中心地址, host:port
+	Username  string   // 认证用户名
+	Password  string   // 认证密码
+	Token     string   // consul ACL token
+	Namespace string   // consul/etcd键前缀, nacos命名空间
+	Group     string   // nacos配置分组, 默认DEFAULT_GROUP
+	Timeout   int      // 连接超时/毫秒, 默认5000
+	Interval  int      // 文件检查间隔/秒, 默认10
+}
+
+type watcher struct {
+	mu        sync.Mutex
+	data      []byte
+	version   int64 // 内容变更次数, 用于锁外回调后检查是否错过新内容
+	callbacks []func(data []byte) error
+	stop      func()
+}
+
+var (
+	mu       sync.Mutex
+	source   Source
+	watchers = make(map[string]*watcher)
+)
+
+// InitConfig 初始化配置中心, 重复初始化时关闭原配置源及全部监听
+func InitConfig(config Config) error {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+	var s Source
+	var err error
+	switch config.Type {
+	case "", SOURCE_FILE:
+		s = newFileSource(config)
+	case SOURCE_CONSUL:
+		s, err = newConsulSource(config)
+	case SOURCE_ETCD:
+		s, err = newEtcdSource(config)
+	case SOURCE_NACOS:
+		s, err = newNacosSource(config)
+	default:
+		return utils.Error("config source type [", config.Type, "] invalid")
+	}
+	if err != nil {
+		return err
+	}
+	if err := Close(); err != nil {
+		zlog.Error("config source close failed", 0, zlog.AddError(err))
+	}
+	mu.Lock()
+	source = s
+	mu.Unlock()
+	zlog.Printf("config source [%s] init successful", config.Type)
+	return nil
+}
+
+func getSource() (Source, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if source == nil {
+		return nil, utils.Error("config source not initialized")
+	}
+	return source, nil
+}
+
+// Get 读取JSON配置并解析至result
+func Get(key string, result interface{}) error {
+	s, err := getSource()
+	if err != nil {
+		return err
+	}
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return utils.Error("config [", key, "] not found")
+	}
+	return utils.JsonUnmarshal(data, result)
+}
+
+// OnChange 注册配置变更回调, 注册时以当前内容立即回调一次, 之后内容变化时按注册顺序回调
+// 回调返回错误时记录日志, 不影响其他回调, 应由回调自行保留原配置; 回调在锁外执行, 可在回调内注册其他监听
+func OnChange(key string, callback func(data []byte) error) error {
+	if callback == nil {
+		panic("config callback is nil")
+	}
+	s, err := getSource()
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	w, ok := watchers[key]
+	if !ok {
+		w = &watcher{}
+		watchers[key] = w
+	}
+	mu.Unlock()
+	w.mu.Lock()
+	if !ok {
+		data, err := s.Get(key)
+		if err != nil {
+			w.mu.Unlock()
+			mu.Lock()
+			delete(watchers, key)
+			mu.Unlock()
+			return err
+		}
+		w.data = data
+		if w.stop, err = s.Watch(key, func(data []byte) { w.change(key, data) }); err != nil {
+			w.mu.Unlock()
+			mu.Lock()
+			delete(watchers, key)
+			mu.Unlock()
+			return err
+		}
+	}
+	w.callbacks = append(w.callbacks, callback)
+	data, version := w.data, w.version
+	w.mu.Unlock()
+	for {
+		if len(data) > 0 {
+			invoke(key, callback, data)
+		}
+		// 首次回调期间内容已变化时补发最新内容, 保证回调最终持有最新配置
+		w.mu.Lock()
+		if w.version == version {
+			w.mu.Unlock()
+			return nil
+		}
+		data, version = w.data, w.version
+		w.mu.Unlock()
+	}
+}
+
+// Bind 注册JSON配置变更回调, 内容解析为T后回调apply, 配置被删除或解析失败时不回调, 保留原配置
+func Bind[T any](key string, apply func(value *T) error) error {
+	return OnChange(key, func(data []byte) error {
+		if len(data) == 0 {
+			return nil
+		}
+		value := new(T)
+		if err := utils.JsonUnmarshal(data, value); err != nil {
+			return err
+		}
+		return apply(value)
+	})
+}
+
+// 内容变化时在锁外按注册顺序回调, 避免回调阻塞或重入时死锁
+func (self *watcher) change(key string, data []byte) {
+	self.mu.Lock()
+	if bytes.Equal(self.data, data) {
+		self.mu.Unlock()
+		return
+	}
+	self.data = data
+	self.version++
+	callbacks := self.callbacks
+	self.mu.Unlock()
+	zlog.Info("config changed", 0, zlog.String("key", key), zlog.Int("size", len(data)))
+	for _, callback := range callbacks {
+		invoke(key, callback, data)
+	}
+}
+
+// 回调异常不影响配置监听
+func invoke(key string, callback func(data []byte) error, data []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Error("config callback panic", 0, zlog.String("key", key), zlog.Any("error", r))
+		}
+	}()
+	if err := callback(data); err != nil {
+		zlog.Error("config callback failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+}
+
+// Close 停止全部监听并关闭配置源
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	for k, v := range watchers {
+		if v.stop != nil {
+			v.stop()
+		}
+		delete(watchers, k)
+	}
+	if source == nil {
+		return nil
+	}
+	err := source.Close()
+	source = nil
+	return err
+}
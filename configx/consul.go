@@ -0,0 +1,93 @@
+package configx
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	consulapi "github.com/hashicorp/consul/api"
+	"strings"
+	"time"
+)
+
+const consulWaitTime = 5 * time.Minute
+
+// ConsulSource 基于consul KV的配置源, 通过阻塞查询监听变化
+type ConsulSource struct {
+	client *consulapi.Client
+	prefix string
+}
+
+func newConsulSource(config Config) (*ConsulSource, error) {
+	if len(config.Hosts) == 0 {
+		return nil, utils.Error("consul config hosts is nil")
+	}
+	client, err := consulapi.NewClient(&consulapi.Config{
+		Address:  config.Hosts[0],
+		Token:    config.Token,
+		WaitTime: time.Duration(config.Timeout) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulSource{client: client, prefix: strings.Trim(config.Namespace, "/")}, nil
+}
+
+func (self *ConsulSource) key(key string) string {
+	if len(self.prefix) == 0 {
+		return key
+	}
+	return utils.AddStr(self.prefix, "/", key)
+}
+
+func (self *ConsulSource) Get(key string) ([]byte, error) {
+	pair, _, err := self.client.KV().Get(self.key(key), nil)
+	if err != nil || pair == nil {
+		return nil, err
+	}
+	return pair.Value, nil
+}
+
+func (self *ConsulSource) Watch(key string, change func(data []byte)) (func(), error) {
+	_, meta, err := self.client.KV().Get(self.key(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	index := meta.LastIndex
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pair, meta, err := self.client.KV().Get(self.key(key), &consulapi.QueryOptions{WaitIndex: index, WaitTime: consulWaitTime})
+			if err != nil {
+				zlog.Error("consul config watch failed", 0, zlog.String("key", key), zlog.AddError(err))
+				select {
+				case <-stop:
+					return
+				case <-time.After(5 * time.Second):
+				}
+				continue
+			}
+			if meta.LastIndex < index { // 索引回退时重置, 参考consul阻塞查询说明
+				index = 0
+				continue
+			}
+			if meta.LastIndex == index {
+				continue
+			}
+			index = meta.LastIndex
+			if pair == nil {
+				change(nil)
+			} else {
+				change(pair.Value)
+			}
+		}
+	}()
+	return func() { close(stop) }, nil
+}
+
+func (self *ConsulSource) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package configx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
+	"time"
+)
+
+// EtcdSource 基于etcd v3的配置源, 通过Watch监听变化
+type EtcdSource struct {
+	client  *clientv3.Client
+	prefix  string
+	timeout time.Duration
+}
+
+func newEtcdSource(config Config) (*EtcdSource, error) {
+	timeout := time.Duration(config.Timeout) * time.Millisecond
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   config.Hosts,
+		Username:    config.Username,
+		Password:    config.Password,
+		DialTimeout: timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdSource{client: client, prefix: strings.TrimSuffix(config.Namespace, "/"), timeout: timeout}, nil
+}
+
+func (self *EtcdSource) key(key string) string {
+	if len(self.prefix) == 0 {
+		return key
+	}
+	return utils.AddStr(self.prefix, "/", strings.TrimPrefix(key, "/"))
+}
+
+func (self *EtcdSource) Get(key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	resp, err := self.client.Get(ctx, self.key(key))
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, err
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+func (self *EtcdSource) Watch(key string, change func(data []byte)) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for resp := range self.client.Watch(ctx, self.key(key)) {
+			for _, event := range resp.Events {
+				if event.Type == clientv3.EventTypeDelete {
+					change(nil)
+				} else {
+					change(event.Kv.Value)
+				}
+			}
+		}
+	}()
+	return cancel, nil
+}
+
+func (self *EtcdSource) Close() error {
+	return self.client.Close()
+}
@@ -0,0 +1,66 @@
+package configx
+
+import (
+	"github.com/godaddy-x/freego/zlog"
+	"os"
+	"time"
+)
+
+// FileSource 本地文件配置源, 按间隔检查文件修改时间, 兼容ReadLocalJsonConfig的静态配置文件
+type FileSource struct {
+	interval time.Duration
+}
+
+func newFileSource(config Config) *FileSource {
+	return &FileSource{interval: time.Duration(config.Interval) * time.Second}
+}
+
+func (self *FileSource) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(key)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (self *FileSource) Watch(key string, change func(data []byte)) (func(), error) {
+	var modTime time.Time
+	if info, err := os.Stat(key); err == nil {
+		modTime = info.ModTime()
+	}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(self.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(key)
+			if os.IsNotExist(err) {
+				if !modTime.IsZero() {
+					modTime = time.Time{}
+					change(nil)
+				}
+				continue
+			}
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			data, err := self.Get(key)
+			if err != nil {
+				zlog.Error("config file read failed", 0, zlog.String("file", key), zlog.AddError(err))
+				continue
+			}
+			modTime = info.ModTime()
+			change(data)
+		}
+	}()
+	return func() { close(stop) }, nil
+}
+
+func (self *FileSource) Close() error {
+	return nil
+}
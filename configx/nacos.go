@@ -0,0 +1,83 @@
+package configx
+
+import (
+	"github.com/nacos-group/nacos-sdk-go/v2/clients"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/config_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+	"net"
+	"strconv"
+)
+
+const defaultNacosGroup = "DEFAULT_GROUP"
+
+// NacosSource 基于nacos配置管理的配置源, key为dataId, 由nacos长轮询推送变化
+type NacosSource struct {
+	client config_client.IConfigClient
+	group  string
+}
+
+func newNacosSource(config Config) (*NacosSource, error) {
+	serverConfigs := make([]constant.ServerConfig, 0, len(config.Hosts))
+	for _, host := range config.Hosts {
+		ip, port, err := net.SplitHostPort(host)
+		if err != nil {
+			return nil, err
+		}
+		p, err := strconv.ParseUint(port, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		serverConfigs = append(serverConfigs, constant.ServerConfig{IpAddr: ip, Port: p})
+	}
+	clientConfig := constant.ClientConfig{
+		NamespaceId:         config.Namespace,
+		TimeoutMs:           uint64(config.Timeout),
+		Username:            config.Username,
+		Password:            config.Password,
+		NotLoadCacheAtStart: true,
+		LogLevel:            "warn",
+	}
+	client, err := clients.NewConfigClient(vo.NacosClientParam{ClientConfig: &clientConfig, ServerConfigs: serverConfigs})
+	if err != nil {
+		return nil, err
+	}
+	group := config.Group
+	if len(group) == 0 {
+		group = defaultNacosGroup
+	}
+	return &NacosSource{client: client, group: group}, nil
+}
+
+func (self *NacosSource) Get(key string) ([]byte, error) {
+	data, err := self.client.GetConfig(vo.ConfigParam{DataId: key, Group: self.group})
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+func (self *NacosSource) Watch(key string, change func(data []byte)) (func(), error) {
+	param := vo.ConfigParam{
+		DataId: key,
+		Group:  self.group,
+		OnChange: func(namespace, group, dataId, data string) {
+			if len(data) == 0 {
+				change(nil)
+			} else {
+				change([]byte(data))
+			}
+		},
+	}
+	if err := self.client.ListenConfig(param); err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = self.client.CancelListenConfig(vo.ConfigParam{DataId: key, Group: self.group})
+	}, nil
+}
+
+func (self *NacosSource) Close() error {
+	self.client.CloseClient()
+	return nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/godaddy-x/freego/job"
+	"github.com/godaddy-x/freego/jobs"
+	"github.com/godaddy-x/freego/testx"
 	"github.com/godaddy-x/freego/utils"
 	"testing"
+	"time"
 )
 
 func TestJobTask(t *testing.T) {
@@ -22,3 +26,32 @@ func TestJobTask(t *testing.T) {
 	}
 	job.Run(task1, task2)
 }
+
+func TestJobsScheduler(t *testing.T) {
+	testx.Redis(t)
+	elector, err := jobs.NewRedisElector(15000)
+	if err != nil {
+		panic(err)
+	}
+	scheduler, err := jobs.NewScheduler(jobs.Config{Name: "test", Elector: elector})
+	if err != nil {
+		panic(err)
+	}
+	if err := scheduler.Add(jobs.Task{
+		Name:    "test.report",
+		Spec:    "*/2 * * * * *",
+		Timeout: 3000,
+		Func: func(ctx context.Context) error {
+			fence, _ := jobs.FencingToken(ctx) // 写入外部存储时携带, 拒绝旧主节点的写入
+			fmt.Println("jobs report: ", utils.UnixMilli(), fence)
+			time.Sleep(2500 * time.Millisecond) // 超过调度间隔, 下次执行被跳过
+			return nil
+		},
+	}); err != nil {
+		panic(err)
+	}
+	scheduler.Start()
+	time.Sleep(10 * time.Second)
+	fmt.Println(scheduler.Status())
+	fmt.Println(jobs.Close(context.Background()))
+}
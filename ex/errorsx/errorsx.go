@@ -0,0 +1,302 @@
+package errorsx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const domain = "freego"
+
+// Error 业务错误, 统一在gRPC status details与HTTP响应体中传递code/message/metadata
+type Error struct {
+	Code     int
+	Msg      string
+	Arg      []string // 多语言消息参数, 替换消息中的$1、$2
+	Metadata map[string]string
+	Err      error
+	stack    []uintptr
+	origin   *Error // 派生副本的原始错误, 用于errors.Is匹配哨兵错误
+}
+
+type mapping struct {
+	grpcCode   codes.Code
+	httpStatus int
+}
+
+var (
+	stackable int32 // 1.创建错误时记录调用栈
+	mu        sync.RWMutex
+	mappings  = map[int]mapping{
+		ex.BIZ:     {grpcCode: codes.FailedPrecondition, httpStatus: http.StatusBadRequest},
+		ex.GRPC:    {grpcCode: codes.Unavailable, httpStatus: http.StatusBadGateway},
+		ex.JSON:    {grpcCode: codes.InvalidArgument, httpStatus: http.StatusBadRequest},
+		ex.NUMBER:  {grpcCode: codes.InvalidArgument, httpStatus: http.StatusBadRequest},
+		ex.DATA:    {grpcCode: codes.Internal, httpStatus: http.StatusInternalServerError},
+		ex.CACHE:   {grpcCode: codes.Internal, httpStatus: http.StatusInternalServerError},
+		ex.SYSTEM:  {grpcCode: codes.Internal, httpStatus: http.StatusInternalServerError},
+		ex.UNKNOWN: {grpcCode: codes.Unknown, httpStatus: http.StatusInternalServerError},
+		ex.MQ:      {grpcCode: codes.Unavailable, httpStatus: http.StatusServiceUnavailable},
+	}
+)
+
+// New 创建业务错误, 可作为哨兵错误, errors.Is按实例匹配, 不同实例即使code相同也不相等
+func New(code int, msg string) *Error {
+	return &Error{Code: code, Msg: msg, stack: callers()}
+}
+
+// Wrap 以业务code/msg包装原始错误, errors.Is/As可穿透到原始错误
+func Wrap(err error, code int, msg string) *Error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Msg: msg, Err: err, stack: callers()}
+}
+
+// EnableStack 开启/关闭创建错误时的调用栈记录
+func EnableStack(enable bool) {
+	if enable {
+		atomic.StoreInt32(&stackable, 1)
+	} else {
+		atomic.StoreInt32(&stackable, 0)
+	}
+}
+
+func callers() []uintptr {
+	if atomic.LoadInt32(&stackable) == 0 {
+		return nil
+	}
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+// Is errors.Is调用, 同为*Error时按实例或其派生副本匹配
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As errors.As调用
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// Code 获取错误链中首个业务错误的code, 不存在时返回0
+func Code(err error) int {
+	var target *Error
+	if errors.As(err, &target) {
+		return target.Code
+	}
+	return 0
+}
+
+// Register 注册业务code到gRPC code与HTTP状态码的映射
+func Register(code int, grpcCode codes.Code, httpStatus int) {
+	mu.Lock()
+	defer mu.Unlock()
+	mappings[code] = mapping{grpcCode: grpcCode, httpStatus: httpStatus}
+}
+
+// GRPCCode 业务code对应的gRPC code, 未注册时按HTTP状态码区间推断
+func GRPCCode(code int) codes.Code {
+	mu.RLock()
+	m, b := mappings[code]
+	mu.RUnlock()
+	if b {
+		return m.grpcCode
+	}
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	}
+	if code >= 500 && code <= 600 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// HTTPStatus 业务code对应的HTTP状态码, 未注册时code<=600直接作为状态码
+func HTTPStatus(code int) int {
+	mu.RLock()
+	m, b := mappings[code]
+	mu.RUnlock()
+	if b {
+		return m.httpStatus
+	}
+	if code >= 100 && code <= 600 {
+		return code
+	}
+	return http.StatusInternalServerError
+}
+
+// WithMetadata 返回附加错误元数据的副本, 不修改哨兵错误
+func (self *Error) WithMetadata(key, value string) *Error {
+	c := self.clone()
+	c.Metadata[key] = value
+	return c
+}
+
+// WithArgs 返回附加多语言消息参数的副本
+func (self *Error) WithArgs(args ...string) *Error {
+	c := self.clone()
+	c.Arg = append(c.Arg, args...)
+	return c
+}
+
+// Wrap 返回附加原始错误的副本, 原始错误仅用于日志输出, 不对外传递
+func (self *Error) Wrap(err error) *Error {
+	c := self.clone()
+	c.Err = err
+	return c
+}
+
+// 复制错误及元数据/参数, 副本保留原始错误用于errors.Is匹配
+func (self *Error) clone() *Error {
+	c := *self
+	c.Metadata = make(map[string]string, len(self.Metadata)+1)
+	for k, v := range self.Metadata {
+		c.Metadata[k] = v
+	}
+	c.Arg = append([]string(nil), self.Arg...)
+	if self.origin == nil {
+		c.origin = self
+	}
+	return &c
+}
+
+// Error 输出格式与ex.Throw一致, 保证ex.Catch可正常解析
+func (self *Error) Error() string {
+	return self.Throw().Error()
+}
+
+func (self *Error) Unwrap() error {
+	return self.Err
+}
+
+func (self *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return self == t || (self.origin != nil && self.origin == t)
+}
+
+// Stack 调用栈, 未开启EnableStack时为空
+func (self *Error) Stack() string {
+	if len(self.stack) == 0 {
+		return ""
+	}
+	buf := strings.Builder{}
+	frames := runtime.CallersFrames(self.stack)
+	for {
+		frame, more := frames.Next()
+		buf.WriteString(fmt.Sprintf("%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
+// Format %+v输出原始错误与调用栈, zlog.AddError记录为errorVerbose
+func (self *Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			_, _ = io.WriteString(s, self.Error())
+			if self.Err != nil {
+				_, _ = fmt.Fprintf(s, "\ncaused by: %+v", self.Err)
+			}
+			if stack := self.Stack(); len(stack) > 0 {
+				_, _ = io.WriteString(s, "\n")
+				_, _ = io.WriteString(s, stack)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		_, _ = io.WriteString(s, self.Error())
+	case 'q':
+		_, _ = fmt.Fprintf(s, "%q", self.Error())
+	}
+}
+
+// Throw 转换为ex.Throw
+func (self *Error) Throw() ex.Throw {
+	code := self.Code
+	if code == 0 {
+		code = ex.BIZ
+	}
+	return ex.Throw{Code: code, Msg: self.Msg, Err: self.Err, Arg: self.Arg}
+}
+
+// GRPCStatus 转换为gRPC status, code/metadata写入ErrorInfo details
+func (self *Error) GRPCStatus() *status.Status {
+	st := status.New(GRPCCode(self.Code), self.Msg)
+	info := &errdetails.ErrorInfo{
+		Reason:   utils.AnyToStr(self.Code),
+		Domain:   domain,
+		Metadata: self.Metadata,
+	}
+	if detail, err := st.WithDetails(info); err == nil {
+		return detail
+	}
+	return st
+}
+
+// FromStatus 从gRPC status解析业务错误, 不含ErrorInfo details时返回nil
+func FromStatus(st *status.Status) *Error {
+	if st == nil {
+		return nil
+	}
+	for _, v := range st.Details() {
+		info, ok := v.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != domain {
+			continue
+		}
+		code, err := utils.StrToInt(info.Reason)
+		if err != nil {
+			return nil
+		}
+		return &Error{Code: code, Msg: st.Message(), Metadata: info.Metadata}
+	}
+	return nil
+}
+
+// FromError 转换任意错误为业务错误
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var target *Error
+	if errors.As(err, &target) {
+		return target
+	}
+	if st, ok := status.FromError(err); ok {
+		if target = FromStatus(st); target != nil {
+			return target
+		}
+	}
+	throw := ex.Catch(err)
+	return &Error{Code: throw.Code, Msg: throw.Msg, Arg: throw.Arg, Err: err}
+}
@@ -1,6 +1,7 @@
 package ex
 
 import (
+	"errors"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/zlog"
 	"strings"
@@ -73,39 +74,54 @@ func (self Throw) Error() string {
 	return errMsg
 }
 
+// Unwrap 返回原始错误, 支持errors.Is/As
+func (self Throw) Unwrap() error {
+	return self.Err
+}
+
 func Catch(err error) Throw {
 	if throw, ok := err.(Throw); ok {
 		return throw
 	}
+	if throw, ok := parse(err.Error()); ok {
+		return throw
+	}
+	var throw Throw
+	if errors.As(err, &throw) { // 被fmt.Errorf等包装的Throw
+		return throw
+	}
 	spl := strings.Split(err.Error(), sep)
 	if len(spl) == 1 {
 		return Throw{Code: UNKNOWN, Msg: spl[0]}
-	} else if len(spl) == 2 {
-		if c, err := utils.StrToInt(spl[0]); err != nil {
-			return Throw{Code: SYSTEM, Msg: err.Error()}
-		} else {
-			return Throw{Code: c, Msg: spl[1]}
-		}
-	} else if len(spl) == 3 {
-		if c, err := utils.StrToInt(spl[0]); err != nil {
-			return Throw{Code: SYSTEM, Msg: err.Error()}
-		} else {
-			return Throw{Code: c, Msg: spl[1], Url: spl[2]}
-		}
-	} else if len(spl) == 4 {
-		if c, err := utils.StrToInt(spl[0]); err != nil {
-			return Throw{Code: SYSTEM, Msg: err.Error()}
-		} else {
-			var args []string
-			if err := utils.JsonUnmarshal(utils.Str2Bytes(spl[3]), &args); err != nil {
-				zlog.Error("exception args unmarshal failed", 0, zlog.AddError(err))
-			}
-			return Throw{Code: c, Msg: spl[1], Url: spl[2], Arg: args}
-		}
+	}
+	if _, e := utils.StrToInt(spl[0]); e != nil {
+		return Throw{Code: SYSTEM, Msg: e.Error()}
 	}
 	return Throw{Code: UNKNOWN, Msg: "failed to catch exception", Err: err}
 }
 
+// 解析Throw.Error()格式的错误信息
+func parse(msg string) (Throw, bool) {
+	spl := strings.Split(msg, sep)
+	if len(spl) < 2 || len(spl) > 4 {
+		return Throw{}, false
+	}
+	c, err := utils.StrToInt(spl[0])
+	if err != nil {
+		return Throw{}, false
+	}
+	throw := Throw{Code: c, Msg: spl[1]}
+	if len(spl) > 2 {
+		throw.Url = spl[2]
+	}
+	if len(spl) == 4 {
+		if err := utils.JsonUnmarshal(utils.Str2Bytes(spl[3]), &throw.Arg); err != nil {
+			zlog.Error("exception args unmarshal failed", 0, zlog.AddError(err))
+		}
+	}
+	return throw, true
+}
+
 func OutError(title string, err error) {
 	throw, ok := err.(Throw)
 	if ok {
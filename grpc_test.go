@@ -31,6 +31,34 @@ func TestConsulxRunGRPCServer(t *testing.T) {
 	rpcx.RunServer("", false, objects...)
 }
 
+func TestRegistryRunGRPCServer(t *testing.T) {
+	initRegistry()
+	objects := []*rpcx.GRPC{
+		{
+			Address: "localhost",
+			Service: "PubWorker",
+			Tags:    []string{"ID Generator"},
+			AddRPC:  func(server *grpc.Server) { pb.RegisterPubWorkerServer(server, &impl.PubWorker{}) },
+		},
+	}
+	rpcx.RunServer("", false, objects...)
+}
+
+func TestRegistryCallGRPC_GenID(t *testing.T) {
+	initRegistry()
+	rpcx.RunClient()
+	conn, err := rpcx.NewClientConn(rpcx.GRPC{Service: "PubWorker", Cache: 30})
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	res, err := pb.NewPubWorkerClient(conn.Value()).GenerateId(conn.Context(), &pb.GenerateIdReq{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("call rpc:", res)
+}
+
 func TestConsulxRunGRPCOnlyServer(t *testing.T) {
 	objects := []*rpcx.GRPC{
 		{
@@ -0,0 +1,219 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"github.com/godaddy-x/freego/ex/errorsx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/valyala/fasthttp"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Option 客户端配置项
+type Option func(client *Client)
+
+// Client HTTP客户端, 支持连接池、路径级超时、熔断及重试
+type Client struct {
+	client   *fasthttp.Client
+	timeout  time.Duration
+	timeouts map[string]time.Duration
+	retry    *utils.RetryPolicy
+	breaker  *utils.BreakerConfig
+	breakers sync.Map // host+path -> *utils.CircuitBreaker
+}
+
+// WithTimeout 设置默认请求超时, 默认30s
+func WithTimeout(timeout time.Duration) Option {
+	return func(client *Client) {
+		if timeout <= 0 {
+			panic("http client timeout invalid")
+		}
+		client.timeout = timeout
+	}
+}
+
+// WithPathTimeout 设置路径级超时, 覆盖默认超时, key为请求path, 例: /api/getUser
+func WithPathTimeout(timeouts map[string]time.Duration) Option {
+	return func(client *Client) {
+		for path, timeout := range timeouts {
+			if len(path) == 0 || timeout <= 0 {
+				panic("http client path timeout invalid")
+			}
+			client.timeouts[path] = timeout
+		}
+	}
+}
+
+// WithRetry 设置重试策略, Retryable为空时仅重试网络错误及502/503/504, 仅应对幂等请求启用
+func WithRetry(policy utils.RetryPolicy) Option {
+	return func(client *Client) {
+		if policy.Retryable == nil {
+			policy.Retryable = isRetryable
+		}
+		client.retry = &policy
+	}
+}
+
+// WithBreaker 设置熔断配置, 按host+path独立统计, 网络错误及5xx响应计入失败
+func WithBreaker(config utils.BreakerConfig) Option {
+	return func(client *Client) {
+		if config.IsFailure == nil {
+			config.IsFailure = isFailure
+		}
+		client.breaker = &config
+	}
+}
+
+// WithMaxConns 设置单host最大连接数
+func WithMaxConns(maxConns int) Option {
+	return func(client *Client) {
+		client.client.MaxConnsPerHost = maxConns
+	}
+}
+
+// New 创建HTTP客户端, 客户端并发安全, 应复用
+func New(options ...Option) *Client {
+	client := &Client{
+		client:   &fasthttp.Client{MaxConnsPerHost: 512, MaxIdleConnDuration: 60 * time.Second},
+		timeout:  defaultTimeout,
+		timeouts: make(map[string]time.Duration),
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// Do 执行请求, 网络错误及5xx响应返回错误, resp在重试时复用
+func (self *Client) Do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if self.retry == nil {
+		return self.do(ctx, req, resp)
+	}
+	return utils.Retry(ctx, *self.retry, func(ctx context.Context) error {
+		return self.do(ctx, req, resp)
+	})
+}
+
+// DoOnce 执行非幂等请求, 仅在请求未发出(建立连接失败)时按重试策略重发原请求, 已签名请求不重新生成nonce
+func (self *Client) DoOnce(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if self.retry == nil {
+		return self.do(ctx, req, resp)
+	}
+	policy := *self.retry
+	policy.Retryable = IsConnError
+	return utils.Retry(ctx, policy, func(ctx context.Context) error {
+		return self.do(ctx, req, resp)
+	})
+}
+
+func (self *Client) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	path := utils.Bytes2Str(req.URI().Path())
+	if self.breaker == nil {
+		return self.call(ctx, path, req, resp)
+	}
+	name := utils.AddStr(utils.Bytes2Str(req.URI().Host()), path)
+	v, ok := self.breakers.Load(name)
+	if !ok {
+		v, _ = self.breakers.LoadOrStore(name, utils.NewCircuitBreaker(name, *self.breaker))
+	}
+	done, err := v.(*utils.CircuitBreaker).Allow()
+	if err != nil {
+		return errorsx.Wrap(err, http.StatusServiceUnavailable, utils.AddStr("the request [", name, "] circuit breaker is open"))
+	}
+	err = self.call(ctx, path, req, resp)
+	done(err)
+	return err
+}
+
+func (self *Client) call(ctx context.Context, path string, req *fasthttp.Request, resp *fasthttp.Response) error {
+	timeout := self.timeout
+	if v, ok := self.timeouts[path]; ok {
+		timeout = v
+	}
+	deadline := time.Now().Add(timeout)
+	if v, ok := ctx.Deadline(); ok && v.Before(deadline) {
+		deadline = v
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := self.client.DoDeadline(req, resp, deadline); err != nil {
+		return errorsx.Wrap(err, http.StatusBadGateway, utils.AddStr("request [", path, "] failed: ", err.Error()))
+	}
+	if code := resp.StatusCode(); code >= http.StatusInternalServerError {
+		return errorsx.New(code, utils.AddStr("request [", path, "] response status: ", code))
+	}
+	return nil
+}
+
+// Get 发送GET请求, 返回响应内容
+func (self *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.Header.SetMethod("GET")
+	req.SetRequestURI(url)
+	if err := self.Do(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// PostJson 发送JSON请求, result不为空时解析响应内容
+func (self *Client) PostJson(ctx context.Context, url string, body, result interface{}) error {
+	data, err := utils.JsonMarshal(body)
+	if err != nil {
+		return err
+	}
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json;charset=UTF-8")
+	req.SetRequestURI(url)
+	req.SetBody(data)
+	if err := self.Do(ctx, req, resp); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return utils.JsonUnmarshal(resp.Body(), result)
+}
+
+func isRetryable(err error) bool {
+	switch errorsx.Code(err) {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return !errors.Is(err, utils.ErrBreakerOpen)
+	}
+	return false
+}
+
+// IsConnError 是否为请求发出前的连接错误(建立连接失败/超时或无可用连接), 此时服务端未收到请求
+func IsConnError(err error) bool {
+	if errors.Is(err, utils.ErrBreakerOpen) {
+		return false
+	}
+	if errors.Is(err, fasthttp.ErrDialTimeout) || errors.Is(err, fasthttp.ErrNoFreeConns) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isFailure(err error) bool {
+	return errorsx.Code(err) >= http.StatusInternalServerError
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	consulapi "github.com/hashicorp/consul/api"
+	"sync"
+	"time"
+)
+
+const consulLeaderKey = "jobs/leader/"
+
+// ConsulElector 基于consul会话锁选主, 会话失效时持有的任务键自动删除
+// fencing token取获得主节点时任务键的ModifyIndex, raft索引全局递增, 续约期间不变
+type ConsulElector struct {
+	mu      sync.Mutex
+	client  *consulapi.Client
+	ttl     time.Duration
+	token   string
+	session string
+	renewed time.Time
+	fences  map[string]int64 // 任务 -> 当前会话持有的fencing token
+}
+
+// NewConsulElector 创建consul选主, ttl为会话租约时间/毫秒, 默认15000, consul最小10秒
+func NewConsulElector(client *consulapi.Client, ttl int64) (*ConsulElector, error) {
+	if client == nil {
+		return nil, utils.Error("consul client is nil")
+	}
+	if ttl < 10000 {
+		ttl = 15000
+	}
+	return &ConsulElector{client: client, ttl: time.Duration(ttl) * time.Millisecond, token: instanceId(), fences: make(map[string]int64)}, nil
+}
+
+func (self *ConsulElector) Campaign(ctx context.Context, name string) (int64, error) {
+	session, err := self.getSession(ctx)
+	if err != nil {
+		return 0, err
+	}
+	key := utils.AddStr(consulLeaderKey, name)
+	pair := &consulapi.KVPair{Key: key, Value: utils.Str2Bytes(self.token), Session: session}
+	ok, _, err := self.client.KV().Acquire(pair, (&consulapi.WriteOptions{}).WithContext(ctx))
+	if err != nil || !ok {
+		self.setFence(name, 0)
+		return 0, err
+	}
+	self.mu.Lock()
+	fence := self.fences[name]
+	self.mu.Unlock()
+	if fence > 0 {
+		return fence, nil
+	}
+	if pair, _, err = self.client.KV().Get(key, (&consulapi.QueryOptions{}).WithContext(ctx)); err != nil {
+		return 0, err
+	}
+	if pair == nil || pair.Session != session {
+		return 0, nil
+	}
+	fence = int64(pair.ModifyIndex)
+	self.setFence(name, fence)
+	return fence, nil
+}
+
+func (self *ConsulElector) setFence(name string, fence int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if fence > 0 {
+		self.fences[name] = fence
+	} else {
+		delete(self.fences, name)
+	}
+}
+
+func (self *ConsulElector) Resign(name string) error {
+	self.mu.Lock()
+	session := self.session
+	self.mu.Unlock()
+	if len(session) == 0 {
+		return nil
+	}
+	self.setFence(name, 0)
+	_, _, err := self.client.KV().Release(&consulapi.KVPair{Key: utils.AddStr(consulLeaderKey, name), Session: session}, nil)
+	return err
+}
+
+// Close 销毁会话, 释放全部任务键
+func (self *ConsulElector) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if len(self.session) == 0 {
+		return nil
+	}
+	_, err := self.client.Session().Destroy(self.session, nil)
+	self.session = ""
+	self.fences = make(map[string]int64)
+	return err
+}
+
+// 获取会话, 超过租约1/3时续约, 会话失效时重新创建
+func (self *ConsulElector) getSession(ctx context.Context) (string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if len(self.session) > 0 {
+		if time.Since(self.renewed) < self.ttl/3 {
+			return self.session, nil
+		}
+		entry, _, err := self.client.Session().Renew(self.session, (&consulapi.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+		if entry != nil {
+			self.renewed = time.Now()
+			return self.session, nil
+		}
+		self.session = ""
+	}
+	id, _, err := self.client.Session().Create(&consulapi.SessionEntry{
+		Name:     utils.AddStr("jobs-", self.token),
+		TTL:      self.ttl.String(),
+		Behavior: consulapi.SessionBehaviorDelete,
+	}, (&consulapi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	self.session = id
+	self.renewed = time.Now()
+	self.fences = make(map[string]int64) // 新会话需重新获得主节点
+	return id, nil
+}
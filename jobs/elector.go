@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"github.com/garyburd/redigo/redis"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/utils"
+	"os"
+)
+
+// Elector 分布式选主, 每个任务独立选主, 租约到期未续约时由其他实例接替
+// 每次主节点变更时生成递增的fencing token, 任务执行超过租约时新旧主节点可能同时写入, 外部存储可据此拒绝旧token的写入
+type Elector interface {
+	// Campaign 竞选或续约任务主节点, 返回fencing token, 大于0表示当前实例为主节点, 续约期间token不变
+	Campaign(ctx context.Context, name string) (int64, error)
+	// Resign 放弃任务主节点身份
+	Resign(name string) error
+	// Close 关闭选主, 释放会话等资源
+	Close() error
+}
+
+const (
+	redisLeaderKey = "jobs:leader:" // 主节点租约键, hash: owner/token
+	redisFenceKey  = "jobs:fence:"  // fencing token计数器, 不过期
+)
+
+// 持有者为当前实例时续约并返回原token, 否则租约键不存在时抢占并递增token
+var campaignScript = redis.NewScript(2, `
+	if redis.call("hget", KEYS[1], "owner") == ARGV[1]
+	then
+		redis.call("pexpire", KEYS[1], ARGV[2])
+		return tonumber(redis.call("hget", KEYS[1], "token"))
+	end
+	if redis.call("exists", KEYS[1]) == 0
+	then
+		local token = redis.call("incr", KEYS[2])
+		redis.call("hset", KEYS[1], "owner", ARGV[1], "token", token)
+		redis.call("pexpire", KEYS[1], ARGV[2])
+		return token
+	end
+	return 0
+`)
+
+var resignScript = redis.NewScript(1, `
+	if redis.call("hget", KEYS[1], "owner") == ARGV[1]
+	then
+		return redis.call("del", KEYS[1])
+	end
+	return 0
+`)
+
+// 租约键及token计数器使用相同hash tag, 集群模式下位于同一slot
+func redisLeaderKeys(name string) (string, string) {
+	tag := utils.AddStr("{", name, "}")
+	return utils.AddStr(redisLeaderKey, tag), utils.AddStr(redisFenceKey, tag)
+}
+
+// RedisElector 基于redis租约键选主
+type RedisElector struct {
+	ds    string
+	ttl   int64
+	token string
+}
+
+// NewRedisElector 创建redis选主, ttl为租约时间/毫秒, 默认15000, 应大于调度器续约间隔的2倍
+func NewRedisElector(ttl int64, ds ...string) (*RedisElector, error) {
+	if ttl <= 0 {
+		ttl = 15000
+	}
+	var dsName string
+	if len(ds) > 0 {
+		dsName = ds[0]
+	}
+	if _, err := cache.NewRedis(dsName); err != nil {
+		return nil, err
+	}
+	return &RedisElector{ds: dsName, ttl: ttl, token: instanceId()}, nil
+}
+
+func (self *RedisElector) Campaign(ctx context.Context, name string) (int64, error) {
+	rds, err := cache.NewRedis(self.ds)
+	if err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	conn := rds.Pool.Get()
+	defer rds.Close(conn)
+	leaderKey, fenceKey := redisLeaderKeys(name)
+	return redis.Int64(campaignScript.Do(conn, leaderKey, fenceKey, self.token, self.ttl))
+}
+
+func (self *RedisElector) Resign(name string) error {
+	rds, err := cache.NewRedis(self.ds)
+	if err != nil {
+		return err
+	}
+	conn := rds.Pool.Get()
+	defer rds.Close(conn)
+	leaderKey, _ := redisLeaderKeys(name)
+	_, err = resignScript.Do(conn, leaderKey, self.token)
+	return err
+}
+
+func (self *RedisElector) Close() error {
+	return nil
+}
+
+// 实例标识, 主机名+随机ID, 同一主机多进程时不冲突
+func instanceId() string {
+	host, _ := os.Hostname()
+	return utils.AddStr(host, "-", utils.NextSID())
+}
@@ -0,0 +1,395 @@
+package jobs
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/job"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 定时任务调度: cron表达式(含秒)调度, 单任务超时及异常恢复, 上次执行未结束时跳过本次
+// 配置Elector后每个任务独立选主, 集群内仅主节点执行, 续约失败或丢失主节点身份后停止执行
+// 执行上下文携带选主的fencing token(FencingToken获取), 丢失主节点身份时取消执行中任务的ctx
+
+type fencingKey struct{}
+
+// FencingToken 获取任务执行上下文中的fencing token, 写入外部存储时携带并拒绝小于已见token的写入, 未配置Elector时返回false
+func FencingToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingKey{}).(int64)
+	return token, ok
+}
+
+// Task 定时任务
+type Task struct {
+	Name    string                          // 任务名称, 集群内唯一, 用作选主键及指标标签
+	Spec    string                          // cron表达式, 秒 分 时 日 月 周, 如 */5 * * * * ?
+	Timeout int64                           // 执行超时/毫秒, 默认60000, 超时后ctx取消, 任务返回前不再重复执行
+	Func    func(ctx context.Context) error // 任务函数, 应响应ctx取消
+}
+
+// Config 调度器配置
+type Config struct {
+	Name          string  // 调度器名称, 默认master
+	Elector       Elector // 分布式选主, 为空则本实例执行全部任务
+	ElectInterval int64   // 选主续约间隔/毫秒, 默认5000, 应小于选主租约时间的1/2
+}
+
+// Status 任务状态
+type Status struct {
+	Name     string
+	Spec     string
+	Leader   bool   // 当前实例是否为主节点
+	Running  bool   // 是否执行中
+	Next     int64  // 下次执行时间/毫秒
+	LastRun  int64  // 最近执行开始时间/毫秒
+	LastCost int64  // 最近执行耗时/毫秒
+	LastErr  string // 最近执行错误
+	Runs     int64  // 累计执行次数
+	Failed   int64  // 累计失败次数
+	Skipped  int64  // 累计跳过次数
+}
+
+type task struct {
+	Task
+	id       job.EntryID
+	leader   int32
+	fence    int64 // 当前主节点fencing token, 非主节点为0
+	running  int32
+	mu       sync.Mutex
+	abort    context.CancelFunc // 执行中任务的取消函数
+	runFence int64              // 执行中任务的fencing token
+	lastRun  int64
+	lastCost int64
+	lastErr  string
+	runs     int64
+	failed   int64
+	skipped  int64
+}
+
+// Scheduler 定时任务调度器
+type Scheduler struct {
+	mu      sync.Mutex
+	config  Config
+	cron    *job.Cron
+	tasks   map[string]*task
+	started bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+var (
+	schedulerMu sync.Mutex
+	schedulers  = make(map[string]*Scheduler)
+)
+
+// NewScheduler 创建调度器, 同名调度器已存在时返回错误
+func NewScheduler(config Config) (*Scheduler, error) {
+	if len(config.Name) == 0 {
+		config.Name = "master"
+	}
+	if config.ElectInterval <= 0 {
+		config.ElectInterval = 5000
+	}
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if _, ok := schedulers[config.Name]; ok {
+		return nil, utils.Error("job scheduler [", config.Name, "] exist")
+	}
+	s := &Scheduler{config: config, cron: job.NewJob(), tasks: make(map[string]*task)}
+	schedulers[config.Name] = s
+	return s, nil
+}
+
+// GetScheduler 获取调度器, 默认master
+func GetScheduler(name ...string) (*Scheduler, error) {
+	key := "master"
+	if len(name) > 0 && len(name[0]) > 0 {
+		key = name[0]
+	}
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	s, ok := schedulers[key]
+	if !ok {
+		return nil, utils.Error("job scheduler [", key, "] not found")
+	}
+	return s, nil
+}
+
+// Add 添加定时任务, 可在启动前后调用
+func (self *Scheduler) Add(input ...Task) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range input {
+		if len(v.Name) == 0 {
+			return utils.Error("job name is nil")
+		}
+		if v.Func == nil {
+			return utils.Error("job [", v.Name, "] func is nil")
+		}
+		if _, ok := self.tasks[v.Name]; ok {
+			return utils.Error("job [", v.Name, "] exist")
+		}
+		if v.Timeout <= 0 {
+			v.Timeout = 60000
+		}
+		t := &task{Task: v}
+		if self.config.Elector == nil {
+			t.leader = 1
+		}
+		id, err := self.cron.AddFunc(v.Spec, func() { self.execute(t) })
+		if err != nil {
+			return utils.Error("job [", v.Name, "] spec [", v.Spec, "] invalid: ", err)
+		}
+		t.id = id
+		self.tasks[v.Name] = t
+		promx.SetJobLeader(v.Name, t.leader == 1)
+	}
+	return nil
+}
+
+// Start 启动调度器, 配置Elector时同时启动选主任务
+func (self *Scheduler) Start() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.started {
+		return
+	}
+	self.started = true
+	if self.config.Elector != nil {
+		self.stop = make(chan struct{})
+		self.done = make(chan struct{})
+		self.campaign()
+		go self.elect()
+	}
+	self.cron.Start()
+	zlog.Printf("job scheduler【%s】has been started successful", self.config.Name)
+}
+
+// Stop 停止调度, 等待执行中任务结束或ctx取消, 之后放弃全部主节点身份
+func (self *Scheduler) Stop(ctx context.Context) error {
+	self.mu.Lock()
+	if !self.started {
+		self.mu.Unlock()
+		return nil
+	}
+	self.started = false
+	self.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	wait := self.cron.Stop()
+	var err error
+	select {
+	case <-wait.Done():
+	case <-ctx.Done():
+		err = utils.Error("job scheduler [", self.config.Name, "] stop timeout: ", ctx.Err())
+	}
+	if self.config.Elector != nil {
+		close(self.stop)
+		<-self.done
+		for _, t := range self.snapshot() {
+			atomic.StoreInt64(&t.fence, 0)
+			if atomic.SwapInt32(&t.leader, 0) == 1 {
+				if e := self.config.Elector.Resign(t.Name); e != nil {
+					zlog.Error("job resign failed", 0, zlog.String("job", t.Name), zlog.AddError(e))
+				}
+				promx.SetJobLeader(t.Name, false)
+			}
+		}
+	}
+	return err
+}
+
+// Status 获取全部任务状态
+func (self *Scheduler) Status() []Status {
+	next := make(map[job.EntryID]time.Time)
+	for _, v := range self.cron.Entries() {
+		next[v.ID] = v.Next
+	}
+	tasks := self.snapshot()
+	result := make([]Status, 0, len(tasks))
+	for _, t := range tasks {
+		t.mu.Lock()
+		status := Status{
+			Name:     t.Name,
+			Spec:     t.Spec,
+			Leader:   atomic.LoadInt32(&t.leader) == 1,
+			Running:  atomic.LoadInt32(&t.running) == 1,
+			LastRun:  t.lastRun,
+			LastCost: t.lastCost,
+			LastErr:  t.lastErr,
+			Runs:     t.runs,
+			Failed:   t.failed,
+			Skipped:  t.skipped,
+		}
+		t.mu.Unlock()
+		if v, ok := next[t.id]; ok && !v.IsZero() {
+			status.Next = v.UnixMilli()
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+func (self *Scheduler) snapshot() []*task {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	result := make([]*task, 0, len(self.tasks))
+	for _, v := range self.tasks {
+		result = append(result, v)
+	}
+	return result
+}
+
+// 按间隔续约或竞选全部任务主节点
+func (self *Scheduler) elect() {
+	defer close(self.done)
+	ticker := time.NewTicker(time.Duration(self.config.ElectInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			self.campaign()
+		}
+	}
+}
+
+// 选主失败时视为非主节点, 避免网络分区时多实例同时执行
+func (self *Scheduler) campaign() {
+	for _, t := range self.snapshot() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.config.ElectInterval)*time.Millisecond)
+		fence, err := self.config.Elector.Campaign(ctx, t.Name)
+		cancel()
+		if err != nil {
+			zlog.Error("job campaign failed", 0, zlog.String("job", t.Name), zlog.AddError(err))
+			fence = 0
+		}
+		leader := fence > 0
+		var state int32
+		if leader {
+			state = 1
+		}
+		atomic.StoreInt64(&t.fence, fence)
+		if atomic.SwapInt32(&t.leader, state) != state {
+			zlog.Info("job leader changed", 0, zlog.String("job", t.Name), zlog.Bool("leader", leader), zlog.Int64("fence", fence))
+			promx.SetJobLeader(t.Name, leader)
+		}
+		t.fenced(fence)
+	}
+}
+
+// fenced 执行中任务的fencing token已失效(丢失或变更主节点)时取消其ctx, 避免超出租约继续执行
+func (self *task) fenced(fence int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.abort == nil || self.runFence == fence {
+		return
+	}
+	zlog.Warn("job lease lost, running job canceled", 0, zlog.String("job", self.Name), zlog.Int64("fence", self.runFence))
+	self.abort()
+	self.abort = nil
+}
+
+// 执行任务, 非主节点或上次执行未结束时跳过, 超时后释放调度协程, 任务函数返回前保持执行中状态
+func (self *Scheduler) execute(t *task) {
+	if atomic.LoadInt32(&t.leader) != 1 {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		t.mu.Lock()
+		t.skipped++
+		t.mu.Unlock()
+		promx.ObserveJobSkipped(t.Name)
+		zlog.Warn("job skipped, previous run not finished", 0, zlog.String("job", t.Name))
+		return
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(t.Timeout)*time.Millisecond)
+	if self.config.Elector != nil {
+		fence := atomic.LoadInt64(&t.fence)
+		if fence == 0 { // 选主期间刚丢失主节点身份
+			cancel()
+			atomic.StoreInt32(&t.running, 0)
+			return
+		}
+		ctx = context.WithValue(ctx, fencingKey{}, fence)
+		t.mu.Lock()
+		t.abort, t.runFence = cancel, fence
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			t.abort = nil
+			t.mu.Unlock()
+		}()
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer atomic.StoreInt32(&t.running, 0)
+		done <- invoke(ctx, t)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			err = utils.Error("job [", t.Name, "] canceled, lease lost")
+		} else {
+			err = utils.Error("job [", t.Name, "] timeout")
+		}
+	}
+	cancel()
+	cost := time.Since(start)
+	t.mu.Lock()
+	t.lastRun = start.UnixMilli()
+	t.lastCost = cost.Milliseconds()
+	t.runs++
+	t.lastErr = ""
+	if err != nil {
+		t.failed++
+		t.lastErr = err.Error()
+	}
+	t.mu.Unlock()
+	promx.ObserveJob(t.Name, cost, err)
+	if err != nil {
+		zlog.Error("job run failed", 0, zlog.String("job", t.Name), zlog.Int64("cost", cost.Milliseconds()), zlog.AddError(err))
+	}
+}
+
+// 任务异常不影响调度
+func invoke(ctx context.Context, t *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = utils.Error("job [", t.Name, "] panic: ", r)
+		}
+	}()
+	return t.Func(ctx)
+}
+
+// Close 停止全部调度器并关闭选主, 停机时调用
+func Close(ctx context.Context) map[string]error {
+	schedulerMu.Lock()
+	list := make(map[string]*Scheduler, len(schedulers))
+	for k, v := range schedulers {
+		list[k] = v
+		delete(schedulers, k)
+	}
+	schedulerMu.Unlock()
+	result := make(map[string]error)
+	for k, v := range list {
+		if err := v.Stop(ctx); err != nil {
+			result[k] = err
+		}
+		if v.config.Elector != nil {
+			if err := v.config.Elector.Close(); err != nil {
+				result[k] = err
+			}
+		}
+	}
+	return result
+}
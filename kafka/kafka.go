@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/Shopify/sarama"
+	"github.com/godaddy-x/freego/utils"
+	"time"
+)
+
+const (
+	PLAIN = 0 // 明文签名
+	AES   = 1 // AES-GCM加密签名
+
+	RANGE      = "range"
+	ROUNDROBIN = "roundrobin"
+	STICKY     = "sticky"
+)
+
+type KafkaConfig struct {
+	DsName    string
+	Addrs     []string // broker地址, host:port
+	Version   string   // kafka版本, 默认2.1.0
+	ClientId  string   // 客户端标识, 默认freego
+	Username  string   // SASL/PLAIN账号, 为空则不开启认证
+	Password  string   // SASL/PLAIN密码
+	SecretKey string   // 消息签名密钥
+	Timeout   int      // 连接/请求超时/毫秒, 默认10000
+}
+
+type Option struct {
+	Topic  string `json:"tp"`
+	SigTyp int    `json:"st"` // 是否加密 0.明文签名 1.AES-GCM加密签名
+	SigKey string `json:"-"`  // 验签密钥
+}
+
+type MsgData struct {
+	Option    Option      `json:"op"`
+	Content   interface{} `json:"co"`
+	Type      int64       `json:"ty"`
+	Nonce     string      `json:"no"`
+	Signature string      `json:"sg"`
+	Key       string      `json:"-"` // 消息key, 相同key写入同一分区有序消费
+	ctx       context.Context
+}
+
+// Kafka监听配置参数
+type Config struct {
+	Option   Option
+	Group    string // 消费组, 同组消费者按分区负载均衡
+	Strategy string // 分区分配策略 range/roundrobin/sticky, 默认range
+	Oldest   bool   // 消费组无已提交位点时是否从最早消息开始消费, 默认最新
+	IsNack   bool   // 回调失败时是否按Delay间隔重试, 否则提交位点跳过
+}
+
+func newConfig(conf KafkaConfig) (*sarama.Config, error) {
+	if len(conf.Addrs) == 0 {
+		return nil, utils.Error("kafka addrs is nil")
+	}
+	config := sarama.NewConfig()
+	version := sarama.V2_1_0_0
+	if len(conf.Version) > 0 {
+		v, err := sarama.ParseKafkaVersion(conf.Version)
+		if err != nil {
+			return nil, utils.Error("kafka version [", conf.Version, "] invalid: ", err)
+		}
+		version = v
+	}
+	config.Version = version
+	config.ClientID = "freego"
+	if len(conf.ClientId) > 0 {
+		config.ClientID = conf.ClientId
+	}
+	timeout := 10 * time.Second
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Millisecond
+	}
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	if len(conf.Username) > 0 {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = conf.Username
+		config.Net.SASL.Password = conf.Password
+	}
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Consumer.Return.Errors = true
+	return config, nil
+}
+
+func newClient(conf KafkaConfig) (sarama.Client, error) {
+	config, err := newConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(conf.Addrs, config)
+	if err != nil {
+		return nil, utils.Error("kafka init failed: ", err)
+	}
+	return client, nil
+}
+
+func sigKey(secretKey string) string {
+	return utils.HMAC_SHA512(secretKey, utils.GetLocalSecretKey())
+}
+
+// sign 按签名模式加密并签名消息内容
+func (self *MsgData) sign(key string) error {
+	if len(key) == 0 {
+		return utils.Error("kafka publish data key is nil")
+	}
+	if self.Content == nil {
+		self.Content = map[string]string{}
+	}
+	body, err := utils.JsonMarshal(self.Content)
+	if err != nil {
+		return err
+	}
+	content := utils.Base64Encode(body)
+	if len(content) == 0 {
+		return utils.Error("kafka publish content is nil")
+	}
+	if self.Option.SigTyp == AES {
+		if content, err = gcmEncrypt(body, key); err != nil {
+			return utils.Error("kafka publish content aes encrypt failed: ", err)
+		}
+	}
+	self.Content = content
+	self.Signature = utils.HMAC_SHA256(utils.AddStr(content, self.Nonce), key, true)
+	return nil
+}
+
+func gcmCipher(key string) (cipher.AEAD, error) {
+	sum := sha256.Sum256(utils.Str2Bytes(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AES-GCM加密, 返回base64(nonce+密文)
+func gcmEncrypt(plain []byte, key string) (string, error) {
+	gcm, err := gcmCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return utils.Base64Encode(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+func gcmDecrypt(msg, key string) ([]byte, error) {
+	gcm, err := gcmCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	bs := utils.Base64Decode(msg)
+	if len(bs) <= gcm.NonceSize() {
+		return nil, utils.Error("kafka ciphertext invalid")
+	}
+	return gcm.Open(nil, bs[:gcm.NonceSize()], bs[gcm.NonceSize():], nil)
+}
@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"os"
+)
+
+type logProducer struct {
+	producer sarama.AsyncProducer
+}
+
+// NewLogProducer 创建zlog kafka日志输出实现, 异步发送且不等待确认, 发送失败输出至标准错误
+// 如 zlog.InitDefaultLog(&zlog.ZapConfig{Kafka: &zlog.KafkaConfig{Topic: "app_log", Producer: producer}})
+func NewLogProducer(conf KafkaConfig) (zlog.LogProducer, error) {
+	config, err := newConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	config.Producer.Return.Successes = false
+	producer, err := sarama.NewAsyncProducer(conf.Addrs, config)
+	if err != nil {
+		return nil, utils.Error("kafka log producer init failed: ", err)
+	}
+	go func() {
+		for err := range producer.Errors() {
+			_, _ = os.Stderr.WriteString("zlog kafka write failed: " + err.Error() + "\n")
+		}
+	}()
+	return &logProducer{producer: producer}, nil
+}
+
+// Send 非阻塞写入生产者缓冲区, 缓冲区满时返回错误
+func (self *logProducer) Send(topic string, value []byte) error {
+	select {
+	case self.producer.Input() <- &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(value)}:
+		return nil
+	default:
+		return utils.Error("kafka log producer buffer is full")
+	}
+}
+
+func (self *logProducer) Close() error {
+	return self.producer.Close()
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+var (
+	publishMgrs = make(map[string]*PublishManager)
+)
+
+type PublishManager struct {
+	conf     KafkaConfig
+	client   sarama.Client
+	producer sarama.SyncProducer
+	sigKey   string
+}
+
+func (self *PublishManager) InitConfig(input ...KafkaConfig) (*PublishManager, error) {
+	for _, v := range input {
+		if _, b := publishMgrs[v.DsName]; b {
+			return nil, utils.Error("kafka publish init failed: [", v.DsName, "] exist")
+		}
+		if len(v.DsName) == 0 {
+			v.DsName = DIC.MASTER
+		}
+		if len(v.SecretKey) == 0 {
+			return nil, utils.Error("kafka publish SecretKey is nil")
+		}
+		client, err := newClient(v)
+		if err != nil {
+			return nil, err
+		}
+		producer, err := sarama.NewSyncProducerFromClient(client)
+		if err != nil {
+			_ = client.Close()
+			return nil, utils.Error("kafka publish init failed: ", err)
+		}
+		publishMgrs[v.DsName] = &PublishManager{conf: v, client: client, producer: producer, sigKey: sigKey(v.SecretKey)}
+		zlog.Printf("kafka publish service【%s】has been started successful", v.DsName)
+	}
+	return self, nil
+}
+
+func (self *PublishManager) Client(ds ...string) (*PublishManager, error) {
+	dsName := DIC.MASTER
+	if len(ds) > 0 && len(ds[0]) > 0 {
+		dsName = ds[0]
+	}
+	return publishMgrs[dsName], nil
+}
+
+func NewPublish(ds ...string) (*PublishManager, error) {
+	return new(PublishManager).Client(ds...)
+}
+
+func (self *PublishManager) Publish(topic string, dataType int64, content interface{}) error {
+	msg := &MsgData{
+		Option:  Option{Topic: topic},
+		Type:    dataType,
+		Content: content,
+	}
+	return self.PublishMsgData(msg)
+}
+
+func (self *PublishManager) PublishMsgData(data *MsgData) (err error) {
+	if data == nil {
+		return utils.Error("publish data empty")
+	}
+	ctx, span := startSpan(data.Context(), data.Option.Topic, "", trace.SpanKindProducer)
+	defer func() {
+		endSpan(span, err)
+		promx.ObserveKafkaPublish(data.Option.Topic, err)
+	}()
+	if len(data.Option.Topic) == 0 {
+		return utils.Error("kafka publish topic is nil")
+	}
+	if !utils.CheckInt(data.Option.SigTyp, PLAIN, AES) {
+		data.Option.SigTyp = AES
+	}
+	if len(data.Nonce) == 0 {
+		data.Nonce = utils.RandNonce()
+	}
+	if err := data.sign(self.sigKey); err != nil {
+		return err
+	}
+	body, err := utils.JsonMarshal(data)
+	if err != nil {
+		return err
+	}
+	msg := &sarama.ProducerMessage{Topic: data.Option.Topic, Value: sarama.ByteEncoder(body), Timestamp: time.Now()}
+	if len(data.Key) > 0 {
+		msg.Key = sarama.StringEncoder(data.Key)
+	}
+	msg.Headers = injectHeaders(ctx, msg.Headers)
+	if _, _, err := self.producer.SendMessage(msg); err != nil {
+		return utils.Error("kafka publish [", data.Option.Topic, "] failed: ", err)
+	}
+	return nil
+}
+
+// PingPublish 检测所有已初始化的发布连接能否刷新broker元数据, 返回数据源名称对应的检测结果
+func PingPublish() map[string]error {
+	result := make(map[string]error, len(publishMgrs))
+	for k, v := range publishMgrs {
+		result[k] = ping(k, v.client)
+	}
+	return result
+}
+
+func ping(dsName string, client sarama.Client) error {
+	if client.Closed() {
+		return utils.Error("kafka [", dsName, "] client closed")
+	}
+	if err := client.RefreshMetadata(); err != nil {
+		return utils.Error("kafka [", dsName, "] refresh metadata failed: ", err)
+	}
+	if len(client.Brokers()) == 0 {
+		return utils.Error("kafka [", dsName, "] no available broker")
+	}
+	return nil
+}
+
+// ClosePublish 关闭全部发布者, 等待已提交的消息发送完成
+func ClosePublish() map[string]error {
+	result := make(map[string]error, len(publishMgrs))
+	for k, v := range publishMgrs {
+		if err := v.producer.Close(); err != nil {
+			zlog.Warn("kafka producer close failed", 0, zlog.String("ds", k), zlog.AddError(err))
+		}
+		if v.client.Closed() {
+			result[k] = nil
+			continue
+		}
+		if err := v.client.Close(); err != nil {
+			result[k] = utils.Error("kafka publish [", k, "] close failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
@@ -0,0 +1,466 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/Shopify/sarama"
+	"github.com/godaddy-x/freego/cache"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+)
+
+const (
+	dedupPrefix     = "kafka:dedup:"
+	dedupProcessing = "processing"
+	dedupDone       = "done"
+)
+
+var (
+	pullMgrs = make(map[string]*PullManager)
+
+	errDedupProcessing = errors.New("kafka pull message is processing")
+)
+
+type PullManager struct {
+	mu        sync.Mutex
+	conf      KafkaConfig
+	client    sarama.Client // 用于健康检查及积压统计
+	admin     sarama.ClusterAdmin
+	sigKey    string
+	receivers []*PullReceiver
+}
+
+type PullReceiver struct {
+	group        sarama.ConsumerGroup
+	cancel       context.CancelFunc
+	done         chan struct{}
+	Config       *Config
+	ContentInter func(typ int64) interface{}
+	Callback     func(msg *MsgData) error
+	Debug        bool                        // 是否打印具体pull数据实体
+	Delay        int                         // pull失败重试间隔/秒, 默认5
+	DedupCache   func() (cache.Cache, error) // 消费去重缓存, 为空则不去重
+	DedupExpire  int                         // 去重有效期/秒, 默认86400
+	DedupProcess int                         // 处理中标记有效期/秒, 默认300, 应大于回调最长执行时间, 处理中断后标记过期可重新消费
+}
+
+// TopicLag 消费组积压
+type TopicLag struct {
+	Topic string
+	Group string
+	Lag   int64 // 各分区最新位点与已提交位点差值之和
+}
+
+func (self *PullManager) InitConfig(input ...KafkaConfig) (*PullManager, error) {
+	for _, v := range input {
+		if _, b := pullMgrs[v.DsName]; b {
+			return nil, utils.Error("kafka pull init failed: [", v.DsName, "] exist")
+		}
+		if len(v.DsName) == 0 {
+			v.DsName = DIC.MASTER
+		}
+		if len(v.SecretKey) == 0 {
+			return nil, utils.Error("kafka pull SecretKey is nil")
+		}
+		client, err := newClient(v)
+		if err != nil {
+			return nil, err
+		}
+		admin, err := sarama.NewClusterAdminFromClient(client)
+		if err != nil {
+			_ = client.Close()
+			return nil, utils.Error("kafka pull init failed: ", err)
+		}
+		pullMgrs[v.DsName] = &PullManager{conf: v, client: client, admin: admin, sigKey: sigKey(v.SecretKey)}
+		zlog.Printf("kafka pull service【%s】has been started successful", v.DsName)
+	}
+	return self, nil
+}
+
+func (self *PullManager) Client(ds ...string) (*PullManager, error) {
+	dsName := DIC.MASTER
+	if len(ds) > 0 && len(ds[0]) > 0 {
+		dsName = ds[0]
+	}
+	return pullMgrs[dsName], nil
+}
+
+func NewPull(ds ...string) (*PullManager, error) {
+	return new(PullManager).Client(ds...)
+}
+
+func (self *PullManager) AddPullReceiver(receivers ...*PullReceiver) {
+	for _, v := range receivers {
+		if err := self.start(v); err != nil {
+			v.OnError(err)
+		}
+	}
+}
+
+func (self *PullManager) start(receiver *PullReceiver) error {
+	option := receiver.Config.Option
+	if len(option.Topic) == 0 {
+		return utils.Error("kafka pull topic is nil")
+	}
+	if len(receiver.Config.Group) == 0 {
+		return utils.Error("kafka pull group is nil")
+	}
+	if !utils.CheckInt(option.SigTyp, PLAIN, AES) {
+		receiver.Config.Option.SigTyp = AES
+	}
+	receiver.Config.Option.SigKey = self.sigKey
+	config, err := newConfig(self.conf)
+	if err != nil {
+		return err
+	}
+	switch receiver.Config.Strategy {
+	case "", RANGE:
+		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
+	case ROUNDROBIN:
+		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
+	case STICKY:
+		config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategySticky
+	default:
+		return utils.Error("kafka pull strategy [", receiver.Config.Strategy, "] invalid")
+	}
+	if receiver.Config.Oldest {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+	group, err := sarama.NewConsumerGroup(self.conf.Addrs, receiver.Config.Group, config)
+	if err != nil {
+		return utils.Error("kafka pull init group [", receiver.Config.Group, "] failed: ", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver.group = group
+	receiver.cancel = cancel
+	receiver.done = make(chan struct{})
+	self.mu.Lock()
+	self.receivers = append(self.receivers, receiver)
+	self.mu.Unlock()
+	go func() {
+		for err := range group.Errors() {
+			receiver.OnError(err)
+		}
+	}()
+	go receiver.consume(ctx)
+	zlog.Printf("kafka pull init topic [%s - %s] successful...", receiver.Config.Option.Topic, receiver.Config.Group)
+	return nil
+}
+
+// consume 加入消费组并持续消费, 分区重新分配(rebalance)后Consume返回, 循环重新加入
+func (self *PullReceiver) consume(ctx context.Context) {
+	defer close(self.done)
+	topics := []string{self.Config.Option.Topic}
+	for {
+		if err := self.group.Consume(ctx, topics, self); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			self.OnError(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(2500 * time.Millisecond):
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (self *PullReceiver) Setup(session sarama.ConsumerGroupSession) error {
+	zlog.Info("kafka pull partitions assigned", 0, zlog.String("topic", self.Config.Option.Topic), zlog.String("group", self.Config.Group), zlog.Any("claims", session.Claims()))
+	return nil
+}
+
+func (self *PullReceiver) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 按分区顺序处理消息, 处理完成后提交位点
+func (self *PullReceiver) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			key, ok := self.handle(session, msg)
+			if !ok {
+				return nil
+			}
+			session.MarkMessage(msg, "")
+			self.dedupDone(key)
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// handle 处理单条消息, 失败且开启IsNack时按Delay间隔重试, 分区被回收时返回false且不提交位点, 成功时返回去重标记key
+func (self *PullReceiver) handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) (string, bool) {
+	ctx := extractHeaders(msg.Headers)
+	delay := self.Delay
+	if delay == 0 {
+		delay = 5
+	}
+	for {
+		key, ok, err := self.receive(ctx, msg.Value)
+		if err != errDedupProcessing { // 其他消费者处理中或处理中断, 等待完成标记或处理中标记过期后重新判断
+			promx.ObserveKafkaConsume(self.Config.Option.Topic, self.Config.Group, err)
+		}
+		if ok {
+			return key, true
+		}
+		select {
+		case <-session.Context().Done():
+			return "", false
+		case <-time.After(time.Duration(delay) * time.Second):
+		}
+	}
+}
+
+func (self *PullReceiver) OnError(err error) {
+	zlog.Error("kafka pull receiver data failed", 0, zlog.AddError(err))
+}
+
+func (self *PullReceiver) OnReceive(b []byte) bool {
+	key, ok, _ := self.receive(context.Background(), b)
+	if ok {
+		self.dedupDone(key)
+	}
+	return ok
+}
+
+// receive 返回false时携带回调错误, 用于失败重试, 回调成功时返回去重标记key, 提交位点后由dedupDone标记为已完成
+func (self *PullReceiver) receive(ctx context.Context, b []byte) (string, bool, error) {
+	if len(b) == 0 || string(b) == "{}" || string(b) == "[]" {
+		return "", true, nil
+	}
+	if self.Debug {
+		defer zlog.Debug("kafka pull consumption data monitoring", utils.UnixMilli(), zlog.String("message", utils.Bytes2Str(b)))
+	}
+	msg := &MsgData{}
+	if err := utils.JsonUnmarshal(b, msg); err != nil {
+		zlog.Error("kafka pull consumption data parsing failed", 0, zlog.String("topic", self.Config.Option.Topic), zlog.AddError(err))
+		return "", true, nil
+	}
+	if msg.Content == nil {
+		return "", true, nil
+	}
+	sigKey := self.Config.Option.SigKey
+	if len(msg.Signature) == 0 {
+		zlog.Error("kafka pull consumption data signature is nil", 0, zlog.String("topic", self.Config.Option.Topic), zlog.Any("message", msg))
+		return "", true, nil
+	}
+	v, ok := msg.Content.(string)
+	if !ok || len(v) == 0 {
+		zlog.Error("kafka consumption data (non string type) or nil", 0, zlog.String("topic", self.Config.Option.Topic), zlog.Any("message", msg))
+		return "", true, nil
+	}
+	if msg.Signature != utils.HMAC_SHA256(utils.AddStr(v, msg.Nonce), sigKey, true) {
+		zlog.Error("kafka consumption data signature invalid", 0, zlog.String("topic", self.Config.Option.Topic), zlog.Any("message", msg))
+		return "", true, nil
+	}
+	var btv []byte
+	if self.Config.Option.SigTyp == AES {
+		content, err := gcmDecrypt(v, sigKey)
+		if err != nil {
+			zlog.Error("kafka consumption data aes decrypt failed", 0, zlog.String("topic", self.Config.Option.Topic), zlog.Any("message", msg), zlog.AddError(err))
+			return "", true, nil
+		}
+		btv = content
+	} else {
+		btv = utils.Base64Decode(v)
+	}
+	if len(btv) == 0 {
+		zlog.Error("kafka pull consumption data Base64 parsing failed", 0, zlog.String("topic", self.Config.Option.Topic), zlog.Any("message", msg))
+		return "", true, nil
+	}
+	if self.ContentInter == nil {
+		content := map[string]interface{}{}
+		if err := utils.JsonUnmarshal(btv, &content); err != nil {
+			zlog.Error("kafka pull consumption data conversion type(Map) failed", 0, zlog.String("topic", self.Config.Option.Topic), zlog.AddError(err))
+			return "", true, nil
+		}
+		msg.Content = content
+	} else {
+		content := self.ContentInter(msg.Type)
+		if err := utils.JsonUnmarshal(btv, content); err != nil {
+			zlog.Error("kafka pull consumption data conversion type(ContentInter) failed", 0, zlog.String("topic", self.Config.Option.Topic), zlog.AddError(err))
+			return "", true, nil
+		}
+		msg.Content = content
+	}
+	dedupKey, ok, err := self.dedup(msg)
+	if err != nil {
+		return "", false, err
+	}
+	if !ok {
+		return "", true, nil
+	}
+	ctx, span := startSpan(ctx, self.Config.Option.Topic, self.Config.Group, trace.SpanKindConsumer)
+	msg.ctx = ctx
+	err = self.Callback(msg)
+	endSpan(span, err)
+	if err != nil {
+		self.undedup(dedupKey)
+		zlog.Error("kafka pull consumption data processing failed", 0, zlog.String("topic", self.Config.Option.Topic), zlog.String("group", self.Config.Group), zlog.AddError(err))
+		if self.Config.IsNack {
+			return "", false, err
+		}
+		return "", true, nil
+	}
+	return dedupKey, true, nil
+}
+
+// dedup 以消息nonce为唯一标识写入短期处理中标记, 提交位点后标记为已完成, 已完成视为重复投递直接提交
+// 处理中标记存在时返回errDedupProcessing, 等待其他消费者完成或处理中断后标记过期再重新消费, 避免处理中断的消息被当作重复丢弃
+func (self *PullReceiver) dedup(msg *MsgData) (string, bool, error) {
+	if self.DedupCache == nil || len(msg.Nonce) == 0 {
+		return "", true, nil
+	}
+	c, err := self.DedupCache()
+	if err != nil {
+		zlog.Error("kafka pull dedup cache invalid", 0, zlog.AddError(err))
+		return "", true, nil
+	}
+	process := self.DedupProcess
+	if process <= 0 {
+		process = 300
+	}
+	key := utils.AddStr(dedupPrefix, self.Config.Group, ":", msg.Nonce)
+	b, err := c.PutNX(key, dedupProcessing, process)
+	if err != nil {
+		zlog.Error("kafka pull dedup cache put failed", 0, zlog.String("key", key), zlog.AddError(err))
+		return "", true, nil
+	}
+	if b {
+		return key, true, nil
+	}
+	state, err := c.GetString(key)
+	if err != nil {
+		zlog.Error("kafka pull dedup cache get failed", 0, zlog.String("key", key), zlog.AddError(err))
+		return "", false, errDedupProcessing
+	}
+	if state != dedupDone {
+		return "", false, errDedupProcessing
+	}
+	zlog.Warn("kafka pull duplicate message skipped", 0, zlog.String("topic", self.Config.Option.Topic), zlog.String("nonce", msg.Nonce))
+	return "", false, nil
+}
+
+// dedupDone 提交位点后将处理中标记改为已完成, 按去重有效期保留
+func (self *PullReceiver) dedupDone(key string) {
+	if len(key) == 0 {
+		return
+	}
+	c, err := self.DedupCache()
+	if err != nil {
+		return
+	}
+	expire := self.DedupExpire
+	if expire <= 0 {
+		expire = 86400
+	}
+	if err := c.Put(key, dedupDone, expire); err != nil {
+		zlog.Error("kafka pull dedup cache done failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+}
+
+// undedup 回调失败时释放占位, 保证重试消息可再次消费
+func (self *PullReceiver) undedup(key string) {
+	if len(key) == 0 {
+		return
+	}
+	c, err := self.DedupCache()
+	if err != nil {
+		return
+	}
+	if err := c.Del(key); err != nil {
+		zlog.Error("kafka pull dedup cache del failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+}
+
+// PingPull 检测所有已初始化的消费连接能否刷新broker元数据
+func PingPull() map[string]error {
+	result := make(map[string]error, len(pullMgrs))
+	for k, v := range pullMgrs {
+		result[k] = ping(k, v.client)
+	}
+	return result
+}
+
+// GetConsumerLag 获取所有消费组的积压消息数
+func GetConsumerLag() map[string][]TopicLag {
+	result := make(map[string][]TopicLag, len(pullMgrs))
+	for k, v := range pullMgrs {
+		result[k] = v.lag()
+	}
+	return result
+}
+
+func (self *PullManager) lag() []TopicLag {
+	self.mu.Lock()
+	receivers := make([]*PullReceiver, len(self.receivers))
+	copy(receivers, self.receivers)
+	self.mu.Unlock()
+	result := make([]TopicLag, 0, len(receivers))
+	for _, v := range receivers {
+		topic := v.Config.Option.Topic
+		partitions, err := self.client.Partitions(topic)
+		if err != nil {
+			zlog.Error("kafka topic partitions failed", 0, zlog.String("topic", topic), zlog.AddError(err))
+			continue
+		}
+		offsets, err := self.admin.ListConsumerGroupOffsets(v.Config.Group, map[string][]int32{topic: partitions})
+		if err != nil {
+			zlog.Error("kafka consumer group offsets failed", 0, zlog.String("group", v.Config.Group), zlog.AddError(err))
+			continue
+		}
+		lag := int64(0)
+		for _, partition := range partitions {
+			newest, err := self.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				zlog.Error("kafka partition offset failed", 0, zlog.String("topic", topic), zlog.Int32("partition", partition), zlog.AddError(err))
+				continue
+			}
+			committed := int64(0)
+			if block := offsets.GetBlock(topic, partition); block != nil && block.Offset > 0 {
+				committed = block.Offset
+			}
+			lag += newest - committed
+		}
+		result = append(result, TopicLag{Topic: topic, Group: v.Config.Group, Lag: lag})
+	}
+	return result
+}
+
+// ClosePull 停止全部消费者并离开消费组, 已处理消息的位点在离开前提交, 未处理消息由组内其他消费者继续消费
+func ClosePull() map[string]error {
+	result := make(map[string]error, len(pullMgrs))
+	for k, v := range pullMgrs {
+		v.mu.Lock()
+		for _, receiver := range v.receivers {
+			receiver.cancel()
+			if err := receiver.group.Close(); err != nil {
+				zlog.Warn("kafka pull group close failed", 0, zlog.String("topic", receiver.Config.Option.Topic), zlog.String("group", receiver.Config.Group), zlog.AddError(err))
+			}
+			<-receiver.done
+		}
+		v.mu.Unlock()
+		// admin由client创建, 关闭时一并关闭client
+		if err := v.admin.Close(); err != nil {
+			result[k] = utils.Error("kafka pull [", k, "] close failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
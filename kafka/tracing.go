@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"context"
+	"github.com/Shopify/sarama"
+	"github.com/godaddy-x/freego/otelx"
+	"github.com/godaddy-x/freego/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 发送消息头trace上下文写入
+type producerCarrier struct {
+	headers *[]sarama.RecordHeader
+}
+
+func (self producerCarrier) Get(key string) string {
+	for _, v := range *self.headers {
+		if string(v.Key) == key {
+			return string(v.Value)
+		}
+	}
+	return ""
+}
+
+func (self producerCarrier) Set(key, value string) {
+	*self.headers = append(*self.headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (self producerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*self.headers))
+	for _, v := range *self.headers {
+		keys = append(keys, string(v.Key))
+	}
+	return keys
+}
+
+// 消费消息头trace上下文读取
+type consumerCarrier []*sarama.RecordHeader
+
+func (self consumerCarrier) Get(key string) string {
+	for _, v := range self {
+		if v != nil && string(v.Key) == key {
+			return string(v.Value)
+		}
+	}
+	return ""
+}
+
+func (self consumerCarrier) Set(key, value string) {}
+
+func (self consumerCarrier) Keys() []string {
+	keys := make([]string, 0, len(self))
+	for _, v := range self {
+		if v != nil {
+			keys = append(keys, string(v.Key))
+		}
+	}
+	return keys
+}
+
+// WithContext 设置消息上下文, 发送时透传其中的trace上下文至消费方
+func (self *MsgData) WithContext(ctx context.Context) *MsgData {
+	self.ctx = ctx
+	return self
+}
+
+// Context 消息上下文, 消费回调中携带上游透传的trace上下文
+func (self *MsgData) Context() context.Context {
+	if self.ctx == nil {
+		return context.Background()
+	}
+	return self.ctx
+}
+
+// 创建收发span, 未启用链路追踪时span为nil
+func startSpan(ctx context.Context, topic, group string, kind trace.SpanKind) (context.Context, trace.Span) {
+	if !otelx.Enabled() {
+		return ctx, nil
+	}
+	operation := "publish"
+	if kind == trace.SpanKindConsumer {
+		operation = "receive"
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination", topic),
+		attribute.String("messaging.operation", operation),
+	}
+	if len(group) > 0 {
+		attrs = append(attrs, attribute.String("messaging.kafka.consumer_group", group))
+	}
+	return otelx.Start(ctx, utils.AddStr(topic, " ", operation), kind, attrs...)
+}
+
+func endSpan(span trace.Span, err error) {
+	if span != nil {
+		otelx.End(span, err)
+	}
+}
+
+func injectHeaders(ctx context.Context, headers []sarama.RecordHeader) []sarama.RecordHeader {
+	if otelx.Enabled() {
+		otelx.Inject(ctx, producerCarrier{headers: &headers})
+	}
+	return headers
+}
+
+func extractHeaders(headers []*sarama.RecordHeader) context.Context {
+	if !otelx.Enabled() || len(headers) == 0 {
+		return context.Background()
+	}
+	return otelx.Extract(context.Background(), consumerCarrier(headers))
+}
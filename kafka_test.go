@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/kafka"
+	"testing"
+	"time"
+)
+
+var kafkaTopic = "test.monitor"
+var kafkaInput = kafka.KafkaConfig{
+	Addrs:     []string{"172.31.25.1:9092"},
+	SecretKey: "123456",
+}
+
+func TestKafkaPull(t *testing.T) {
+	if _, err := new(kafka.PullManager).InitConfig(kafkaInput); err != nil {
+		panic(err)
+	}
+	cli, _ := kafka.NewPull()
+	receiver := &kafka.PullReceiver{
+		Config: &kafka.Config{Option: kafka.Option{Topic: kafkaTopic}, Group: "test.group", Oldest: true},
+		Callback: func(msg *kafka.MsgData) error {
+			fmt.Println("receive msg: ", msg.Content)
+			return nil
+		},
+	}
+	cli.AddPullReceiver(receiver)
+	time.Sleep(60 * time.Second)
+	fmt.Println(kafka.GetConsumerLag())
+	fmt.Println(kafka.ClosePull())
+}
+
+func TestKafkaPublish(t *testing.T) {
+	if _, err := new(kafka.PublishManager).InitConfig(kafkaInput); err != nil {
+		panic(err)
+	}
+	cli, _ := kafka.NewPublish()
+	content := map[string]interface{}{"test": 1234}
+	for i := 0; i < 10; i++ {
+		if err := cli.PublishMsgData(&kafka.MsgData{Option: kafka.Option{Topic: kafkaTopic}, Type: 1, Key: "user_1", Content: content}); err != nil {
+			fmt.Println("send msg failed: ", err)
+		} else {
+			fmt.Println("send msg success: ", content)
+		}
+	}
+	fmt.Println(kafka.PingPublish())
+	fmt.Println(kafka.ClosePublish())
+}
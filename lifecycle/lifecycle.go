@@ -0,0 +1,130 @@
+package lifecycle
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/amqp"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/configx"
+	"github.com/godaddy-x/freego/jobs"
+	"github.com/godaddy-x/freego/kafka"
+	"github.com/godaddy-x/freego/node"
+	"github.com/godaddy-x/freego/ormx/outbox"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/otelx"
+	"github.com/godaddy-x/freego/rpcx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/utils/certx"
+	"github.com/godaddy-x/freego/zlog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+var (
+	hooks   []func(ctx context.Context) error
+	hooksMu sync.Mutex
+	once    sync.Once
+	result  error
+)
+
+// OnShutdown 注册停机回调, 在HTTP/gRPC服务停止后、数据源关闭前按注册顺序执行
+func OnShutdown(fn func(ctx context.Context) error) {
+	if fn == nil {
+		panic("shutdown function is nil")
+	}
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+type step struct {
+	name string
+	call func(ctx context.Context) map[string]error
+}
+
+func single(err error) map[string]error {
+	return map[string]error{"": err}
+}
+
+// 先停止接收请求, 再关闭消费者及发布者, 然后关闭缓存和数据库, 最后上报剩余链路数据
+func steps() []step {
+	return []step{
+		{name: "http", call: func(ctx context.Context) map[string]error { return single(node.Shutdown(ctx)) }},
+		{name: "grpc", call: func(ctx context.Context) map[string]error { return single(rpcx.Shutdown(ctx)) }},
+		{name: "registry", call: func(ctx context.Context) map[string]error { return rpcx.CloseRegistry() }},
+		{name: "config", call: func(ctx context.Context) map[string]error { return single(configx.Close()) }},
+		{name: "certificate", call: func(ctx context.Context) map[string]error { return single(certx.Close()) }},
+		{name: "hook", call: runHooks},
+		{name: "jobs", call: jobs.Close},
+		{name: "message outbox", call: func(ctx context.Context) map[string]error { outbox.Stop(); return nil }},
+		{name: "mongo outbox", call: func(ctx context.Context) map[string]error { sqld.StopMongoOutbox(); return nil }},
+		{name: "audit", call: func(ctx context.Context) map[string]error { sqld.StopAudit(); return nil }},
+		{name: "query killer", call: func(ctx context.Context) map[string]error { sqld.StopQueryKiller(); return nil }},
+		{name: "rabbitmq drain", call: rabbitmq.DrainPull},
+		{name: "rabbitmq pull", call: func(ctx context.Context) map[string]error { return rabbitmq.ClosePull() }},
+		{name: "rabbitmq publish", call: func(ctx context.Context) map[string]error { return rabbitmq.ClosePublish() }},
+		{name: "kafka pull", call: func(ctx context.Context) map[string]error { return kafka.ClosePull() }},
+		{name: "kafka publish", call: func(ctx context.Context) map[string]error { return kafka.ClosePublish() }},
+		{name: "tiered cache", call: func(ctx context.Context) map[string]error { cache.CloseTiered(); return nil }},
+		{name: "redis stream", call: func(ctx context.Context) map[string]error { return single(cache.CloseStream()) }},
+		{name: "redis", call: func(ctx context.Context) map[string]error { return cache.CloseRedis() }},
+		{name: "mongo", call: sqld.CloseMongo},
+		{name: "rdb", call: func(ctx context.Context) map[string]error { return sqld.CloseRDB() }},
+		{name: "tracing", call: func(ctx context.Context) map[string]error { return single(otelx.Shutdown(ctx)) }},
+	}
+}
+
+func runHooks(ctx context.Context) map[string]error {
+	hooksMu.Lock()
+	fns := make([]func(ctx context.Context) error, len(hooks))
+	copy(fns, hooks)
+	hooksMu.Unlock()
+	result := make(map[string]error, len(fns))
+	for i, fn := range fns {
+		result[utils.AnyToStr(i)] = fn(ctx)
+	}
+	return result
+}
+
+// Shutdown 按顺序停止服务并关闭数据源, 单步失败不影响后续步骤, 返回汇总错误, 重复调用返回首次结果
+func Shutdown(ctx context.Context) error {
+	once.Do(func() {
+		start := utils.UnixMilli()
+		var errs []error
+		for _, v := range steps() {
+			for k, err := range v.call(ctx) {
+				if err == nil {
+					continue
+				}
+				zlog.Error("shutdown step failed", 0, zlog.String("step", v.name), zlog.String("dsName", k), zlog.AddError(err))
+				errs = append(errs, utils.Error(v.name, " shutdown failed: ", err))
+			}
+		}
+		if len(errs) > 0 {
+			result = &utils.MultiError{Errors: errs}
+		}
+		zlog.Info("shutdown finished", start, zlog.Bool("ok", result == nil))
+		zlog.Close() // 最后关闭日志输出, 确保停机日志已发送
+	})
+	return result
+}
+
+// RunUntilSignal 阻塞至收到SIGINT/SIGTERM后执行Shutdown, timeout为整体停机时间, 默认30秒
+func RunUntilSignal(timeout ...time.Duration) error {
+	t := defaultShutdownTimeout
+	if len(timeout) > 0 && timeout[0] > 0 {
+		t = timeout[0]
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-ch
+	signal.Stop(ch)
+	zlog.Println("received signal, shutting down: ", sig.String())
+	ctx, cancel := context.WithTimeout(context.Background(), t)
+	defer cancel()
+	return Shutdown(ctx)
+}
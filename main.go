@@ -3,11 +3,15 @@ package main
 import (
 	"github.com/godaddy-x/freego/cache"
 	"github.com/godaddy-x/freego/cache/limiter"
+	"github.com/godaddy-x/freego/configx"
 	ballast "github.com/godaddy-x/freego/gc"
 	"github.com/godaddy-x/freego/node"
 	http_web "github.com/godaddy-x/freego/node/test"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/otelx"
 	"github.com/godaddy-x/freego/rpcx"
 	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
 	_ "go.uber.org/automaxprocs"
 	"net/http"
 	_ "net/http/pprof"
@@ -32,6 +36,55 @@ func initConsul() {
 	new(rpcx.ConsulManager).InitConfig(conf)
 }
 
+func initRegistry() {
+	conf := rpcx.RegistryConfig{}
+	if err := utils.ReadLocalJsonConfig("resource/registry.json", &conf); err != nil {
+		panic(utils.AddStr("读取注册中心配置失败: ", err.Error()))
+	}
+	rpcx.InitRegistry(conf)
+}
+
+func initTracing() {
+	if err := otelx.InitTracing("127.0.0.1:4318", otelx.TracingConfig{ServiceName: "freego", Insecure: true}); err != nil {
+		panic(utils.AddStr("初始化链路追踪失败: ", err.Error()))
+	}
+}
+
+// 配置中心热更新: 限流、模块日志级别、慢查询阈值变更后无需重启
+func initConfigCenter() {
+	conf := configx.Config{}
+	if err := utils.ReadLocalJsonConfig("resource/config.json", &conf); err != nil {
+		panic(utils.AddStr("读取配置中心配置失败: ", err.Error()))
+	}
+	if err := configx.InitConfig(conf); err != nil {
+		panic(utils.AddStr("初始化配置中心失败: ", err.Error()))
+	}
+	if err := configx.Bind("freego/ratelimit", func(value *node.RateLimitConfig) error {
+		node.SetRateLimitConfig(*value)
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+	if err := configx.Bind("freego/loglevel", func(value *map[string]string) error {
+		for k, v := range *value {
+			zlog.SetModuleLevel(k, v)
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+	if err := configx.Bind("freego/slowquery", func(value *map[string]int64) error {
+		for k, v := range *value {
+			if err := sqld.SetSlowQuery(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
 func initRedis() {
 	conf := cache.RedisConfig{}
 	if err := utils.ReadLocalJsonConfig("resource/redis.json", &conf); err != nil {
@@ -75,6 +128,8 @@ func initGRPC() {
 
 func init() {
 	//initConsul()
+	//initTracing()
+	//initConfigCenter()
 	//initRedis()
 	//initGRPC()
 }
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/testx"
+	"testing"
+)
+
+// 集成测试依赖的MySQL/MongoDB/Redis由testx按需启动, 全部测试结束后销毁
+// 使用已有服务: FREEGO_TEST_MYSQL="root:123456@tcp(127.0.0.1:3306)/openwallet" go test -run TestMysql
+func TestMain(m *testing.M) {
+	testx.Main(m, testx.Config{Database: "openwallet", SyncSchema: true, Cache: cache.NewLocalCache(30, 2)})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/godaddy-x/freego/goquery"
 	"github.com/godaddy-x/freego/ormx/sqlc"
 	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/testx"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/utils/concurrent"
 	"github.com/godaddy-x/freego/utils/gauth"
@@ -78,6 +79,7 @@ func TestMongoIndex(t *testing.T) {
 }
 
 func TestMongoSave(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -100,6 +102,7 @@ func TestMongoSave(t *testing.T) {
 }
 
 func TestMongoUpdate(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -116,6 +119,7 @@ func TestMongoUpdate(t *testing.T) {
 }
 
 func TestMongoUpdateByCnd1(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -130,6 +134,7 @@ func TestMongoUpdateByCnd1(t *testing.T) {
 }
 
 func TestMongoDelete(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -141,6 +146,7 @@ func TestMongoDelete(t *testing.T) {
 }
 
 func TestMongoAgg(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -151,6 +157,7 @@ func TestMongoAgg(t *testing.T) {
 }
 
 func TestMongoCount(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -163,7 +170,22 @@ func TestMongoCount(t *testing.T) {
 	}
 }
 
+func TestMongoFindAggregate(t *testing.T) {
+	initMongoDB(t)
+	db, err := sqld.NewMongo()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var result []map[string]interface{}
+	if err := db.FindAggregate(sqlc.M(&OwWallet{}).Groupby("appID").Sum("utime", "total").Max("ctime").Agg(sqlc.CNT_, "*", "count").Desc("total"), &result); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(result)
+}
+
 func TestMongoFindList(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -183,6 +205,7 @@ func TestMongoFindList(t *testing.T) {
 }
 
 func TestMongoFindOne(t *testing.T) {
+	initMongoDB(t)
 	db, err := sqld.NewMongo()
 	if err != nil {
 		panic(err)
@@ -195,7 +218,32 @@ func TestMongoFindOne(t *testing.T) {
 	fmt.Println(o.Id.Hex())
 }
 
+// 单节点时secondaryPreferred回退到主节点, 资金写入要求多数节点确认
+func TestMongoReadPreference(t *testing.T) {
+	initMongoDB(t)
+	db, err := sqld.NewMongo(sqld.Option{ReadPref: "secondaryPreferred", WriteConcern: &sqld.WriteConcern{W: "majority", J: true, WTimeout: 5000}})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	o := &OwWallet{AppID: utils.NextSID(), WalletID: utils.NextSID()}
+	if err := db.Save(o); err != nil {
+		panic(err)
+	}
+	result := &OwWallet{}
+	if err := db.FindOne(sqlc.M().Eq("id", o.Id).ReadPreference("nearest"), result); err != nil {
+		panic(err)
+	}
+	if result.WalletID != o.WalletID {
+		t.Fatal("read preference query result invalid")
+	}
+	if _, err := db.Count(sqlc.M(&OwWallet{}).ReadPreference("primary", map[string]string{"region": "east"})); err == nil {
+		t.Fatal("primary read preference with tags should be rejected")
+	}
+}
+
 func TestMongoUpdateByCnd(t *testing.T) {
+	initMongoDB(t)
 	l := utils.UnixMilli()
 	db, err := sqld.NewMongo()
 	if err != nil {
@@ -213,6 +261,7 @@ func TestMongoUpdateByCnd(t *testing.T) {
 }
 
 func TestMongoTx(t *testing.T) {
+	initMongoDB(t)
 	err := sqld.UseTransaction(func(self *sqld.MGOManager) error {
 		o := OwWallet{
 			AppID:    utils.NextSID(),
@@ -232,6 +281,7 @@ func TestMongoTx(t *testing.T) {
 }
 
 func TestRedis(t *testing.T) {
+	testx.Redis(t)
 	client, err := new(cache.RedisManager).Client()
 	if err != nil {
 		fmt.Println(err.Error())
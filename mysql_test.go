@@ -1,19 +1,79 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/godaddy-x/freego/ormx/outbox"
 	"github.com/godaddy-x/freego/ormx/sqlc"
 	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/testx"
 	"github.com/godaddy-x/freego/utils"
 	"testing"
+	"time"
 )
 
 func init() {
 	initDriver()
+	sqld.ModelDriver(&OwWalletLog{})
+	sqld.RegisterSharding(&OwWalletLog{}, &sqld.HashSharding{Count: 4})
+	sqld.ModelDriver(&OwWalletSecret{})
+}
+
+// 加密存储钱包密钥
+type OwWalletSecret struct {
+	Id       int64  `json:"id" bson:"_id"`
+	WalletID string `json:"walletID" bson:"walletID"`
+	Password string `json:"password" bson:"password" encrypt:"aes-gcm"`
+	Keystore string `json:"keystore" bson:"keystore" encrypt:"aes-gcm" db:"TEXT"`
+	Mobile   string `json:"mobile" bson:"mobile" mask:"phone"`
+	Email    string `json:"email" bson:"email" mask:"email"`
+	Ctime    int64  `json:"ctime" bson:"ctime"`
+}
+
+func (o *OwWalletSecret) GetTable() string {
+	return "ow_wallet_secret"
+}
+
+func (o *OwWalletSecret) NewObject() sqlc.Object {
+	return &OwWalletSecret{}
+}
+
+func (o *OwWalletSecret) NewIndex() []sqlc.Index {
+	return nil
+}
+
+// 未设置创建时间时写入当前时间
+func (o *OwWalletSecret) BeforeSave(ctx context.Context) error {
+	if o.Ctime == 0 {
+		o.Ctime = utils.UnixMilli()
+	}
+	return nil
+}
+
+// 按walletID分表的流水, ow_wallet_log_00 ~ ow_wallet_log_03
+type OwWalletLog struct {
+	Id       int64  `json:"id" bson:"_id"`
+	WalletID int64  `json:"walletID" bson:"walletID" shard:"true"`
+	Amount   int64  `json:"amount" bson:"amount"`
+	Remark   string `json:"remark" bson:"remark"`
+	Ctime    int64  `json:"ctime" bson:"ctime" autotime:"create"`
+}
+
+func (o *OwWalletLog) GetTable() string {
+	return "ow_wallet_log"
+}
+
+func (o *OwWalletLog) NewObject() sqlc.Object {
+	return &OwWalletLog{}
+}
+
+func (o *OwWalletLog) NewIndex() []sqlc.Index {
+	return nil
 }
 
 func TestMysqlSave(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := sqld.NewMysql(sqld.Option{OpenTx: true, AutoID: true})
 	if err != nil {
 		panic(err)
@@ -34,7 +94,7 @@ func TestMysqlSave(t *testing.T) {
 }
 
 func TestMysqlUpdate(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: true})
 	if err != nil {
 		panic(err)
@@ -57,8 +117,31 @@ func TestMysqlUpdate(t *testing.T) {
 	fmt.Println("cost: ", utils.UnixMilli()-l)
 }
 
+func TestMysqlUpdateBatch(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var list []*OwWallet
+	if err := db.FindList(sqlc.M(&OwWallet{}).Orderby("id", sqlc.DESC_).Limit(1, 10), &list); err != nil {
+		panic(err)
+	}
+	var vs []sqlc.Object
+	for _, v := range list {
+		v.Utime = utils.UnixMilli()
+		vs = append(vs, v)
+	}
+	l := utils.UnixMilli()
+	if err := db.Update(vs...); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("cost: ", utils.UnixMilli()-l)
+}
+
 func TestMysqlUpdateByCnd(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: true})
 	if err != nil {
 		panic(err)
@@ -71,8 +154,140 @@ func TestMysqlUpdateByCnd(t *testing.T) {
 	fmt.Println("cost: ", utils.UnixMilli()-l)
 }
 
+func TestMysqlUpdateByCndExpr(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: true})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	l := utils.UnixMilli()
+	if _, err := db.UpdateByCnd(sqlc.M(&OwWallet{}).UpsetExpr("utime", "utime + ?", 1).Eq("id", 1649040212178763776).Raw("ctime > ? - ?", utils.UnixMilli(), 3600000)); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("cost: ", utils.UnixMilli()-l)
+}
+
+func TestMysqlTransaction(t *testing.T) {
+	initMysqlDB(t)
+	err := sqld.UseMysqlTransaction(func(db *sqld.RDBManager) error {
+		o := OwWallet{AppID: utils.NextSID(), WalletID: utils.NextSID()}
+		if err := db.Save(&o); err != nil {
+			return err
+		}
+		// 内层失败仅回滚到保存点, 外层保存的数据正常提交
+		if err := db.Transaction(func(db *sqld.RDBManager) error {
+			if err := db.Save(&OwWallet{AppID: utils.NextSID(), WalletID: utils.NextSID()}); err != nil {
+				return err
+			}
+			return utils.Error("test nested error")
+		}); err != nil {
+			fmt.Println(err)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestMysqlMongoOutbox(t *testing.T) {
+	initMysqlDB(t)
+	initMongoDB(t)
+	if err := sqld.EnableMongoOutbox(sqld.MongoOutboxConfig{Interval: 200}); err != nil {
+		panic(err)
+	}
+	defer sqld.StopMongoOutbox()
+	err := sqld.UseMysqlTransaction(func(db *sqld.RDBManager) error {
+		return db.Save(&OwWallet{AppID: utils.NextSID(), WalletID: utils.NextSID()})
+	}, sqld.Option{MongoSync: true})
+	if err != nil {
+		panic(err)
+	}
+	time.Sleep(time.Second)
+	fmt.Println(sqld.MongoOutboxStats())
+}
+
+func TestMysqlMessageOutbox(t *testing.T) {
+	initMysqlDB(t)
+	testx.RabbitMQ(t)
+	if err := outbox.Enable(outbox.Config{Publisher: outbox.RabbitMQ(""), Interval: 200}); err != nil {
+		panic(err)
+	}
+	defer outbox.Stop()
+	err := sqld.UseMysqlTransaction(func(db *sqld.RDBManager) error {
+		wallet := &OwWallet{AppID: utils.NextSID(), WalletID: utils.NextSID()}
+		if err := db.Save(wallet); err != nil {
+			return err
+		}
+		return outbox.Enqueue(db, exchange, queue, map[string]interface{}{"walletId": wallet.WalletID})
+	})
+	if err != nil {
+		panic(err)
+	}
+	time.Sleep(time.Second)
+	fmt.Println(outbox.Stats())
+}
+
+func TestMysqlSlowQueryHook(t *testing.T) {
+	initMysqlDB(t)
+	sqld.RegisterSlowQueryHook(func(sql string, args []interface{}, took time.Duration) {
+		fmt.Println("slow query: ", sql, args, took)
+	})
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var result []*OwWallet
+	if err := db.FindList(sqlc.M(&OwWallet{}).Limit(1, 100), &result); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func TestMysqlSharding(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	for i := int64(1); i <= 8; i++ {
+		if err := db.Save(&OwWalletLog{WalletID: i, Amount: i * 100, Ctime: utils.UnixMilli()}); err != nil {
+			fmt.Println(err)
+		}
+	}
+	var one []*OwWalletLog
+	if err := db.FindList(sqlc.M(&OwWalletLog{}).Eq("walletID", 3), &one); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("shard result: ", len(one))
+	cnd := sqlc.M(&OwWalletLog{}).Orderby("amount", sqlc.DESC_).Limit(2, 3)
+	var all []*OwWalletLog
+	if err := db.FindList(cnd, &all); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("scatter result: ", len(all), cnd.Pagination.PageTotal, cnd.Pagination.PageCount)
+}
+
+func TestMysqlFindListT(t *testing.T) {
+	initMysqlDB(t)
+	one, err := sqld.FindOneT[OwWallet](sqlc.M().Orderby("id", sqlc.DESC_))
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(one)
+	list, err := sqld.FindListT[OwWallet](sqlc.M().Orderby("id", sqlc.DESC_).Limit(1, 5))
+	if err != nil {
+		fmt.Println(err)
+	}
+	for _, v := range list {
+		fmt.Println(v.Id, v.AppID)
+	}
+}
+
 func TestMysqlDelete(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: true})
 	if err != nil {
 		panic(err)
@@ -93,7 +308,7 @@ func TestMysqlDelete(t *testing.T) {
 }
 
 func TestMysqlFindById(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get()
 	if err != nil {
 		panic(err)
@@ -110,7 +325,7 @@ func TestMysqlFindById(t *testing.T) {
 }
 
 func TestMysqlFindOne(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := sqld.NewMysql()
 	if err != nil {
 		panic(err)
@@ -123,7 +338,7 @@ func TestMysqlFindOne(t *testing.T) {
 }
 
 func TestMysqlDeleteById(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := sqld.NewMysql()
 	if err != nil {
 		panic(err)
@@ -137,7 +352,7 @@ func TestMysqlDeleteById(t *testing.T) {
 }
 
 func TestMysqlFindList(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: false})
 	if err != nil {
 		panic(err)
@@ -151,8 +366,43 @@ func TestMysqlFindList(t *testing.T) {
 	fmt.Println("cost: ", utils.UnixMilli()-l)
 }
 
+func TestMysqlFindListNested(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: false})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var result []*OwWallet
+	cnd := sqlc.M(&OwWallet{}).Eq("appID", "123456789").Or(func(c *sqlc.Cnd) {
+		c.Gt("ctime", 0).And(func(c *sqlc.Cnd) {
+			c.Eq("isTrust", 1)
+		}, func(c *sqlc.Cnd) {
+			c.Or(sqlc.M().Eq("passwordType", 1), sqlc.M().Eq("passwordType", 2))
+		})
+	}, sqlc.M().Eq("id", 1109996130134917121))
+	if err := db.FindList(cnd.Limit(1, 5), &result); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(len(result))
+}
+
+func TestMysqlFindAggregate(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: false})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var result []map[string]interface{}
+	if err := db.FindAggregate(sqlc.M(&OwWallet{}).Groupby("appID").Sum("utime", "total").Max("ctime").Agg(sqlc.CNT_, "*", "count").Desc("total"), &result); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(result)
+}
+
 func TestMysqlFindListComplex(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: false})
 	if err != nil {
 		panic(err)
@@ -167,7 +417,7 @@ func TestMysqlFindListComplex(t *testing.T) {
 }
 
 func TestMysqlFindOneComplex(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: false})
 	if err != nil {
 		panic(err)
@@ -182,7 +432,7 @@ func TestMysqlFindOneComplex(t *testing.T) {
 }
 
 func TestMysqlCount(t *testing.T) {
-	initMysqlDB()
+	initMysqlDB(t)
 	db, err := new(sqld.MysqlManager).Get(sqld.Option{OpenTx: false})
 	if err != nil {
 		panic(err)
@@ -196,3 +446,204 @@ func TestMysqlCount(t *testing.T) {
 	}
 	fmt.Println("cost: ", utils.UnixMilli()-l)
 }
+
+func TestOrderedStringID(t *testing.T) {
+	prevULID, prevUUID := "", ""
+	for i := 0; i < 10000; i++ {
+		ulid, uuid := utils.NextULID(), utils.NextUUIDv7()
+		if ulid <= prevULID || uuid <= prevUUID {
+			panic("ordered id not increasing")
+		}
+		prevULID, prevUUID = ulid, uuid
+	}
+	fmt.Println(prevULID, prevUUID)
+}
+
+func TestMysqlFieldEncrypt(t *testing.T) {
+	initMysqlDB(t)
+	sqld.SetFieldKeyProvider(utils.FuncKeyProvider(func() (string, error) {
+		return "123456789012345678901234567890", nil // 实际应从KMS获取
+	}))
+	if _, err := sqld.SyncSchema(sqld.SchemaOption{Tables: []string{"ow_wallet_secret"}}); err != nil {
+		panic(err)
+	}
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	secret := &OwWalletSecret{WalletID: utils.NextSID(), Password: "123456", Keystore: `{"key":"value"}`, Ctime: utils.UnixMilli()}
+	if err := db.Save(secret); err != nil {
+		panic(err)
+	}
+	result := &OwWalletSecret{}
+	if err := db.FindOne(sqlc.M().Eq("id", secret.Id), result); err != nil {
+		panic(err)
+	}
+	if result.Password != secret.Password || result.Keystore != secret.Keystore {
+		panic("field decrypt failed")
+	}
+	fmt.Println(result)
+}
+
+func TestMysqlFieldMask(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	secret := &OwWalletSecret{WalletID: utils.NextSID(), Mobile: "13800138000", Email: "test@example.com", Ctime: utils.UnixMilli()}
+	if err := db.Save(secret); err != nil {
+		panic(err)
+	}
+	var result []*OwWalletSecret
+	if err := db.FindList(sqlc.M(&OwWalletSecret{}).Eq("id", secret.Id).Masked(), &result); err != nil {
+		panic(err)
+	}
+	for _, v := range result {
+		fmt.Println(v.Mobile, v.Email) // 138****8000 t***@example.com
+	}
+}
+
+func TestMysqlAudit(t *testing.T) {
+	initMysqlDB(t)
+	if err := sqld.EnableAudit(sqld.AuditConfig{Models: []string{"ow_wallet"}, Interval: 200, BeforeImage: true}); err != nil {
+		panic(err)
+	}
+	defer sqld.StopAudit()
+	ctx := sqld.WithAuditUser(context.Background(), "admin")
+	err := sqld.UseMysqlTransactionContext(ctx, func(ctx context.Context, db *sqld.RDBManager) error {
+		wallet := &OwWallet{AppID: utils.NextSID(), WalletID: utils.NextSID(), Alias: "before"}
+		if err := db.Save(wallet); err != nil {
+			return err
+		}
+		wallet.Alias = "after"
+		return db.Update(wallet)
+	})
+	if err != nil {
+		panic(err)
+	}
+	time.Sleep(time.Second)
+	result, err := sqld.QueryAudit(sqld.AuditQuery{Model: "ow_wallet", User: "admin", Limit: 10})
+	if err != nil {
+		panic(err)
+	}
+	for _, v := range result {
+		fmt.Println(v.Action, v.RecordId, v.Diff)
+	}
+	fmt.Println(sqld.AuditStats())
+}
+
+func TestMysqlModelHook(t *testing.T) {
+	initMysqlDB(t)
+	err := sqld.UseMysqlTransaction(func(db *sqld.RDBManager) error {
+		secret := &OwWalletSecret{WalletID: utils.NextSID()}
+		if err := db.Save(secret); err != nil {
+			return err
+		}
+		fmt.Println(secret.Id, secret.Ctime)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestMysqlAutoTime(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	log := &OwWalletLog{WalletID: 1, Amount: 100}
+	if err := db.Save(log); err != nil {
+		panic(err)
+	}
+	fmt.Println(log.Id, log.Ctime)
+}
+
+func TestMysqlCndJson(t *testing.T) {
+	initMysqlDB(t)
+	bs, err := json.Marshal(sqlc.M(&OwWallet{}).Gt("id", 0).In("dealstate", 0, 1).Desc("id").Limit(1, 10))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(bs))
+	cnd, err := sqlc.ParseCnd(bs, &OwWallet{})
+	if err != nil {
+		panic(err)
+	}
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var result []*OwWallet
+	if err := db.FindList(cnd, &result); err != nil {
+		panic(err)
+	}
+	fmt.Println(len(result), cnd.Pagination.PageTotal)
+}
+
+func TestMysqlKeyset(t *testing.T) {
+	initMysqlDB(t)
+	db, err := new(sqld.MysqlManager).Get()
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	cursor := ""
+	for i := 0; i < 3; i++ {
+		var result []*OwWallet
+		cnd := sqlc.M(&OwWallet{}).Desc("ctime").After(cursor, 10)
+		if err := db.FindList(cnd, &result); err != nil {
+			panic(err)
+		}
+		fmt.Println(len(result), cnd.Pagination.NextCursor)
+		if cursor = cnd.Pagination.NextCursor; len(cursor) == 0 {
+			break
+		}
+	}
+}
+
+func TestMysqlSqlGuard(t *testing.T) {
+	initMysqlDB(t)
+	if err := sqld.CheckComplexCnd(sqlc.M(&OwWallet{}).Fields("count(a.id) as `id`").From("ow_wallet a").Orderby("a.id", sqlc.DESC_)); err != nil {
+		panic(err)
+	}
+	invalid := []*sqlc.Cnd{
+		sqlc.M(&OwWallet{}).Fields("a.id").From("ow_wallet a; drop table ow_wallet"),
+		sqlc.M(&OwWallet{}).Fields("a.id").From("ow_wallet a").Join(sqlc.LEFT_, "ow_wallet b", "a.id = b.id or sleep(5)"),
+		sqlc.M(&OwWallet{}).Fields("a.id").From("ow_wallet a").Join(sqlc.LEFT_, "ow_wallet b", "a.id = b.id and b.alias = 'x'"),
+		sqlc.M(&OwWallet{}).Fields("a.notExist").From("ow_wallet a"),
+	}
+	for _, v := range invalid {
+		if err := sqld.CheckComplexCnd(v); err == nil {
+			panic("sql guard check should fail")
+		} else {
+			fmt.Println(err)
+		}
+	}
+	fmt.Println(sqld.QuoteIdent("a.id"))
+}
+
+func TestMysqlQueryKiller(t *testing.T) {
+	initMysqlDB(t)
+	if err := sqld.StartQueryKiller(sqld.QueryKillerConfig{Factor: 1, Interval: 1000, Kill: true}); err != nil {
+		panic(err)
+	}
+	defer sqld.StopQueryKiller()
+	db, err := new(sqld.MysqlManager).Get(sqld.Option{Timeout: 1000})
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+	var result []*OwWallet
+	if err := db.FindList(sqlc.M(&OwWallet{}).Raw("sleep(5) = 0").Limit(1, 1), &result); err != nil {
+		fmt.Println(err)
+	}
+	time.Sleep(3 * time.Second)
+	fmt.Println(sqld.QueryStats())
+}
@@ -0,0 +1,36 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/zlog"
+	"time"
+)
+
+var accessLogger *zlog.AccessLogger
+
+// UseAccessLog 开启访问日志, 记录耗时、状态码、用户ID及trace_id, 需在StartServer前调用
+func UseAccessLog(config zlog.AccessLogConfig) {
+	accessLogger = zlog.NewAccessLogger(config)
+	zlog.Printf("add access log successful")
+}
+
+func (self *Context) writeAccessLog(start time.Time, err error) {
+	if accessLogger == nil {
+		return
+	}
+	trace, _ := zlog.TraceFromContext(self.Context())
+	body := self.JsonBody.RawData()
+	if body == nil && !self.RequestCtx.Request.IsBodyStream() { // 流式请求体可能未通过长度校验, 不读取
+		body = self.RequestCtx.PostBody()
+	}
+	accessLogger.Log(zlog.AccessEntry{
+		Method:  self.Method,
+		Path:    self.Path,
+		Status:  self.RequestCtx.Response.StatusCode(),
+		Latency: time.Since(start),
+		IP:      self.RemoteIP(),
+		UserId:  self.Subject.Payload.Sub,
+		TraceId: trace,
+		Body:    body,
+		Error:   err,
+	})
+}
@@ -0,0 +1,288 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"github.com/godaddy-x/freego/amqp"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/node"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/rpcx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"net/http"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+)
+
+const (
+	defaultPrefix = "/admin"
+	TokenHeader   = "X-Admin-Token"
+	masked        = "******"
+)
+
+var (
+	sensitiveKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|key|credential)`)
+	flags        = sync.Map{}
+)
+
+// Config 运行时管理端点配置
+type Config struct {
+	Prefix   string                        // 路由前缀, 默认/admin
+	Token    string                        // 访问令牌, 请求头X-Admin-Token, 必填
+	AllowIPs []string                      // 允许访问的IP, 为空则不限制
+	Settings func() interface{}            // 当前配置, 输出时对密码/密钥等字段脱敏
+	Cache    node.CacheAware               // 缓存统计数据源, 为空则不输出
+	Extra    map[string]func() interface{} // 自定义统计项, GET {prefix}/extra
+}
+
+// Flag 获取功能开关状态, 未设置时返回def
+func Flag(name string, def bool) bool {
+	if v, b := flags.Load(name); b {
+		return v.(bool)
+	}
+	return def
+}
+
+// SetFlag 设置功能开关
+func SetFlag(name string, enabled bool) {
+	flags.Store(name, enabled)
+}
+
+// Flags 获取所有功能开关
+func Flags() map[string]bool {
+	result := map[string]bool{}
+	flags.Range(func(key, value interface{}) bool {
+		result[key.(string)] = value.(bool)
+		return true
+	})
+	return result
+}
+
+type manager struct {
+	conf Config
+}
+
+// Register 在HTTP节点注册受保护的/admin管理端点
+func Register(httpNode *node.HttpNode, conf Config) {
+	if len(conf.Token) == 0 {
+		panic("admin token is nil")
+	}
+	if len(conf.Prefix) == 0 {
+		conf.Prefix = defaultPrefix
+	}
+	m := &manager{conf: conf}
+	routes := []struct {
+		method string
+		path   string
+		handle func(ctx *node.Context) error
+	}{
+		{node.GET, "/config", m.settings},
+		{node.GET, "/datasource", m.datasource},
+		{node.GET, "/cache", m.cache},
+		{node.GET, "/limiter", m.limiter},
+		{node.GET, "/consumer", m.consumer},
+		{node.GET, "/index", m.index},
+		{node.GET, "/runtime", m.runtime},
+		{node.GET, "/pprof/goroutine", m.profile("goroutine")},
+		{node.GET, "/pprof/heap", m.profile("heap")},
+		{node.GET, "/log/level", m.getLevel},
+		{node.POST, "/log/level", m.setLevel},
+		{node.GET, "/flags", m.getFlags},
+		{node.POST, "/flags", m.setFlag},
+		{node.POST, "/jwt/rotate", m.rotateJwt},
+		{node.GET, "/extra", m.extra},
+	}
+	for _, v := range routes {
+		handle := m.protect(v.handle)
+		config := &node.RouterConfig{Guest: true}
+		if v.method == node.POST {
+			httpNode.POST(conf.Prefix+v.path, handle, config)
+		} else {
+			httpNode.GET(conf.Prefix+v.path, handle, config)
+		}
+	}
+}
+
+func (self *manager) protect(handle func(ctx *node.Context) error) func(ctx *node.Context) error {
+	return func(ctx *node.Context) error {
+		if len(self.conf.AllowIPs) > 0 && !utils.CheckStr(ctx.RemoteIP(), self.conf.AllowIPs...) {
+			return ex.Throw{Code: http.StatusForbidden, Msg: "admin access denied"}
+		}
+		token := ctx.RequestCtx.Request.Header.Peek(TokenHeader)
+		if subtle.ConstantTimeCompare(token, utils.Str2Bytes(self.conf.Token)) != 1 {
+			return ex.Throw{Code: http.StatusUnauthorized, Msg: "admin token invalid"}
+		}
+		return handle(ctx)
+	}
+}
+
+func (self *manager) settings(ctx *node.Context) error {
+	if self.conf.Settings == nil {
+		return ctx.Json(nil)
+	}
+	bs, err := utils.JsonMarshal(self.conf.Settings())
+	if err != nil {
+		return ex.Throw{Code: http.StatusInternalServerError, Msg: "admin config marshal failed", Err: err}
+	}
+	var data interface{}
+	if err := utils.JsonUnmarshal(bs, &data); err != nil {
+		return ex.Throw{Code: http.StatusInternalServerError, Msg: "admin config unmarshal failed", Err: err}
+	}
+	return ctx.Json(mask(data))
+}
+
+// mask 对键名包含password/secret/token/key等的字段值脱敏
+func mask(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if sensitiveKey.MatchString(k) {
+				if s, b := item.(string); b && len(s) == 0 {
+					continue
+				}
+				v[k] = masked
+				continue
+			}
+			v[k] = mask(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mask(item)
+		}
+	}
+	return data
+}
+
+func (self *manager) datasource(ctx *node.Context) error {
+	return ctx.Json(map[string]interface{}{
+		"mysql": sqld.RDBStats(),
+		"redis": cache.RedisStats(),
+	})
+}
+
+func (self *manager) cache(ctx *node.Context) error {
+	if self.conf.Cache == nil {
+		return ctx.Json(nil)
+	}
+	c, err := self.conf.Cache()
+	if err != nil {
+		return err
+	}
+	size, err := c.Size()
+	if err != nil {
+		return err
+	}
+	return ctx.Json(map[string]interface{}{"size": size})
+}
+
+func (self *manager) limiter(ctx *node.Context) error {
+	return ctx.Json(node.GetLimiterStats())
+}
+
+func (self *manager) consumer(ctx *node.Context) error {
+	return ctx.Json(rabbitmq.GetConsumerLag())
+}
+
+func (self *manager) index(ctx *node.Context) error {
+	return ctx.Json(sqld.GetMongoIndexProgress())
+}
+
+func (self *manager) runtime(ctx *node.Context) error {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return ctx.Json(map[string]interface{}{
+		"goroutines":  runtime.NumGoroutine(),
+		"heapAlloc":   mem.HeapAlloc,
+		"heapInuse":   mem.HeapInuse,
+		"heapObjects": mem.HeapObjects,
+		"numGC":       mem.NumGC,
+		"pauseTotal":  mem.PauseTotalNs,
+	})
+}
+
+func (self *manager) profile(name string) func(ctx *node.Context) error {
+	return func(ctx *node.Context) error {
+		p := pprof.Lookup(name)
+		if p == nil {
+			return ex.Throw{Code: http.StatusNotFound, Msg: "profile not found"}
+		}
+		buf := bytes.Buffer{}
+		if err := p.WriteTo(&buf, 1); err != nil {
+			return ex.Throw{Code: http.StatusInternalServerError, Msg: "profile write failed", Err: err}
+		}
+		return ctx.Text(buf.String())
+	}
+}
+
+func (self *manager) getLevel(ctx *node.Context) error {
+	return ctx.Json(map[string]interface{}{"level": zlog.GetLevelName(), "modules": zlog.GetModuleLevels()})
+}
+
+// module为空时调整全局级别, 调整模块级别时level为空则移除该模块级别
+func (self *manager) setLevel(ctx *node.Context) error {
+	req := struct {
+		Module string `json:"module"`
+		Level  string `json:"level"`
+	}{}
+	if err := ctx.JsonBody.ParseData(&req); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "parameters invalid", Err: err}
+	}
+	if (len(req.Module) == 0 || len(req.Level) > 0) && !utils.CheckStr(req.Level, zlog.DEBUG, zlog.INFO, zlog.WARN, zlog.ERROR, zlog.FATAL) {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "log level invalid"}
+	}
+	zlog.SetModuleLevel(req.Module, req.Level)
+	zlog.Warn("admin log level changed", 0, zlog.String("module", req.Module), zlog.String("level", req.Level), zlog.String("ip", ctx.RemoteIP()))
+	return self.getLevel(ctx)
+}
+
+func (self *manager) getFlags(ctx *node.Context) error {
+	return ctx.Json(Flags())
+}
+
+func (self *manager) setFlag(ctx *node.Context) error {
+	req := struct {
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+	}{}
+	if err := ctx.JsonBody.ParseData(&req); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "parameters invalid", Err: err}
+	}
+	if len(req.Name) == 0 {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "flag name is nil"}
+	}
+	SetFlag(req.Name, req.Enabled)
+	zlog.Warn("admin feature flag changed", 0, zlog.String("name", req.Name), zlog.Bool("enabled", req.Enabled), zlog.String("ip", ctx.RemoteIP()))
+	return ctx.Json(Flags())
+}
+
+// 轮换gRPC HS256签发密钥, 旧密钥签发的token在overlap秒内继续有效, 多实例部署需逐个实例调用
+func (self *manager) rotateJwt(ctx *node.Context) error {
+	req := struct {
+		Kid     string `json:"kid"`
+		Key     string `json:"key"`
+		Overlap int64  `json:"overlap"`
+	}{}
+	if err := ctx.JsonBody.ParseData(&req); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "parameters invalid", Err: err}
+	}
+	if len(req.Kid) == 0 || len(req.Key) == 0 {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "jwt kid or key is nil"}
+	}
+	if err := new(rpcx.GRPCManager).RotateJwtKey(req.Kid, req.Key, req.Overlap); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "jwt key rotate failed", Err: err}
+	}
+	zlog.Warn("admin jwt key rotated", 0, zlog.String("kid", req.Kid), zlog.Int64("overlap", req.Overlap), zlog.String("ip", ctx.RemoteIP()))
+	return ctx.Json(map[string]interface{}{"kid": req.Kid, "overlap": req.Overlap})
+}
+
+func (self *manager) extra(ctx *node.Context) error {
+	result := make(map[string]interface{}, len(self.conf.Extra))
+	for k, v := range self.conf.Extra {
+		result[k] = v()
+	}
+	return ctx.Json(result)
+}
@@ -0,0 +1,28 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/utils/certx"
+	"github.com/godaddy-x/freego/zlog"
+)
+
+// UseACME 通过ACME自动申请及续期证书并以HTTPS提供服务, 适用于公网域名, 需在StartServer前调用
+// 未设置HttpAddr时通过TLS-ALPN-01验证, 服务需监听443端口
+func (self *HttpNode) UseACME(config certx.AcmeConfig) {
+	if self.tlsConfig != nil {
+		panic("http tls has been set")
+	}
+	tlsConfig := certx.NewAcme(config).ServerTLS("http-server")
+	// fasthttp不支持HTTP/2, 仅保留http/1.1及ACME验证协议
+	tlsConfig.NextProtos = []string{"http/1.1", "acme-tls/1"}
+	self.tlsConfig = tlsConfig
+	zlog.Printf("http acme tls %v has been set successful", config.Domains)
+}
+
+// UseSPIFFE 通过SPIFFE workload API获取证书并以mTLS提供服务, 按SPIFFE ID/信任域校验客户端, 需在StartServer前调用
+func (self *HttpNode) UseSPIFFE(config certx.SpiffeConfig) {
+	if self.tlsConfig != nil {
+		panic("http tls has been set")
+	}
+	self.tlsConfig = certx.NewSpiffe(config).ServerTLS("http-server")
+	zlog.Printf("http spiffe tls has been set successful")
+}
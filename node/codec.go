@@ -0,0 +1,326 @@
+package node
+
+import (
+	"bytes"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/valyala/fasthttp"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 请求/响应体编码协商, 按Content-Type选择请求编码, 按Accept的q权重选择响应编码, 未匹配时请求使用JSON, 响应与请求一致
+// 设置View/PublicID的路由仅以JSON响应(序列化视图仅支持JSON), Accept仅接受其他已注册编码时返回406
+// 编码仅替换信封及业务数据的序列化方式, 签名及加密规则不变: d仍为Base64/AES字符串, 签名内容为path+d+n+t+p
+// protobuf信封字段: 请求 1:d 2:t 3:n 4:p 5:s, 响应 1:c 2:m 3:e(map) 4:d 5:t 6:n 7:p 8:s, 业务数据须为proto.Message且不填充BaseReq
+// msgpack按json标签序列化, 与JSON字段名一致
+
+const (
+	APPLICATION_PROTOBUF = "application/x-protobuf"
+	APPLICATION_MSGPACK  = "application/x-msgpack"
+)
+
+// Codec 请求/响应体编码
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)        // 业务数据序列化
+	Unmarshal(data []byte, v interface{}) error   // 业务数据反序列化
+	DecodeBody(data []byte, body *JsonBody) error // 请求信封解析
+	EncodeResp(resp *JsonResp) ([]byte, error)    // 响应信封序列化
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{
+		"application/json":     jsonCodec{},
+		APPLICATION_PROTOBUF:   protobufCodec{},
+		"application/protobuf": protobufCodec{},
+		APPLICATION_MSGPACK:    msgpackCodec{},
+		"application/msgpack":  msgpackCodec{},
+	}
+)
+
+// RegisterCodec 注册自定义编码, mediaType如application/cbor, 已存在时覆盖
+func RegisterCodec(mediaType string, codec Codec) {
+	if len(mediaType) == 0 || codec == nil {
+		panic("codec media type/codec is nil")
+	}
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[strings.ToLower(mediaType)] = codec
+}
+
+func getCodec(mediaType string) Codec {
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	return codecs[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// 按请求头协商请求及响应编码, jsonOnly时响应仅使用JSON, 不可接受JSON时响应编码返回nil
+func negotiateCodec(request *fasthttp.RequestCtx, jsonOnly bool) (Codec, Codec) {
+	var codec Codec = jsonCodec{}
+	if v := getCodec(utils.Bytes2Str(request.Request.Header.ContentType())); v != nil {
+		codec = v
+	}
+	matched := false
+	for _, v := range parseAccept(utils.Bytes2Str(request.Request.Header.Peek("Accept"))) {
+		if jsonOnly && (v == "*/*" || v == "application/*") {
+			return codec, jsonCodec{}
+		}
+		c := getCodec(v)
+		if c == nil {
+			continue
+		}
+		if !jsonOnly {
+			return codec, c
+		}
+		if _, b := c.(jsonCodec); b {
+			return codec, c
+		}
+		matched = true
+	}
+	if jsonOnly {
+		if matched {
+			return codec, nil
+		}
+		return codec, jsonCodec{}
+	}
+	return codec, codec
+}
+
+// 解析Accept媒体类型, 按q权重降序, 权重相同保持原顺序, 忽略q=0
+func parseAccept(accept string) []string {
+	if len(accept) == 0 {
+		return nil
+	}
+	type media struct {
+		name string
+		q    float64
+	}
+	var list []media
+	for _, v := range strings.Split(accept, ",") {
+		parts := strings.Split(v, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(name) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, media{name: name, q: q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+	result := make([]string, len(list))
+	for i, v := range list {
+		result[i] = v.name
+	}
+	return result
+}
+
+func (self *Context) requestCodec() Codec {
+	if self.codec == nil {
+		return jsonCodec{}
+	}
+	return self.codec
+}
+
+func (self *Context) responseCodec() Codec {
+	if self.accept == nil {
+		return jsonCodec{}
+	}
+	return self.accept
+}
+
+func (self *Context) parseData(dst interface{}) error {
+	codec := self.requestCodec()
+	if _, b := codec.(jsonCodec); b {
+		return self.JsonBody.ParseData(dst)
+	}
+	raw := self.JsonBody.RawData()
+	if raw == nil {
+		return utils.Error("jsonBody data not bytes")
+	}
+	return codec.Unmarshal(raw, dst)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return APPLICATION_JSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return utils.JsonMarshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return utils.JsonUnmarshal(data, v)
+}
+
+func (jsonCodec) DecodeBody(data []byte, body *JsonBody) error {
+	body.Data = utils.GetJsonString(data, "d")
+	body.Time = utils.GetJsonInt64(data, "t")
+	body.Nonce = utils.GetJsonString(data, "n")
+	body.Plan = utils.GetJsonInt64(data, "p")
+	body.Sign = utils.GetJsonString(data, "s")
+	return nil
+}
+
+func (jsonCodec) EncodeResp(resp *JsonResp) ([]byte, error) {
+	return utils.JsonMarshal(resp)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return APPLICATION_MSGPACK
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func (self msgpackCodec) DecodeBody(data []byte, body *JsonBody) error {
+	if err := self.Unmarshal(data, body); err != nil {
+		return err
+	}
+	if _, b := body.Data.(string); !b {
+		body.Data = ""
+	}
+	return nil
+}
+
+func (self msgpackCodec) EncodeResp(resp *JsonResp) ([]byte, error) {
+	return self.Marshal(resp)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return APPLICATION_PROTOBUF
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, b := v.(proto.Message)
+	if !b {
+		return nil, utils.Error("protobuf codec data must be proto.Message")
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, b := v.(proto.Message)
+	if !b {
+		return utils.Error("protobuf codec data must be proto.Message")
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func (protobufCodec) DecodeBody(data []byte, body *JsonBody) error {
+	body.Data = ""
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch {
+		case typ == protowire.BytesType && (num == 1 || num == 3 || num == 5):
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch num {
+			case 1:
+				body.Data = string(v)
+			case 3:
+				body.Nonce = string(v)
+			case 5:
+				body.Sign = string(v)
+			}
+		case typ == protowire.VarintType && (num == 2 || num == 4):
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			if num == 2 {
+				body.Time = int64(v)
+			} else {
+				body.Plan = int64(v)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
+
+func (protobufCodec) EncodeResp(resp *JsonResp) ([]byte, error) {
+	var b []byte
+	appendString := func(num protowire.Number, v string) {
+		if len(v) > 0 {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	appendVarint := func(num protowire.Number, v int64) {
+		if v != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	}
+	appendVarint(1, int64(resp.Code))
+	appendString(2, resp.Message)
+	for k, v := range resp.Meta {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	if v, ok := resp.Data.(string); ok {
+		appendString(4, v)
+	}
+	appendVarint(5, resp.Time)
+	appendString(6, resp.Nonce)
+	appendVarint(7, resp.Plan)
+	appendString(8, resp.Sign)
+	return b, nil
+}
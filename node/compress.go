@@ -0,0 +1,146 @@
+package node
+
+import (
+	"bytes"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// 响应压缩及请求体大小限制
+// UseCompress启用后按Accept-Encoding优先br其次gzip压缩响应体, 仅压缩不小于MinSize的文本/JSON/msgpack/protobuf响应, 流式响应及已设置Content-Encoding的响应不处理
+// RouterConfig.MaxBodySize设置单路由请求体上限, 超出时返回413, 未设置时默认4MB
+// 服务端仅预读requestBodyPrefetch长度请求体, 超出部分按流读取, 读取前按路由上限校验Content-Length, 未声明长度时按上限读取
+
+type CompressConfig struct {
+	MinSize     int // 最小压缩长度/字节, 默认1024
+	GzipLevel   int // gzip压缩等级1-9, 默认6
+	BrotliLevel int // brotli压缩等级1-11, 默认4
+	DisableBr   bool
+}
+
+var (
+	compressMu     sync.Mutex
+	compressConfig *CompressConfig
+	compressTypes  = []string{"text/", "application/json", "application/javascript", "application/xml", APPLICATION_MSGPACK, APPLICATION_PROTOBUF}
+)
+
+// UseCompress 启用响应压缩, 需在StartServer前调用
+func UseCompress(config CompressConfig) {
+	if config.MinSize <= 0 {
+		config.MinSize = 1024
+	}
+	if config.GzipLevel <= 0 || config.GzipLevel > 9 {
+		config.GzipLevel = fasthttp.CompressDefaultCompression
+	}
+	if config.BrotliLevel <= 0 || config.BrotliLevel > 11 {
+		config.BrotliLevel = fasthttp.CompressBrotliDefaultCompression
+	}
+	compressMu.Lock()
+	defer compressMu.Unlock()
+	compressConfig = &config
+	zlog.Printf("add response compress successful")
+}
+
+func compressible(contentType []byte) bool {
+	s := strings.ToLower(string(contentType))
+	for _, v := range compressTypes {
+		if strings.HasPrefix(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// 包装路由处理, 已启用压缩时按Accept-Encoding压缩响应体
+func compressHandler(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	compressMu.Lock()
+	config := compressConfig
+	compressMu.Unlock()
+	if config == nil {
+		return handler
+	}
+	return func(request *fasthttp.RequestCtx) {
+		handler(request)
+		resp := &request.Response
+		if request.IsHead() || resp.IsBodyStream() || len(resp.Header.Peek(fasthttp.HeaderContentEncoding)) > 0 {
+			return
+		}
+		if code := resp.StatusCode(); code == http.StatusNoContent || code == http.StatusNotModified {
+			return
+		}
+		body := resp.Body()
+		if len(body) < config.MinSize || !compressible(resp.Header.ContentType()) {
+			return
+		}
+		resp.Header.Add(fasthttp.HeaderVary, "Accept-Encoding")
+		if !config.DisableBr && request.Request.Header.HasAcceptEncoding("br") {
+			resp.SetBodyRaw(fasthttp.AppendBrotliBytesLevel(nil, body, config.BrotliLevel))
+			resp.Header.Set(fasthttp.HeaderContentEncoding, "br")
+		} else if request.Request.Header.HasAcceptEncoding("gzip") {
+			resp.SetBodyRaw(fasthttp.AppendGzipBytesLevel(nil, body, config.GzipLevel))
+			resp.Header.Set(fasthttp.HeaderContentEncoding, "gzip")
+		}
+	}
+}
+
+// 服务端预读请求体长度/字节, 超出部分由路由校验长度后读取
+const requestBodyPrefetch = 64 * 1024
+
+// 校验单路由请求体长度, 须在读取请求体前调用, 优先使用RouterConfig.MaxBodySize, 未设置时按def限制, def为0时按默认4MB限制
+func (self *Context) validBodySize(def int) error {
+	limit := self.RouterConfig.MaxBodySize
+	if limit <= 0 {
+		limit = def
+	}
+	if limit <= 0 {
+		limit = fasthttp.DefaultMaxRequestBodySize
+	}
+	request := &self.RequestCtx.Request
+	if request.Header.ContentLength() > limit {
+		return self.bodyTooLarge()
+	}
+	if !request.IsBodyStream() {
+		if len(request.Body()) > limit {
+			return self.bodyTooLarge()
+		}
+		return nil
+	}
+	if request.Header.ContentLength() >= 0 { // 已声明长度, 按长度读取
+		return nil
+	}
+	// 分块传输未声明长度, 按上限读取
+	body := &limitedBuffer{limit: limit}
+	if err := request.BodyWriteTo(body); err == errBodyTooLarge {
+		return self.bodyTooLarge()
+	} else if err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "body parameters read failed", Err: err}
+	}
+	request.SetBody(body.Bytes())
+	return nil
+}
+
+var errBodyTooLarge = utils.Error("body parameters length is too large")
+
+// 限制长度的请求体缓冲, 超出上限时中止读取
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (self *limitedBuffer) Write(p []byte) (int, error) {
+	if self.Len()+len(p) > self.limit {
+		return 0, errBodyTooLarge
+	}
+	return self.Buffer.Write(p)
+}
+
+// 请求体未读取完毕, 响应后关闭连接
+func (self *Context) bodyTooLarge() error {
+	self.RequestCtx.SetConnectionClose()
+	return ex.Throw{Code: http.StatusRequestEntityTooLarge, Msg: "body parameters length is too large"}
+}
@@ -17,6 +17,7 @@ const (
 	SessionFilterName            = "SessionFilter"
 	UserRateLimiterFilterName    = "UserRateLimiterFilter"
 	RoleFilterName               = "RoleFilter"
+	PermissionFilterName         = "PermissionFilter"
 	PostHandleFilterName         = "PostHandleFilter"
 	RenderHandleFilterName       = "RenderHandleFilter"
 )
@@ -27,6 +28,7 @@ var filterMap = map[string]*FilterObject{
 	SessionFilterName:            {Name: SessionFilterName, Order: -80, Filter: &SessionFilter{}},
 	UserRateLimiterFilterName:    {Name: UserRateLimiterFilterName, Order: -70, Filter: &UserRateLimiterFilter{}},
 	RoleFilterName:               {Name: RoleFilterName, Order: -60, Filter: &RoleFilter{}},
+	PermissionFilterName:         {Name: PermissionFilterName, Order: -55, Filter: &PermissionFilter{}},
 	PostHandleFilterName:         {Name: PostHandleFilterName, Order: math.MaxInt, Filter: &PostHandleFilter{}},
 	RenderHandleFilterName:       {Name: RenderHandleFilterName, Order: math.MinInt, Filter: &RenderHandleFilter{}},
 }
@@ -44,6 +46,7 @@ func createFilterChain(extFilters []*FilterObject) ([]*FilterObject, error) {
 	for _, v := range filterMap {
 		extFilters = append(extFilters, v)
 	}
+	extFilters = append(extFilters, getMiddlewares()...)
 	for _, v := range extFilters {
 		for _, check := range fs {
 			if check.(*FilterObject).Name == v.Name {
@@ -119,6 +122,17 @@ func SetUserRateLimiter(option rate.Option) {
 	userRateLimiter = rate.NewRateLimiter(option)
 }
 
+// GetLimiterStats 获取网关/方法/用户限流器放行及拒绝计数, 未实现rate.StatRateLimiter的限流器不输出
+func GetLimiterStats() map[string]rate.Stat {
+	result := make(map[string]rate.Stat, 3)
+	for k, v := range map[string]rate.RateLimiter{"gateway": gatewayRateLimiter, "method": methodRateLimiter, "user": userRateLimiter} {
+		if stat, ok := rate.GetStats(v); ok {
+			result[k] = stat
+		}
+	}
+	return result
+}
+
 func (self *GatewayRateLimiterFilter) DoFilter(chain Filter, ctx *Context, args ...interface{}) error {
 	//if b := gatewayRateLimiter.Allow("HttpThreshold"); !b {
 	//	return ex.Throw{Code: 429, Msg: "the gateway request is full, please try again later"}
@@ -140,13 +154,19 @@ func (self *SessionFilter) DoFilter(chain Filter, ctx *Context, args ...interfac
 	if len(ctx.Subject.GetRawBytes()) == 0 {
 		return ex.Throw{Code: http.StatusUnauthorized, Msg: "token is nil"}
 	}
-	if err := ctx.Subject.Verify(utils.Bytes2Str(ctx.Subject.GetRawBytes()), ctx.GetJwtConfig().TokenKey, true); err != nil {
+	if err := ctx.Subject.VerifyConfig(utils.Bytes2Str(ctx.Subject.GetRawBytes()), ctx.GetJwtConfig(), true); err != nil {
 		return ex.Throw{Code: http.StatusUnauthorized, Msg: "token invalid or expired", Err: err}
 	}
+	if err := ctx.checkRevoked(); err != nil {
+		return err
+	}
 	return chain.DoFilter(chain, ctx, args...)
 }
 
 func (self *UserRateLimiterFilter) DoFilter(chain Filter, ctx *Context, args ...interface{}) error {
+	if err := checkRateLimit(ctx); err != nil {
+		return err
+	}
 	//if b := methodRateLimiter.Allow(ctx.Path); !b {
 	//	return ex.Throw{Code: 429, Msg: "the method request is full, please try again later"}
 	//}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"time"
+)
+
+// ProbeFunc 就绪检测, 返回是否就绪及检测详情, 详情按JSON输出
+type ProbeFunc func(ctx context.Context) (bool, interface{})
+
+const probeTimeout = 3 * time.Second
+
+// AddHealth 注册存活及就绪检测路由, 如/healthz和/readyz, 不经过过滤器链, 供Kubernetes探针使用
+// 存活检测固定返回200, 就绪检测在停机中或ready返回false时返回503, ready为空时仅检测停机状态, 路径为空时不注册
+func (self *HttpNode) AddHealth(livePath, readyPath string, ready ProbeFunc) {
+	if len(livePath) == 0 && len(readyPath) == 0 {
+		panic("health path is nil")
+	}
+	self.newRouter()
+	if len(livePath) > 0 {
+		self.Context.router.Handle(GET, livePath, func(ctx *fasthttp.RequestCtx) {
+			writeProbe(ctx, http.StatusOK, map[string]interface{}{"ok": true})
+		})
+		zlog.Printf("add health path [%s] successful", livePath)
+	}
+	if len(readyPath) > 0 {
+		self.Context.router.Handle(GET, readyPath, func(ctx *fasthttp.RequestCtx) {
+			if IsShuttingDown() {
+				writeProbe(ctx, http.StatusServiceUnavailable, map[string]interface{}{"ok": false, "error": "server is shutting down"})
+				return
+			}
+			if ready == nil {
+				writeProbe(ctx, http.StatusOK, map[string]interface{}{"ok": true})
+				return
+			}
+			c, cancel := context.WithTimeout(context.Background(), probeTimeout)
+			defer cancel()
+			ok, detail := ready(c)
+			if !ok {
+				writeProbe(ctx, http.StatusServiceUnavailable, detail)
+				return
+			}
+			writeProbe(ctx, http.StatusOK, detail)
+		})
+		zlog.Printf("add ready path [%s] successful", readyPath)
+	}
+}
+
+func writeProbe(ctx *fasthttp.RequestCtx, status int, detail interface{}) {
+	result, err := utils.JsonMarshal(detail)
+	if err != nil {
+		status = http.StatusInternalServerError
+		result = []byte(`{"ok":false}`)
+	}
+	ctx.SetContentType(APPLICATION_JSON)
+	ctx.SetStatusCode(status)
+	ctx.SetBody(result)
+}
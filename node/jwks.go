@@ -0,0 +1,32 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp"
+	"net/http"
+)
+
+// AddJWKS 注册JWKS公钥发布路由, 如/.well-known/jwks.json, 不经过过滤器链, 需先通过AddJwtConfig设置Keys
+func (self *HttpNode) AddJWKS(path string) {
+	if len(path) == 0 {
+		panic("jwks path is nil")
+	}
+	self.readyContext()
+	keys := self.Context.configs.jwtConfig.Keys
+	if keys == nil {
+		panic("jwt config keys is nil")
+	}
+	self.newRouter()
+	self.Context.router.Handle(GET, path, func(ctx *fasthttp.RequestCtx) {
+		result, err := keys.JWKS()
+		if err != nil {
+			zlog.Error("jwks marshal failed", 0, zlog.AddError(err))
+			ctx.SetStatusCode(http.StatusInternalServerError)
+			return
+		}
+		ctx.Response.Header.Set("Cache-Control", "public, max-age=300")
+		ctx.SetContentType(APPLICATION_JSON)
+		ctx.SetBody(result)
+	})
+	zlog.Printf("add jwks path [%s] successful", path)
+}
@@ -0,0 +1,29 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"time"
+)
+
+const unknownPath = "unknown"
+
+// AddMetrics 注册Prometheus指标输出路由, 如/metrics, 不经过过滤器链, 生产环境应限制内网访问
+func (self *HttpNode) AddMetrics(path string) {
+	if len(path) == 0 {
+		panic("metrics path is nil")
+	}
+	self.newRouter()
+	self.Context.router.Handle(GET, path, fasthttpadaptor.NewFastHTTPHandler(promx.Handler()))
+	zlog.Printf("add metrics path [%s] successful", path)
+}
+
+// 记录请求耗时及响应状态, 未注册的路由路径统一为unknown避免指标膨胀
+func (self *Context) observe(start time.Time) {
+	path := self.Path
+	if self.RouterConfig == nil {
+		path = unknownPath
+	}
+	promx.ObserveHTTP(self.Method, path, self.RequestCtx.Response.StatusCode(), time.Since(start))
+}
@@ -0,0 +1,173 @@
+package node
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+const (
+	RecoveryFilterOrder = math.MinInt + 1 // 仅次于RenderHandleFilter, panic转换为错误后统一渲染
+	CORSFilterOrder     = -110            // 先于网关限流执行
+)
+
+// Middleware 中间件函数, 调用next执行后续过滤器及业务处理, 不调用则中断请求
+type Middleware func(ctx *Context, next func() error) error
+
+type middlewareFilter struct {
+	fn Middleware
+}
+
+func (self *middlewareFilter) DoFilter(chain Filter, ctx *Context, args ...interface{}) error {
+	return self.fn(ctx, func() error {
+		return chain.DoFilter(chain, ctx, args...)
+	})
+}
+
+var (
+	middlewareMu sync.Mutex
+	middlewares  []*FilterObject
+	corsConfig   *CORSConfig
+)
+
+// UseFilter 注册全局中间件, order越小越先执行, pattern为匹配的URL(为空则匹配全部), 需在StartServer前调用
+func UseFilter(order int, fn func(ctx *Context, next func() error) error, pattern ...string) {
+	if fn == nil {
+		panic("middleware function is nil")
+	}
+	if order == math.MinInt || order == math.MaxInt {
+		panic("middleware order is reserved by built-in filter")
+	}
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	name := fmt.Sprintf("UseFilter#%d", len(middlewares)+1)
+	middlewares = append(middlewares, &FilterObject{Name: name, Order: order, Filter: &middlewareFilter{fn: fn}, MatchPattern: pattern})
+	zlog.Printf("add filter [%s] successful", name)
+}
+
+func getMiddlewares() []*FilterObject {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	return append([]*FilterObject{}, middlewares...)
+}
+
+// Recovery 捕获后续过滤器及业务处理的panic, 记录堆栈并返回500错误
+func Recovery(ctx *Context, next func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Error("[Recovery] request panic", 0, zlog.String("path", ctx.Path), zlog.Any("error", r), zlog.String("stack", utils.Bytes2Str(debug.Stack())))
+			err = ex.Throw{Code: http.StatusInternalServerError, Msg: "server internal error", Err: utils.Error("panic: ", r)}
+		}
+	}()
+	return next()
+}
+
+// UseRecovery 注册panic恢复中间件
+func UseRecovery() {
+	UseFilter(RecoveryFilterOrder, Recovery)
+}
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	AllowOrigins     []string // 允许的来源, *为全部
+	AllowMethods     []string // 默认GET,POST,PUT,DELETE,OPTIONS
+	AllowHeaders     []string // 默认Content-Type,Authorization
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           int // 预检结果缓存时间/秒
+}
+
+func (self *CORSConfig) allowOrigin(origin string) string {
+	for _, v := range self.AllowOrigins {
+		if v == "*" {
+			if self.AllowCredentials {
+				return origin // 携带凭证时不允许返回*
+			}
+			return "*"
+		}
+		if strings.EqualFold(v, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// 设置跨域响应头, 来源不允许时返回false
+func (self *CORSConfig) setHeader(request *fasthttp.RequestCtx, preflight bool) bool {
+	origin := utils.Bytes2Str(request.Request.Header.Peek("Origin"))
+	if len(origin) == 0 {
+		return false
+	}
+	allow := self.allowOrigin(origin)
+	if len(allow) == 0 {
+		return false
+	}
+	header := &request.Response.Header
+	header.Set("Access-Control-Allow-Origin", allow)
+	if allow != "*" {
+		header.Add("Vary", "Origin")
+	}
+	if self.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if len(self.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(self.ExposeHeaders, ","))
+		}
+		return true
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(self.AllowMethods, ","))
+	header.Set("Access-Control-Allow-Headers", strings.Join(self.AllowHeaders, ","))
+	if self.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", utils.AnyToStr(self.MaxAge))
+	}
+	return true
+}
+
+// UseCORS 注册跨域中间件, 预检请求(OPTIONS)在路由前直接响应
+func UseCORS(config CORSConfig) {
+	if len(config.AllowOrigins) == 0 {
+		panic("cors allow origins is nil")
+	}
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = []string{GET, POST, PUT, DELETE, OPTIONS}
+	}
+	if len(config.AllowHeaders) == 0 {
+		config.AllowHeaders = []string{"Content-Type", "Authorization"}
+	}
+	middlewareMu.Lock()
+	corsConfig = &config
+	middlewareMu.Unlock()
+	UseFilter(CORSFilterOrder, func(ctx *Context, next func() error) error {
+		config.setHeader(ctx.RequestCtx, false)
+		return next()
+	})
+}
+
+// 包装路由处理, 已注册跨域时拦截预检请求
+func corsHandler(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	middlewareMu.Lock()
+	config := corsConfig
+	middlewareMu.Unlock()
+	if config == nil {
+		return handler
+	}
+	return func(request *fasthttp.RequestCtx) {
+		if !request.IsOptions() || len(request.Request.Header.Peek("Access-Control-Request-Method")) == 0 {
+			handler(request)
+			return
+		}
+		if config.setHeader(request, true) {
+			request.SetStatusCode(http.StatusNoContent)
+		} else {
+			request.SetStatusCode(http.StatusForbidden)
+		}
+	}
+}
@@ -2,15 +2,19 @@ package node
 
 import (
 	"bytes"
+	"context"
 	"github.com/buaazp/fasthttprouter"
 	"github.com/godaddy-x/freego/cache"
 	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/ex/errorsx"
 	"github.com/godaddy-x/freego/node/common"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/utils/crypto"
 	"github.com/godaddy-x/freego/utils/jwt"
+	"github.com/godaddy-x/freego/utils/valid"
 	"github.com/godaddy-x/freego/zlog"
 	"github.com/valyala/fasthttp"
+	"google.golang.org/protobuf/proto"
 	"net/http"
 	"strings"
 	"unsafe"
@@ -52,14 +56,28 @@ type Configs struct {
 	routerConfigs map[string]*RouterConfig
 	langConfigs   map[string]map[string]string
 	defaultLang   string
+	tokenStore    TokenStore
+	refreshConfig RefreshConfig
+	permResolver  PermissionResolver
 }
 
 type RouterConfig struct {
 	Guest  bool // 游客模式,原始请求 false.否 true.是
 	UseRSA bool // 非登录状态使用RSA模式请求 false.否 true.是
 	//UseHAX      bool // 非登录状态,判定公钥哈希验签 false.否 true.是
-	AesRequest  bool // 请求是否必须AES加密 false.否 true.是
-	AesResponse bool // 响应是否必须AES加密 false.否 true.是
+	AesRequest  bool     // 请求是否必须AES加密 false.否 true.是
+	AesResponse bool     // 响应是否必须AES加密 false.否 true.是
+	View        string   // 响应数据序列化视图, 按字段view标签过滤输出, 为空则输出全部字段
+	PublicID    bool     // 响应数据public_id标签字段是否混淆输出, 设置View时默认混淆
+	Doc         *ApiDoc  // 接口文档描述, 用于生成OpenAPI文档
+	Perms       []string // 所需权限, 如wallet:write, 需设置PermissionResolver
+	PermAny     bool     // true.满足任一权限即可 false.需满足全部权限
+	// 文件上传路由, 仅此类路由接受multipart请求, 非游客模式需在表单body字段提交签名信封, 业务数据files字段为各文件SHA256
+	Upload bool
+	// 请求体最大长度/字节, 超出返回413, 为0时安全请求按MAX_VALUE_LEN限制, 游客及文件上传请求按4MB限制
+	MaxBodySize int
+	// 错误响应按错误码映射HTTP状态码, 默认仅游客模式映射, 信封接口保持200由响应体c字段区分
+	HttpStatus bool
 }
 
 type HttpLog struct {
@@ -79,13 +97,14 @@ type JsonBody struct {
 }
 
 type JsonResp struct {
-	Code    int         `json:"c"`
-	Message string      `json:"m"`
-	Data    interface{} `json:"d"`
-	Time    int64       `json:"t"`
-	Nonce   string      `json:"n"`
-	Plan    int64       `json:"p"`
-	Sign    string      `json:"s"`
+	Code    int               `json:"c"`
+	Message string            `json:"m"`
+	Meta    map[string]string `json:"e,omitempty"` // 业务错误元数据
+	Data    interface{}       `json:"d"`
+	Time    int64             `json:"t"`
+	Nonce   string            `json:"n"`
+	Plan    int64             `json:"p"`
+	Sign    string            `json:"s"`
 }
 
 type Permission struct {
@@ -123,6 +142,10 @@ type Context struct {
 	postHandle    PostHandle
 	errorHandle   ErrorHandle
 	Encipher      *EncipherClient
+	traceCtx      context.Context
+	codec         Codec             // 请求体编码
+	accept        Codec             // 响应体编码
+	uploadHashes  map[string]string // 已签名的上传文件哈希, 表单字段 -> SHA256
 }
 
 type Response struct {
@@ -132,6 +155,7 @@ type Response struct {
 	// response result
 	StatusCode        int
 	ContentEntityByte bytes.Buffer
+	streamed          bool // 响应已由ServeFile直接输出
 }
 
 func (self *JsonBody) ParseData(dst interface{}) error {
@@ -203,11 +227,17 @@ func (self *Context) Parser(dst interface{}) error {
 	if self.JsonBody == nil || self.JsonBody.Data == nil {
 		return nil
 	}
-	if err := self.JsonBody.ParseData(dst); err != nil {
+	if err := self.parseData(dst); err != nil {
 		msg := "JSON parameter parsing failed"
 		zlog.Error(msg, 0, zlog.String("path", self.Path), zlog.String("device", self.ClientDevice()), zlog.Any("data", self.JsonBody), zlog.AddError(err))
 		return ex.Throw{Msg: msg, Err: err}
 	}
+	if err := valid.Validate(dst); err != nil {
+		return validError(err)
+	}
+	if _, b := dst.(proto.Message); b { // protobuf消息无BaseReq, 不填充上下文
+		return nil
+	}
 	// TODO 备注: 已有会话状态时,指针填充context值,不能随意修改指针偏移值
 	identify := &common.Identify{}
 	if self.Authenticated() {
@@ -235,6 +265,19 @@ func (self *Context) Parser(dst interface{}) error {
 	return nil
 }
 
+// 参数校验失败返回400, 错误元数据按字段输出全部失败项
+func validError(err error) error {
+	errs, ok := err.(valid.Errors)
+	if !ok { // 校验标签无效, 属于服务端定义错误
+		return ex.Throw{Code: http.StatusInternalServerError, Msg: "request validation rule invalid", Err: err}
+	}
+	result := errorsx.New(http.StatusBadRequest, "request parameters invalid").Wrap(err)
+	for _, v := range errs {
+		result = result.WithMetadata(v.Field, v.Msg)
+	}
+	return result
+}
+
 func (self *Context) ClientDevice() string {
 	agent := utils.Bytes2Str(self.RequestCtx.Request.Header.Peek("User-Agent"))
 	if utils.HasStr(agent, "Android") || utils.HasStr(agent, "Adr") {
@@ -251,12 +294,32 @@ func (self *Context) ClientLanguage() string {
 }
 
 func (self *Context) readParams() error {
+	if self.accept == nil {
+		return ex.Throw{Code: http.StatusNotAcceptable, Msg: "response view only supports json"}
+	}
 	if self.Method != POST {
+		if !self.RouterConfig.Guest { // GET等请求(如文件下载)仅读取会话
+			auth := self.RequestCtx.Request.Header.Peek(Authorization)
+			if len(auth) > MAX_TOKEN_LEN {
+				return ex.Throw{Code: http.StatusBadRequest, Msg: "authorization parameters length is too long"}
+			}
+			self.Subject.ResetTokenBytes(auth)
+		}
 		return nil
 	}
-	body := self.RequestCtx.PostBody()
+	multipart := isMultipart(self.RequestCtx)
+	if multipart && !self.RouterConfig.Upload {
+		return ex.Throw{Code: http.StatusUnsupportedMediaType, Msg: "multipart request not allowed"}
+	}
 	// 原始请求模式
 	if self.RouterConfig.Guest {
+		if err := self.validBodySize(0); err != nil {
+			return err
+		}
+		if multipart { // 文件由SaveUploadFile读取
+			return nil
+		}
+		body := self.RequestCtx.PostBody()
 		if body == nil || len(body) == 0 {
 			return nil
 		}
@@ -270,17 +333,19 @@ func (self *Context) readParams() error {
 	}
 	self.Subject.ResetTokenBytes(auth)
 	//self.Subject.ResetTokenBytes(self.RequestCtx.Request.Header.Peek(Authorization))
+	if multipart { // 文件上传请求, 签名信封位于表单body字段, 文件由SaveUploadFile校验哈希后读取
+		return self.readUploadParams()
+	}
+	if err := self.validBodySize(MAX_VALUE_LEN); err != nil {
+		return err
+	}
+	body := self.RequestCtx.PostBody()
 	if body == nil || len(body) == 0 {
 		return ex.Throw{Code: http.StatusBadRequest, Msg: "body parameters is nil"}
 	}
-	if len(body) > (MAX_VALUE_LEN) {
-		return ex.Throw{Code: http.StatusLengthRequired, Msg: "body parameters length is too long"}
+	if err := self.requestCodec().DecodeBody(body, self.JsonBody); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "body parameters decode failed", Err: err}
 	}
-	self.JsonBody.Data = utils.GetJsonString(body, "d")
-	self.JsonBody.Time = utils.GetJsonInt64(body, "t")
-	self.JsonBody.Nonce = utils.GetJsonString(body, "n")
-	self.JsonBody.Plan = utils.GetJsonInt64(body, "p")
-	self.JsonBody.Sign = utils.GetJsonString(body, "s")
 	//if err := utils.JsonUnmarshal(body, self.JsonBody); err != nil {
 	//	panic(err)
 	//}
@@ -326,7 +391,11 @@ func (self *Context) validJsonBody() error {
 	if body.Time <= 0 {
 		return ex.Throw{Code: http.StatusBadRequest, Msg: "request time must be > 0"}
 	}
-	if utils.MathAbs(utils.UnixSecond()-body.Time) > jwt.FIVE_MINUTES { // 判断绝对时间差超过5分钟
+	window := jwt.FIVE_MINUTES // 开启防重放时按其时间窗口校验, 否则默认5分钟
+	if replayGuard != nil {
+		window = replayGuard.Window()
+	}
+	if utils.MathAbs(utils.UnixSecond()-body.Time) > window {
 		return ex.Throw{Code: http.StatusBadRequest, Msg: "request time invalid"}
 	}
 	if self.RouterConfig.AesRequest && body.Plan != 1 {
@@ -381,7 +450,11 @@ func (self *Context) validJsonBody() error {
 		}
 	}
 
-	if err := self.validReplayAttack(body.Sign); err != nil {
+	if replayGuard != nil {
+		if err := self.validReplayNonce(body.Nonce, body.Time); err != nil {
+			return err
+		}
+	} else if err := self.validReplayAttack(body.Sign); err != nil {
 		return err
 	}
 
@@ -526,6 +599,9 @@ func (self *Context) reset(ctx *Context, handle PostHandle, request *fasthttp.Re
 	self.RouterConfig = self.configs.routerConfigs[self.Path]
 	self.postCompleted = false
 	self.filterChain.pos = 0
+	self.traceCtx = nil
+	self.codec, self.accept = negotiateCodec(request, self.RouterConfig != nil && (len(self.RouterConfig.View) > 0 || self.RouterConfig.PublicID))
+	self.uploadHashes = nil
 	self.resetJsonBody()
 	self.resetResponse()
 	self.resetSubject()
@@ -564,6 +640,7 @@ func (self *Context) resetResponse() {
 	}
 	self.Response.ContentEntity = nil
 	self.Response.StatusCode = 0
+	self.Response.streamed = false
 	if self.Response.ContentEntityByte.Len() > 0 {
 		self.Response.ContentEntityByte.Reset()
 	}
@@ -597,6 +674,28 @@ func (self *Context) Json(data interface{}) error {
 	return nil
 }
 
+// JsonView 按视图输出响应数据, 优先于RouterConfig.View
+func (self *Context) JsonView(data interface{}, view string) error {
+	if data == nil {
+		return self.Json(nil)
+	}
+	return self.Json(utils.NewView(data, view))
+}
+
+// 按路由配置包装响应数据的序列化视图
+func viewEntity(routerConfig *RouterConfig, data interface{}) interface{} {
+	if _, b := data.(*utils.ViewEntity); b {
+		return data
+	}
+	if len(routerConfig.View) > 0 {
+		return utils.NewView(data, routerConfig.View)
+	}
+	if routerConfig.PublicID {
+		return utils.NewView(data, utils.ViewAll)
+	}
+	return data
+}
+
 func (self *Context) Text(data string) error {
 	self.Response.ContentType = TEXT_PLAIN
 	self.Response.ContentEntity = data
@@ -0,0 +1,274 @@
+package node
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/valyala/fasthttp"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	GridFSPrefix = "gridfs://" // GridFS存储路径前缀, 格式: gridfs://{bucket}/{文件名或文件ID}
+
+	defaultUploadSize = 10 << 20
+	uploadBodyField   = "body" // 上传请求签名信封表单字段
+)
+
+// UploadLimits 上传文件限制
+type UploadLimits struct {
+	MaxSize int64    // 单个文件最大字节, 默认10MB
+	Exts    []string // 允许的扩展名, 如.json, 为空则不限制
+}
+
+// UploadFile 已保存的上传文件
+type UploadFile struct {
+	Name        string // 原始文件名
+	Size        int64
+	ContentType string
+	Path        string // 本地路径或gridfs://{bucket}/{文件ID}
+}
+
+// FileStore gridfs://路径的文件存储, 由sqld.GridFSStore实现并通过SetFileStore注入, HTTP层无需依赖ORM
+type FileStore interface {
+	// Upload 流式上传文件, 返回文件ID
+	Upload(bucket, filename string, source io.Reader) (string, error)
+	// Open 打开文件流, 返回文件流/大小/文件名, 读取完成后需Close
+	Open(bucket, id string) (io.ReadCloser, int64, string, error)
+}
+
+var fileStore FileStore
+
+// SetFileStore 设置gridfs://路径的文件存储, 如 node.SetFileStore(sqld.GridFSStore{})
+func SetFileStore(store FileStore) {
+	fileStore = store
+}
+
+// 上传请求签名数据, 可与业务参数共用同一JSON
+type uploadMeta struct {
+	Files map[string]string `json:"files"` // 表单文件字段 -> 文件SHA256(hex)
+}
+
+func isMultipart(request *fasthttp.RequestCtx) bool {
+	return strings.HasPrefix(utils.Bytes2Str(request.Request.Header.ContentType()), "multipart/form-data")
+}
+
+// 上传请求参数, 表单body字段为JSON签名信封, 与普通请求一致校验签名/n/t/AES及重放, 业务数据files字段记录各文件哈希
+func (self *Context) readUploadParams() error {
+	if err := self.validBodySize(0); err != nil {
+		return err
+	}
+	form, err := self.RequestCtx.MultipartForm()
+	if err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "multipart form parse failed", Err: err}
+	}
+	values := form.Value[uploadBodyField]
+	if len(values) != 1 || len(values[0]) == 0 {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "body parameters is nil"}
+	}
+	if len(values[0]) > MAX_VALUE_LEN {
+		return ex.Throw{Code: http.StatusRequestEntityTooLarge, Msg: "body parameters length is too large"}
+	}
+	if err := (jsonCodec{}).DecodeBody(utils.Str2Bytes(values[0]), self.JsonBody); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "body parameters decode failed", Err: err}
+	}
+	if err := self.validJsonBody(); err != nil {
+		return err
+	}
+	meta := uploadMeta{}
+	if err := utils.JsonUnmarshal(self.JsonBody.RawData(), &meta); err != nil {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "upload file metadata invalid", Err: err}
+	}
+	if len(meta.Files) == 0 {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "upload file hash is nil"}
+	}
+	self.uploadHashes = meta.Files
+	return nil
+}
+
+func parseGridFS(path string) (string, string) {
+	path = strings.TrimPrefix(path, GridFSPrefix)
+	if index := strings.IndexByte(path, '/'); index >= 0 {
+		return path[:index], path[index+1:]
+	}
+	return "", path
+}
+
+// SaveUploadFile 保存multipart上传文件, dst为本地路径(以/结尾时为目录, 使用原始文件名)或gridfs://{bucket}/{文件名}
+func (self *Context) SaveUploadFile(field, dst string, limits UploadLimits) (*UploadFile, error) {
+	if self.RequestCtx == nil || !isMultipart(self.RequestCtx) {
+		return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "request is not multipart form"}
+	}
+	var hash string
+	if !self.RouterConfig.Guest { // 文件内容须与签名信封中的哈希一致
+		if hash = self.uploadHashes[field]; len(hash) == 0 {
+			return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "upload file hash not signed"}
+		}
+	}
+	header, err := self.RequestCtx.FormFile(field)
+	if err != nil {
+		return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "upload file not found", Err: err}
+	}
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = defaultUploadSize
+	}
+	if header.Size > limits.MaxSize {
+		return nil, ex.Throw{Code: http.StatusRequestEntityTooLarge, Msg: "upload file size too large"}
+	}
+	name := filepath.Base(header.Filename)
+	if len(limits.Exts) > 0 {
+		ext := filepath.Ext(name)
+		allow := false
+		for _, v := range limits.Exts {
+			if strings.EqualFold(v, ext) {
+				allow = true
+				break
+			}
+		}
+		if !allow {
+			return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "upload file type not allowed"}
+		}
+	}
+	src, err := header.Open()
+	if err != nil {
+		return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file open failed", Err: err}
+	}
+	defer src.Close()
+	if len(hash) > 0 {
+		h := sha256.New()
+		if _, err := io.Copy(h, io.LimitReader(src, limits.MaxSize)); err != nil {
+			return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file read failed", Err: err}
+		}
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), hash) {
+			return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "upload file hash invalid"}
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file read failed", Err: err}
+		}
+	}
+	result := &UploadFile{Name: name, Size: header.Size, ContentType: header.Header.Get("Content-Type")}
+	source := io.LimitReader(src, limits.MaxSize)
+	if strings.HasPrefix(dst, GridFSPrefix) {
+		bucket, filename := parseGridFS(dst)
+		if len(filename) == 0 {
+			filename = name
+		}
+		if fileStore == nil {
+			return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "file store is nil"}
+		}
+		id, err := fileStore.Upload(bucket, filename, source)
+		if err != nil {
+			return nil, err
+		}
+		result.Path = utils.AddStr(GridFSPrefix, bucket, "/", id)
+		return result, nil
+	}
+	if strings.HasSuffix(dst, "/") {
+		dst = filepath.Join(dst, name)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file directory create failed", Err: err}
+	}
+	tmp := utils.AddStr(dst, ".tmp")
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file create failed", Err: err}
+	}
+	if _, err := io.Copy(out, source); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file write failed", Err: err}
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file write failed", Err: err}
+	}
+	if err := os.Rename(tmp, dst); err != nil { // 写入完成后替换, 避免读取到不完整文件
+		os.Remove(tmp)
+		return nil, ex.Throw{Code: http.StatusInternalServerError, Msg: "upload file save failed", Err: err}
+	}
+	result.Path = dst
+	return result, nil
+}
+
+type fileStream struct {
+	io.Reader
+	io.Closer
+}
+
+// ServeFile 输出本地文件或gridfs://{bucket}/{文件ID}, 支持Range分段下载, name不为空时作为附件下载
+func (self *Context) ServeFile(path string, name ...string) error {
+	var reader io.ReadCloser
+	var size int64
+	filename := filepath.Base(path)
+	if strings.HasPrefix(path, GridFSPrefix) {
+		if fileStore == nil {
+			return ex.Throw{Code: http.StatusInternalServerError, Msg: "file store is nil"}
+		}
+		bucket, id := parseGridFS(path)
+		file, length, name, err := fileStore.Open(bucket, id)
+		if err != nil {
+			return ex.Throw{Code: http.StatusNotFound, Msg: "file not found", Err: err}
+		}
+		reader, size, filename = file, length, name
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return ex.Throw{Code: http.StatusNotFound, Msg: "file not found", Err: err}
+		}
+		stat, err := file.Stat()
+		if err != nil || stat.IsDir() {
+			file.Close()
+			return ex.Throw{Code: http.StatusNotFound, Msg: "file not found", Err: err}
+		}
+		reader, size = file, stat.Size()
+	}
+	if len(name) > 0 && len(name[0]) > 0 {
+		filename = name[0]
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	start, length := int64(0), size
+	status := http.StatusOK
+	if byteRange := self.RequestCtx.Request.Header.Peek("Range"); len(byteRange) > 0 && size > 0 {
+		startPos, endPos, err := fasthttp.ParseByteRange(byteRange, int(size))
+		if err != nil {
+			reader.Close()
+			self.RequestCtx.Response.Header.Set("Content-Range", utils.AddStr("bytes */", size))
+			return ex.Throw{Code: http.StatusRequestedRangeNotSatisfiable, Msg: "range invalid", Err: err}
+		}
+		start, length = int64(startPos), int64(endPos-startPos+1)
+		status = http.StatusPartialContent
+		self.RequestCtx.Response.Header.Set("Content-Range", utils.AddStr("bytes ", startPos, "-", endPos, "/", size))
+	}
+	if start > 0 {
+		if seeker, ok := reader.(io.Seeker); ok {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				reader.Close()
+				return ex.Throw{Code: http.StatusInternalServerError, Msg: "file seek failed", Err: err}
+			}
+		} else if skipper, ok := reader.(interface{ Skip(int64) (int64, error) }); ok { // GridFS文件流不支持Seek
+			if _, err := skipper.Skip(start); err != nil {
+				reader.Close()
+				return ex.Throw{Code: http.StatusInternalServerError, Msg: "file seek failed", Err: err}
+			}
+		}
+	}
+	if len(name) > 0 && len(name[0]) > 0 {
+		self.RequestCtx.Response.Header.Set("Content-Disposition", utils.AddStr(`attachment; filename="`, strings.ReplaceAll(filename, `"`, ""), `"`))
+	}
+	self.RequestCtx.Response.Header.Set("Accept-Ranges", "bytes")
+	self.RequestCtx.SetContentType(contentType)
+	self.RequestCtx.SetStatusCode(status)
+	self.RequestCtx.SetBodyStream(&fileStream{Reader: io.LimitReader(reader, length), Closer: reader}, int(length))
+	self.Response.streamed = true
+	return nil
+}
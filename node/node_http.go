@@ -1,15 +1,20 @@
 package node
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/buaazp/fasthttprouter"
 	"github.com/godaddy-x/freego/cache"
 	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/ex/errorsx"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/utils/crypto"
 	"github.com/godaddy-x/freego/utils/jwt"
+	"github.com/godaddy-x/freego/utils/valid"
 	"github.com/godaddy-x/freego/zlog"
 	"github.com/valyala/fasthttp"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -24,6 +29,13 @@ type HttpNode struct {
 	HookNode
 	mu      sync.Mutex
 	ctxPool sync.Pool
+	hub     WSHub
+	// 停机控制
+	server       *fasthttp.Server
+	shutdownWait time.Duration
+	stopped      chan struct{}
+	// UseACME/UseSPIFFE设置的TLS配置
+	tlsConfig *tls.Config
 }
 
 type PostHandle func(*Context) error
@@ -33,21 +45,30 @@ type ErrorHandle func(ctx *Context, throw ex.Throw) error
 func (self *HttpNode) doRequest(handle PostHandle, request *fasthttp.RequestCtx) error {
 	ctx := self.ctxPool.Get().(*Context)
 	ctx.reset(self.Context, handle, request, self.filters)
-	if err := ctx.filterChain.DoFilter(ctx.filterChain, ctx); err != nil {
-		self.ctxPool.Put(ctx)
-		return err
-	}
+	start := time.Now()
+	span := ctx.startSpan()
+	err := ctx.filterChain.DoFilter(ctx.filterChain, ctx)
+	ctx.endSpan(span, err)
+	ctx.observe(start)
+	ctx.writeAccessLog(start, err)
 	self.ctxPool.Put(ctx)
-	return nil
+	return err
 }
 
 func (self *HttpNode) proxy(handle PostHandle, ctx *fasthttp.RequestCtx) {
+	if !acquireRequest() {
+		rejectRequest(ctx)
+		return
+	}
+	defer releaseRequest()
 	if err := self.doRequest(handle, ctx); err != nil {
 		zlog.Error("doRequest failed", 0, zlog.AddError(err))
 	}
 }
 
+// StartServer 启动服务并阻塞至Shutdown完成, timeout为停机时等待处理中请求的最长时间/秒, 默认10
 func (self *HttpNode) StartServer(addr string, timeout ...int) {
+	self.stopped = make(chan struct{})
 	go func() {
 		if self.Context.CacheAware != nil {
 			zlog.Printf("cache service has been started successful")
@@ -67,16 +88,28 @@ func (self *HttpNode) StartServer(addr string, timeout ...int) {
 		if len(self.filters) == 0 {
 			panic("filter chain is nil")
 		}
-		zlog.Printf("http【%s】service has been started successful", addr)
 		t := 10
 		if timeout != nil {
 			t = timeout[0]
 		}
-		if err := fasthttp.Serve(NewGracefulListener(addr, time.Second*time.Duration(t)), self.Context.router.Handler); err != nil {
+		ln, err := net.Listen("tcp4", addr)
+		if err != nil {
 			panic(err)
 		}
+		if self.tlsConfig != nil {
+			ln = tls.NewListener(ln, self.tlsConfig)
+		}
+		self.server = &fasthttp.Server{Handler: compressHandler(corsHandler(self.Context.router.Handler)),
+			MaxRequestBodySize: requestBodyPrefetch, StreamRequestBody: true, DisablePreParseMultipartForm: true}
+		self.shutdownWait = time.Second * time.Duration(t)
+		addServerNode(self)
+		zlog.Printf("http【%s】service has been started successful", addr)
+		if err := self.server.Serve(ln); err != nil && !IsShuttingDown() {
+			panic(err)
+		}
+		close(self.stopped)
 	}()
-	select {}
+	<-self.stopped // 调用Shutdown后返回
 }
 
 func (self *HttpNode) checkContextReady(path string, routerConfig *RouterConfig) {
@@ -88,7 +121,13 @@ func (self *HttpNode) checkContextReady(path string, routerConfig *RouterConfig)
 }
 
 func (self *HttpNode) addRouter(method, path string, handle PostHandle, routerConfig *RouterConfig) {
+	if routerConfig != nil && routerConfig.Doc != nil { // 注册时解析请求模型校验标签, 标签无效时启动失败
+		if err := valid.Prepare(routerConfig.Doc.Request); err != nil {
+			panic(utils.AddStr("router [", path, "] ", err.Error()))
+		}
+	}
 	self.checkContextReady(path, routerConfig)
+	addApiRoute(method, path, self.Context.configs.routerConfigs[path])
 	self.Context.router.Handle(method, path, fasthttp.TimeoutHandler(
 		func(ctx *fasthttp.RequestCtx) {
 			self.proxy(handle, ctx)
@@ -254,6 +293,7 @@ func (self *HttpNode) AddJwtConfig(config jwt.JwtConfig) {
 	self.Context.configs.jwtConfig.TokenTyp = config.TokenTyp
 	self.Context.configs.jwtConfig.TokenKey = config.TokenKey
 	self.Context.configs.jwtConfig.TokenExp = config.TokenExp
+	self.Context.configs.jwtConfig.Keys = config.Keys
 }
 
 func (self *HttpNode) EnableECC(enable bool) {
@@ -324,14 +364,31 @@ func defaultRenderError(ctx *Context, err error) error {
 	if err == nil {
 		return nil
 	}
+	if ctx.Response.streamed { // 文件输出后出错, 改为输出错误信息
+		ctx.Response.streamed = false
+		ctx.RequestCtx.Response.ResetBody()
+		ctx.RequestCtx.Response.Header.Del("Content-Range")
+		ctx.RequestCtx.Response.Header.Del("Content-Disposition")
+	}
 	out := ex.Catch(err)
+	var target *errorsx.Error
+	errors.As(err, &target)
+	status := http.StatusOK // 业务异常码(>600)且非errorsx错误时保持200
+	if target != nil {
+		status = errorsx.HTTPStatus(out.Code)
+	} else if out.Code <= 600 {
+		status = out.Code
+	}
+	if status >= http.StatusInternalServerError { // 服务端错误记录原始错误及调用栈
+		zlog.Error("request failed", 0, zlog.String("path", ctx.Path), zlog.Int("code", out.Code), zlog.AddError(err))
+	}
 	if ctx.errorHandle != nil {
 		throw, ok := err.(ex.Throw)
 		if !ok {
 			throw = ex.Throw{Code: out.Code, Msg: out.Msg, Err: err, Arg: out.Arg}
 		}
-		if err = ctx.errorHandle(ctx, throw); err != nil {
-			zlog.Error("response error handle failed", 0, zlog.AddError(err))
+		if e := ctx.errorHandle(ctx, throw); e != nil {
+			zlog.Error("response error handle failed", 0, zlog.AddError(e))
 		}
 	}
 	resp := &JsonResp{
@@ -340,6 +397,12 @@ func defaultRenderError(ctx *Context, err error) error {
 		Time:    utils.UnixMilli(),
 		Nonce:   utils.RandNonce(),
 	}
+	if target != nil {
+		resp.Meta = target.Metadata
+	}
+	if ctx.RouterConfig.Guest || ctx.RouterConfig.HttpStatus { // 信封接口保持200, 由响应体c字段区分
+		ctx.Response.StatusCode = status
+	}
 	//if !ctx.Authenticated() {
 	//	resp.Nonce = utils.RandNonce()
 	//} else {
@@ -350,14 +413,12 @@ func defaultRenderError(ctx *Context, err error) error {
 	//	}
 	//}
 	if ctx.RouterConfig.Guest {
-		if out.Code <= 600 {
-			ctx.Response.StatusCode = out.Code
-		}
 		ctx.Response.ContentType = TEXT_PLAIN
 		ctx.Response.ContentEntityByte.Write(utils.Str2Bytes(resp.Message))
 		return nil
 	}
-	result, err := utils.JsonMarshal(resp)
+	codec := ctx.responseCodec()
+	result, err := codec.EncodeResp(resp)
 	if err != nil {
 		ctx.Response.ContentType = TEXT_PLAIN
 		ctx.Response.ContentEntityByte.Write(utils.Str2Bytes(err.Error()))
@@ -369,7 +430,14 @@ func defaultRenderError(ctx *Context, err error) error {
 }
 
 func defaultRenderTo(ctx *Context) error {
-	ctx.RequestCtx.SetContentType(ctx.Response.ContentType)
+	if ctx.Response.streamed {
+		return nil
+	}
+	if ctx.Response.ContentType == APPLICATION_JSON { // 按协商结果输出编码类型
+		ctx.RequestCtx.SetContentType(ctx.responseCodec().ContentType())
+	} else {
+		ctx.RequestCtx.SetContentType(ctx.Response.ContentType)
+	}
 	if ctx.Response.StatusCode == 0 {
 		ctx.RequestCtx.SetStatusCode(http.StatusOK)
 	} else {
@@ -382,6 +450,9 @@ func defaultRenderTo(ctx *Context) error {
 }
 
 func defaultRenderPre(ctx *Context) error {
+	if ctx.Response.streamed {
+		return nil
+	}
 	routerConfig, _ := ctx.configs.routerConfigs[ctx.Path]
 	switch ctx.Response.ContentType {
 	case TEXT_PLAIN:
@@ -395,15 +466,19 @@ func defaultRenderPre(ctx *Context) error {
 		if ctx.Response.ContentEntity == nil {
 			return ex.Throw{Code: http.StatusInternalServerError, Msg: "response ContentEntity is nil"}
 		}
+		codec := ctx.responseCodec()
+		if _, b := codec.(jsonCodec); b { // 序列化视图仅支持JSON, 设置视图的路由协商时已限定JSON响应
+			ctx.Response.ContentEntity = viewEntity(routerConfig, ctx.Response.ContentEntity)
+		}
 		if routerConfig.Guest {
-			if result, err := utils.JsonMarshal(ctx.Response.ContentEntity); err != nil {
+			if result, err := codec.Marshal(ctx.Response.ContentEntity); err != nil {
 				return ex.Throw{Code: http.StatusInternalServerError, Msg: "response JSON data failed", Err: err}
 			} else {
 				ctx.Response.ContentEntityByte.Write(result)
 			}
 			break
 		}
-		data, err := utils.JsonMarshal(ctx.Response.ContentEntity)
+		data, err := codec.Marshal(ctx.Response.ContentEntity)
 		if err != nil {
 			return ex.Throw{Code: http.StatusInternalServerError, Msg: "response conversion JSON failed", Err: err}
 		}
@@ -461,7 +536,7 @@ func defaultRenderPre(ctx *Context) error {
 				}
 			}
 		}
-		if result, err := utils.JsonMarshal(resp); err != nil {
+		if result, err := codec.EncodeResp(resp); err != nil {
 			return ex.Throw{Code: http.StatusInternalServerError, Msg: "response JSON data failed", Err: err}
 		} else {
 			ctx.Response.ContentEntityByte.Write(result)
@@ -69,6 +69,7 @@ func (self *WsServer) AddJwtConfig(config jwt.JwtConfig) {
 	self.Context.configs.jwtConfig.TokenTyp = config.TokenTyp
 	self.Context.configs.jwtConfig.TokenKey = config.TokenKey
 	self.Context.configs.jwtConfig.TokenExp = config.TokenExp
+	self.Context.configs.jwtConfig.Keys = config.Keys
 }
 
 func (self *WsServer) addRouterConfig(path string, routerConfig *RouterConfig) {
@@ -199,6 +200,7 @@ func wsRenderTo(ws *websocket.Conn, ctx *Context, data interface{}) error {
 		return nil
 	}
 	routerConfig, _ := ctx.configs.routerConfigs[ctx.Path]
+	data = viewEntity(routerConfig, data)
 	data, err := authReq(ctx.Path, data, ctx.GetTokenSecret(), routerConfig.AesResponse)
 	if err != nil {
 		return err
@@ -367,7 +369,7 @@ func (self *WsServer) wsHandler(path string, handle Handle) websocket.Handler {
 			_ = ctx.writeError(ws, ex.Throw{Code: http.StatusUnauthorized, Msg: "token is nil"})
 			return
 		}
-		if err := ctx.Subject.Verify(utils.Bytes2Str(ctx.Subject.GetRawBytes()), ctx.GetJwtConfig().TokenKey, true); err != nil {
+		if err := ctx.Subject.VerifyConfig(utils.Bytes2Str(ctx.Subject.GetRawBytes()), ctx.GetJwtConfig(), true); err != nil {
 			_ = ctx.writeError(ws, ex.Throw{Code: http.StatusUnauthorized, Msg: "token invalid or expired", Err: err})
 			return
 		}
@@ -0,0 +1,302 @@
+package node
+
+import (
+	"bufio"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// WSHooks websocket握手来源限制及连接生命周期回调
+type WSHooks struct {
+	OnConnect func(conn *WSConn) error      // 连接建立后执行, 返回错误则断开连接
+	OnClose   func(conn *WSConn, err error) // 连接断开后执行, 正常关闭时err为nil
+	// 允许握手的Origin, 如https://www.example.com, *为全部, 为空时仅允许同源, 未携带Origin的非浏览器客户端不受限制
+	AllowOrigins []string
+}
+
+// 校验握手来源, 防止跨站websocket劫持
+func (self *WSHooks) allowOrigin(request *fasthttp.RequestCtx) bool {
+	origin := utils.Bytes2Str(request.Request.Header.Peek("Origin"))
+	if len(origin) == 0 {
+		return true
+	}
+	for _, v := range self.AllowOrigins {
+		if v == "*" || strings.EqualFold(v, origin) {
+			return true
+		}
+	}
+	if len(self.AllowOrigins) > 0 {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, utils.Bytes2Str(request.Host()))
+}
+
+// WSHub 当前节点websocket连接集合, 用于按用户推送或广播
+type WSHub struct {
+	mu    sync.RWMutex
+	conns map[string]map[*WSConn]struct{} // sub -> conns
+}
+
+func (self *WSHub) add(conn *WSConn) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.conns == nil {
+		self.conns = make(map[string]map[*WSConn]struct{}, 64)
+	}
+	check, b := self.conns[conn.Sub]
+	if !b {
+		check = make(map[*WSConn]struct{}, 2)
+		self.conns[conn.Sub] = check
+	}
+	check[conn] = struct{}{}
+}
+
+func (self *WSHub) remove(conn *WSConn) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	check, b := self.conns[conn.Sub]
+	if !b {
+		return
+	}
+	delete(check, conn)
+	if len(check) == 0 {
+		delete(self.conns, conn.Sub)
+	}
+}
+
+func (self *WSHub) find(match func(conn *WSConn) bool, sub ...string) []*WSConn {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	var result []*WSConn
+	collect := func(check map[*WSConn]struct{}) {
+		for conn := range check {
+			if match == nil || match(conn) {
+				result = append(result, conn)
+			}
+		}
+	}
+	if len(sub) > 0 {
+		collect(self.conns[sub[0]])
+		return result
+	}
+	for _, check := range self.conns {
+		collect(check)
+	}
+	return result
+}
+
+func (self *WSHub) send(conns []*WSConn, data interface{}) (int, error) {
+	var err error
+	count := 0
+	for _, conn := range conns {
+		if e := conn.Send(data); e != nil {
+			zlog.Error("websocket push failed", 0, zlog.String("sub", conn.Sub), zlog.String("dev", conn.Dev), zlog.String("path", conn.Path), zlog.AddError(e))
+			conn.Close()
+			err = e
+			continue
+		}
+		count++
+	}
+	return count, err
+}
+
+// Send 推送消息至指定用户的连接, dev不为空时仅推送指定设备
+func (self *WSHub) Send(sub string, data interface{}, dev ...string) error {
+	conns := self.find(func(conn *WSConn) bool {
+		return len(dev) == 0 || utils.CheckStr(conn.Dev, dev...)
+	}, sub)
+	_, err := self.send(conns, data)
+	return err
+}
+
+// Broadcast 广播消息至全部连接, path不为空时仅推送指定路由的连接, 返回成功推送数量
+func (self *WSHub) Broadcast(data interface{}, path ...string) int {
+	conns := self.find(func(conn *WSConn) bool {
+		return len(path) == 0 || utils.CheckStr(conn.Path, path...)
+	})
+	count, _ := self.send(conns, data)
+	return count
+}
+
+// Count 当前连接数量
+func (self *WSHub) Count() int {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	count := 0
+	for _, check := range self.conns {
+		count += len(check)
+	}
+	return count
+}
+
+// Hub 获取websocket连接集合
+func (self *HttpNode) Hub() *WSHub {
+	return &self.hub
+}
+
+// AddWS 添加websocket路由, 握手时校验来源(WSHooks.AllowOrigins)、JWT及限流规则, 消息体与JSON接口一致校验签名并按规则限流
+func (self *HttpNode) AddWS(path string, handle Handle, routerConfig *RouterConfig, hooks ...WSHooks) {
+	if handle == nil {
+		panic("handle function is nil")
+	}
+	self.checkContextReady(path, routerConfig)
+	var hook WSHooks
+	if len(hooks) > 0 {
+		hook = hooks[0]
+	}
+	self.Context.router.Handle(GET, path, func(request *fasthttp.RequestCtx) {
+		self.upgradeWS(request, handle, hook)
+	})
+}
+
+func (self *HttpNode) upgradeWS(request *fasthttp.RequestCtx, handle Handle, hook WSHooks) {
+	ctx := self.ctxPool.New().(*Context)
+	ctx.reset(self.Context, nil, request, nil)
+	key := utils.Bytes2Str(request.Request.Header.Peek("Sec-WebSocket-Key"))
+	if !strings.EqualFold(utils.Bytes2Str(request.Request.Header.Peek("Upgrade")), "websocket") ||
+		!strings.Contains(strings.ToLower(utils.Bytes2Str(request.Request.Header.Peek("Connection"))), "upgrade") ||
+		utils.Bytes2Str(request.Request.Header.Peek("Sec-WebSocket-Version")) != "13" || len(key) == 0 {
+		_ = defaultRenderError(ctx, ex.Throw{Code: http.StatusBadRequest, Msg: "websocket handshake invalid"})
+		_ = defaultRenderTo(ctx)
+		return
+	}
+	if !hook.allowOrigin(request) {
+		_ = defaultRenderError(ctx, ex.Throw{Code: http.StatusForbidden, Msg: "websocket origin not allowed"})
+		_ = defaultRenderTo(ctx)
+		return
+	}
+	if err := ctx.authWS(); err != nil {
+		_ = defaultRenderError(ctx, err)
+		_ = defaultRenderTo(ctx)
+		return
+	}
+	conn := &WSConn{Sub: ctx.Subject.GetSub(), Dev: ctx.Subject.GetDev(), Path: ctx.Path, IP: ctx.RemoteIP(), Ctx: ctx, done: make(chan struct{})}
+	if len(conn.Dev) == 0 {
+		conn.Dev = "web"
+	}
+	request.Response.Header.Set("Upgrade", "websocket")
+	request.Response.Header.Set("Connection", "Upgrade")
+	request.Response.Header.Set("Sec-WebSocket-Accept", wsAcceptKey(key))
+	request.SetStatusCode(http.StatusSwitchingProtocols)
+	request.Hijack(func(c net.Conn) {
+		ctx.RequestCtx = nil // 握手请求已结束, 连接期间不可再访问
+		conn.conn = c
+		conn.reader = bufio.NewReader(c)
+		self.serveWS(conn, handle, hook)
+	})
+}
+
+// 握手认证, 游客模式跳过JWT校验, 浏览器无法设置请求头时可通过token参数传递
+func (self *Context) authWS() error {
+	if !self.RouterConfig.Guest {
+		auth := self.RequestCtx.Request.Header.Peek(Authorization)
+		if len(auth) == 0 {
+			auth = self.RequestCtx.QueryArgs().Peek("token")
+		}
+		if len(auth) > MAX_TOKEN_LEN {
+			return ex.Throw{Code: http.StatusBadRequest, Msg: "authorization parameters length is too long"}
+		}
+		if len(auth) == 0 {
+			return ex.Throw{Code: http.StatusUnauthorized, Msg: "token is nil"}
+		}
+		self.Subject.ResetTokenBytes(auth)
+		if err := self.Subject.VerifyConfig(utils.Bytes2Str(self.Subject.GetRawBytes()), self.GetJwtConfig(), true); err != nil {
+			return ex.Throw{Code: http.StatusUnauthorized, Msg: "token invalid or expired", Err: err}
+		}
+		if err := self.checkRevoked(); err != nil {
+			return err
+		}
+		if err := checkPermission(self); err != nil {
+			return err
+		}
+	}
+	return checkRateLimit(self)
+}
+
+// 读取消息体, 非游客模式校验签名并解密数据
+func (self *Context) readWSMessage(body []byte) ([]byte, error) {
+	self.resetJsonBody()
+	if len(body) == 0 {
+		return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "body parameters is nil"}
+	}
+	if self.RouterConfig.Guest {
+		return body, nil
+	}
+	self.JsonBody.Data = utils.GetJsonString(body, "d")
+	self.JsonBody.Time = utils.GetJsonInt64(body, "t")
+	self.JsonBody.Nonce = utils.GetJsonString(body, "n")
+	self.JsonBody.Plan = utils.GetJsonInt64(body, "p")
+	self.JsonBody.Sign = utils.GetJsonString(body, "s")
+	if err := self.validJsonBody(); err != nil {
+		return nil, err
+	}
+	data, _ := self.JsonBody.Data.([]byte)
+	return data, nil
+}
+
+func (self *HttpNode) serveWS(conn *WSConn, handle Handle, hook WSHooks) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil { // 业务处理或回调异常时断开连接, 避免影响服务进程
+			zlog.Error("websocket serve panic", 0, zlog.String("sub", conn.Sub), zlog.String("path", conn.Path), zlog.Any("error", r), zlog.String("stack", utils.Bytes2Str(debug.Stack())))
+			err = utils.Error("panic: ", r)
+		}
+		self.hub.remove(conn)
+		conn.Close()
+		if err == io.EOF {
+			err = nil
+		}
+		if hook.OnClose != nil {
+			hook.OnClose(conn, err)
+		}
+		zlog.Info("websocket client disconnect", 0, zlog.String("sub", conn.Sub), zlog.String("dev", conn.Dev), zlog.String("path", conn.Path), zlog.AddError(err))
+	}()
+	if hook.OnConnect != nil {
+		if err = hook.OnConnect(conn); err != nil {
+			conn.writeError(err)
+			return
+		}
+	}
+	self.hub.add(conn)
+	go conn.keepalive()
+	zlog.Info("websocket client connect success", 0, zlog.String("sub", conn.Sub), zlog.String("dev", conn.Dev), zlog.String("path", conn.Path), zlog.String("ip", conn.IP))
+	for {
+		var body []byte
+		if body, err = conn.ReadMessage(); err != nil {
+			return
+		}
+		data, e := conn.Ctx.readWSMessage(body)
+		if e != nil {
+			conn.writeError(e)
+			continue
+		}
+		if utils.GetJsonString(data, "healthCheck") == pingCmd { // 兼容WsClient应用层心跳
+			continue
+		}
+		if e := checkRateLimit(conn.Ctx); e != nil {
+			conn.writeError(e)
+			continue
+		}
+		reply, e := handle(conn.Ctx, data)
+		if e != nil {
+			conn.writeError(e)
+			continue
+		}
+		if err = conn.Send(reply); err != nil {
+			return
+		}
+	}
+}
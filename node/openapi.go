@@ -0,0 +1,411 @@
+package node
+
+import (
+	"encoding"
+	"encoding/json"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApiDoc 接口文档描述
+type ApiDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{} // 请求数据模型, 如&User{}, 安全模式下为d字段解码后的数据, 注册路由时预解析valid标签
+	Response    interface{} // 响应数据模型, 按路由View过滤字段
+	Hidden      bool        // 不输出至文档
+}
+
+// OpenAPIInfo 文档基本信息
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+	Servers     []string
+}
+
+// ModelDescriber ORM模型字段描述, 按表名及结构体字段名返回字段注释及数据库类型
+// 由sqld.DescribeField实现并通过SetModelDescriber注入, HTTP层无需依赖ORM
+type ModelDescriber func(table, field string) (comment, dbType string, ok bool)
+
+var modelDescriber ModelDescriber
+
+// SetModelDescriber 设置OpenAPI模型字段描述来源, 如 node.SetModelDescriber(sqld.DescribeField)
+func SetModelDescriber(describer ModelDescriber) {
+	modelDescriber = describer
+}
+
+type apiRoute struct {
+	method string
+	path   string
+	config *RouterConfig
+}
+
+type schemaKey struct {
+	typ  reflect.Type
+	view string
+}
+
+type openapiBuilder struct {
+	schemas map[string]interface{}
+	names   map[schemaKey]string
+}
+
+var (
+	apiRoutesMu sync.Mutex
+	apiRoutes   []apiRoute
+
+	timeType          = reflect.TypeOf(time.Time{})
+	objectType        = reflect.TypeOf((*sqlc.Object)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func addApiRoute(method, path string, config *RouterConfig) {
+	apiRoutesMu.Lock()
+	defer apiRoutesMu.Unlock()
+	apiRoutes = append(apiRoutes, apiRoute{method: method, path: path, config: config})
+}
+
+// ExportOpenAPI 按当前进程已注册的路由生成OpenAPI 3文档
+func ExportOpenAPI(info ...OpenAPIInfo) ([]byte, error) {
+	return utils.JsonMarshal(buildOpenAPI(info...))
+}
+
+// ServeOpenAPI 注册游客模式GET路由输出OpenAPI文档, 如/openapi.json
+func (self *HttpNode) ServeOpenAPI(path string, info ...OpenAPIInfo) {
+	self.GET(path, func(ctx *Context) error {
+		return ctx.Json(buildOpenAPI(info...))
+	}, &RouterConfig{Guest: true, Doc: &ApiDoc{Hidden: true}})
+}
+
+func buildOpenAPI(info ...OpenAPIInfo) map[string]interface{} {
+	var config OpenAPIInfo
+	if len(info) > 0 {
+		config = info[0]
+	}
+	if len(config.Title) == 0 {
+		config.Title = "freego api"
+	}
+	if len(config.Version) == 0 {
+		config.Version = "1.0.0"
+	}
+	builder := &openapiBuilder{schemas: map[string]interface{}{}, names: map[schemaKey]string{}}
+	builder.schemas["ErrorResp"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"c": map[string]interface{}{"type": "integer", "description": "错误码"},
+			"m": map[string]interface{}{"type": "string", "description": "错误信息"},
+			"e": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}, "description": "业务错误元数据"},
+			"t": map[string]interface{}{"type": "integer", "format": "int64"},
+			"n": map[string]interface{}{"type": "string"},
+		},
+	}
+	apiRoutesMu.Lock()
+	routes := append([]apiRoute{}, apiRoutes...)
+	apiRoutesMu.Unlock()
+	paths := map[string]interface{}{}
+	for _, v := range routes {
+		if v.config.Doc != nil && v.config.Doc.Hidden {
+			continue
+		}
+		path, params := openapiPath(v.path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(v.method)] = builder.operation(v, params)
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": config.Title, "version": config.Version, "description": config.Description},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": builder.schemas,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "apiKey", "in": "header", "name": Authorization},
+			},
+		},
+	}
+	if len(config.Servers) > 0 {
+		servers := make([]interface{}, 0, len(config.Servers))
+		for _, v := range config.Servers {
+			servers = append(servers, map[string]interface{}{"url": v})
+		}
+		doc["servers"] = servers
+	}
+	return doc
+}
+
+func (self *openapiBuilder) operation(route apiRoute, params []interface{}) map[string]interface{} {
+	config := route.config
+	op := map[string]interface{}{"operationId": operationId(route.method, route.path)}
+	var request, response interface{}
+	if doc := config.Doc; doc != nil {
+		if len(doc.Summary) > 0 {
+			op["summary"] = doc.Summary
+		}
+		if len(doc.Description) > 0 {
+			op["description"] = doc.Description
+		}
+		if len(doc.Tags) > 0 {
+			op["tags"] = doc.Tags
+		}
+		request, response = doc.Request, doc.Response
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	op["x-freego"] = map[string]interface{}{"guest": config.Guest, "anonymous": config.UseRSA, "aesRequest": config.AesRequest, "aesResponse": config.AesResponse, "upload": config.Upload, "httpStatus": config.HttpStatus} // 安全模式, 供SDK生成器使用
+	if !config.Guest && !config.UseRSA {
+		op["security"] = []interface{}{map[string]interface{}{"token": []string{}}}
+	}
+	if route.method == POST || route.method == PUT || route.method == PATCH {
+		data := self.modelSchema(request, "")
+		if !config.Guest {
+			data = envelopeSchema(data, false)
+		}
+		op["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": data}}}
+	}
+	view := config.View
+	if len(view) == 0 && config.PublicID {
+		view = utils.ViewAll
+	}
+	data := self.modelSchema(response, view)
+	if !config.Guest {
+		data = envelopeSchema(data, true)
+	}
+	op["responses"] = map[string]interface{}{
+		"200":     map[string]interface{}{"description": "OK", "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": data}}},
+		"default": map[string]interface{}{"description": "error", "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/ErrorResp"}}}},
+	}
+	return op
+}
+
+// 安全模式请求/响应包装, d为数据JSON的Base64编码(p=1时AES加密), x-data描述解码后的数据结构
+func envelopeSchema(data map[string]interface{}, response bool) map[string]interface{} {
+	properties := map[string]interface{}{
+		"d": map[string]interface{}{"type": "string", "description": "数据JSON的Base64编码, p=1时为AES加密", "x-data": data},
+		"t": map[string]interface{}{"type": "integer", "format": "int64", "description": "时间戳"},
+		"n": map[string]interface{}{"type": "string", "description": "随机数"},
+		"p": map[string]interface{}{"type": "integer", "format": "int64", "description": "0.默认 1.AES 2.RSA/ECC"},
+		"s": map[string]interface{}{"type": "string", "description": "签名"},
+	}
+	if response {
+		properties["c"] = map[string]interface{}{"type": "integer"}
+		properties["m"] = map[string]interface{}{"type": "string"}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (self *openapiBuilder) modelSchema(model interface{}, view string) map[string]interface{} {
+	if model == nil {
+		return map[string]interface{}{"type": "object"}
+	}
+	return self.schemaOf(reflect.TypeOf(model), view)
+}
+
+func (self *openapiBuilder) schemaOf(t reflect.Type, view string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return map[string]interface{}{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": self.schemaOf(t.Elem(), view)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": self.schemaOf(t.Elem(), view)}
+	case reflect.Struct:
+		return self.structSchema(t, view)
+	}
+	return map[string]interface{}{}
+}
+
+// 具名结构体输出至components引用, 同一类型按视图区分
+func (self *openapiBuilder) structSchema(t reflect.Type, view string) map[string]interface{} {
+	if len(t.Name()) == 0 {
+		return self.objectSchema(t, view)
+	}
+	key := schemaKey{typ: t, view: view}
+	name, ok := self.names[key]
+	if !ok {
+		name = t.Name()
+		if len(view) > 0 && view != utils.ViewAll {
+			name = utils.AddStr(name, "_", view)
+		}
+		if _, exist := self.schemas[name]; exist { // 不同包同名类型
+			name = strings.NewReplacer(".", "_", "/", "_").Replace(utils.AddStr(t.PkgPath(), ".", name))
+		}
+		self.names[key] = name
+		self.schemas[name] = map[string]interface{}{} // 占位, 避免递归引用
+		self.schemas[name] = self.objectSchema(t, view)
+	}
+	return map[string]interface{}{"$ref": utils.AddStr("#/components/schemas/", name)}
+}
+
+func (self *openapiBuilder) objectSchema(t reflect.Type, view string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var table string
+	if modelDescriber != nil && reflect.PtrTo(t).Implements(objectType) { // 已注册ORM模型使用模型字段描述
+		if object, ok := reflect.New(t).Interface().(sqlc.Object); ok {
+			table = object.GetTable()
+		}
+	}
+	self.fieldSchema(t, view, table, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// 字段解析规则与utils.MarshalView一致
+func (self *openapiBuilder) fieldSchema(t reflect.Type, view, table string, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if index := strings.IndexByte(tag, ','); index >= 0 {
+			name, opts = tag[:index], tag[index+1:]
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct {
+			self.fieldSchema(ft, view, table, properties)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = sf.Name
+		}
+		if _, exist := properties[name]; exist {
+			continue
+		}
+		if !fieldInView(sf, view) {
+			continue
+		}
+		var schema map[string]interface{}
+		if strings.Contains(opts, "string") || (len(view) > 0 && sf.Tag.Get("public_id") == "true") {
+			schema = map[string]interface{}{"type": "string"}
+		} else {
+			schema = self.schemaOf(sf.Type, view)
+		}
+		comment := sf.Tag.Get(sqlc.Comment)
+		if len(table) > 0 {
+			if fieldComment, dbType, ok := modelDescriber(table, sf.Name); ok {
+				comment = fieldComment
+				if size := varcharSize(dbType); size > 0 && schema["type"] == "string" {
+					schema["maxLength"] = size
+				}
+			}
+		}
+		if len(comment) > 0 {
+			if _, ref := schema["$ref"]; ref { // $ref不允许同级属性
+				schema = map[string]interface{}{"allOf": []interface{}{schema}}
+			}
+			schema["description"] = comment
+		}
+		properties[name] = schema
+	}
+}
+
+func fieldInView(sf reflect.StructField, view string) bool {
+	if len(view) == 0 {
+		return true
+	}
+	tag, ok := sf.Tag.Lookup("view")
+	if !ok {
+		return true
+	}
+	if tag == "-" {
+		return false
+	}
+	if view == utils.ViewAll {
+		return true
+	}
+	for _, v := range strings.Split(tag, ",") {
+		if strings.TrimSpace(v) == view {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析varchar(n)/char(n)长度
+func varcharSize(dbType string) int {
+	dbType = strings.ToLower(dbType)
+	if !strings.HasPrefix(dbType, "varchar(") && !strings.HasPrefix(dbType, "char(") {
+		return 0
+	}
+	start, end := strings.IndexByte(dbType, '('), strings.IndexByte(dbType, ')')
+	if end <= start {
+		return 0
+	}
+	size, err := utils.StrToInt(dbType[start+1 : end])
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// 路由参数:id/*id转换为{id}
+func openapiPath(path string) (string, []interface{}) {
+	var params []interface{}
+	parts := strings.Split(path, "/")
+	for i, v := range parts {
+		if len(v) > 1 && (v[0] == ':' || v[0] == '*') {
+			parts[i] = utils.AddStr("{", v[1:], "}")
+			params = append(params, map[string]interface{}{"name": v[1:], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func operationId(method, path string) string {
+	id := strings.ToLower(method)
+	for _, v := range strings.Split(path, "/") {
+		v = strings.TrimLeft(v, ":*")
+		v = strings.Map(func(r rune) rune {
+			if r == '_' || r == '-' || r == '.' {
+				return -1
+			}
+			return r
+		}, v)
+		if len(v) > 0 {
+			id = utils.AddStr(id, strings.ToUpper(v[:1]), v[1:])
+		}
+	}
+	return id
+}
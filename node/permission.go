@@ -0,0 +1,134 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/zlog"
+	"net/http"
+	"strings"
+)
+
+const (
+	permDivider  = ":"
+	permWildcard = "*"
+	permSubParts = ","
+)
+
+// PermissionResolver 获取当前登录用户拥有的权限列表, 如wallet:*、order:read,write, 可自行从数据库或缓存加载
+type PermissionResolver func(ctx *Context) ([]string, error)
+
+type PermissionFilter struct{}
+
+// RequirePerm 创建需满足全部权限的路由配置
+func RequirePerm(perms ...string) *RouterConfig {
+	return (&RouterConfig{}).RequirePerm(perms...)
+}
+
+// RequireAnyPerm 创建满足任一权限即可访问的路由配置
+func RequireAnyPerm(perms ...string) *RouterConfig {
+	return (&RouterConfig{}).RequireAnyPerm(perms...)
+}
+
+// RequirePerm 追加所需权限, 需全部满足
+func (self *RouterConfig) RequirePerm(perms ...string) *RouterConfig {
+	self.Perms = append(self.Perms, perms...)
+	return self
+}
+
+// RequireAnyPerm 追加所需权限, 满足任一即可
+func (self *RouterConfig) RequireAnyPerm(perms ...string) *RouterConfig {
+	self.Perms = append(self.Perms, perms...)
+	self.PermAny = true
+	return self
+}
+
+// AddPermissionResolver 设置权限加载方法, 路由配置了Perms时校验用户权限
+func (self *HttpNode) AddPermissionResolver(resolver PermissionResolver) {
+	self.readyContext()
+	if resolver == nil {
+		panic("permission resolver is nil")
+	}
+	self.Context.configs.permResolver = resolver
+	zlog.Printf("add permission resolver successful")
+}
+
+// MatchPerm 校验已授权权限是否包含所需权限
+// 以:分隔层级, *匹配任意值, 逗号分隔同级多个值, 父级权限包含全部子级权限(wallet包含wallet:write)
+func MatchPerm(granted, required string) bool {
+	if len(granted) == 0 || len(required) == 0 {
+		return false
+	}
+	grantedParts := strings.Split(granted, permDivider)
+	requiredParts := strings.Split(required, permDivider)
+	for i, part := range requiredParts {
+		if i >= len(grantedParts) { // 已授权权限层级更短, 包含全部子级
+			return true
+		}
+		if !matchPermPart(grantedParts[i], part) {
+			return false
+		}
+	}
+	for _, part := range grantedParts[len(requiredParts):] { // 已授权权限层级更长, 剩余层级须为通配符
+		if part != permWildcard {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPermPart(granted, required string) bool {
+	if granted == permWildcard {
+		return true
+	}
+	for _, v := range strings.Split(granted, permSubParts) {
+		if v == required {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPerm(granted []string, required string) bool {
+	for _, v := range granted {
+		if MatchPerm(v, required) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPermission(ctx *Context) error {
+	if ctx.RouterConfig == nil || len(ctx.RouterConfig.Perms) == 0 {
+		return nil
+	}
+	resolver := ctx.configs.permResolver
+	if resolver == nil {
+		return ex.Throw{Code: http.StatusForbidden, Msg: "permission resolver is nil"}
+	}
+	if !ctx.Authenticated() {
+		return ex.Throw{Code: http.StatusUnauthorized, Msg: "login status required"}
+	}
+	granted, err := resolver(ctx)
+	if err != nil {
+		return err
+	}
+	for _, required := range ctx.RouterConfig.Perms {
+		if hasPerm(granted, required) {
+			if ctx.RouterConfig.PermAny {
+				return nil
+			}
+		} else if !ctx.RouterConfig.PermAny {
+			return ex.Throw{Code: http.StatusForbidden, Msg: "access denied"}
+		}
+	}
+	if ctx.RouterConfig.PermAny {
+		return ex.Throw{Code: http.StatusForbidden, Msg: "access denied"}
+	}
+	return nil
+}
+
+func (self *PermissionFilter) DoFilter(chain Filter, ctx *Context, args ...interface{}) error {
+	if err := checkPermission(ctx); err != nil {
+		return err
+	}
+	return chain.DoFilter(chain, ctx, args...)
+}
@@ -0,0 +1,159 @@
+package node
+
+import (
+	rate "github.com/godaddy-x/freego/cache/limiter"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 按路由及用户限流, 由UserRateLimiterFilter在会话认证后执行, 未设置配置时不限流
+// 请求匹配的全部规则均需放行, 各规则独立计数, 路由计数按实际请求路径区分, PerUser/Subject规则再按用户(JWT subject)区分
+// PerUser规则对未登录请求按客户端IP计数, Subject规则仅对指定用户生效
+// 同一Path存在匹配当前用户的Subject规则时, 该Path的通用PerUser规则不生效, 用于单独调整指定用户的限额
+// 热更新时未变化的规则保留原计数, 仅新增或修改的规则重新计数
+
+// RateLimitRule 限流规则
+type RateLimitRule struct {
+	Name    string      // 规则名称, 用于区分计数, 为空按规则内容生成
+	Path    string      // 路由路径, 支持/api/*通配, 为空匹配全部路由
+	Subject string      // 指定用户标识, 为空匹配全部用户
+	PerUser bool        // 按登录用户分别计数, 否则该路由全部请求共享限额
+	Option  rate.Option // 限流参数
+}
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	Rules []RateLimitRule
+}
+
+type rateLimitEntry struct {
+	id      string // 计数键前缀
+	sign    string // 规则内容摘要, 热更新时判断规则是否变化
+	rule    RateLimitRule
+	limiter rate.RateLimiter
+}
+
+var (
+	rateLimitMu    sync.Mutex
+	rateLimitRules atomic.Value // []*rateLimitEntry
+)
+
+// SetRateLimitConfig 设置限流配置, 可在运行时调用替换全部规则, 未变化的规则保留原计数
+func SetRateLimitConfig(config RateLimitConfig) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	prev := make(map[string]*rateLimitEntry)
+	if old, _ := rateLimitRules.Load().([]*rateLimitEntry); len(old) > 0 {
+		for _, v := range old {
+			prev[v.sign] = v
+		}
+	}
+	entries := make([]*rateLimitEntry, 0, len(config.Rules))
+	for i, v := range config.Rules {
+		bs, _ := utils.JsonMarshal(&v)
+		sign := utils.MD5(utils.Bytes2Str(bs))
+		if e, ok := prev[sign]; ok {
+			delete(prev, sign) // 重复规则各自计数
+			entries = append(entries, e)
+			continue
+		}
+		id := v.Name
+		if len(id) == 0 {
+			id = utils.AddStr(i, ".", sign[:8])
+		}
+		entries = append(entries, &rateLimitEntry{id: id, sign: sign, rule: v, limiter: rate.NewRateLimiter(v.Option)})
+	}
+	rateLimitRules.Store(entries)
+	zlog.Info("rate limit config updated", 0, zlog.Int("rules", len(entries)))
+}
+
+// WatchRateLimitConfig 按间隔从配置源加载限流配置, 配置变化时热更新, 返回停止监听函数
+func WatchRateLimitConfig(load func() (RateLimitConfig, error), interval time.Duration) func() {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	stop := make(chan struct{})
+	var last string
+	refresh := func() {
+		config, err := load()
+		if err != nil {
+			zlog.Error("rate limit config load failed", 0, zlog.AddError(err))
+			return
+		}
+		bs, err := utils.JsonMarshal(&config)
+		if err != nil {
+			zlog.Error("rate limit config marshal failed", 0, zlog.AddError(err))
+			return
+		}
+		if current := utils.Bytes2Str(bs); current != last {
+			last = current
+			SetRateLimitConfig(config)
+		}
+	}
+	refresh()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				refresh()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+	}
+}
+
+// 执行匹配的限流规则
+func checkRateLimit(ctx *Context) error {
+	entries, _ := rateLimitRules.Load().([]*rateLimitEntry)
+	if len(entries) == 0 {
+		return nil
+	}
+	var sub string
+	if ctx.Authenticated() {
+		sub = ctx.Subject.Payload.Sub
+	}
+	matched := make([]*rateLimitEntry, 0, 4)
+	override := make(map[string]bool)
+	for _, v := range entries {
+		if len(v.rule.Path) > 0 && !utils.MatchFilterURL(ctx.Path, []string{v.rule.Path}) {
+			continue
+		}
+		if len(v.rule.Subject) > 0 {
+			if v.rule.Subject != sub {
+				continue
+			}
+			override[v.rule.Path] = true
+		}
+		matched = append(matched, v)
+	}
+	for _, v := range matched {
+		key := utils.AddStr("http:", v.id, ":", ctx.Path)
+		if len(v.rule.Subject) > 0 || v.rule.PerUser {
+			if len(v.rule.Subject) == 0 && override[v.rule.Path] {
+				continue
+			}
+			if len(sub) > 0 {
+				key = utils.AddStr(key, ":", sub)
+			} else { // 非登录状态按客户端IP计数
+				key = utils.AddStr(key, ":ip:", ctx.RemoteIP())
+			}
+		}
+		if !v.limiter.Allow(key) {
+			if len(v.rule.Subject) > 0 || v.rule.PerUser {
+				return ex.Throw{Code: 429, Msg: "the access frequency is too fast, please try again later"}
+			}
+			return ex.Throw{Code: 429, Msg: "the method request is full, please try again later"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/zlog"
+	"net/http"
+)
+
+var replayGuard *cache.ReplayGuard
+
+// UseReplayGuard 开启基于nonce及时间戳的防重放校验, 替换默认按签名缓存的校验, 需在StartServer前调用
+func UseReplayGuard(config cache.ReplayConfig) {
+	replayGuard = cache.NewReplayGuard(config)
+	zlog.Printf("add replay guard successful")
+}
+
+// 请求签名已包含nonce及时间戳, 校验通过后nonce不可篡改
+func (self *Context) validReplayNonce(nonce string, timestamp int64) error {
+	switch err := replayGuard.Check("http", nonce, timestamp); err {
+	case nil:
+		return nil
+	case cache.ErrReplayInvalid, cache.ErrReplayStale:
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "request time invalid", Err: err}
+	case cache.ErrReplayDuplicate:
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "replay attack invalid"}
+	default:
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "cache replay attack value error", Err: err}
+	}
+}
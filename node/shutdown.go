@@ -0,0 +1,96 @@
+package node
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/valyala/fasthttp"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	serverNodes   []*HttpNode
+	serverNodesMu sync.Mutex
+	shuttingDown  int32 // 停机标记, 置位后拒绝新请求
+	inflight      int64 // 处理中请求数量
+)
+
+func addServerNode(node *HttpNode) {
+	serverNodesMu.Lock()
+	defer serverNodesMu.Unlock()
+	serverNodes = append(serverNodes, node)
+}
+
+// 先计数再检查停机标记, 保证Shutdown等待时不会遗漏已进入的请求
+func acquireRequest() bool {
+	atomic.AddInt64(&inflight, 1)
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		atomic.AddInt64(&inflight, -1)
+		return false
+	}
+	return true
+}
+
+func releaseRequest() {
+	atomic.AddInt64(&inflight, -1)
+}
+
+func rejectRequest(ctx *fasthttp.RequestCtx) {
+	resp := &JsonResp{Code: http.StatusServiceUnavailable, Message: "server is shutting down", Time: utils.UnixMilli(), Nonce: utils.RandNonce()}
+	result, _ := utils.JsonMarshal(resp)
+	ctx.SetConnectionClose()
+	ctx.SetContentType(APPLICATION_JSON)
+	ctx.SetStatusCode(http.StatusServiceUnavailable)
+	ctx.SetBody(result)
+}
+
+// IsShuttingDown 是否处于停机状态
+func IsShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// Shutdown 停止全部已启动的HttpNode: 停止接收新请求, 断开websocket连接, 等待处理中请求完成
+// 等待时间取ctx截止时间与StartServer配置时间的较小值, 超时返回错误
+func Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&shuttingDown, 0, 1) {
+		return nil
+	}
+	serverNodesMu.Lock()
+	nodes := make([]*HttpNode, len(serverNodes))
+	copy(nodes, serverNodes)
+	serverNodesMu.Unlock()
+	var wait time.Duration
+	for _, node := range nodes {
+		if node.shutdownWait > wait {
+			wait = node.shutdownWait
+		}
+		go func(node *HttpNode) {
+			if err := node.server.Shutdown(); err != nil { // 关闭监听并等待空闲连接关闭
+				zlog.Error("http service shutdown failed", 0, zlog.AddError(err))
+			}
+		}(node)
+		for _, conn := range node.hub.find(nil) {
+			conn.Close()
+		}
+	}
+	if wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ex.Throw{Code: http.StatusServiceUnavailable, Msg: utils.AddStr("http service shutdown timeout, inflight requests: ", atomic.LoadInt64(&inflight)), Err: ctx.Err()}
+		case <-ticker.C:
+		}
+	}
+	zlog.Printf("http service has been shutdown successful")
+	return nil
+}
@@ -2,15 +2,20 @@ package http_web
 
 import (
 	"fmt"
+	rate "github.com/godaddy-x/freego/cache/limiter"
 	"github.com/godaddy-x/freego/ex"
 	"github.com/godaddy-x/freego/geetest"
+	"github.com/godaddy-x/freego/lifecycle"
 	"github.com/godaddy-x/freego/node"
 	"github.com/godaddy-x/freego/node/common"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/preflight"
 	"github.com/godaddy-x/freego/rpcx"
 	"github.com/godaddy-x/freego/rpcx/pb"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/utils/jwt"
 	"github.com/godaddy-x/freego/utils/sdk"
+	"github.com/godaddy-x/freego/zlog"
 	"strings"
 	"time"
 )
@@ -21,8 +26,8 @@ type MyWebNode struct {
 
 type GetUserReq struct {
 	common.BaseReq
-	Uid  int    `json:"uid"`
-	Name string `json:"name"`
+	Uid  int    `json:"uid" valid:"min=1"`
+	Name string `json:"name" valid:"required,len=1-64,regexp=^\\w+$"`
 }
 
 func (self *MyWebNode) test(ctx *node.Context) error {
@@ -84,6 +89,18 @@ func (self *MyWebNode) login(ctx *node.Context) error {
 	//return self.Html(ctx, "/web/index.html", map[string]interface{}{"tewt": 1})
 }
 
+func (self *MyWebNode) importKeystore(ctx *node.Context) error {
+	file, err := ctx.SaveUploadFile("keystore", "keystore/", node.UploadLimits{MaxSize: 1 << 20, Exts: []string{".json"}})
+	if err != nil {
+		return err
+	}
+	return self.Json(ctx, map[string]interface{}{"path": file.Path, "size": file.Size})
+}
+
+func (self *MyWebNode) exportKeystore(ctx *node.Context) error {
+	return ctx.ServeFile("keystore/wallet.json", "wallet.json")
+}
+
 func (self *MyWebNode) publicKey(ctx *node.Context) error {
 	//testCallRPC()
 	//_, publicKey := ctx.RSA.GetPublicKey()
@@ -221,6 +238,9 @@ func NewHTTP() *MyWebNode {
 	my.SetEncipher(createEncipher("http://localhost:4141"))
 	my.SetSystem("test", "1.0.0")
 	my.AddRoleRealm(roleRealm)
+	my.AddPermissionResolver(func(ctx *node.Context) ([]string, error) {
+		return []string{"user:*", "keystore:read,write"}, nil
+	})
 	my.AddErrorHandle(func(ctx *node.Context, throw ex.Throw) error {
 		fmt.Println(throw)
 		return throw
@@ -235,9 +255,11 @@ func StartHttpNode() {
 	go geetest.CheckServerStatus(geetest.Config{})
 	my := NewHTTP()
 	my.POST("/test1", my.test, nil)
-	my.POST("/getUser", my.getUser, &node.RouterConfig{AesResponse: false})
+	my.POST("/getUser", my.getUser, &node.RouterConfig{AesResponse: false, Doc: &node.ApiDoc{Summary: "获取用户信息", Tags: []string{"user"}, Request: &GetUserReq{}}})
 	my.POST("/testGuestPost", my.testGuestPost, &node.RouterConfig{Guest: true})
 	my.GET("/key", my.publicKey, &node.RouterConfig{Guest: true})
+	my.POST("/importKeystore", my.importKeystore, (&node.RouterConfig{Upload: true}).RequirePerm("keystore:write"))
+	my.GET("/exportKeystore", my.exportKeystore, node.RequirePerm("keystore:read"))
 	my.POST("/login", my.login, &node.RouterConfig{UseRSA: true})
 
 	my.POST("/geetest/register", my.FirstRegister, &node.RouterConfig{UseRSA: true})
@@ -250,8 +272,33 @@ func StartHttpNode() {
 	//	return my.ProxyRequest(ctx, proxy, "", "")
 	//}, &node.RouterConfig{Guest: true})
 
+	node.SetRateLimitConfig(node.RateLimitConfig{Rules: []node.RateLimitRule{
+		{Path: "/getUser", Option: rate.Option{Limit: 200, Bucket: 2000, Expire: 30}},
+		{Path: "/*", PerUser: true, Option: rate.Option{Bucket: 10, Expire: 30, Algorithm: rate.SlidingWindow}},
+	}})
+
+	my.AddTokenStore(node.NewMemoryTokenStore(), node.RefreshConfig{MaxAge: 30 * 86400})
+	my.AddRefreshRouter("/refreshToken", nil)
+	node.SetModelDescriber(sqld.DescribeField)
+	node.SetFileStore(sqld.GridFSStore{})
+	my.ServeOpenAPI("/openapi.json", node.OpenAPIInfo{Title: "freego webapp", Version: "1.0.0"})
+	my.AddMetrics("/metrics")
+	my.AddHealth("/healthz", "/readyz", preflight.Probe)
+	node.UseAccessLog(zlog.AccessLogConfig{Console: true, SampleQPS: 1000, SampleRate: 0.1, SlowRequest: 500})
+	node.UseRecovery()
+	node.UseCORS(node.CORSConfig{AllowOrigins: []string{"*"}, MaxAge: 3600})
+	node.UseFilter(-50, func(ctx *node.Context, next func() error) error {
+		start := utils.UnixMilli()
+		err := next()
+		zlog.Info("request finished", start, zlog.String("path", ctx.Path))
+		return err
+	})
+
 	my.AddLanguageByJson("en", []byte(`{"test":"测试$1次 我是$4岁"}`))
-	my.StartServer(":8090")
+	go my.StartServer(":8090", 15)
+	if err := lifecycle.RunUntilSignal(); err != nil { // 收到退出信号后停止服务并关闭数据源
+		zlog.Error("shutdown failed", 0, zlog.AddError(err))
+	}
 }
 
 func StartHttpNode1() {
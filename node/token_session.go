@@ -0,0 +1,208 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/node/common"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/utils/jwt"
+	"github.com/godaddy-x/freego/zlog"
+	"net/http"
+)
+
+const defaultRefreshExp = int64(604800) // 7天
+
+// RefreshConfig 刷新令牌配置
+type RefreshConfig struct {
+	RefreshExp int64 // 刷新令牌有效期/秒, 每次刷新重新计时(滑动过期), 默认7天
+	MaxAge     int64 // 会话最长有效期/秒, 自首次登录起计算, 超过后需重新登录, 0不限制
+}
+
+// TokenPair 访问令牌及刷新令牌
+type TokenPair struct {
+	Token          string `json:"token"`
+	Secret         string `json:"secret"`
+	Expired        int64  `json:"expired"`
+	Refresh        string `json:"refresh"`
+	RefreshExpired int64  `json:"refreshExpired"`
+}
+
+type refreshReq struct {
+	common.BaseReq
+	Refresh string `json:"refresh"`
+}
+
+// AddTokenStore 设置令牌存储, 设置后会话认证时校验token是否已吊销
+func (self *HttpNode) AddTokenStore(store TokenStore, config ...RefreshConfig) {
+	self.readyContext()
+	if store == nil {
+		panic("token store is nil")
+	}
+	refreshConfig := RefreshConfig{}
+	if len(config) > 0 {
+		refreshConfig = config[0]
+	}
+	if refreshConfig.RefreshExp < 0 || refreshConfig.MaxAge < 0 {
+		panic("refresh config exp invalid")
+	}
+	if refreshConfig.RefreshExp == 0 {
+		refreshConfig.RefreshExp = defaultRefreshExp
+	}
+	self.Context.configs.tokenStore = store
+	self.Context.configs.refreshConfig = refreshConfig
+	zlog.Printf("add token store successful")
+}
+
+// AddRefreshRouter 添加刷新令牌接口, 请求参数{"refresh":"..."}, 返回新的TokenPair, 旧刷新令牌立即失效
+// routerConfig为空时与登录接口一致使用RSA模式
+func (self *HttpNode) AddRefreshRouter(path string, routerConfig *RouterConfig) {
+	if routerConfig == nil {
+		routerConfig = &RouterConfig{UseRSA: true}
+	}
+	self.POST(path, func(ctx *Context) error {
+		req := &refreshReq{}
+		if err := ctx.Parser(req); err != nil {
+			return err
+		}
+		pair, err := ctx.RefreshToken(req.Refresh)
+		if err != nil {
+			return err
+		}
+		return ctx.Json(pair)
+	}, routerConfig)
+}
+
+func (self *Context) tokenStore() (TokenStore, error) {
+	if self.configs.tokenStore == nil {
+		return nil, ex.Throw{Msg: "token store is nil"}
+	}
+	return self.configs.tokenStore, nil
+}
+
+// CreateToken 登录成功后签发访问令牌及刷新令牌
+func (self *Context) CreateToken(sub, dev string) (*TokenPair, error) {
+	if len(sub) == 0 {
+		return nil, ex.Throw{Msg: "token subject is nil"}
+	}
+	return self.createToken(&RefreshSession{Sub: sub, Dev: dev, Start: utils.UnixMilli()})
+}
+
+func (self *Context) createToken(session *RefreshSession) (*TokenPair, error) {
+	store, err := self.tokenStore()
+	if err != nil {
+		return nil, err
+	}
+	config := self.GetJwtConfig()
+	now := utils.UnixSecond()
+	subject := &jwt.Subject{}
+	subject.Create(session.Sub).Dev(session.Dev)
+	token := subject.Generate(config)
+	if len(token) == 0 {
+		return nil, ex.Throw{Msg: "create token failed"}
+	}
+	refreshConfig := self.configs.refreshConfig
+	expire := refreshConfig.RefreshExp
+	if refreshConfig.MaxAge > 0 { // 刷新令牌不超过会话最长有效期
+		if remain := session.Start/1000 + refreshConfig.MaxAge - now; remain < expire {
+			expire = remain
+		}
+	}
+	pair := &TokenPair{
+		Token:   token,
+		Secret:  jwt.GetTokenSecret(token, config.TokenKey),
+		Expired: subject.Payload.Exp,
+	}
+	if expire > 0 {
+		pair.Refresh = utils.SHA256(utils.AddStr(utils.NextSID(), utils.RandStr2(32), utils.GetUUID()))
+		pair.RefreshExpired = now + expire
+		if err := store.SaveRefresh(pair.Refresh, session, expire); err != nil {
+			return nil, ex.Throw{Code: ex.CACHE, Msg: ex.CACHE_C_ERR, Err: err}
+		}
+	}
+	return pair, nil
+}
+
+// RefreshToken 使用刷新令牌换取新的令牌对, 刷新令牌仅可使用一次
+func (self *Context) RefreshToken(refresh string) (*TokenPair, error) {
+	store, err := self.tokenStore()
+	if err != nil {
+		return nil, err
+	}
+	if len(refresh) == 0 || len(refresh) > MAX_TOKEN_LEN {
+		return nil, ex.Throw{Code: http.StatusBadRequest, Msg: "refresh token invalid"}
+	}
+	session, err := store.TakeRefresh(refresh)
+	if err != nil {
+		return nil, ex.Throw{Code: ex.CACHE, Msg: ex.CACHE_R_ERR, Err: err}
+	}
+	if session == nil {
+		return nil, ex.Throw{Code: http.StatusUnauthorized, Msg: "refresh token invalid or expired"}
+	}
+	if maxAge := self.configs.refreshConfig.MaxAge; maxAge > 0 && session.Start/1000+maxAge <= utils.UnixSecond() {
+		return nil, ex.Throw{Code: http.StatusUnauthorized, Msg: "session expired"}
+	}
+	revoked, err := store.Revoked(session.Sub, "", session.Start)
+	if err != nil {
+		return nil, ex.Throw{Code: ex.CACHE, Msg: ex.CACHE_R_ERR, Err: err}
+	}
+	if revoked {
+		return nil, ex.Throw{Code: http.StatusUnauthorized, Msg: "token revoked"}
+	}
+	return self.createToken(session)
+}
+
+// RevokeToken 吊销当前请求的token, 用于退出登录
+func (self *Context) RevokeToken() error {
+	store, err := self.tokenStore()
+	if err != nil {
+		return err
+	}
+	jti := self.Subject.GetJti()
+	if len(jti) == 0 {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "token jti is nil"}
+	}
+	if err := store.Revoke(jti, self.Subject.GetExp()-utils.UnixSecond()); err != nil {
+		return ex.Throw{Code: ex.CACHE, Msg: ex.CACHE_C_ERR, Err: err}
+	}
+	return nil
+}
+
+// RevokeSubject 吊销用户当前已签发的全部token及刷新令牌, 用于修改密码或强制下线
+func (self *Context) RevokeSubject(sub string) error {
+	store, err := self.tokenStore()
+	if err != nil {
+		return err
+	}
+	if len(sub) == 0 {
+		return ex.Throw{Code: http.StatusBadRequest, Msg: "token subject is nil"}
+	}
+	expire := int64(0) // 会话不限时长时永久保留
+	if maxAge := self.configs.refreshConfig.MaxAge; maxAge > 0 {
+		expire = jwt.TWO_WEEK
+		if exp := self.GetJwtConfig().TokenExp; exp > 0 {
+			expire = exp
+		}
+		if maxAge > expire {
+			expire = maxAge
+		}
+	}
+	if err := store.RevokeSubject(sub, utils.UnixMilli(), expire); err != nil {
+		return ex.Throw{Code: ex.CACHE, Msg: ex.CACHE_C_ERR, Err: err}
+	}
+	return nil
+}
+
+// 未设置令牌存储时跳过
+func (self *Context) checkRevoked() error {
+	store := self.configs.tokenStore
+	if store == nil {
+		return nil
+	}
+	revoked, err := store.Revoked(self.Subject.GetSub(), self.Subject.GetJti(), self.Subject.GetIat())
+	if err != nil {
+		return ex.Throw{Code: ex.CACHE, Msg: ex.CACHE_R_ERR, Err: err}
+	}
+	if revoked {
+		return ex.Throw{Code: http.StatusUnauthorized, Msg: "token revoked"}
+	}
+	return nil
+}
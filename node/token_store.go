@@ -0,0 +1,206 @@
+package node
+
+import (
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/utils"
+	"sync"
+)
+
+const (
+	revokeTokenKey   = "jwt:revoke:jti:"
+	revokeSubjectKey = "jwt:revoke:sub:"
+	refreshTokenKey  = "jwt:refresh:"
+
+	// 原子读取并删除刷新令牌
+	takeRefreshScript = `local v = redis.call('GET', KEYS[1]) if v then redis.call('DEL', KEYS[1]) end return v`
+)
+
+// TokenStore 令牌黑名单及刷新令牌存储
+type TokenStore interface {
+	// Revoke 吊销单个token, expire为保留时间/秒, 应不小于token剩余有效期
+	Revoke(jti string, expire int64) error
+	// RevokeSubject 吊销用户在before(毫秒)之前签发的全部token及刷新令牌, expire为保留时间/秒, 0为永久保留
+	RevokeSubject(sub string, before, expire int64) error
+	// Revoked 校验token是否已吊销, iat为token签发时间/毫秒
+	Revoked(sub, jti string, iat int64) (bool, error)
+	// SaveRefresh 保存刷新令牌, expire为有效期/秒
+	SaveRefresh(refresh string, session *RefreshSession, expire int64) error
+	// TakeRefresh 读取并删除刷新令牌(一次性使用), 不存在或已过期返回nil
+	TakeRefresh(refresh string) (*RefreshSession, error)
+}
+
+// RefreshSession 刷新令牌对应的会话信息
+type RefreshSession struct {
+	Sub   string `json:"sub"`
+	Dev   string `json:"dev"`
+	Start int64  `json:"start"` // 会话首次登录时间/毫秒, 刷新时保持不变
+}
+
+// 存储键使用刷新令牌摘要, 避免明文泄露
+func refreshKey(refresh string) string {
+	return utils.AddStr(refreshTokenKey, utils.SHA256(refresh))
+}
+
+// 吊销后同一毫秒内签发的token仍有效, 未携带签发时间的token视为已吊销
+func revoked(iat, before int64, exists bool) bool {
+	if exists {
+		return true
+	}
+	return before > 0 && iat < before
+}
+
+// RedisTokenStore 基于redis的令牌存储, 适用于多节点部署
+type RedisTokenStore struct {
+	ds string
+}
+
+// NewRedisTokenStore 创建redis令牌存储, ds为redis数据源名称, 为空使用默认数据源
+func NewRedisTokenStore(ds ...string) *RedisTokenStore {
+	store := &RedisTokenStore{}
+	if len(ds) > 0 {
+		store.ds = ds[0]
+	}
+	return store
+}
+
+func (self *RedisTokenStore) client() (*cache.RedisManager, error) {
+	if len(self.ds) > 0 {
+		return cache.NewRedis(self.ds)
+	}
+	return cache.NewRedis()
+}
+
+func (self *RedisTokenStore) Revoke(jti string, expire int64) error {
+	if len(jti) == 0 || expire <= 0 {
+		return nil
+	}
+	client, err := self.client()
+	if err != nil {
+		return err
+	}
+	return client.Put(utils.AddStr(revokeTokenKey, jti), 1, int(expire))
+}
+
+func (self *RedisTokenStore) RevokeSubject(sub string, before, expire int64) error {
+	if len(sub) == 0 {
+		return nil
+	}
+	client, err := self.client()
+	if err != nil {
+		return err
+	}
+	return client.Put(utils.AddStr(revokeSubjectKey, sub), before, int(expire))
+}
+
+func (self *RedisTokenStore) Revoked(sub, jti string, iat int64) (bool, error) {
+	client, err := self.client()
+	if err != nil {
+		return false, err
+	}
+	exists := false
+	if len(jti) > 0 {
+		if exists, err = client.Exists(utils.AddStr(revokeTokenKey, jti)); err != nil {
+			return false, err
+		}
+	}
+	before, err := client.GetInt64(utils.AddStr(revokeSubjectKey, sub))
+	if err != nil {
+		return false, err
+	}
+	return revoked(iat, before, exists), nil
+}
+
+func (self *RedisTokenStore) SaveRefresh(refresh string, session *RefreshSession, expire int64) error {
+	client, err := self.client()
+	if err != nil {
+		return err
+	}
+	value, err := utils.JsonMarshal(session)
+	if err != nil {
+		return err
+	}
+	return client.Put(refreshKey(refresh), value, int(expire))
+}
+
+func (self *RedisTokenStore) TakeRefresh(refresh string) (*RefreshSession, error) {
+	client, err := self.client()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := client.LuaScript(takeRefreshScript, []string{refreshKey(refresh)})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := reply.([]byte)
+	if !ok || len(value) == 0 {
+		return nil, nil
+	}
+	session := &RefreshSession{}
+	if err := utils.JsonUnmarshal(value, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// MemoryTokenStore 基于本地缓存的令牌存储, 仅适用于单节点部署
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	cache cache.Cache
+}
+
+// NewMemoryTokenStore 创建本地令牌存储
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{cache: cache.NewLocalCache(30, 5)}
+}
+
+func (self *MemoryTokenStore) Revoke(jti string, expire int64) error {
+	if len(jti) == 0 || expire <= 0 {
+		return nil
+	}
+	return self.cache.Put(utils.AddStr(revokeTokenKey, jti), 1, int(expire))
+}
+
+func (self *MemoryTokenStore) RevokeSubject(sub string, before, expire int64) error {
+	if len(sub) == 0 {
+		return nil
+	}
+	if expire <= 0 {
+		expire = -1 // 不过期
+	}
+	return self.cache.Put(utils.AddStr(revokeSubjectKey, sub), before, int(expire))
+}
+
+func (self *MemoryTokenStore) Revoked(sub, jti string, iat int64) (bool, error) {
+	exists := false
+	if len(jti) > 0 {
+		exists, _ = self.cache.Exists(utils.AddStr(revokeTokenKey, jti))
+	}
+	before, err := self.cache.GetInt64(utils.AddStr(revokeSubjectKey, sub))
+	if err != nil {
+		return false, err
+	}
+	return revoked(iat, before, exists), nil
+}
+
+func (self *MemoryTokenStore) SaveRefresh(refresh string, session *RefreshSession, expire int64) error {
+	value := *session
+	return self.cache.Put(refreshKey(refresh), &value, int(expire))
+}
+
+func (self *MemoryTokenStore) TakeRefresh(refresh string) (*RefreshSession, error) {
+	key := refreshKey(refresh)
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	value, b, err := self.cache.Get(key, nil)
+	if err != nil || !b {
+		return nil, err
+	}
+	if err := self.cache.Del(key); err != nil {
+		return nil, err
+	}
+	session, ok := value.(*RefreshSession)
+	if !ok {
+		return nil, nil
+	}
+	return session, nil
+}
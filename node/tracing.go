@@ -0,0 +1,67 @@
+package node
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/otelx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// fasthttp请求头trace上下文读写
+type headerCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (self headerCarrier) Get(key string) string {
+	return utils.Bytes2Str(self.header.Peek(key))
+}
+
+func (self headerCarrier) Set(key, value string) {
+	self.header.Set(key, value)
+}
+
+func (self headerCarrier) Keys() []string {
+	keys := make([]string, 0, self.header.Len())
+	self.header.VisitAll(func(key, value []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Context 请求上下文, 已启用链路追踪时携带当前请求span, 用于数据库/RPC/MQ调用透传
+func (self *Context) Context() context.Context {
+	if self.traceCtx == nil {
+		return context.Background()
+	}
+	return self.traceCtx
+}
+
+// 提取上游trace上下文并创建服务端span
+func (self *Context) startSpan() trace.Span {
+	if !otelx.Enabled() {
+		return nil
+	}
+	ctx := otelx.Extract(context.Background(), headerCarrier{header: &self.RequestCtx.Request.Header})
+	ctx, span := otelx.Start(ctx, utils.AddStr(self.Method, " ", self.Path), trace.SpanKindServer,
+		attribute.String("http.method", self.Method),
+		attribute.String("http.target", self.Path),
+		attribute.String("http.client_ip", self.RemoteIP()),
+	)
+	self.traceCtx = ctx
+	return span
+}
+
+func (self *Context) endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	code := self.RequestCtx.Response.StatusCode()
+	span.SetAttributes(attribute.Int("http.status_code", code))
+	if err == nil && code >= http.StatusInternalServerError {
+		err = utils.Error("response status: ", code)
+	}
+	otelx.End(span, err)
+}
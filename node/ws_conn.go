@@ -0,0 +1,253 @@
+package node
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RFC6455帧操作码
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsPingInterval = 30 * time.Second // 服务端心跳间隔
+	wsReadTimeout  = 90 * time.Second // 超时未收到任何帧则断开
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WSConn 基于HttpNode的websocket连接, 连接级Context保存握手时的会话信息
+type WSConn struct {
+	Sub    string
+	Dev    string
+	Path   string
+	IP     string
+	Ctx    *Context
+	conn   net.Conn
+	reader *bufio.Reader
+	wmu    sync.Mutex
+	closed int32
+	done   chan struct{}
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.Sum(utils.Str2Bytes(utils.AddStr(key, wsGUID)))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func wsProtocolError(msg string) error {
+	return ex.Throw{Code: http.StatusBadRequest, Msg: utils.AddStr("websocket protocol error: ", msg)}
+}
+
+// 读取单个帧, 客户端帧必须掩码
+func (self *WSConn) readFrame() (bool, byte, []byte, error) {
+	if err := self.conn.SetReadDeadline(time.Now().Add(wsReadTimeout)); err != nil {
+		return false, 0, nil, err
+	}
+	var head [8]byte
+	if _, err := io.ReadFull(self.reader, head[:2]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	op := head[0] & 0x0f
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, wsProtocolError("extensions not supported")
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, wsProtocolError("client frame must be masked")
+	}
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(self.reader, head[:2]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(head[:2]))
+	case 127:
+		if _, err := io.ReadFull(self.reader, head[:8]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(head[:8])
+	}
+	if op >= wsClose && (!fin || length > 125) {
+		return false, 0, nil, wsProtocolError("invalid control frame")
+	}
+	if length > MAX_VALUE_LEN {
+		return false, 0, nil, ex.Throw{Code: http.StatusLengthRequired, Msg: "body parameters length is too long"}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(self.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(self.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// ReadMessage 读取完整消息, 自动处理分片及ping/pong/close控制帧, 对端关闭时返回io.EOF
+func (self *WSConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, op, payload, err := self.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := self.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose: // 关闭帧由Close回复
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if started {
+				return nil, wsProtocolError("unexpected data frame")
+			}
+			started = true
+			message = payload
+		case wsContinuation:
+			if !started {
+				return nil, wsProtocolError("unexpected continuation frame")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, wsProtocolError("unknown opcode")
+		}
+		if len(message) > MAX_VALUE_LEN {
+			return nil, ex.Throw{Code: http.StatusLengthRequired, Msg: "body parameters length is too long"}
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// 写入单个不分片帧, 服务端帧不掩码
+func (self *WSConn) writeFrame(op byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|op)
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(length))
+		frame = append(append(frame, 127), size[:]...)
+	}
+	frame = append(frame, payload...)
+	self.wmu.Lock()
+	defer self.wmu.Unlock()
+	if err := self.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	_, err := self.conn.Write(frame)
+	return err
+}
+
+// WriteMessage 发送原始文本消息
+func (self *WSConn) WriteMessage(data []byte) error {
+	if atomic.LoadInt32(&self.closed) == 1 {
+		return ex.Throw{Code: ex.WS_SEND, Msg: "websocket connection closed"}
+	}
+	if err := self.writeFrame(wsText, data); err != nil {
+		return ex.Throw{Code: ex.WS_SEND, Msg: "websocket send error", Err: err}
+	}
+	return nil
+}
+
+// Send 按路由配置输出数据, 游客模式输出原始JSON, 否则与JSON接口一致签名(及加密)
+func (self *WSConn) Send(data interface{}) error {
+	if data == nil {
+		return nil
+	}
+	routerConfig := self.Ctx.RouterConfig
+	data = viewEntity(routerConfig, data)
+	var result []byte
+	var err error
+	if routerConfig.Guest {
+		result, err = utils.JsonMarshal(data)
+	} else {
+		result, err = authReq(self.Path, data, self.Ctx.GetTokenSecret(), routerConfig.AesResponse)
+	}
+	if err != nil {
+		return err
+	}
+	return self.WriteMessage(result)
+}
+
+func (self *WSConn) writeError(err error) {
+	if err == nil {
+		return
+	}
+	out := ex.Catch(err)
+	if self.Ctx.errorHandle != nil {
+		throw, ok := err.(ex.Throw)
+		if !ok {
+			throw = ex.Throw{Code: out.Code, Msg: out.Msg, Err: err, Arg: out.Arg}
+		}
+		if err = self.Ctx.errorHandle(self.Ctx, throw); err != nil {
+			zlog.Error("response error handle failed", 0, zlog.AddError(err))
+		}
+	}
+	resp := &JsonResp{Code: out.Code, Message: out.Msg, Time: utils.UnixMilli(), Nonce: utils.RandNonce()}
+	if resp.Code == 0 {
+		resp.Code = ex.BIZ
+	}
+	result, _ := utils.JsonMarshal(resp)
+	if err := self.WriteMessage(result); err != nil {
+		zlog.Error("websocket send error", 0, zlog.String("sub", self.Sub), zlog.String("path", self.Path), zlog.AddError(err))
+	}
+}
+
+// 定时发送ping帧保持连接
+func (self *WSConn) keepalive() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.done:
+			return
+		case <-ticker.C:
+			if err := self.writeFrame(wsPing, nil); err != nil {
+				self.Close()
+				return
+			}
+		}
+	}
+}
+
+// Close 发送关闭帧并断开连接, 可重复调用
+func (self *WSConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&self.closed, 0, 1) {
+		return nil
+	}
+	close(self.done)
+	_ = self.writeFrame(wsClose, []byte{0x03, 0xe8}) // 1000正常关闭
+	return self.conn.Close()
+}
@@ -0,0 +1,363 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 消息outbox, 事务内调用Enqueue将待发送消息写入outbox表, 与业务数据同一事务提交, 回滚时消息一并丢弃
+// 后台任务按写入顺序逐条认领(租约)后批量发送至Publisher, 确认后标记为已发送, 失败按退避时间重试
+// 标记前宕机或租约到期重新认领时可能重复发送, 消息ID固定为记录ID, 消费端按ID去重
+// 如 outbox.Enable(outbox.Config{Publisher: outbox.RabbitMQ("")}), 事务内 outbox.Enqueue(db, exchange, router, payload)
+
+const (
+	statePending = 0      // 待发送
+	stateSent    = 1      // 已发送
+	stateDead    = 2      // 超过重试次数
+	leaseTime    = 300000 // 认领租约/毫秒, 实例宕机后租约到期由其他实例继续发送
+)
+
+// Message 待发送消息
+type Message struct {
+	ID       int64 // 记录ID, 重复发送时不变, 用于消费端去重
+	Exchange string
+	Router   string
+	Payload  json.RawMessage
+}
+
+// Publisher 消息发送, 按顺序返回每条消息的发送结果, nil表示broker已确认
+type Publisher interface {
+	Publish(ctx context.Context, msgs ...*Message) []error
+}
+
+// Config 消息outbox配置
+type Config struct {
+	DsName    string    // outbox表所在数据源, 默认master
+	Publisher Publisher // 消息发送, 必填
+	Table     string    // outbox表名, 默认message_outbox
+	Interval  int64     // 轮询间隔/毫秒, 默认1000
+	BatchSize int       // 单次发送条数, 默认100
+	MaxRetry  int       // 最大重试次数, 默认10
+	Retention int64     // 已发送记录保留时间/秒, 默认86400
+	Timeout   int64     // 单次发送确认超时/毫秒, 默认10000
+}
+
+// Stat 发送统计
+type Stat struct {
+	Pending int64 // 待发送条数
+	Lag     int64 // 最早待发送消息距今/毫秒
+	Sent    int64 // 累计发送成功条数
+	Failed  int64 // 累计发送失败次数
+	Dead    int64 // 累计超过重试次数条数
+}
+
+type messageOutbox struct {
+	config  Config
+	stop    chan struct{}
+	done    chan struct{}
+	pending int64
+	lag     int64
+	sent    int64
+	failed  int64
+	dead    int64
+}
+
+var (
+	mu      sync.RWMutex
+	current *messageOutbox
+	owner   = utils.MD5(utils.GetUUID())[:16] // 进程标识, 用于认领记录
+)
+
+// Enable 开启消息outbox并启动后台发送任务, 自动创建outbox表
+func Enable(config Config) error {
+	if config.Publisher == nil {
+		return utils.Error("[MessageOutbox] publisher is nil")
+	}
+	if len(config.DsName) == 0 {
+		config.DsName = DIC.MASTER
+	}
+	if len(config.Table) == 0 {
+		config.Table = "message_outbox"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 1000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.MaxRetry <= 0 {
+		config.MaxRetry = 10
+	}
+	if config.Retention <= 0 {
+		config.Retention = 86400
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10000
+	}
+	db := &sqld.RDBManager{}
+	if err := db.GetDB(sqld.Option{DsName: config.DsName}); err != nil {
+		return err
+	}
+	if err := sqld.CreateOutboxTable(db, config.Table,
+		"`id` BIGINT NOT NULL PRIMARY KEY",
+		"`exchange` VARCHAR(255) NOT NULL",
+		"`router` VARCHAR(255) NOT NULL",
+		"`payload` MEDIUMTEXT NOT NULL",
+		"`state` INT NOT NULL DEFAULT 0",
+		"`retry` INT NOT NULL DEFAULT 0",
+		"`next_time` BIGINT NOT NULL DEFAULT 0",
+		"`owner` VARCHAR(32) NOT NULL DEFAULT ''",
+		"`lease_time` BIGINT NOT NULL DEFAULT 0",
+		"`error` VARCHAR(512) NOT NULL DEFAULT ''",
+		"`ctime` BIGINT NOT NULL DEFAULT 0",
+		"`utime` BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return utils.Error("[MessageOutbox] create table failed: ", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil {
+		return utils.Error("[MessageOutbox] already enabled")
+	}
+	current = &messageOutbox{config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	go current.run()
+	return nil
+}
+
+// Stop 停止后台发送任务, 未发送的消息保留在outbox表, 重新开启后继续发送
+func Stop() {
+	mu.Lock()
+	outbox := current
+	current = nil
+	mu.Unlock()
+	if outbox != nil {
+		close(outbox.stop)
+		<-outbox.done
+	}
+}
+
+// Stats 获取发送统计, 未开启时返回零值
+func Stats() Stat {
+	outbox := getOutbox()
+	if outbox == nil {
+		return Stat{}
+	}
+	return Stat{
+		Pending: atomic.LoadInt64(&outbox.pending),
+		Lag:     atomic.LoadInt64(&outbox.lag),
+		Sent:    atomic.LoadInt64(&outbox.sent),
+		Failed:  atomic.LoadInt64(&outbox.failed),
+		Dead:    atomic.LoadInt64(&outbox.dead),
+	}
+}
+
+func getOutbox() *messageOutbox {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Enqueue 事务内写入待发送消息, payload序列化为JSON, 事务提交后由后台任务发送至exchange/router
+func Enqueue(db *sqld.RDBManager, exchange, router string, payload interface{}) error {
+	outbox := getOutbox()
+	if outbox == nil {
+		return utils.Error("[MessageOutbox] not enabled")
+	}
+	if db == nil || !db.OpenTx || db.Tx == nil {
+		return utils.Error("[MessageOutbox] enqueue message must be in transaction")
+	}
+	if len(exchange) == 0 || len(router) == 0 {
+		return utils.Error("[MessageOutbox] exchange/router is nil")
+	}
+	data, err := utils.JsonMarshal(payload)
+	if err != nil {
+		return utils.Error("[MessageOutbox] marshal payload failed: ", err)
+	}
+	base := db.Context
+	if base == nil {
+		base = context.Background()
+	}
+	now := utils.UnixMilli()
+	ctx, cancel := context.WithTimeout(base, time.Duration(db.Timeout)*time.Millisecond)
+	defer cancel()
+	if _, err := db.ExecContext(ctx, utils.AddStr("insert into `", outbox.config.Table, "` (`id`,`exchange`,`router`,`payload`,`state`,`next_time`,`ctime`,`utime`) values (?,?,?,?,?,?,?,?)"),
+		utils.NextIID(), exchange, router, utils.Bytes2Str(data), statePending, now, now, now); err != nil {
+		return utils.Error("[MessageOutbox] write failed: ", err)
+	}
+	return nil
+}
+
+func (self *messageOutbox) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(time.Duration(self.config.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	// 停止时取消进行中的发送确认
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-self.stop
+		cancel()
+	}()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			if err := self.process(ctx); err != nil {
+				zlog.Error("[MessageOutbox] process failed", 0, zlog.AddError(err))
+			}
+		}
+	}
+}
+
+// 按写入顺序逐条认领后批量确认发送, 逐条标记结果, 已被其他实例认领的记录跳过
+func (self *messageOutbox) process(base context.Context) error {
+	db := &sqld.RDBManager{}
+	if err := db.GetDB(sqld.Option{DsName: self.config.DsName}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(db.Timeout)*time.Millisecond)
+	defer cancel()
+	table := self.config.Table
+	now := utils.UnixMilli()
+	rows, err := db.QueryContext(ctx, utils.AddStr("select `id`,`exchange`,`router`,`payload`,`retry` from `", table, "` where `state` = ? and `next_time` <= ? and `lease_time` <= ? order by `id` limit ?"),
+		statePending, now, now, self.config.BatchSize)
+	if err != nil {
+		return utils.Error("[MessageOutbox] query failed: ", err)
+	}
+	type outboxRow struct {
+		id    int64
+		msg   *Message
+		retry int
+	}
+	var list []*outboxRow
+	for rows.Next() {
+		row := &outboxRow{msg: &Message{}}
+		var payload string
+		if err := rows.Scan(&row.id, &row.msg.Exchange, &row.msg.Router, &payload, &row.retry); err != nil {
+			rows.Close()
+			return utils.Error("[MessageOutbox] read failed: ", err)
+		}
+		row.msg.ID, row.msg.Payload = row.id, json.RawMessage(payload)
+		list = append(list, row)
+	}
+	rows.Close()
+	var claimed []*outboxRow
+	for _, row := range list {
+		res, err := db.ExecContext(ctx, utils.AddStr("update `", table, "` set `owner` = ?, `lease_time` = ? where `id` = ? and `state` = ? and `lease_time` <= ?"),
+			owner, now+leaseTime, row.id, statePending, now)
+		if err != nil {
+			return utils.Error("[MessageOutbox] claim failed: ", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			claimed = append(claimed, row)
+		}
+	}
+	if len(claimed) > 0 {
+		msgs := make([]*Message, len(claimed))
+		for i, row := range claimed {
+			msgs[i] = row.msg
+		}
+		results := self.publish(base, msgs)
+		// 发送完成后重新计算数据库操作超时
+		markCtx, markCancel := context.WithTimeout(context.Background(), time.Duration(db.Timeout)*time.Millisecond)
+		defer markCancel()
+		ctx = markCtx
+		for i, row := range claimed {
+			var cause error
+			if i < len(results) {
+				cause = results[i]
+			} else {
+				cause = utils.Error("publish result missing")
+			}
+			if err := self.mark(ctx, db, row.msg, row.retry, cause); err != nil {
+				return err
+			}
+		}
+	}
+	if err := self.clean(ctx, db, now); err != nil {
+		return err
+	}
+	var pending int64
+	var oldest sql.NullInt64
+	if err := db.QueryRowContext(ctx, utils.AddStr("select count(1), min(`ctime`) from `", table, "` where `state` = ?"), statePending).Scan(&pending, &oldest); err != nil {
+		return utils.Error("[MessageOutbox] stat failed: ", err)
+	}
+	atomic.StoreInt64(&self.pending, pending)
+	if oldest.Valid && pending > 0 {
+		atomic.StoreInt64(&self.lag, utils.UnixMilli()-oldest.Int64)
+	} else {
+		atomic.StoreInt64(&self.lag, 0)
+	}
+	return nil
+}
+
+// 批量发送并等待确认, 超时或停止时未确认的消息按失败重试
+func (self *messageOutbox) publish(base context.Context, msgs []*Message) []error {
+	ctx, cancel := context.WithTimeout(base, time.Duration(self.config.Timeout)*time.Millisecond)
+	defer cancel()
+	return self.config.Publisher.Publish(ctx, msgs...)
+}
+
+// 清理超过保留时间的已发送记录, 单次最多BatchSize条
+func (self *messageOutbox) clean(ctx context.Context, db *sqld.RDBManager, now int64) error {
+	table := self.config.Table
+	query := utils.AddStr("delete from `", table, "` where `state` = ? and `utime` < ? limit ?")
+	if len(db.Driver) > 0 && db.Driver != sqld.MYSQL { // postgres/sqlite不支持delete limit
+		query = utils.AddStr("delete from `", table, "` where `id` in (select `id` from `", table, "` where `state` = ? and `utime` < ? order by `id` limit ?)")
+	}
+	if _, err := db.ExecContext(ctx, query, stateSent, now-self.config.Retention*1000, self.config.BatchSize); err != nil {
+		return utils.Error("[MessageOutbox] clean failed: ", err)
+	}
+	return nil
+}
+
+// 标记发送结果并释放认领, 失败按退避时间重试, 超过最大重试次数标记为失败不再处理
+func (self *messageOutbox) mark(ctx context.Context, db *sqld.RDBManager, msg *Message, retry int, cause error) error {
+	now := utils.UnixMilli()
+	table := self.config.Table
+	if cause == nil {
+		if _, err := db.ExecContext(ctx, utils.AddStr("update `", table, "` set `state` = ?, `owner` = '', `lease_time` = 0, `error` = '', `utime` = ? where `id` = ? and `owner` = ?"),
+			stateSent, now, msg.ID, owner); err != nil {
+			return utils.Error("[MessageOutbox] mark sent failed: ", err)
+		}
+		atomic.AddInt64(&self.sent, 1)
+		return nil
+	}
+	atomic.AddInt64(&self.failed, 1)
+	retry++
+	state := statePending
+	if retry >= self.config.MaxRetry {
+		state = stateDead
+		atomic.AddInt64(&self.dead, 1)
+	}
+	reason := cause.Error()
+	if len(reason) > 512 {
+		reason = reason[:512]
+	}
+	zlog.Error("[MessageOutbox] publish failed", 0, zlog.Int64("id", msg.ID), zlog.String("exchange", msg.Exchange), zlog.String("router", msg.Router), zlog.Int("retry", retry), zlog.AddError(cause))
+	if _, err := db.ExecContext(ctx, utils.AddStr("update `", table, "` set `state` = ?, `retry` = ?, `next_time` = ?, `owner` = '', `lease_time` = 0, `error` = ?, `utime` = ? where `id` = ? and `owner` = ?"),
+		state, retry, now+self.backoff(retry), reason, now, msg.ID, owner); err != nil {
+		return utils.Error("[MessageOutbox] update retry failed: ", err)
+	}
+	return nil
+}
+
+// 重试退避时间, 按轮询间隔指数增长, 最长5分钟
+func (self *messageOutbox) backoff(retry int) int64 {
+	delay := self.config.Interval
+	for i := 1; i < retry && delay < 300000; i++ {
+		delay *= 2
+	}
+	if delay > 300000 {
+		delay = 300000
+	}
+	return delay
+}
@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"context"
+	rabbitmq "github.com/godaddy-x/freego/amqp"
+	"github.com/godaddy-x/freego/utils"
+)
+
+type rabbitPublisher struct {
+	ds string
+}
+
+// RabbitMQ 使用rabbitmq数据源以确认模式发送, ds为空时使用master, 消息Nonce为记录ID
+func RabbitMQ(ds string) Publisher {
+	return &rabbitPublisher{ds: ds}
+}
+
+func (self *rabbitPublisher) Publish(ctx context.Context, msgs ...*Message) []error {
+	publisher, err := rabbitmq.NewPublish(self.ds)
+	if err == nil && publisher == nil {
+		err = utils.Error("[MessageOutbox] rabbitmq publish [", self.ds, "] not found")
+	}
+	if err != nil {
+		results := make([]error, len(msgs))
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+	data := make([]*rabbitmq.MsgData, len(msgs))
+	for i, v := range msgs {
+		data[i] = &rabbitmq.MsgData{
+			Option:  rabbitmq.Option{Exchange: v.Exchange, Router: v.Router},
+			Durable: true,
+			Content: v.Payload,
+			Nonce:   utils.AnyToStr(v.ID),
+		}
+	}
+	return publisher.PublishConfirmBatch(ctx, data...)
+}
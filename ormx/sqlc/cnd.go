@@ -37,6 +37,8 @@ const (
 	MIN_
 	MAX_
 	CNT_
+	RAW_
+	AND_
 )
 
 const ASC_ = 1
@@ -57,6 +59,21 @@ const (
 	Comment = "comment"
 	Charset = "charset"
 	Collate = "collate"
+	SoftDel = "softdel"
+	Shard   = "shard"
+	IdGen   = "idgen" // 字符串主键生成方式, 默认雪花ID
+	ULID    = "ulid"
+	UUIDv7  = "uuidv7"
+	Encrypt = "encrypt" // 字段加密存储算法
+	AesGcm  = "aes-gcm"
+	Mask    = "mask" // 字段脱敏规则, phone/email/idcard/bank/name或自定义
+)
+
+// 自动写入时间标签, autotime:"create"/autotime:"update"
+const (
+	AutoTime   = "autotime"
+	AutoCreate = "create"
+	AutoUpdate = "update"
 )
 
 // 数据库操作逻辑条件对象
@@ -68,6 +85,12 @@ type Condition struct {
 	Alias  string
 }
 
+// 原生SQL表达式, 用于更新字段时引用数据库函数或字段自身, 如 balance + ?
+type Expr struct {
+	Sql    string
+	Values []interface{}
+}
+
 type Collation struct {
 	Locale          string `bson:",omitempty"` // The locale
 	CaseLevel       bool   `bson:",omitempty"` // The case level
@@ -114,6 +137,11 @@ type Cnd struct {
 	LimitSize       int64 // 固定截取结果集数量
 	CacheConfig     CacheConfig
 	Escape          bool
+	Unscope         bool                // 查询包含软删除数据
+	ShardTable      string              // 指定分片表名
+	MaskResult      bool                // 查询结果按mask标签脱敏
+	ReadPref        string              // MongoDB查询读偏好, 为空使用Option配置
+	ReadTags        []map[string]string // MongoDB读偏好标签集合
 }
 
 // 缓存结果集参数
@@ -145,6 +173,34 @@ func (self *Cnd) UnEscape() *Cnd {
 	return self
 }
 
+// 原生SQL条件片段, 如 Raw("ctime > UNIX_TIMESTAMP()-?", 3600), 参数使用?占位, 仅关系数据库支持
+// 片段原样拼接到SQL中, 禁止拼接外部输入
+func (self *Cnd) Raw(sql string, values ...interface{}) *Cnd {
+	if len(sql) == 0 {
+		return self
+	}
+	condit := Condition{RAW_, sql, nil, values, ""}
+	return addDefaultCondit(self, condit)
+}
+
+// 查询包含已软删除的数据
+func (self *Cnd) Unscoped() *Cnd {
+	self.Unscope = true
+	return self
+}
+
+// 查询结果按mask标签脱敏, 用于列表/导出接口, 不影响缓存中的完整数据
+func (self *Cnd) Masked() *Cnd {
+	self.MaskResult = true
+	return self
+}
+
+// 指定分片表名, 如 ow_wallet_03, 不再按分片键计算
+func (self *Cnd) InShard(table string) *Cnd {
+	self.ShardTable = table
+	return self
+}
+
 // =
 func (self *Cnd) Eq(key string, value interface{}) *Cnd {
 	if value == nil {
@@ -282,15 +338,40 @@ func (self *Cnd) AddOther(part string) *Cnd {
 	return self
 }
 
-// or
+// or, 参数为*Cnd或func(c *Cnd), 各组之间以or连接, 组内条件以and连接, 支持任意层级嵌套
 func (self *Cnd) Or(cnds ...interface{}) *Cnd {
 	if cnds == nil || len(cnds) == 0 {
 		return self
 	}
-	condit := Condition{OR_, "", nil, cnds, ""}
+	condit := Condition{OR_, "", nil, self.subCnds(cnds), ""}
 	return addDefaultCondit(self, condit)
 }
 
+// and条件组, 如 And(func(c *Cnd) { c.Eq("a", 1).Or(...) }), 生成带括号的嵌套条件
+func (self *Cnd) And(cnds ...interface{}) *Cnd {
+	if cnds == nil || len(cnds) == 0 {
+		return self
+	}
+	condit := Condition{AND_, "", nil, self.subCnds(cnds), ""}
+	return addDefaultCondit(self, condit)
+}
+
+// 将func(c *Cnd)转换为子条件, 子条件继承字段转义设置
+func (self *Cnd) subCnds(cnds []interface{}) []interface{} {
+	result := make([]interface{}, 0, len(cnds))
+	for _, v := range cnds {
+		switch fn := v.(type) {
+		case func(c *Cnd):
+			sub := &Cnd{Escape: self.Escape}
+			fn(sub)
+			result = append(result, sub)
+		default:
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 // 复杂查询设定首个from table as
 func (self *Cnd) From(fromTable string) *Cnd {
 	self.FromCond = &FromCond{fromTable, ""}
@@ -369,13 +450,33 @@ func (self *Cnd) Agg(logic int, key string, alias ...string) *Cnd {
 		return self
 	}
 	ali := key
-	if alias != nil || len(alias) > 0 {
+	if len(alias) > 0 && len(alias[0]) > 0 {
 		ali = alias[0]
 	}
 	self.Aggregates = append(self.Aggregates, Condition{Logic: logic, Key: key, Alias: ali})
 	return self
 }
 
+// 求和, alias为结果字段名, 默认与key相同
+func (self *Cnd) Sum(key string, alias ...string) *Cnd {
+	return self.Agg(SUM_, key, alias...)
+}
+
+// 求平均值
+func (self *Cnd) Avg(key string, alias ...string) *Cnd {
+	return self.Agg(AVG_, key, alias...)
+}
+
+// 求最大值
+func (self *Cnd) Max(key string, alias ...string) *Cnd {
+	return self.Agg(MAX_, key, alias...)
+}
+
+// 求最小值
+func (self *Cnd) Min(key string, alias ...string) *Cnd {
+	return self.Agg(MIN_, key, alias...)
+}
+
 // 按字段排序
 func (self *Cnd) Orderby(key string, sortby int) *Cnd {
 	if !(sortby == ASC_ || sortby == DESC_) {
@@ -444,6 +545,13 @@ func (self *Cnd) Sample(size int64) *Cnd {
 	return self
 }
 
+// MongoDB查询读偏好 primary/primaryPreferred/secondary/secondaryPreferred/nearest, 可指定标签集合如 {"region": "east"}
+func (self *Cnd) ReadPreference(mode string, tags ...map[string]string) *Cnd {
+	self.ReadPref = mode
+	self.ReadTags = tags
+	return self
+}
+
 // 固定截取结果集数量
 func (self *Cnd) ResultSize(size int64) *Cnd {
 	if size <= 0 {
@@ -474,10 +582,22 @@ func (self *Cnd) FastPage(key string, sort int, prevID, lastID, pageSize int64,
 	return self
 }
 
-// 缓存指定结果集
-func (self *Cnd) Cache(config CacheConfig) *Cnd {
-	self.CacheConfig = config
+// 游标分页, 按排序字段及主键定位下一页, 避免深度分页扫描, cursor为上页返回的Pagination.NextCursor, 首页传空
+// 最多一个排序字段(未指定时按主键升序), 主键自动作为第二排序字段, NextCursor为空时无更多数据
+func (self *Cnd) After(cursor string, size int64) *Cnd {
+	if size <= 0 || size > 5000 {
+		size = 50
+	}
+	self.Pagination = dialect.Dialect{PageNo: 0, PageSize: size, Spilled: true, IsOffset: true, IsKeyset: true, Cursor: cursor}
+	return self
+}
+
+// 缓存查询结果集, FindOne/FindList/Count生效, 需数据源配置CacheManager
+// key为空时按查询条件自动生成, expire为缓存时间/秒, 默认60, 同表执行写操作后自动失效
+func (self *Cnd) Cache(key string, expire int) *Cnd {
 	self.CacheConfig.Open = true
+	self.CacheConfig.Key = key
+	self.CacheConfig.Expire = expire
 	return self
 }
 
@@ -499,6 +619,18 @@ func (self *Cnd) Upset(keys []string, values ...interface{}) *Cnd {
 	return self
 }
 
+// 指定字段按原生SQL表达式更新, 如 UpsetExpr("balance", "balance + ?", amount), 仅关系数据库支持
+func (self *Cnd) UpsetExpr(key string, sql string, values ...interface{}) *Cnd {
+	if len(key) == 0 || len(sql) == 0 {
+		return self
+	}
+	if self.Upsets == nil {
+		self.Upsets = make(map[string]interface{}, 2)
+	}
+	self.Upsets[key] = Expr{Sql: sql, Values: values}
+	return self
+}
+
 func (self *Cnd) GetPageResult() dialect.PageResult {
 	return self.Pagination.GetResult()
 }
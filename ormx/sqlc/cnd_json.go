@@ -0,0 +1,306 @@
+package sqlc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 查询条件JSON序列化, 用于前端或其他服务传递查询条件后由FindList执行
+// 仅支持比较/范围/in/like/or/and条件、查询字段、排序及分页(含游标分页), Raw/Join/聚合/更新字段等不可序列化
+// ParseCnd按模型json/bson字段名校验条件字段, 忽略字段、加密字段及脱敏字段不可查询, 条件值仅允许字符串/数字/布尔
+// 未指定pageSize时按默认条数分页, pageSize超过最大条数时返回错误, 避免无限制查询
+
+const (
+	cndJsonMaxConditions = 100  // 最大条件数量, 含子条件
+	cndJsonMaxDepth      = 3    // or/and最大嵌套层级
+	cndJsonMaxValues     = 1000 // in/not in最大参数数量
+	cndJsonPageSize      = 20   // 默认分页条数
+	cndJsonMaxPageSize   = 1000 // 最大分页条数
+)
+
+var (
+	cndJsonOps = map[int]string{
+		EQ_: "eq", NOT_EQ_: "ne", LT_: "lt", LTE_: "lte", GT_: "gt", GTE_: "gte",
+		IS_NULL_: "null", IS_NOT_NULL_: "notNull", BETWEEN_: "between", BETWEEN2_: "inDate", NOT_BETWEEN_: "notBetween",
+		IN_: "in", NOT_IN_: "notIn", LIKE_: "like", NOT_LIKE_: "notLike", OR_: "or", AND_: "and",
+	}
+	cndJsonLogics = func() map[string]int {
+		result := make(map[string]int, len(cndJsonOps))
+		for k, v := range cndJsonOps {
+			result[v] = k
+		}
+		return result
+	}()
+	cndJsonFields sync.Map // reflect.Type -> map[string]bool
+)
+
+type cndJson struct {
+	Conditions []*condJson  `json:"conditions,omitempty"`
+	Fields     []string     `json:"fields,omitempty"`
+	Orderbys   []*orderJson `json:"orderBy,omitempty"`
+	PageNo     int64        `json:"pageNo,omitempty"`
+	PageSize   int64        `json:"pageSize,omitempty"`
+	Offset     bool         `json:"offset,omitempty"` // PageNo为下标
+	Keyset     bool         `json:"keyset,omitempty"` // 游标分页, 按PageSize截取
+	Cursor     string       `json:"cursor,omitempty"` // 游标分页当前游标
+}
+
+type condJson struct {
+	Op     string        `json:"op"`
+	Key    string        `json:"key,omitempty"`
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+	Subs   []*cndJson    `json:"subs,omitempty"` // or/and子条件
+}
+
+type orderJson struct {
+	Key  string `json:"key"`
+	Sort string `json:"sort"` // asc/desc
+}
+
+// MarshalJSON 序列化查询条件, 包含不可序列化的条件时返回错误, 避免接收方放宽查询范围
+func (self *Cnd) MarshalJSON() ([]byte, error) {
+	data, err := encodeCndJson(self)
+	if err != nil {
+		return nil, err
+	}
+	if self.Pagination.IsFastPage {
+		return nil, errors.New("cnd json unsupported fast page")
+	}
+	if self.Pagination.IsKeyset {
+		data.PageSize = self.Pagination.PageSize
+		data.Keyset = true
+		data.Cursor = self.Pagination.Cursor
+	} else if self.Pagination.IsPage {
+		data.PageNo = self.Pagination.PageNo
+		data.PageSize = self.Pagination.PageSize
+		data.Offset = self.Pagination.IsOffset
+	}
+	data.Fields = self.AnyFields
+	for _, v := range self.Orderbys {
+		sort := "asc"
+		if v.Value == DESC_ {
+			sort = "desc"
+		}
+		data.Orderbys = append(data.Orderbys, &orderJson{Key: v.Key, Sort: sort})
+	}
+	return json.Marshal(data)
+}
+
+func encodeCndJson(cnd *Cnd) (*cndJson, error) {
+	if len(cnd.ConditPart) > 0 || len(cnd.JoinCond) > 0 || cnd.FromCond != nil || len(cnd.Aggregates) > 0 || len(cnd.Groupbys) > 0 || len(cnd.Upsets) > 0 {
+		return nil, errors.New("cnd json only supports query conditions")
+	}
+	data := &cndJson{}
+	for _, v := range cnd.Conditions {
+		op, ok := cndJsonOps[v.Logic]
+		if !ok {
+			return nil, fmt.Errorf("cnd json unsupported condition: %d", v.Logic)
+		}
+		condit := &condJson{Op: op, Key: v.Key, Value: v.Value}
+		if v.Logic == OR_ || v.Logic == AND_ {
+			for _, sub := range v.Values {
+				c, ok := sub.(*Cnd)
+				if !ok {
+					return nil, errors.New("cnd json sub condition must be *Cnd")
+				}
+				subData, err := encodeCndJson(c)
+				if err != nil {
+					return nil, err
+				}
+				condit.Subs = append(condit.Subs, subData)
+			}
+		} else {
+			condit.Values = v.Values
+		}
+		data.Conditions = append(data.Conditions, condit)
+	}
+	return data, nil
+}
+
+// ParseCnd 解析JSON查询条件, 按模型字段校验条件/查询/排序字段, 分页参数按Limit/Offset规则修正
+func ParseCnd(data []byte, model Object) (*Cnd, error) {
+	if model == nil {
+		return nil, errors.New("cnd json model is nil")
+	}
+	fields, err := modelJsonFields(model)
+	if err != nil {
+		return nil, err
+	}
+	input := &cndJson{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(input); err != nil {
+		return nil, fmt.Errorf("cnd json invalid: %v", err)
+	}
+	cnd := M(model)
+	count := 0
+	if err := decodeCndJson(cnd, input, fields, 0, &count); err != nil {
+		return nil, err
+	}
+	for _, v := range input.Fields {
+		if !fields[v] {
+			return nil, fmt.Errorf("cnd json field invalid: %s", v)
+		}
+	}
+	cnd.Fields(input.Fields...)
+	for _, v := range input.Orderbys {
+		if !fields[v.Key] {
+			return nil, fmt.Errorf("cnd json order field invalid: %s", v.Key)
+		}
+		switch v.Sort {
+		case "asc", "":
+			cnd.Asc(v.Key)
+		case "desc":
+			cnd.Desc(v.Key)
+		default:
+			return nil, fmt.Errorf("cnd json order sort invalid: %s", v.Sort)
+		}
+	}
+	if input.PageSize < 0 || input.PageSize > cndJsonMaxPageSize {
+		return nil, fmt.Errorf("cnd json pageSize range [1-%d]: %d", cndJsonMaxPageSize, input.PageSize)
+	}
+	if input.PageSize == 0 {
+		input.PageSize = cndJsonPageSize
+	}
+	if input.Keyset {
+		cnd.After(input.Cursor, input.PageSize)
+	} else if input.Offset {
+		cnd.Offset(input.PageNo, input.PageSize)
+	} else {
+		cnd.Limit(input.PageNo, input.PageSize)
+	}
+	return cnd, nil
+}
+
+func decodeCndJson(cnd *Cnd, input *cndJson, fields map[string]bool, depth int, count *int) error {
+	if depth > cndJsonMaxDepth {
+		return errors.New("cnd json nested too deep")
+	}
+	if depth > 0 && (len(input.Fields) > 0 || len(input.Orderbys) > 0 || input.PageSize > 0 || input.Keyset) {
+		return errors.New("cnd json sub condition only supports conditions")
+	}
+	for _, v := range input.Conditions {
+		if *count++; *count > cndJsonMaxConditions {
+			return errors.New("cnd json too many conditions")
+		}
+		logic, ok := cndJsonLogics[v.Op]
+		if !ok {
+			return fmt.Errorf("cnd json operator invalid: %s", v.Op)
+		}
+		if logic == OR_ || logic == AND_ {
+			if len(v.Subs) == 0 {
+				return fmt.Errorf("cnd json %s sub condition is nil", v.Op)
+			}
+			subs := make([]interface{}, 0, len(v.Subs))
+			for _, sub := range v.Subs {
+				c := &Cnd{Escape: cnd.Escape}
+				if err := decodeCndJson(c, sub, fields, depth+1, count); err != nil {
+					return err
+				}
+				subs = append(subs, c)
+			}
+			if logic == OR_ {
+				cnd.Or(subs...)
+			} else {
+				cnd.And(subs...)
+			}
+			continue
+		}
+		if !fields[v.Key] {
+			return fmt.Errorf("cnd json condition field invalid: %s", v.Key)
+		}
+		if err := addCndJson(cnd, logic, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addCndJson(cnd *Cnd, logic int, v *condJson) error {
+	switch logic {
+	case IS_NULL_:
+		cnd.IsNull(v.Key)
+		return nil
+	case IS_NOT_NULL_:
+		cnd.IsNotNull(v.Key)
+		return nil
+	case BETWEEN_, BETWEEN2_, NOT_BETWEEN_:
+		if len(v.Values) != 2 {
+			return fmt.Errorf("cnd json %s requires 2 values: %s", v.Op, v.Key)
+		}
+	case IN_, NOT_IN_:
+		if len(v.Values) == 0 || len(v.Values) > cndJsonMaxValues {
+			return fmt.Errorf("cnd json %s values size invalid: %s", v.Op, v.Key)
+		}
+	default:
+		value, err := cndJsonValue(v.Value)
+		if err != nil {
+			return fmt.Errorf("cnd json %s value invalid: %s %v", v.Op, v.Key, err)
+		}
+		addDefaultCondit(cnd, Condition{Logic: logic, Key: v.Key, Value: value})
+		return nil
+	}
+	values := make([]interface{}, len(v.Values))
+	for i, value := range v.Values {
+		result, err := cndJsonValue(value)
+		if err != nil {
+			return fmt.Errorf("cnd json %s value invalid: %s %v", v.Op, v.Key, err)
+		}
+		values[i] = result
+	}
+	addDefaultCondit(cnd, Condition{Logic: logic, Key: v.Key, Values: values})
+	return nil
+}
+
+// 条件值仅允许标量, 避免对象值被mongo解析为操作符
+func cndJsonValue(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case string, bool:
+		return n, nil
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		if f, err := n.Float64(); err == nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("number %s", n.String())
+	case nil:
+		return nil, errors.New("value is nil")
+	}
+	return nil, fmt.Errorf("type %T", v)
+}
+
+// 模型可查询字段, 包含json及bson字段名, 排除ignore、加密及脱敏字段, 避免通过like等条件探测脱敏前的值
+func modelJsonFields(model Object) (map[string]bool, error) {
+	tof := reflect.TypeOf(model)
+	if cache, ok := cndJsonFields.Load(tof); ok {
+		return cache.(map[string]bool), nil
+	}
+	if tof.Kind() != reflect.Ptr || tof.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("cnd json model must be struct pointer")
+	}
+	elem := tof.Elem()
+	fields := make(map[string]bool, elem.NumField()*2)
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		if field.Tag.Get(Ignore) == True || len(field.Tag.Get(Encrypt)) > 0 || len(field.Tag.Get(Mask)) > 0 {
+			continue
+		}
+		for _, tag := range []string{Json, Bson} {
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if len(name) > 0 && name != "-" {
+				fields[name] = true
+			}
+		}
+	}
+	cndJsonFields.Store(tof, fields)
+	return fields, nil
+}
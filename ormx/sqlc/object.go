@@ -1,5 +1,7 @@
 package sqlc
 
+import "context"
+
 type Index struct {
 	Name   string
 	Key    []string
@@ -12,6 +14,31 @@ type Object interface {
 	NewIndex() []Index
 }
 
+// 模型生命周期回调, 模型按需实现, 关系数据库开启事务时在事务内执行, 返回错误时中止操作
+type BeforeSave interface {
+	BeforeSave(ctx context.Context) error
+}
+
+type AfterSave interface {
+	AfterSave(ctx context.Context) error
+}
+
+type BeforeUpdate interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+type AfterUpdate interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+type BeforeDelete interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+type AfterDelete interface {
+	AfterDelete(ctx context.Context) error
+}
+
 type DefaultObject struct{}
 
 func (o *DefaultObject) GetTable() string {
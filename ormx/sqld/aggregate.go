@@ -0,0 +1,279 @@
+package sqld
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// 聚合查询, cnd.Sum/Avg/Max/Min/Agg指定聚合字段, cnd.Groupby指定分组字段
+// 结果按分组字段名及聚合别名写入data, data为切片指针时写入全部分组, 为对象或map指针时写入首行
+
+const cacheKindAgg = "agg"
+
+var aggregateFuncs = map[int]string{
+	sqlc.SUM_: "sum",
+	sqlc.AVG_: "avg",
+	sqlc.MIN_: "min",
+	sqlc.MAX_: "max",
+	sqlc.CNT_: "count",
+}
+
+// 按条件执行聚合查询
+func (self *RDBManager) FindAggregate(cnd *sqlc.Cnd, data interface{}) (err error) {
+	if data == nil {
+		return self.Error("[Mysql.FindAggregate] data is nil")
+	}
+	if cnd.Model == nil {
+		return self.Error("[Mysql.FindAggregate] model is nil")
+	}
+	if len(cnd.Aggregates) == 0 {
+		return self.Error("[Mysql.FindAggregate] aggregate fields is nil")
+	}
+	obv, ok := modelDrivers[cnd.Model.GetTable()]
+	if !ok {
+		return self.Error("[Mysql.FindAggregate] registration object type not found [", cnd.Model.GetTable(), "]")
+	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return self.Error("[Mysql.FindAggregate] ", err)
+	}
+	defer softDeleteScope(obv, cnd)()
+	cacheKey, useCache := self.queryCacheKey(cnd, obv.TableName, cacheKindAgg)
+	if useCache {
+		if _, hit := self.getQueryCache(cacheKey, data); hit {
+			return nil
+		}
+	}
+	columns := make([]string, 0, len(cnd.Groupbys)+len(cnd.Aggregates))
+	numbers := make([]bool, 0, len(cnd.Groupbys)+len(cnd.Aggregates))
+	fpart := bytes.NewBuffer(make([]byte, 0, 32*cap(columns)))
+	for _, v := range cnd.Groupbys {
+		fpart.Write(self.BuildCondKey(cnd, v))
+		fpart.WriteString(",")
+		columns = append(columns, v)
+		numbers = append(numbers, isNumberField(obv, v))
+	}
+	for _, v := range cnd.Aggregates {
+		fn, ok := aggregateFuncs[v.Logic]
+		if !ok {
+			return self.Error("[Mysql.FindAggregate] aggregate type invalid: ", v.Logic)
+		}
+		fpart.WriteString(" ")
+		fpart.WriteString(fn)
+		fpart.WriteString("(")
+		if v.Key == "*" {
+			fpart.WriteString(v.Key)
+		} else {
+			fpart.Write(self.BuildCondKey(cnd, v.Key))
+		}
+		fpart.WriteString(") as `")
+		fpart.WriteString(v.Alias)
+		fpart.WriteString("`,")
+		columns = append(columns, v.Alias)
+		numbers = append(numbers, true)
+	}
+	case_part, case_arg := self.BuildWhereCase(cnd)
+	parameter := make([]interface{}, 0, len(case_arg))
+	for _, v := range case_arg {
+		parameter = append(parameter, v)
+	}
+	var vpart *bytes.Buffer
+	if case_part.Len() > 0 {
+		vpart = bytes.NewBuffer(make([]byte, 0, case_part.Len()+16))
+		vpart.WriteString("where")
+		str := case_part.String()
+		vpart.WriteString(utils.Substr(str, 0, len(str)-3))
+	}
+	str1 := utils.Bytes2Str(fpart.Bytes())
+	str2 := ""
+	if vpart != nil {
+		str2 = utils.Bytes2Str(vpart.Bytes())
+	}
+	groupby := self.BuildGroupBy(cnd)
+	sortby := self.BuildSortBy(cnd)
+	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str1)+len(str2)+len(groupby)+len(sortby)+32))
+	sqlbuf.WriteString("select")
+	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
+	sqlbuf.WriteString(" from ")
+	sqlbuf.WriteString(table)
+	sqlbuf.WriteString(" ")
+	if len(str2) > 0 {
+		sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
+	}
+	if len(groupby) > 0 {
+		sqlbuf.WriteString(groupby)
+	}
+	if len(sortby) > 0 {
+		sqlbuf.WriteString(sortby)
+	}
+	prepare, err := self.BuildPagination(cnd, utils.Bytes2Str(sqlbuf.Bytes()), parameter)
+	if err != nil {
+		return self.Error(err)
+	}
+	if zlog.IsDebug() {
+		defer zlog.Debug("[Mysql.FindAggregate] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
+	}
+	defer self.writeSlowLog("[Mysql.FindAggregate]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
+	defer cancel()
+	var stmt *sql.Stmt
+	var rows *sql.Rows
+	stmt, err = self.prepareContext(ctx, prepare)
+	if err != nil {
+		return self.Error("[Mysql.FindAggregate] [ ", prepare, " ] prepare failed: ", err)
+	}
+	defer stmt.Close()
+	rows, err = stmt.QueryContext(ctx, parameter...)
+	if err != nil {
+		return self.Error("[Mysql.FindAggregate] query failed: ", err)
+	}
+	defer rows.Close()
+	out, err := OutDest(rows, len(columns))
+	if err != nil {
+		return self.Error("[Mysql.FindAggregate] read result failed: ", err)
+	}
+	result := make([]map[string]interface{}, 0, len(out))
+	for _, v := range out {
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col] = aggregateValue(v[i], numbers[i])
+		}
+		result = append(result, row)
+	}
+	if err := decodeAggregate(result, data); err != nil {
+		return self.Error("[Mysql.FindAggregate] ", err)
+	}
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{}, data)
+	}
+	return nil
+}
+
+// 按条件执行聚合查询, 使用$match/$group/$project/$sort/$limit管道
+func (self *MGOManager) FindAggregate(cnd *sqlc.Cnd, data interface{}) error {
+	if data == nil {
+		return self.Error("[Mongo.FindAggregate] data is nil")
+	}
+	if cnd.Model == nil {
+		return self.Error("[Mongo.FindAggregate] data model is nil")
+	}
+	if len(cnd.Aggregates) == 0 {
+		return self.Error("[Mongo.FindAggregate] aggregate fields is nil")
+	}
+	if err := checkMongoRaw(cnd); err != nil {
+		return self.Error(err)
+	}
+	defer softDeleteScope(modelDrivers[cnd.Model.GetTable()], cnd)()
+	cacheKey, useCache := self.queryCacheKey(cnd, cnd.Model.GetTable(), cacheKindAgg)
+	if useCache {
+		if _, hit := self.getQueryCache(cacheKey, data); hit {
+			return nil
+		}
+	}
+	db, err := self.GetDatabase(cnd.Model.GetTable(), cnd)
+	if err != nil {
+		return self.Error(err)
+	}
+	pipe := make([]interface{}, 0, 6)
+	if match := buildMongoMatch(cnd); len(match) > 0 {
+		pipe = append(pipe, bson.M{"$match": match})
+	}
+	for _, v := range buildMongoAggregate(cnd) {
+		pipe = append(pipe, v)
+	}
+	if len(cnd.Orderbys) > 0 {
+		sortBy := bson.D{}
+		for _, v := range cnd.Orderbys {
+			if v.Value == sqlc.DESC_ {
+				sortBy = append(sortBy, bson.E{Key: v.Key, Value: -1})
+			} else {
+				sortBy = append(sortBy, bson.E{Key: v.Key, Value: 1})
+			}
+		}
+		pipe = append(pipe, bson.M{"$sort": sortBy})
+	}
+	if cnd.LimitSize > 0 {
+		pipe = append(pipe, bson.M{"$limit": cnd.LimitSize})
+	}
+	defer self.writeLog("[Mongo.FindAggregate]", utils.UnixMilli(), pipe, nil)
+	cur, err := db.Aggregate(self.GetSessionContext(), pipe)
+	if err != nil {
+		return self.Error("[Mongo.FindAggregate] query failed: ", err)
+	}
+	var result []map[string]interface{}
+	if err := cur.All(self.GetSessionContext(), &result); err != nil {
+		return self.Error("[Mongo.FindAggregate] read result failed: ", err)
+	}
+	if err := decodeAggregate(result, data); err != nil {
+		return self.Error("[Mongo.FindAggregate] ", err)
+	}
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{}, data)
+	}
+	return nil
+}
+
+// 模型中对应字段是否为数值类型
+func isNumberField(obv *MdlDriver, key string) bool {
+	for _, v := range obv.FieldElem {
+		if v.FieldJsonName != key {
+			continue
+		}
+		switch v.FieldKind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// 数值结果保持原始精度输出, 避免decimal转float丢失精度
+func aggregateValue(b []byte, number bool) interface{} {
+	if b == nil {
+		return nil
+	}
+	s := string(b)
+	if number {
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	}
+	return s
+}
+
+// 按字段名写入结果, data为切片指针写入全部, 否则写入首行
+func decodeAggregate(result []map[string]interface{}, data interface{}) error {
+	rv := reflect.ValueOf(data)
+	if rv.Kind() != reflect.Ptr {
+		return utils.Error("target value kind not ptr")
+	}
+	var value interface{} = result
+	if rv.Elem().Kind() != reflect.Slice {
+		if len(result) == 0 {
+			return nil
+		}
+		value = result[0]
+	} else if len(result) == 0 {
+		value = []map[string]interface{}{}
+	}
+	bs, err := utils.JsonMarshal(value)
+	if err != nil {
+		return utils.Error("marshal result failed: ", err)
+	}
+	if err := utils.JsonUnmarshal(bs, data); err != nil {
+		return utils.Error("unmarshal result failed: ", err)
+	}
+	return nil
+}
@@ -0,0 +1,804 @@
+package sqld
+
+import (
+	"context"
+	"encoding/json"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 数据审计, 开启后记录Save/Update/Delete等写操作的前后镜像及字段差异, 操作人通过WithAuditUser写入Option.Context
+// 开启BeforeImage时按主键更新/删除前读取变更前数据并记录差异, 否则仅记录变更后数据及主键, 按条件更新/删除时仅记录条件及影响条数
+// 审计表与业务数据位于同一关系数据源时, 事务中的记录在提交前于同一事务写入, 与业务数据同时提交或回滚
+// 其他记录进入内存队列由后台任务批量写入审计表/集合, 队列已满时丢弃并计入freego_audit_entries_total{result="dropped"}, 不阻塞业务写操作
+// 加密字段以******记录, 不写入明文
+
+const (
+	AuditSave        = "save"
+	AuditUpdate      = "update"
+	AuditDelete      = "delete"
+	AuditUpdateByCnd = "update_by_cnd"
+	AuditDeleteByCnd = "delete_by_cnd"
+)
+
+const auditMaxLimit = 1000
+
+// AuditConfig 审计配置
+type AuditConfig struct {
+	DsName      string   // 审计表所在数据源, 默认master
+	Mongo       bool     // 写入mongo集合, 默认写入关系数据库表
+	Table       string   // 审计表/集合名, 默认audit_log
+	Models      []string // 审计的模型表名, 为空则审计全部模型
+	BufferSize  int      // 队列长度, 默认10000
+	BatchSize   int      // 单次写入条数, 默认200
+	Interval    int64    // 写入间隔/毫秒, 默认1000
+	Retention   int64    // 记录保留天数, 默认180
+	BeforeImage bool     // 记录变更前镜像及字段差异, 每次按主键更新/删除增加一次主键查询, 默认关闭
+}
+
+// AuditEntry 审计记录
+type AuditEntry struct {
+	Id       int64                     `json:"id" bson:"_id"`
+	Model    string                    `json:"model" bson:"model"`
+	Action   string                    `json:"action" bson:"action"`
+	RecordId string                    `json:"recordId" bson:"recordId"`
+	User     string                    `json:"user" bson:"user"`
+	Trace    string                    `json:"trace" bson:"trace"`
+	Before   map[string]interface{}    `json:"before,omitempty" bson:"before,omitempty"`
+	After    map[string]interface{}    `json:"after,omitempty" bson:"after,omitempty"`
+	Diff     map[string][2]interface{} `json:"diff,omitempty" bson:"diff,omitempty"` // 字段名 -> [变更前, 变更后]
+	Cnd      interface{}               `json:"cnd,omitempty" bson:"cnd,omitempty"`
+	Affected int64                     `json:"affected" bson:"affected"`
+	Ctime    int64                     `json:"ctime" bson:"ctime"`
+}
+
+// AuditQuery 审计查询条件, 按ID倒序返回
+type AuditQuery struct {
+	Model     string
+	RecordId  string
+	User      string
+	Action    string
+	StartTime int64 // 开始时间/毫秒
+	EndTime   int64 // 结束时间/毫秒
+	LastId    int64 // 翻页时传入上一页最后一条记录ID
+	Limit     int   // 默认20, 最大1000
+}
+
+// AuditStat 审计统计
+type AuditStat struct {
+	Queued  int64 // 队列中条数
+	Written int64 // 累计写入条数
+	Dropped int64 // 累计队列已满丢弃条数
+	Failed  int64 // 累计写入失败条数
+}
+
+type auditUserContextKey struct{}
+
+type auditWriter struct {
+	config  AuditConfig
+	models  map[string]bool
+	queue   chan *AuditEntry
+	stop    chan struct{}
+	done    chan struct{}
+	written int64
+	dropped int64
+	failed  int64
+}
+
+var (
+	auditMu      sync.RWMutex
+	currentAudit *auditWriter
+)
+
+// WithAuditUser 将操作人写入上下文, 通过Option.Context传入数据库管理器后记录到审计日志
+func WithAuditUser(ctx context.Context, user string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, auditUserContextKey{}, user)
+}
+
+// AuditUserFromContext 获取上下文中的操作人
+func AuditUserFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	user, _ := ctx.Value(auditUserContextKey{}).(string)
+	return user
+}
+
+// EnableAudit 开启数据审计并启动后台写入任务, MySQL数据源自动创建审计表, mongo自动创建索引
+func EnableAudit(config AuditConfig) error {
+	if len(config.DsName) == 0 {
+		config.DsName = DIC.MASTER
+	}
+	if len(config.Table) == 0 {
+		config.Table = "audit_log"
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 10000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 200
+	}
+	if config.Interval <= 0 {
+		config.Interval = 1000
+	}
+	if config.Retention <= 0 {
+		config.Retention = 180
+	}
+	if config.Mongo {
+		if err := createAuditIndex(config); err != nil {
+			return err
+		}
+	} else if err := createAuditTable(config); err != nil {
+		return err
+	}
+	writer := &auditWriter{config: config, queue: make(chan *AuditEntry, config.BufferSize), stop: make(chan struct{}), done: make(chan struct{})}
+	if len(config.Models) > 0 {
+		writer.models = make(map[string]bool, len(config.Models))
+		for _, v := range config.Models {
+			writer.models[v] = true
+		}
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if currentAudit != nil {
+		return utils.Error("[Audit] already enabled")
+	}
+	currentAudit = writer
+	go currentAudit.run()
+	return nil
+}
+
+// StopAudit 停止审计并写入队列中剩余记录
+func StopAudit() {
+	auditMu.Lock()
+	writer := currentAudit
+	currentAudit = nil
+	auditMu.Unlock()
+	if writer != nil {
+		close(writer.stop)
+		<-writer.done
+	}
+}
+
+// AuditStats 获取审计统计, 未开启时返回零值
+func AuditStats() AuditStat {
+	writer := getAuditWriter()
+	if writer == nil {
+		return AuditStat{}
+	}
+	return AuditStat{
+		Queued:  int64(len(writer.queue)),
+		Written: atomic.LoadInt64(&writer.written),
+		Dropped: atomic.LoadInt64(&writer.dropped),
+		Failed:  atomic.LoadInt64(&writer.failed),
+	}
+}
+
+func getAuditWriter() *auditWriter {
+	auditMu.RLock()
+	defer auditMu.RUnlock()
+	return currentAudit
+}
+
+func createAuditTable(config AuditConfig) error {
+	db := &RDBManager{}
+	if err := db.GetDB(Option{DsName: config.DsName}); err != nil {
+		return err
+	}
+	if len(db.Driver) > 0 && db.Driver != MYSQL {
+		return nil
+	}
+	if _, err := db.Db.Exec(utils.AddStr("CREATE TABLE IF NOT EXISTS `", config.Table, "` (",
+		"`id` BIGINT NOT NULL PRIMARY KEY,",
+		"`model` VARCHAR(128) NOT NULL,",
+		"`action` VARCHAR(32) NOT NULL,",
+		"`record_id` VARCHAR(64) NOT NULL DEFAULT '',",
+		"`user` VARCHAR(128) NOT NULL DEFAULT '',",
+		"`trace` VARCHAR(64) NOT NULL DEFAULT '',",
+		"`before_image` MEDIUMTEXT,",
+		"`after_image` MEDIUMTEXT,",
+		"`diff` MEDIUMTEXT,",
+		"`cnd` TEXT,",
+		"`affected` BIGINT NOT NULL DEFAULT 0,",
+		"`ctime` BIGINT NOT NULL DEFAULT 0,",
+		"INDEX `idx_model_record` (`model`, `record_id`),",
+		"INDEX `idx_user` (`user`),",
+		"INDEX `idx_ctime` (`ctime`)",
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")); err != nil {
+		return utils.Error("[Audit] create table failed: ", err)
+	}
+	return nil
+}
+
+func createAuditIndex(config AuditConfig) error {
+	mgo, err := NewMongo(Option{DsName: config.DsName})
+	if err != nil {
+		return err
+	}
+	defer mgo.Close()
+	db, err := mgo.GetDatabase(config.Table)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Indexes().CreateMany(mgo.PackContext.Context, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "model", Value: 1}, {Key: "recordId", Value: 1}}},
+		{Keys: bson.D{{Key: "user", Value: 1}}},
+		{Keys: bson.D{{Key: "ctime", Value: 1}}},
+	}); err != nil {
+		return utils.Error("[Audit] create index failed: ", err)
+	}
+	return nil
+}
+
+// 模型是否需要审计
+func auditEnabled(table string) bool {
+	writer := getAuditWriter()
+	if writer == nil {
+		return false
+	}
+	return writer.models == nil || writer.models[table]
+}
+
+// 事务中暂存审计记录, 提交前写入或提交后入队; 未开启事务时直接入队
+func (self *DBManager) addAudit(tx bool, entries ...*AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	if tx {
+		self.auditEntries = append(self.auditEntries, entries...)
+		return
+	}
+	submitAudit(entries...)
+}
+
+// 事务提交后入队暂存的审计记录
+func (self *DBManager) flushAudit() {
+	if len(self.auditEntries) == 0 {
+		return
+	}
+	submitAudit(self.auditEntries...)
+	self.auditEntries = nil
+}
+
+func submitAudit(entries ...*AuditEntry) {
+	writer := getAuditWriter()
+	if writer == nil {
+		return
+	}
+	for _, v := range entries {
+		select {
+		case writer.queue <- v:
+		default:
+			promx.ObserveAudit("dropped", 1)
+			if atomic.AddInt64(&writer.dropped, 1)%1000 == 1 {
+				zlog.Warn("[Audit] queue full, entry dropped", 0, zlog.String("model", v.Model), zlog.String("action", v.Action), zlog.String("recordId", v.RecordId))
+			}
+		}
+	}
+}
+
+// 创建审计记录, 操作人及trace_id从上下文读取
+func (self *DBManager) newAudit(obv *MdlDriver, action string, before, after sqlc.Object) *AuditEntry {
+	ctx := self.baseContext()
+	trace, _ := zlog.TraceFromContext(ctx)
+	entry := &AuditEntry{Id: utils.NextIID(), Model: obv.TableName, Action: action, User: AuditUserFromContext(ctx), Trace: trace, Affected: 1, Ctime: utils.UnixMilli()}
+	if before != nil {
+		entry.Before = auditImage(obv, before)
+		entry.RecordId = auditRecordId(obv, before)
+	}
+	if after != nil {
+		entry.After = auditImage(obv, after)
+		entry.RecordId = auditRecordId(obv, after)
+	}
+	if entry.Before != nil && entry.After != nil {
+		entry.Diff = make(map[string][2]interface{})
+		for k, v := range entry.After {
+			if old := entry.Before[k]; !reflect.DeepEqual(old, v) {
+				entry.Diff[k] = [2]interface{}{old, v}
+			}
+		}
+	}
+	return entry
+}
+
+// 创建按条件更新/删除的审计记录
+func (self *DBManager) newCndAudit(obv *MdlDriver, action string, cnd *sqlc.Cnd, affected int64) *AuditEntry {
+	entry := self.newAudit(obv, action, nil, nil)
+	entry.Affected = affected
+	data := encodeOutboxCnd(cnd)
+	if data != nil && len(data.Upsets) > 0 {
+		upsets := make(map[string]interface{}, len(data.Upsets))
+		for k, v := range data.Upsets {
+			upsets[k] = v
+			for _, f := range obv.FieldElem {
+				if len(f.Encrypt) > 0 && (k == f.FieldJsonName || k == f.FieldBsonName) {
+					upsets[k] = maskAll
+					break
+				}
+			}
+		}
+		data.Upsets = upsets
+	}
+	entry.Cnd = data
+	return entry
+}
+
+// 对象字段镜像, 键为json字段名, 加密字段非空时记录为******
+func auditImage(obv *MdlDriver, obj sqlc.Object) map[string]interface{} {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	image := make(map[string]interface{}, len(obv.FieldElem))
+	for _, f := range obv.FieldElem {
+		if f.Ignore {
+			continue
+		}
+		field := value.FieldByName(f.FieldName)
+		if !field.IsValid() || !field.CanInterface() {
+			continue
+		}
+		if len(f.Encrypt) > 0 && !field.IsZero() {
+			image[f.FieldJsonName] = maskAll
+			continue
+		}
+		image[f.FieldJsonName] = field.Interface()
+	}
+	return image
+}
+
+func auditRecordId(obv *MdlDriver, obj sqlc.Object) string {
+	if len(obv.PkName) == 0 {
+		return ""
+	}
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	for _, f := range obv.FieldElem {
+		if f.Primary {
+			return auditIdString(value.FieldByName(f.FieldName).Interface())
+		}
+	}
+	return ""
+}
+
+func auditIdString(id interface{}) string {
+	if oid, ok := id.(interface{ Hex() string }); ok { // primitive.ObjectID
+		return oid.Hex()
+	}
+	return utils.AnyToStr(id)
+}
+
+// 是否读取变更前镜像
+func auditBeforeImage() bool {
+	writer := getAuditWriter()
+	return writer != nil && writer.config.BeforeImage
+}
+
+// 按主键读取变更前数据, 未开启BeforeImage时返回nil, 读取失败不影响写操作及事务
+func (self *RDBManager) auditBefore(obv *MdlDriver, data sqlc.Object) sqlc.Object {
+	if !auditBeforeImage() {
+		return nil
+	}
+	before := obv.Object.NewObject()
+	reflect.ValueOf(before).Elem().Set(reflect.ValueOf(data).Elem()) // 复制主键及分表键
+	size, notFound := len(self.Errors), self.NotFound
+	self.NotFound = true
+	err := self.FindById(before)
+	self.Errors, self.NotFound = self.Errors[:size], notFound
+	if err != nil {
+		if err != ErrNotFound {
+			zlog.Warn("[Audit] read before image failed", 0, zlog.String("model", obv.TableName), zlog.AddError(err))
+		}
+		return nil
+	}
+	return before
+}
+
+// 删除操作审计记录, 开启BeforeImage时仅记录删除前存在的数据, 否则按主键记录
+func (self *DBManager) deleteAudits(obv *MdlDriver, befores []sqlc.Object, ids []interface{}) []*AuditEntry {
+	if !auditBeforeImage() {
+		entries := make([]*AuditEntry, 0, len(ids))
+		for _, v := range ids {
+			entry := self.newAudit(obv, AuditDelete, nil, nil)
+			entry.RecordId = auditIdString(v)
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+	entries := make([]*AuditEntry, 0, len(befores))
+	for _, v := range befores {
+		entries = append(entries, self.newAudit(obv, AuditDelete, v, nil))
+	}
+	return entries
+}
+
+// 按主键值创建对象, 用于DeleteById读取变更前数据
+func auditObjectById(obv *MdlDriver, id interface{}) sqlc.Object {
+	obj := obv.Object.NewObject()
+	switch obv.PkKind {
+	case reflect.Int64:
+		v, err := utils.StrToInt64(utils.AnyToStr(id))
+		if err != nil {
+			return nil
+		}
+		utils.SetInt64(utils.GetPtr(obj, obv.PkOffset), v)
+	case reflect.String:
+		utils.SetString(utils.GetPtr(obj, obv.PkOffset), utils.AnyToStr(id))
+	default:
+		return nil
+	}
+	return obj
+}
+
+// 按_id读取变更前数据, 未开启BeforeImage时返回nil, 读取失败不影响写操作
+func (self *MGOManager) auditBefore(obv *MdlDriver, db *mongo.Collection, id interface{}) sqlc.Object {
+	if !auditBeforeImage() {
+		return nil
+	}
+	before := obv.Object.NewObject()
+	if err := db.FindOne(self.GetSessionContext(), bson.M{"_id": id}).Decode(before); err != nil {
+		if err != mongo.ErrNoDocuments {
+			zlog.Warn("[Audit] read before image failed", 0, zlog.String("model", obv.TableName), zlog.AddError(err))
+		}
+		return nil
+	}
+	if err := decryptObject(obv, before); err != nil {
+		zlog.Warn("[Audit] decrypt before image failed", 0, zlog.String("model", obv.TableName), zlog.AddError(err))
+	}
+	return before
+}
+
+// 按_id读取删除前数据, 未开启审计或BeforeImage时返回nil
+func (self *MGOManager) auditBefores(obv *MdlDriver, db *mongo.Collection, ids []interface{}) []sqlc.Object {
+	if !self.auditable(obv.TableName) || !auditBeforeImage() {
+		return nil
+	}
+	befores := make([]sqlc.Object, 0, len(ids))
+	for _, id := range ids {
+		if before := self.auditBefore(obv, db, id); before != nil {
+			befores = append(befores, before)
+		}
+	}
+	return befores
+}
+
+// mongo同步数据(MGOSyncData非空)已由关系数据库记录, 不重复审计
+func (self *MGOManager) auditable(table string) bool {
+	return len(self.MGOSyncData) == 0 && auditEnabled(table)
+}
+
+// mongo事务中暂存审计记录
+func (self *MGOManager) inTx() bool {
+	return self.PackContext != nil && self.PackContext.SessionContext != nil
+}
+
+func (self *auditWriter) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(time.Duration(self.config.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	var lastClean int64
+	batch := make([]*AuditEntry, 0, self.config.BatchSize)
+	for {
+		select {
+		case <-self.stop:
+			for {
+				select {
+				case v := <-self.queue:
+					if batch = append(batch, v); len(batch) >= self.config.BatchSize {
+						self.write(batch)
+						batch = batch[:0]
+					}
+				default:
+					self.write(batch)
+					return
+				}
+			}
+		case v := <-self.queue:
+			if batch = append(batch, v); len(batch) >= self.config.BatchSize {
+				self.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			self.write(batch)
+			batch = batch[:0]
+			if now := utils.UnixMilli(); now-lastClean >= 3600000 { // 每小时清理过期记录
+				lastClean = now
+				if err := self.clean(now - self.config.Retention*86400000); err != nil {
+					zlog.Error("[Audit] clean failed", 0, zlog.AddError(err))
+				}
+			}
+		}
+	}
+}
+
+// 写入失败时记录日志并丢弃该批次, 避免阻塞队列
+func (self *auditWriter) write(batch []*AuditEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	var err error
+	if self.config.Mongo {
+		err = self.writeMongo(batch)
+	} else {
+		err = self.writeRDB(batch)
+	}
+	if err != nil {
+		atomic.AddInt64(&self.failed, int64(len(batch)))
+		promx.ObserveAudit("failed", len(batch))
+		zlog.Error("[Audit] write failed", 0, zlog.Int("size", len(batch)), zlog.AddError(err))
+		return
+	}
+	atomic.AddInt64(&self.written, int64(len(batch)))
+	promx.ObserveAudit("written", len(batch))
+}
+
+func (self *auditWriter) writeRDB(batch []*AuditEntry) error {
+	db := &RDBManager{}
+	if err := db.GetDB(Option{DsName: self.config.DsName}); err != nil {
+		return err
+	}
+	return insertAudit(db, self.config.Table, batch)
+}
+
+// 事务提交前在同一事务中写入暂存的审计记录, 仅审计表与业务数据位于同一关系数据源时生效, 写入失败时回滚事务
+func (self *RDBManager) writeTxAudit() error {
+	writer := getAuditWriter()
+	if writer == nil || writer.config.Mongo || writer.config.DsName != self.DsName || len(self.auditEntries) == 0 {
+		return nil
+	}
+	if self.Tx == nil {
+		return utils.Error("[Audit] transaction already closed")
+	}
+	entries := self.auditEntries
+	for start := 0; start < len(entries); start += writer.config.BatchSize {
+		end := start + writer.config.BatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := insertAudit(self, writer.config.Table, entries[start:end]); err != nil {
+			return utils.Error("[Audit] write in transaction failed: ", err)
+		}
+	}
+	self.auditEntries = nil
+	atomic.AddInt64(&writer.written, int64(len(entries)))
+	promx.ObserveAudit("written", len(entries))
+	return nil
+}
+
+func insertAudit(db *RDBManager, table string, batch []*AuditEntry) error {
+	parameter := make([]interface{}, 0, 12*len(batch))
+	values := make([]byte, 0, 28*len(batch))
+	for i, v := range batch {
+		if i > 0 {
+			values = append(values, ',')
+		}
+		values = append(values, "(?,?,?,?,?,?,?,?,?,?,?,?)"...)
+		parameter = append(parameter, v.Id, v.Model, v.Action, v.RecordId, v.User, v.Trace,
+			auditJson(v.Before), auditJson(v.After), auditJson(v.Diff), auditJson(v.Cnd), v.Affected, v.Ctime)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(db.Timeout)*time.Millisecond)
+	defer cancel()
+	_, err := db.execContext(ctx, utils.AddStr("insert into `", table, "` (`id`,`model`,`action`,`record_id`,`user`,`trace`,`before_image`,`after_image`,`diff`,`cnd`,`affected`,`ctime`) values ",
+		utils.Bytes2Str(values)), parameter...)
+	return err
+}
+
+func (self *auditWriter) writeMongo(batch []*AuditEntry) error {
+	mgo, err := NewMongo(Option{DsName: self.config.DsName})
+	if err != nil {
+		return err
+	}
+	defer mgo.Close()
+	db, err := mgo.GetDatabase(self.config.Table)
+	if err != nil {
+		return err
+	}
+	docs := make([]interface{}, len(batch))
+	for i, v := range batch {
+		docs[i] = v
+	}
+	_, err = db.InsertMany(mgo.PackContext.Context, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// 按创建时间分批删除过期记录
+func (self *auditWriter) clean(expire int64) error {
+	if self.config.Mongo {
+		mgo, err := NewMongo(Option{DsName: self.config.DsName})
+		if err != nil {
+			return err
+		}
+		defer mgo.Close()
+		db, err := mgo.GetDatabase(self.config.Table)
+		if err != nil {
+			return err
+		}
+		_, err = db.DeleteMany(mgo.PackContext.Context, bson.M{"ctime": bson.M{"$lt": expire}})
+		return err
+	}
+	db := &RDBManager{}
+	if err := db.GetDB(Option{DsName: self.config.DsName}); err != nil {
+		return err
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(db.Timeout)*time.Millisecond)
+		ret, err := db.execContext(ctx, utils.AddStr("delete from `", self.config.Table, "` where `ctime` < ? limit ?"), expire, self.config.BatchSize*10)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if affected, err := ret.RowsAffected(); err != nil || affected < int64(self.config.BatchSize*10) {
+			return err
+		}
+	}
+}
+
+// QueryAudit 查询审计记录, 按ID倒序返回, 翻页时传入上一页最后一条记录ID
+func QueryAudit(query AuditQuery) ([]*AuditEntry, error) {
+	writer := getAuditWriter()
+	if writer == nil {
+		return nil, utils.Error("[Audit] not enabled")
+	}
+	if query.Limit <= 0 {
+		query.Limit = 20
+	}
+	if query.Limit > auditMaxLimit {
+		query.Limit = auditMaxLimit
+	}
+	if writer.config.Mongo {
+		return queryMongoAudit(writer.config, query)
+	}
+	return queryRDBAudit(writer.config, query)
+}
+
+func queryRDBAudit(config AuditConfig, query AuditQuery) ([]*AuditEntry, error) {
+	db := &RDBManager{}
+	if err := db.GetDB(Option{DsName: config.DsName}); err != nil {
+		return nil, err
+	}
+	where := "1 = 1"
+	var parameter []interface{}
+	add := func(cond string, value interface{}) {
+		where = utils.AddStr(where, " and ", cond)
+		parameter = append(parameter, value)
+	}
+	if len(query.Model) > 0 {
+		add("`model` = ?", query.Model)
+	}
+	if len(query.RecordId) > 0 {
+		add("`record_id` = ?", query.RecordId)
+	}
+	if len(query.User) > 0 {
+		add("`user` = ?", query.User)
+	}
+	if len(query.Action) > 0 {
+		add("`action` = ?", query.Action)
+	}
+	if query.StartTime > 0 {
+		add("`ctime` >= ?", query.StartTime)
+	}
+	if query.EndTime > 0 {
+		add("`ctime` <= ?", query.EndTime)
+	}
+	if query.LastId > 0 {
+		add("`id` < ?", query.LastId)
+	}
+	parameter = append(parameter, query.Limit)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(db.Timeout)*time.Millisecond)
+	defer cancel()
+	rows, err := db.queryContext(ctx, utils.AddStr("select `id`,`model`,`action`,`record_id`,`user`,`trace`,`before_image`,`after_image`,`diff`,`cnd`,`affected`,`ctime` from `",
+		config.Table, "` where ", where, " order by `id` desc limit ?"), parameter...)
+	if err != nil {
+		return nil, utils.Error("[Audit] query failed: ", err)
+	}
+	defer rows.Close()
+	var result []*AuditEntry
+	for rows.Next() {
+		var before, after, diff, cnd []byte
+		entry := &AuditEntry{}
+		if err := rows.Scan(&entry.Id, &entry.Model, &entry.Action, &entry.RecordId, &entry.User, &entry.Trace, &before, &after, &diff, &cnd, &entry.Affected, &entry.Ctime); err != nil {
+			return nil, utils.Error("[Audit] read failed: ", err)
+		}
+		if err := auditUnmarshal(before, &entry.Before); err != nil {
+			return nil, err
+		}
+		if err := auditUnmarshal(after, &entry.After); err != nil {
+			return nil, err
+		}
+		if err := auditUnmarshal(diff, &entry.Diff); err != nil {
+			return nil, err
+		}
+		if err := auditUnmarshal(cnd, &entry.Cnd); err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.Error("[Audit] read failed: ", err)
+	}
+	return result, nil
+}
+
+func queryMongoAudit(config AuditConfig, query AuditQuery) ([]*AuditEntry, error) {
+	mgo, err := NewMongo(Option{DsName: config.DsName})
+	if err != nil {
+		return nil, err
+	}
+	defer mgo.Close()
+	db, err := mgo.GetDatabase(config.Table)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{}
+	if len(query.Model) > 0 {
+		filter["model"] = query.Model
+	}
+	if len(query.RecordId) > 0 {
+		filter["recordId"] = query.RecordId
+	}
+	if len(query.User) > 0 {
+		filter["user"] = query.User
+	}
+	if len(query.Action) > 0 {
+		filter["action"] = query.Action
+	}
+	ctime := bson.M{}
+	if query.StartTime > 0 {
+		ctime["$gte"] = query.StartTime
+	}
+	if query.EndTime > 0 {
+		ctime["$lte"] = query.EndTime
+	}
+	if len(ctime) > 0 {
+		filter["ctime"] = ctime
+	}
+	if query.LastId > 0 {
+		filter["_id"] = bson.M{"$lt": query.LastId}
+	}
+	cursor, err := db.Find(mgo.PackContext.Context, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(query.Limit)))
+	if err != nil {
+		return nil, utils.Error("[Audit] query failed: ", err)
+	}
+	var result []*AuditEntry
+	if err := cursor.All(mgo.PackContext.Context, &result); err != nil {
+		return nil, utils.Error("[Audit] read failed: ", err)
+	}
+	return result, nil
+}
+
+func auditJson(v interface{}) interface{} {
+	if value := reflect.ValueOf(v); !value.IsValid() || (value.Kind() == reflect.Map || value.Kind() == reflect.Ptr) && value.IsNil() {
+		return nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		zlog.Warn("[Audit] marshal failed", 0, zlog.AddError(err))
+		return nil
+	}
+	return utils.Bytes2Str(bs)
+}
+
+func auditUnmarshal(bs []byte, v interface{}) error {
+	if len(bs) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return utils.Error("[Audit] unmarshal failed: ", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"reflect"
+)
+
+// 自动写入时间, autotime:"create"字段在Save时为零值则写入当前时间, autotime:"update"字段在Save/Update/UpdateByCnd时写入当前时间
+// int64/int字段写入毫秒时间戳(date标签字段按ModelLocal时区格式写入), int32字段写入秒级时间戳, string字段按ModelLocal时区格式写入
+// UpdateByCnd未指定该字段时追加到更新字段; MongoSync按对象同步时沿用关系数据库已写入的时间, 按条件同步时取同步时的时间
+
+func parseAutoTime(md *MdlDriver, f *FieldElem, tag string) {
+	if len(tag) == 0 {
+		return
+	}
+	if tag != sqlc.AutoCreate && tag != sqlc.AutoUpdate {
+		panic("auto time invalid: " + md.TableName + "." + f.FieldName + " " + tag)
+	}
+	switch f.FieldKind {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.String:
+	default:
+		panic("auto time field must be int/int32/int64/string type: " + md.TableName + "." + f.FieldName)
+	}
+	if f.Primary || len(f.Encrypt) > 0 {
+		panic("auto time field can not be primary or encrypt: " + md.TableName + "." + f.FieldName)
+	}
+	f.AutoTime = tag
+	md.AutoTime = true
+}
+
+// 写入对象的自动时间字段, create为true时同时处理创建时间字段
+func setAutoTime(obv *MdlDriver, create bool, data ...sqlc.Object) {
+	if obv == nil || !obv.AutoTime {
+		return
+	}
+	now := utils.UnixMilli()
+	for _, v := range data {
+		for _, f := range obv.FieldElem {
+			if f.AutoTime == sqlc.AutoUpdate || (create && f.AutoTime == sqlc.AutoCreate && isZeroTime(v, f)) {
+				setTime(v, f, now)
+			}
+		}
+	}
+}
+
+func isZeroTime(obj sqlc.Object, f *FieldElem) bool {
+	ptr := utils.GetPtr(obj, f.FieldOffset)
+	switch f.FieldKind {
+	case reflect.Int:
+		return utils.GetInt(ptr) == 0
+	case reflect.Int32:
+		return utils.GetInt32(ptr) == 0
+	case reflect.Int64:
+		return utils.GetInt64(ptr) == 0
+	case reflect.String:
+		return len(utils.GetString(ptr)) == 0
+	}
+	return false
+}
+
+func setTime(obj sqlc.Object, f *FieldElem, now int64) {
+	ptr := utils.GetPtr(obj, f.FieldOffset)
+	switch f.FieldKind {
+	case reflect.Int:
+		utils.SetInt(ptr, int(now))
+	case reflect.Int32:
+		utils.SetInt32(ptr, int32(now/1000))
+	case reflect.Int64:
+		utils.SetInt64(ptr, now)
+	case reflect.String:
+		utils.SetString(ptr, utils.Time2FormatStr(now, fieldTime.local, fieldTime.fmt))
+	}
+}
+
+// 按条件更新时追加更新时间字段, 返回新的更新字段, 已指定该字段时不覆盖; mongo使用bson字段名, date标签仅对关系数据库生效
+func autoTimeUpsets(obv *MdlDriver, upsets map[string]interface{}, mongo bool) map[string]interface{} {
+	if obv == nil || !obv.AutoTime {
+		return upsets
+	}
+	var result map[string]interface{}
+	now := utils.UnixMilli()
+	for _, f := range obv.FieldElem {
+		if f.AutoTime != sqlc.AutoUpdate {
+			continue
+		}
+		key := f.FieldJsonName
+		if mongo {
+			key = f.FieldBsonName
+		}
+		if _, ok := upsets[key]; ok {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]interface{}, len(upsets)+1)
+			for k, v := range upsets {
+				result[k] = v
+			}
+		}
+		switch f.FieldKind {
+		case reflect.Int32:
+			result[key] = int32(now / 1000)
+		case reflect.String:
+			result[key] = utils.Time2FormatStr(now, fieldTime.local, fieldTime.fmt)
+		default:
+			if f.IsDate && !mongo {
+				result[key] = utils.Time2FormatStr(now, fieldTime.local, fieldTime.fmt)
+			} else {
+				result[key] = now
+			}
+		}
+	}
+	if result == nil {
+		return upsets
+	}
+	return result
+}
@@ -0,0 +1,203 @@
+package sqld
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/ex/errorsx"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrInsufficientFunds AddBalance扣减后余额小于0时返回该错误, 数据保持不变
+var ErrInsufficientFunds = errorsx.New(ex.BIZ, "insufficient funds")
+
+// 记录余额不足错误, 开启事务时Close自动回滚
+func (self *DBManager) insufficientFunds() error {
+	self.Errors = append(self.Errors, ErrInsufficientFunds)
+	return ErrInsufficientFunds
+}
+
+// 余额字段须为已注册模型的数值字段(关系数据库可为decimal字段), 不能为主键或加密字段
+func balanceField(obv *MdlDriver, field string, bsonKey bool) (*FieldElem, error) {
+	for _, v := range obv.FieldElem {
+		name := v.FieldJsonName
+		if bsonKey {
+			name = v.FieldBsonName
+		}
+		if v.Ignore || name != field {
+			continue
+		}
+		if v.Primary || len(v.Encrypt) > 0 {
+			return nil, utils.Error("balance field [", field, "] can't be primary key or encrypted")
+		}
+		switch v.FieldKind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			return v, nil
+		}
+		if !bsonKey && strings.HasPrefix(strings.ToLower(v.FieldDBType), "decimal") {
+			return v, nil
+		}
+		return nil, utils.Error("balance field [", field, "] must be number type")
+	}
+	return nil, utils.Error("balance field [", field, "] not found in [", obv.TableName, "]")
+}
+
+// 余额变更须包含主键等值条件, 仅更新单条数据
+func hasPkCondition(cnd *sqlc.Cnd, keys ...string) bool {
+	for _, v := range cnd.Conditions {
+		if v.Logic != sqlc.EQ_ || v.Value == nil {
+			continue
+		}
+		for _, k := range keys {
+			if len(k) > 0 && v.Key == k {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddBalance 原子增减余额字段, 执行 set field = field + delta where cnd and field + delta >= 0
+// cnd须包含主键等值条件, 仅更新单条数据, field须为模型已注册的数值字段
+// 无匹配数据返回ErrNotFound, 余额不足返回ErrInsufficientFunds, 避免并发扣减导致透支, 不触发MongoSync同步
+func (self *RDBManager) AddBalance(cnd *sqlc.Cnd, field string, delta interface{}) (affected int64, err error) {
+	if cnd.Model == nil {
+		return 0, self.Error("[Mysql.AddBalance] data is nil")
+	}
+	if len(field) == 0 || delta == nil {
+		return 0, self.Error("[Mysql.AddBalance] field or delta is nil")
+	}
+	obv, ok := modelDrivers[cnd.Model.GetTable()]
+	if !ok {
+		return 0, self.Error("[Mysql.AddBalance] registration object type not found [", cnd.Model.GetTable(), "]")
+	}
+	elem, err := balanceField(obv, field, false)
+	if err != nil {
+		return 0, self.Error("[Mysql.AddBalance] ", err)
+	}
+	field = elem.FieldJsonName
+	if !hasPkCondition(cnd, obv.PkName) {
+		return 0, self.Error("[Mysql.AddBalance] condition must match by primary key [", obv.PkName, "]")
+	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return 0, self.Error("[Mysql.AddBalance] ", err)
+	}
+	case_part, case_arg := self.BuildWhereCase(cnd)
+	if case_part.Len() == 0 || len(case_arg) == 0 {
+		return 0, self.Error("[Mysql.AddBalance] update WhereCase is nil")
+	}
+	parameter := make([]interface{}, 0, len(case_arg)+2)
+	parameter = append(parameter, delta)
+	parameter = append(parameter, case_arg...)
+	parameter = append(parameter, delta)
+	str := case_part.String()
+	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str)+64))
+	sqlbuf.WriteString("update ")
+	sqlbuf.WriteString(table)
+	sqlbuf.WriteString(" set ")
+	sqlbuf.WriteString("`")
+	sqlbuf.WriteString(field)
+	sqlbuf.WriteString("` = `")
+	sqlbuf.WriteString(field)
+	sqlbuf.WriteString("` + ? where")
+	sqlbuf.WriteString(str)
+	sqlbuf.WriteString(" `")
+	sqlbuf.WriteString(field)
+	sqlbuf.WriteString("` + ? >= 0")
+	prepare := utils.Bytes2Str(sqlbuf.Bytes())
+	if zlog.IsDebug() {
+		defer zlog.Debug("[Mysql.AddBalance] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
+	}
+	defer self.writeSlowLog("[Mysql.AddBalance]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
+	defer cancel()
+	var stmt *sql.Stmt
+	stmt, err = self.prepareContext(ctx, prepare)
+	if err != nil {
+		return 0, self.Error("[Mysql.AddBalance] [ ", prepare, " ] prepare failed: ", err)
+	}
+	defer stmt.Close()
+	ret, err := stmt.ExecContext(ctx, parameter...)
+	if err != nil {
+		return 0, self.Error("[Mysql.AddBalance] update failed: ", err)
+	}
+	rowsAffected, err := ret.RowsAffected()
+	if err != nil {
+		return 0, self.Error("[Mysql.AddBalance] affected rows failed: ", err)
+	}
+	if rowsAffected > 0 {
+		self.evictTable(obv.TableName)
+		return rowsAffected, nil
+	}
+	exists, err := self.Exists(cnd)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		self.Errors = append(self.Errors, ErrNotFound)
+		return 0, ErrNotFound
+	}
+	return 0, self.insufficientFunds()
+}
+
+// AddBalance 原子增减余额字段, 通过$inc及$expr过滤 field + delta >= 0 实现, 参数校验及返回值同RDBManager.AddBalance
+func (self *MGOManager) AddBalance(cnd *sqlc.Cnd, field string, delta interface{}) (int64, error) {
+	if cnd.Model == nil {
+		return 0, self.Error("[Mongo.AddBalance] data model is nil")
+	}
+	if len(field) == 0 || delta == nil {
+		return 0, self.Error("[Mongo.AddBalance] field or delta is nil")
+	}
+	obv, ok := modelDrivers[cnd.Model.GetTable()]
+	if !ok {
+		return 0, self.Error("[Mongo.AddBalance] registration object type not found [", cnd.Model.GetTable(), "]")
+	}
+	elem, err := balanceField(obv, field, true)
+	if err != nil {
+		return 0, self.Error("[Mongo.AddBalance] ", err)
+	}
+	field = elem.FieldBsonName
+	if !hasPkCondition(cnd, JID, BID, obv.PkBsonName) {
+		return 0, self.Error("[Mongo.AddBalance] condition must match by primary key [", BID, "]")
+	}
+	db, err := self.GetDatabase(cnd.Model.GetTable())
+	if err != nil {
+		return 0, err
+	}
+	match := buildMongoMatch(cnd)
+	if match == nil || len(match) == 0 {
+		return 0, self.Error("[Mongo.AddBalance] pipe match is nil")
+	}
+	filter := bson.M{"$expr": bson.M{"$gte": bson.A{bson.M{"$add": bson.A{utils.AddStr("$", field), delta}}, 0}}}
+	for k, v := range match {
+		filter[k] = v
+	}
+	upset := bson.M{"$inc": bson.M{field: delta}}
+	defer self.writeLog("[Mongo.AddBalance]", utils.UnixMilli(), map[string]interface{}{"match": filter, "upset": upset}, nil)
+	res, err := db.UpdateOne(self.GetSessionContext(), filter, upset)
+	if err != nil {
+		return 0, self.Error("[Mongo.AddBalance] update failed: ", err)
+	}
+	if res.MatchedCount > 0 {
+		self.evictQueryCache(cnd.Model.GetTable(), false)
+		return res.ModifiedCount, nil
+	}
+	count, err := db.CountDocuments(self.GetSessionContext(), match)
+	if err != nil {
+		return 0, self.Error("[Mongo.AddBalance] count failed: ", err)
+	}
+	if count == 0 {
+		self.Errors = append(self.Errors, ErrNotFound)
+		return 0, ErrNotFound
+	}
+	return 0, self.insufficientFunds()
+}
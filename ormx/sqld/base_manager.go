@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"github.com/godaddy-x/freego/cache"
 	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/ex/errorsx"
 	"github.com/godaddy-x/freego/ormx/sqlc"
 	"github.com/godaddy-x/freego/ormx/sqld/dialect"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/zlog"
+	"net/http"
 	"reflect"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,6 +25,14 @@ var (
 	TRUE  = true
 	FALSE = false
 	rdbs  = map[string]*RDBManager{}
+	// ErrNotFound 开启Option.NotFound时, FindById/FindOne/FindOneComplex无匹配数据返回该错误
+	ErrNotFound = errorsx.New(http.StatusNotFound, "data not found")
+)
+
+const (
+	MYSQL    = "mysql"
+	POSTGRES = "postgres"
+	SQLITE   = "sqlite3"
 )
 
 const (
@@ -52,6 +66,13 @@ type Option struct {
 	Timeout     int64  // 请求超时设置/毫秒,默认10000
 	SlowQuery   int64  // 0.不开启筛选 >0开启筛选查询 毫秒
 	SlowLogPath string // 慢查询写入地址
+	NotFound    bool   // 单条查询无数据时是否返回ErrNotFound, 默认返回nil且对象保持零值
+	// MongoDB读偏好 primary/primaryPreferred/secondary/secondaryPreferred/nearest, 为空使用连接配置
+	ReadPref     string
+	ReadTags     []map[string]string // MongoDB读偏好标签集合, 按顺序匹配, 如 [{"region": "east"}, {}]
+	WriteConcern *WriteConcern       // MongoDB写关注, 为空使用连接配置
+	// 上级请求上下文, 用于链路追踪透传, 为空则使用context.Background()
+	Context context.Context
 }
 
 type MGOSyncData struct {
@@ -64,9 +85,12 @@ type MGOSyncData struct {
 // 数据库管理器
 type DBManager struct {
 	Option
-	CacheManager cache.Cache    // 缓存管理器
-	MGOSyncData  []*MGOSyncData // 同步数据对象
-	Errors       []error        // 错误异常记录
+	CacheManager cache.Cache       // 缓存管理器
+	MGOSyncData  []*MGOSyncData    // 同步数据对象
+	Errors       []error           // 错误异常记录
+	cacheTables  []string          // 事务提交后需失效查询缓存的表
+	auditEntries []*AuditEntry     // 事务提交后写入的审计记录
+	transitions  []TransitionEvent // 事务提交后触发的状态迁移事件
 }
 
 /********************************** 数据库ORM实现 **********************************/
@@ -103,6 +127,8 @@ type IDBase interface {
 	FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error
 	// 按复杂条件查询数据列表
 	FindListComplex(cnd *sqlc.Cnd, data interface{}) error
+	// 按条件聚合查询
+	FindAggregate(cnd *sqlc.Cnd, data interface{}) error
 	// 构建数据表别名
 	BuildCondKey(cnd *sqlc.Cnd, key string) []byte
 	// 构建逻辑条件
@@ -177,6 +203,10 @@ func (self *DBManager) FindListComplex(cnd *sqlc.Cnd, data interface{}) error {
 	return utils.Error("No implementation method [FindListComplex] was found")
 }
 
+func (self *DBManager) FindAggregate(cnd *sqlc.Cnd, data interface{}) error {
+	return utils.Error("No implementation method [FindAggregate] was found")
+}
+
 func (self *DBManager) Close() error {
 	return utils.Error("No implementation method [Close] was found")
 }
@@ -205,11 +235,21 @@ func (self *DBManager) BuildPagination(cnd *sqlc.Cnd, sql string, values []inter
 	return "", utils.Error("No implementation method [BuildPagination] was found")
 }
 
+// notFound 单条查询无数据时的返回值, 不记录到Errors避免事务回滚
+func (self *DBManager) notFound() error {
+	if self.NotFound {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (self *DBManager) Error(data ...interface{}) error {
 	if data == nil || len(data) == 0 {
 		return nil
 	}
-	err := utils.Error(data...)
+	countQueryInterrupt(self.DsName, data)
+	cause := utils.Error(data...)
+	err := errorsx.Wrap(cause, ex.DATA, cause.Error()) // 数据服务异常, 保留原始错误
 	self.Errors = append(self.Errors, err)
 	return err
 }
@@ -219,8 +259,10 @@ func (self *DBManager) Error(data ...interface{}) error {
 // 关系数据库连接管理器
 type RDBManager struct {
 	DBManager
-	Db *sql.DB
-	Tx *sql.Tx
+	Db        *sql.DB
+	Tx        *sql.Tx
+	Driver    string // 数据库类型 MYSQL/POSTGRES/SQLITE, 为空则按MYSQL处理
+	savepoint int    // 嵌套事务保存点序号
 }
 
 func (self *RDBManager) GetDB(options ...Option) error {
@@ -239,13 +281,18 @@ func (self *RDBManager) GetDB(options ...Option) error {
 		return self.Error("datasource [", dsName, "] not found...")
 	}
 	self.Db = rdb.Db
+	self.Driver = rdb.Driver
 	self.DsName = rdb.DsName
 	self.Database = rdb.Database
 	self.Timeout = 10000
 	self.MongoSync = rdb.MongoSync
 	self.CacheManager = rdb.CacheManager
+	self.SlowQuery = atomic.LoadInt64(&rdb.SlowQuery)
+	self.SlowLogPath = rdb.SlowLogPath
 	self.OpenTx = false
 	self.Option.AutoID = option.AutoID
+	self.Option.NotFound = option.NotFound
+	self.Option.Context = option.Context
 	if len(option.DsName) > 0 {
 		if len(option.DsName) > 0 {
 			self.DsName = option.DsName
@@ -273,7 +320,7 @@ func (self *RDBManager) GetDB(options ...Option) error {
 	return nil
 }
 
-func (self *RDBManager) Save(data ...sqlc.Object) error {
+func (self *RDBManager) Save(data ...sqlc.Object) (err error) {
 	if data == nil || len(data) == 0 {
 		return self.Error("[Mysql.Save] data is nil")
 	}
@@ -287,6 +334,10 @@ func (self *RDBManager) Save(data ...sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mysql.Save] registration object type not found [", data[0].GetTable(), "]")
 	}
+	if err := self.callHooks(hookBeforeSave, data...); err != nil {
+		return self.Error("[Mysql.Save] before save hook failed: ", err)
+	}
+	setAutoTime(obv, true, data...)
 	var fready bool
 	parameter := make([]interface{}, 0, len(obv.FieldElem)*len(data))
 	fpart := bytes.NewBuffer(make([]byte, 0, 14*len(obv.FieldElem)))
@@ -318,7 +369,7 @@ func (self *RDBManager) Save(data ...sqlc.Object) error {
 						if obv.AutoId {
 							continue
 						}
-						lastInsertId := utils.NextSID()
+						lastInsertId = obv.nextStringId()
 						utils.SetString(utils.GetPtr(v, vv.FieldOffset), lastInsertId)
 					}
 					parameter = append(parameter, lastInsertId)
@@ -328,6 +379,9 @@ func (self *RDBManager) Save(data ...sqlc.Object) error {
 			} else {
 				fval, err := GetValue(v, vv)
 				if err != nil {
+					if len(vv.Encrypt) > 0 { // 加密失败时不可跳过字段, 避免明文缺失或字段错位
+						return self.Error("[Mysql.Save] field [", vv.FieldName, "] encrypt failed: ", err)
+					}
 					zlog.Error("[Mysql.Save] parameter value acquisition failed", 0, zlog.String("field", vv.FieldName), zlog.AddError(err))
 					continue
 				}
@@ -354,8 +408,12 @@ func (self *RDBManager) Save(data ...sqlc.Object) error {
 	str1 := utils.Bytes2Str(fpart.Bytes())
 	str2 := utils.Bytes2Str(vpart.Bytes())
 	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str1)+len(str2)+64))
+	table, err := shardTableByData(obv, data...)
+	if err != nil {
+		return self.Error("[Mysql.Save] ", err)
+	}
 	sqlbuf.WriteString("insert into ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" (")
 	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	sqlbuf.WriteString(")")
@@ -363,24 +421,32 @@ func (self *RDBManager) Save(data ...sqlc.Object) error {
 	if len(str2) > 0 {
 		sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
 	}
+	if self.AutoID && self.Driver == POSTGRES { // postgres不支持LastInsertId, 通过returning获取自增ID
+		sqlbuf.WriteString(" returning ")
+		sqlbuf.WriteString("`")
+		sqlbuf.WriteString(obv.PkName)
+		sqlbuf.WriteString("`")
+	}
 	prepare := utils.Bytes2Str(sqlbuf.Bytes())
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.Save] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.Save]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.Save] [ ", prepare, " ] prepare failed: ", err)
 	}
 	defer stmt.Close()
-	if ret, err := stmt.ExecContext(ctx, parameter...); err != nil {
+	if self.AutoID && self.Driver == POSTGRES {
+		var lastInsertId int64
+		if err := stmt.QueryRowContext(ctx, parameter...).Scan(&lastInsertId); err != nil {
+			return self.Error("[Mysql.Save] save get last id failed: ", err)
+		}
+		utils.SetInt64(utils.GetPtr(data[0], obv.PkOffset), lastInsertId)
+	} else if ret, err := stmt.ExecContext(ctx, parameter...); err != nil {
 		return self.Error("[Mysql.Save] save failed: ", err)
 	} else if rowsAffected, err := ret.RowsAffected(); err != nil {
 		return self.Error("[Mysql.Save] affected rows failed: ", err)
@@ -399,28 +465,69 @@ func (self *RDBManager) Save(data ...sqlc.Object) error {
 			}
 		}
 	}
+	if err := self.callHooks(hookAfterSave, data...); err != nil {
+		return self.Error("[Mysql.Save] after save hook failed: ", err)
+	}
+	if auditEnabled(obv.TableName) {
+		entries := make([]*AuditEntry, 0, len(data))
+		for _, v := range data {
+			entries = append(entries, self.newAudit(obv, AuditSave, nil, v))
+		}
+		self.addAudit(self.OpenTx && self.Tx != nil, entries...)
+	}
+	self.evictTable(obv.TableName)
 	if self.MongoSync && obv.ToMongo {
 		self.MGOSyncData = append(self.MGOSyncData, &MGOSyncData{SAVE, data[0], nil, data})
 	}
 	return nil
 }
 
+// 按主键更新数据, 多个对象时在同一事务中逐条更新, 任一失败全部回滚, 未开启事务时使用新事务执行
 func (self *RDBManager) Update(data ...sqlc.Object) error {
 	if data == nil || len(data) == 0 {
 		return self.Error("[Mysql.Update] data is nil")
 	}
-	if len(data) > 1 {
-		return self.Error("[Mysql.Update] data length must 1")
+	if len(data) > 2000 {
+		return self.Error("[Mysql.Update] data length > 2000")
+	}
+	if len(data) == 1 {
+		return self.updateOne(data[0])
 	}
-	oneData := data[0]
+	for _, v := range data {
+		if v.GetTable() != data[0].GetTable() {
+			return self.Error("[Mysql.Update] batch data table must be the same [", data[0].GetTable(), "] [", v.GetTable(), "]")
+		}
+	}
+	if self.OpenTx && self.Tx != nil {
+		return self.updateBatch(data)
+	}
+	return UseMysqlTransaction(func(db *RDBManager) error {
+		return db.updateBatch(data)
+	}, self.Option)
+}
+
+func (self *RDBManager) updateBatch(data []sqlc.Object) error {
+	for _, v := range data {
+		if err := self.updateOne(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *RDBManager) updateOne(oneData sqlc.Object) (err error) {
 	obv, ok := modelDrivers[oneData.GetTable()]
 	if !ok {
-		return self.Error("[Mysql.Update] registration object type not found [", data[0].GetTable(), "]")
+		return self.Error("[Mysql.Update] registration object type not found [", oneData.GetTable(), "]")
 	}
 
 	if len(obv.PkName) == 0 {
 		return utils.Error("PK field not fond, you can use [updateByCnd]")
 	}
+	if err := self.callHooks(hookBeforeUpdate, oneData); err != nil {
+		return self.Error("[Mysql.Update] before update hook failed: ", err)
+	}
+	setAutoTime(obv, false, oneData)
 
 	parameter := make([]interface{}, 0, len(obv.FieldElem))
 	fpart := bytes.NewBuffer(make([]byte, 0, 96))
@@ -463,8 +570,12 @@ func (self *RDBManager) Update(data ...sqlc.Object) error {
 	parameter = append(parameter, lastInsertId)
 	str1 := utils.Bytes2Str(fpart.Bytes())
 	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str1)))
+	table, err := shardTableByData(obv, oneData)
+	if err != nil {
+		return self.Error("[Mysql.Update] ", err)
+	}
 	sqlbuf.WriteString("update ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" set ")
 	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	sqlbuf.WriteString(" where ")
@@ -472,20 +583,31 @@ func (self *RDBManager) Update(data ...sqlc.Object) error {
 	sqlbuf.WriteString(obv.PkName)
 	sqlbuf.WriteString("`")
 	sqlbuf.WriteString(" = ?")
+	guards, guardErr := self.checkTransitions(obv, table, oneData, lastInsertId)
+	if guardErr != nil {
+		return guardErr
+	}
+	for _, v := range guards { // 状态迁移校验, 防止读取后被并发修改
+		sqlbuf.WriteString(" and `")
+		sqlbuf.WriteString(v.machine.field.FieldJsonName)
+		sqlbuf.WriteString("` = ?")
+		parameter = append(parameter, v.from)
+	}
+	var before sqlc.Object
+	audit := auditEnabled(obv.TableName)
+	if audit {
+		before = self.auditBefore(obv, oneData)
+	}
 
 	prepare := utils.Bytes2Str(sqlbuf.Bytes())
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.Update] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.Update]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.Update] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -495,16 +617,29 @@ func (self *RDBManager) Update(data ...sqlc.Object) error {
 	} else if rowsAffected, err := ret.RowsAffected(); err != nil {
 		return self.Error("[Mysql.Update] affected rows failed: ", err)
 	} else if rowsAffected <= 0 {
+		if len(guards) > 0 {
+			if err := self.checkStateConflict(obv, table, lastInsertId, guards); err != nil {
+				return err
+			}
+		}
 		zlog.Warn(utils.AddStr("[Mysql.Update] affected rows <= 0 -> ", rowsAffected), 0, zlog.String("sql", prepare))
 		return nil
 	}
+	self.addTransitions(self.OpenTx && self.Tx != nil, obv.TableName, lastInsertId, 1, guards)
+	if err := self.callHooks(hookAfterUpdate, oneData); err != nil {
+		return self.Error("[Mysql.Update] after update hook failed: ", err)
+	}
+	if audit {
+		self.addAudit(self.OpenTx && self.Tx != nil, self.newAudit(obv, AuditUpdate, before, oneData))
+	}
+	self.evictTable(obv.TableName)
 	if self.MongoSync && obv.ToMongo {
 		self.MGOSyncData = append(self.MGOSyncData, &MGOSyncData{UPDATE, oneData, nil, nil})
 	}
 	return nil
 }
 
-func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
+func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) (affected int64, err error) {
 	if cnd.Model == nil {
 		return 0, self.Error("[Mysql.UpdateByCnd] data is nil")
 	}
@@ -515,25 +650,42 @@ func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if !ok {
 		return 0, self.Error("[Mysql.UpdateByCnd] registration object type not found [", cnd.Model.GetTable(), "]")
 	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return 0, self.Error("[Mysql.UpdateByCnd] ", err)
+	}
+	origin := cnd
+	cnd, guards := guardCnd(obv, cnd, false)
 	case_part, case_arg := self.BuildWhereCase(cnd)
 	if case_part.Len() == 0 || len(case_arg) == 0 {
 		return 0, self.Error("[Mysql.UpdateByCnd] update WhereCase is nil")
 	}
-	parameter := make([]interface{}, 0, len(cnd.Upsets)+len(case_arg))
+	upsets, err := encryptUpsets(obv, cnd.Upsets)
+	if err != nil {
+		return 0, self.Error("[Mysql.UpdateByCnd] ", err)
+	}
+	upsets = autoTimeUpsets(obv, upsets, false)
+	parameter := make([]interface{}, 0, len(upsets)+len(case_arg))
 	fpart := bytes.NewBuffer(make([]byte, 0, 96))
-	for k, v := range cnd.Upsets { // 遍历对象字段
+	for k, v := range upsets { // 遍历对象字段
 		if cnd.Escape {
 			fpart.WriteString(" ")
 			fpart.WriteString("`")
 			fpart.WriteString(k)
 			fpart.WriteString("`")
-			fpart.WriteString(" = ?,")
 		} else {
 			fpart.WriteString(" ")
 			fpart.WriteString(k)
+		}
+		if expr, ok := v.(sqlc.Expr); ok {
+			fpart.WriteString(" = ")
+			fpart.WriteString(expr.Sql)
+			fpart.WriteString(",")
+			parameter = append(parameter, expr.Values...)
+		} else {
 			fpart.WriteString(" = ?,")
+			parameter = append(parameter, v)
 		}
-		parameter = append(parameter, v)
 	}
 	for _, v := range case_arg {
 		parameter = append(parameter, v)
@@ -546,7 +698,7 @@ func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
 	str2 := utils.Bytes2Str(vpart.Bytes())
 	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str1)+len(str2)+64))
 	sqlbuf.WriteString("update ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" set ")
 	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	sqlbuf.WriteString(" ")
@@ -557,15 +709,11 @@ func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.UpdateByCnd] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.UpdateByCnd]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return 0, self.Error("[Mysql.UpdateByCnd] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -579,16 +727,26 @@ func (self *RDBManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
 		return 0, self.Error("[Mysql.UpdateByCnd] affected rows failed: ", err)
 	}
 	if rowsAffected <= 0 {
+		if len(guards) > 0 {
+			if err := self.checkCndTransitions(obv, origin, cnd, guards); err != nil {
+				return 0, err
+			}
+		}
 		zlog.Warn(utils.AddStr("[Mysql.UpdateByCnd] affected rows <= 0 -> ", rowsAffected), 0, zlog.String("sql", prepare))
 		return 0, nil
 	}
+	self.addTransitions(self.OpenTx && self.Tx != nil, obv.TableName, nil, rowsAffected, guards)
+	if auditEnabled(obv.TableName) {
+		self.addAudit(self.OpenTx && self.Tx != nil, self.newCndAudit(obv, AuditUpdateByCnd, origin, rowsAffected))
+	}
+	self.evictTable(obv.TableName)
 	if self.MongoSync && obv.ToMongo {
 		self.MGOSyncData = append(self.MGOSyncData, &MGOSyncData{UPDATE_BY_CND, cnd.Model, cnd, nil})
 	}
 	return rowsAffected, nil
 }
 
-func (self *RDBManager) Delete(data ...sqlc.Object) error {
+func (self *RDBManager) Delete(data ...sqlc.Object) (err error) {
 	if data == nil || len(data) == 0 {
 		return self.Error("[Mysql.Delete] data is nil")
 	}
@@ -599,9 +757,16 @@ func (self *RDBManager) Delete(data ...sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mysql.Delete] registration object type not found [", data[0].GetTable(), "]")
 	}
+	table, err := shardTableByData(obv, data...)
+	if err != nil {
+		return self.Error("[Mysql.Delete] ", err)
+	}
 	if len(obv.PkName) == 0 {
 		return utils.Error("PK field not fond, you can use [deleteByCnd]")
 	}
+	if err := self.callHooks(hookBeforeDelete, data...); err != nil {
+		return self.Error("[Mysql.Delete] before delete hook failed: ", err)
+	}
 	parameter := make([]interface{}, 0, len(data))
 	vpart := bytes.NewBuffer(make([]byte, 0, 2*len(data)))
 	for _, v := range data {
@@ -625,8 +790,7 @@ func (self *RDBManager) Delete(data ...sqlc.Object) error {
 		return self.Error("where case is nil")
 	}
 	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str2)+64))
-	sqlbuf.WriteString("delete from ")
-	sqlbuf.WriteString(obv.TableName)
+	parameter = writeDeleteSql(sqlbuf, obv, table, parameter)
 	sqlbuf.WriteString(" where ")
 	sqlbuf.WriteString("`")
 	sqlbuf.WriteString(obv.PkName)
@@ -634,20 +798,27 @@ func (self *RDBManager) Delete(data ...sqlc.Object) error {
 	sqlbuf.WriteString(" in (")
 	sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
 	sqlbuf.WriteString(")")
+	var befores []sqlc.Object
+	var ids []interface{}
+	audit := auditEnabled(obv.TableName)
+	if audit {
+		for _, v := range data {
+			ids = append(ids, auditRecordId(obv, v))
+			if before := self.auditBefore(obv, v); before != nil {
+				befores = append(befores, before)
+			}
+		}
+	}
 
 	prepare := utils.Bytes2Str(sqlbuf.Bytes())
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.Delete] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.Delete]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.Delete] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -660,13 +831,20 @@ func (self *RDBManager) Delete(data ...sqlc.Object) error {
 		zlog.Warn(utils.AddStr("[Mysql.Delete] affected rows <= 0 -> ", rowsAffected), 0, zlog.String("sql", prepare))
 		return nil
 	}
+	if err := self.callHooks(hookAfterDelete, data...); err != nil {
+		return self.Error("[Mysql.Delete] after delete hook failed: ", err)
+	}
+	if audit {
+		self.addAudit(self.OpenTx && self.Tx != nil, self.deleteAudits(obv, befores, ids)...)
+	}
+	self.evictTable(obv.TableName)
 	if self.MongoSync && obv.ToMongo {
 		self.MGOSyncData = append(self.MGOSyncData, &MGOSyncData{DELETE, data[0], nil, data})
 	}
 	return nil
 }
 
-func (self *RDBManager) DeleteById(object sqlc.Object, data ...interface{}) (int64, error) {
+func (self *RDBManager) DeleteById(object sqlc.Object, data ...interface{}) (affected int64, err error) {
 	if data == nil || len(data) == 0 {
 		return 0, self.Error("[Mysql.DeleteById] data is nil")
 	}
@@ -677,6 +855,10 @@ func (self *RDBManager) DeleteById(object sqlc.Object, data ...interface{}) (int
 	if !ok {
 		return 0, self.Error("[Mysql.DeleteById] registration object type not found [", object.GetTable(), "]")
 	}
+	table, err := shardTableByIds(obv, data...)
+	if err != nil {
+		return 0, self.Error("[Mysql.DeleteById] ", err)
+	}
 	if len(obv.PkName) == 0 {
 		return 0, utils.Error("PK field not fond, you can use [deleteByCnd]")
 	}
@@ -691,8 +873,7 @@ func (self *RDBManager) DeleteById(object sqlc.Object, data ...interface{}) (int
 		return 0, self.Error("where case is nil")
 	}
 	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str2)+64))
-	sqlbuf.WriteString("delete from ")
-	sqlbuf.WriteString(obv.TableName)
+	parameter = writeDeleteSql(sqlbuf, obv, table, parameter)
 	sqlbuf.WriteString(" where ")
 	sqlbuf.WriteString("`")
 	sqlbuf.WriteString(obv.PkName)
@@ -700,20 +881,27 @@ func (self *RDBManager) DeleteById(object sqlc.Object, data ...interface{}) (int
 	sqlbuf.WriteString(" in (")
 	sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
 	sqlbuf.WriteString(")")
+	var befores []sqlc.Object
+	audit := auditEnabled(obv.TableName)
+	if audit {
+		for _, v := range data {
+			if obj := auditObjectById(obv, v); obj != nil {
+				if before := self.auditBefore(obv, obj); before != nil {
+					befores = append(befores, before)
+				}
+			}
+		}
+	}
 
 	prepare := utils.Bytes2Str(sqlbuf.Bytes())
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.DeleteById] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.DeleteById]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return 0, self.Error("[Mysql.DeleteById] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -730,10 +918,14 @@ func (self *RDBManager) DeleteById(object sqlc.Object, data ...interface{}) (int
 		zlog.Warn(utils.AddStr("[Mysql.DeleteById] affected rows <= 0 -> ", rowsAffected), 0, zlog.String("sql", prepare))
 		return 0, nil
 	}
+	if audit {
+		self.addAudit(self.OpenTx && self.Tx != nil, self.deleteAudits(obv, befores, data)...)
+	}
+	self.evictTable(obv.TableName)
 	return rowsAffected, nil
 }
 
-func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
+func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) (affected int64, err error) {
 	if cnd.Model == nil {
 		return 0, self.Error("[Mysql.DeleteByCnd] data is nil")
 	}
@@ -741,6 +933,10 @@ func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if !ok {
 		return 0, self.Error("[Mysql.DeleteByCnd] registration object type not found [", cnd.Model.GetTable(), "]")
 	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return 0, self.Error("[Mysql.DeleteByCnd] ", err)
+	}
 	case_part, case_arg := self.BuildWhereCase(cnd)
 	if case_part.Len() == 0 || len(case_arg) == 0 {
 		return 0, self.Error("[Mysql.DeleteByCnd] update WhereCase is nil")
@@ -771,8 +967,7 @@ func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
 	//str1 := utils.Bytes2Str(fpart.Bytes())
 	str2 := utils.Bytes2Str(vpart.Bytes())
 	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(str2)+64))
-	sqlbuf.WriteString("delete from ")
-	sqlbuf.WriteString(obv.TableName)
+	parameter = writeDeleteSql(sqlbuf, obv, table, parameter)
 	//sqlbuf.WriteString(" set ")
 	//sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	//sqlbuf.WriteString(" ")
@@ -783,15 +978,11 @@ func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.DeleteByCnd] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.DeleteByCnd]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return 0, self.Error("[Mysql.DeleteByCnd] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -808,13 +999,17 @@ func (self *RDBManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
 		zlog.Warn(utils.AddStr("[Mysql.DeleteByCnd] affected rows <= 0 -> ", rowsAffected), 0, zlog.String("sql", prepare))
 		return 0, nil
 	}
+	if auditEnabled(obv.TableName) {
+		self.addAudit(self.OpenTx && self.Tx != nil, self.newCndAudit(obv, AuditDeleteByCnd, cnd, rowsAffected))
+	}
+	self.evictTable(obv.TableName)
 	if self.MongoSync && obv.ToMongo {
 		self.MGOSyncData = append(self.MGOSyncData, &MGOSyncData{DELETE, cnd.Model, cnd, nil})
 	}
 	return rowsAffected, nil
 }
 
-func (self *RDBManager) FindById(data sqlc.Object) error {
+func (self *RDBManager) FindById(data sqlc.Object) (err error) {
 	if data == nil {
 		return self.Error("[Mysql.FindById] data is nil")
 	}
@@ -822,6 +1017,10 @@ func (self *RDBManager) FindById(data sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mysql.FindById] registration object type not found [", data.GetTable(), "]")
 	}
+	table, err := shardTableByData(obv, data)
+	if err != nil {
+		return self.Error("[Mysql.FindById] ", err)
+	}
 	if len(obv.PkName) == 0 {
 		return utils.Error("PK field not fond, you can use [findOne] or [findList]")
 	}
@@ -854,7 +1053,7 @@ func (self *RDBManager) FindById(data sqlc.Object) error {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	sqlbuf.WriteString(" from ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" where ")
 	sqlbuf.WriteString("`")
 	sqlbuf.WriteString(obv.PkName)
@@ -865,16 +1064,12 @@ func (self *RDBManager) FindById(data sqlc.Object) error {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.FindById] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.FindById]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
 	var rows *sql.Rows
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.FindById] [", prepare, "] prepare failed: ", err)
 	}
@@ -892,7 +1087,7 @@ func (self *RDBManager) FindById(data sqlc.Object) error {
 	if out, err := OutDest(rows, len(cols)); err != nil {
 		return self.Error("[Mysql.FindById] read result failed: ", err)
 	} else if len(out) == 0 {
-		return nil
+		return self.notFound()
 	} else {
 		first = out[0]
 	}
@@ -907,7 +1102,7 @@ func (self *RDBManager) FindById(data sqlc.Object) error {
 	return nil
 }
 
-func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
+func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) (err error) {
 	if data == nil {
 		return self.Error("[Mysql.FindOne] data is nil")
 	}
@@ -915,6 +1110,21 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mysql.FindOne] registration object type not found [", data.GetTable(), "]")
 	}
+	defer maskScope(obv, cnd, data)()
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return self.Error("[Mysql.FindOne] ", err)
+	}
+	defer softDeleteScope(obv, cnd)()
+	cacheKey, useCache := self.queryCacheKey(cnd, obv.TableName, cacheKindOne)
+	if useCache {
+		if entry, hit := self.getQueryCache(cacheKey, data); hit {
+			if string(entry.Data) == string(cacheNotFound) {
+				return self.notFound()
+			}
+			return nil
+		}
+	}
 	var parameter []interface{}
 	fpart := bytes.NewBuffer(make([]byte, 0, 14*len(obv.FieldElem)))
 	for _, vv := range obv.FieldElem {
@@ -947,7 +1157,7 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	sqlbuf.WriteString(" from ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" ")
 	if len(str2) > 0 {
 		sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
@@ -965,16 +1175,12 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.FindOne] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.FindOne]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
 	var rows *sql.Rows
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.FindOne] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -992,7 +1198,10 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if out, err := OutDest(rows, len(cols)); err != nil {
 		return self.Error("[Mysql.FindOne] read result failed: ", err)
 	} else if len(out) == 0 {
-		return nil
+		if useCache {
+			self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Data: cacheNotFound}, nil)
+		}
+		return self.notFound()
 	} else {
 		first = out[0]
 	}
@@ -1004,10 +1213,13 @@ func (self *RDBManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 			return self.Error(err)
 		}
 	}
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{}, data)
+	}
 	return nil
 }
 
-func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
+func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) (err error) {
 	if data == nil {
 		return self.Error("[Mysql.FindList] data is nil")
 	}
@@ -1018,6 +1230,30 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if !ok {
 		return self.Error("[Mysql.FindList] registration object type not found [", cnd.Model.GetTable(), "]")
 	}
+	defer maskScope(obv, cnd, data)()
+	if isScatter(obv, cnd) {
+		if cnd.Pagination.IsKeyset {
+			return self.Error("[Mysql.FindList] keyset pagination unsupported scatter query")
+		}
+		return self.findListShards(obv, cnd, data)
+	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return self.Error("[Mysql.FindList] ", err)
+	}
+	defer softDeleteScope(obv, cnd)()
+	keyset, err := keysetScope(obv, cnd, data, false)
+	if err != nil {
+		return self.Error("[Mysql.FindList] ", err)
+	}
+	defer keyset()
+	cacheKey, useCache := self.queryCacheKey(cnd, obv.TableName, cacheKindList)
+	if useCache {
+		if entry, hit := self.getQueryCache(cacheKey, data); hit {
+			setCachePagination(cnd, entry)
+			return nil
+		}
+	}
 	fpart := bytes.NewBuffer(make([]byte, 0, 14*len(obv.FieldElem)))
 	for _, vv := range obv.FieldElem {
 		if vv.Ignore {
@@ -1051,7 +1287,7 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(utils.Substr(str1, 0, len(str1)-1))
 	sqlbuf.WriteString(" from ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" ")
 	if len(str2) > 0 {
 		sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
@@ -1069,15 +1305,12 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.FindList] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.FindList]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
 	var stmt *sql.Stmt
 	var rows *sql.Rows
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.FindList] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -1099,6 +1332,9 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 			cnd.Pagination.PageCount = 0
 			cnd.Pagination.PageTotal = 0
 		}
+		if useCache {
+			self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Data: json.RawMessage("[]")}, nil)
+		}
 		return nil
 	}
 	resultv := reflect.ValueOf(data)
@@ -1128,10 +1364,13 @@ func (self *RDBManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	}
 	slicev = slicev.Slice(0, slicev.Cap())
 	resultv.Elem().Set(slicev.Slice(0, len(out)))
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Total: cnd.Pagination.PageTotal, Count: cnd.Pagination.PageCount}, data)
+	}
 	return nil
 }
 
-func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
+func (self *RDBManager) Count(cnd *sqlc.Cnd) (count int64, err error) {
 	if cnd.Model == nil {
 		return 0, self.Error("[Mysql.Count] data is nil")
 	}
@@ -1139,6 +1378,21 @@ func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	if !ok {
 		return 0, self.Error("[Mysql.Count] registration object type not found [", cnd.Model.GetTable(), "]")
 	}
+	if isScatter(obv, cnd) {
+		return self.countShards(obv, cnd)
+	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return 0, self.Error("[Mysql.Count] ", err)
+	}
+	defer softDeleteScope(obv, cnd)()
+	cacheKey, useCache := self.queryCacheKey(cnd, obv.TableName, cacheKindCount)
+	if useCache {
+		if entry, hit := self.getQueryCache(cacheKey, nil); hit {
+			setPageTotal(cnd, entry.Total)
+			return entry.Total, nil
+		}
+	}
 	fpart := bytes.NewBuffer(make([]byte, 0, 32))
 	fpart.WriteString("count(1)")
 	case_part, case_arg := self.BuildWhereCase(cnd)
@@ -1162,7 +1416,7 @@ func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(str1)
 	sqlbuf.WriteString(" from ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" ")
 	if len(str2) > 0 {
 		sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
@@ -1171,16 +1425,12 @@ func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.Count] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.Count]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var rows *sql.Rows
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return 0, self.Error("[Mysql.Count] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -1199,22 +1449,14 @@ func (self *RDBManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	if err := rows.Err(); err != nil {
 		return 0, self.Error("[Mysql.Count] read result failed: ", err)
 	}
-	if pageTotal > 0 && cnd.Pagination.PageSize > 0 {
-		var pageCount int64
-		if pageTotal%cnd.Pagination.PageSize == 0 {
-			pageCount = pageTotal / cnd.Pagination.PageSize
-		} else {
-			pageCount = pageTotal/cnd.Pagination.PageSize + 1
-		}
-		cnd.Pagination.PageCount = pageCount
-	} else {
-		cnd.Pagination.PageCount = 0
+	setPageTotal(cnd, pageTotal)
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Total: pageTotal}, nil)
 	}
-	cnd.Pagination.PageTotal = pageTotal
 	return pageTotal, nil
 }
 
-func (self *RDBManager) Exists(cnd *sqlc.Cnd) (bool, error) {
+func (self *RDBManager) Exists(cnd *sqlc.Cnd) (exists bool, err error) {
 	if cnd.Model == nil {
 		return false, self.Error("[Mysql.Exists] data is nil")
 	}
@@ -1222,6 +1464,11 @@ func (self *RDBManager) Exists(cnd *sqlc.Cnd) (bool, error) {
 	if !ok {
 		return false, self.Error("[Mysql.Exists] registration object type not found [", cnd.Model.GetTable(), "]")
 	}
+	table, err := shardTableByCnd(obv, cnd)
+	if err != nil {
+		return false, self.Error("[Mysql.Exists] ", err)
+	}
+	defer softDeleteScope(obv, cnd)()
 	fpart := bytes.NewBuffer(make([]byte, 0, 32))
 	fpart.WriteString("1")
 	case_part, case_arg := self.BuildWhereCase(cnd)
@@ -1246,7 +1493,7 @@ func (self *RDBManager) Exists(cnd *sqlc.Cnd) (bool, error) {
 	sqlbuf.WriteString("select ")
 	sqlbuf.WriteString(str1)
 	sqlbuf.WriteString(" from ")
-	sqlbuf.WriteString(obv.TableName)
+	sqlbuf.WriteString(table)
 	sqlbuf.WriteString(" ")
 	if len(str2) > 0 {
 		sqlbuf.WriteString(utils.Substr(str2, 0, len(str2)-1))
@@ -1257,16 +1504,12 @@ func (self *RDBManager) Exists(cnd *sqlc.Cnd) (bool, error) {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.Exists] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.Exists]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var rows *sql.Rows
 	var stmt *sql.Stmt
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return false, self.Error("[Mysql.Exists] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -1276,7 +1519,6 @@ func (self *RDBManager) Exists(cnd *sqlc.Cnd) (bool, error) {
 		return false, utils.Error("[Mysql.Exists] query failed: ", err)
 	}
 	defer rows.Close()
-	var exists int64
 	for rows.Next() {
 		if err := rows.Scan(&exists); err != nil {
 			return false, self.Error("[Mysql.Exists] read total failed: ", err)
@@ -1285,10 +1527,10 @@ func (self *RDBManager) Exists(cnd *sqlc.Cnd) (bool, error) {
 	if err := rows.Err(); err != nil {
 		return false, self.Error("[Mysql.Exists] read result failed: ", err)
 	}
-	return exists > 0, nil
+	return exists, nil
 }
 
-func (self *RDBManager) FindListComplex(cnd *sqlc.Cnd, data interface{}) error {
+func (self *RDBManager) FindListComplex(cnd *sqlc.Cnd, data interface{}) (err error) {
 	if data == nil {
 		return self.Error("[Mysql.FindListComplex] data is nil")
 	}
@@ -1305,6 +1547,10 @@ func (self *RDBManager) FindListComplex(cnd *sqlc.Cnd, data interface{}) error {
 	if !ok {
 		return self.Error("[Mysql.FindListComplex] registration object type not found [", cnd.Model.GetTable(), "]")
 	}
+	if err := guardComplexCnd(cnd); err != nil {
+		return self.Error("[Mysql.FindListComplex] ", err)
+	}
+	defer maskScope(obv, cnd, data)()
 	fpart := bytes.NewBuffer(make([]byte, 0, 32*len(cnd.AnyFields)))
 	for _, vv := range cnd.AnyFields {
 		if cnd.Escape {
@@ -1381,15 +1627,12 @@ func (self *RDBManager) FindListComplex(cnd *sqlc.Cnd, data interface{}) error {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.FindListComplex] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.FindListComplex]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
 	var stmt *sql.Stmt
 	var rows *sql.Rows
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.FindListComplex] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -1444,7 +1687,7 @@ func (self *RDBManager) FindListComplex(cnd *sqlc.Cnd, data interface{}) error {
 	return nil
 }
 
-func (self *RDBManager) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error {
+func (self *RDBManager) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) (err error) {
 	if data == nil {
 		return self.Error("[Mysql.FindOneComplex] data is nil")
 	}
@@ -1458,6 +1701,10 @@ func (self *RDBManager) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mysql.FindOneComplex] registration object type not found [", data.GetTable(), "]")
 	}
+	if err := guardComplexCnd(cnd); err != nil {
+		return self.Error("[Mysql.FindOneComplex] ", err)
+	}
+	defer maskScope(obv, cnd, data)()
 	fpart := bytes.NewBuffer(make([]byte, 0, 32*len(cnd.AnyFields)))
 	for _, vv := range cnd.AnyFields {
 		if cnd.Escape {
@@ -1535,16 +1782,12 @@ func (self *RDBManager) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mysql.FindOneComplex] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	defer self.writeSlowLog("[Mysql.FindOneComplex]", prepare, parameter, time.Now(), &err)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	defer cancel()
-	var err error
 	var stmt *sql.Stmt
 	var rows *sql.Rows
-	if self.OpenTx {
-		stmt, err = self.Tx.PrepareContext(ctx, prepare)
-	} else {
-		stmt, err = self.Db.PrepareContext(ctx, prepare)
-	}
+	stmt, err = self.prepareContext(ctx, prepare)
 	if err != nil {
 		return self.Error("[Mysql.FindOneComplex] [ ", prepare, " ] prepare failed: ", err)
 	}
@@ -1565,7 +1808,7 @@ func (self *RDBManager) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if out, err := OutDest(rows, len(cols)); err != nil {
 		return self.Error("[Mysql.FindOneComplex] read result failed: ", err)
 	} else if len(out) == 0 {
-		return nil
+		return self.notFound()
 	} else {
 		first = out[0]
 	}
@@ -1585,6 +1828,20 @@ func (self *RDBManager) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error {
 func (self *RDBManager) Close() error {
 	if self.OpenTx && self.Tx != nil {
 		if self.Errors == nil && len(self.Errors) == 0 {
+			if err := self.writeMongoOutbox(); err != nil { // outbox写入失败时回滚, 保证业务数据与同步数据一致
+				zlog.Error("mongo sync outbox write failed", 0, zlog.AddError(err))
+				if err := self.Tx.Rollback(); err != nil {
+					zlog.Error("transaction rollback failed", 0, zlog.AddError(err))
+				}
+				return err
+			}
+			if err := self.writeTxAudit(); err != nil { // 审计记录写入失败时回滚, 保证写操作均有审计记录
+				zlog.Error("audit write failed", 0, zlog.AddError(err))
+				if err := self.Tx.Rollback(); err != nil {
+					zlog.Error("transaction rollback failed", 0, zlog.AddError(err))
+				}
+				return err
+			}
 			if err := self.Tx.Commit(); err != nil {
 				zlog.Error("transaction commit failed", 0, zlog.AddError(err))
 				return nil
@@ -1596,9 +1853,17 @@ func (self *RDBManager) Close() error {
 			return nil
 		}
 	}
+	if len(self.Errors) == 0 {
+		self.flushQueryCache()
+		self.flushAudit()
+		self.flushTransitions()
+	}
 	if self.Errors == nil && len(self.Errors) == 0 && self.MongoSync && len(self.MGOSyncData) > 0 {
+		if err := self.writeMongoOutbox(); err != nil { // 未开启事务时写入失败则直接同步
+			zlog.Error("mongo sync outbox write failed", 0, zlog.AddError(err))
+		}
 		for _, v := range self.MGOSyncData {
-			if len(v.CacheObject) > 0 {
+			if len(v.CacheObject) > 0 || v.CacheCnd != nil {
 				if err := self.mongoSyncData(v.CacheOption, v.CacheModel, v.CacheCnd, v.CacheObject...); err != nil {
 					zlog.Error("MySQL data synchronization Mongo failed", 0, zlog.Any("data", v), zlog.AddError(err))
 				}
@@ -1619,11 +1884,13 @@ func (self *RDBManager) mongoSyncData(option int, model sqlc.Object, cnd *sqlc.C
 		{option, model, cnd, data},
 	}
 	switch option {
-	case SAVE:
-		return mongo.Save(data...)
-	case UPDATE:
-		return mongo.Update(data...)
+	case SAVE, UPDATE: // upsert保证同步失败重试时幂等
+		return mongo.SaveOrUpdateByID(data...)
 	case DELETE:
+		if len(data) == 0 && cnd != nil {
+			_, err = mongo.DeleteByCnd(cnd)
+			return err
+		}
 		return mongo.Delete(data...)
 	case UPDATE_BY_CND:
 		if cnd == nil {
@@ -1638,6 +1905,41 @@ func (self *RDBManager) mongoSyncData(option int, model sqlc.Object, cnd *sqlc.C
 	return nil
 }
 
+// 查询字段值, 兼容驱动返回的非[]byte类型, 如postgres的time.Time
+type outValue []byte
+
+func (self *outValue) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*self = nil
+	case []byte:
+		b := make([]byte, len(v))
+		copy(b, v)
+		*self = b
+	case string:
+		*self = []byte(v)
+	case time.Time:
+		*self = []byte(v.Format(fieldTime.fmt))
+	default:
+		rv := reflect.ValueOf(src)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			*self = strconv.AppendInt(nil, rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			*self = strconv.AppendUint(nil, rv.Uint(), 10)
+		case reflect.Float32:
+			*self = strconv.AppendFloat(nil, rv.Float(), 'g', -1, 32)
+		case reflect.Float64:
+			*self = strconv.AppendFloat(nil, rv.Float(), 'g', -1, 64)
+		case reflect.Bool:
+			*self = strconv.AppendBool(nil, rv.Bool())
+		default:
+			return utils.Error("unsupported column type: ", rv.Type().String())
+		}
+	}
+	return nil
+}
+
 // 输出查询结果集
 func OutDest(rows *sql.Rows, flen int) ([][][]byte, error) {
 	out := make([][][]byte, 0)
@@ -1645,7 +1947,7 @@ func OutDest(rows *sql.Rows, flen int) ([][][]byte, error) {
 		rets := make([][]byte, flen)
 		dest := make([]interface{}, flen)
 		for i, _ := range rets {
-			dest[i] = &rets[i]
+			dest[i] = (*outValue)(&rets[i])
 		}
 		if err := rows.Scan(dest...); err != nil {
 			return nil, utils.Error("rows scan failed: ", err)
@@ -1658,6 +1960,97 @@ func OutDest(rows *sql.Rows, flen int) ([][][]byte, error) {
 	return out, nil
 }
 
+// 预编译语句, postgres自动转换占位符及标识符引号, 语句附加进程标识注释用于失控查询检测
+func (self *RDBManager) prepareContext(ctx context.Context, prepare string) (*sql.Stmt, error) {
+	if self.Driver == POSTGRES {
+		prepare = rebindPostgres(prepare)
+	}
+	prepare = utils.AddStr(queryTag, prepare)
+	if self.OpenTx {
+		return self.Tx.PrepareContext(ctx, prepare)
+	}
+	return self.Db.PrepareContext(ctx, prepare)
+}
+
+func (self *RDBManager) queryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	if self.Driver == POSTGRES {
+		query = rebindPostgres(query)
+	}
+	defer self.writeSlowLog("[Mysql.queryContext]", query, args, time.Now(), &err)
+	query = utils.AddStr(queryTag, query)
+	if self.OpenTx {
+		return self.Tx.QueryContext(ctx, query, args...)
+	}
+	return self.Db.QueryContext(ctx, query, args...)
+}
+
+func (self *RDBManager) queryRowContext(ctx context.Context, query string, args ...interface{}) (row *sql.Row) {
+	if self.Driver == POSTGRES {
+		query = rebindPostgres(query)
+	}
+	var err error
+	defer self.writeSlowLog("[Mysql.queryRowContext]", query, args, time.Now(), &err)
+	defer func() {
+		if row != nil {
+			err = row.Err()
+		}
+	}()
+	query = utils.AddStr(queryTag, query)
+	if self.OpenTx {
+		return self.Tx.QueryRowContext(ctx, query, args...)
+	}
+	return self.Db.QueryRowContext(ctx, query, args...)
+}
+
+func (self *RDBManager) execContext(ctx context.Context, query string, args ...interface{}) (ret sql.Result, err error) {
+	if self.Driver == POSTGRES {
+		query = rebindPostgres(query)
+	}
+	defer self.writeSlowLog("[Mysql.execContext]", query, args, time.Now(), &err)
+	query = utils.AddStr(queryTag, query)
+	if self.OpenTx {
+		return self.Tx.ExecContext(ctx, query, args...)
+	}
+	return self.Db.ExecContext(ctx, query, args...)
+}
+
+// like参数, postgres的concat无法推断参数类型需显式转换, sqlite不支持concat函数
+func (self *RDBManager) likeArg() string {
+	if self.Driver == POSTGRES {
+		return "concat('%',?::text,'%')"
+	}
+	if self.Driver == SQLITE {
+		return "'%'||?||'%'"
+	}
+	return "concat('%',?,'%')"
+}
+
+// 转换为postgres语法: ?占位符转换为$N, 反引号转换为双引号, 忽略字符串常量内的字符
+func rebindPostgres(query string) string {
+	buf := bytes.NewBuffer(make([]byte, 0, len(query)+16))
+	var quoted bool
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+			buf.WriteByte(c)
+		case quoted:
+			buf.WriteByte(c)
+		case c == '`':
+			buf.WriteByte('"')
+		case c == '?':
+			n++
+			buf.WriteByte('$')
+			buf.WriteString(strconv.Itoa(n))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
 func (self *RDBManager) BuildCondKey(cnd *sqlc.Cnd, key string) []byte {
 	fieldPart := bytes.NewBuffer(make([]byte, 0, 16))
 	if cnd.Escape {
@@ -1749,37 +2142,53 @@ func (self *RDBManager) BuildWhereCase(cnd *sqlc.Cnd) (*bytes.Buffer, []interfac
 			case_part.WriteString(") and")
 		case sqlc.LIKE_:
 			case_part.Write(self.BuildCondKey(cnd, key))
-			case_part.WriteString(" like concat('%',?,'%') and")
+			case_part.WriteString(" like ")
+			case_part.WriteString(self.likeArg())
+			case_part.WriteString(" and")
 			case_arg = append(case_arg, value)
 		case sqlc.NOT_LIKE_:
 			case_part.Write(self.BuildCondKey(cnd, key))
-			case_part.WriteString(" not like concat('%',?,'%') and")
+			case_part.WriteString(" not like ")
+			case_part.WriteString(self.likeArg())
+			case_part.WriteString(" and")
 			case_arg = append(case_arg, value)
-		case sqlc.OR_:
-			var orpart bytes.Buffer
+		case sqlc.OR_, sqlc.AND_:
+			sep := " or"
+			if v.Logic == sqlc.AND_ {
+				sep = " and"
+			}
+			var grouppart bytes.Buffer
 			var args []interface{}
 			for _, v := range values {
-				cnd, ok := v.(*sqlc.Cnd)
+				sub, ok := v.(*sqlc.Cnd)
 				if !ok {
 					continue
 				}
-				buf, arg := self.BuildWhereCase(cnd)
+				buf, arg := self.BuildWhereCase(sub)
+				if buf.Len() == 0 {
+					continue
+				}
 				s := buf.String()
-				s = utils.Substr(s, 0, len(s)-3)
-				orpart.WriteString(s)
-				orpart.WriteString(" or")
-				for _, v := range arg {
-					args = append(args, v)
+				if grouppart.Len() > 0 {
+					grouppart.WriteString(sep)
 				}
+				grouppart.WriteString(" (")
+				grouppart.WriteString(utils.Substr(s, 0, len(s)-3))
+				grouppart.WriteString(")")
+				args = append(args, arg...)
+			}
+			if grouppart.Len() == 0 {
+				continue
 			}
-			s := orpart.String()
-			s = utils.Substr(s, 0, len(s)-3)
 			case_part.WriteString(" (")
-			case_part.WriteString(s)
+			case_part.WriteString(grouppart.String())
 			case_part.WriteString(") and")
-			for _, v := range args {
-				case_arg = append(case_arg, v)
-			}
+			case_arg = append(case_arg, args...)
+		case sqlc.RAW_:
+			case_part.WriteString(" (")
+			case_part.WriteString(key)
+			case_part.WriteString(") and")
+			case_arg = append(case_arg, values...)
 		}
 	}
 	return case_part, case_arg
@@ -1851,27 +2260,30 @@ func (self *RDBManager) BuildPagination(cnd *sqlc.Cnd, sqlbuf string, values []i
 	if pagination.PageSize <= 0 {
 		pagination.PageSize = 10
 	}
-	dialect := dialect.MysqlDialect{Dialect: pagination}
-	limitSql, err := dialect.GetLimitSql(sqlbuf)
+	var pageDialect dialect.IDialect
+	if self.Driver == POSTGRES {
+		pageDialect = &dialect.PostgresDialect{Dialect: pagination}
+	} else if self.Driver == SQLITE {
+		pageDialect = &dialect.SqliteDialect{Dialect: pagination}
+	} else {
+		pageDialect = &dialect.MysqlDialect{Dialect: pagination}
+	}
+	limitSql, err := pageDialect.GetLimitSql(sqlbuf)
 	if err != nil {
 		return "", err
 	}
-	if !dialect.IsPage {
+	if !pagination.IsPage {
 		return limitSql, nil
 	}
-	if !dialect.IsOffset {
-		countSql, err := dialect.GetCountSql(sqlbuf)
+	if !pagination.IsOffset {
+		countSql, err := pageDialect.GetCountSql(sqlbuf)
 		if err != nil {
 			return "", err
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+		ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 		defer cancel()
 		var rows *sql.Rows
-		if self.OpenTx {
-			rows, err = self.Tx.QueryContext(ctx, countSql, values...)
-		} else {
-			rows, err = self.Db.QueryContext(ctx, countSql, values...)
-		}
+		rows, err = self.queryContext(ctx, countSql, values...)
 		if err != nil {
 			return "", self.Error("count query failed: ", err)
 		}
@@ -1896,3 +2308,39 @@ func (self *RDBManager) BuildPagination(cnd *sqlc.Cnd, sqlbuf string, values []i
 	}
 	return limitSql, nil
 }
+
+// PingRDB 检测所有已初始化的关系数据库数据源, 执行select 1, 返回数据源名称对应的检测结果
+func PingRDB(ctx context.Context) map[string]error {
+	result := make(map[string]error, len(rdbs))
+	for k, v := range rdbs {
+		var one int
+		if err := v.Db.QueryRowContext(ctx, "select 1").Scan(&one); err != nil {
+			result[k] = utils.Error("mysql [", k, "] select 1 failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
+
+// CloseRDB 关闭所有关系数据库数据源连接池, 等待已开始的查询完成
+func CloseRDB() map[string]error {
+	result := make(map[string]error, len(rdbs))
+	for k, v := range rdbs {
+		if err := v.Db.Close(); err != nil {
+			result[k] = utils.Error("rdb [", k, "] close failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
+
+// RDBStats 获取所有关系数据库数据源的连接池统计
+func RDBStats() map[string]sql.DBStats {
+	result := make(map[string]sql.DBStats, len(rdbs))
+	for k, v := range rdbs {
+		result[k] = v.Db.Stats()
+	}
+	return result
+}
@@ -0,0 +1,405 @@
+package sqld
+
+import (
+	"bytes"
+	"context"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"os"
+	"reflect"
+	"time"
+)
+
+// PipeConfig 数据迁移配置, 按主键游标分批读取源关系数据库写入目标数据源, 保留原ID
+type PipeConfig struct {
+	Model       sqlc.Object              // 迁移模型, 需已注册ModelDriver, 主键仅支持int64/string
+	Cnd         *sqlc.Cnd                // 源数据过滤条件, 为空则全量迁移
+	Source      Option                   // 源关系数据源
+	Target      Option                   // 目标数据源
+	ToMongo     bool                     // 目标是否为mongo, 按_id upsert写入
+	BatchSize   int64                    // 每批数量, 默认500, 最大2000
+	RateLimit   int64                    // 每秒最大写入条数, 0则不限制
+	Checkpoint  string                   // 断点文件路径, 存在则从断点继续, 为空则不记录
+	Verify      bool                     // 迁移完成后按主键校验目标数据是否完整
+	SkipDeleted bool                     // 跳过软删除数据, 默认包含
+	OnProgress  func(report *PipeReport) // 每批完成回调
+}
+
+// PipeReport 迁移进度
+type PipeReport struct {
+	Table    string `json:"table"`
+	LastID   string `json:"lastId"`   // 最后完成批次的主键游标
+	Read     int64  `json:"read"`     // 读取数量
+	Written  int64  `json:"written"`  // 写入数量
+	Verified int64  `json:"verified"` // 校验数量
+	Missing  int64  `json:"missing"`  // 校验时目标缺失数量
+	Cost     int64  `json:"cost"`     // 本次执行耗时/毫秒
+}
+
+// Pipe 执行数据迁移, 每批写入后记录断点, 中断后以相同配置再次执行即可续传
+func Pipe(ctx context.Context, config PipeConfig) (*PipeReport, error) {
+	if config.Model == nil {
+		return nil, utils.Error("[Pipe] model is nil")
+	}
+	obv, ok := modelDrivers[config.Model.GetTable()]
+	if !ok {
+		return nil, utils.Error("[Pipe] registration object type not found [", config.Model.GetTable(), "]")
+	}
+	if obv.PkKind != reflect.Int64 && obv.PkKind != reflect.String {
+		return nil, utils.Error("[Pipe] only Int64 and string type IDs are supported")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	} else if config.BatchSize > 2000 {
+		config.BatchSize = 2000
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := utils.UnixMilli()
+	report := &PipeReport{Table: obv.TableName}
+	if len(config.Checkpoint) > 0 {
+		if err := loadPipeCheckpoint(config.Checkpoint, report); err != nil {
+			return nil, err
+		}
+		if report.Table != obv.TableName {
+			return nil, utils.Error("[Pipe] checkpoint table [", report.Table, "] not match [", obv.TableName, "]")
+		}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		begin := time.Now()
+		list, next, err := pipeRead(config, obv, report.LastID)
+		if err != nil {
+			return report, err
+		}
+		if len(list) == 0 {
+			break
+		}
+		report.Read += int64(len(list))
+		if err := pipeWrite(config, list); err != nil {
+			return report, err
+		}
+		report.Written += int64(len(list))
+		report.LastID = next
+		report.Cost = utils.UnixMilli() - start
+		if len(config.Checkpoint) > 0 {
+			if err := savePipeCheckpoint(config.Checkpoint, report); err != nil {
+				return report, err
+			}
+		}
+		if config.OnProgress != nil {
+			config.OnProgress(report)
+		}
+		if int64(len(list)) < config.BatchSize {
+			break
+		}
+		if err := pipeThrottle(ctx, config.RateLimit, len(list), begin); err != nil {
+			return report, err
+		}
+	}
+	if config.Verify {
+		if err := pipeVerify(ctx, config, obv, report); err != nil {
+			return report, err
+		}
+	}
+	report.Cost = utils.UnixMilli() - start
+	zlog.Info("[Pipe] data pipe finished", start, zlog.String("table", report.Table), zlog.Int64("written", report.Written), zlog.Int64("missing", report.Missing))
+	return report, nil
+}
+
+// 按主键升序读取游标之后的一批数据, 返回数据及新游标
+func pipeRead(config PipeConfig, obv *MdlDriver, cursor string) ([]sqlc.Object, string, error) {
+	cnd := sqlc.M(config.Model)
+	if !config.SkipDeleted {
+		cnd.Unscoped()
+	}
+	if config.Cnd != nil {
+		cnd.Conditions = append(cnd.Conditions, config.Cnd.Conditions...)
+		cnd.Escape = config.Cnd.Escape
+	}
+	if obv.PkKind == reflect.Int64 {
+		var last int64
+		if len(cursor) > 0 {
+			v, err := utils.StrToInt64(cursor)
+			if err != nil {
+				return nil, "", utils.Error("[Pipe] checkpoint id invalid: ", cursor)
+			}
+			last = v
+		}
+		cnd.Gt(obv.PkName, last)
+	} else {
+		cnd.Gt(obv.PkName, cursor)
+	}
+	cnd.Asc(obv.PkName).Offset(0, config.BatchSize)
+	db := &RDBManager{}
+	if err := db.GetDB(config.Source); err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+	result := reflect.New(reflect.SliceOf(reflect.TypeOf(config.Model)))
+	if err := db.FindList(cnd, result.Interface()); err != nil {
+		return nil, "", err
+	}
+	slice := result.Elem()
+	list := make([]sqlc.Object, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		list[i] = slice.Index(i).Interface().(sqlc.Object)
+	}
+	if len(list) == 0 {
+		return nil, cursor, nil
+	}
+	return list, utils.AnyToStr(pipePk(obv, list[len(list)-1])), nil
+}
+
+func pipePk(obv *MdlDriver, data sqlc.Object) interface{} {
+	if obv.PkKind == reflect.Int64 {
+		return utils.GetInt64(utils.GetPtr(data, obv.PkOffset))
+	}
+	return utils.GetString(utils.GetPtr(data, obv.PkOffset))
+}
+
+// 写入目标数据源, 按主键upsert保证续传重复写入幂等, 不触发钩子及自动时间, 保留源数据时间字段
+func pipeWrite(config PipeConfig, list []sqlc.Object) error {
+	if config.ToMongo {
+		db, err := new(MGOManager).Get(config.Target)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		db.MGOSyncData = []*MGOSyncData{{SAVE, config.Model, nil, nil}} // 按同步数据写入, 跳过自动时间
+		return db.SaveOrUpdateByID(list...)
+	}
+	option := config.Target
+	option.OpenTx = true
+	db := &RDBManager{}
+	if err := db.GetDB(option); err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.pipeUpsert(list)
+}
+
+// 按分表分组批量upsert, mysql使用on duplicate key update, 其他驱动使用on conflict
+func (self *RDBManager) pipeUpsert(list []sqlc.Object) error {
+	obv, ok := modelDrivers[list[0].GetTable()]
+	if !ok {
+		return self.Error("[Pipe] registration object type not found [", list[0].GetTable(), "]")
+	}
+	groups := make(map[string][]sqlc.Object)
+	tables := make([]string, 0, 1)
+	for _, v := range list {
+		table, err := shardTableByData(obv, v)
+		if err != nil {
+			return self.Error("[Pipe] ", err)
+		}
+		if _, ok := groups[table]; !ok {
+			tables = append(tables, table)
+		}
+		groups[table] = append(groups[table], v)
+	}
+	fields := make([]*FieldElem, 0, len(obv.FieldElem))
+	for _, vv := range obv.FieldElem {
+		if !vv.Ignore {
+			fields = append(fields, vv)
+		}
+	}
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
+	defer cancel()
+	for _, table := range tables {
+		data := groups[table]
+		parameter := make([]interface{}, 0, len(fields)*len(data))
+		sqlbuf := bytes.NewBuffer(make([]byte, 0, 64*len(fields)+16*len(fields)*len(data)))
+		sqlbuf.WriteString("insert into ")
+		sqlbuf.WriteString(table)
+		sqlbuf.WriteString(" (")
+		for i, vv := range fields {
+			if i > 0 {
+				sqlbuf.WriteString(",")
+			}
+			sqlbuf.WriteString("`")
+			sqlbuf.WriteString(vv.FieldJsonName)
+			sqlbuf.WriteString("`")
+		}
+		sqlbuf.WriteString(") values ")
+		for i, v := range data {
+			if i > 0 {
+				sqlbuf.WriteString(",")
+			}
+			sqlbuf.WriteString("(")
+			for j, vv := range fields {
+				if j > 0 {
+					sqlbuf.WriteString(",")
+				}
+				sqlbuf.WriteString("?")
+				if vv.Primary {
+					parameter = append(parameter, pipePk(obv, v))
+					continue
+				}
+				fval, err := GetValue(v, vv)
+				if err != nil {
+					return self.Error("[Pipe] field [", vv.FieldName, "] value acquisition failed: ", err)
+				}
+				if vv.IsDate && fval == "" { // time = 0
+					fval = utils.Time2Str(utils.UnixMilli())
+				}
+				parameter = append(parameter, fval)
+			}
+			sqlbuf.WriteString(")")
+		}
+		var update int
+		mysql := len(self.Driver) == 0 || self.Driver == MYSQL
+		if mysql {
+			sqlbuf.WriteString(" on duplicate key update ")
+		} else {
+			sqlbuf.WriteString(" on conflict (`")
+			sqlbuf.WriteString(obv.PkName)
+			sqlbuf.WriteString("`) do ")
+		}
+		for _, vv := range fields {
+			if vv.Primary {
+				continue
+			}
+			if update > 0 {
+				sqlbuf.WriteString(",")
+			} else if !mysql {
+				sqlbuf.WriteString("update set ")
+			}
+			update++
+			sqlbuf.WriteString("`")
+			sqlbuf.WriteString(vv.FieldJsonName)
+			if mysql {
+				sqlbuf.WriteString("`=values(`")
+			} else {
+				sqlbuf.WriteString("`=excluded.`")
+			}
+			sqlbuf.WriteString(vv.FieldJsonName)
+			sqlbuf.WriteString("`")
+		}
+		if update == 0 {
+			if mysql { // 仅主键字段时重复写入保持原值
+				sqlbuf.WriteString("`")
+				sqlbuf.WriteString(obv.PkName)
+				sqlbuf.WriteString("`=`")
+				sqlbuf.WriteString(obv.PkName)
+				sqlbuf.WriteString("`")
+			} else {
+				sqlbuf.WriteString("nothing")
+			}
+		}
+		prepare := utils.Bytes2Str(sqlbuf.Bytes())
+		if zlog.IsDebug() {
+			zlog.Debug("[Pipe] sql log", utils.UnixMilli(), zlog.String("sql", prepare), zlog.Any("values", parameter))
+		}
+		if _, err := self.execContext(ctx, prepare, parameter...); err != nil {
+			return self.Error("[Pipe] [ ", prepare, " ] upsert failed: ", err)
+		}
+	}
+	return nil
+}
+
+func pipeCount(config PipeConfig, obv *MdlDriver, ids []interface{}) (int64, error) {
+	if config.ToMongo {
+		db, err := new(MGOManager).Get(config.Target)
+		if err != nil {
+			return 0, err
+		}
+		defer db.Close()
+		return db.Count(sqlc.M(config.Model).Unscoped().In(JID, ids...))
+	}
+	db := &RDBManager{}
+	if err := db.GetDB(config.Target); err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return db.Count(sqlc.M(config.Model).Unscoped().In(obv.PkName, ids...))
+}
+
+// 重新遍历源数据, 按主键统计目标数据源缺失数量
+func pipeVerify(ctx context.Context, config PipeConfig, obv *MdlDriver, report *PipeReport) error {
+	report.Verified = 0
+	report.Missing = 0
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		list, next, err := pipeRead(config, obv, cursor)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		ids := make([]interface{}, 0, len(list))
+		for _, v := range list {
+			ids = append(ids, pipePk(obv, v))
+		}
+		count, err := pipeCount(config, obv, ids)
+		if err != nil {
+			return err
+		}
+		report.Verified += int64(len(list))
+		report.Missing += int64(len(list)) - count
+		if config.OnProgress != nil {
+			config.OnProgress(report)
+		}
+		if int64(len(list)) < config.BatchSize {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// 按每秒最大写入条数限流
+func pipeThrottle(ctx context.Context, rate int64, size int, begin time.Time) error {
+	if rate <= 0 {
+		return nil
+	}
+	wait := time.Duration(size)*time.Second/time.Duration(rate) - time.Since(begin)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func loadPipeCheckpoint(path string, report *PipeReport) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return utils.Error("[Pipe] read checkpoint failed: ", err)
+	}
+	if err := utils.JsonUnmarshal(bs, report); err != nil {
+		return utils.Error("[Pipe] parse checkpoint failed: ", err)
+	}
+	report.Cost = 0
+	return nil
+}
+
+// 先写临时文件再替换, 避免中断时断点文件损坏
+func savePipeCheckpoint(path string, report *PipeReport) error {
+	bs, err := utils.JsonMarshal(report)
+	if err != nil {
+		return utils.Error("[Pipe] marshal checkpoint failed: ", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0644); err != nil {
+		return utils.Error("[Pipe] write checkpoint failed: ", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return utils.Error("[Pipe] write checkpoint failed: ", err)
+	}
+	return nil
+}
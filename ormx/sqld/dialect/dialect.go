@@ -24,6 +24,9 @@ type Dialect struct {
 	FastPageParam      []int64 // 快速分页下标值
 	FastPageSortParam  int     // 快速分页正反序值
 	FastPageSortCountQ bool    // 是否执行count
+	IsKeyset           bool    // 是否游标分页
+	Cursor             string  // 游标分页当前游标
+	NextCursor         string  // 游标分页下一页游标, 为空时无更多数据
 }
 
 type PageResult struct {
@@ -31,6 +34,8 @@ type PageResult struct {
 	PageSize  int64 `json:"pageSize"`  // 分页截取数量
 	PageTotal int64 `json:"pageTotal"` // 总数据量
 	PageCount int64 `json:"pageCount"` // 总页数 pageTotal/pageSize
+	// 游标分页下一页游标
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 // 方言分页接口
@@ -58,7 +63,7 @@ func (self *Dialect) GetLimitSql(sql string) (string, error) {
 }
 
 func (self *Dialect) GetResult() PageResult {
-	return PageResult{PageNo: self.PageNo, PageSize: self.PageSize, PageTotal: self.PageTotal, PageCount: self.PageCount}
+	return PageResult{PageNo: self.PageNo, PageSize: self.PageSize, PageTotal: self.PageTotal, PageCount: self.PageCount, NextCursor: self.NextCursor}
 }
 
 // 字节数组转字符串
@@ -213,20 +218,38 @@ func (self *Sybase) GetLimitSql(sql string) (string, error) {
 
 /********************************** PostgreSQL方言实现 **********************************/
 
-type PostgreSQL struct {
+type PostgresDialect struct {
 	Dialect
 }
 
-func (self *PostgreSQL) Support() (bool, error) {
-	return false, errors.New("No implementation method [Support] was found")
+// PostgreSQL 兼容旧名称
+type PostgreSQL = PostgresDialect
+
+func (self *PostgresDialect) Support() (bool, error) {
+	return true, nil
 }
 
-func (self *PostgreSQL) GetCountSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetCountSql] was found")
+func (self *PostgresDialect) GetCountSql(sql string) (string, error) {
+	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(sql)+50))
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return bytes2str(sqlbuf.Bytes()), nil
 }
 
-func (self *PostgreSQL) GetLimitSql(sql string) (string, error) {
-	return "", errors.New("No implementation method [GetLimitSql] was found")
+func (self *PostgresDialect) GetLimitSql(sql string) (string, error) {
+	offset := strconv.FormatInt((self.PageNo-1)*self.PageSize, 10)
+	limit := strconv.FormatInt(self.PageSize, 10)
+	if self.IsOffset {
+		offset = strconv.FormatInt(self.PageNo, 10)
+	}
+	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(sql)+50))
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" limit ")
+	sqlbuf.WriteString(limit)
+	sqlbuf.WriteString(" offset ")
+	sqlbuf.WriteString(offset)
+	return bytes2str(sqlbuf.Bytes()), nil
 }
 
 /********************************** Derby方言实现 **********************************/
@@ -246,3 +269,36 @@ func (self *Derby) GetCountSql(sql string) (string, error) {
 func (self *Derby) GetLimitSql(sql string) (string, error) {
 	return "", errors.New("No implementation method [GetLimitSql] was found")
 }
+
+/********************************** SQLite方言实现 **********************************/
+
+type SqliteDialect struct {
+	Dialect
+}
+
+func (self *SqliteDialect) Support() (bool, error) {
+	return true, nil
+}
+
+func (self *SqliteDialect) GetCountSql(sql string) (string, error) {
+	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(sql)+50))
+	sqlbuf.WriteString("select count(1) from (")
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(") as cba1")
+	return bytes2str(sqlbuf.Bytes()), nil
+}
+
+func (self *SqliteDialect) GetLimitSql(sql string) (string, error) {
+	offset := strconv.FormatInt((self.PageNo-1)*self.PageSize, 10)
+	limit := strconv.FormatInt(self.PageSize, 10)
+	if self.IsOffset {
+		offset = strconv.FormatInt(self.PageNo, 10)
+	}
+	sqlbuf := bytes.NewBuffer(make([]byte, 0, len(sql)+50))
+	sqlbuf.WriteString(sql)
+	sqlbuf.WriteString(" limit ")
+	sqlbuf.WriteString(limit)
+	sqlbuf.WriteString(" offset ")
+	sqlbuf.WriteString(offset)
+	return bytes2str(sqlbuf.Bytes()), nil
+}
@@ -0,0 +1,255 @@
+package sqld
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 字段加密存储, encrypt:"aes-gcm"标签的字符串字段写入前加密(含空值), 读取后解密, 密文格式为enc:v1:<kid>:base64(nonce+密文)
+// kid为密钥摘要, 用于密钥轮换时选择解密密钥, 读取时非当前格式或kid未注册的值返回错误, 空值(NULL)返回空字符串
+// 密文不可用于条件查询及排序, 含加密字段的模型不使用查询缓存, 避免明文写入缓存
+
+const (
+	FieldKeyEnvName = "FREEGO_FIELD_KEY" // 默认字段加密密钥环境变量
+	fieldEncPrefix  = "enc:v1:"          // 字段密文前缀
+)
+
+var fieldCrypto = &fieldCipher{providers: []utils.KeyProvider{utils.EnvKeyProvider{Name: FieldKeyEnvName}}}
+
+type fieldCipher struct {
+	mu        sync.RWMutex
+	providers []utils.KeyProvider // 首个为加密密钥, 其余为轮换前的解密密钥
+	active    string
+	keys      map[string]cipher.AEAD // kid -> aead
+}
+
+// SetFieldKeyProvider 设置字段加密密钥提供者, 默认读取环境变量FREEGO_FIELD_KEY, KMS可使用utils.FuncKeyProvider
+// previous为轮换前的密钥, 仅用于解密历史数据, 密钥首次使用时读取并缓存, 重新设置后下次使用时重新读取
+func SetFieldKeyProvider(provider utils.KeyProvider, previous ...utils.KeyProvider) {
+	fieldCrypto.mu.Lock()
+	defer fieldCrypto.mu.Unlock()
+	fieldCrypto.providers = append([]utils.KeyProvider{provider}, previous...)
+	fieldCrypto.active = ""
+	fieldCrypto.keys = nil
+}
+
+// 密钥标识, 不可逆推密钥
+func fieldKeyId(key string) string {
+	return utils.SHA256(utils.AddStr("freego:field:kid:", key))[:8]
+}
+
+func (self *fieldCipher) load() error {
+	if self.keys != nil {
+		return nil
+	}
+	if len(self.providers) == 0 || self.providers[0] == nil {
+		return utils.Error("field key provider is nil")
+	}
+	keys := make(map[string]cipher.AEAD, len(self.providers))
+	var active string
+	for i, provider := range self.providers {
+		if provider == nil {
+			continue
+		}
+		key, err := provider.ConfigKey()
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			return utils.Error("field key is nil")
+		}
+		sum := sha256.Sum256(utils.Str2Bytes(key))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return err
+		}
+		kid := fieldKeyId(key)
+		if i == 0 {
+			active = kid
+		}
+		if _, b := keys[kid]; !b {
+			keys[kid] = aead
+		}
+	}
+	self.active, self.keys = active, keys
+	return nil
+}
+
+// 获取密钥, kid为空时返回加密密钥
+func (self *fieldCipher) get(kid string) (string, cipher.AEAD, error) {
+	self.mu.RLock()
+	if self.keys != nil {
+		defer self.mu.RUnlock()
+		return self.find(kid)
+	}
+	self.mu.RUnlock()
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if err := self.load(); err != nil {
+		return "", nil, err
+	}
+	return self.find(kid)
+}
+
+func (self *fieldCipher) find(kid string) (string, cipher.AEAD, error) {
+	if len(kid) == 0 {
+		kid = self.active
+	}
+	aead, b := self.keys[kid]
+	if !b {
+		return "", nil, utils.Error("field key [", kid, "] not found")
+	}
+	return kid, aead, nil
+}
+
+func parseEncrypt(md *MdlDriver, f *FieldElem, tag string) {
+	if len(tag) == 0 {
+		return
+	}
+	if tag != sqlc.AesGcm {
+		panic("field encrypt invalid: " + md.TableName + "." + f.FieldName + " " + tag)
+	}
+	if f.FieldKind != reflect.String || f.Primary {
+		panic("field encrypt only supports non-primary string field: " + md.TableName + "." + f.FieldName)
+	}
+	f.Encrypt = tag
+	md.Encrypted = true
+}
+
+// 加密字段值, 任意值(含空值及形似密文的值)均加密
+func encryptField(value string) (string, error) {
+	kid, aead, err := fieldCrypto.get("")
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return utils.AddStr(fieldEncPrefix, kid, ":", utils.Base64Encode(aead.Seal(nonce, nonce, utils.Str2Bytes(value), nil))), nil
+}
+
+// 解密字段值, 空值(NULL)返回空字符串, 非密文格式返回错误
+func decryptField(value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	if !strings.HasPrefix(value, fieldEncPrefix) {
+		return "", utils.Error("field ciphertext format invalid")
+	}
+	value = value[len(fieldEncPrefix):]
+	i := strings.IndexByte(value, ':')
+	if i <= 0 {
+		return "", utils.Error("field ciphertext key id invalid")
+	}
+	_, aead, err := fieldCrypto.get(value[:i])
+	if err != nil {
+		return "", err
+	}
+	bs := utils.Base64Decode(value[i+1:])
+	if len(bs) <= aead.NonceSize() {
+		return "", utils.Error("field ciphertext invalid")
+	}
+	plain, err := aead.Open(nil, bs[:aead.NonceSize()], bs[aead.NonceSize():], nil)
+	if err != nil {
+		return "", utils.Error("field decrypt failed: ", err)
+	}
+	return utils.Bytes2Str(plain), nil
+}
+
+// 按字段名加密条件更新的字段值, 返回新的更新字段, 原条件不变
+func encryptUpsets(obv *MdlDriver, upsets map[string]interface{}) (map[string]interface{}, error) {
+	if obv == nil || !obv.Encrypted {
+		return upsets, nil
+	}
+	result := make(map[string]interface{}, len(upsets))
+	for k, v := range upsets {
+		result[k] = v
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		for _, f := range obv.FieldElem {
+			if len(f.Encrypt) > 0 && (k == f.FieldJsonName || k == f.FieldBsonName) {
+				value, err := encryptField(s)
+				if err != nil {
+					return nil, err
+				}
+				result[k] = value
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// 原地加密对象的加密字段, 返回恢复明文函数, 用于直接序列化对象写入的场景(mongo)
+func encryptObject(obv *MdlDriver, data ...sqlc.Object) (func(), error) {
+	if obv == nil || !obv.Encrypted {
+		return func() {}, nil
+	}
+	type plain struct {
+		ptr   uintptr
+		value string
+	}
+	var origin []plain
+	restore := func() { // 可重复调用, 仅首次恢复
+		for _, v := range origin {
+			utils.SetString(v.ptr, v.value)
+		}
+		origin = nil
+	}
+	for _, obj := range data {
+		for _, f := range obv.FieldElem {
+			if len(f.Encrypt) == 0 {
+				continue
+			}
+			ptr := utils.GetPtr(obj, f.FieldOffset)
+			value := utils.GetString(ptr)
+			enc, err := encryptField(value)
+			if err != nil {
+				restore()
+				return nil, err
+			}
+			origin = append(origin, plain{ptr: ptr, value: value})
+			utils.SetString(ptr, enc)
+		}
+	}
+	return restore, nil
+}
+
+// 原地解密查询结果的加密字段, data为对象指针或对象指针切片的指针
+func decryptResult(obv *MdlDriver, data interface{}) error {
+	if obv == nil || !obv.Encrypted {
+		return nil
+	}
+	return eachObject(obv, data, func(obj sqlc.Object) error {
+		return decryptObject(obv, obj)
+	})
+}
+
+func decryptObject(obv *MdlDriver, obj sqlc.Object) error {
+	for _, f := range obv.FieldElem {
+		if len(f.Encrypt) == 0 {
+			continue
+		}
+		ptr := utils.GetPtr(obj, f.FieldOffset)
+		value, err := decryptField(utils.GetString(ptr))
+		if err != nil {
+			return utils.Error("[", obv.TableName, ".", f.FieldName, "] ", err)
+		}
+		utils.SetString(ptr, value)
+	}
+	return nil
+}
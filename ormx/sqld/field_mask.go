@@ -0,0 +1,142 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 查询结果脱敏, mask:"phone"标签的字符串字段在cnd.Masked()查询时替换为脱敏值, 未调用Masked()时返回完整值
+// 内置规则phone/email/idcard/bank/name, 其他规则通过RegisterMasker注册, 未注册的规则全部替换为******
+
+const maskAll = "******"
+
+var (
+	maskerMu sync.RWMutex
+	maskers  = map[string]func(value string) string{
+		"phone":  func(value string) string { return maskKeep(value, 3, 4) },
+		"idcard": func(value string) string { return maskKeep(value, 6, 4) },
+		"bank":   func(value string) string { return maskKeep(value, 0, 4) },
+		"name":   func(value string) string { return maskKeep(value, 1, 0) },
+		"email":  maskEmail,
+	}
+)
+
+// RegisterMasker 注册自定义脱敏规则, 与内置规则同名时覆盖
+func RegisterMasker(name string, masker func(value string) string) {
+	if len(name) == 0 || masker == nil {
+		panic("masker name or func is nil")
+	}
+	maskerMu.Lock()
+	defer maskerMu.Unlock()
+	maskers[name] = masker
+}
+
+func parseMask(md *MdlDriver, f *FieldElem, tag string) {
+	if len(tag) == 0 {
+		return
+	}
+	if f.FieldKind != reflect.String {
+		panic("field mask only supports string field: " + md.TableName + "." + f.FieldName)
+	}
+	f.Mask = tag
+	md.Masked = true
+}
+
+// 按cnd.Masked()脱敏查询结果, 在查询方法中defer调用, 缓存写入完整数据后执行
+func maskScope(obv *MdlDriver, cnd *sqlc.Cnd, data interface{}) func() {
+	if obv == nil || !obv.Masked || cnd == nil || !cnd.MaskResult {
+		return func() {}
+	}
+	return func() {
+		_ = eachObject(obv, data, func(obj sqlc.Object) error {
+			maskObject(obv, obj)
+			return nil
+		})
+	}
+}
+
+func maskObject(obv *MdlDriver, obj sqlc.Object) {
+	for _, f := range obv.FieldElem {
+		if len(f.Mask) == 0 {
+			continue
+		}
+		ptr := utils.GetPtr(obj, f.FieldOffset)
+		utils.SetString(ptr, maskValue(f.Mask, utils.GetString(ptr)))
+	}
+}
+
+func maskValue(name, value string) string {
+	if len(value) == 0 {
+		return value
+	}
+	maskerMu.RLock()
+	masker, ok := maskers[name]
+	maskerMu.RUnlock()
+	if !ok {
+		return maskAll
+	}
+	return masker(value)
+}
+
+// 保留前prefix及后suffix个字符, 中间替换为*, 长度不足时按比例保留
+func maskKeep(value string, prefix, suffix int) string {
+	runes := []rune(value)
+	size := len(runes)
+	if prefix+suffix >= size {
+		prefix, suffix = size/4, size/4
+		if prefix == 0 && size > 1 {
+			prefix = 1
+		}
+	}
+	var b strings.Builder
+	b.Grow(len(value))
+	b.WriteString(string(runes[:prefix]))
+	b.WriteString(strings.Repeat("*", size-prefix-suffix))
+	b.WriteString(string(runes[size-suffix:]))
+	return b.String()
+}
+
+// 保留用户名首字符及域名, 如 a***@example.com
+func maskEmail(value string) string {
+	index := strings.LastIndex(value, "@")
+	if index <= 0 {
+		return maskKeep(value, 1, 0)
+	}
+	_, size := utf8.DecodeRuneInString(value)
+	return value[:size] + "***" + value[index:]
+}
+
+// 遍历查询结果中与模型类型一致的对象, data为对象指针或对象指针切片的指针
+func eachObject(obv *MdlDriver, data interface{}, fn func(obj sqlc.Object) error) error {
+	if data == nil {
+		return nil
+	}
+	model := reflect.TypeOf(obv.Object)
+	if obj, ok := data.(sqlc.Object); ok {
+		if reflect.TypeOf(obj) != model {
+			return nil
+		}
+		return fn(obj)
+	}
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice {
+		return nil
+	}
+	for i := 0; i < value.Len(); i++ {
+		item := value.Index(i)
+		if item.Type() != model || item.IsNil() {
+			continue
+		}
+		if err := fn(item.Interface().(sqlc.Object)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package sqld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/godaddy-x/freego/ex/errorsx"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// StateUnknown UpdateByCnd批量更新时无法确定的原状态
+const StateUnknown = int64(-1)
+
+var (
+	// ErrIllegalTransition 非法状态迁移, 可通过errors.Is判断
+	ErrIllegalTransition = errors.New("illegal state transition")
+	// ErrStateConflict 状态字段读取后被并发修改, 本次更新未生效
+	ErrStateConflict = errorsx.New(http.StatusConflict, "state transition conflict")
+)
+
+// TransitionError 非法状态迁移错误
+type TransitionError struct {
+	Table string
+	Field string
+	From  int64
+	To    int64
+}
+
+func (self *TransitionError) Error() string {
+	return fmt.Sprintf("illegal state transition: %s.%s %d -> %d", self.Table, self.Field, self.From, self.To)
+}
+
+func (self *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// TransitionEvent 状态迁移事件, 更新成功后触发, 事务中的更新在提交后触发
+type TransitionEvent struct {
+	Table string
+	Field string
+	ID    interface{} // 按对象更新时的主键, UpdateByCnd时为空
+	From  int64       // 原状态, UpdateByCnd时为StateUnknown
+	To    int64
+	Rows  int64 // 影响行数
+}
+
+type stateMachine struct {
+	field  *FieldElem
+	states map[int64]map[int64]bool // from -> to
+}
+
+type stateGuard struct {
+	machine *stateMachine
+	from    int64
+	to      int64
+}
+
+var (
+	fsmMu         sync.RWMutex
+	stateMachines = map[string][]*stateMachine{}
+	transitionFns []func(event TransitionEvent)
+)
+
+// RegisterTransitions 声明模型状态字段允许的迁移, 需在ModelDriver之后调用
+// 注册后Update/UpdateByCnd修改该字段时校验迁移是否合法, 非法时返回TransitionError, 读取后被并发修改时返回ErrStateConflict
+// 示例: RegisterTransitions(&OwWallet{}, "dealstate", map[int64][]int64{1: {2, 3}, 2: {3}})
+func RegisterTransitions(model sqlc.Object, field string, transitions map[int64][]int64) {
+	obv, ok := modelDrivers[model.GetTable()]
+	if !ok {
+		panic("registration object type not found: " + model.GetTable())
+	}
+	var elem *FieldElem
+	for _, v := range obv.FieldElem {
+		if v.FieldJsonName == field {
+			elem = v
+			break
+		}
+	}
+	if elem == nil || elem.Ignore || elem.Primary {
+		panic("state field invalid: " + model.GetTable() + "." + field)
+	}
+	switch elem.FieldKind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	default:
+		panic("state field must be int type: " + model.GetTable() + "." + field)
+	}
+	machine := &stateMachine{field: elem, states: make(map[int64]map[int64]bool, len(transitions))}
+	for from, list := range transitions {
+		tos := make(map[int64]bool, len(list))
+		for _, to := range list {
+			tos[to] = true
+		}
+		machine.states[from] = tos
+	}
+	fsmMu.Lock()
+	defer fsmMu.Unlock()
+	machines := stateMachines[obv.TableName]
+	for i, v := range machines {
+		if v.field.FieldJsonName == field {
+			machines[i] = machine
+			return
+		}
+	}
+	stateMachines[obv.TableName] = append(machines, machine)
+}
+
+// OnTransition 注册状态迁移事件回调, 用于审计/变更通知, 开启事务时在提交成功后触发, 回滚时不触发
+func OnTransition(fn func(event TransitionEvent)) {
+	fsmMu.Lock()
+	defer fsmMu.Unlock()
+	transitionFns = append(transitionFns, fn)
+}
+
+// CanTransition 校验状态迁移是否合法, 相同状态视为合法, 未注册的字段不做限制
+func CanTransition(model sqlc.Object, field string, from, to int64) error {
+	for _, v := range getStateMachines(model.GetTable()) {
+		if v.field.FieldJsonName == field && !v.allow(from, to) {
+			return &TransitionError{Table: model.GetTable(), Field: field, From: from, To: to}
+		}
+	}
+	return nil
+}
+
+func getStateMachines(table string) []*stateMachine {
+	fsmMu.RLock()
+	defer fsmMu.RUnlock()
+	return stateMachines[table]
+}
+
+func (self *stateMachine) allow(from, to int64) bool {
+	return from == to || self.states[from][to]
+}
+
+// 可迁移至目标状态的原状态列表, 包含目标状态本身
+func (self *stateMachine) froms(to int64) []interface{} {
+	result := []interface{}{to}
+	for from, tos := range self.states {
+		if from != to && tos[to] {
+			result = append(result, from)
+		}
+	}
+	return result
+}
+
+func stateValue(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	}
+	return 0, false
+}
+
+// 按对象更新时读取当前状态并校验, 返回的guard用于拼接 and field = from 防止并发修改
+func (self *RDBManager) checkTransitions(obv *MdlDriver, table string, data sqlc.Object, pk interface{}) ([]*stateGuard, error) {
+	machines := getStateMachines(obv.TableName)
+	if len(machines) == 0 {
+		return nil, nil
+	}
+	guards := make([]*stateGuard, 0, len(machines))
+	for _, machine := range machines {
+		value, err := GetValue(data, machine.field)
+		if err != nil {
+			return nil, self.Error(err)
+		}
+		to, _ := stateValue(value)
+		from, found, err := self.readState(obv, table, machine, pk)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		if !machine.allow(from, to) {
+			err := &TransitionError{Table: obv.TableName, Field: machine.field.FieldJsonName, From: from, To: to}
+			self.Errors = append(self.Errors, err)
+			return nil, err
+		}
+		guards = append(guards, &stateGuard{machine: machine, from: from, to: to})
+	}
+	return guards, nil
+}
+
+func (self *RDBManager) readState(obv *MdlDriver, table string, machine *stateMachine, pk interface{}) (int64, bool, error) {
+	prepare := utils.AddStr("select `", machine.field.FieldJsonName, "` from ", table, " where `", obv.PkName, "` = ? limit 1")
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
+	defer cancel()
+	rows, err := self.queryContext(ctx, prepare, pk)
+	if err != nil {
+		return 0, false, self.Error("[Mysql.Update] read state failed: ", err)
+	}
+	defer rows.Close()
+	var from int64
+	found := rows.Next()
+	if found {
+		err = rows.Scan(&from)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		return 0, false, self.Error("[Mysql.Update] read state failed: ", err)
+	}
+	return from, found, nil
+}
+
+// 按对象更新无影响行时, 状态已不是读取时的原状态则为并发修改, 否则为数据未变化
+func (self *RDBManager) checkStateConflict(obv *MdlDriver, table string, pk interface{}, guards []*stateGuard) error {
+	for _, guard := range guards {
+		current, found, err := self.readState(obv, table, guard.machine, pk)
+		if err != nil {
+			return err
+		}
+		if !found || current != guard.from {
+			self.Errors = append(self.Errors, ErrStateConflict)
+			return ErrStateConflict
+		}
+	}
+	return nil
+}
+
+// mongo按对象更新时读取当前状态并校验, 返回的guard用于追加 field = from 过滤条件
+func (self *MGOManager) checkTransitions(obv *MdlDriver, db *mongo.Collection, data sqlc.Object, pk interface{}) ([]*stateGuard, error) {
+	machines := getStateMachines(obv.TableName)
+	if len(machines) == 0 {
+		return nil, nil
+	}
+	project := bson.M{}
+	for _, machine := range machines {
+		project[machine.field.FieldBsonName] = 1
+	}
+	current := bson.M{}
+	if err := db.FindOne(self.GetSessionContext(), bson.M{"_id": pk}, options.FindOne().SetProjection(project)).Decode(&current); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, self.Error("[Mongo.Update] read state failed: ", err)
+	}
+	guards := make([]*stateGuard, 0, len(machines))
+	for _, machine := range machines {
+		value, err := GetValue(data, machine.field)
+		if err != nil {
+			return nil, self.Error(err)
+		}
+		to, _ := stateValue(value)
+		from, ok := stateValue(current[machine.field.FieldBsonName])
+		if !ok {
+			continue
+		}
+		if !machine.allow(from, to) {
+			err := &TransitionError{Table: obv.TableName, Field: machine.field.FieldJsonName, From: from, To: to}
+			self.Errors = append(self.Errors, err)
+			return nil, err
+		}
+		guards = append(guards, &stateGuard{machine: machine, from: from, to: to})
+	}
+	return guards, nil
+}
+
+// 按条件更新时为状态字段追加 field in (可迁移原状态) 条件, mongo按bson字段名匹配
+func guardCnd(obv *MdlDriver, cnd *sqlc.Cnd, bsonKey bool) (*sqlc.Cnd, []*stateGuard) {
+	machines := getStateMachines(obv.TableName)
+	if len(machines) == 0 || len(cnd.Upsets) == 0 {
+		return cnd, nil
+	}
+	var guards []*stateGuard
+	guarded := *cnd
+	guarded.Conditions = append(make([]sqlc.Condition, 0, len(cnd.Conditions)+len(machines)), cnd.Conditions...)
+	for _, machine := range machines {
+		key := machine.field.FieldJsonName
+		if bsonKey {
+			key = machine.field.FieldBsonName
+		}
+		value, ok := cnd.Upsets[key]
+		if !ok {
+			continue
+		}
+		to, ok := stateValue(value)
+		if !ok {
+			continue
+		}
+		guarded.Conditions = append(guarded.Conditions, sqlc.Condition{Logic: sqlc.IN_, Key: key, Values: machine.froms(to)})
+		guards = append(guards, &stateGuard{machine: machine, from: StateUnknown, to: to})
+	}
+	if len(guards) == 0 {
+		return cnd, nil
+	}
+	return &guarded, guards
+}
+
+// 按条件更新无影响行时, 区分数据未变化与状态迁移非法
+func (self *RDBManager) checkCndTransitions(obv *MdlDriver, origin, guarded *sqlc.Cnd, guards []*stateGuard) error {
+	pagination := origin.Pagination
+	defer func() {
+		origin.Pagination = pagination
+	}()
+	if count, err := self.Count(guarded); err != nil || count > 0 {
+		return err
+	}
+	if count, err := self.Count(origin); err != nil || count == 0 {
+		return err
+	}
+	err := &TransitionError{Table: obv.TableName, Field: guards[0].machine.field.FieldJsonName, From: StateUnknown, To: guards[0].to}
+	self.Errors = append(self.Errors, err)
+	return err
+}
+
+// mongo按条件更新无匹配数据时, 区分数据不存在与状态迁移非法
+func (self *MGOManager) checkCndTransitions(obv *MdlDriver, origin *sqlc.Cnd, guards []*stateGuard) error {
+	pagination := origin.Pagination
+	defer func() {
+		origin.Pagination = pagination
+	}()
+	if count, err := self.Count(origin); err != nil || count == 0 {
+		return err
+	}
+	err := &TransitionError{Table: obv.TableName, Field: guards[0].machine.field.FieldJsonName, From: StateUnknown, To: guards[0].to}
+	self.Errors = append(self.Errors, err)
+	return err
+}
+
+// 登记状态迁移事件, 事务中暂存至提交成功后触发
+func (self *DBManager) addTransitions(tx bool, table string, pk interface{}, rows int64, guards []*stateGuard) {
+	for _, guard := range guards {
+		if guard.from == guard.to {
+			continue
+		}
+		event := TransitionEvent{Table: table, Field: guard.machine.field.FieldJsonName, ID: pk, From: guard.from, To: guard.to, Rows: rows}
+		if tx {
+			self.transitions = append(self.transitions, event)
+		} else {
+			fireTransition(event)
+		}
+	}
+}
+
+// 事务提交后触发暂存的状态迁移事件
+func (self *DBManager) flushTransitions() {
+	events := self.transitions
+	self.transitions = nil
+	for _, v := range events {
+		fireTransition(v)
+	}
+}
+
+func fireTransition(event TransitionEvent) {
+	fsmMu.RLock()
+	fns := transitionFns
+	fsmMu.RUnlock()
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					zlog.Error("state transition callback panic", 0, zlog.Any("event", event), zlog.Any("recover", r))
+				}
+			}()
+			fn(event)
+		}()
+	}
+}
@@ -0,0 +1,69 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"reflect"
+)
+
+// 泛型查询, 按模型类型实例化结果, 无需传入结果对象及切片指针
+// 例: wallet, err := sqld.FindOneT[OwWallet](sqlc.M().Eq("id", 1))
+//     list, err := sqld.FindListT[OwWallet](sqlc.M().Limit(1, 20))
+
+// 模型指针约束, T为模型结构体, *T实现sqlc.Object
+type objectPtr[T any] interface {
+	*T
+	sqlc.Object
+}
+
+// FindOneT 使用默认关系数据库查询单条数据, 未查询到数据时返回nil(Option.NotFound为true时返回ErrNotFound)
+func FindOneT[T any, P objectPtr[T]](cnd *sqlc.Cnd, option ...Option) (*T, error) {
+	db, err := NewMysql(option...)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return FindOneWith[T, P](&db.RDBManager, cnd)
+}
+
+// FindListT 使用默认关系数据库查询列表数据
+func FindListT[T any, P objectPtr[T]](cnd *sqlc.Cnd, option ...Option) ([]*T, error) {
+	db, err := NewMysql(option...)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return FindListWith[T, P](&db.RDBManager, cnd)
+}
+
+// FindOneWith 使用指定数据库管理器查询单条数据, 可在事务或mongo中使用
+func FindOneWith[T any, P objectPtr[T]](db IDBase, cnd *sqlc.Cnd) (*T, error) {
+	if cnd == nil {
+		cnd = sqlc.M()
+	}
+	result := new(T)
+	if cnd.Model == nil {
+		cnd.Model = P(new(T))
+	}
+	if err := db.FindOne(cnd, P(result)); err != nil {
+		return nil, err
+	}
+	if reflect.ValueOf(result).Elem().IsZero() { // 未查询到数据
+		return nil, nil
+	}
+	return result, nil
+}
+
+// FindListWith 使用指定数据库管理器查询列表数据, 可在事务或mongo中使用
+func FindListWith[T any, P objectPtr[T]](db IDBase, cnd *sqlc.Cnd) ([]*T, error) {
+	if cnd == nil {
+		cnd = sqlc.M()
+	}
+	if cnd.Model == nil {
+		cnd.Model = P(new(T))
+	}
+	result := make([]*T, 0)
+	if err := db.FindList(cnd, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"testing"
+)
+
+// 仅实现查询方法的数据库管理器
+type genericDB struct {
+	IDBase
+	rows []*guardUser
+}
+
+func (self *genericDB) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
+	if len(self.rows) > 0 {
+		*data.(*guardUser) = *self.rows[0]
+	}
+	return nil
+}
+
+func (self *genericDB) FindList(cnd *sqlc.Cnd, data interface{}) error {
+	*data.(*[]*guardUser) = append(*data.(*[]*guardUser), self.rows...)
+	return nil
+}
+
+func TestFindT(t *testing.T) {
+	initGuardModel()
+	// 数据源未初始化时返回错误
+	if _, err := FindOneT[guardUser](sqlc.M().Eq("id", 1), Option{DsName: "generic.none"}); err == nil {
+		t.Error("find one without datasource should fail")
+	}
+	if _, err := FindListT[guardUser](sqlc.M(), Option{DsName: "generic.none"}); err == nil {
+		t.Error("find list without datasource should fail")
+	}
+	db := &genericDB{}
+	one, err := FindOneWith[guardUser](db, nil)
+	if err != nil || one != nil {
+		t.Fatalf("find one empty invalid: %v %v", one, err)
+	}
+	db.rows = []*guardUser{{Id: 1, Username: "a"}, {Id: 2, Username: "b"}}
+	if one, err = FindOneWith[guardUser](db, sqlc.M().Eq("id", 1)); err != nil || one == nil || one.Id != 1 {
+		t.Fatalf("find one invalid: %v %v", one, err)
+	}
+	list, err := FindListWith[guardUser](db, nil)
+	if err != nil || len(list) != 2 || list[1].Username != "b" {
+		t.Fatalf("find list invalid: %s %v", utils.AddStr(len(list)), err)
+	}
+}
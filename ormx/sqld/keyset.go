@@ -0,0 +1,258 @@
+package sqld
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+)
+
+// 游标分页, 由cnd.After开启, FindList按(排序字段, 主键)定位上页末行之后的数据
+// 关系数据库生成 where (sortKey, id) > (?, ?), 倒序为 <, mongo生成等价的$or条件, 主键自动追加为第二排序字段
+// 查询多取一条判断是否存在下一页, 存在时将末行排序值及主键编码为Pagination.NextCursor, 排序字段应为非空字段
+// 排序字段不可为忽略/加密/脱敏字段, 游标与排序字段不一致时返回错误, 不支持分片聚合查询
+
+type keysetCursor struct {
+	Key   string      `json:"k"`
+	Value interface{} `json:"v,omitempty"`
+	Id    interface{} `json:"i"`
+}
+
+// 开启游标分页时追加定位条件及主键排序, 返回的函数在查询结束后还原条件, 截取结果并写入NextCursor
+func keysetScope(obv *MdlDriver, cnd *sqlc.Cnd, data interface{}, mongo bool) (func(), error) {
+	if obv == nil || cnd == nil || !cnd.Pagination.IsKeyset {
+		return func() {}, nil
+	}
+	pk := obv.PkName
+	if mongo {
+		pk = BID
+	}
+	var sortElem *FieldElem
+	sort := sqlc.ASC_
+	hasPk := false
+	for i, v := range cnd.Orderbys {
+		key := v.Key
+		if mongo {
+			key = getKey(key)
+		}
+		if key == pk {
+			if i != len(cnd.Orderbys)-1 || (sortElem != nil && v.Value != sort) {
+				return nil, utils.Error("keyset pagination primary key order invalid: ", v.Key)
+			}
+			sort, _ = v.Value.(int)
+			hasPk = true
+			continue
+		}
+		if i > 0 {
+			return nil, utils.Error("keyset pagination supports one order field: ", v.Key)
+		}
+		if sortElem = keysetField(obv, key, mongo); sortElem == nil {
+			return nil, utils.Error("keyset pagination order field invalid: ", v.Key)
+		}
+		sort, _ = v.Value.(int)
+	}
+	pkElem := keysetPk(obv)
+	if pkElem == nil {
+		return nil, utils.Error("keyset pagination primary key not found: ", obv.TableName)
+	}
+	sortKey := pk
+	if sortElem != nil {
+		sortKey = sortElem.FieldJsonName
+		if mongo {
+			sortKey = sortElem.FieldBsonName
+		}
+	}
+	condSize := len(cnd.Conditions)
+	orders := cnd.Orderbys
+	if len(cnd.Pagination.Cursor) > 0 {
+		cursor, err := decodeKeysetCursor(obv, cnd.Pagination.Cursor, sortKey, sortElem != nil, mongo)
+		if err != nil {
+			return nil, err
+		}
+		addKeysetCondit(cnd, sortElem != nil, sortKey, pk, sort, cursor, mongo)
+	}
+	if !hasPk {
+		cnd.Orderbys = append(append(make([]sqlc.Condition, 0, len(orders)+1), orders...), sqlc.Condition{Logic: sqlc.ORDER_BY_, Key: pk, Value: sort})
+	}
+	size := cnd.Pagination.PageSize
+	cnd.Pagination.PageSize = size + 1
+	cnd.Pagination.NextCursor = ""
+	return func() {
+		cnd.Conditions = cnd.Conditions[:condSize]
+		cnd.Orderbys = orders
+		cnd.Pagination.PageSize = size
+		next, err := keysetResult(sortElem, pkElem, sortKey, data, size, mongo)
+		if err != nil {
+			zlog.Error("keyset pagination next cursor failed", 0, zlog.String("table", obv.TableName), zlog.AddError(err))
+			return
+		}
+		cnd.Pagination.NextCursor = next
+	}, nil
+}
+
+// 游标排序字段, 仅允许数值及字符串类型
+func keysetField(obv *MdlDriver, key string, mongo bool) *FieldElem {
+	for _, f := range obv.FieldElem {
+		name := f.FieldJsonName
+		if mongo {
+			name = f.FieldBsonName
+		}
+		if name != key {
+			continue
+		}
+		if f.Ignore || len(f.Encrypt) > 0 || len(f.Mask) > 0 {
+			return nil
+		}
+		switch f.FieldKind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.String:
+			return f
+		}
+		return nil
+	}
+	return nil
+}
+
+func keysetPk(obv *MdlDriver) *FieldElem {
+	for _, f := range obv.FieldElem {
+		if f.Primary {
+			return f
+		}
+	}
+	return nil
+}
+
+// 追加游标定位条件, 关系数据库使用行比较, mongo使用 sortKey > v or (sortKey = v and _id > id)
+func addKeysetCondit(cnd *sqlc.Cnd, sortField bool, sortKey, pk string, sort int, cursor *keysetCursor, mongo bool) {
+	if !sortField {
+		if sort == sqlc.DESC_ {
+			cnd.Lt(pk, cursor.Id)
+		} else {
+			cnd.Gt(pk, cursor.Id)
+		}
+		return
+	}
+	if mongo {
+		cnd.Or(func(c *sqlc.Cnd) {
+			if sort == sqlc.DESC_ {
+				c.Lt(sortKey, cursor.Value)
+			} else {
+				c.Gt(sortKey, cursor.Value)
+			}
+		}, func(c *sqlc.Cnd) {
+			if sort == sqlc.DESC_ {
+				c.Eq(sortKey, cursor.Value).Lt(pk, cursor.Id)
+			} else {
+				c.Eq(sortKey, cursor.Value).Gt(pk, cursor.Id)
+			}
+		})
+		return
+	}
+	op := ">"
+	if sort == sqlc.DESC_ {
+		op = "<"
+	}
+	if cnd.Escape {
+		sortKey = utils.AddStr("`", sortKey, "`")
+		pk = utils.AddStr("`", pk, "`")
+	}
+	cnd.Raw(utils.AddStr("(", sortKey, ", ", pk, ") ", op, " (?, ?)"), cursor.Value, cursor.Id)
+}
+
+// 解析游标, 值仅允许标量, 避免对象值被mongo解析为操作符
+func decodeKeysetCursor(obv *MdlDriver, s, sortKey string, sortField, mongo bool) (*keysetCursor, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, utils.Error("keyset cursor invalid: ", err)
+	}
+	cursor := &keysetCursor{}
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	if err := decoder.Decode(cursor); err != nil {
+		return nil, utils.Error("keyset cursor invalid: ", err)
+	}
+	if cursor.Key != sortKey {
+		return nil, utils.Error("keyset cursor order field not match: ", cursor.Key)
+	}
+	if cursor.Id, err = keysetValue(cursor.Id); err != nil {
+		return nil, err
+	}
+	if sortField {
+		if cursor.Value, err = keysetValue(cursor.Value); err != nil {
+			return nil, err
+		}
+	}
+	if mongo && obv.PkType == "primitive.ObjectID" {
+		hex, _ := cursor.Id.(string)
+		oid, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, utils.Error("keyset cursor id invalid: ", err)
+		}
+		cursor.Id = oid
+	}
+	return cursor, nil
+}
+
+func keysetValue(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case string:
+		return n, nil
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		if f, err := n.Float64(); err == nil {
+			return f, nil
+		}
+	}
+	return nil, utils.Error("keyset cursor value invalid: ", v)
+}
+
+// 结果多于分页数量时截取, 并按末行排序值及主键生成下一页游标
+func keysetResult(sortElem, pkElem *FieldElem, sortKey string, data interface{}, size int64, mongo bool) (string, error) {
+	resultv := reflect.ValueOf(data)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return "", nil
+	}
+	slicev := resultv.Elem()
+	if int64(slicev.Len()) <= size {
+		return "", nil
+	}
+	slicev.Set(slicev.Slice(0, int(size)))
+	last := slicev.Index(int(size) - 1)
+	if last.Kind() != reflect.Ptr {
+		last = last.Addr()
+	}
+	cursor := &keysetCursor{Key: sortKey}
+	var err error
+	if cursor.Id, err = keysetFieldValue(last, pkElem, mongo); err != nil {
+		return "", err
+	}
+	if sortElem != nil {
+		if cursor.Value, err = keysetFieldValue(last, sortElem, mongo); err != nil {
+			return "", err
+		}
+	}
+	bs, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// 关系数据库取写入值(date字段为格式化时间), mongo取字段原值
+func keysetFieldValue(obj reflect.Value, f *FieldElem, mongo bool) (interface{}, error) {
+	if !mongo {
+		return GetValue(obj.Interface(), f)
+	}
+	value := obj.Elem().FieldByName(f.FieldName).Interface()
+	if oid, ok := value.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+	return value, nil
+}
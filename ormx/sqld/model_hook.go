@@ -0,0 +1,73 @@
+package sqld
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+)
+
+// 模型生命周期回调, 模型实现sqlc.BeforeSave/AfterSave/BeforeUpdate/AfterUpdate/BeforeDelete/AfterDelete时由管理器调用
+// Save/Update/Delete按对象调用, DeleteById/UpdateByCnd/DeleteByCnd无对象不调用, MongoSync同步写入不重复调用
+// 关系数据库开启事务时ctx携带当前事务, 回调内可通过GetMysqlTransaction(ctx)在同一事务中读写, 返回错误时事务回滚
+// 未开启事务时After回调返回错误不回滚已写入的数据
+
+const (
+	hookBeforeSave = iota
+	hookAfterSave
+	hookBeforeUpdate
+	hookAfterUpdate
+	hookBeforeDelete
+	hookAfterDelete
+)
+
+func callModelHooks(ctx context.Context, stage int, data ...sqlc.Object) error {
+	for _, v := range data {
+		var err error
+		switch stage {
+		case hookBeforeSave:
+			if hook, ok := v.(sqlc.BeforeSave); ok {
+				err = hook.BeforeSave(ctx)
+			}
+		case hookAfterSave:
+			if hook, ok := v.(sqlc.AfterSave); ok {
+				err = hook.AfterSave(ctx)
+			}
+		case hookBeforeUpdate:
+			if hook, ok := v.(sqlc.BeforeUpdate); ok {
+				err = hook.BeforeUpdate(ctx)
+			}
+		case hookAfterUpdate:
+			if hook, ok := v.(sqlc.AfterUpdate); ok {
+				err = hook.AfterUpdate(ctx)
+			}
+		case hookBeforeDelete:
+			if hook, ok := v.(sqlc.BeforeDelete); ok {
+				err = hook.BeforeDelete(ctx)
+			}
+		case hookAfterDelete:
+			if hook, ok := v.(sqlc.AfterDelete); ok {
+				err = hook.AfterDelete(ctx)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 执行模型回调, 开启事务时ctx携带当前管理器
+func (self *RDBManager) callHooks(stage int, data ...sqlc.Object) error {
+	ctx := self.baseContext()
+	if self.OpenTx && self.Tx != nil {
+		ctx = context.WithValue(ctx, rdbTxContextKey{}, self)
+	}
+	return callModelHooks(ctx, stage, data...)
+}
+
+// 执行模型回调, mongo事务中ctx为会话上下文
+func (self *MGOManager) callHooks(stage int, data ...sqlc.Object) error {
+	if len(self.MGOSyncData) > 0 {
+		return nil
+	}
+	return callModelHooks(self.GetSessionContext(), stage, data...)
+}
@@ -203,25 +203,10 @@ func addMysqlIndex(object sqlc.Object, index sqlc.Index) error {
 		zlog.Warn("addMysqlIndex keys is nil", 0, zlog.Any("object", object))
 		return nil
 	}
-	if len(index.Name) == 0 {
-		panic("index key name is nil: " + object.GetTable())
-	}
-	var columns string
-	for _, v := range index.Key {
-		if len(v) == 0 {
-			panic("index key field is nil: " + object.GetTable())
-		}
-		columns += utils.AddStr(",`", v, "`")
-	}
-	sql := "CREATE"
-	if index.Unique {
-		sql = utils.AddStr(sql, " UNIQUE ")
+	sql, err := mysqlIndexSql(object.GetTable(), index)
+	if err != nil {
+		panic(err)
 	}
-	sql = utils.AddStr(sql, " INDEX ")
-	sql = utils.AddStr(sql, "`", index.Name, "`")
-	sql = utils.AddStr(sql, " ON ", object.GetTable(), " (")
-	sql = utils.AddStr(sql, columns[1:], ")")
-
 	db, err := NewMysql(Option{Timeout: 120000})
 	if err != nil {
 		panic(err)
@@ -269,35 +254,8 @@ func checkMysqlTable(tableName string) (bool, error) {
 	return true, nil // 表存在
 }
 
-func isInt(s string) bool {
-	if s == "int64" || s == "int" {
-		return true
-	}
-	return false
-}
-
 func createTable(model *MdlDriver) error {
-	sql := utils.AddStr("CREATE TABLE ", model.TableName, "( ")
-	var fields string
-	for _, v := range model.FieldElem {
-		if len(v.FieldDBType) == 0 {
-			if isInt(v.FieldType) {
-				fields = utils.AddStr(fields, ",`", v.FieldJsonName, "` ", "BIGINT")
-			} else {
-				fields = utils.AddStr(fields, ",`", v.FieldJsonName, "` ", "VARCHAR(255)")
-			}
-		} else {
-			fields = utils.AddStr(fields, ",`", v.FieldJsonName, "` ", v.FieldDBType)
-		}
-		if v.Primary {
-			fields = utils.AddStr(fields, " NOT NULL PRIMARY KEY")
-		}
-		if len(v.FieldComment) > 0 {
-			fields = utils.AddStr(fields, " COMMENT '", v.FieldComment, "'")
-		}
-	}
-	sql = utils.AddStr(sql, fields[1:], ")")
-	sql = utils.AddStr(sql, " ENGINE=InnoDB DEFAULT CHARSET=", model.Charset, " COLLATE=", model.Collate, ";")
+	sql := createTableSql(model)
 	db, err := NewMysql(Option{Timeout: 120000})
 	if err != nil {
 		panic(err)
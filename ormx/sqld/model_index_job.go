@@ -0,0 +1,203 @@
+package sqld
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/job"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IndexReport 单表索引比对结果
+type IndexReport struct {
+	Table     string   `json:"table"`
+	Missing   []string `json:"missing,omitempty"`   // 已声明但线上不存在的索引
+	Created   []string `json:"created,omitempty"`   // 本次已创建的索引
+	Orphans   []string `json:"orphans,omitempty"`   // 线上存在但未声明的索引, 仅报告不删除
+	Conflicts []string `json:"conflicts,omitempty"` // 名称相同但字段/唯一性不一致的索引, 需人工处理
+	Error     string   `json:"error,omitempty"`
+}
+
+// IndexProgress 索引对账任务进度
+type IndexProgress struct {
+	Running  bool          `json:"running"`
+	Total    int           `json:"total"`
+	Done     int           `json:"done"`
+	StartAt  int64         `json:"startAt"`
+	FinishAt int64         `json:"finishAt"`
+	Reports  []IndexReport `json:"reports"`
+}
+
+var indexProgress = &struct {
+	mu sync.RWMutex
+	IndexProgress
+}{}
+
+// GetMongoIndexProgress 获取最近一次mongo索引对账进度
+func GetMongoIndexProgress() IndexProgress {
+	indexProgress.mu.RLock()
+	defer indexProgress.mu.RUnlock()
+	result := indexProgress.IndexProgress
+	result.Reports = append([]IndexReport{}, indexProgress.Reports...)
+	return result
+}
+
+type liveIndex struct {
+	Name   string `bson:"name"`
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique"`
+}
+
+func (self liveIndex) keys() []string {
+	result := make([]string, 0, len(self.Key))
+	for _, v := range self.Key {
+		result = append(result, v.Key)
+	}
+	return result
+}
+
+// 复合索引字段顺序决定索引可用的查询前缀, 需按顺序比对
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReconcileMongoIndex 比对sqlc.Index声明与线上索引, 后台创建缺失索引, 报告多余及冲突索引
+// interval为每次创建索引后的等待间隔, 避免集中建索引影响线上负载
+func ReconcileMongoIndex(ctx context.Context, interval time.Duration) (IndexProgress, error) {
+	indexProgress.mu.Lock()
+	if indexProgress.Running {
+		indexProgress.mu.Unlock()
+		return GetMongoIndexProgress(), utils.Error("mongo index reconcile is running")
+	}
+	models := make([]*MdlDriver, 0, len(modelDrivers))
+	for _, v := range modelDrivers {
+		if len(v.Object.NewIndex()) > 0 {
+			models = append(models, v)
+		}
+	}
+	indexProgress.IndexProgress = IndexProgress{Running: true, Total: len(models), StartAt: utils.UnixMilli()}
+	indexProgress.mu.Unlock()
+	defer func() {
+		indexProgress.mu.Lock()
+		indexProgress.Running = false
+		indexProgress.FinishAt = utils.UnixMilli()
+		indexProgress.mu.Unlock()
+	}()
+	db, err := NewMongo(Option{Timeout: 120000})
+	if err != nil {
+		return GetMongoIndexProgress(), err
+	}
+	defer db.Close()
+	for _, model := range models {
+		if ctx.Err() != nil {
+			return GetMongoIndexProgress(), ctx.Err()
+		}
+		report := reconcileMongoIndex(ctx, db, model.Object, interval)
+		if len(report.Error) > 0 {
+			zlog.Error("mongo index reconcile failed", 0, zlog.String("table", report.Table), zlog.String("error", report.Error))
+		} else if len(report.Orphans) > 0 || len(report.Conflicts) > 0 {
+			zlog.Warn("mongo index inconsistent", 0, zlog.String("table", report.Table), zlog.Any("orphans", report.Orphans), zlog.Any("conflicts", report.Conflicts))
+		}
+		indexProgress.mu.Lock()
+		indexProgress.Done++
+		indexProgress.Reports = append(indexProgress.Reports, report)
+		indexProgress.mu.Unlock()
+	}
+	return GetMongoIndexProgress(), nil
+}
+
+func reconcileMongoIndex(ctx context.Context, db *MGOManager, object sqlc.Object, interval time.Duration) IndexReport {
+	report := IndexReport{Table: object.GetTable()}
+	coll, err := db.GetDatabase(object.GetTable())
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	live := map[string]liveIndex{}
+	cur, err := coll.Indexes().List(ctx)
+	if err != nil {
+		// 集合不存在时索引列表为空, 创建索引会同时创建集合
+		if e, b := err.(mongo.CommandError); !b || e.Code != 26 {
+			report.Error = err.Error()
+			return report
+		}
+	} else {
+		var list []liveIndex
+		if err := cur.All(ctx, &list); err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		for _, v := range list {
+			if v.Name == "_id_" {
+				continue
+			}
+			live[v.Name] = v
+		}
+	}
+	declared := map[string]bool{}
+	for _, v := range object.NewIndex() {
+		declared[v.Name] = true
+		exist, b := live[v.Name]
+		if b {
+			if !sameKeys(exist.keys(), v.Key) || exist.Unique != v.Unique {
+				report.Conflicts = append(report.Conflicts, v.Name)
+			}
+			continue
+		}
+		report.Missing = append(report.Missing, v.Name)
+		keys := bson.D{}
+		for _, k := range v.Key {
+			keys = append(keys, bson.E{Key: k, Value: 1})
+		}
+		name, unique, background := v.Name, v.Unique, true
+		model := mongo.IndexModel{Keys: keys, Options: &options.IndexOptions{Name: &name, Unique: &unique, Background: &background}}
+		if _, err := coll.Indexes().CreateOne(ctx, model); err != nil {
+			report.Error = utils.AddStr("create index [", v.Name, "] failed: ", err)
+			return report
+		}
+		report.Created = append(report.Created, v.Name)
+		zlog.Info("mongo index created", 0, zlog.String("table", report.Table), zlog.String("index", v.Name))
+		if interval > 0 {
+			select {
+			case <-ctx.Done():
+				return report
+			case <-time.After(interval):
+			}
+		}
+	}
+	for k := range live {
+		if !declared[k] {
+			report.Orphans = append(report.Orphans, k)
+		}
+	}
+	sort.Strings(report.Orphans)
+	return report
+}
+
+// StartMongoIndexJob 按cron表达式定时执行mongo索引对账, 例: "0 0 3 * * ?"
+func StartMongoIndexJob(spec string, interval time.Duration) (*job.Cron, error) {
+	c := job.NewJob()
+	if _, err := c.AddFunc(spec, func() {
+		if _, err := ReconcileMongoIndex(context.Background(), interval); err != nil {
+			zlog.Error("mongo index reconcile job failed", 0, zlog.AddError(err))
+		}
+	}); err != nil {
+		return nil, err
+	}
+	c.Start()
+	return c, nil
+}
@@ -24,6 +24,9 @@ type FieldElem struct {
 	Ignore        bool
 	IsDate        bool
 	IsBlob        bool
+	Encrypt       string // 加密存储算法, aes-gcm
+	Mask          string // 脱敏规则
+	AutoTime      string // 自动写入时间, create/update
 	FieldName     string
 	FieldJsonName string
 	FieldBsonName string
@@ -43,11 +46,21 @@ type MdlDriver struct {
 	PkName     string
 	PkBsonName string
 	AutoId     bool
+	IdGen      string // 字符串主键生成方式, ulid/uuidv7, 为空使用雪花ID
+	Encrypted  bool   // 是否包含加密存储字段
+	Masked     bool   // 是否包含脱敏字段
+	AutoTime   bool   // 是否包含自动写入时间字段
 	PkType     string
 	Charset    string
 	Collate    string
 	FieldElem  []*FieldElem
 	Object     sqlc.Object
+	// 软删除字段及删除状态值, 状态值为0时按时间戳标记
+	SoftDel      *FieldElem
+	SoftDelState int64
+	// 分片键字段及分片策略, 未注册策略时不分片
+	ShardKey *FieldElem
+	Sharding ShardingPolicy
 }
 
 func isPk(key string) bool {
@@ -121,6 +134,15 @@ func ModelDriver(objects ...sqlc.Object) error {
 				if len(auto) > 0 && auto == sqlc.True {
 					md.AutoId = true
 				}
+				md.IdGen = field.Tag.Get(sqlc.IdGen)
+				if len(md.IdGen) > 0 {
+					if md.IdGen != sqlc.ULID && md.IdGen != sqlc.UUIDv7 {
+						panic("id generator invalid: " + md.TableName + "." + f.FieldName + " " + md.IdGen)
+					}
+					if f.FieldKind != reflect.String {
+						panic("id generator only supports string primary key: " + md.TableName + "." + f.FieldName)
+					}
+				}
 			}
 			ignore := field.Tag.Get(sqlc.Ignore)
 			if len(ignore) > 0 && ignore == sqlc.True {
@@ -134,6 +156,17 @@ func ModelDriver(objects ...sqlc.Object) error {
 			if len(isBlob) > 0 && isBlob == sqlc.True {
 				f.IsBlob = true
 			}
+			parseSoftDelete(md, f, field.Tag.Get(sqlc.SoftDel))
+			parseEncrypt(md, f, field.Tag.Get(sqlc.Encrypt))
+			parseMask(md, f, field.Tag.Get(sqlc.Mask))
+			parseAutoTime(md, f, field.Tag.Get(sqlc.AutoTime))
+			shard := field.Tag.Get(sqlc.Shard)
+			if len(shard) > 0 && shard == sqlc.True {
+				if md.ShardKey != nil {
+					panic("shard key field exist: " + md.TableName + "." + f.FieldName)
+				}
+				md.ShardKey = f
+			}
 			md.FieldElem = append(md.FieldElem, f)
 		}
 		if _, b := modelDrivers[md.TableName]; b {
@@ -144,10 +177,42 @@ func ModelDriver(objects ...sqlc.Object) error {
 	return nil
 }
 
+// 生成字符串主键, 按idgen标签使用ULID/UUIDv7, 默认雪花ID
+func (self *MdlDriver) nextStringId() string {
+	switch self.IdGen {
+	case sqlc.ULID:
+		return utils.NextULID()
+	case sqlc.UUIDv7:
+		return utils.NextUUIDv7()
+	}
+	return utils.NextSID()
+}
+
+// GetModelFields 获取已注册模型的字段信息, 未注册返回nil
+func GetModelFields(table string) []*FieldElem {
+	if obv, ok := modelDrivers[table]; ok {
+		return obv.FieldElem
+	}
+	return nil
+}
+
+// DescribeField 获取模型字段注释及数据库类型, field为结构体字段名, 用于 node.SetModelDescriber(sqld.DescribeField)
+func DescribeField(table, field string) (string, string, bool) {
+	for _, v := range GetModelFields(table) {
+		if v.FieldName == field {
+			return v.FieldComment, v.FieldDBType, true
+		}
+	}
+	return "", "", false
+}
+
 func GetValue(obj interface{}, elem *FieldElem) (interface{}, error) {
 	ptr := utils.GetPtr(obj, elem.FieldOffset)
 	switch elem.FieldKind {
 	case reflect.String:
+		if len(elem.Encrypt) > 0 {
+			return encryptField(utils.GetString(ptr))
+		}
 		return utils.GetString(ptr), nil
 	case reflect.Int:
 		ret := utils.GetInt(ptr)
@@ -269,11 +334,16 @@ func SetValue(obj interface{}, elem *FieldElem, b []byte) error {
 	ptr := utils.GetPtr(obj, elem.FieldOffset)
 	switch elem.FieldKind {
 	case reflect.String:
-		if ret, err := utils.NewString(b); err != nil {
+		ret, err := utils.NewString(b)
+		if err != nil {
 			return err
-		} else {
-			utils.SetString(ptr, ret)
 		}
+		if len(elem.Encrypt) > 0 {
+			if ret, err = decryptField(ret); err != nil {
+				return utils.Error("[", elem.FieldName, "] ", err)
+			}
+		}
+		utils.SetString(ptr, ret)
 		return nil
 	case reflect.Int:
 		if elem.IsDate {
@@ -0,0 +1,215 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaOption 表结构同步选项
+type SchemaOption struct {
+	Option
+	DryRun bool     // 仅返回待执行的SQL, 不执行
+	Tables []string // 指定同步的表, 为空则同步全部已注册模型
+}
+
+// SyncSchema 按已注册模型同步MySQL表结构, 返回已执行(DryRun时为待执行)的SQL
+// 表不存在时建表及索引, 表存在时仅新增缺失的字段和索引, 不修改或删除已有字段/索引
+func SyncSchema(opts ...SchemaOption) ([]string, error) {
+	var opt SchemaOption
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 120000
+	}
+	opt.OpenTx = false // DDL隐式提交, 不使用事务
+	db, err := NewMysql(opt.Option)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tables := opt.Tables
+	if len(tables) == 0 {
+		for k := range modelDrivers {
+			tables = append(tables, k)
+		}
+		sort.Strings(tables)
+	}
+	var result []string
+	for _, table := range tables {
+		model, ok := modelDrivers[table]
+		if !ok {
+			return result, utils.Error("[SyncSchema] registration object type not found [", table, "]")
+		}
+		list, err := schemaStatements(&db.RDBManager, model)
+		if err != nil {
+			return result, err
+		}
+		for _, v := range list {
+			if !opt.DryRun {
+				if _, err := db.Db.Exec(v); err != nil {
+					return result, utils.Error("[SyncSchema] [ ", v, " ] execute failed: ", err)
+				}
+				zlog.Info("[SyncSchema] execute success", 0, zlog.String("table", table), zlog.String("sql", v))
+			}
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// 对比数据库当前结构生成待执行的DDL
+func schemaStatements(db *RDBManager, model *MdlDriver) ([]string, error) {
+	var result []string
+	columns, err := queryStrings(db, "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?", model.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		result = append(result, createTableSql(model))
+		for _, v := range model.Object.NewIndex() {
+			index, err := mysqlIndexSql(model.TableName, v)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, index)
+		}
+		return result, nil
+	}
+	exist := make(map[string]bool, len(columns))
+	for _, v := range columns {
+		exist[strings.ToLower(v)] = true
+	}
+	for _, v := range model.FieldElem {
+		if v.Ignore || exist[strings.ToLower(v.FieldJsonName)] {
+			continue
+		}
+		result = append(result, utils.AddStr("ALTER TABLE `", model.TableName, "` ADD COLUMN ", columnDefine(model, v)))
+	}
+	indexes, err := queryStrings(db, "SELECT DISTINCT index_name FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ?", model.TableName)
+	if err != nil {
+		return nil, err
+	}
+	existIndex := make(map[string]bool, len(indexes))
+	for _, v := range indexes {
+		existIndex[strings.ToLower(v)] = true
+	}
+	for _, v := range model.Object.NewIndex() {
+		if existIndex[strings.ToLower(v.Name)] {
+			continue
+		}
+		index, err := mysqlIndexSql(model.TableName, v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, index)
+	}
+	return result, nil
+}
+
+func queryStrings(db *RDBManager, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Db.Query(query, args...)
+	if err != nil {
+		return nil, utils.Error("[SyncSchema] [ ", query, " ] query failed: ", err)
+	}
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, utils.Error("[SyncSchema] read result failed: ", err)
+		}
+		result = append(result, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.Error("[SyncSchema] read result failed: ", err)
+	}
+	return result, nil
+}
+
+func createTableSql(model *MdlDriver) string {
+	var fields string
+	for _, v := range model.FieldElem {
+		if v.Ignore {
+			continue
+		}
+		fields = utils.AddStr(fields, ",", columnDefine(model, v))
+	}
+	return utils.AddStr("CREATE TABLE `", model.TableName, "` (", fields[1:], ") ENGINE=InnoDB DEFAULT CHARSET=", model.Charset, " COLLATE=", model.Collate)
+}
+
+// 字段定义, db标签优先, 否则按字段类型映射
+func columnDefine(model *MdlDriver, field *FieldElem) string {
+	dbType := mysqlType(field)
+	if field.Primary && len(field.FieldDBType) == 0 {
+		switch model.IdGen {
+		case sqlc.ULID:
+			dbType = "CHAR(26)"
+		case sqlc.UUIDv7:
+			dbType = "CHAR(36)"
+		}
+	}
+	define := utils.AddStr("`", field.FieldJsonName, "` ", dbType)
+	if field.Primary {
+		if model.AutoId && field.FieldKind == reflect.Int64 {
+			define = utils.AddStr(define, " NOT NULL AUTO_INCREMENT PRIMARY KEY")
+		} else {
+			define = utils.AddStr(define, " NOT NULL PRIMARY KEY")
+		}
+	}
+	if len(field.FieldComment) > 0 {
+		define = utils.AddStr(define, " COMMENT '", strings.ReplaceAll(field.FieldComment, "'", "''"), "'")
+	}
+	return define
+}
+
+func mysqlType(field *FieldElem) string {
+	if len(field.FieldDBType) > 0 {
+		return field.FieldDBType
+	}
+	if field.IsDate {
+		return "DATETIME"
+	}
+	if field.IsBlob {
+		return "BLOB"
+	}
+	switch field.FieldKind {
+	case reflect.Int, reflect.Int64:
+		return "BIGINT"
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return "INT"
+	case reflect.Uint, reflect.Uint64:
+		return "BIGINT UNSIGNED"
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return "INT UNSIGNED"
+	case reflect.Bool:
+		return "TINYINT(1)"
+	case reflect.Float32, reflect.Float64:
+		return "DOUBLE"
+	case reflect.String:
+		return "VARCHAR(255)"
+	}
+	return "TEXT"
+}
+
+func mysqlIndexSql(table string, index sqlc.Index) (string, error) {
+	if len(index.Name) == 0 || len(index.Key) == 0 {
+		return "", utils.Error("table index name/key invalid: ", table)
+	}
+	var columns string
+	for _, v := range index.Key {
+		if len(v) == 0 {
+			return "", utils.Error("index key field is nil: ", table)
+		}
+		columns = utils.AddStr(columns, ",`", v, "`")
+	}
+	sql := "CREATE"
+	if index.Unique {
+		sql = utils.AddStr(sql, " UNIQUE")
+	}
+	return utils.AddStr(sql, " INDEX `", index.Name, "` ON `", table, "` (", columns[1:], ")"), nil
+}
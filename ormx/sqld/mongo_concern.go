@@ -0,0 +1,103 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/tag"
+	"strconv"
+	"time"
+)
+
+// MongoDB读偏好及写关注
+// MGOConfig中的ReadPref/ReadTags/WriteConcern为连接默认值, Option按操作覆盖, Cnd.ReadPreference按查询覆盖
+// 读偏好仅对Count/FindOne/FindList/FindAggregate生效, 事务内忽略读偏好及写关注, 以事务配置为准
+// 如 读多接口 sqld.NewMongo(sqld.Option{ReadPref: "secondaryPreferred"}), 资金写入 sqld.Option{WriteConcern: &sqld.WriteConcern{W: "majority", J: true, WTimeout: 5000}}
+
+// WriteConcern 写关注配置
+type WriteConcern struct {
+	W        string // 写入确认节点数, 如"1"/"2"/"majority", 其他值按副本集标签集名称处理
+	J        bool   // 是否等待写入日志
+	WTimeout int64  // 等待确认超时/毫秒, 0不限制
+}
+
+func (self *WriteConcern) build() *writeconcern.WriteConcern {
+	var opts []writeconcern.Option
+	if len(self.W) > 0 {
+		if n, err := strconv.Atoi(self.W); err == nil {
+			opts = append(opts, writeconcern.W(n))
+		} else if self.W == "majority" {
+			opts = append(opts, writeconcern.WMajority())
+		} else {
+			opts = append(opts, writeconcern.WTagSet(self.W))
+		}
+	}
+	if self.J {
+		opts = append(opts, writeconcern.J(true))
+	}
+	if self.WTimeout > 0 {
+		opts = append(opts, writeconcern.WTimeout(time.Duration(self.WTimeout)*time.Millisecond))
+	}
+	return writeconcern.New(opts...)
+}
+
+// 读偏好 primary/primaryPreferred/secondary/secondaryPreferred/nearest, tags为按顺序匹配的标签集合, primary不支持标签
+func buildReadPref(mode string, tags []map[string]string) (*readpref.ReadPref, error) {
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, utils.Error("mongo read preference [", mode, "] invalid")
+	}
+	var opts []readpref.Option
+	if len(tags) > 0 {
+		sets := make([]tag.Set, 0, len(tags))
+		for _, v := range tags {
+			sets = append(sets, tag.NewTagSetFromMap(v))
+		}
+		opts = append(opts, readpref.WithTagSets(sets...))
+	}
+	rp, err := readpref.New(m, opts...)
+	if err != nil {
+		return nil, utils.Error("mongo read preference [", mode, "] invalid: ", err)
+	}
+	return rp, nil
+}
+
+// 连接默认读偏好及写关注
+func applyClientConcern(opts *options.ClientOptions, config MGOConfig) error {
+	if len(config.ReadPref) > 0 {
+		rp, err := buildReadPref(config.ReadPref, config.ReadTags)
+		if err != nil {
+			return err
+		}
+		opts.SetReadPreference(rp)
+	}
+	if config.WriteConcern != nil {
+		opts.SetWriteConcern(config.WriteConcern.build())
+	}
+	return nil
+}
+
+// 集合读偏好及写关注, Cnd指定读偏好时优先
+func (self *MGOManager) collectionOptions(cnd ...*sqlc.Cnd) (*options.CollectionOptions, error) {
+	opts := options.Collection()
+	if self.PackContext != nil && self.PackContext.SessionContext != nil {
+		return opts, nil
+	}
+	mode, tags := self.ReadPref, self.ReadTags
+	if len(cnd) > 0 && cnd[0] != nil && len(cnd[0].ReadPref) > 0 {
+		mode, tags = cnd[0].ReadPref, cnd[0].ReadTags
+	}
+	if len(mode) > 0 {
+		rp, err := buildReadPref(mode, tags)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetReadPreference(rp)
+	}
+	if self.WriteConcern != nil {
+		opts.SetWriteConcern(self.WriteConcern.build())
+	}
+	return opts, nil
+}
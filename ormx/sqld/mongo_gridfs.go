@@ -0,0 +1,98 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"time"
+)
+
+// GridFSFile GridFS文件流, 读取完成后需调用Close释放连接
+type GridFSFile struct {
+	*gridfs.DownloadStream
+	manager *MGOManager
+}
+
+func (self *GridFSFile) Close() error {
+	err := self.DownloadStream.Close()
+	self.manager.Close()
+	return err
+}
+
+func (self *MGOManager) gridBucket(bucket string) (*gridfs.Bucket, error) {
+	if len(bucket) == 0 {
+		bucket = options.DefaultName
+	}
+	b, err := gridfs.NewBucket(self.Session.Database(self.Database), options.GridFSBucket().SetName(bucket))
+	if err != nil {
+		return nil, self.Error("[Mongo.GridFS] create bucket failed: ", err)
+	}
+	deadline := time.Now().Add(time.Duration(self.Timeout) * time.Millisecond)
+	if err := b.SetWriteDeadline(deadline); err != nil {
+		return nil, self.Error("[Mongo.GridFS] set write deadline failed: ", err)
+	}
+	if err := b.SetReadDeadline(deadline); err != nil {
+		return nil, self.Error("[Mongo.GridFS] set read deadline failed: ", err)
+	}
+	return b, nil
+}
+
+// UploadFile 流式上传文件至GridFS, 返回文件ID
+func (self *MGOManager) UploadFile(bucket, filename string, source io.Reader) (string, error) {
+	b, err := self.gridBucket(bucket)
+	if err != nil {
+		return "", err
+	}
+	id, err := b.UploadFromStream(filename, source)
+	if err != nil {
+		return "", self.Error("[Mongo.GridFS] upload file failed: ", err)
+	}
+	return id.Hex(), nil
+}
+
+// OpenFile 打开GridFS文件流, 返回的文件流持有独立连接, 读取完成后需Close
+func OpenFile(bucket, id string, option ...Option) (*GridFSFile, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, utils.Error("[Mongo.GridFS] file id invalid: ", id)
+	}
+	mgo, err := NewMongo(option...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := mgo.gridBucket(bucket)
+	if err != nil {
+		mgo.Close()
+		return nil, err
+	}
+	stream, err := b.OpenDownloadStream(oid)
+	if err != nil {
+		mgo.Close()
+		return nil, mgo.Error("[Mongo.GridFS] open file failed: ", err)
+	}
+	return &GridFSFile{DownloadStream: stream, manager: mgo}, nil
+}
+
+// GridFSStore GridFS文件存储, 用于 node.SetFileStore(sqld.GridFSStore{}), Option为mongo数据源选项
+type GridFSStore struct {
+	Option Option
+}
+
+func (self GridFSStore) Upload(bucket, filename string, source io.Reader) (string, error) {
+	mgo, err := NewMongo(self.Option)
+	if err != nil {
+		return "", err
+	}
+	defer mgo.Close()
+	return mgo.UploadFile(bucket, filename, source)
+}
+
+func (self GridFSStore) Open(bucket, id string) (io.ReadCloser, int64, string, error) {
+	file, err := OpenFile(bucket, id, self.Option)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return file, file.GetFile().Length, file.GetFile().Name, nil
+}
@@ -15,12 +15,12 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/zap"
 	"reflect"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	mgoSessions = make(map[string]*MGOManager)
-	mgoSlowlog  *zap.Logger
 )
 
 type SortBy struct {
@@ -96,13 +96,22 @@ func UseTransaction(fn func(mgo *MGOManager) error, option ...Option) error {
 			self.PackContext.SessionContext.AbortTransaction(self.PackContext.SessionContext)
 			return err
 		}
-		return self.PackContext.SessionContext.CommitTransaction(self.PackContext.SessionContext)
+		if err := self.PackContext.SessionContext.CommitTransaction(self.PackContext.SessionContext); err != nil {
+			return err
+		}
+		self.flushAudit()
+		self.flushTransitions()
+		return nil
 	})
 }
 
-// 获取mongo的数据库连接
-func (self *MGOManager) GetDatabase(tb string) (*mongo.Collection, error) {
-	collection := self.Session.Database(self.Database).Collection(tb)
+// 获取mongo的数据库连接, 传入cnd时使用查询指定的读偏好
+func (self *MGOManager) GetDatabase(tb string, cnd ...*sqlc.Cnd) (*mongo.Collection, error) {
+	opts, err := self.collectionOptions(cnd...)
+	if err != nil {
+		return nil, self.Error(err)
+	}
+	collection := self.Session.Database(self.Database).Collection(tb, opts)
 	if collection == nil {
 		return nil, self.Error("failed to get Mongo collection")
 	}
@@ -128,9 +137,12 @@ func (self *MGOManager) GetDB(options ...Option) error {
 	self.DsName = mgo.DsName
 	self.Database = mgo.Database
 	self.Timeout = 60000
-	self.SlowQuery = mgo.SlowQuery
+	self.SlowQuery = atomic.LoadInt64(&mgo.SlowQuery)
 	self.SlowLogPath = mgo.SlowLogPath
 	self.CacheManager = mgo.CacheManager
+	self.NotFound = option.NotFound
+	self.Context = option.Context
+	self.ReadPref, self.ReadTags, self.WriteConcern = option.ReadPref, option.ReadTags, option.WriteConcern
 	if len(option.DsName) > 0 {
 		if len(option.DsName) > 0 {
 			self.DsName = option.DsName
@@ -145,7 +157,7 @@ func (self *MGOManager) GetDB(options ...Option) error {
 			self.Database = option.Database
 		}
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(self.Timeout)*time.Millisecond)
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
 	self.PackContext = &PackContext{Context: ctx, CancelFunc: cancel}
 	return nil
 }
@@ -200,6 +212,11 @@ func (self *MGOManager) buildByConfig(manager cache.Cache, input ...MGOConfig) e
 		opts.SetMinPoolSize(100)
 		opts.SetMaxPoolSize(uint64(v.PoolLimit))
 		opts.SetSocketTimeout(time.Second * time.Duration(v.SocketTimeout))
+		opts.SetMonitor(newMongoMonitor())
+		opts.SetAppName(mongoAppName(opts))
+		if err := applyClientConcern(opts, v); err != nil {
+			return utils.Error("mongo init failed: ", err)
+		}
 		// 连接数据库
 		session, err := mongo.Connect(context.Background(), opts)
 		if err != nil {
@@ -234,23 +251,11 @@ func (self *MGOManager) initSlowLog() {
 	if self.SlowQuery == 0 || len(self.SlowLogPath) == 0 {
 		return
 	}
-	if mgoSlowlog == nil {
-		mgoSlowlog = zlog.InitNewLog(&zlog.ZapConfig{
-			Level:   "warn",
-			Console: false,
-			FileConfig: &zlog.FileConfig{
-				Compress:   true,
-				Filename:   self.SlowLogPath,
-				MaxAge:     7,
-				MaxBackups: 7,
-				MaxSize:    512,
-			}})
-		mgoSlowlog.Info("MGO query monitoring service started successful...")
-	}
+	initSlowLog(self.SlowLogPath, "MGO")
 }
 
 func (self *MGOManager) getSlowLog() *zap.Logger {
-	return mgoSlowlog
+	return getSlowLog(self.SlowLogPath)
 }
 
 func (self *MGOManager) Save(data ...sqlc.Object) error {
@@ -268,6 +273,12 @@ func (self *MGOManager) Save(data ...sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mongo.Save] registration object type not found [", d.GetTable(), "]")
 	}
+	if err := self.callHooks(hookBeforeSave, data...); err != nil {
+		return self.Error("[Mongo.Save] before save hook failed: ", err)
+	}
+	if len(self.MGOSyncData) == 0 {
+		setAutoTime(obv, true, data...)
+	}
 	db, err := self.GetDatabase(d.GetTable())
 	if err != nil {
 		return self.Error(err)
@@ -286,7 +297,7 @@ func (self *MGOManager) Save(data ...sqlc.Object) error {
 		} else if obv.PkKind == reflect.String {
 			lastInsertId := utils.GetString(utils.GetPtr(v, obv.PkOffset))
 			if len(lastInsertId) == 0 {
-				lastInsertId = utils.NextSID()
+				lastInsertId = obv.nextStringId()
 				utils.SetString(utils.GetPtr(v, obv.PkOffset), lastInsertId)
 			}
 		} else if obv.PkType == "primitive.ObjectID" {
@@ -300,6 +311,11 @@ func (self *MGOManager) Save(data ...sqlc.Object) error {
 		}
 		adds = append(adds, v)
 	}
+	restore, err := encryptObject(obv, data...)
+	if err != nil {
+		return self.Error("[Mongo.Save] ", err)
+	}
+	defer restore()
 	res, err := db.InsertMany(self.GetSessionContext(), adds)
 	if err != nil {
 		return self.Error("[Mongo.Save] save failed: ", err)
@@ -307,6 +323,18 @@ func (self *MGOManager) Save(data ...sqlc.Object) error {
 	if len(res.InsertedIDs) != len(adds) {
 		return self.Error("[Mongo.Save] save failed: InsertedIDs length invalid")
 	}
+	restore()
+	if err := self.callHooks(hookAfterSave, data...); err != nil {
+		return self.Error("[Mongo.Save] after save hook failed: ", err)
+	}
+	if self.auditable(obv.TableName) {
+		entries := make([]*AuditEntry, 0, len(data))
+		for _, v := range data {
+			entries = append(entries, self.newAudit(obv, AuditSave, nil, v))
+		}
+		self.addAudit(self.inTx(), entries...)
+	}
+	self.evictQueryCache(d.GetTable(), false)
 	return nil
 }
 
@@ -325,6 +353,12 @@ func (self *MGOManager) Update(data ...sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mongo.Update] registration object type not found [", d.GetTable(), "]")
 	}
+	if err := self.callHooks(hookBeforeUpdate, data...); err != nil {
+		return self.Error("[Mongo.Update] before update hook failed: ", err)
+	}
+	if len(self.MGOSyncData) == 0 {
+		setAutoTime(obv, false, data...)
+	}
 	db, err := self.GetDatabase(d.GetTable())
 	if err != nil {
 		return self.Error(err)
@@ -332,6 +366,13 @@ func (self *MGOManager) Update(data ...sqlc.Object) error {
 	if zlog.IsDebug() {
 		defer zlog.Debug("[Mongo.Update]", utils.UnixMilli(), zlog.Any("data", data))
 	}
+	restore, err := encryptObject(obv, data...)
+	if err != nil {
+		return self.Error("[Mongo.Update] ", err)
+	}
+	defer restore()
+	audit := self.auditable(obv.TableName)
+	var entries []*AuditEntry
 	var lastInsertId interface{}
 	for _, v := range data {
 		if obv.PkKind == reflect.Int64 {
@@ -355,14 +396,137 @@ func (self *MGOManager) Update(data ...sqlc.Object) error {
 		} else {
 			return self.Error("only Int64 and string and ObjectID type IDs are supported")
 		}
-		res, err := db.ReplaceOne(self.GetSessionContext(), bson.M{"_id": lastInsertId}, v)
+		var before sqlc.Object
+		if audit {
+			before = self.auditBefore(obv, db, lastInsertId)
+		}
+		filter := bson.M{"_id": lastInsertId}
+		var guards []*stateGuard
+		if len(self.MGOSyncData) == 0 { // 同步数据已由关系数据库校验
+			if guards, err = self.checkTransitions(obv, db, v, lastInsertId); err != nil {
+				return err
+			}
+			for _, guard := range guards { // 状态迁移校验, 防止读取后被并发修改
+				filter[guard.machine.field.FieldBsonName] = guard.from
+			}
+		}
+		res, err := db.ReplaceOne(self.GetSessionContext(), filter, v)
 		if err != nil {
 			return self.Error("[Mongo.Update] update failed: ", err)
 		}
+		if res.MatchedCount == 0 && len(guards) > 0 {
+			self.Errors = append(self.Errors, ErrStateConflict)
+			return ErrStateConflict
+		}
 		if res.ModifiedCount == 0 {
 			return self.Error("[Mongo.Update] update failed: ModifiedCount = 0")
 		}
+		self.addTransitions(self.inTx(), obv.TableName, lastInsertId, 1, guards)
+		if audit {
+			entries = append(entries, self.newAudit(obv, AuditUpdate, before, v))
+		}
+	}
+	restore()
+	if err := self.callHooks(hookAfterUpdate, data...); err != nil {
+		return self.Error("[Mongo.Update] after update hook failed: ", err)
+	}
+	self.addAudit(self.inTx(), entries...)
+	self.evictQueryCache(d.GetTable(), false)
+	return nil
+}
+
+// SaveOrUpdateByID 按_id批量upsert(ReplaceOne+upsert), 重复执行结果一致, 适用于MongoSync等同步场景的失败重试
+func (self *MGOManager) SaveOrUpdateByID(data ...sqlc.Object) error {
+	if data == nil || len(data) == 0 {
+		return self.Error("[Mongo.SaveOrUpdateByID] data is nil")
+	}
+	if len(data) > 2000 {
+		return self.Error("[Mongo.SaveOrUpdateByID] data length > 2000")
+	}
+	d := data[0]
+	if len(self.MGOSyncData) > 0 {
+		d = self.MGOSyncData[0].CacheModel
+	}
+	obv, ok := modelDrivers[d.GetTable()]
+	if !ok {
+		return self.Error("[Mongo.SaveOrUpdateByID] registration object type not found [", d.GetTable(), "]")
+	}
+	db, err := self.GetDatabase(d.GetTable())
+	if err != nil {
+		return self.Error(err)
+	}
+	if zlog.IsDebug() {
+		defer zlog.Debug("[Mongo.SaveOrUpdateByID]", utils.UnixMilli(), zlog.Any("data", data))
+	}
+	if len(self.MGOSyncData) == 0 {
+		setAutoTime(obv, true, data...)
+	}
+	models := make([]mongo.WriteModel, 0, len(data))
+	pks := make([]interface{}, 0, len(data))
+	for _, v := range data {
+		var pk interface{}
+		if obv.PkKind == reflect.Int64 {
+			id := utils.GetInt64(utils.GetPtr(v, obv.PkOffset))
+			if id == 0 {
+				id = utils.NextIID()
+				utils.SetInt64(utils.GetPtr(v, obv.PkOffset), id)
+			}
+			pk = id
+		} else if obv.PkKind == reflect.String {
+			id := utils.GetString(utils.GetPtr(v, obv.PkOffset))
+			if len(id) == 0 {
+				id = obv.nextStringId()
+				utils.SetString(utils.GetPtr(v, obv.PkOffset), id)
+			}
+			pk = id
+		} else if obv.PkType == "primitive.ObjectID" {
+			id := utils.GetObjectID(utils.GetPtr(v, obv.PkOffset))
+			if IsNullObjectID(id) {
+				id = primitive.NewObjectID()
+				utils.SetObjectID(utils.GetPtr(v, obv.PkOffset), id)
+			}
+			pk = id
+		} else {
+			return self.Error("only Int64 and string and ObjectID type IDs are supported")
+		}
+		pks = append(pks, pk)
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": pk}).SetReplacement(v).SetUpsert(true))
+	}
+	restore, err := encryptObject(obv, data...)
+	if err != nil {
+		return self.Error("[Mongo.SaveOrUpdateByID] ", err)
+	}
+	defer restore()
+	var befores []sqlc.Object
+	audit := self.auditable(obv.TableName)
+	if audit {
+		befores = make([]sqlc.Object, len(pks))
+		for i, pk := range pks {
+			befores[i] = self.auditBefore(obv, db, pk)
+		}
+	}
+	res, err := db.BulkWrite(self.GetSessionContext(), models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return self.Error("[Mongo.SaveOrUpdateByID] bulk write failed: ", err)
+	}
+	if res.MatchedCount+res.UpsertedCount != int64(len(models)) {
+		return self.Error("[Mongo.SaveOrUpdateByID] bulk write failed: matched + upserted != ", len(models))
+	}
+	if audit {
+		entries := make([]*AuditEntry, 0, len(data))
+		beforeImage := auditBeforeImage()
+		for i, v := range data {
+			if _, upserted := res.UpsertedIDs[int64(i)]; befores[i] == nil && (beforeImage || upserted) {
+				entries = append(entries, self.newAudit(obv, AuditSave, nil, v))
+			} else if befores[i] == nil { // 未读取变更前镜像, 按已存在数据记录为更新
+				entries = append(entries, self.newAudit(obv, AuditUpdate, nil, v))
+			} else {
+				entries = append(entries, self.newAudit(obv, AuditUpdate, befores[i], v))
+			}
+		}
+		self.addAudit(self.inTx(), entries...)
 	}
+	self.evictQueryCache(d.GetTable(), false)
 	return nil
 }
 
@@ -370,12 +534,26 @@ func (self *MGOManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if cnd.Model == nil {
 		return 0, self.Error("[Mongo.UpdateByCnd] data model is nil")
 	}
+	if err := checkMongoRaw(cnd); err != nil {
+		return 0, self.Error(err)
+	}
 	db, err := self.GetDatabase(cnd.Model.GetTable())
 	if err != nil {
 		return 0, err
 	}
+	upsets, err := encryptUpsets(modelDrivers[cnd.Model.GetTable()], cnd.Upsets)
+	if err != nil {
+		return 0, self.Error("[Mongo.UpdateByCnd] ", err)
+	}
+	upsets = autoTimeUpsets(modelDrivers[cnd.Model.GetTable()], upsets, true)
+	origin := cnd
+	var guards []*stateGuard
+	obv, ok := modelDrivers[cnd.Model.GetTable()]
+	if ok && len(self.MGOSyncData) == 0 { // 同步条件已由关系数据库追加状态校验
+		cnd, guards = guardCnd(obv, cnd, true)
+	}
 	match := buildMongoMatch(cnd)
-	upset := buildMongoUpset(cnd)
+	upset := buildMongoUpset(&sqlc.Cnd{Upsets: upsets})
 	if match == nil || len(match) == 0 {
 		return 0, self.Error("pipe match is nil")
 	}
@@ -387,9 +565,21 @@ func (self *MGOManager) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if err != nil {
 		return 0, self.Error("[Mongo.UpdateByCnd] update failed: ", err)
 	}
+	if res.MatchedCount == 0 && len(guards) > 0 {
+		if err := self.checkCndTransitions(obv, origin, guards); err != nil {
+			return 0, err
+		}
+	}
 	if res.ModifiedCount == 0 {
 		return 0, self.Error("[Mongo.Update] update failed: ModifiedCount = 0")
 	}
+	if ok {
+		self.addTransitions(self.inTx(), obv.TableName, nil, res.ModifiedCount, guards)
+		if self.auditable(obv.TableName) {
+			self.addAudit(self.inTx(), self.newCndAudit(obv, AuditUpdateByCnd, origin, res.ModifiedCount))
+		}
+	}
+	self.evictQueryCache(cnd.Model.GetTable(), false)
 	return res.ModifiedCount, nil
 }
 
@@ -408,6 +598,9 @@ func (self *MGOManager) Delete(data ...sqlc.Object) error {
 	if !ok {
 		return self.Error("[Mongo.Delete] registration object type not found [", d.GetTable(), "]")
 	}
+	if err := self.callHooks(hookBeforeDelete, data...); err != nil {
+		return self.Error("[Mongo.Delete] before delete hook failed: ", err)
+	}
 	db, err := self.GetDatabase(d.GetTable())
 	if err != nil {
 		return self.Error(err)
@@ -440,9 +633,17 @@ func (self *MGOManager) Delete(data ...sqlc.Object) error {
 		}
 	}
 	if len(delIds) > 0 {
-		if _, err := db.DeleteMany(self.GetSessionContext(), bson.M{"_id": bson.M{"$in": delIds}}); err != nil {
+		befores := self.auditBefores(obv, db, delIds)
+		if _, err := mongoDeleteMany(self.GetSessionContext(), db, obv, bson.M{"_id": bson.M{"$in": delIds}}); err != nil {
 			return self.Error("[Mongo.Delete] delete failed: ", err)
 		}
+		if err := self.callHooks(hookAfterDelete, data...); err != nil {
+			return self.Error("[Mongo.Delete] after delete hook failed: ", err)
+		}
+		if self.auditable(obv.TableName) {
+			self.addAudit(self.inTx(), self.deleteAudits(obv, befores, delIds)...)
+		}
+		self.evictQueryCache(d.GetTable(), false)
 	}
 	return nil
 }
@@ -458,7 +659,7 @@ func (self *MGOManager) DeleteById(object sqlc.Object, data ...interface{}) (int
 	if len(self.MGOSyncData) > 0 {
 		d = self.MGOSyncData[0].CacheModel
 	}
-	_, ok := modelDrivers[d.GetTable()]
+	obv, ok := modelDrivers[d.GetTable()]
 	if !ok {
 		return 0, self.Error("[Mongo.DeleteById] registration object type not found [", d.GetTable(), "]")
 	}
@@ -470,11 +671,16 @@ func (self *MGOManager) DeleteById(object sqlc.Object, data ...interface{}) (int
 		defer zlog.Debug("[Mongo.DeleteById]", utils.UnixMilli(), zlog.Any("data", data))
 	}
 	if len(data) > 0 {
-		res, err := db.DeleteMany(self.GetSessionContext(), bson.M{"_id": bson.M{"$in": data}})
+		befores := self.auditBefores(obv, db, data)
+		deleted, err := mongoDeleteMany(self.GetSessionContext(), db, obv, bson.M{"_id": bson.M{"$in": data}})
 		if err != nil {
 			return 0, self.Error("[Mongo.DeleteById] delete failed: ", err)
 		}
-		return res.DeletedCount, nil
+		if self.auditable(obv.TableName) {
+			self.addAudit(self.inTx(), self.deleteAudits(obv, befores, data)...)
+		}
+		self.evictQueryCache(d.GetTable(), false)
+		return deleted, nil
 	}
 	return 0, nil
 }
@@ -483,6 +689,9 @@ func (self *MGOManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
 	if cnd.Model == nil {
 		return 0, self.Error("[Mongo.DeleteByCnd] data model is nil")
 	}
+	if err := checkMongoRaw(cnd); err != nil {
+		return 0, self.Error(err)
+	}
 	db, err := self.GetDatabase(cnd.Model.GetTable())
 	if err != nil {
 		return 0, err
@@ -492,21 +701,36 @@ func (self *MGOManager) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
 		return 0, self.Error("pipe match is nil")
 	}
 	defer self.writeLog("[Mongo.DeleteByCnd]", utils.UnixMilli(), map[string]interface{}{"match": match}, nil)
-	res, err := db.DeleteMany(self.GetSessionContext(), match)
+	deleted, err := mongoDeleteMany(self.GetSessionContext(), db, modelDrivers[cnd.Model.GetTable()], match)
 	if err != nil {
 		return 0, self.Error("[Mongo.DeleteByCnd] delete failed: ", err)
 	}
-	if res.DeletedCount == 0 {
+	if deleted == 0 {
 		return 0, self.Error("[Mongo.DeleteByCnd] delete failed: ModifiedCount = 0")
 	}
-	return res.DeletedCount, nil
+	if obv, ok := modelDrivers[cnd.Model.GetTable()]; ok && self.auditable(obv.TableName) {
+		self.addAudit(self.inTx(), self.newCndAudit(obv, AuditDeleteByCnd, cnd, deleted))
+	}
+	self.evictQueryCache(cnd.Model.GetTable(), false)
+	return deleted, nil
 }
 
 func (self *MGOManager) Count(cnd *sqlc.Cnd) (int64, error) {
 	if cnd.Model == nil {
 		return 0, self.Error("[Mongo.Count] data model is nil")
 	}
-	db, err := self.GetDatabase(cnd.Model.GetTable())
+	if err := checkMongoRaw(cnd); err != nil {
+		return 0, self.Error(err)
+	}
+	defer softDeleteScope(modelDrivers[cnd.Model.GetTable()], cnd)()
+	cacheKey, useCache := self.queryCacheKey(cnd, cnd.Model.GetTable(), cacheKindCount)
+	if useCache {
+		if entry, hit := self.getQueryCache(cacheKey, nil); hit {
+			setPageTotal(cnd, entry.Total)
+			return entry.Total, nil
+		}
+	}
+	db, err := self.GetDatabase(cnd.Model.GetTable(), cnd)
 	if err != nil {
 		return 0, self.Error(err)
 	}
@@ -522,18 +746,10 @@ func (self *MGOManager) Count(cnd *sqlc.Cnd) (int64, error) {
 		return 0, self.Error("[Mongo.Count] count failed: ", err)
 	}
 	//pageTotal, err = db.EstimatedDocumentCount(self.GetSessionContext(), pipe)
-	if pageTotal > 0 && cnd.Pagination.PageSize > 0 {
-		var pageCount int64
-		if pageTotal%cnd.Pagination.PageSize == 0 {
-			pageCount = pageTotal / cnd.Pagination.PageSize
-		} else {
-			pageCount = pageTotal/cnd.Pagination.PageSize + 1
-		}
-		cnd.Pagination.PageCount = pageCount
-	} else {
-		cnd.Pagination.PageCount = 0
+	setPageTotal(cnd, pageTotal)
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Total: pageTotal}, nil)
 	}
-	cnd.Pagination.PageTotal = pageTotal
 	return pageTotal, nil
 }
 
@@ -549,7 +765,21 @@ func (self *MGOManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 	if data == nil {
 		return self.Error("[Mongo.FindOne] data is nil")
 	}
-	db, err := self.GetDatabase(data.GetTable())
+	if err := checkMongoRaw(cnd); err != nil {
+		return self.Error(err)
+	}
+	defer softDeleteScope(modelDrivers[data.GetTable()], cnd)()
+	defer maskScope(modelDrivers[data.GetTable()], cnd, data)()
+	cacheKey, useCache := self.queryCacheKey(cnd, data.GetTable(), cacheKindOne)
+	if useCache {
+		if entry, hit := self.getQueryCache(cacheKey, data); hit {
+			if string(entry.Data) == string(cacheNotFound) {
+				return self.notFound()
+			}
+			return nil
+		}
+	}
+	db, err := self.GetDatabase(data.GetTable(), cnd)
 	if err != nil {
 		return self.Error(err)
 	}
@@ -559,10 +789,19 @@ func (self *MGOManager) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
 	cur := db.FindOne(self.GetSessionContext(), pipe, opts...)
 	if err := cur.Decode(data); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil
+			if useCache {
+				self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Data: cacheNotFound}, nil)
+			}
+			return self.notFound()
 		}
 		return self.Error(err)
 	}
+	if err := decryptResult(modelDrivers[data.GetTable()], data); err != nil {
+		return self.Error("[Mongo.FindOne] ", err)
+	}
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{}, data)
+	}
 	return nil
 }
 
@@ -577,7 +816,24 @@ func (self *MGOManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 	if cnd.Model == nil {
 		return self.Error("[Mongo.FindList] data model is nil")
 	}
-	db, err := self.GetDatabase(cnd.Model.GetTable())
+	if err := checkMongoRaw(cnd); err != nil {
+		return self.Error(err)
+	}
+	defer softDeleteScope(modelDrivers[cnd.Model.GetTable()], cnd)()
+	defer maskScope(modelDrivers[cnd.Model.GetTable()], cnd, data)()
+	keyset, err := keysetScope(modelDrivers[cnd.Model.GetTable()], cnd, data, true)
+	if err != nil {
+		return self.Error("[Mongo.FindList] ", err)
+	}
+	defer keyset()
+	cacheKey, useCache := self.queryCacheKey(cnd, cnd.Model.GetTable(), cacheKindList)
+	if useCache {
+		if entry, hit := self.getQueryCache(cacheKey, data); hit {
+			setCachePagination(cnd, entry)
+			return nil
+		}
+	}
+	db, err := self.GetDatabase(cnd.Model.GetTable(), cnd)
 	if err != nil {
 		return self.Error(err)
 	}
@@ -637,6 +893,12 @@ func (self *MGOManager) FindList(cnd *sqlc.Cnd, data interface{}) error {
 		}
 		return self.Error(err)
 	}
+	if err := decryptResult(modelDrivers[cnd.Model.GetTable()], data); err != nil {
+		return self.Error("[Mongo.FindList] ", err)
+	}
+	if useCache {
+		self.putQueryCache(cnd, cacheKey, &queryCacheEntry{Total: cnd.Pagination.PageTotal, Count: cnd.Pagination.PageCount}, data)
+	}
 	return nil
 }
 
@@ -801,6 +1063,31 @@ func buildQueryOptions(cnd *sqlc.Cnd) []*options.FindOptions {
 //	return pipe, nil
 //}
 
+// 原生SQL条件及表达式仅关系数据库支持, mongo中忽略会扩大匹配范围, 直接返回错误
+func checkMongoRaw(cnd *sqlc.Cnd) error {
+	for _, v := range cnd.Conditions {
+		if v.Logic == sqlc.RAW_ {
+			return utils.Error("mongo unsupported raw condition: ", v.Key)
+		}
+		if v.Logic != sqlc.OR_ && v.Logic != sqlc.AND_ {
+			continue
+		}
+		for _, c := range v.Values {
+			if sub, ok := c.(*sqlc.Cnd); ok {
+				if err := checkMongoRaw(sub); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for k, v := range cnd.Upsets {
+		if _, ok := v.(sqlc.Expr); ok {
+			return utils.Error("mongo unsupported upset expression: ", k)
+		}
+	}
+	return nil
+}
+
 // 构建mongo逻辑条件命令
 func buildMongoMatch(cnd *sqlc.Cnd) bson.M {
 	if len(cnd.Conditions) == 0 {
@@ -846,24 +1133,45 @@ func buildMongoMatch(cnd *sqlc.Cnd) bson.M {
 			query[key] = bson.M{"$regex": value}
 		case sqlc.NOT_LIKE_:
 			// unsupported
-		case sqlc.OR_:
-			if values == nil || len(values) == 0 {
-				continue
-			}
+		case sqlc.OR_, sqlc.AND_:
 			var array []interface{}
 			for _, v := range values {
-				cnd, ok := v.(*sqlc.Cnd)
+				sub, ok := v.(*sqlc.Cnd)
 				if !ok {
 					continue
 				}
-				array = append(array, buildMongoMatch(cnd))
+				if match := buildMongoMatch(sub); len(match) > 0 {
+					array = append(array, match)
+				}
+			}
+			if len(array) == 0 {
+				continue
+			}
+			if v.Logic == sqlc.OR_ {
+				addMongoLogic(query, "$or", array)
+			} else {
+				addMongoLogic(query, "$and", array)
 			}
-			query["$or"] = array
 		}
 	}
 	return query
 }
 
+// 同级存在多个条件组时合并到$and, 避免覆盖
+func addMongoLogic(query bson.M, op string, array []interface{}) {
+	exist, ok := query[op]
+	if !ok {
+		query[op] = array
+		return
+	}
+	if op == "$and" {
+		query[op] = append(exist.([]interface{}), array...)
+		return
+	}
+	and, _ := query["$and"].([]interface{})
+	query["$and"] = append(and, bson.M{op: array})
+}
+
 // 构建mongo字段筛选命令
 func buildMongoProject(cnd *sqlc.Cnd) bson.M {
 	if len(cnd.AnyFields) == 0 && len(cnd.AnyNotFields) == 0 {
@@ -887,81 +1195,43 @@ func buildMongoProject(cnd *sqlc.Cnd) bson.M {
 	return project
 }
 
+// 构建mongo聚合命令, 包含$group及$project, 输出字段为分组字段及聚合别名
 func buildMongoAggregate(cnd *sqlc.Cnd) []map[string]interface{} {
 	if len(cnd.Groupbys) == 0 && len(cnd.Aggregates) == 0 {
 		return nil
 	}
-	group := make(map[string]interface{}, 5)
-	group2 := make(map[string]interface{}, 5)
-	project := make(map[string]interface{}, 10)
-	_idMap := make(map[string]interface{}, 5)
-	_idMap2 := make(map[string]interface{}, 5)
+	group := make(map[string]interface{}, len(cnd.Aggregates)+1)
+	project := make(map[string]interface{}, len(cnd.Groupbys)+len(cnd.Aggregates)+1)
 	project[BID] = 0
 	if len(cnd.Groupbys) > 0 {
+		idMap := make(map[string]interface{}, len(cnd.Groupbys))
 		for _, v := range cnd.Groupbys {
-			if v == JID {
-				_idMap[JID] = utils.AddStr("$_id")
-				_idMap2[JID] = utils.AddStr("$_id.id")
-				project[BID] = utils.AddStr("$_id.id")
-				project[BID] = utils.AddStr("$_id.id")
-			} else {
-				_idMap[v] = utils.AddStr("$", v)
-				_idMap2[v] = utils.AddStr("$_id.", v)
-				project[v] = utils.AddStr("$_id.", v)
-			}
+			idMap[v] = utils.AddStr("$", getKey(v))
+			project[v] = utils.AddStr("$_id.", v)
 		}
-		group[BID] = _idMap
-	}
-	if len(cnd.Aggregates) > 0 {
-		if _, b := group[BID]; !b {
-			group[BID] = 0
-		}
-		for _, v := range cnd.Aggregates {
-			k := v.Key
-			if k == JID {
-				if v.Logic == sqlc.SUM_ {
-					group[k] = map[string]string{"$sum": "$_id"}
-				} else if v.Logic == sqlc.MAX_ {
-					group[k] = map[string]string{"$max": "$_id"}
-				} else if v.Logic == sqlc.MIN_ {
-					group[k] = map[string]string{"$min": "$_id"}
-				} else if v.Logic == sqlc.AVG_ {
-					group[k] = map[string]string{"$avg": "$_id"}
-				}
-				project[BID] = utils.AddStr("$", k)
-			} else {
-				if v.Logic == sqlc.SUM_ {
-					group[k] = map[string]string{"$sum": utils.AddStr("$", k)}
-				} else if v.Logic == sqlc.MAX_ {
-					group[k] = map[string]string{"$max": utils.AddStr("$", k)}
-				} else if v.Logic == sqlc.MIN_ {
-					group[k] = map[string]string{"$min": utils.AddStr("$", k)}
-				} else if v.Logic == sqlc.AVG_ {
-					group[k] = map[string]string{"$avg": utils.AddStr("$", k)}
-				} else if v.Logic == sqlc.CNT_ {
-					if _, b := _idMap2[k]; b {
-						delete(_idMap2, k)
-					}
-					group2[v.Alias] = map[string]interface{}{"$sum": 1}
-					project[v.Alias] = 1
-					continue
-				}
-				project[v.Alias] = utils.AddStr("$", k)
-			}
-		}
-	}
-	var result []map[string]interface{}
-	if len(group) > 0 {
-		result = append(result, map[string]interface{}{"$group": group})
-	}
-	if len(group2) > 0 {
-		group2[BID] = _idMap2
-		result = append(result, map[string]interface{}{"$group": group2})
+		group[BID] = idMap
+	} else {
+		group[BID] = nil
 	}
-	if len(project) > 0 {
-		result = append(result, map[string]interface{}{"$project": project})
+	for _, v := range cnd.Aggregates {
+		field := utils.AddStr("$", getKey(v.Key))
+		switch v.Logic {
+		case sqlc.SUM_:
+			group[v.Alias] = map[string]interface{}{"$sum": field}
+		case sqlc.AVG_:
+			group[v.Alias] = map[string]interface{}{"$avg": field}
+		case sqlc.MIN_:
+			group[v.Alias] = map[string]interface{}{"$min": field}
+		case sqlc.MAX_:
+			group[v.Alias] = map[string]interface{}{"$max": field}
+		case sqlc.CNT_:
+			group[v.Alias] = map[string]interface{}{"$sum": 1}
+		default:
+			continue
+		}
+		project[v.Alias] = 1
 	}
-	return result
+	return []map[string]interface{}{{"$group": group}, {"$project": project}}
 }
 
 // 构建mongo字段更新命令
@@ -1057,3 +1327,29 @@ func (self *MGOManager) writeLog(title string, start int64, pipe, opts interface
 		defer zlog.Debug(title, start, zlog.String("pipe", utils.Bytes2Str(pipeStr)), zlog.Any("opts", opts))
 	}
 }
+
+// PingMongo 检测所有已初始化的mongo数据源, 返回数据源名称对应的检测结果
+func PingMongo(ctx context.Context) map[string]error {
+	result := make(map[string]error, len(mgoSessions))
+	for k, v := range mgoSessions {
+		if err := v.Session.Ping(ctx, readpref.Primary()); err != nil {
+			result[k] = utils.Error("mongo [", k, "] ping failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
+
+// CloseMongo 断开所有mongo数据源连接
+func CloseMongo(ctx context.Context) map[string]error {
+	result := make(map[string]error, len(mgoSessions))
+	for k, v := range mgoSessions {
+		if err := v.Session.Disconnect(ctx); err != nil {
+			result[k] = utils.Error("mongo [", k, "] disconnect failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
@@ -0,0 +1,543 @@
+package sqld
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MongoSync持久化队列, 开启后关系数据库事务提交前将待同步数据写入outbox表, 与业务数据同一事务提交
+// 后台任务按写入顺序逐条认领(租约)并同步到mongo, 失败按退避时间重试, 超过最大重试次数标记为失败不再处理
+// 同一文档的操作严格按写入顺序同步, 前序操作重试等待/其他实例处理中/已失败时跳过该文档的后续操作, 按条件操作阻塞同表后续操作
+// 同步操作为upsert/按ID删除/按条件更新, 租约到期重新认领时保持幂等
+
+const (
+	outboxPending = 0      // 待同步
+	outboxDead    = 2      // 超过重试次数
+	outboxLease   = 300000 // 认领租约/毫秒, 实例宕机后租约到期由其他实例继续处理
+)
+
+// MongoOutboxConfig outbox配置
+type MongoOutboxConfig struct {
+	DsName    string // outbox表所在数据源, 默认master, 同步时使用同名mongo数据源
+	Table     string // outbox表名, 默认mongo_sync_outbox
+	Interval  int64  // 轮询间隔/毫秒, 默认1000
+	BatchSize int    // 单次处理条数, 默认100
+	MaxRetry  int    // 最大重试次数, 默认10
+}
+
+// MongoOutboxStat 同步统计
+type MongoOutboxStat struct {
+	Pending int64 // 待同步条数
+	Lag     int64 // 最早待同步数据距今/毫秒
+	Applied int64 // 累计同步成功条数
+	Failed  int64 // 累计同步失败次数
+	Dead    int64 // 累计超过重试次数条数
+}
+
+type mongoOutbox struct {
+	config  MongoOutboxConfig
+	stop    chan struct{}
+	done    chan struct{}
+	pending int64
+	lag     int64
+	applied int64
+	failed  int64
+	dead    int64
+}
+
+type outboxData struct {
+	Objects []json.RawMessage `json:"objects,omitempty"`
+	Cnd     *outboxCnd        `json:"cnd,omitempty"`
+}
+
+type outboxCnd struct {
+	Conditions []outboxCondition      `json:"conditions,omitempty"`
+	Upsets     map[string]interface{} `json:"upsets,omitempty"`
+}
+
+type outboxCondition struct {
+	Logic  int           `json:"logic"`
+	Key    string        `json:"key,omitempty"`
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+	Subs   []*outboxCnd  `json:"subs,omitempty"` // OR/AND子条件
+}
+
+var (
+	outboxMu      sync.RWMutex
+	currentOutbox *mongoOutbox
+)
+
+// EnableMongoOutbox 开启MongoSync持久化队列并启动后台同步任务, 自动创建outbox表
+func EnableMongoOutbox(config MongoOutboxConfig) error {
+	if len(config.DsName) == 0 {
+		config.DsName = DIC.MASTER
+	}
+	if len(config.Table) == 0 {
+		config.Table = "mongo_sync_outbox"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 1000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.MaxRetry <= 0 {
+		config.MaxRetry = 10
+	}
+	db := &RDBManager{}
+	if err := db.GetDB(Option{DsName: config.DsName}); err != nil {
+		return err
+	}
+	if err := CreateOutboxTable(db, config.Table,
+		"`id` BIGINT NOT NULL PRIMARY KEY",
+		"`sync_type` INT NOT NULL",
+		"`tbl` VARCHAR(128) NOT NULL",
+		"`doc` VARCHAR(128) NOT NULL DEFAULT ''",
+		"`data` MEDIUMTEXT NOT NULL",
+		"`state` INT NOT NULL DEFAULT 0",
+		"`retry` INT NOT NULL DEFAULT 0",
+		"`next_time` BIGINT NOT NULL DEFAULT 0",
+		"`owner` VARCHAR(32) NOT NULL DEFAULT ''",
+		"`lease_time` BIGINT NOT NULL DEFAULT 0",
+		"`error` VARCHAR(512) NOT NULL DEFAULT ''",
+		"`ctime` BIGINT NOT NULL DEFAULT 0"); err != nil {
+		return utils.Error("[MongoOutbox] create table failed: ", err)
+	}
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	if currentOutbox != nil {
+		return utils.Error("[MongoOutbox] already enabled")
+	}
+	currentOutbox = &mongoOutbox{config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	go currentOutbox.run()
+	return nil
+}
+
+// StopMongoOutbox 停止后台同步任务, 停止后MongoSync恢复为提交后直接同步
+func StopMongoOutbox() {
+	outboxMu.Lock()
+	outbox := currentOutbox
+	currentOutbox = nil
+	outboxMu.Unlock()
+	if outbox != nil {
+		close(outbox.stop)
+		<-outbox.done
+	}
+}
+
+// MongoOutboxStats 获取同步统计, 未开启时返回零值
+func MongoOutboxStats() MongoOutboxStat {
+	outbox := getMongoOutbox()
+	if outbox == nil {
+		return MongoOutboxStat{}
+	}
+	return MongoOutboxStat{
+		Pending: atomic.LoadInt64(&outbox.pending),
+		Lag:     atomic.LoadInt64(&outbox.lag),
+		Applied: atomic.LoadInt64(&outbox.applied),
+		Failed:  atomic.LoadInt64(&outbox.failed),
+		Dead:    atomic.LoadInt64(&outbox.dead),
+	}
+}
+
+func getMongoOutbox() *mongoOutbox {
+	outboxMu.RLock()
+	defer outboxMu.RUnlock()
+	return currentOutbox
+}
+
+// 将待同步数据写入outbox表, 开启事务时在提交前调用, 写入成功后清空MGOSyncData
+func (self *RDBManager) writeMongoOutbox() error {
+	outbox := getMongoOutbox()
+	if outbox == nil || !self.MongoSync || len(self.MGOSyncData) == 0 {
+		return nil
+	}
+	if self.OpenTx && self.Tx == nil {
+		return utils.Error("[MongoOutbox] transaction already closed")
+	}
+	now := utils.UnixMilli()
+	parameter := make([]interface{}, 0, 8*len(self.MGOSyncData))
+	vpart := bytes.NewBuffer(make([]byte, 0, 18*len(self.MGOSyncData)))
+	for _, v := range self.MGOSyncData {
+		if len(v.CacheObject) == 0 && v.CacheCnd == nil {
+			continue
+		}
+		table := v.CacheModel.GetTable()
+		if v.CacheCnd != nil {
+			if err := checkMongoRaw(v.CacheCnd); err != nil {
+				zlog.Warn("[MongoOutbox] skip unsupported sync data", 0, zlog.String("table", table), zlog.AddError(err))
+				continue
+			}
+		}
+		// 按对象拆分记录, 每条记录对应单个文档, 按条件操作对应整表
+		items := []*MGOSyncData{v}
+		if v.CacheCnd == nil && len(v.CacheObject) > 1 {
+			items = make([]*MGOSyncData, 0, len(v.CacheObject))
+			for _, obj := range v.CacheObject {
+				items = append(items, &MGOSyncData{v.CacheOption, v.CacheModel, nil, []sqlc.Object{obj}})
+			}
+		}
+		for _, item := range items {
+			data, err := encodeOutboxData(item)
+			if err != nil {
+				return err
+			}
+			doc := ""
+			if item.CacheCnd == nil && len(item.CacheObject) == 1 {
+				doc = outboxDoc(modelDrivers[table], item.CacheObject[0])
+			}
+			vpart.WriteString("(?,?,?,?,?,?,?,?),")
+			parameter = append(parameter, utils.NextIID(), item.CacheOption, table, doc, data, outboxPending, now, now)
+		}
+	}
+	if vpart.Len() == 0 {
+		self.MGOSyncData = nil
+		return nil
+	}
+	str := vpart.String()
+	prepare := utils.AddStr("insert into `", outbox.config.Table, "` (`id`,`sync_type`,`tbl`,`doc`,`data`,`state`,`next_time`,`ctime`) values ", str[:len(str)-1])
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
+	defer cancel()
+	stmt, err := self.prepareContext(ctx, prepare)
+	if err != nil {
+		return utils.Error("[MongoOutbox] [ ", prepare, " ] prepare failed: ", err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.ExecContext(ctx, parameter...); err != nil {
+		return utils.Error("[MongoOutbox] write failed: ", err)
+	}
+	self.MGOSyncData = nil
+	return nil
+}
+
+func (self *mongoOutbox) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(time.Duration(self.config.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			if err := self.process(); err != nil {
+				zlog.Error("[MongoOutbox] process failed", 0, zlog.AddError(err))
+			}
+		}
+	}
+}
+
+// 按写入顺序逐条认领并同步, 前序操作未完成的文档跳过后续操作
+func (self *mongoOutbox) process() error {
+	db := &RDBManager{}
+	if err := db.GetDB(Option{DsName: self.config.DsName}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(db.Timeout)*time.Millisecond)
+	defer cancel()
+	table := self.config.Table
+	now := utils.UnixMilli()
+	blocked := &outboxBlocked{tables: map[string]bool{}, docs: map[string]bool{}, dirty: map[string]bool{}}
+	// 已失败的操作阻塞同一文档的后续操作, 需人工处理后删除失败记录
+	rows, err := db.queryContext(ctx, utils.AddStr("select distinct `tbl`,`doc` from `", table, "` where `state` = ?"), outboxDead)
+	if err != nil {
+		return utils.Error("[MongoOutbox] query failed: ", err)
+	}
+	for rows.Next() {
+		var tbl, doc string
+		if err := rows.Scan(&tbl, &doc); err != nil {
+			rows.Close()
+			return utils.Error("[MongoOutbox] read failed: ", err)
+		}
+		blocked.add(tbl, doc)
+	}
+	rows.Close()
+	rows, err = db.queryContext(ctx, utils.AddStr("select `id`,`sync_type`,`tbl`,`doc`,`data`,`retry`,`next_time`,`lease_time` from `", table, "` where `state` = ? order by `id` limit ?"), outboxPending, self.config.BatchSize)
+	if err != nil {
+		return utils.Error("[MongoOutbox] query failed: ", err)
+	}
+	type outboxRow struct {
+		id        int64
+		syncType  int
+		table     string
+		doc       string
+		data      string
+		retry     int
+		nextTime  int64
+		leaseTime int64
+	}
+	var list []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.syncType, &row.table, &row.doc, &row.data, &row.retry, &row.nextTime, &row.leaseTime); err != nil {
+			rows.Close()
+			return utils.Error("[MongoOutbox] read failed: ", err)
+		}
+		list = append(list, row)
+	}
+	rows.Close()
+	for _, row := range list {
+		if blocked.has(row.table, row.doc) || row.nextTime > now || row.leaseTime > now {
+			blocked.add(row.table, row.doc)
+			continue
+		}
+		res, err := db.execContext(ctx, utils.AddStr("update `", table, "` set `owner` = ?, `lease_time` = ? where `id` = ? and `state` = ? and `lease_time` <= ?"),
+			queryOwner, now+outboxLease, row.id, outboxPending, now)
+		if err != nil {
+			return utils.Error("[MongoOutbox] claim failed: ", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 { // 已被其他实例认领或处理
+			blocked.add(row.table, row.doc)
+			continue
+		}
+		err = self.apply(db, row.syncType, row.table, row.data)
+		if err == nil {
+			if _, err := db.execContext(ctx, utils.AddStr("delete from `", table, "` where `id` = ? and `owner` = ?"), row.id, queryOwner); err != nil {
+				return utils.Error("[MongoOutbox] remove failed: ", err)
+			}
+			atomic.AddInt64(&self.applied, 1)
+			continue
+		}
+		blocked.add(row.table, row.doc)
+		atomic.AddInt64(&self.failed, 1)
+		retry := row.retry + 1
+		state := outboxPending
+		if retry >= self.config.MaxRetry {
+			state = outboxDead
+			atomic.AddInt64(&self.dead, 1)
+		}
+		msg := err.Error()
+		if len(msg) > 512 {
+			msg = msg[:512]
+		}
+		zlog.Error("[MongoOutbox] sync failed", 0, zlog.Int64("id", row.id), zlog.String("table", row.table), zlog.String("doc", row.doc), zlog.Int("retry", retry), zlog.AddError(err))
+		if _, err := db.execContext(ctx, utils.AddStr("update `", table, "` set `state` = ?, `retry` = ?, `next_time` = ?, `owner` = '', `lease_time` = 0, `error` = ? where `id` = ? and `owner` = ?"),
+			state, retry, utils.UnixMilli()+self.backoff(retry), msg, row.id, queryOwner); err != nil {
+			return utils.Error("[MongoOutbox] update retry failed: ", err)
+		}
+	}
+	var pending int64
+	var oldest sql.NullInt64
+	if err := db.queryRowContext(ctx, utils.AddStr("select count(1), min(`ctime`) from `", table, "` where `state` = ?"), outboxPending).Scan(&pending, &oldest); err != nil {
+		return utils.Error("[MongoOutbox] stat failed: ", err)
+	}
+	atomic.StoreInt64(&self.pending, pending)
+	if oldest.Valid && pending > 0 {
+		atomic.StoreInt64(&self.lag, utils.UnixMilli()-oldest.Int64)
+	} else {
+		atomic.StoreInt64(&self.lag, 0)
+	}
+	return nil
+}
+
+// 未完成操作阻塞的表及文档
+type outboxBlocked struct {
+	tables map[string]bool // 按条件操作未完成, 阻塞同表全部后续操作
+	docs   map[string]bool // 表:文档ID
+	dirty  map[string]bool // 存在未完成的文档操作, 阻塞同表后续按条件操作
+}
+
+func (self *outboxBlocked) has(table, doc string) bool {
+	if self.tables[table] {
+		return true
+	}
+	if len(doc) == 0 {
+		return self.dirty[table]
+	}
+	return self.docs[utils.AddStr(table, ":", doc)]
+}
+
+func (self *outboxBlocked) add(table, doc string) {
+	if len(doc) == 0 {
+		self.tables[table] = true
+		return
+	}
+	self.docs[utils.AddStr(table, ":", doc)] = true
+	self.dirty[table] = true
+}
+
+// 文档主键, 用于同一文档操作排序
+func outboxDoc(obv *MdlDriver, obj sqlc.Object) string {
+	if obv == nil {
+		return ""
+	}
+	if obv.PkKind == reflect.Int64 {
+		return utils.AnyToStr(utils.GetInt64(utils.GetPtr(obj, obv.PkOffset)))
+	}
+	return utils.GetString(utils.GetPtr(obj, obv.PkOffset))
+}
+
+// CreateOutboxTable 创建outbox表, 列定义使用反引号标识符, 大字段MEDIUMTEXT在非MySQL数据库转换为TEXT, 按(state,id)建立索引
+func CreateOutboxTable(db *RDBManager, table string, columns ...string) error {
+	ddl := utils.AddStr("CREATE TABLE IF NOT EXISTS `", table, "` (", strings.Join(columns, ","))
+	var list []string
+	if len(db.Driver) == 0 || db.Driver == MYSQL {
+		list = append(list, utils.AddStr(ddl, ",INDEX `idx_state_id` (`state`, `id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"))
+	} else {
+		list = append(list, strings.ReplaceAll(ddl, " MEDIUMTEXT", " TEXT")+")",
+			utils.AddStr("CREATE INDEX IF NOT EXISTS `idx_", table, "_state_id` ON `", table, "` (`state`, `id`)"))
+	}
+	for _, v := range list {
+		if db.Driver == POSTGRES {
+			v = rebindPostgres(v)
+		}
+		if _, err := db.Db.Exec(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 重试退避时间, 按轮询间隔指数增长, 最长5分钟
+func (self *mongoOutbox) backoff(retry int) int64 {
+	delay := self.config.Interval
+	for i := 1; i < retry && delay < 300000; i++ {
+		delay *= 2
+	}
+	if delay > 300000 {
+		delay = 300000
+	}
+	return delay
+}
+
+func (self *mongoOutbox) apply(db *RDBManager, syncType int, table, data string) error {
+	obv, ok := modelDrivers[table]
+	if !ok {
+		return utils.Error("registration object type not found [", table, "]")
+	}
+	v, err := decodeOutboxData(obv, syncType, data)
+	if err != nil {
+		return err
+	}
+	return db.mongoSyncData(v.CacheOption, v.CacheModel, v.CacheCnd, v.CacheObject...)
+}
+
+// 加密字段以密文写入outbox表, 同步至mongo时不重复加密
+func encodeOutboxData(v *MGOSyncData) (string, error) {
+	obv := modelDrivers[v.CacheModel.GetTable()]
+	restore, err := encryptObject(obv, v.CacheObject...)
+	if err != nil {
+		return "", utils.Error("[MongoOutbox] ", err)
+	}
+	defer restore()
+	data := outboxData{Cnd: encodeOutboxCnd(v.CacheCnd)}
+	if data.Cnd != nil {
+		if data.Cnd.Upsets, err = encryptUpsets(obv, data.Cnd.Upsets); err != nil {
+			return "", utils.Error("[MongoOutbox] ", err)
+		}
+	}
+	for _, obj := range v.CacheObject {
+		bs, err := utils.JsonMarshal(obj)
+		if err != nil {
+			return "", utils.Error("[MongoOutbox] marshal object failed: ", err)
+		}
+		data.Objects = append(data.Objects, bs)
+	}
+	bs, err := json.Marshal(&data)
+	if err != nil {
+		return "", utils.Error("[MongoOutbox] marshal data failed: ", err)
+	}
+	return string(bs), nil
+}
+
+func encodeOutboxCnd(cnd *sqlc.Cnd) *outboxCnd {
+	if cnd == nil {
+		return nil
+	}
+	result := &outboxCnd{Upsets: cnd.Upsets}
+	for _, v := range cnd.Conditions {
+		condit := outboxCondition{Logic: v.Logic, Key: v.Key, Value: v.Value}
+		if v.Logic == sqlc.OR_ || v.Logic == sqlc.AND_ {
+			for _, sub := range v.Values {
+				if c, ok := sub.(*sqlc.Cnd); ok {
+					condit.Subs = append(condit.Subs, encodeOutboxCnd(c))
+				}
+			}
+		} else {
+			condit.Values = v.Values
+		}
+		result.Conditions = append(result.Conditions, condit)
+	}
+	return result
+}
+
+func decodeOutboxData(obv *MdlDriver, syncType int, str string) (*MGOSyncData, error) {
+	data := outboxData{}
+	decoder := json.NewDecoder(bytes.NewReader(utils.Str2Bytes(str)))
+	decoder.UseNumber() // 避免int64经float64转换丢失精度
+	if err := decoder.Decode(&data); err != nil {
+		return nil, utils.Error("[MongoOutbox] unmarshal data failed: ", err)
+	}
+	result := &MGOSyncData{CacheOption: syncType, CacheModel: obv.Object.NewObject(), CacheCnd: decodeOutboxCnd(data.Cnd, obv.Object)}
+	for _, v := range data.Objects {
+		obj := obv.Object.NewObject()
+		if err := utils.JsonUnmarshal(v, obj); err != nil {
+			return nil, utils.Error("[MongoOutbox] unmarshal object failed: ", err)
+		}
+		result.CacheObject = append(result.CacheObject, obj)
+	}
+	return result, nil
+}
+
+func decodeOutboxCnd(data *outboxCnd, model sqlc.Object) *sqlc.Cnd {
+	if data == nil {
+		return nil
+	}
+	var cnd *sqlc.Cnd
+	if model != nil {
+		cnd = sqlc.M(model)
+	} else {
+		cnd = sqlc.M()
+	}
+	for k, v := range data.Upsets {
+		if cnd.Upsets == nil {
+			cnd.Upsets = make(map[string]interface{}, len(data.Upsets))
+		}
+		cnd.Upsets[k] = outboxNumber(v)
+	}
+	for _, v := range data.Conditions {
+		condit := sqlc.Condition{Logic: v.Logic, Key: v.Key, Value: outboxNumber(v.Value)}
+		for _, sub := range v.Subs {
+			condit.Values = append(condit.Values, decodeOutboxCnd(sub, nil))
+		}
+		for _, value := range v.Values {
+			condit.Values = append(condit.Values, outboxNumber(value))
+		}
+		cnd.Conditions = append(cnd.Conditions, condit)
+	}
+	return cnd
+}
+
+// json.Number还原为int64或float64
+func outboxNumber(v interface{}) interface{} {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return n.String()
+	case []interface{}:
+		for i := range n {
+			n[i] = outboxNumber(n[i])
+		}
+	case map[string]interface{}:
+		for k := range n {
+			n[k] = outboxNumber(n[k])
+		}
+	}
+	return v
+}
@@ -63,6 +63,7 @@ func (self *MysqlManager) buildByConfig(manager cache.Cache, input ...MysqlConfi
 		// db.SetConnMaxIdleTime(time.Second * time.Duration(v.ConnMaxIdleTime))
 		rdb := &RDBManager{}
 		rdb.Db = db
+		rdb.Driver = MYSQL
 		rdb.DsName = dsName
 		rdb.Database = v.Database
 		rdb.CacheManager = manager
@@ -75,6 +76,9 @@ func (self *MysqlManager) buildByConfig(manager cache.Cache, input ...MysqlConfi
 		if v.Timeout > 0 {
 			rdb.Timeout = v.Timeout
 		}
+		rdb.SlowQuery = v.SlowQuery
+		rdb.SlowLogPath = v.SlowLogPath
+		rdb.initSlowLog()
 		rdbs[rdb.DsName] = rdb
 		zlog.Printf("mysql service【%s】has been started successful", dsName)
 	}
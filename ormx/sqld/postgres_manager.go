@@ -0,0 +1,101 @@
+package sqld
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/godaddy-x/freego/cache"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	_ "github.com/lib/pq"
+	"time"
+)
+
+// postgres配置参数
+type PostgresConfig struct {
+	DBConfig
+	SSLMode         string // disable/require/verify-full, 默认disable
+	Schema          string // 默认schema, 为空则使用public
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime int
+	ConnMaxIdleTime int
+}
+
+// postgres连接管理器, 复用RDBManager的sqlc.Cnd实现, 执行时自动转换为postgres语法
+type PostgresManager struct {
+	RDBManager
+}
+
+func (self *PostgresManager) Get(option ...Option) (*PostgresManager, error) {
+	if err := self.GetDB(option...); err != nil {
+		return nil, err
+	}
+	return self, nil
+}
+
+func (self *PostgresManager) InitConfig(input ...PostgresConfig) error {
+	return self.buildByConfig(nil, input...)
+}
+
+func (self *PostgresManager) InitConfigAndCache(manager cache.Cache, input ...PostgresConfig) error {
+	return self.buildByConfig(manager, input...)
+}
+
+func (self *PostgresManager) buildByConfig(manager cache.Cache, input ...PostgresConfig) error {
+	for _, v := range input {
+		dsName := DIC.MASTER
+		if len(v.DsName) > 0 {
+			dsName = v.DsName
+		}
+		if _, b := rdbs[dsName]; b {
+			return utils.Error("postgres init failed: [", v.DsName, "] exist")
+		}
+		if len(v.SSLMode) == 0 {
+			v.SSLMode = "disable"
+		}
+		if len(v.Charset) == 0 {
+			v.Charset = "UTF8"
+		}
+		link := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s client_encoding=%s", v.Host, v.Port, v.Username, v.Password, v.Database, v.SSLMode, v.Charset)
+		if len(v.Schema) > 0 {
+			link = utils.AddStr(link, " search_path=", v.Schema)
+		}
+		db, err := sql.Open("postgres", link)
+		if err != nil {
+			return utils.Error("postgres init failed: ", err)
+		}
+		db.SetMaxIdleConns(v.MaxIdleConns)
+		db.SetMaxOpenConns(v.MaxOpenConns)
+		db.SetConnMaxLifetime(time.Second * time.Duration(v.ConnMaxLifetime))
+		db.SetConnMaxIdleTime(time.Second * time.Duration(v.ConnMaxIdleTime))
+		rdb := &RDBManager{}
+		rdb.Db = db
+		rdb.Driver = POSTGRES
+		rdb.DsName = dsName
+		rdb.Database = v.Database
+		rdb.CacheManager = manager
+		if v.OpenTx {
+			rdb.OpenTx = v.OpenTx
+		}
+		if v.MongoSync {
+			rdb.MongoSync = v.MongoSync
+		}
+		if v.Timeout > 0 {
+			rdb.Timeout = v.Timeout
+		}
+		rdb.SlowQuery = v.SlowQuery
+		rdb.SlowLogPath = v.SlowLogPath
+		rdb.initSlowLog()
+		rdbs[rdb.DsName] = rdb
+		zlog.Printf("postgres service【%s】has been started successful", dsName)
+	}
+	if len(rdbs) == 0 {
+		return utils.Error("postgres init failed: sessions is nil")
+	}
+	return nil
+}
+
+func NewPostgres(option ...Option) (*PostgresManager, error) {
+	return new(PostgresManager).Get(option...)
+}
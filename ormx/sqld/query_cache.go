@@ -0,0 +1,168 @@
+package sqld
+
+import (
+	"encoding/json"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+)
+
+// 查询结果二级缓存, cnd.Cache(key, expire)开启后FindOne/FindList/Count优先读取CacheManager
+// 每张表维护一个版本号, 缓存key包含版本号, 写操作后更新版本号使该表全部缓存失效
+// 开启事务时在提交成功后更新版本号, 避免读取到未提交数据
+
+const (
+	queryCachePrefix = "sqld.cache."
+	queryCacheExpire = 60
+	cacheKindOne     = "one"
+	cacheKindList    = "list"
+	cacheKindCount   = "count"
+)
+
+var cacheNotFound = json.RawMessage("null")
+
+type queryCacheEntry struct {
+	Total int64           `json:"t"` // 分页总条数
+	Count int64           `json:"c"` // 分页总页数
+	Data  json.RawMessage `json:"d"`
+}
+
+func queryCacheVersionKey(table string) string {
+	return utils.AddStr(queryCachePrefix, "ver.", table)
+}
+
+// 按查询条件生成缓存key, 未指定key时按条件内容摘要生成
+func (self *DBManager) queryCacheKey(cnd *sqlc.Cnd, table, kind string) (string, bool) {
+	if self.CacheManager == nil || cnd == nil || !cnd.CacheConfig.Open {
+		return "", false
+	}
+	if obv, ok := modelDrivers[table]; ok && obv.Encrypted { // 加密字段明文不写入缓存
+		return "", false
+	}
+	version, err := self.CacheManager.GetString(queryCacheVersionKey(table))
+	if err != nil {
+		zlog.Warn("[QueryCache] read version failed", 0, zlog.String("table", table), zlog.AddError(err))
+		return "", false
+	}
+	if len(version) == 0 { // 版本号不存在时初始化, 避免过期后复用旧缓存
+		version = utils.NextSID()
+		if ok, err := self.CacheManager.PutNX(queryCacheVersionKey(table), version, 0); err != nil {
+			return "", false
+		} else if !ok {
+			if version, err = self.CacheManager.GetString(queryCacheVersionKey(table)); err != nil || len(version) == 0 {
+				return "", false
+			}
+		}
+	}
+	key := cnd.CacheConfig.Key
+	if len(key) == 0 {
+		p := cnd.Pagination
+		// 条件序列化失败(如子条件包含Raw)时不使用缓存, 避免不同查询共用同一key
+		parts, err := utils.JsonMarshal([]interface{}{cnd.Conditions, cnd.AnyFields, cnd.AnyNotFields, cnd.Distincts, cnd.Groupbys, cnd.Orderbys, cnd.Aggregates})
+		if err != nil {
+			zlog.Warn("[QueryCache] condition marshal failed, skip cache", 0, zlog.String("table", table), zlog.AddError(err))
+			return "", false
+		}
+		key = utils.MD5(utils.AddStr(parts,
+			p.PageNo, ".", p.PageSize, ".", p.IsPage, ".", p.IsOffset, ".", p.IsFastPage, ".", p.FastPageParam, ".", p.Cursor, ".", cnd.SampleSize, ".", cnd.LimitSize, ".", cnd.ShardTable))
+	}
+	return utils.AddStr(queryCachePrefix, cnd.CacheConfig.Prefix, table, ".", version, ".", kind, ".", key), true
+}
+
+// 读取缓存结果, 命中时将数据写入data并返回缓存项
+func (self *DBManager) getQueryCache(key string, data interface{}) (*queryCacheEntry, bool) {
+	bs, err := self.CacheManager.GetBytes(key)
+	if err != nil || len(bs) == 0 {
+		return nil, false
+	}
+	entry := &queryCacheEntry{}
+	if err := utils.JsonUnmarshal(bs, entry); err != nil {
+		return nil, false
+	}
+	if data != nil && len(entry.Data) > 0 && string(entry.Data) != string(cacheNotFound) {
+		if err := utils.JsonUnmarshal(entry.Data, data); err != nil {
+			return nil, false
+		}
+	}
+	return entry, true
+}
+
+// 写入缓存结果, 失败仅记录日志
+func (self *DBManager) putQueryCache(cnd *sqlc.Cnd, key string, entry *queryCacheEntry, data interface{}) {
+	if data != nil {
+		bs, err := utils.JsonMarshal(data)
+		if err != nil {
+			zlog.Warn("[QueryCache] marshal data failed", 0, zlog.String("key", key), zlog.AddError(err))
+			return
+		}
+		entry.Data = bs
+	}
+	bs, err := utils.JsonMarshal(entry)
+	if err != nil {
+		zlog.Warn("[QueryCache] marshal entry failed", 0, zlog.String("key", key), zlog.AddError(err))
+		return
+	}
+	expire := cnd.CacheConfig.Expire
+	if expire <= 0 {
+		expire = queryCacheExpire
+	}
+	if err := self.CacheManager.Put(key, bs, expire); err != nil {
+		zlog.Warn("[QueryCache] put failed", 0, zlog.String("key", key), zlog.AddError(err))
+	}
+}
+
+// 写操作后使表缓存失效, 事务中延迟到提交后执行
+func (self *DBManager) evictQueryCache(table string, delay bool) {
+	if self.CacheManager == nil {
+		return
+	}
+	if delay {
+		for _, v := range self.cacheTables {
+			if v == table {
+				return
+			}
+		}
+		self.cacheTables = append(self.cacheTables, table)
+		return
+	}
+	if err := self.CacheManager.Put(queryCacheVersionKey(table), utils.NextSID()); err != nil {
+		zlog.Error("[QueryCache] evict failed", 0, zlog.String("table", table), zlog.AddError(err))
+	}
+}
+
+// 关系数据库写操作后使表缓存失效
+func (self *RDBManager) evictTable(table string) {
+	self.evictQueryCache(table, self.OpenTx && self.Tx != nil)
+}
+
+// 事务提交后执行延迟的缓存失效
+func (self *DBManager) flushQueryCache() {
+	for _, v := range self.cacheTables {
+		self.evictQueryCache(v, false)
+	}
+	self.cacheTables = nil
+}
+
+// 按总条数计算分页总页数
+func setPageTotal(cnd *sqlc.Cnd, pageTotal int64) {
+	if pageTotal > 0 && cnd.Pagination.PageSize > 0 {
+		var pageCount int64
+		if pageTotal%cnd.Pagination.PageSize == 0 {
+			pageCount = pageTotal / cnd.Pagination.PageSize
+		} else {
+			pageCount = pageTotal/cnd.Pagination.PageSize + 1
+		}
+		cnd.Pagination.PageCount = pageCount
+	} else {
+		cnd.Pagination.PageCount = 0
+	}
+	cnd.Pagination.PageTotal = pageTotal
+}
+
+// 按分页参数回填缓存的总条数
+func setCachePagination(cnd *sqlc.Cnd, entry *queryCacheEntry) {
+	if cnd.Pagination.IsPage || cnd.Pagination.PageSize > 0 {
+		cnd.Pagination.PageTotal = entry.Total
+		cnd.Pagination.PageCount = entry.Count
+	}
+}
@@ -0,0 +1,294 @@
+package sqld
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/otelx"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 查询中断统计及失控查询终止
+// 数据库操作因超时或上下文取消失败时按数据源计数, 客户端超时后服务端仍可能继续执行, 由失控查询检测补充处理
+// 开启检测后定时扫描数据源当前账号/库下执行时间超过 Timeout*Factor 的查询: MySQL读取processlist并执行KILL QUERY,
+// Postgres读取pg_stat_activity并执行pg_cancel_backend, mongo读取currentOp并执行killOp, Kill为false时仅记录
+// 仅处理当前进程发起的查询: 关系库语句统一附加进程标识注释 /* freego:<owner> */, mongo连接appName附加进程标识,
+// 其他服务、迁移脚本、索引构建等同账号查询不受影响
+// 检测及终止结果写入zlog并上报指标, 查询语句已脱敏常量值, sqlite不支持检测
+
+type QueryKillerConfig struct {
+	DsName   string // 数据源名称, 为空时为默认数据源
+	Mongo    bool   // 是否mongo数据源
+	Factor   int64  // 执行时间超过Timeout的倍数判定为失控查询, 默认3
+	Interval int64  // 检测间隔/毫秒, 默认10000
+	Kill     bool   // 是否终止失控查询, 否则仅记录
+}
+
+type QueryStat struct {
+	Timeout    int64 // 超时中断次数
+	Canceled   int64 // 取消中断次数
+	Runaway    int64 // 检测到的失控查询次数
+	Killed     int64 // 已终止的失控查询次数
+	KillFailed int64 // 终止失败次数
+}
+
+type runawayQuery struct {
+	id    interface{} // MySQL连接ID/Postgres进程ID/mongo opid
+	secs  int64       // 已执行秒数
+	query string
+}
+
+type queryKiller struct {
+	config QueryKillerConfig
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+var (
+	queryOwner    = utils.MD5(utils.GetUUID())[:16] // 进程标识
+	queryTag      = utils.AddStr("/* freego:", queryOwner, " */ ")
+	queryKillerMu sync.Mutex
+	queryKillers  = map[string]*queryKiller{}
+	queryStats    sync.Map // dsName -> *QueryStat
+)
+
+// StartQueryKiller 开启数据源失控查询检测, 同一数据源重复开启时替换原检测
+func StartQueryKiller(config QueryKillerConfig) error {
+	if len(config.DsName) == 0 {
+		config.DsName = DIC.MASTER
+	}
+	if config.Factor <= 0 {
+		config.Factor = 3
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10000
+	}
+	if config.Mongo {
+		if _, ok := mgoSessions[config.DsName]; !ok {
+			return utils.Error("mongo datasource [", config.DsName, "] not found")
+		}
+	} else {
+		rdb, ok := rdbs[config.DsName]
+		if !ok {
+			return utils.Error("rdb datasource [", config.DsName, "] not found")
+		}
+		if rdb.Driver == SQLITE {
+			return utils.Error("query killer unsupported sqlite datasource [", config.DsName, "]")
+		}
+	}
+	killer := &queryKiller{config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	queryKillerMu.Lock()
+	old := queryKillers[config.DsName]
+	queryKillers[config.DsName] = killer
+	queryKillerMu.Unlock()
+	if old != nil {
+		old.close()
+	}
+	go killer.run()
+	zlog.Printf("query killer [%s] started successful", config.DsName)
+	return nil
+}
+
+// StopQueryKiller 停止全部失控查询检测
+func StopQueryKiller() {
+	queryKillerMu.Lock()
+	killers := queryKillers
+	queryKillers = map[string]*queryKiller{}
+	queryKillerMu.Unlock()
+	for _, v := range killers {
+		v.close()
+	}
+}
+
+// QueryStats 获取各数据源查询中断及失控查询统计
+func QueryStats() map[string]QueryStat {
+	result := map[string]QueryStat{}
+	queryStats.Range(func(key, value interface{}) bool {
+		stat := value.(*QueryStat)
+		result[key.(string)] = QueryStat{
+			Timeout:    atomic.LoadInt64(&stat.Timeout),
+			Canceled:   atomic.LoadInt64(&stat.Canceled),
+			Runaway:    atomic.LoadInt64(&stat.Runaway),
+			Killed:     atomic.LoadInt64(&stat.Killed),
+			KillFailed: atomic.LoadInt64(&stat.KillFailed),
+		}
+		return true
+	})
+	return result
+}
+
+// 连接appName附加进程标识, 未配置时为 freego-<owner>
+func mongoAppName(opts *options.ClientOptions) string {
+	if opts.AppName != nil && len(*opts.AppName) > 0 {
+		return utils.AddStr(*opts.AppName, "-", queryOwner)
+	}
+	return utils.AddStr("freego-", queryOwner)
+}
+
+func getQueryStat(ds string) *QueryStat {
+	if v, ok := queryStats.Load(ds); ok {
+		return v.(*QueryStat)
+	}
+	v, _ := queryStats.LoadOrStore(ds, &QueryStat{})
+	return v.(*QueryStat)
+}
+
+// 统计因超时或取消失败的数据库操作, data为Error参数
+func countQueryInterrupt(ds string, data []interface{}) {
+	for _, v := range data {
+		err, ok := v.(error)
+		if !ok {
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			atomic.AddInt64(&getQueryStat(ds).Canceled, 1)
+			promx.ObserveDBInterrupt(ds, "canceled")
+		} else if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+			atomic.AddInt64(&getQueryStat(ds).Timeout, 1)
+			promx.ObserveDBInterrupt(ds, "timeout")
+		}
+		return
+	}
+}
+
+func (self *queryKiller) close() {
+	close(self.stop)
+	<-self.done
+}
+
+func (self *queryKiller) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(time.Duration(self.config.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			if self.config.Mongo {
+				self.checkMongo()
+			} else {
+				self.checkRDB()
+			}
+		}
+	}
+}
+
+// 失控判定秒数, 不足1秒按1秒
+func runawaySeconds(timeout, factor int64) int64 {
+	secs := timeout * factor / 1000
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+func (self *queryKiller) checkRDB() {
+	rdb, ok := rdbs[self.config.DsName]
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rdb.Timeout)*time.Millisecond)
+	defer cancel()
+	secs := runawaySeconds(rdb.Timeout, self.config.Factor)
+	var rows *sql.Rows
+	var err error
+	if rdb.Driver == POSTGRES {
+		rows, err = rdb.Db.QueryContext(ctx, "select pid, floor(extract(epoch from now() - query_start))::bigint, query from pg_stat_activity where state = 'active' and usename = current_user and datname = current_database() and pid <> pg_backend_pid() and query_start < now() - $1 * interval '1 second' and left(query, length($2)) = $2", secs, queryTag)
+	} else {
+		rows, err = rdb.Db.QueryContext(ctx, "select id, time, info from information_schema.processlist where command in ('Query', 'Execute') and user = substring_index(current_user(), '@', 1) and db = database() and id <> connection_id() and time >= ? and left(info, ?) = ?", secs, len(queryTag), queryTag)
+	}
+	if err != nil {
+		zlog.Error("[QueryKiller] query runaway failed", 0, zlog.String("ds", self.config.DsName), zlog.AddError(err))
+		return
+	}
+	var runaways []*runawayQuery
+	for rows.Next() {
+		var id, took int64
+		var query sql.NullString
+		if err := rows.Scan(&id, &took, &query); err != nil {
+			zlog.Error("[QueryKiller] rows scan failed", 0, zlog.String("ds", self.config.DsName), zlog.AddError(err))
+			break
+		}
+		runaways = append(runaways, &runawayQuery{id: id, secs: took, query: query.String})
+	}
+	rows.Close()
+	for _, v := range runaways {
+		self.handle(rdb.driverName(), v, func() error {
+			if rdb.Driver == POSTGRES {
+				_, err := rdb.Db.ExecContext(ctx, "select pg_cancel_backend($1)", v.id)
+				return err
+			}
+			_, err := rdb.Db.ExecContext(ctx, "kill query "+strconv.FormatInt(v.id.(int64), 10))
+			return err
+		})
+	}
+}
+
+func (self *queryKiller) checkMongo() {
+	mgo, ok := mgoSessions[self.config.DsName]
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(mgo.Timeout)*time.Millisecond)
+	defer cancel()
+	admin := mgo.Session.Database("admin")
+	command := bson.D{
+		{Key: "currentOp", Value: 1},
+		{Key: "active", Value: true},
+		{Key: "secs_running", Value: bson.M{"$gte": runawaySeconds(mgo.Timeout, self.config.Factor)}},
+		{Key: "ns", Value: bson.M{"$regex": "^" + regexp.QuoteMeta(mgo.Database) + `\.`}},
+		{Key: "appName", Value: bson.M{"$regex": regexp.QuoteMeta(queryOwner) + "$"}},
+	}
+	result := struct {
+		Inprog []struct {
+			Opid        interface{} `bson:"opid"`
+			SecsRunning int64       `bson:"secs_running"`
+			Ns          string      `bson:"ns"`
+			Op          string      `bson:"op"`
+		} `bson:"inprog"`
+	}{}
+	if err := admin.RunCommand(ctx, command).Decode(&result); err != nil {
+		zlog.Error("[QueryKiller] current op failed", 0, zlog.String("ds", self.config.DsName), zlog.AddError(err))
+		return
+	}
+	for _, v := range result.Inprog {
+		opid := v.Opid
+		self.handle("mongodb", &runawayQuery{id: opid, secs: v.SecsRunning, query: utils.AddStr(v.Op, " ", v.Ns)}, func() error {
+			return admin.RunCommand(ctx, bson.D{{Key: "killOp", Value: 1}, {Key: "op", Value: opid}}).Err()
+		})
+	}
+}
+
+// 记录失控查询, 开启Kill时执行终止
+func (self *queryKiller) handle(system string, query *runawayQuery, kill func() error) {
+	ds := self.config.DsName
+	stat := getQueryStat(ds)
+	atomic.AddInt64(&stat.Runaway, 1)
+	promx.ObserveDBRunaway(system, ds, "detected")
+	statement := otelx.SanitizeSQL(query.query)
+	zlog.Warn("[QueryKiller] runaway query detected", 0, zlog.String("ds", ds), zlog.Any("id", query.id), zlog.Int64("secs", query.secs), zlog.String("query", statement))
+	if !self.config.Kill {
+		return
+	}
+	if err := kill(); err != nil {
+		atomic.AddInt64(&stat.KillFailed, 1)
+		promx.ObserveDBRunaway(system, ds, "failure")
+		zlog.Error("[QueryKiller] runaway query kill failed", 0, zlog.String("ds", ds), zlog.Any("id", query.id), zlog.AddError(err))
+		return
+	}
+	atomic.AddInt64(&stat.Killed, 1)
+	promx.ObserveDBRunaway(system, ds, "killed")
+	zlog.Warn("[QueryKiller] runaway query killed", 0, zlog.String("ds", ds), zlog.Any("id", query.id), zlog.Int64("secs", query.secs))
+}
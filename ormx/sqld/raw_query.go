@@ -0,0 +1,24 @@
+package sqld
+
+import (
+	"context"
+	"database/sql"
+)
+
+// 原生语句执行, 供扩展组件(如消息outbox)在同一事务内读写自有表
+// 开启事务时在事务内执行, postgres自动转换占位符及标识符引号, 语句附加进程标识注释
+
+// ExecContext 执行原生语句
+func (self *RDBManager) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return self.execContext(ctx, query, args...)
+}
+
+// QueryContext 执行原生查询
+func (self *RDBManager) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return self.queryContext(ctx, query, args...)
+}
+
+// QueryRowContext 执行原生单行查询
+func (self *RDBManager) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return self.queryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,393 @@
+package sqld
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/ormx/sqld/dialect"
+	"github.com/godaddy-x/freego/utils"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 分表, 模型字段声明shard:"true"作为分片键, RegisterSharding指定分片策略后
+// Save/Update/Delete/FindById按对象分片键值, 其余按条件中分片键的Eq值改写表名, 如 ow_wallet -> ow_wallet_03
+// 条件不含分片键时FindList/Count跨全部分片查询并合并结果, 其余操作返回错误
+// cnd.InShard(table)可直接指定分片表, 分片仅作用于关系数据库, mongo仍使用逻辑表名
+
+// ShardingPolicy 分片策略
+type ShardingPolicy interface {
+	// 按分片键值返回分片表名
+	Table(table string, value interface{}) (string, error)
+	// 返回全部分片表名, 用于跨分片查询
+	Tables(table string) ([]string, error)
+}
+
+// HashSharding 按分片键哈希取模, 表名后缀为两位序号, 如 ow_wallet_03
+type HashSharding struct {
+	Count int // 分片数量
+}
+
+func (self *HashSharding) Table(table string, value interface{}) (string, error) {
+	if self.Count <= 0 {
+		return "", utils.Error("hash sharding count invalid: ", table)
+	}
+	var hash uint64
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := rv.Int()
+		if n < 0 {
+			n = -n
+		}
+		hash = uint64(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		hash = rv.Uint()
+	case reflect.String:
+		hash = uint64(crc32.ChecksumIEEE(utils.Str2Bytes(rv.String())))
+	default:
+		return "", utils.Error("hash sharding value type invalid: ", table)
+	}
+	return fmt.Sprintf("%s_%02d", table, hash%uint64(self.Count)), nil
+}
+
+func (self *HashSharding) Tables(table string) ([]string, error) {
+	if self.Count <= 0 {
+		return nil, utils.Error("hash sharding count invalid: ", table)
+	}
+	result := make([]string, 0, self.Count)
+	for i := 0; i < self.Count; i++ {
+		result = append(result, fmt.Sprintf("%s_%02d", table, i))
+	}
+	return result, nil
+}
+
+// DateSharding 按分片键时间分表, 分片键为毫秒时间戳/time.Time/日期字符串, 如 ow_wallet_202301
+type DateSharding struct {
+	Layout string    // 表名后缀格式, 默认200601按月, 20060102按天, 2006按年
+	Start  time.Time // 最早分片时间, 跨分片查询时使用
+	End    time.Time // 最晚分片时间, 为空则为当前时间
+}
+
+func (self *DateSharding) layout() string {
+	if len(self.Layout) == 0 {
+		return "200601"
+	}
+	return self.Layout
+}
+
+func (self *DateSharding) Table(table string, value interface{}) (string, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := time.ParseInLocation(fieldTime.fmt, v, fieldTime.local)
+		if err != nil {
+			return "", utils.Error("date sharding value invalid: ", table, " ", v)
+		}
+		t = parsed
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			if rv.Int() <= 0 {
+				return "", utils.Error("date sharding value invalid: ", table)
+			}
+			t = utils.Int2Time(rv.Int())
+		default:
+			return "", utils.Error("date sharding value type invalid: ", table)
+		}
+	}
+	return utils.AddStr(table, "_", t.In(fieldTime.local).Format(self.layout())), nil
+}
+
+func (self *DateSharding) Tables(table string) ([]string, error) {
+	if self.Start.IsZero() {
+		return nil, utils.Error("date sharding start time is nil: ", table)
+	}
+	layout := self.layout()
+	end := self.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	var result []string
+	exist := make(map[string]bool)
+	for t := self.Start.In(fieldTime.local); !t.After(end); {
+		name := utils.AddStr(table, "_", t.Format(layout))
+		if !exist[name] {
+			exist[name] = true
+			result = append(result, name)
+		}
+		if strings.Contains(layout, "02") {
+			t = t.AddDate(0, 0, 1)
+		} else if strings.Contains(layout, "01") {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		} else {
+			t = time.Date(t.Year()+1, 1, 1, 0, 0, 0, 0, t.Location())
+		}
+	}
+	return result, nil
+}
+
+// RegisterSharding 为已注册模型指定分片策略, 模型需声明shard:"true"字段
+func RegisterSharding(model sqlc.Object, policy ShardingPolicy) {
+	obv, ok := modelDrivers[model.GetTable()]
+	if !ok {
+		panic("registration object type not found: " + model.GetTable())
+	}
+	if obv.ShardKey == nil {
+		panic("shard key field not found: " + model.GetTable())
+	}
+	if policy == nil {
+		panic("sharding policy is nil: " + model.GetTable())
+	}
+	obv.Sharding = policy
+}
+
+// 读取分片键原始值, 时间字段不做格式化
+func shardKeyValue(obv *MdlDriver, data sqlc.Object) (interface{}, error) {
+	field := *obv.ShardKey
+	field.IsDate = false
+	return GetValue(data, &field)
+}
+
+// 条件中分片键的Eq值
+func shardCndValue(obv *MdlDriver, cnd *sqlc.Cnd) (interface{}, bool) {
+	if cnd == nil {
+		return nil, false
+	}
+	for _, v := range cnd.Conditions {
+		if v.Logic == sqlc.EQ_ && v.Key == obv.ShardKey.FieldJsonName {
+			return v.Value, true
+		}
+	}
+	return nil, false
+}
+
+// 是否需要跨分片查询
+func isScatter(obv *MdlDriver, cnd *sqlc.Cnd) bool {
+	if obv.Sharding == nil || cnd == nil || len(cnd.ShardTable) > 0 {
+		return false
+	}
+	_, ok := shardCndValue(obv, cnd)
+	return !ok
+}
+
+// 按条件获取分片表名, 未分片时返回逻辑表名
+func shardTableByCnd(obv *MdlDriver, cnd *sqlc.Cnd) (string, error) {
+	if obv.Sharding == nil {
+		return obv.TableName, nil
+	}
+	if cnd != nil && len(cnd.ShardTable) > 0 {
+		return cnd.ShardTable, nil
+	}
+	value, ok := shardCndValue(obv, cnd)
+	if !ok {
+		return "", utils.Error("shard key [", obv.ShardKey.FieldJsonName, "] eq condition is required: ", obv.TableName)
+	}
+	return obv.Sharding.Table(obv.TableName, value)
+}
+
+// 按对象获取分片表名, 多个对象须位于同一分片
+func shardTableByData(obv *MdlDriver, data ...sqlc.Object) (string, error) {
+	if obv.Sharding == nil {
+		return obv.TableName, nil
+	}
+	var table string
+	for _, v := range data {
+		value, err := shardKeyValue(obv, v)
+		if err != nil {
+			return "", err
+		}
+		name, err := obv.Sharding.Table(obv.TableName, value)
+		if err != nil {
+			return "", err
+		}
+		if len(table) > 0 && table != name {
+			return "", utils.Error("objects must be in the same shard: ", table, " ", name)
+		}
+		table = name
+	}
+	return table, nil
+}
+
+// 按主键获取分片表名, 仅分片键为主键时支持, 多个主键须位于同一分片
+func shardTableByIds(obv *MdlDriver, ids ...interface{}) (string, error) {
+	if obv.Sharding == nil {
+		return obv.TableName, nil
+	}
+	if !obv.ShardKey.Primary {
+		return "", utils.Error("shard key is not primary key, you can use [deleteByCnd]: ", obv.TableName)
+	}
+	var table string
+	for _, v := range ids {
+		name, err := obv.Sharding.Table(obv.TableName, v)
+		if err != nil {
+			return "", err
+		}
+		if len(table) > 0 && table != name {
+			return "", utils.Error("objects must be in the same shard: ", table, " ", name)
+		}
+		table = name
+	}
+	return table, nil
+}
+
+// 跨分片统计总数
+func (self *RDBManager) countShards(obv *MdlDriver, cnd *sqlc.Cnd) (int64, error) {
+	tables, err := obv.Sharding.Tables(obv.TableName)
+	if err != nil {
+		return 0, self.Error("[Mysql.Count] ", err)
+	}
+	var total int64
+	for _, table := range tables {
+		sub := shardSubCnd(cnd, table)
+		count, err := self.Count(sub)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// 跨分片查询列表, 每个分片查询前offset+size条, 合并排序后截取分页
+func (self *RDBManager) findListShards(obv *MdlDriver, cnd *sqlc.Cnd, data interface{}) error {
+	resultv := reflect.ValueOf(data)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		return self.Error("[Mysql.FindList] target value kind not slice ptr")
+	}
+	tables, err := obv.Sharding.Tables(obv.TableName)
+	if err != nil {
+		return self.Error("[Mysql.FindList] ", err)
+	}
+	pagination := cnd.Pagination
+	var offset, size int64
+	if pagination.PageSize > 0 {
+		size = pagination.PageSize
+		if pagination.IsOffset {
+			offset = pagination.PageNo
+		} else if pagination.PageNo > 0 {
+			offset = (pagination.PageNo - 1) * pagination.PageSize
+		}
+	}
+	sliceType := resultv.Elem().Type()
+	merged := reflect.MakeSlice(sliceType, 0, 0)
+	var total int64
+	for _, table := range tables {
+		sub := shardSubCnd(cnd, table)
+		if pagination.IsPage && !pagination.IsOffset {
+			count, err := self.Count(shardSubCnd(cnd, table))
+			if err != nil {
+				return err
+			}
+			total += count
+		}
+		if size > 0 { // 各分片均取前offset+size条, 不受单页最大条数限制
+			sub.Pagination = dialect.Dialect{PageSize: offset + size, Spilled: true, IsOffset: true, IsPage: true}
+		}
+		list := reflect.New(sliceType)
+		if err := self.FindList(sub, list.Interface()); err != nil {
+			return err
+		}
+		merged = reflect.AppendSlice(merged, list.Elem())
+	}
+	sortShardResult(obv, cnd.Orderbys, merged)
+	if size > 0 {
+		start, end := offset, offset+size
+		if start > int64(merged.Len()) {
+			start = int64(merged.Len())
+		}
+		if end > int64(merged.Len()) {
+			end = int64(merged.Len())
+		}
+		merged = merged.Slice(int(start), int(end))
+	}
+	resultv.Elem().Set(merged)
+	if pagination.IsPage && !pagination.IsOffset {
+		setPageTotal(cnd, total)
+	}
+	return nil
+}
+
+// 复制条件并指定分片表, 去除分页及缓存设置
+func shardSubCnd(cnd *sqlc.Cnd, table string) *sqlc.Cnd {
+	sub := *cnd
+	sub.Conditions = append(make([]sqlc.Condition, 0, len(cnd.Conditions)+1), cnd.Conditions...)
+	sub.Pagination = dialect.Dialect{}
+	sub.CacheConfig = sqlc.CacheConfig{}
+	sub.ShardTable = table
+	return &sub
+}
+
+// 按排序条件合并各分片结果
+func sortShardResult(obv *MdlDriver, orderbys []sqlc.Condition, list reflect.Value) {
+	if len(orderbys) == 0 || list.Len() < 2 {
+		return
+	}
+	fields := make([]*FieldElem, 0, len(orderbys))
+	sorts := make([]int, 0, len(orderbys))
+	for _, v := range orderbys {
+		for _, field := range obv.FieldElem {
+			if field.FieldJsonName == v.Key {
+				elem := *field
+				elem.IsDate = false
+				fields = append(fields, &elem)
+				order, _ := v.Value.(int)
+				sorts = append(sorts, order)
+				break
+			}
+		}
+	}
+	sort.SliceStable(list.Interface(), func(i, j int) bool {
+		a := list.Index(i).Interface()
+		b := list.Index(j).Interface()
+		for k, field := range fields {
+			va, _ := GetValue(a, field)
+			vb, _ := GetValue(b, field)
+			c := compareValue(va, vb)
+			if c == 0 {
+				continue
+			}
+			if sorts[k] == sqlc.DESC_ {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+func compareValue(a, b interface{}) int {
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch ra.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, y := ra.Int(), rb.Int()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, y := ra.Uint(), rb.Uint()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case reflect.Float32, reflect.Float64:
+		x, y := ra.Float(), rb.Float()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,134 @@
+package sqld
+
+import (
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 关系数据库慢查询, 执行耗时超过SlowQuery(毫秒)时写入SlowLogPath并回调已注册的hook
+
+// SlowQueryHook 慢查询回调, 可用于上报APM
+type SlowQueryHook func(sql string, args []interface{}, took time.Duration)
+
+var (
+	slowLogMu      sync.RWMutex
+	slowLogs       = make(map[string]*zap.Logger) // 慢查询日志路径 -> 日志, 各数据源按SlowLogPath区分, 相同路径共用
+	slowQueryMu    sync.RWMutex
+	slowQueryHooks []SlowQueryHook
+)
+
+// RegisterSlowQueryHook 注册慢查询回调, 需数据源配置SlowQuery
+func RegisterSlowQueryHook(hook SlowQueryHook) {
+	if hook == nil {
+		return
+	}
+	slowQueryMu.Lock()
+	defer slowQueryMu.Unlock()
+	slowQueryHooks = append(slowQueryHooks, hook)
+}
+
+// SetSlowQuery 运行时调整数据源慢查询阈值/毫秒, 0则关闭, 对之后获取的连接对象生效; dsName为空时为默认数据源
+func SetSlowQuery(dsName string, slowQuery int64) error {
+	if len(dsName) == 0 {
+		dsName = DIC.MASTER
+	}
+	if slowQuery < 0 {
+		slowQuery = 0
+	}
+	found := false
+	if rdb, ok := rdbs[dsName]; ok {
+		atomic.StoreInt64(&rdb.SlowQuery, slowQuery)
+		rdb.initSlowLog()
+		found = true
+	}
+	if mgo, ok := mgoSessions[dsName]; ok {
+		atomic.StoreInt64(&mgo.SlowQuery, slowQuery)
+		mgo.initSlowLog()
+		found = true
+	}
+	if !found {
+		return utils.Error("datasource [", dsName, "] not found")
+	}
+	zlog.Info("slow query threshold changed", 0, zlog.String("ds", dsName), zlog.Int64("slowQuery", slowQuery))
+	return nil
+}
+
+// initSlowLog 按数据源SlowLogPath创建慢查询日志, 路径已创建时复用
+func initSlowLog(path, name string) {
+	slowLogMu.Lock()
+	defer slowLogMu.Unlock()
+	if _, ok := slowLogs[path]; ok {
+		return
+	}
+	slowlog := zlog.InitNewLog(&zlog.ZapConfig{
+		Level:   "warn",
+		Console: false,
+		FileConfig: &zlog.FileConfig{
+			Compress:   true,
+			Filename:   path,
+			MaxAge:     7,
+			MaxBackups: 7,
+			MaxSize:    512,
+		}})
+	slowlog.Info(utils.AddStr(name, " query monitoring service started successful..."))
+	slowLogs[path] = slowlog
+}
+
+// getSlowLog 获取SlowLogPath对应的慢查询日志, 未创建时返回nil
+func getSlowLog(path string) *zap.Logger {
+	if len(path) == 0 {
+		return nil
+	}
+	slowLogMu.RLock()
+	defer slowLogMu.RUnlock()
+	return slowLogs[path]
+}
+
+func (self *RDBManager) initSlowLog() {
+	if self.SlowQuery == 0 || len(self.SlowLogPath) == 0 {
+		return
+	}
+	initSlowLog(self.SlowLogPath, "RDB")
+}
+
+// 记录慢查询, start为执行开始时间, err指向执行结果错误(defer时取值)
+func (self *RDBManager) writeSlowLog(title, prepare string, args []interface{}, start time.Time, err *error) {
+	var cause error
+	if err != nil {
+		cause = *err
+	}
+	self.traceQuery(title, prepare, start, cause)
+	self.observeQuery(title, prepare, start, cause)
+	if self.SlowQuery <= 0 {
+		return
+	}
+	took := time.Since(start)
+	cost := took.Milliseconds()
+	if cost <= self.SlowQuery {
+		return
+	}
+	if slowlog := getSlowLog(self.SlowLogPath); slowlog != nil {
+		slowlog.Warn(title, zlog.Int64("cost", cost), zlog.String("ds", self.DsName), zlog.String("sql", prepare), zlog.Any("values", args))
+	}
+	slowQueryMu.RLock()
+	hooks := slowQueryHooks
+	slowQueryMu.RUnlock()
+	for _, hook := range hooks {
+		callSlowQueryHook(hook, prepare, args, took)
+	}
+}
+
+// hook异常不影响数据库操作
+func callSlowQueryHook(hook SlowQueryHook, prepare string, args []interface{}, took time.Duration) {
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Error("slow query hook panic", 0, zlog.Any("error", r))
+		}
+	}()
+	hook(prepare, args, took)
+}
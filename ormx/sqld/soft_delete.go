@@ -0,0 +1,97 @@
+package sqld
+
+import (
+	"bytes"
+	"context"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+)
+
+// 软删除, 模型字段声明softdel标签后Delete/DeleteById/DeleteByCnd改为更新该字段
+// softdel:"true" 删除时写入当前毫秒时间戳, 字段为0表示未删除(如deleted_at)
+// softdel:"2" 删除时写入指定状态值, 字段不等于该值表示未删除(如state)
+// FindOne/FindList/Count/Exists自动过滤已删除数据, cnd.Unscoped()时包含已删除数据
+// FindById及Complex查询不做过滤
+
+// 解析软删除标签, 仅支持整数类型字段
+func parseSoftDelete(md *MdlDriver, f *FieldElem, tag string) {
+	if len(tag) == 0 {
+		return
+	}
+	switch f.FieldKind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	default:
+		panic("soft delete field must be int type: " + md.TableName + "." + f.FieldName)
+	}
+	if md.SoftDel != nil {
+		panic("soft delete field exist: " + md.TableName + "." + f.FieldName)
+	}
+	if tag != sqlc.True {
+		state, err := utils.StrToInt64(tag)
+		if err != nil || state == 0 {
+			panic("soft delete state invalid: " + md.TableName + "." + f.FieldName)
+		}
+		md.SoftDelState = state
+	}
+	md.SoftDel = f
+}
+
+// 删除时写入的字段值
+func (self *MdlDriver) softDeleteValue() int64 {
+	if self.SoftDelState != 0 {
+		return self.SoftDelState
+	}
+	return utils.UnixMilli()
+}
+
+// 软删除模型生成update语句, 否则生成delete语句, 返回补充更新值后的参数
+func writeDeleteSql(buf *bytes.Buffer, obv *MdlDriver, table string, parameter []interface{}) []interface{} {
+	if obv.SoftDel == nil {
+		buf.WriteString("delete from ")
+		buf.WriteString(table)
+		return parameter
+	}
+	buf.WriteString("update ")
+	buf.WriteString(table)
+	buf.WriteString(" set `")
+	buf.WriteString(obv.SoftDel.FieldJsonName)
+	buf.WriteString("` = ?")
+	return append([]interface{}{obv.softDeleteValue()}, parameter...)
+}
+
+// 软删除模型更新删除字段, 否则物理删除, 返回影响条数
+func mongoDeleteMany(ctx context.Context, db *mongo.Collection, obv *MdlDriver, filter interface{}) (int64, error) {
+	if obv == nil || obv.SoftDel == nil {
+		res, err := db.DeleteMany(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+		return res.DeletedCount, nil
+	}
+	res, err := db.UpdateMany(ctx, filter, bson.M{"$set": bson.M{obv.SoftDel.FieldBsonName: obv.softDeleteValue()}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// 查询时追加未删除条件, 返回的函数用于查询结束后移除该条件, 避免影响调用方复用cnd
+func softDeleteScope(obv *MdlDriver, cnd *sqlc.Cnd) func() {
+	if obv == nil || obv.SoftDel == nil || cnd == nil || cnd.Unscope {
+		return func() {}
+	}
+	size := len(cnd.Conditions)
+	if obv.SoftDelState != 0 {
+		cnd.NotEq(obv.SoftDel.FieldJsonName, obv.SoftDelState)
+	} else {
+		cnd.Eq(obv.SoftDel.FieldJsonName, 0)
+	}
+	return func() {
+		if len(cnd.Conditions) > size {
+			cnd.Conditions = append(cnd.Conditions[:size], cnd.Conditions[size+1:]...)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"strings"
+	"sync"
+)
+
+// 复杂查询SQL安全校验, FindOneComplex/FindListComplex直接拼接表名、别名、join on条件及字段表达式
+// 开启严格模式后按注册模型校验: 表名须为已注册模型或白名单表, 别名须为合法标识符, 字段引用须为 别名.字段 且字段存在于模型或白名单表字段
+// 表达式仅允许 别名.字段、数字、比较/算术运算符、括号、白名单函数及and/or/in等少量关键字, 未限定别名的字段、其他SQL关键字、引号、注释、分号等直接拒绝
+// as后的输出别名须为非保留字标识符, Raw条件由调用方负责
+// 未开启严格模式时保持原有拼接行为, 可直接调用CheckComplexCnd/CheckSqlExpr/QuoteIdent自行校验
+
+type SqlGuardConfig struct {
+	Strict bool                // 是否开启严格模式
+	Tables map[string][]string // 非注册模型的白名单表及允许引用的字段
+	Funcs  []string            // 追加允许的函数名, 默认允许常用聚合/条件/时间函数
+}
+
+var (
+	sqlGuardMu     sync.RWMutex
+	sqlGuardStrict bool
+	sqlGuardTables = map[string]map[string]bool{}
+	sqlGuardFuncs  = guardFuncs(nil)
+	sqlGuardWords  = map[string]bool{
+		"and": true, "or": true, "not": true, "is": true, "null": true, "in": true, "between": true,
+		"as": true, "distinct": true, "case": true, "when": true, "then": true, "else": true, "end": true,
+	}
+	// 不可用作输出别名的保留字
+	sqlGuardReserved = map[string]bool{
+		"select": true, "from": true, "where": true, "union": true, "join": true, "on": true, "group": true, "order": true,
+		"by": true, "having": true, "limit": true, "offset": true, "into": true, "insert": true, "update": true, "delete": true,
+		"drop": true, "alter": true, "create": true, "exists": true, "like": true, "regexp": true, "sleep": true, "benchmark": true,
+	}
+	sqlGuardDefaultFuncs = []string{
+		"count", "sum", "avg", "max", "min", "ifnull", "coalesce", "if", "abs", "round", "floor", "ceil",
+		"greatest", "least", "length", "lower", "upper", "concat", "from_unixtime", "unix_timestamp", "date_format",
+	}
+)
+
+// SetSqlGuard 设置复杂查询安全校验, 重复设置时覆盖白名单表及追加函数
+func SetSqlGuard(config SqlGuardConfig) {
+	tables := make(map[string]map[string]bool, len(config.Tables))
+	for k, v := range config.Tables {
+		columns := make(map[string]bool, len(v))
+		for _, c := range v {
+			columns[c] = true
+		}
+		tables[k] = columns
+	}
+	funcs := guardFuncs(config.Funcs)
+	sqlGuardMu.Lock()
+	defer sqlGuardMu.Unlock()
+	sqlGuardStrict = config.Strict
+	sqlGuardTables = tables
+	sqlGuardFuncs = funcs
+}
+
+func guardFuncs(extra []string) map[string]bool {
+	funcs := make(map[string]bool, len(sqlGuardDefaultFuncs)+len(extra))
+	for _, v := range sqlGuardDefaultFuncs {
+		funcs[v] = true
+	}
+	for _, v := range extra {
+		funcs[strings.ToLower(v)] = true
+	}
+	return funcs
+}
+
+// 严格模式下校验复杂查询
+func guardComplexCnd(cnd *sqlc.Cnd) error {
+	sqlGuardMu.RLock()
+	strict := sqlGuardStrict
+	sqlGuardMu.RUnlock()
+	if !strict {
+		return nil
+	}
+	return CheckComplexCnd(cnd)
+}
+
+// CheckComplexCnd 校验复杂查询的from/join表、on条件、查询字段、条件字段、分组及排序字段
+func CheckComplexCnd(cnd *sqlc.Cnd) error {
+	if cnd == nil || cnd.FromCond == nil {
+		return utils.Error("sql guard from table is nil")
+	}
+	aliases := make(map[string]string, len(cnd.JoinCond)+1)
+	if err := addGuardTable(aliases, cnd.FromCond.Table, cnd.FromCond.Alias); err != nil {
+		return err
+	}
+	for _, v := range cnd.JoinCond {
+		if err := addGuardTable(aliases, v.Table, v.Alias); err != nil {
+			return err
+		}
+	}
+	for _, v := range cnd.JoinCond {
+		if err := CheckSqlExpr(v.On, aliases); err != nil {
+			return utils.Error("sql guard join on invalid: ", v.On, " ", err)
+		}
+	}
+	for _, v := range cnd.AnyFields {
+		if err := CheckSqlExpr(v, aliases); err != nil {
+			return utils.Error("sql guard field invalid: ", v, " ", err)
+		}
+	}
+	for _, v := range cnd.Groupbys {
+		if err := CheckSqlExpr(v, aliases); err != nil {
+			return utils.Error("sql guard group by invalid: ", v, " ", err)
+		}
+	}
+	for _, v := range cnd.Orderbys {
+		if err := CheckSqlExpr(v.Key, aliases); err != nil {
+			return utils.Error("sql guard order by invalid: ", v.Key, " ", err)
+		}
+	}
+	return checkGuardCondit(cnd.Conditions, aliases)
+}
+
+func checkGuardCondit(conditions []sqlc.Condition, aliases map[string]string) error {
+	for _, v := range conditions {
+		switch v.Logic {
+		case sqlc.RAW_:
+			continue
+		case sqlc.OR_, sqlc.AND_:
+			for _, sub := range v.Values {
+				if c, ok := sub.(*sqlc.Cnd); ok {
+					if err := checkGuardCondit(c.Conditions, aliases); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		if err := CheckSqlExpr(v.Key, aliases); err != nil {
+			return utils.Error("sql guard condition invalid: ", v.Key, " ", err)
+		}
+	}
+	return nil
+}
+
+func addGuardTable(aliases map[string]string, ref, alias string) error {
+	table, refAlias, err := ParseTableRef(ref)
+	if err != nil {
+		return err
+	}
+	if len(alias) > 0 {
+		if len(refAlias) > 0 || !isSqlIdent(alias) {
+			return utils.Error("sql guard table alias invalid: ", ref, " ", alias)
+		}
+		refAlias = alias
+	}
+	if _, ok := modelDrivers[table]; !ok {
+		sqlGuardMu.RLock()
+		_, allow := sqlGuardTables[table]
+		sqlGuardMu.RUnlock()
+		if !allow {
+			return utils.Error("sql guard table not registered: ", table)
+		}
+	}
+	if len(refAlias) == 0 {
+		refAlias = table
+	}
+	if _, ok := aliases[refAlias]; ok {
+		return utils.Error("sql guard table alias duplicate: ", refAlias)
+	}
+	aliases[refAlias] = table
+	return nil
+}
+
+// ParseTableRef 解析表引用, 支持 table / table alias / table as alias, 表名可使用反引号
+func ParseTableRef(ref string) (string, string, error) {
+	parts := strings.Fields(ref)
+	var table, alias string
+	switch {
+	case len(parts) == 1:
+		table = parts[0]
+	case len(parts) == 2:
+		table, alias = parts[0], parts[1]
+	case len(parts) == 3 && strings.EqualFold(parts[1], "as"):
+		table, alias = parts[0], parts[2]
+	default:
+		return "", "", utils.Error("sql guard table invalid: ", ref)
+	}
+	if len(table) > 2 && table[0] == '`' && table[len(table)-1] == '`' {
+		table = table[1 : len(table)-1]
+	}
+	if !isSqlIdent(table) || (len(alias) > 0 && checkGuardAlias(alias) != nil) {
+		return "", "", utils.Error("sql guard table invalid: ", ref)
+	}
+	return table, alias, nil
+}
+
+// QuoteIdent 校验标识符并添加反引号, 支持 table.column 形式
+func QuoteIdent(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", utils.Error("sql guard identifier invalid: ", name)
+	}
+	for i, v := range parts {
+		if !isSqlIdent(v) {
+			return "", utils.Error("sql guard identifier invalid: ", name)
+		}
+		parts[i] = utils.AddStr("`", v, "`")
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// CheckSqlExpr 校验SQL表达式, aliases为别名对应的表名, 字段引用须为 别名.字段 且存在于对应模型或白名单表字段
+func CheckSqlExpr(expr string, aliases map[string]string) error {
+	tokens, err := scanSqlExpr(expr)
+	if err != nil {
+		return err
+	}
+	depth := 0
+	for i, t := range tokens {
+		alias := i > 0 && strings.EqualFold(tokens[i-1], "as")
+		switch {
+		case t == "(":
+			depth++
+		case t == ")":
+			if depth--; depth < 0 {
+				return utils.Error("sql guard parentheses invalid")
+			}
+		case t[0] == '`':
+			if !alias {
+				return utils.Error("sql guard column must be qualified by table alias: ", t)
+			}
+			if err := checkGuardAlias(t[1 : len(t)-1]); err != nil {
+				return err
+			}
+		case isSqlIdentStart(t[0]):
+			if alias {
+				if err := checkGuardAlias(t); err != nil {
+					return err
+				}
+				continue
+			}
+			if dot := strings.IndexByte(t, '.'); dot > 0 {
+				if err := checkGuardColumn(t[:dot], t[dot+1:], aliases); err != nil {
+					return err
+				}
+				continue
+			}
+			word := strings.ToLower(t)
+			if sqlGuardWords[word] {
+				continue
+			}
+			if i+1 < len(tokens) && tokens[i+1] == "(" {
+				sqlGuardMu.RLock()
+				allow := sqlGuardFuncs[word]
+				sqlGuardMu.RUnlock()
+				if !allow {
+					return utils.Error("sql guard function not allowed: ", t)
+				}
+				continue
+			}
+			// 未限定别名的字段或其他SQL关键字
+			return utils.Error("sql guard column must be qualified by table alias: ", t)
+		}
+	}
+	if depth != 0 {
+		return utils.Error("sql guard parentheses invalid")
+	}
+	return nil
+}
+
+// 输出别名不能为关键字
+func checkGuardAlias(alias string) error {
+	word := strings.ToLower(alias)
+	if !isSqlIdent(alias) || sqlGuardWords[word] || sqlGuardReserved[word] {
+		return utils.Error("sql guard field alias invalid: ", alias)
+	}
+	return nil
+}
+
+// 校验字段引用, 别名须已声明且字段存在于对应表
+func checkGuardColumn(alias, column string, aliases map[string]string) error {
+	table, ok := aliases[alias]
+	if !ok {
+		return utils.Error("sql guard table alias not found: ", alias)
+	}
+	if column == "*" || hasGuardColumn(table, column) {
+		return nil
+	}
+	return utils.Error("sql guard column not found: ", alias, ".", column)
+}
+
+func hasGuardColumn(table, column string) bool {
+	obv, ok := modelDrivers[table]
+	if !ok { // 白名单表仅允许已声明字段
+		sqlGuardMu.RLock()
+		allow := sqlGuardTables[table][column]
+		sqlGuardMu.RUnlock()
+		return allow
+	}
+	for _, f := range obv.FieldElem {
+		if !f.Ignore && f.FieldJsonName == column {
+			return true
+		}
+	}
+	return false
+}
+
+// 拆分表达式, 标识符(含 a.b / a.*)、反引号标识符、数字、运算符及括号逗号, 其他字符返回错误
+func scanSqlExpr(expr string) ([]string, error) {
+	if len(strings.TrimSpace(expr)) == 0 {
+		return nil, utils.Error("sql guard expression is nil")
+	}
+	if strings.Contains(expr, "--") || strings.Contains(expr, "/*") || strings.Contains(expr, "*/") {
+		return nil, utils.Error("sql guard expression contains comment")
+	}
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+		case isSqlIdentStart(c):
+			for i < len(expr) && isSqlIdentChar(expr[i]) {
+				i++
+			}
+			if i+1 < len(expr) && expr[i] == '.' {
+				if expr[i+1] == '*' {
+					i += 2
+				} else if isSqlIdentStart(expr[i+1]) {
+					for i++; i < len(expr) && isSqlIdentChar(expr[i]); i++ {
+					}
+				}
+			}
+		case c == '`':
+			end := strings.IndexByte(expr[i+1:], '`')
+			if end <= 0 || !isSqlIdent(expr[i+1:i+1+end]) {
+				return nil, utils.Error("sql guard quoted identifier invalid")
+			}
+			i += end + 2
+		case c >= '0' && c <= '9':
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.') {
+				i++
+			}
+		case c == '<' || c == '>' || c == '!':
+			i++
+			if i < len(expr) && (expr[i] == '=' || c == '<' && expr[i] == '>') {
+				i++
+			} else if c == '!' {
+				return nil, utils.Error("sql guard operator invalid")
+			}
+		case strings.IndexByte("=+-*/(),", c) >= 0:
+			i++
+		default:
+			return nil, utils.Error("sql guard expression contains invalid char: ", string(c))
+		}
+		tokens = append(tokens, expr[start:i])
+	}
+	return tokens, nil
+}
+
+func isSqlIdent(s string) bool {
+	if len(s) == 0 || !isSqlIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isSqlIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSqlIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSqlIdentChar(c byte) bool {
+	return isSqlIdentStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,106 @@
+package sqld
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"sync"
+	"testing"
+)
+
+type guardUser struct {
+	Id       int64  `json:"id" bson:"_id"`
+	Username string `json:"username" bson:"username"`
+	Password string `json:"password" bson:"password"`
+	Status   int64  `json:"status" bson:"status"`
+}
+
+func (o *guardUser) GetTable() string {
+	return "guard_user"
+}
+
+func (o *guardUser) NewObject() sqlc.Object {
+	return &guardUser{}
+}
+
+func (o *guardUser) NewIndex() []sqlc.Index {
+	return nil
+}
+
+var guardModelOnce sync.Once
+
+func initGuardModel() {
+	guardModelOnce.Do(func() {
+		if err := ModelDriver(&guardUser{}); err != nil {
+			panic(err)
+		}
+	})
+}
+
+func TestCheckSqlExpr(t *testing.T) {
+	initGuardModel()
+	SetSqlGuard(SqlGuardConfig{Tables: map[string][]string{"guard_log": {"user_id", "ctime"}}})
+	defer SetSqlGuard(SqlGuardConfig{})
+	aliases := map[string]string{"a": "guard_user", "b": "guard_log"}
+	valid := []string{
+		"a.id",
+		"a.*",
+		"count(a.id) as total",
+		"count(*) as `total`",
+		"a.id = b.user_id and a.status in (1, 2)",
+		"ifnull(sum(a.status), 0) >= 10",
+		"case when a.status = 1 then a.id else 0 end",
+	}
+	for _, v := range valid {
+		if err := CheckSqlExpr(v, aliases); err != nil {
+			t.Errorf("expr [%s] should pass: %v", v, err)
+		}
+	}
+	invalid := []string{
+		"id",                                   // 未限定别名
+		"`id`",                                 // 反引号字段未限定别名
+		"a.id union select password from user", // 关键字及未限定字段
+		"a.id = b.user_id union select a.password", // union关键字
+		"a.id = b.password",                        // 白名单表未声明字段
+		"c.id",                                     // 别名未声明
+		"a.notExist",                               // 模型字段不存在
+		"a.id as select",                           // 保留字别名
+		"a.id = b.user_id or sleep(5)",             // 函数不在白名单
+		"a.id = 'x'",                               // 引号
+		"a.id; drop table guard_user",              // 分号
+		"a.id -- comment",                          // 注释
+		"(a.id",                                    // 括号不匹配
+	}
+	for _, v := range invalid {
+		if err := CheckSqlExpr(v, aliases); err == nil {
+			t.Errorf("expr [%s] should fail", v)
+		}
+	}
+}
+
+func TestCheckComplexCnd(t *testing.T) {
+	initGuardModel()
+	SetSqlGuard(SqlGuardConfig{Tables: map[string][]string{"guard_log": {"user_id", "ctime"}}})
+	defer SetSqlGuard(SqlGuardConfig{})
+	cnd := sqlc.M(&guardUser{}).Fields("a.id", "b.ctime").From("guard_user a").Join(sqlc.LEFT_, "guard_log b", "a.id = b.user_id").Eq("a.status", 1).Orderby("b.ctime", sqlc.DESC_)
+	if err := CheckComplexCnd(cnd); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []*sqlc.Cnd{
+		sqlc.M(&guardUser{}).Fields("a.id").From("guard_user a; drop table guard_user"),
+		sqlc.M(&guardUser{}).Fields("a.id").From("guard_unknown a"),
+		sqlc.M(&guardUser{}).Fields("a.id").From("guard_user a").Join(sqlc.LEFT_, "guard_log a", "a.id = a.user_id"),
+		sqlc.M(&guardUser{}).Fields("a.id").From("guard_user a").Eq("status", 1),
+		sqlc.M(&guardUser{}).Fields("a.id").From("guard_user a").Groupby("status"),
+		sqlc.M(&guardUser{}).Fields("a.id").From("guard_user a").Or(sqlc.M().Eq("password", "x")),
+	}
+	for i, v := range invalid {
+		if err := CheckComplexCnd(v); err == nil {
+			t.Errorf("cnd [%d] should fail", i)
+		}
+	}
+	if _, _, err := ParseTableRef("guard_user as select"); err == nil {
+		t.Error("table alias keyword should fail")
+	}
+	if v, err := QuoteIdent("a.id"); err != nil || v != "`a`.`id`" {
+		t.Errorf("quote ident invalid: %s %v", v, err)
+	}
+}
@@ -0,0 +1,8 @@
+// Package sqlite 注册sqlite数据库驱动(github.com/mattn/go-sqlite3, 依赖cgo)
+// 使用sqld.SqliteManager时导入: import _ "github.com/godaddy-x/freego/ormx/sqld/sqlite"
+// 驱动独立为子包, 未使用sqlite的服务可在CGO_ENABLED=0时构建
+package sqlite
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,174 @@
+package sqld
+
+import (
+	"database/sql"
+	"github.com/godaddy-x/freego/cache"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"reflect"
+	"time"
+)
+
+// sqlite驱动依赖cgo, 需导入 _ "github.com/godaddy-x/freego/ormx/sqld/sqlite" 注册驱动
+
+// sqlite配置参数
+type SqliteConfig struct {
+	Option
+	Path            string // 数据库文件路径, :memory:为内存数据库, 固定单连接且不回收, 连接关闭时数据丢失
+	BusyTimeout     int    // 数据库锁等待时间/毫秒, 默认5000
+	WAL             bool   // 是否开启WAL日志模式, 提升并发读性能
+	MaxOpenConns    int    // 最大连接数, 默认1避免写锁冲突
+	ConnMaxLifetime int    // 连接最大存活时间/秒, 内存数据库忽略
+}
+
+const sqliteMemory = ":memory:"
+
+// sqlite连接管理器, 复用RDBManager的sqlc.Cnd实现
+type SqliteManager struct {
+	RDBManager
+}
+
+func (self *SqliteManager) Get(option ...Option) (*SqliteManager, error) {
+	if err := self.GetDB(option...); err != nil {
+		return nil, err
+	}
+	return self, nil
+}
+
+func (self *SqliteManager) InitConfig(input ...SqliteConfig) error {
+	return self.buildByConfig(nil, input...)
+}
+
+func (self *SqliteManager) InitConfigAndCache(manager cache.Cache, input ...SqliteConfig) error {
+	return self.buildByConfig(manager, input...)
+}
+
+func (self *SqliteManager) buildByConfig(manager cache.Cache, input ...SqliteConfig) error {
+	for _, v := range input {
+		dsName := DIC.MASTER
+		if len(v.DsName) > 0 {
+			dsName = v.DsName
+		}
+		if _, b := rdbs[dsName]; b {
+			return utils.Error("sqlite init failed: [", v.DsName, "] exist")
+		}
+		if len(v.Path) == 0 {
+			return utils.Error("sqlite init failed: [", dsName, "] path is nil")
+		}
+		if v.BusyTimeout <= 0 {
+			v.BusyTimeout = 5000
+		}
+		if v.MaxOpenConns <= 0 {
+			v.MaxOpenConns = 1
+		}
+		if v.Path == sqliteMemory { // 每个连接为独立的内存数据库, 连接回收后数据丢失
+			v.MaxOpenConns, v.ConnMaxLifetime = 1, 0
+		}
+		link := utils.AddStr("file:", v.Path, "?_busy_timeout=", v.BusyTimeout, "&_foreign_keys=1")
+		if v.WAL {
+			link = utils.AddStr(link, "&_journal_mode=WAL")
+		}
+		if !sqliteRegistered() {
+			return utils.Error("sqlite init failed: driver not registered, import _ \"github.com/godaddy-x/freego/ormx/sqld/sqlite\"")
+		}
+		db, err := sql.Open(SQLITE, link)
+		if err != nil {
+			return utils.Error("sqlite init failed: ", err)
+		}
+		db.SetMaxOpenConns(v.MaxOpenConns)
+		db.SetMaxIdleConns(v.MaxOpenConns)
+		db.SetConnMaxLifetime(time.Second * time.Duration(v.ConnMaxLifetime))
+		rdb := &RDBManager{}
+		rdb.Db = db
+		rdb.Driver = SQLITE
+		rdb.DsName = dsName
+		rdb.Database = v.Path
+		rdb.CacheManager = manager
+		if v.OpenTx {
+			rdb.OpenTx = v.OpenTx
+		}
+		if v.MongoSync {
+			rdb.MongoSync = v.MongoSync
+		}
+		if v.Timeout > 0 {
+			rdb.Timeout = v.Timeout
+		}
+		rdb.SlowQuery = v.SlowQuery
+		rdb.SlowLogPath = v.SlowLogPath
+		rdb.initSlowLog()
+		rdbs[rdb.DsName] = rdb
+		zlog.Printf("sqlite service【%s】has been started successful", dsName)
+	}
+	if len(rdbs) == 0 {
+		return utils.Error("sqlite init failed: sessions is nil")
+	}
+	return nil
+}
+
+func sqliteRegistered() bool {
+	for _, v := range sql.Drivers() {
+		if v == SQLITE {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTable 按已注册模型创建不存在的数据表, 自增主键模型(auto:"true")使用INTEGER PRIMARY KEY AUTOINCREMENT
+func (self *SqliteManager) CreateTable(objects ...sqlc.Object) error {
+	for _, object := range objects {
+		obv, ok := modelDrivers[object.GetTable()]
+		if !ok {
+			return self.Error("[Sqlite.CreateTable] registration object type not found [", object.GetTable(), "]")
+		}
+		var fields string
+		for _, v := range obv.FieldElem {
+			if v.Ignore {
+				continue
+			}
+			if v.Primary && obv.AutoId && v.FieldKind == reflect.Int64 {
+				fields = utils.AddStr(fields, ",`", v.FieldJsonName, "` INTEGER PRIMARY KEY AUTOINCREMENT")
+				continue
+			}
+			fields = utils.AddStr(fields, ",`", v.FieldJsonName, "` ", sqliteType(v))
+			if v.Primary {
+				fields = utils.AddStr(fields, " NOT NULL PRIMARY KEY")
+			}
+		}
+		if len(fields) == 0 {
+			return self.Error("[Sqlite.CreateTable] table [", obv.TableName, "] fields is nil")
+		}
+		prepare := utils.AddStr("CREATE TABLE IF NOT EXISTS ", obv.TableName, " (", fields[1:], ")")
+		if _, err := self.Db.Exec(prepare); err != nil {
+			return self.Error("[Sqlite.CreateTable] [ ", prepare, " ] create failed: ", err)
+		}
+	}
+	return nil
+}
+
+// 字段类型映射sqlite存储类型, 日期字段使用DATETIME以便驱动解析为时间
+func sqliteType(field *FieldElem) string {
+	if len(field.FieldDBType) > 0 {
+		return field.FieldDBType
+	}
+	if field.IsDate {
+		return "DATETIME"
+	}
+	if field.IsBlob {
+		return "BLOB"
+	}
+	switch field.FieldKind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Bool:
+		return "INTEGER"
+	case reflect.Float32, reflect.Float64:
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+func NewSqlite(option ...Option) (*SqliteManager, error) {
+	return new(SqliteManager).Get(option...)
+}
@@ -0,0 +1,363 @@
+package sqltest
+
+import (
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/utils"
+	"path"
+	"sync"
+	"time"
+)
+
+// 内存缓存, 实现cache.Cache, 用于业务单元测试替代Redis
+// 与RedisManager一致按字节保存数据(非[]byte值使用utils.AnyToStr转换), Get传入input时按json解析
+// 支持过期时间、通配符Keys/Size/Values、Rpush/Brpop队列及进程内Publish/Subscribe, LuaScript返回错误
+// Now可替换为固定时钟以测试过期逻辑
+
+type FakeCache struct {
+	cache.CacheManager
+	Now   func() time.Time
+	mu    sync.Mutex
+	items map[string]fakeItem
+	lists map[string][][]byte
+	subs  map[string][]chan string
+}
+
+type fakeItem struct {
+	value  []byte
+	expire time.Time // 零值不过期
+}
+
+func NewFakeCache() *FakeCache {
+	return &FakeCache{
+		Now:   time.Now,
+		items: map[string]fakeItem{},
+		lists: map[string][][]byte{},
+		subs:  map[string][]chan string{},
+	}
+}
+
+func toBytes(input interface{}) []byte {
+	if v, b := input.([]byte); b {
+		return v
+	}
+	return utils.Str2Bytes(utils.AnyToStr(input))
+}
+
+// 读取未过期数据, 调用方需持有锁
+func (self *FakeCache) load(key string) ([]byte, bool) {
+	v, ok := self.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !v.expire.IsZero() && !self.Now().Before(v.expire) {
+		delete(self.items, key)
+		return nil, false
+	}
+	return v.value, true
+}
+
+func (self *FakeCache) store(key string, input interface{}, expire int) {
+	item := fakeItem{value: toBytes(input)}
+	if expire > 0 {
+		item.expire = self.Now().Add(time.Duration(expire) * time.Second)
+	}
+	self.items[key] = item
+}
+
+func (self *FakeCache) get(key string) []byte {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	v, _ := self.load(key)
+	return v
+}
+
+func (self *FakeCache) Get(key string, input interface{}) (interface{}, bool, error) {
+	value := self.get(key)
+	if len(value) == 0 {
+		return nil, false, nil
+	}
+	if input == nil {
+		return value, true, nil
+	}
+	return value, true, utils.JsonUnmarshal(value, input)
+}
+
+func (self *FakeCache) GetInt64(key string) (int64, error) {
+	value := self.get(key)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	return utils.StrToInt64(utils.Bytes2Str(value))
+}
+
+func (self *FakeCache) GetFloat64(key string) (float64, error) {
+	value := self.get(key)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	return utils.StrToFloat(utils.Bytes2Str(value))
+}
+
+func (self *FakeCache) GetString(key string) (string, error) {
+	return utils.Bytes2Str(self.get(key)), nil
+}
+
+func (self *FakeCache) GetBytes(key string) ([]byte, error) {
+	value := self.get(key)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (self *FakeCache) GetBool(key string) (bool, error) {
+	value := self.get(key)
+	if len(value) == 0 {
+		return false, nil
+	}
+	return utils.StrToBool(utils.Bytes2Str(value))
+}
+
+func (self *FakeCache) Put(key string, input interface{}, expire ...int) error {
+	if len(key) == 0 || input == nil {
+		return nil
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if len(expire) > 0 {
+		self.store(key, input, expire[0])
+	} else {
+		self.store(key, input, 0)
+	}
+	return nil
+}
+
+func (self *FakeCache) PutBatch(objs ...*cache.PutObj) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range objs {
+		if v == nil || len(v.Key) == 0 || v.Value == nil {
+			continue
+		}
+		self.store(v.Key, v.Value, v.Expire)
+	}
+	return nil
+}
+
+func (self *FakeCache) PutNX(key string, input interface{}, expire int) (bool, error) {
+	if len(key) == 0 || input == nil {
+		return false, nil
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.load(key); ok {
+		return false, nil
+	}
+	self.store(key, input, expire)
+	return true, nil
+}
+
+func (self *FakeCache) Del(key ...string) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range key {
+		delete(self.items, v)
+		delete(self.lists, v)
+	}
+	return nil
+}
+
+func (self *FakeCache) Exists(key string) (bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, ok := self.load(key); ok {
+		return true, nil
+	}
+	_, ok := self.lists[key]
+	return ok, nil
+}
+
+// 通配符规则同path.Match, 为空时匹配全部
+func (self *FakeCache) match(pattern []string) map[string][]byte {
+	result := map[string][]byte{}
+	for k := range self.items {
+		if len(pattern) > 0 && len(pattern[0]) > 0 {
+			if ok, _ := path.Match(pattern[0], k); !ok {
+				continue
+			}
+		}
+		if v, ok := self.load(k); ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func (self *FakeCache) Size(pattern ...string) (int, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return len(self.match(pattern)), nil
+}
+
+func (self *FakeCache) Keys(pattern ...string) ([]string, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	items := self.match(pattern)
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (self *FakeCache) Values(pattern ...string) ([]interface{}, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	items := self.match(pattern)
+	values := make([]interface{}, 0, len(items))
+	for _, v := range items {
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (self *FakeCache) Rpush(key string, val interface{}) error {
+	if val == nil || len(key) == 0 {
+		return nil
+	}
+	self.mu.Lock()
+	self.lists[key] = append(self.lists[key], toBytes(val))
+	self.mu.Unlock()
+	return nil
+}
+
+func (self *FakeCache) rpop(key string) ([]byte, bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	list := self.lists[key]
+	if len(list) == 0 {
+		return nil, false
+	}
+	v := list[len(list)-1]
+	if len(list) == 1 {
+		delete(self.lists, key)
+	} else {
+		self.lists[key] = list[:len(list)-1]
+	}
+	return v, true
+}
+
+// 与BRPOP一致从队尾取出, 等待expire秒无数据返回错误
+func (self *FakeCache) BrpopString(key string, expire int64) (string, error) {
+	if len(key) == 0 || expire <= 0 {
+		return "", nil
+	}
+	deadline := time.Now().Add(time.Duration(expire) * time.Second)
+	for {
+		if v, ok := self.rpop(key); ok {
+			return utils.Bytes2Str(v), nil
+		}
+		if !time.Now().Before(deadline) {
+			return "", utils.Error("brpop [", key, "] timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (self *FakeCache) Brpop(key string, expire int64, result interface{}) error {
+	ret, err := self.BrpopString(key, expire)
+	if err != nil || len(ret) == 0 {
+		return err
+	}
+	return utils.JsonUnmarshal(utils.Str2Bytes(ret), result)
+}
+
+func (self *FakeCache) BrpopInt64(key string, expire int64) (int64, error) {
+	ret, err := self.BrpopString(key, expire)
+	if err != nil || len(ret) == 0 {
+		return 0, err
+	}
+	return utils.StrToInt64(ret)
+}
+
+func (self *FakeCache) BrpopFloat64(key string, expire int64) (float64, error) {
+	ret, err := self.BrpopString(key, expire)
+	if err != nil || len(ret) == 0 {
+		return 0, err
+	}
+	return utils.StrToFloat(ret)
+}
+
+func (self *FakeCache) BrpopBool(key string, expire int64) (bool, error) {
+	ret, err := self.BrpopString(key, expire)
+	if err != nil || len(ret) == 0 {
+		return false, err
+	}
+	return utils.StrToBool(ret)
+}
+
+// 发送至当前订阅者, 无订阅者返回false
+func (self *FakeCache) Publish(key string, val interface{}, try ...int) (bool, error) {
+	if val == nil || len(key) == 0 {
+		return false, nil
+	}
+	msg := utils.AnyToStr(val)
+	self.mu.Lock()
+	subs := self.subs[key]
+	self.mu.Unlock()
+	sent := false
+	for _, c := range subs {
+		select {
+		case c <- msg:
+			sent = true
+		default:
+		}
+	}
+	return sent, nil
+}
+
+// 与RedisManager一致, call返回true时结束订阅, 超过timeout秒无消息返回错误
+func (self *FakeCache) Subscribe(key string, timeout int, call func(msg string) (bool, error)) error {
+	if call == nil || len(key) == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 5
+	}
+	c := make(chan string, 64)
+	self.mu.Lock()
+	self.subs[key] = append(self.subs[key], c)
+	self.mu.Unlock()
+	defer func() {
+		self.mu.Lock()
+		subs := self.subs[key]
+		for i, v := range subs {
+			if v == c {
+				self.subs[key] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(self.subs[key]) == 0 {
+			delete(self.subs, key)
+		}
+		self.mu.Unlock()
+	}()
+	for {
+		select {
+		case msg := <-c:
+			if r, err := call(msg); err == nil && r {
+				return nil
+			}
+		case <-time.After(time.Duration(timeout) * time.Second):
+			return utils.Error("subscribe [", key, "] timeout")
+		}
+	}
+}
+
+func (self *FakeCache) Flush() error {
+	self.mu.Lock()
+	self.items = map[string]fakeItem{}
+	self.lists = map[string][][]byte{}
+	self.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,358 @@
+package sqltest
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/utils"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 内存条件匹配, 比较规则: 数值按大小(数字字符串可与数值比较), 字符串按字典序, Like与MySQL一致按%/_通配不区分大小写匹配, \转义通配符
+
+type model struct {
+	pk     *sqld.FieldElem
+	idgen  string
+	fields map[string]*sqld.FieldElem // json/bson/字段名 -> 字段
+}
+
+func getModel(object sqlc.Object) (*model, error) {
+	if object == nil {
+		return nil, utils.Error("model is nil")
+	}
+	elems := sqld.GetModelFields(object.GetTable())
+	if len(elems) == 0 {
+		return nil, utils.Error("model [", object.GetTable(), "] not registered")
+	}
+	m := &model{fields: make(map[string]*sqld.FieldElem, len(elems)*3)}
+	for _, v := range elems {
+		if v.Ignore {
+			continue
+		}
+		if v.Primary {
+			m.pk = v
+		}
+		for _, k := range []string{v.FieldName, v.FieldJsonName, v.FieldBsonName} {
+			if len(k) > 0 {
+				m.fields[k] = v
+			}
+		}
+	}
+	if m.pk == nil {
+		return nil, utils.Error("model [", object.GetTable(), "] primary key not found")
+	}
+	if f, ok := reflect.TypeOf(object).Elem().FieldByName(m.pk.FieldName); ok {
+		m.idgen = f.Tag.Get(sqlc.IdGen)
+	}
+	return m, nil
+}
+
+// 与sqld一致, 字符串主键按idgen标签使用ULID/UUIDv7, 默认雪花ID
+func (self *model) nextStringId() string {
+	switch self.idgen {
+	case sqlc.ULID:
+		return utils.NextULID()
+	case sqlc.UUIDv7:
+		return utils.NextUUIDv7()
+	}
+	return utils.NextSID()
+}
+
+// 转换为主键类型, 用于map查找
+func (self *model) pkKey(v interface{}) (interface{}, error) {
+	switch self.pk.FieldKind {
+	case reflect.Int64:
+		if n, ok := toNumber(v); ok {
+			if i, acc := n.Int64(); acc == big.Exact {
+				return i, nil
+			}
+		}
+		return nil, utils.Error("id [", v, "] invalid")
+	case reflect.String:
+		return utils.AnyToStr(v), nil
+	}
+	return v, nil
+}
+
+func (self *model) field(key string) (*sqld.FieldElem, error) {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 { // 去除别名前缀, 如a.id
+		key = key[i+1:]
+	}
+	f, ok := self.fields[key]
+	if !ok {
+		return nil, utils.Error("field [", key, "] not found")
+	}
+	return f, nil
+}
+
+func (self *model) value(row reflect.Value, key string) (interface{}, error) {
+	f, err := self.field(key)
+	if err != nil {
+		return nil, err
+	}
+	return row.Elem().FieldByName(f.FieldName).Interface(), nil
+}
+
+func (self *model) setValue(row reflect.Value, key string, value interface{}) error {
+	switch value.(type) {
+	case sqlc.Expr, *sqlc.Expr:
+		return utils.Error("field [", key, "] upset expr unsupported")
+	}
+	f, err := self.field(key)
+	if err != nil {
+		return err
+	}
+	if f.Primary {
+		return utils.Error("field [", key, "] primary key can't be updated")
+	}
+	target := row.Elem().FieldByName(f.FieldName)
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(target.Type()) {
+		target.Set(v)
+		return nil
+	}
+	if isNumberKind(v.Kind()) && isNumberKind(target.Kind()) {
+		target.Set(v.Convert(target.Type()))
+		return nil
+	}
+	return utils.Error("field [", key, "] value type ", v.Type(), " mismatch ", target.Type())
+}
+
+func (self *model) match(row reflect.Value, conditions []sqlc.Condition) (bool, error) {
+	for _, v := range conditions {
+		var b bool
+		var err error
+		switch v.Logic {
+		case sqlc.OR_, sqlc.AND_:
+			b, err = self.matchGroup(row, v)
+		case sqlc.RAW_:
+			return false, utils.Error("raw condition unsupported")
+		default:
+			var value interface{}
+			if value, err = self.value(row, v.Key); err == nil {
+				b, err = matchCondition(value, v)
+			}
+		}
+		if err != nil || !b {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// 条件组, 与SQL一致忽略空条件, 全部为空时视为匹配
+func (self *model) matchGroup(row reflect.Value, condit sqlc.Condition) (bool, error) {
+	matched, empty := condit.Logic == sqlc.AND_, true
+	for _, v := range condit.Values {
+		sub, ok := v.(*sqlc.Cnd)
+		if !ok || len(sub.Conditions) == 0 {
+			continue
+		}
+		empty = false
+		b, err := self.match(row, sub.Conditions)
+		if err != nil {
+			return false, err
+		}
+		if condit.Logic == sqlc.OR_ && b {
+			return true, nil
+		}
+		if condit.Logic == sqlc.AND_ && !b {
+			return false, nil
+		}
+	}
+	return matched || empty, nil
+}
+
+func matchCondition(value interface{}, condit sqlc.Condition) (bool, error) {
+	switch condit.Logic {
+	case sqlc.EQ_, sqlc.NOT_EQ_:
+		c, ok := compare(value, condit.Value)
+		return ok && (c == 0) == (condit.Logic == sqlc.EQ_), nil
+	case sqlc.LT_, sqlc.LTE_, sqlc.GT_, sqlc.GTE_:
+		c, ok := compare(value, condit.Value)
+		if !ok {
+			return false, nil
+		}
+		switch condit.Logic {
+		case sqlc.LT_:
+			return c < 0, nil
+		case sqlc.LTE_:
+			return c <= 0, nil
+		case sqlc.GT_:
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case sqlc.IS_NULL_, sqlc.IS_NOT_NULL_:
+		return isNull(value) == (condit.Logic == sqlc.IS_NULL_), nil
+	case sqlc.BETWEEN_, sqlc.BETWEEN2_, sqlc.NOT_BETWEEN_:
+		if len(condit.Values) != 2 {
+			return false, utils.Error("field [", condit.Key, "] between values invalid")
+		}
+		c1, ok1 := compare(value, condit.Values[0])
+		c2, ok2 := compare(value, condit.Values[1])
+		if !ok1 || !ok2 {
+			return false, nil
+		}
+		if condit.Logic == sqlc.BETWEEN2_ {
+			return c1 >= 0 && c2 < 0, nil
+		}
+		return (c1 >= 0 && c2 <= 0) == (condit.Logic == sqlc.BETWEEN_), nil
+	case sqlc.IN_, sqlc.NOT_IN_:
+		for _, v := range flatten(condit.Values) {
+			if c, ok := compare(value, v); ok && c == 0 {
+				return condit.Logic == sqlc.IN_, nil
+			}
+		}
+		return condit.Logic == sqlc.NOT_IN_, nil
+	case sqlc.LIKE_, sqlc.NOT_LIKE_:
+		if value == nil || condit.Value == nil {
+			return false, nil
+		}
+		b, err := likeMatch(utils.AnyToStr(value), utils.AnyToStr(condit.Value))
+		if err != nil {
+			return false, utils.Error("field [", condit.Key, "] like pattern invalid: ", err)
+		}
+		return b == (condit.Logic == sqlc.LIKE_), nil
+	}
+	return false, utils.Error("field [", condit.Key, "] logic [", condit.Logic, "] unsupported")
+}
+
+// LIKE模式转换为正则, %匹配任意字符串, _匹配单个字符, \后字符按原义匹配
+func likeMatch(s, pattern string) (bool, error) {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	escape := false
+	for _, r := range pattern {
+		switch {
+		case escape:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escape = false
+		case r == '\\':
+			escape = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escape { // 末尾转义符按原义匹配
+		b.WriteString(regexp.QuoteMeta("\\"))
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// In参数为单个切片时展开
+func flatten(values []interface{}) []interface{} {
+	if len(values) != 1 || values[0] == nil {
+		return values
+	}
+	v := reflect.ValueOf(values[0])
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+	result := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		result = append(result, v.Index(i).Interface())
+	}
+	return result
+}
+
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return (k >= reflect.Int && k <= reflect.Float64) && k != reflect.Uintptr
+}
+
+func toNumber(value interface{}) (*big.Float, bool) {
+	if value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return new(big.Float).SetInt64(v.Int()), true
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		return new(big.Float).SetUint64(v.Uint()), true
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return big.NewFloat(v.Float()), true
+	case v.Kind() == reflect.String:
+		f, _, err := big.ParseFloat(strings.TrimSpace(v.String()), 10, 128, big.ToNearestEven)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// 比较a和b, 返回-1/0/1, 类型不可比较时返回false
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	if v := reflect.ValueOf(a); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		a = v.Elem().Interface()
+	}
+	if v := reflect.ValueOf(b); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		b = v.Elem().Interface()
+	}
+	if t1, ok := a.(time.Time); ok {
+		if t2, ok := b.(time.Time); ok {
+			if t1.Before(t2) {
+				return -1, true
+			} else if t1.After(t2) {
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	if s1, ok := a.(string); ok {
+		if s2, ok := b.(string); ok {
+			return strings.Compare(s1, s2), true
+		}
+	}
+	if b1, ok := a.(bool); ok {
+		b2, ok := b.(bool)
+		if !ok || b1 == b2 {
+			return 0, ok
+		}
+		if b2 {
+			return -1, true
+		}
+		return 1, true
+	}
+	n1, ok1 := toNumber(a)
+	n2, ok2 := toNumber(b)
+	if ok1 && ok2 {
+		return n1.Cmp(n2), true
+	}
+	return 0, false
+}
@@ -0,0 +1,417 @@
+package sqltest
+
+import (
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/utils"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// 内存数据库, 实现sqld.IDBase, 用于业务单元测试替代MySQL/Mongo
+// 模型须先通过sqld.ModelDriver注册, 数据按表名及主键保存对象浅拷贝, 查询返回拷贝, 修改查询结果不影响已保存数据
+// 条件字段可使用json/bson标签名或结构体字段名, 支持Eq/NotEq/Lt/Lte/Gt/Gte/IsNull/IsNotNull/Between/InDate/NotBetween/In/NotIn/Like/NotLike/Or/And
+// 支持排序、Limit/Offset分页及ResultSize, Raw/Join/聚合/UpsetExpr/FastPage/After等条件返回错误; 不执行模型钩子、软删除、字段加密及自动时间
+
+type MemDB struct {
+	sqld.DBManager
+	mu     sync.RWMutex
+	tables map[string]*memTable
+}
+
+type memTable struct {
+	rows  map[interface{}]reflect.Value // 主键 -> 对象拷贝(指针)
+	order []interface{}                 // 写入顺序, 未指定排序时按写入顺序返回
+}
+
+// NewMemDB 创建内存数据库, 多个测试间请使用独立实例
+func NewMemDB(option ...sqld.Option) *MemDB {
+	db := &MemDB{tables: map[string]*memTable{}}
+	if len(option) > 0 {
+		db.Option = option[0]
+	}
+	return db
+}
+
+// Reset 清空全部数据
+func (self *MemDB) Reset() {
+	self.mu.Lock()
+	self.tables = map[string]*memTable{}
+	self.mu.Unlock()
+}
+
+func (self *MemDB) InitConfig(input interface{}) error {
+	return nil
+}
+
+func (self *MemDB) GetDB(option ...sqld.Option) error {
+	if len(option) > 0 {
+		self.Option = option[0]
+	}
+	return nil
+}
+
+func (self *MemDB) table(name string) *memTable {
+	t, ok := self.tables[name]
+	if !ok {
+		t = &memTable{rows: map[interface{}]reflect.Value{}}
+		self.tables[name] = t
+	}
+	return t
+}
+
+func (self *memTable) remove(pk interface{}) {
+	delete(self.rows, pk)
+	for i, v := range self.order {
+		if v == pk {
+			self.order = append(self.order[:i], self.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (self *memTable) list() []reflect.Value {
+	result := make([]reflect.Value, 0, len(self.order))
+	for _, v := range self.order {
+		result = append(result, self.rows[v])
+	}
+	return result
+}
+
+// 对象浅拷贝
+func clone(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type().Elem())
+	c.Elem().Set(v.Elem())
+	return c
+}
+
+func (self *MemDB) Save(datas ...sqlc.Object) error {
+	if len(datas) == 0 {
+		return self.Error("[MemDB.Save] data is nil")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range datas {
+		m, err := getModel(v)
+		if err != nil {
+			return self.Error("[MemDB.Save] ", err)
+		}
+		rv := reflect.ValueOf(v)
+		pk := rv.Elem().FieldByName(m.pk.FieldName)
+		if pk.IsZero() { // 与MySQL一致, 主键为空时生成ID并回写对象
+			switch pk.Kind() {
+			case reflect.Int64:
+				pk.SetInt(utils.NextIID())
+			case reflect.String:
+				pk.SetString(m.nextStringId())
+			default:
+				return self.Error("[MemDB.Save] only Int64 and string type IDs are supported")
+			}
+		}
+		t := self.table(v.GetTable())
+		key := pk.Interface()
+		if _, ok := t.rows[key]; ok {
+			return self.Error("[MemDB.Save] duplicate entry [", key, "] for table [", v.GetTable(), "]")
+		}
+		t.rows[key] = clone(rv)
+		t.order = append(t.order, key)
+	}
+	return nil
+}
+
+func (self *MemDB) Update(datas ...sqlc.Object) error {
+	if len(datas) == 0 {
+		return self.Error("[MemDB.Update] data is nil")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range datas {
+		m, err := getModel(v)
+		if err != nil {
+			return self.Error("[MemDB.Update] ", err)
+		}
+		rv := reflect.ValueOf(v)
+		pk := rv.Elem().FieldByName(m.pk.FieldName)
+		if pk.IsZero() {
+			return self.Error("[MemDB.Update] data object id is nil")
+		}
+		t := self.table(v.GetTable())
+		if _, ok := t.rows[pk.Interface()]; ok {
+			t.rows[pk.Interface()] = clone(rv)
+		}
+	}
+	return nil
+}
+
+func (self *MemDB) UpdateByCnd(cnd *sqlc.Cnd) (int64, error) {
+	if cnd.Model == nil {
+		return 0, self.Error("[MemDB.UpdateByCnd] model is nil")
+	}
+	if len(cnd.Upsets) == 0 {
+		return 0, self.Error("[MemDB.UpdateByCnd] upset fields is nil")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	m, rows, err := self.filter(cnd)
+	if err != nil {
+		return 0, self.Error("[MemDB.UpdateByCnd] ", err)
+	}
+	for _, row := range rows {
+		for k, v := range cnd.Upsets {
+			if err := m.setValue(row, k, v); err != nil {
+				return 0, self.Error("[MemDB.UpdateByCnd] ", err)
+			}
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+func (self *MemDB) Delete(datas ...sqlc.Object) error {
+	if len(datas) == 0 {
+		return self.Error("[MemDB.Delete] data is nil")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, v := range datas {
+		m, err := getModel(v)
+		if err != nil {
+			return self.Error("[MemDB.Delete] ", err)
+		}
+		self.table(v.GetTable()).remove(reflect.ValueOf(v).Elem().FieldByName(m.pk.FieldName).Interface())
+	}
+	return nil
+}
+
+func (self *MemDB) DeleteById(object sqlc.Object, data ...interface{}) (int64, error) {
+	if object == nil || len(data) == 0 {
+		return 0, self.Error("[MemDB.DeleteById] data is nil")
+	}
+	m, err := getModel(object)
+	if err != nil {
+		return 0, self.Error("[MemDB.DeleteById] ", err)
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	t := self.table(object.GetTable())
+	var count int64
+	for _, v := range flatten(data) {
+		key, err := m.pkKey(v)
+		if err != nil {
+			return count, self.Error("[MemDB.DeleteById] ", err)
+		}
+		if _, ok := t.rows[key]; ok {
+			t.remove(key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (self *MemDB) DeleteByCnd(cnd *sqlc.Cnd) (int64, error) {
+	if cnd.Model == nil {
+		return 0, self.Error("[MemDB.DeleteByCnd] model is nil")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	m, rows, err := self.filter(cnd)
+	if err != nil {
+		return 0, self.Error("[MemDB.DeleteByCnd] ", err)
+	}
+	t := self.table(cnd.Model.GetTable())
+	for _, row := range rows {
+		t.remove(row.Elem().FieldByName(m.pk.FieldName).Interface())
+	}
+	return int64(len(rows)), nil
+}
+
+func (self *MemDB) Count(cnd *sqlc.Cnd) (int64, error) {
+	if cnd.Model == nil {
+		return 0, self.Error("[MemDB.Count] model is nil")
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	_, rows, err := self.filter(cnd)
+	if err != nil {
+		return 0, self.Error("[MemDB.Count] ", err)
+	}
+	return int64(len(rows)), nil
+}
+
+func (self *MemDB) Exists(cnd *sqlc.Cnd) (bool, error) {
+	count, err := self.Count(cnd)
+	return count > 0, err
+}
+
+func (self *MemDB) FindById(data sqlc.Object) error {
+	if data == nil {
+		return self.Error("[MemDB.FindById] data is nil")
+	}
+	m, err := getModel(data)
+	if err != nil {
+		return self.Error("[MemDB.FindById] ", err)
+	}
+	pk := reflect.ValueOf(data).Elem().FieldByName(m.pk.FieldName)
+	if pk.IsZero() {
+		return self.Error("[MemDB.FindById] data object id is nil")
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	row, ok := self.table(data.GetTable()).rows[pk.Interface()]
+	if !ok {
+		return self.notFound()
+	}
+	reflect.ValueOf(data).Elem().Set(row.Elem())
+	return nil
+}
+
+func (self *MemDB) FindOne(cnd *sqlc.Cnd, data sqlc.Object) error {
+	if data == nil {
+		return self.Error("[MemDB.FindOne] data is nil")
+	}
+	if cnd.Model == nil {
+		cnd.Model = data
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	m, rows, err := self.filter(cnd)
+	if err != nil {
+		return self.Error("[MemDB.FindOne] ", err)
+	}
+	if len(rows) == 0 {
+		return self.notFound()
+	}
+	m.sort(rows, cnd.Orderbys)
+	reflect.ValueOf(data).Elem().Set(rows[0].Elem())
+	return nil
+}
+
+func (self *MemDB) FindList(cnd *sqlc.Cnd, data interface{}) error {
+	if data == nil {
+		return self.Error("[MemDB.FindList] data is nil")
+	}
+	if cnd.Model == nil {
+		return self.Error("[MemDB.FindList] model is nil")
+	}
+	if cnd.Pagination.IsFastPage || cnd.Pagination.IsKeyset {
+		return self.Error("[MemDB.FindList] fast/keyset pagination unsupported")
+	}
+	out := reflect.ValueOf(data)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return self.Error("[MemDB.FindList] data must be slice pointer")
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	m, rows, err := self.filter(cnd)
+	if err != nil {
+		return self.Error("[MemDB.FindList] ", err)
+	}
+	m.sort(rows, cnd.Orderbys)
+	if page := &cnd.Pagination; page.IsPage && page.PageSize > 0 {
+		total := int64(len(rows))
+		page.PageTotal = total
+		page.PageCount = total / page.PageSize
+		if total%page.PageSize != 0 {
+			page.PageCount++
+		}
+		start := page.PageNo
+		if !page.IsOffset {
+			start = (page.PageNo - 1) * page.PageSize
+		}
+		if start > total {
+			start = total
+		}
+		end := start + page.PageSize
+		if end > total {
+			end = total
+		}
+		rows = rows[start:end]
+	}
+	if cnd.LimitSize > 0 && int64(len(rows)) > cnd.LimitSize {
+		rows = rows[:cnd.LimitSize]
+	}
+	slice := out.Elem()
+	elemPtr := slice.Type().Elem().Kind() == reflect.Ptr
+	for _, row := range rows {
+		c := clone(row)
+		if elemPtr {
+			slice = reflect.Append(slice, c)
+		} else {
+			slice = reflect.Append(slice, c.Elem())
+		}
+	}
+	out.Elem().Set(slice)
+	return nil
+}
+
+func (self *MemDB) FindOneComplex(cnd *sqlc.Cnd, data sqlc.Object) error {
+	if len(cnd.JoinCond) > 0 {
+		return self.Error("[MemDB.FindOneComplex] join unsupported")
+	}
+	return self.FindOne(cnd, data)
+}
+
+func (self *MemDB) FindListComplex(cnd *sqlc.Cnd, data interface{}) error {
+	if len(cnd.JoinCond) > 0 {
+		return self.Error("[MemDB.FindListComplex] join unsupported")
+	}
+	return self.FindList(cnd, data)
+}
+
+func (self *MemDB) notFound() error {
+	if self.NotFound {
+		self.Errors = append(self.Errors, sqld.ErrNotFound)
+		return sqld.ErrNotFound
+	}
+	return nil
+}
+
+// 按条件筛选数据, 返回已保存对象, 调用方需持有锁
+func (self *MemDB) filter(cnd *sqlc.Cnd) (*model, []reflect.Value, error) {
+	m, err := getModel(cnd.Model)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cnd.ConditPart) > 0 || len(cnd.Aggregates) > 0 || len(cnd.Groupbys) > 0 {
+		return nil, nil, utils.Error("raw/aggregate/group condition unsupported")
+	}
+	t, ok := self.tables[cnd.Model.GetTable()]
+	if !ok {
+		return m, nil, nil
+	}
+	var result []reflect.Value
+	for _, row := range t.list() {
+		b, err := m.match(row, cnd.Conditions)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b {
+			result = append(result, row)
+		}
+	}
+	return m, result, nil
+}
+
+func (self *model) sort(rows []reflect.Value, orderbys []sqlc.Condition) {
+	if len(orderbys) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, v := range orderbys {
+			a, err1 := self.value(rows[i], v.Key)
+			b, err2 := self.value(rows[j], v.Key)
+			if err1 != nil || err2 != nil {
+				return false
+			}
+			c, ok := compare(a, b)
+			if !ok || c == 0 {
+				continue
+			}
+			if v.Value == sqlc.DESC_ {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
@@ -0,0 +1,101 @@
+package sqld
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/otelx"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var sqlTable = regexp.MustCompile("(?i)\\b(?:from|into|update)\\s+[`\"]?(\\w+)")
+
+// 数据库操作上级上下文, 未设置时使用context.Background()
+func (self *DBManager) baseContext() context.Context {
+	if self.Context == nil {
+		return context.Background()
+	}
+	return self.Context
+}
+
+// 数据库类型, 未设置时为MYSQL
+func (self *RDBManager) driverName() string {
+	if len(self.Driver) == 0 {
+		return MYSQL
+	}
+	return self.Driver
+}
+
+// 记录SQL执行耗时指标, 表名从语句中解析, 解析失败时为unknown
+func (self *RDBManager) observeQuery(title, prepare string, start time.Time, err error) {
+	table := "unknown"
+	if match := sqlTable.FindStringSubmatch(prepare); len(match) > 1 {
+		table = match[1]
+	}
+	operation := strings.TrimSuffix(strings.TrimPrefix(title, "[Mysql."), "]")
+	promx.ObserveDB(self.driverName(), table, operation, time.Since(start), err)
+}
+
+// 补录SQL执行span, 语句已脱敏常量值
+func (self *RDBManager) traceQuery(title, prepare string, start time.Time, err error) {
+	if !otelx.Enabled() {
+		return
+	}
+	_, span := otelx.StartAt(self.baseContext(), strings.Trim(title, "[]"), trace.SpanKindClient, start,
+		attribute.String("db.system", self.driverName()),
+		attribute.String("db.name", self.Database),
+		attribute.String("db.statement", otelx.SanitizeSQL(prepare)),
+	)
+	otelx.End(span, err)
+}
+
+// mongo命令执行中记录
+type mongoCommand struct {
+	span       trace.Span
+	collection string
+}
+
+// mongo命令监听, 记录耗时指标并创建span, 仅记录命令名及集合, 不记录查询参数
+func newMongoMonitor() *event.CommandMonitor {
+	var commands sync.Map // RequestID -> *mongoCommand
+	finish := func(evt event.CommandFinishedEvent, err error) {
+		v, ok := commands.LoadAndDelete(evt.RequestID)
+		if !ok {
+			return
+		}
+		command := v.(*mongoCommand)
+		promx.ObserveDB("mongodb", command.collection, evt.CommandName, time.Duration(evt.DurationNanos), err)
+		if command.span != nil {
+			otelx.End(command.span, err)
+		}
+	}
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			command := &mongoCommand{}
+			if collection, ok := evt.Command.Lookup(evt.CommandName).StringValueOK(); ok {
+				command.collection = collection
+			}
+			if otelx.Enabled() {
+				_, command.span = otelx.Start(ctx, utils.AddStr("Mongo.", evt.CommandName), trace.SpanKindClient,
+					attribute.String("db.system", "mongodb"),
+					attribute.String("db.name", evt.DatabaseName),
+					attribute.String("db.operation", evt.CommandName),
+					attribute.String("db.mongodb.collection", command.collection),
+				)
+			}
+			commands.Store(evt.RequestID, command)
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			finish(evt.CommandFinishedEvent, nil)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			finish(evt.CommandFinishedEvent, utils.Error(evt.Failure))
+		},
+	}
+}
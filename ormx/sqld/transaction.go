@@ -0,0 +1,139 @@
+package sqld
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"time"
+)
+
+// 关系数据库事务, fn返回nil时提交, 返回错误或panic时回滚
+// 嵌套调用(db.Transaction或ctx已携带事务)时使用SAVEPOINT, 内层失败仅回滚到保存点
+
+type rdbTxContextKey struct{}
+
+// UseMysqlTransaction 在新事务中执行fn
+func UseMysqlTransaction(fn func(db *RDBManager) error, option ...Option) error {
+	return UseMysqlTransactionContext(context.Background(), func(ctx context.Context, db *RDBManager) error {
+		return fn(db)
+	}, option...)
+}
+
+// UseMysqlTransactionContext 在事务中执行fn, ctx已携带事务时作为嵌套事务执行, ctx取消时事务自动回滚
+func UseMysqlTransactionContext(ctx context.Context, fn func(ctx context.Context, db *RDBManager) error, option ...Option) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if db := GetMysqlTransaction(ctx); db != nil {
+		return db.Transaction(func(db *RDBManager) error {
+			return fn(ctx, db)
+		})
+	}
+	var opt Option
+	if len(option) > 0 {
+		opt = option[0]
+	}
+	opt.OpenTx = false
+	if opt.Context == nil {
+		opt.Context = ctx
+	}
+	db := &RDBManager{}
+	if err := db.GetDB(opt); err != nil {
+		return err
+	}
+	tx, err := db.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return db.Error("[Mysql.Transaction] begin failed: ", err)
+	}
+	db.Tx = tx
+	db.OpenTx = true
+	return db.finishTx(func() error {
+		return fn(context.WithValue(ctx, rdbTxContextKey{}, db), db)
+	})
+}
+
+// GetMysqlTransaction 获取上下文中的事务管理器, 不存在返回nil
+func GetMysqlTransaction(ctx context.Context) *RDBManager {
+	if ctx == nil {
+		return nil
+	}
+	db, _ := ctx.Value(rdbTxContextKey{}).(*RDBManager)
+	return db
+}
+
+// 执行fn并提交或回滚, 提交后执行缓存失效及MongoSync
+func (self *RDBManager) finishTx(fn func() error) error {
+	defer func() {
+		if r := recover(); r != nil {
+			self.Errors = append(self.Errors, utils.Error("[Mysql.Transaction] panic: ", r))
+			self.Close()
+			panic(r)
+		}
+	}()
+	if err := fn(); err != nil {
+		if len(self.Errors) == 0 {
+			self.Errors = append(self.Errors, err)
+		}
+		self.Close()
+		return err
+	}
+	self.Errors = nil // fn已处理的错误不影响提交
+	if err := self.writeMongoOutbox(); err != nil {
+		self.Errors = append(self.Errors, err)
+		self.Close()
+		return err
+	}
+	tx := self.Tx
+	self.Tx = nil
+	if err := tx.Commit(); err != nil {
+		return utils.Error("[Mysql.Transaction] commit failed: ", err)
+	}
+	return self.Close()
+}
+
+// Transaction 在当前事务中以SAVEPOINT执行fn, fn返回错误时回滚到保存点并返回该错误, 外层事务可继续
+// 当前未开启事务时在新事务中执行
+func (self *RDBManager) Transaction(fn func(db *RDBManager) error) error {
+	if !self.OpenTx || self.Tx == nil {
+		return UseMysqlTransaction(fn, self.Option)
+	}
+	self.savepoint++
+	name := utils.AddStr("sp_", self.savepoint)
+	if err := self.execTx("SAVEPOINT ", name); err != nil {
+		return self.Error("[Mysql.Transaction] savepoint failed: ", err)
+	}
+	errSize, cacheSize, syncSize, auditSize, eventSize := len(self.Errors), len(self.cacheTables), len(self.MGOSyncData), len(self.auditEntries), len(self.transitions)
+	rollback := func() error {
+		if err := self.execTx("ROLLBACK TO SAVEPOINT ", name); err != nil {
+			return err
+		}
+		self.Errors = self.Errors[:errSize]
+		self.cacheTables = self.cacheTables[:cacheSize]
+		self.MGOSyncData = self.MGOSyncData[:syncSize]
+		self.auditEntries = self.auditEntries[:auditSize]
+		self.transitions = self.transitions[:eventSize]
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+	}()
+	if err := fn(self); err != nil {
+		if rerr := rollback(); rerr != nil {
+			return self.Error("[Mysql.Transaction] rollback to savepoint failed: ", rerr)
+		}
+		return err
+	}
+	if err := self.execTx("RELEASE SAVEPOINT ", name); err != nil {
+		return self.Error("[Mysql.Transaction] release savepoint failed: ", err)
+	}
+	return nil
+}
+
+func (self *RDBManager) execTx(command, name string) error {
+	ctx, cancel := context.WithTimeout(self.baseContext(), time.Duration(self.Timeout)*time.Millisecond)
+	defer cancel()
+	_, err := self.Tx.ExecContext(ctx, utils.AddStr(command, name))
+	return err
+}
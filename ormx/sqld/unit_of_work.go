@@ -0,0 +1,279 @@
+package sqld
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/ormx/sqlc"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+)
+
+// UnitOfWork 请求级工作单元, 写操作先登记, Commit时在同一关系数据库事务(及mongo事务)中执行
+// 提交成功后依次清除缓存、执行AfterCommit回调(如发送outbox消息), 未Commit的操作不会执行
+type UnitOfWork struct {
+	mu          sync.Mutex
+	option      Option
+	rdbActions  []func(db *RDBManager) error
+	mgoActions  []func(db *MGOManager) error
+	evicts      []uowEvict
+	afterCommit []func() error
+	finished    bool
+}
+
+type uowEvict struct {
+	manager cache.Cache
+	keys    []string
+}
+
+type uowContextKey struct{}
+
+const uowStorageKey = "freego.unitOfWork"
+
+// UnitOfWorkStorage 请求级存储, 由node.Context等请求上下文实现, HTTP层无需依赖ORM
+type UnitOfWorkStorage interface {
+	GetStorage(k string) interface{}
+	AddStorage(k string, v interface{})
+}
+
+// NewUnitOfWork 创建工作单元, option为关系数据库及mongo数据源选项, 事务由工作单元管理
+func NewUnitOfWork(option ...Option) *UnitOfWork {
+	uow := &UnitOfWork{}
+	if len(option) > 0 {
+		uow.option = option[0]
+	}
+	uow.option.OpenTx = true
+	return uow
+}
+
+// RequestUnitOfWork 获取请求级工作单元, 同一请求内返回同一实例, 需由业务方法调用Commit提交
+// 如 uow := sqld.RequestUnitOfWork(ctx), ctx为*node.Context
+func RequestUnitOfWork(storage UnitOfWorkStorage, option ...Option) *UnitOfWork {
+	if v, b := storage.GetStorage(uowStorageKey).(*UnitOfWork); b {
+		return v
+	}
+	uow := NewUnitOfWork(option...)
+	storage.AddStorage(uowStorageKey, uow)
+	return uow
+}
+
+// WithUnitOfWork 将工作单元绑定到请求上下文, 用于gRPC等基于context.Context的请求
+func WithUnitOfWork(ctx context.Context, uow *UnitOfWork) context.Context {
+	return context.WithValue(ctx, uowContextKey{}, uow)
+}
+
+// GetUnitOfWork 获取请求上下文绑定的工作单元, 不存在返回nil
+func GetUnitOfWork(ctx context.Context) *UnitOfWork {
+	if ctx == nil {
+		return nil
+	}
+	uow, _ := ctx.Value(uowContextKey{}).(*UnitOfWork)
+	return uow
+}
+
+func (self *UnitOfWork) addRDB(fn func(db *RDBManager) error) *UnitOfWork {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.rdbActions = append(self.rdbActions, fn)
+	return self
+}
+
+// Save 登记保存数据
+func (self *UnitOfWork) Save(data ...sqlc.Object) *UnitOfWork {
+	return self.addRDB(func(db *RDBManager) error {
+		return db.Save(data...)
+	})
+}
+
+// Update 登记按主键更新数据
+func (self *UnitOfWork) Update(data ...sqlc.Object) *UnitOfWork {
+	return self.addRDB(func(db *RDBManager) error {
+		return db.Update(data...)
+	})
+}
+
+// UpdateByCnd 登记按条件更新数据
+func (self *UnitOfWork) UpdateByCnd(cnd *sqlc.Cnd) *UnitOfWork {
+	return self.addRDB(func(db *RDBManager) error {
+		_, err := db.UpdateByCnd(cnd)
+		return err
+	})
+}
+
+// Delete 登记删除数据
+func (self *UnitOfWork) Delete(data ...sqlc.Object) *UnitOfWork {
+	return self.addRDB(func(db *RDBManager) error {
+		return db.Delete(data...)
+	})
+}
+
+// DeleteByCnd 登记按条件删除数据
+func (self *UnitOfWork) DeleteByCnd(cnd *sqlc.Cnd) *UnitOfWork {
+	return self.addRDB(func(db *RDBManager) error {
+		_, err := db.DeleteByCnd(cnd)
+		return err
+	})
+}
+
+// Exec 登记自定义关系数据库操作, 与其他操作共享同一事务
+func (self *UnitOfWork) Exec(fn func(db *RDBManager) error) *UnitOfWork {
+	return self.addRDB(fn)
+}
+
+// ExecMongo 登记mongo操作, 副本集环境下在mongo事务中执行, 否则在关系数据库提交后执行
+func (self *UnitOfWork) ExecMongo(fn func(db *MGOManager) error) *UnitOfWork {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.mgoActions = append(self.mgoActions, fn)
+	return self
+}
+
+// Evict 登记提交成功后需清除的缓存key
+func (self *UnitOfWork) Evict(manager cache.Cache, keys ...string) *UnitOfWork {
+	if manager == nil || len(keys) == 0 {
+		return self
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.evicts = append(self.evicts, uowEvict{manager: manager, keys: keys})
+	return self
+}
+
+// AfterCommit 登记提交成功后执行的回调, 如发送outbox消息, 回调失败仅记录日志
+func (self *UnitOfWork) AfterCommit(fn func() error) *UnitOfWork {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.afterCommit = append(self.afterCommit, fn)
+	return self
+}
+
+// Rollback 丢弃已登记的全部操作
+func (self *UnitOfWork) Rollback() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.reset()
+	self.finished = true
+}
+
+func (self *UnitOfWork) reset() {
+	self.rdbActions = nil
+	self.mgoActions = nil
+	self.evicts = nil
+	self.afterCommit = nil
+}
+
+// Commit 执行已登记的操作, 任一操作失败则回滚关系数据库及mongo事务, 工作单元只能提交一次
+func (self *UnitOfWork) Commit() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.finished {
+		return utils.Error("[UnitOfWork] already committed or rolled back")
+	}
+	self.finished = true
+	defer self.reset()
+	if len(self.mgoActions) == 0 {
+		if err := self.commitRDB(); err != nil {
+			return err
+		}
+	} else if err := self.commitWithMongo(); err != nil {
+		return err
+	}
+	for _, v := range self.evicts {
+		if err := v.manager.Del(v.keys...); err != nil {
+			zlog.Error("[UnitOfWork] cache evict failed", 0, zlog.Any("keys", v.keys), zlog.AddError(err))
+		}
+	}
+	for _, fn := range self.afterCommit {
+		if err := fn(); err != nil {
+			zlog.Error("[UnitOfWork] after commit callback failed", 0, zlog.AddError(err))
+		}
+	}
+	return nil
+}
+
+// 在单个事务中执行关系数据库操作, 提交失败时返回错误
+func (self *UnitOfWork) commitRDB() error {
+	if len(self.rdbActions) == 0 {
+		return nil
+	}
+	db := &RDBManager{}
+	if err := db.GetDB(self.option); err != nil {
+		return err
+	}
+	for _, fn := range self.rdbActions {
+		if err := fn(db); err != nil {
+			if len(db.Errors) == 0 {
+				db.Errors = append(db.Errors, err)
+			}
+			db.Close()
+			return err
+		}
+	}
+	if err := db.writeMongoOutbox(); err != nil {
+		db.Errors = append(db.Errors, err)
+		db.Close()
+		return err
+	}
+	if err := db.writeTxAudit(); err != nil {
+		db.Errors = append(db.Errors, err)
+		db.Close()
+		return err
+	}
+	if db.Tx != nil {
+		tx := db.Tx
+		db.Tx = nil
+		if err := tx.Commit(); err != nil {
+			return utils.Error("[UnitOfWork] transaction commit failed: ", err)
+		}
+	}
+	return db.Close() // 执行MongoSync同步
+}
+
+// mongo事务包裹关系数据库事务, 关系数据库提交后再提交mongo事务, 不支持事务时退化为顺序执行
+func (self *UnitOfWork) commitWithMongo() error {
+	mgo, err := NewMongo(self.option)
+	if err != nil {
+		return err
+	}
+	defer mgo.Close()
+	session, err := mgo.Session.StartSession()
+	if err != nil {
+		return utils.Error("[UnitOfWork] mongo start session failed: ", err)
+	}
+	defer session.EndSession(mgo.PackContext.Context)
+	return mongo.WithSession(mgo.PackContext.Context, session, func(sessionContext mongo.SessionContext) error {
+		if err := sessionContext.StartTransaction(); err != nil {
+			zlog.Warn("[UnitOfWork] mongo transaction unsupported, execute without transaction", 0, zlog.AddError(err))
+			if err := self.commitRDB(); err != nil {
+				return err
+			}
+			return self.execMongo(mgo)
+		}
+		mgo.PackContext.SessionContext = sessionContext
+		if err := self.execMongo(mgo); err != nil {
+			sessionContext.AbortTransaction(sessionContext)
+			return err
+		}
+		if err := self.commitRDB(); err != nil {
+			sessionContext.AbortTransaction(sessionContext)
+			return err
+		}
+		if err := sessionContext.CommitTransaction(sessionContext); err != nil {
+			zlog.Error("[UnitOfWork] mongo commit failed after rdb committed", 0, zlog.AddError(err))
+			return utils.Error("[UnitOfWork] mongo transaction commit failed: ", err)
+		}
+		mgo.flushAudit()
+		mgo.flushTransitions()
+		return nil
+	})
+}
+
+func (self *UnitOfWork) execMongo(mgo *MGOManager) error {
+	for _, fn := range self.mgoActions {
+		if err := fn(mgo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
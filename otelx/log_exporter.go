@@ -0,0 +1,370 @@
+package otelx
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	common "go.opentelemetry.io/proto/otlp/common/v1"
+	logs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpres "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OTLP日志导出, 日志记录按批通过OTLP/HTTP上报, trace_id/span_id字段写入LogRecord对应属性, 与链路关联
+// 如 core, _ := otelx.NewLogExporter("127.0.0.1:4318", otelx.LogConfig{Insecure: true})
+// zlog.InitDefaultLog(&zlog.ZapConfig{Level: zlog.INFO, Console: true, Exporters: []zapcore.Core{core}})
+
+// LogConfig 日志导出配置
+type LogConfig struct {
+	ServiceName string            // 服务名称, 默认freego
+	Insecure    bool              // true: 使用HTTP上报, 默认HTTPS
+	Headers     map[string]string // 上报请求头, 如认证token
+	Timeout     int               // 上报超时/毫秒, 默认10000
+	Level       string            // 导出日志级别, 默认info
+	Buffer      int               // 发送队列长度, 默认4096
+	BatchSize   int               // 单次上报条数, 默认512
+	Interval    int               // 上报间隔/毫秒, 默认1000
+}
+
+var (
+	logDropped int64 // 日志导出丢弃数量
+	logMu      sync.Mutex
+	exporters  []*logExporter
+)
+
+// LogDropped OTLP日志导出因队列满或上报失败丢弃的日志数量
+func LogDropped() int64 {
+	return atomic.LoadInt64(&logDropped)
+}
+
+type logExporter struct {
+	mu       sync.RWMutex
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	resource *otlpres.Resource
+	batch    int
+	interval time.Duration
+	queue    chan *logs.LogRecord
+	done     chan struct{}
+	closed   bool
+}
+
+// NewLogExporter 创建OTLP日志导出core, endpoint为OTLP/HTTP采集地址, 如127.0.0.1:4318
+// 返回值作为zlog.ZapConfig.Exporters使用, 异步批量上报, 不阻塞日志调用, Shutdown时上报剩余日志
+func NewLogExporter(endpoint string, config ...LogConfig) (zapcore.Core, error) {
+	if len(endpoint) == 0 {
+		return nil, utils.Error("log exporter endpoint is nil")
+	}
+	conf := LogConfig{}
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if len(conf.ServiceName) == 0 {
+		conf.ServiceName = "freego"
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10000
+	}
+	if len(conf.Level) == 0 {
+		conf.Level = zlog.INFO
+	}
+	if conf.Buffer <= 0 {
+		conf.Buffer = 4096
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 512
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = 1000
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(conf.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([]*common.KeyValue, 0, res.Len())
+	for _, v := range res.Attributes() {
+		attrs = append(attrs, keyValue(string(v.Key), v.Value.AsInterface()))
+	}
+	scheme := "https://"
+	if conf.Insecure {
+		scheme = "http://"
+	}
+	exporter := &logExporter{
+		url:      utils.AddStr(scheme, endpoint, "/v1/logs"),
+		headers:  conf.Headers,
+		client:   &http.Client{Timeout: time.Duration(conf.Timeout) * time.Millisecond},
+		resource: &otlpres.Resource{Attributes: attrs},
+		batch:    conf.BatchSize,
+		interval: time.Duration(conf.Interval) * time.Millisecond,
+		queue:    make(chan *logs.LogRecord, conf.Buffer),
+		done:     make(chan struct{}),
+	}
+	go exporter.run()
+	logMu.Lock()
+	exporters = append(exporters, exporter)
+	logMu.Unlock()
+	return &logCore{LevelEnabler: zlog.GetLevel(conf.Level), exporter: exporter}, nil
+}
+
+// 非阻塞写入发送队列, 采集端不可用导致队列满时丢弃
+func (self *logExporter) enqueue(record *logs.LogRecord) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	if self.closed {
+		return
+	}
+	select {
+	case self.queue <- record:
+	default:
+		atomic.AddInt64(&logDropped, 1)
+	}
+}
+
+func (self *logExporter) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(self.interval)
+	defer ticker.Stop()
+	batch := make([]*logs.LogRecord, 0, self.batch)
+	for {
+		select {
+		case record, ok := <-self.queue:
+			if !ok {
+				self.export(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= self.batch {
+				self.export(batch)
+				batch = make([]*logs.LogRecord, 0, self.batch)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				self.export(batch)
+				batch = make([]*logs.LogRecord, 0, self.batch)
+			}
+		}
+	}
+}
+
+func (self *logExporter) export(batch []*logs.LogRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	request := &collogs.ExportLogsServiceRequest{ResourceLogs: []*logs.ResourceLogs{{
+		Resource:  self.resource,
+		ScopeLogs: []*logs.ScopeLogs{{Scope: &common.InstrumentationScope{Name: instrumentation}, LogRecords: batch}},
+		SchemaUrl: semconv.SchemaURL,
+	}}}
+	body, err := proto.Marshal(request)
+	if err != nil {
+		atomic.AddInt64(&logDropped, int64(len(batch)))
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, self.url, bytes.NewReader(body))
+	if err != nil {
+		atomic.AddInt64(&logDropped, int64(len(batch)))
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range self.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		atomic.AddInt64(&logDropped, int64(len(batch)))
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		atomic.AddInt64(&logDropped, int64(len(batch)))
+	}
+}
+
+// 停止写入并上报队列中剩余日志, ctx超时则放弃等待
+func (self *logExporter) shutdown(ctx context.Context) error {
+	self.mu.Lock()
+	if self.closed {
+		self.mu.Unlock()
+		return nil
+	}
+	self.closed = true
+	close(self.queue)
+	self.mu.Unlock()
+	select {
+	case <-self.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 关闭全部日志导出
+func shutdownLogs(ctx context.Context) error {
+	logMu.Lock()
+	list := exporters
+	exporters = nil
+	logMu.Unlock()
+	var result error
+	for _, v := range list {
+		if err := v.shutdown(ctx); err != nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// zap日志输出core, 转换为OTLP LogRecord写入导出队列
+type logCore struct {
+	zapcore.LevelEnabler
+	exporter *logExporter
+	fields   []zapcore.Field
+}
+
+func (self *logCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logCore{
+		LevelEnabler: self.LevelEnabler,
+		exporter:     self.exporter,
+		fields:       append(self.fields[:len(self.fields):len(self.fields)], fields...),
+	}
+}
+
+func (self *logCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if self.Enabled(ent.Level) {
+		return ce.AddCore(ent, self)
+	}
+	return ce
+}
+
+func (self *logCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, v := range self.fields {
+		v.AddTo(enc)
+	}
+	for _, v := range fields {
+		v.AddTo(enc)
+	}
+	record := &logs.LogRecord{
+		TimeUnixNano:         uint64(ent.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity(ent.Level),
+		SeverityText:         ent.Level.CapitalString(),
+		Body:                 anyValue(ent.Message),
+	}
+	if len(ent.LoggerName) > 0 {
+		record.Attributes = append(record.Attributes, keyValue("logger", ent.LoggerName))
+	}
+	for k, v := range enc.Fields {
+		if s, ok := v.(string); ok && (k == zlog.TraceKey || k == zlog.SpanKey) {
+			if id, err := hex.DecodeString(s); err == nil {
+				if k == zlog.TraceKey {
+					record.TraceId = id
+				} else {
+					record.SpanId = id
+				}
+				continue
+			}
+		}
+		record.Attributes = append(record.Attributes, keyValue(k, v))
+	}
+	self.exporter.enqueue(record)
+	return nil
+}
+
+func (self *logCore) Sync() error {
+	return nil
+}
+
+func severity(level zapcore.Level) logs.SeverityNumber {
+	switch level {
+	case zapcore.DebugLevel:
+		return logs.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case zapcore.InfoLevel:
+		return logs.SeverityNumber_SEVERITY_NUMBER_INFO
+	case zapcore.WarnLevel:
+		return logs.SeverityNumber_SEVERITY_NUMBER_WARN
+	case zapcore.ErrorLevel:
+		return logs.SeverityNumber_SEVERITY_NUMBER_ERROR
+	default:
+		return logs.SeverityNumber_SEVERITY_NUMBER_FATAL
+	}
+}
+
+func keyValue(key string, value interface{}) *common.KeyValue {
+	return &common.KeyValue{Key: key, Value: anyValue(value)}
+}
+
+// 转换字段值, 复杂类型序列化为JSON字符串
+func anyValue(value interface{}) *common.AnyValue {
+	switch v := value.(type) {
+	case string:
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &common.AnyValue{Value: &common.AnyValue_BoolValue{BoolValue: v}}
+	case int:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case int8:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case int16:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: v}}
+	case uint8:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint16:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint32:
+		return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+	case uint:
+		return uintValue(uint64(v))
+	case uint64:
+		return uintValue(v)
+	case uintptr:
+		return uintValue(uint64(v))
+	case float32:
+		return &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: utils.AnyToStr(v)}}
+		}
+		return &common.AnyValue{Value: &common.AnyValue_DoubleValue{DoubleValue: v}}
+	case []byte:
+		return &common.AnyValue{Value: &common.AnyValue_BytesValue{BytesValue: v}}
+	case time.Time:
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v.Format(time.RFC3339Nano)}}
+	case time.Duration:
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v.String()}}
+	case error:
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: v.Error()}}
+	case nil:
+		return &common.AnyValue{}
+	}
+	bs, err := utils.JsonMarshal(value)
+	if err != nil {
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: utils.AnyToStr(value)}}
+	}
+	return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: utils.Bytes2Str(bs)}}
+}
+
+// 超出int64范围时按字符串输出
+func uintValue(v uint64) *common.AnyValue {
+	if v > math.MaxInt64 {
+		return &common.AnyValue{Value: &common.AnyValue_StringValue{StringValue: utils.AnyToStr(v)}}
+	}
+	return &common.AnyValue{Value: &common.AnyValue_IntValue{IntValue: int64(v)}}
+}
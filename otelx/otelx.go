@@ -0,0 +1,181 @@
+package otelx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	instrumentation = "github.com/godaddy-x/freego"
+	maxStatementLen = 2048
+)
+
+var (
+	enabled  int32
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer = trace.NewNoopTracerProvider().Tracer(instrumentation)
+
+	sqlString  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumber  = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	sqlSpace   = regexp.MustCompile(`\s+`)
+	propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	ServiceName string            // 服务名称, 默认freego
+	Insecure    bool              // true: 使用HTTP上报, 默认HTTPS
+	SampleRatio float64           // 采样比例(0, 1], 默认1; 上游已采样时跟随上游
+	Headers     map[string]string // 上报请求头, 如认证token
+	Timeout     int               // 上报超时/毫秒, 默认10000
+}
+
+// InitTracing 初始化OpenTelemetry链路追踪, endpoint为OTLP/HTTP采集地址, 如127.0.0.1:4318
+// 初始化后HTTP/gRPC服务端提取并向下游透传trace上下文, 数据库查询及MQ收发创建对应span, zlog *Ctx日志附带trace_id/span_id
+func InitTracing(endpoint string, config ...TracingConfig) error {
+	if len(endpoint) == 0 {
+		return utils.Error("tracing endpoint is nil")
+	}
+	conf := TracingConfig{}
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if len(conf.ServiceName) == 0 {
+		conf.ServiceName = "freego"
+	}
+	if conf.SampleRatio <= 0 || conf.SampleRatio > 1 {
+		conf.SampleRatio = 1
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10000
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint),
+		otlptracehttp.WithTimeout(time.Duration(conf.Timeout) * time.Millisecond),
+	}
+	if conf.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(conf.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(conf.ServiceName)))
+	if err != nil {
+		return err
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	tracer = provider.Tracer(instrumentation)
+	zlog.SetTraceExtractor(chainExtractor(zlog.GetTraceExtractor()))
+	atomic.StoreInt32(&enabled, 1)
+	zlog.Printf("opentelemetry tracing【%s】has been started successful", endpoint)
+	return nil
+}
+
+// Shutdown 上报剩余日志及span并关闭日志导出及链路追踪
+func Shutdown(ctx context.Context) error {
+	err := shutdownLogs(ctx)
+	if !atomic.CompareAndSwapInt32(&enabled, 1, 0) {
+		return err
+	}
+	if e := provider.Shutdown(ctx); e != nil {
+		return e
+	}
+	return err
+}
+
+// Enabled 是否已初始化链路追踪
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Start 创建span, ctx为空时使用context.Background()
+func Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// StartAt 以指定开始时间创建span, 用于耗时统计已完成后补录
+func StartAt(ctx context.Context, name string, kind trace.SpanKind, start time.Time, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+}
+
+// End 结束span, err不为空时记录错误状态
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject 写入trace上下文到carrier, 用于向下游透传
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+// Extract 从carrier读取上游trace上下文
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return propagator.Extract(ctx, carrier)
+}
+
+// SanitizeSQL 脱敏SQL语句, 字符串及数字常量替换为?, 合并空白字符并截断超长语句
+func SanitizeSQL(statement string) string {
+	statement = sqlString.ReplaceAllString(statement, "?")
+	statement = sqlNumber.ReplaceAllString(statement, "?")
+	statement = strings.TrimSpace(sqlSpace.ReplaceAllString(statement, " "))
+	if len(statement) > maxStatementLen {
+		statement = statement[:maxStatementLen]
+	}
+	return statement
+}
+
+// 优先读取SpanContext, 无有效span时回退到原提取函数, 保留zlog.WithTrace写入的ID
+func chainExtractor(previous zlog.TraceExtractor) zlog.TraceExtractor {
+	return func(ctx context.Context) (string, string) {
+		if trace, span := spanExtractor(ctx); len(trace) > 0 {
+			return trace, span
+		}
+		return previous(ctx)
+	}
+}
+
+// 读取OpenTelemetry SpanContext
+func spanExtractor(ctx context.Context) (string, string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
@@ -0,0 +1,76 @@
+package preflight
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/rpcx"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 就绪检测, 复用启动前依赖检测, 按关键性汇总: 非关键数据源检测失败时仍视为就绪, 仅在结果中体现
+// 默认全部数据源为关键, SetNonCritical按类型(如redis)或类型/数据源(如redis/cache2)设置非关键
+// 用法: node.AddHealth("/healthz", "/readyz", preflight.Probe), grpc服务调用preflight.WatchGRPC切换grpc.health.v1状态
+
+var (
+	nonCriticalMu sync.RWMutex
+	nonCritical   = map[string]bool{}
+	lastReady     = int32(1) // 上次就绪状态, 状态变化时记录日志
+)
+
+// SetNonCritical 设置非关键检测项, 格式为kind或kind/dsName, 重复设置时覆盖
+func SetNonCritical(items ...string) {
+	result := make(map[string]bool, len(items))
+	for _, v := range items {
+		result[v] = true
+	}
+	nonCriticalMu.Lock()
+	defer nonCriticalMu.Unlock()
+	nonCritical = result
+}
+
+func isCritical(v Result) bool {
+	nonCriticalMu.RLock()
+	defer nonCriticalMu.RUnlock()
+	return !nonCritical[v.Kind] && !nonCritical[v.Kind+"/"+v.DsName]
+}
+
+// Ready 执行就绪检测, 仅关键检测项失败时Ok为false, 就绪状态变化时记录日志
+func Ready(ctx context.Context) *Report {
+	report := collect(ctx)
+	report.Ok = true
+	for _, v := range report.Results {
+		if !v.Ok && isCritical(v) {
+			report.Ok = false
+			break
+		}
+	}
+	state := int32(0)
+	if report.Ok {
+		state = 1
+	}
+	if atomic.SwapInt32(&lastReady, state) != state {
+		if report.Ok {
+			zlog.Info("readiness check recovered", 0, zlog.Int64("cost", report.Cost))
+		} else {
+			for _, v := range report.Failed() {
+				zlog.Error("readiness check failed", 0, zlog.String("kind", v.Kind), zlog.String("dsName", v.DsName), zlog.Bool("critical", isCritical(v)), zlog.String("error", v.Error))
+			}
+		}
+	}
+	return report
+}
+
+// Probe 就绪检测探针, 适配node.AddHealth
+func Probe(ctx context.Context) (bool, interface{}) {
+	report := Ready(ctx)
+	return report.Ok, report
+}
+
+// WatchGRPC 按间隔执行就绪检测并切换grpc.health.v1服务状态
+func WatchGRPC(interval time.Duration) {
+	rpcx.WatchHealth(interval, func(ctx context.Context) bool {
+		return Ready(ctx).Ok
+	})
+}
@@ -0,0 +1,163 @@
+package preflight
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/amqp"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/kafka"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/rpcx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	MYSQL     = "mysql"
+	MONGO     = "mongo"
+	REDIS     = "redis"
+	RABBITMQ  = "rabbitmq"
+	KAFKA     = "kafka"
+	CONSUL    = "consul"
+	SNOWFLAKE = "snowflake"
+)
+
+// Result 单个数据源检测结果
+type Result struct {
+	Kind   string `json:"kind"`
+	DsName string `json:"dsName"`
+	Ok     bool   `json:"ok"`
+	Cost   int64  `json:"cost"` // 毫秒
+	Error  string `json:"error,omitempty"`
+}
+
+// Report 启动前依赖检测报告
+type Report struct {
+	Ok      bool     `json:"ok"`
+	Cost    int64    `json:"cost"` // 毫秒
+	Results []Result `json:"results"`
+}
+
+// Failed 检测失败的数据源
+func (self *Report) Failed() []Result {
+	var result []Result
+	for _, v := range self.Results {
+		if !v.Ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Error 存在失败项时返回汇总错误
+func (self *Report) Error() error {
+	failed := self.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(failed))
+	for _, v := range failed {
+		errs = append(errs, utils.Error(v.Error))
+	}
+	return &utils.MultiError{Errors: errs}
+}
+
+type checker struct {
+	kind string
+	call func(ctx context.Context) map[string]error
+}
+
+var checkers = []checker{
+	{kind: MYSQL, call: sqld.PingRDB},
+	{kind: MONGO, call: sqld.PingMongo},
+	{kind: REDIS, call: func(ctx context.Context) map[string]error { return cache.PingRedis() }},
+	{kind: RABBITMQ, call: func(ctx context.Context) map[string]error { return rabbitmq.PingPublish() }},
+	{kind: KAFKA, call: func(ctx context.Context) map[string]error { return kafka.PingPublish() }},
+	{kind: CONSUL, call: func(ctx context.Context) map[string]error { return rpcx.PingConsul() }},
+	{kind: SNOWFLAKE, call: func(ctx context.Context) map[string]error { return checkSnowflake() }},
+}
+
+// 雪花机器ID环境变量无效时报告失败
+func checkSnowflake() map[string]error {
+	if err := utils.SnowflakeEnvError(); err != nil {
+		return map[string]error{"": err}
+	}
+	return nil
+}
+
+// Preflight 并行检测所有已初始化数据源的连通性(MySQL select 1/Mongo ping/Redis PING/AMQP open channel/Kafka metadata/Consul leader)
+// 应在各数据源InitConfig之后、节点开始服务之前调用, ctx控制整体超时
+func Preflight(ctx context.Context) *Report {
+	report := collect(ctx)
+	for _, v := range report.Results {
+		if !v.Ok {
+			zlog.Error("preflight check failed", 0, zlog.String("kind", v.Kind), zlog.String("dsName", v.DsName), zlog.String("error", v.Error))
+		}
+	}
+	zlog.Info("preflight check finished", 0, zlog.Int64("cost", report.Cost), zlog.Bool("ok", report.Ok), zlog.Int("checks", len(report.Results)))
+	return report
+}
+
+// 并行执行全部检测, 结果按类型及数据源排序
+func collect(ctx context.Context) *Report {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := utils.UnixMilli()
+	report := &Report{Ok: true}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, v := range checkers {
+		wg.Add(1)
+		go func(c checker) {
+			defer wg.Done()
+			results := check(ctx, c)
+			mu.Lock()
+			report.Results = append(report.Results, results...)
+			mu.Unlock()
+		}(v)
+	}
+	wg.Wait()
+	sort.Slice(report.Results, func(i, j int) bool {
+		if report.Results[i].Kind != report.Results[j].Kind {
+			return report.Results[i].Kind < report.Results[j].Kind
+		}
+		return report.Results[i].DsName < report.Results[j].DsName
+	})
+	for _, v := range report.Results {
+		if !v.Ok {
+			report.Ok = false
+		}
+	}
+	report.Cost = utils.UnixMilli() - start
+	return report
+}
+
+func check(ctx context.Context, c checker) (results []Result) {
+	start := time.Now()
+	done := make(chan map[string]error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- map[string]error{"": utils.Error(c.kind, " check panic: ", r)}
+			}
+		}()
+		done <- c.call(ctx)
+	}()
+	select {
+	case <-ctx.Done():
+		return []Result{{Kind: c.kind, Cost: time.Since(start).Milliseconds(), Error: utils.AddStr(c.kind, " check timeout: ", ctx.Err())}}
+	case errs := <-done:
+		cost := time.Since(start).Milliseconds()
+		for k, err := range errs {
+			result := Result{Kind: c.kind, DsName: k, Ok: err == nil, Cost: cost}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+		return results
+	}
+}
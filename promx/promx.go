@@ -0,0 +1,276 @@
+package promx
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "freego"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path", "status"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_handled_duration_seconds",
+		Help:      "gRPC方法调用耗时, side为server/client",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"side", "service", "method", "code"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "数据库操作耗时",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"system", "table", "operation"})
+
+	dbErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "数据库操作失败次数",
+	}, []string{"system", "table", "operation"})
+
+	dbInterrupts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_interrupts_total",
+		Help:      "数据库操作中断次数, reason为timeout/canceled",
+	}, []string{"ds", "reason"})
+
+	dbRunaways = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_runaway_queries_total",
+		Help:      "失控查询次数, result为detected/killed/failure",
+	}, []string{"system", "ds", "result"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "缓存读取次数, result为hit/miss/error",
+	}, []string{"system", "ds", "result"})
+
+	amqpPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "amqp_published_total",
+		Help:      "MQ消息发送次数, result为success/failure",
+	}, []string{"exchange", "router", "result"})
+
+	amqpConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "amqp_consumed_total",
+		Help:      "MQ消息消费次数, result为success/failure",
+	}, []string{"exchange", "queue", "result"})
+
+	amqpRedelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "amqp_redelivered_total",
+		Help:      "MQ消息重复投递次数",
+	}, []string{"exchange", "queue"})
+
+	kafkaPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_published_total",
+		Help:      "kafka消息发送次数, result为success/failure",
+	}, []string{"topic", "result"})
+
+	kafkaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumed_total",
+		Help:      "kafka消息消费次数, result为success/failure",
+	}, []string{"topic", "group", "result"})
+
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "定时任务执行次数, result为success/failure/skipped",
+	}, []string{"job", "result"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "定时任务执行耗时",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job"})
+
+	jobLastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_last_run_timestamp_seconds",
+		Help:      "定时任务最近执行完成时间",
+	}, []string{"job", "result"})
+
+	jobLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_leader",
+		Help:      "当前实例是否为定时任务主节点, 1.是 0.否",
+	}, []string{"job"})
+
+	certExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tls_cert_expiry_timestamp_seconds",
+		Help:      "TLS证书过期时间",
+	}, []string{"name"})
+
+	auditEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_entries_total",
+		Help:      "数据审计记录数量, result为written/dropped/failed",
+	}, []string{"result"})
+
+	replayRejects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "replay_rejects_total",
+		Help:      "防重放拒绝次数, side为http/grpc, reason为invalid/stale/duplicate/error",
+	}, []string{"side", "reason"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpDuration, grpcDuration, dbDuration, dbErrors, dbInterrupts, dbRunaways,
+		cacheRequests, amqpPublished, amqpConsumed, amqpRedelivered,
+		kafkaPublished, kafkaConsumed,
+		jobRuns, jobDuration, jobLastRun, jobLeader, certExpiry, replayRejects, auditEntries,
+	)
+}
+
+// Register 注册自定义指标, 与内置指标通过同一/metrics输出
+func Register(collectors ...prometheus.Collector) error {
+	for _, v := range collectors {
+		if err := registry.Register(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustRegister 注册自定义指标, 重复注册时panic
+func MustRegister(collectors ...prometheus.Collector) {
+	registry.MustRegister(collectors...)
+}
+
+// Registry 获取指标注册器
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// Handler 指标输出处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP 记录HTTP请求耗时, path应为路由路径, 避免路径参数导致指标膨胀
+func ObserveHTTP(method, path string, status int, took time.Duration) {
+	httpDuration.WithLabelValues(method, path, strconv.Itoa(status)).Observe(took.Seconds())
+}
+
+// ObserveGRPC 记录gRPC方法调用耗时, side为server/client, code为gRPC状态码名称
+func ObserveGRPC(side, service, method, code string, took time.Duration) {
+	grpcDuration.WithLabelValues(side, service, method, code).Observe(took.Seconds())
+}
+
+// ObserveDB 记录数据库操作耗时, err不为空时计入失败次数
+func ObserveDB(system, table, operation string, took time.Duration, err error) {
+	dbDuration.WithLabelValues(system, table, operation).Observe(took.Seconds())
+	if err != nil {
+		dbErrors.WithLabelValues(system, table, operation).Inc()
+	}
+}
+
+// ObserveDBInterrupt 记录数据库操作因超时或取消中断, reason为timeout/canceled
+func ObserveDBInterrupt(ds, reason string) {
+	dbInterrupts.WithLabelValues(ds, reason).Inc()
+}
+
+// ObserveDBRunaway 记录失控查询, result为detected/killed/failure
+func ObserveDBRunaway(system, ds, result string) {
+	dbRunaways.WithLabelValues(system, ds, result).Inc()
+}
+
+// ObserveCache 记录缓存读取结果
+func ObserveCache(system, ds string, hit bool, err error) {
+	result := "miss"
+	if err != nil {
+		result = "error"
+	} else if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(system, ds, result).Inc()
+}
+
+// ObservePublish 记录MQ消息发送结果
+func ObservePublish(exchange, router string, err error) {
+	amqpPublished.WithLabelValues(exchange, router, result(err)).Inc()
+}
+
+// ObserveConsume 记录MQ消息消费结果, redelivered为true时计入重复投递次数
+func ObserveConsume(exchange, queue string, redelivered bool, err error) {
+	amqpConsumed.WithLabelValues(exchange, queue, result(err)).Inc()
+	if redelivered {
+		amqpRedelivered.WithLabelValues(exchange, queue).Inc()
+	}
+}
+
+// ObserveKafkaPublish 记录kafka消息发送结果
+func ObserveKafkaPublish(topic string, err error) {
+	kafkaPublished.WithLabelValues(topic, result(err)).Inc()
+}
+
+// ObserveKafkaConsume 记录kafka消息消费结果
+func ObserveKafkaConsume(topic, group string, err error) {
+	kafkaConsumed.WithLabelValues(topic, group, result(err)).Inc()
+}
+
+// ObserveJob 记录定时任务执行结果
+func ObserveJob(name string, took time.Duration, err error) {
+	r := result(err)
+	jobRuns.WithLabelValues(name, r).Inc()
+	jobDuration.WithLabelValues(name).Observe(took.Seconds())
+	jobLastRun.WithLabelValues(name, r).SetToCurrentTime()
+}
+
+// ObserveJobSkipped 记录定时任务因上次执行未结束而跳过
+func ObserveJobSkipped(name string) {
+	jobRuns.WithLabelValues(name, "skipped").Inc()
+}
+
+// SetJobLeader 记录当前实例是否为定时任务主节点
+func SetJobLeader(name string, leader bool) {
+	if leader {
+		jobLeader.WithLabelValues(name).Set(1)
+	} else {
+		jobLeader.WithLabelValues(name).Set(0)
+	}
+}
+
+// SetCertExpiry 记录TLS证书过期时间, name为证书用途如grpc-server
+func SetCertExpiry(name string, notAfter time.Time) {
+	certExpiry.WithLabelValues(name).Set(float64(notAfter.Unix()))
+}
+
+// ObserveReplayReject 记录防重放拒绝, reason为invalid/stale/duplicate/error
+func ObserveReplayReject(side, reason string) {
+	replayRejects.WithLabelValues(side, reason).Inc()
+}
+
+// ObserveAudit 记录数据审计记录数量, result为written/dropped/failed
+func ObserveAudit(result string, n int) {
+	auditEntries.WithLabelValues(result).Add(float64(n))
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
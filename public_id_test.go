@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"testing"
+)
+
+func TestPublicID(t *testing.T) {
+	utils.SetIDSecret("test.secret")
+	s, err := utils.EncodeID(1693872000000123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := utils.DecodeID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1693872000000123 {
+		t.Error("decode id invalid: ", id)
+	}
+	forged, _ := utils.EncodeID(1)
+	if _, err := utils.DecodeID(forged[1:] + "A"); err == nil {
+		t.Error("forged id should be rejected")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/godaddy-x/freego/amqp"
 	"testing"
@@ -56,3 +57,135 @@ func TestMQPublish(t *testing.T) {
 
 	time.Sleep(10000 * time.Second)
 }
+
+func TestMQPublishDelayed(t *testing.T) {
+	mq, err := rabbitmq.NewPublish()
+	if err != nil {
+		panic(err)
+	}
+	cli, _ := mq.Client()
+	msg := &rabbitmq.MsgData{
+		Option:  rabbitmq.Option{Exchange: exchange, Queue: queue},
+		Type:    1,
+		Content: map[string]interface{}{"test": 1234},
+	}
+	if err := cli.PublishDelayed(context.Background(), msg, 10*time.Second); err != nil {
+		panic(err)
+	}
+	fmt.Println("send delayed msg success: ", time.Now())
+}
+
+func TestMQBrowseDeadLetter(t *testing.T) {
+	mq, err := rabbitmq.NewPublish()
+	if err != nil {
+		panic(err)
+	}
+	config := &rabbitmq.Config{Option: rabbitmq.Option{Exchange: exchange, Queue: queue}, IsNack: true, MaxRetries: 3}
+	for offset := 0; offset >= 0; {
+		var result []rabbitmq.ReplayMessage
+		result, offset, err = mq.BrowseDeadLetter(config, offset, 10, rabbitmq.ReplayFilter{})
+		if err != nil {
+			panic(err)
+		}
+		for _, v := range result {
+			fmt.Println(v.Offset, v.Exchange, v.Router, v.Headers)
+		}
+	}
+	count, err := mq.ReplayDeadLetter(config, rabbitmq.ReplayRequest{Limit: 10, Operator: "admin"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("replay count: ", count)
+}
+
+func TestMQPublishConfirm(t *testing.T) {
+	mq, err := rabbitmq.NewPublish()
+	if err != nil {
+		panic(err)
+	}
+	mq.OnReturn(func(ret rabbitmq.ReturnedMessage) {
+		fmt.Println("returned msg: ", ret.Exchange, ret.Router, ret.Reason)
+	})
+	msg := &rabbitmq.MsgData{
+		Option:  rabbitmq.Option{Exchange: exchange, Queue: queue},
+		Type:    1,
+		Content: map[string]interface{}{"amount": "100.00"},
+	}
+	if err := mq.PublishConfirm(context.Background(), msg); err != nil {
+		panic(err)
+	}
+	batch := make([]*rabbitmq.MsgData, 0, 10)
+	for i := 0; i < 10; i++ {
+		batch = append(batch, &rabbitmq.MsgData{Option: rabbitmq.Option{Exchange: exchange, Queue: queue}, Type: 1, Content: map[string]interface{}{"index": i}})
+	}
+	fmt.Println(mq.PublishConfirmBatch(context.Background(), batch...))
+}
+
+func TestMQPullConcurrency(t *testing.T) {
+	mq, err := rabbitmq.NewPull()
+	if err != nil {
+		panic(err)
+	}
+	receiver := &rabbitmq.PullReceiver{
+		Config: &rabbitmq.Config{Option: rabbitmq.Option{Exchange: exchange, Queue: queue}, Concurrency: 8, OrderByRouter: true},
+		Callback: func(msg *rabbitmq.MsgData) error {
+			time.Sleep(500 * time.Millisecond)
+			fmt.Println("receive msg: ", msg.Content)
+			return nil
+		},
+	}
+	mq.AddPullReceiver(receiver)
+	time.Sleep(30 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fmt.Println(receiver.Stop(ctx))
+}
+
+func TestMQDeclareTopology(t *testing.T) {
+	mq, err := rabbitmq.NewPublish()
+	if err != nil {
+		panic(err)
+	}
+	err = mq.DeclareTopology(rabbitmq.Topology{
+		Exchanges: []rabbitmq.ExchangeSpec{{Name: exchange, Durable: true}},
+		Queues: []rabbitmq.QueueSpec{
+			{Name: queue, Durable: true, Quorum: true, DeadLetterExchange: "test.monitor.dlx"},
+			{Name: "test.monitor.ttl", Durable: true, MessageTTL: 60000},
+		},
+		Bindings: []rabbitmq.BindingSpec{{Queue: queue, Exchange: exchange}, {Queue: "test.monitor.ttl", Exchange: exchange}},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestMemoryBrokerConfirm(t *testing.T) {
+	broker := rabbitmq.NewMemoryBroker(rabbitmq.AmqpConfig{SecretKey: "test", ConfirmTimeout: 200}, 1)
+	defer broker.Close()
+	var returned []rabbitmq.ReturnedMessage
+	broker.OnReturn(func(ret rabbitmq.ReturnedMessage) {
+		returned = append(returned, ret)
+	})
+	routed := &rabbitmq.MsgData{Option: rabbitmq.Option{Exchange: exchange, Queue: queue}, Content: map[string]interface{}{"test": 1}}
+	if err := broker.PublishConfirm(context.Background(), routed); err != nil {
+		t.Fatal(err)
+	}
+	full := &rabbitmq.MsgData{Option: rabbitmq.Option{Exchange: exchange, Queue: queue}, Content: map[string]interface{}{"test": 2}}
+	if err := broker.PublishConfirm(context.Background(), full); err != rabbitmq.ErrConfirmTimeout { // 队列已满且无消费者
+		t.Fatalf("expected confirm timeout, got %v", err)
+	}
+	unroutable := &rabbitmq.MsgData{Option: rabbitmq.Option{Exchange: "test.unroutable", Router: "none"}, Content: map[string]interface{}{"test": 3}}
+	if err := broker.PublishConfirm(context.Background(), unroutable); err != rabbitmq.ErrPublishReturned {
+		t.Fatalf("expected returned, got %v", err)
+	}
+	if len(returned) != 1 || returned[0].Exchange != "test.unroutable" {
+		t.Fatalf("return callback not invoked: %v", returned)
+	}
+	broker.OnConfirm(func(data *rabbitmq.MsgData) error {
+		return rabbitmq.ErrPublishNack
+	})
+	result := broker.PublishConfirmBatch(context.Background(), routed, nil)
+	if result[0] != rabbitmq.ErrPublishNack || result[1] == nil {
+		t.Fatalf("unexpected batch result: %v", result)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/garyburd/redigo/redis"
 	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/testx"
 	"github.com/godaddy-x/freego/utils"
 	"reflect"
 	"testing"
@@ -12,10 +13,6 @@ import (
 
 var subkey = "test.subkey"
 
-func init() {
-	initRedis()
-}
-
 func expectPushed(t *testing.T, c redis.PubSubConn, message string, expected interface{}) {
 	actual := c.Receive()
 	if !reflect.DeepEqual(actual, expected) {
@@ -24,6 +21,7 @@ func expectPushed(t *testing.T, c redis.PubSubConn, message string, expected int
 }
 
 func TestRedisPublish(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := cache.NewRedis()
 	if err != nil {
 		panic(err)
@@ -36,6 +34,7 @@ func TestRedisPublish(t *testing.T) {
 }
 
 func TestRedisSubscribe(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := cache.NewRedis()
 	if err != nil {
 		panic(err)
@@ -51,6 +50,7 @@ func TestRedisSubscribe(t *testing.T) {
 }
 
 func TestRedisSubscribe2(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := new(cache.RedisManager).Client()
 	if err != nil {
 		panic(err)
@@ -62,6 +62,7 @@ func TestRedisSubscribe2(t *testing.T) {
 }
 
 func TestRedisSpinLocker(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := new(cache.RedisManager).Client()
 	if err != nil {
 		panic(err)
@@ -76,6 +77,7 @@ func TestRedisSpinLocker(t *testing.T) {
 }
 
 func TestRedisSpinLocker2(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := new(cache.RedisManager).Client()
 	if err != nil {
 		panic(err)
@@ -89,6 +91,7 @@ func TestRedisSpinLocker2(t *testing.T) {
 }
 
 func TestRedisSpinLocker3(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := new(cache.RedisManager).Client()
 	if err != nil {
 		panic(err)
@@ -102,6 +105,7 @@ func TestRedisSpinLocker3(t *testing.T) {
 }
 
 func TestRedisTryLocker1(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := new(cache.RedisManager).Client()
 	if err != nil {
 		panic(err)
@@ -116,6 +120,7 @@ func TestRedisTryLocker1(t *testing.T) {
 }
 
 func TestRedisTryLocker2(t *testing.T) {
+	testx.Redis(t)
 	mgr, err := new(cache.RedisManager).Client()
 	if err != nil {
 		panic(err)
@@ -129,6 +134,7 @@ func TestRedisTryLocker2(t *testing.T) {
 }
 
 func TestRedisGetAndSet(t *testing.T) {
+	testx.Redis(t)
 	rds, err := cache.NewRedis()
 	if err != nil {
 		panic(err)
@@ -144,6 +150,38 @@ func TestRedisGetAndSet(t *testing.T) {
 	fmt.Println("---", value)
 }
 
+func TestRedisCluster(t *testing.T) {
+	if _, err := new(cache.RedisManager).InitConfig(cache.RedisConfig{
+		DsName:    "cluster",
+		Mode:      cache.RedisCluster,
+		Addrs:     []string{"127.0.0.1:7000", "127.0.0.1:7001", "127.0.0.1:7002"},
+		MaxIdle:   10,
+		MaxActive: 100,
+	}); err != nil {
+		panic(err)
+	}
+	rds, err := cache.NewRedis("cluster")
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 10; i++ {
+		key := utils.AddStr("cluster.key.", i)
+		if err := rds.Put(key, i, 30); err != nil {
+			panic(err)
+		}
+		value, err := rds.GetInt64(key)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(key, value)
+	}
+	keys, err := rds.Keys("cluster.key.*")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("keys: ", len(keys))
+}
+
 func TestLocalCacheGetAndSet(t *testing.T) {
 	rds := cache.NewLocalCache(10, 10)
 	key := utils.MD5("123456")
@@ -157,7 +195,40 @@ func TestLocalCacheGetAndSet(t *testing.T) {
 	fmt.Println("---", value)
 }
 
+func TestLRUCacheGetAndSet(t *testing.T) {
+	lru := cache.NewLRUCache(cache.LRUOption{MaxEntries: 2, Expire: 30})
+	for i := 0; i < 3; i++ {
+		if err := lru.Put(utils.AddStr("lru.", i), i); err != nil {
+			panic(err)
+		}
+	}
+	keys, _ := lru.Keys("lru.*")
+	fmt.Println("keys: ", keys)
+}
+
+func TestTieredCacheGetAndSet(t *testing.T) {
+	testx.Redis(t)
+	rds, err := cache.NewRedis()
+	if err != nil {
+		panic(err)
+	}
+	tiered := cache.Tiered(cache.NewLRUCache(cache.LRUOption{MaxEntries: 10000}), rds)
+	defer tiered.Close()
+	key := utils.MD5("tiered.123456")
+	if err := tiered.Put(key, 1, 30); err != nil {
+		panic(err)
+	}
+	for i := 0; i < 3; i++ {
+		value, err := tiered.GetInt64(key)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("---", value)
+	}
+}
+
 func BenchmarkRedisGetAndSet(b *testing.B) {
+	testx.Redis(b)
 	b.StopTimer()
 	b.StartTimer()
 	rds, err := cache.NewRedis()
@@ -176,6 +247,34 @@ func BenchmarkRedisGetAndSet(b *testing.B) {
 	}
 }
 
+func TestRedisStreamQueue(t *testing.T) {
+	testx.Redis(t)
+	queue, err := cache.NewStreamQueue("test.stream", 10000)
+	if err != nil {
+		panic(err)
+	}
+	receiver := &cache.StreamReceiver{
+		Config: &cache.StreamConfig{Group: "test.group", ClaimIdle: 10000, IsNack: true},
+		Callback: func(msg *cache.StreamMessage) error {
+			fmt.Println("receive msg: ", msg.Id, msg.Type, msg.Content)
+			return nil
+		},
+	}
+	if err := queue.AddReceiver(receiver); err != nil {
+		panic(err)
+	}
+	for i := 0; i < 5; i++ {
+		id, err := queue.Publish(1, map[string]interface{}{"test": i})
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("send msg success: ", id)
+	}
+	time.Sleep(3 * time.Second)
+	fmt.Println(queue.Pending("test.group"))
+	fmt.Println(cache.CloseStream())
+}
+
 func BenchmarkLocalCacheGetAndSet(b *testing.B) {
 	b.StopTimer()
 	b.StartTimer()
@@ -191,3 +290,43 @@ func BenchmarkLocalCacheGetAndSet(b *testing.B) {
 		}
 	}
 }
+
+func TestRedisSnowflakeWorker(t *testing.T) {
+	testx.Redis(t)
+	mgr, err := cache.NewRedis()
+	if err != nil {
+		panic(err)
+	}
+	release, err := mgr.LeaseSnowflakeWorker(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datacenter, _ := utils.SnowflakeWorker(); datacenter != 1 {
+		t.Fatalf("snowflake datacenter should be 1: %d", datacenter)
+	}
+	ids := utils.NextIIDs(10)
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("snowflake ids should be increasing: %v", ids)
+		}
+	}
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisReplayGuard(t *testing.T) {
+	testx.Redis(t)
+	guard := cache.NewReplayGuard(cache.ReplayConfig{Window: 60})
+	nonce := utils.RandNonce()
+	if err := guard.Check("http", nonce, utils.UnixSecond()); err != nil {
+		panic(err)
+	}
+	if err := guard.Check("http", nonce, utils.UnixSecond()); err != cache.ErrReplayDuplicate {
+		panic("replay nonce should be rejected")
+	}
+	if err := guard.Check("http", utils.RandNonce(), utils.UnixSecond()-120); err != cache.ErrReplayStale {
+		panic("stale timestamp should be rejected")
+	}
+	fmt.Println("replay guard check successful")
+}
@@ -0,0 +1,60 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"github.com/godaddy-x/freego/ex/errorsx"
+	"github.com/godaddy-x/freego/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"sync"
+)
+
+// WithBreaker 客户端熔断拦截器, 按目标地址+方法独立统计失败率, 熔断期间直接返回503
+// 配合UseClientInterceptor使用, 与WithRetry同时使用时应置于其后, 使每次重试均计入统计
+func WithBreaker(config utils.BreakerConfig) grpc.UnaryClientInterceptor {
+	if config.IsFailure == nil {
+		config.IsFailure = isUnavailable
+	}
+	var breakers sync.Map
+	return func(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		name := utils.AddStr(conn.Target(), method)
+		v, ok := breakers.Load(name)
+		if !ok {
+			v, _ = breakers.LoadOrStore(name, utils.NewCircuitBreaker(name, config))
+		}
+		done, err := v.(*utils.CircuitBreaker).Allow()
+		if err != nil {
+			return errorsx.Wrap(err, http.StatusServiceUnavailable, utils.AddStr("the method [", method, "] circuit breaker is open"))
+		}
+		err = invoker(ctx, method, req, reply, conn, opts...)
+		done(err)
+		return err
+	}
+}
+
+// WithRetry 客户端重试拦截器, 按策略指数退避重试, Retryable为空时仅重试服务不可用错误
+// 仅应对幂等方法启用, 可配合RetryPolicy.Budget限制重试流量
+func WithRetry(policy utils.RetryPolicy) grpc.UnaryClientInterceptor {
+	if policy.Retryable == nil {
+		policy.Retryable = func(err error) bool {
+			return status.Code(err) == codes.Unavailable && !errors.Is(err, utils.ErrBreakerOpen)
+		}
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return utils.Retry(ctx, policy, func(ctx context.Context) error {
+			return invoker(ctx, method, req, reply, conn, opts...)
+		})
+	}
+}
+
+// 服务不可用/超时/限流/服务端异常计入熔断失败, 业务错误不计入
+func isUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
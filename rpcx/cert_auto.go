@@ -0,0 +1,36 @@
+package rpcx
+
+import (
+	"crypto/tls"
+	"github.com/godaddy-x/freego/utils/certx"
+	"google.golang.org/grpc/credentials"
+)
+
+// 自动证书, TlsConfig.Acme/Spiffe二选一, 设置后忽略证书文件配置
+// ACME适用于对外暴露的grpc服务, 客户端按系统根证书及HostName校验; SPIFFE适用于内部服务间mTLS, 按SPIFFE ID/信任域校验对端
+// 自动证书无RSA私钥文件, 如需GetAuthorizeTLS请另行调用CreateAuthorizeTLS
+
+func checkAutoTLS(tlsConfig TlsConfig) {
+	if tlsConfig.Acme != nil && tlsConfig.Spiffe != nil {
+		panic("only one Acme/Spiffe can be used")
+	}
+}
+
+func autoServerTLS(tlsConfig TlsConfig) *tls.Config {
+	checkAutoTLS(tlsConfig)
+	if tlsConfig.Spiffe != nil {
+		return certx.NewSpiffe(*tlsConfig.Spiffe).ServerTLS("grpc-server")
+	}
+	return certx.NewAcme(*tlsConfig.Acme).ServerTLS("grpc-server")
+}
+
+func autoClientTLS(tlsConfig TlsConfig) credentials.TransportCredentials {
+	checkAutoTLS(tlsConfig)
+	if tlsConfig.Spiffe != nil {
+		return credentials.NewTLS(certx.NewSpiffe(*tlsConfig.Spiffe).ClientTLS("grpc-client"))
+	}
+	if len(tlsConfig.HostName) == 0 {
+		panic("server host name is nil")
+	}
+	return credentials.NewClientTLSFromCert(nil, tlsConfig.HostName)
+}
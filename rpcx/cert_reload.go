@@ -0,0 +1,251 @@
+package rpcx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"google.golang.org/grpc/credentials"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 证书热加载, TlsConfig.Reload>0时开启, 按间隔检测证书/私钥/CA文件修改时间, 变更后重新加载, 收到SIGHUP时立即重新加载
+// 新证书仅对之后的TLS握手生效, 已建立的连接不中断; 加载失败时保留原证书并记录错误
+// 证书及CA剩余有效期不足7天时每小时记录告警, 过期时间通过promx指标tls_cert_expiry_timestamp_seconds输出
+
+const certExpiryWarn = 7 * 24 * time.Hour
+
+type certReloader struct {
+	name     string
+	config   TlsConfig
+	client   bool
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	expiry   time.Time // 证书及CA最早过期时间
+	modTime  map[string]time.Time
+	lastWarn time.Time
+}
+
+var (
+	certReloaders   []*certReloader
+	certReloadersMu sync.Mutex
+	certSignalOnce  sync.Once
+)
+
+func newCertReloader(name string, config TlsConfig, client bool) *certReloader {
+	self := &certReloader{name: name, config: config, client: client}
+	if err := self.load(); err != nil {
+		panic(err)
+	}
+	certReloadersMu.Lock()
+	certReloaders = append(certReloaders, self)
+	certReloadersMu.Unlock()
+	go self.watch()
+	certSignalOnce.Do(func() {
+		go watchCertSignal()
+	})
+	return self
+}
+
+// 需要加载的文件: 证书/私钥及CA, 单向TLS客户端使用服务端证书作为根证书
+func (self *certReloader) files() (certFile, keyFile, caFile string) {
+	if !self.client {
+		certFile, keyFile = self.config.CrtFile, self.config.KeyFile
+		if self.config.UseMTLS {
+			caFile = self.config.CACrtFile
+		}
+		return
+	}
+	if self.config.UseMTLS {
+		return self.config.CrtFile, self.config.KeyFile, self.config.CACrtFile
+	}
+	return "", "", self.config.CrtFile
+}
+
+func (self *certReloader) load() error {
+	certFile, keyFile, caFile := self.files()
+	modTime := map[string]time.Time{}
+	var expiry time.Time
+	var cert *tls.Certificate
+	if len(certFile) > 0 {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return utils.Error("[TLS] ", self.name, " load key pair failed: ", err)
+		}
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return utils.Error("[TLS] ", self.name, " parse certificate failed: ", err)
+		}
+		pair.Leaf = leaf
+		cert = &pair
+		expiry = leaf.NotAfter
+		for _, v := range []string{certFile, keyFile} {
+			if info, err := os.Stat(v); err == nil {
+				modTime[v] = info.ModTime()
+			}
+		}
+	}
+	var pool *x509.CertPool
+	if len(caFile) > 0 {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return utils.Error("[TLS] ", self.name, " read ca failed: ", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return utils.Error("[TLS] ", self.name, " failed to append ca certs")
+		}
+		if notAfter := pemExpiry(data); !notAfter.IsZero() && (expiry.IsZero() || notAfter.Before(expiry)) {
+			expiry = notAfter
+		}
+		if info, err := os.Stat(caFile); err == nil {
+			modTime[caFile] = info.ModTime()
+		}
+	}
+	self.mu.Lock()
+	self.cert, self.pool, self.expiry, self.modTime = cert, pool, expiry, modTime
+	self.mu.Unlock()
+	if !expiry.IsZero() {
+		promx.SetCertExpiry(self.name, expiry)
+	}
+	zlog.Info("[TLS] certificate loaded", 0, zlog.String("name", self.name), zlog.String("expiry", expiry.Format(time.RFC3339)))
+	self.checkExpiry()
+	return nil
+}
+
+// 证书链中最早的过期时间
+func pemExpiry(data []byte) time.Time {
+	var result time.Time
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return result
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && (result.IsZero() || cert.NotAfter.Before(result)) {
+			result = cert.NotAfter
+		}
+	}
+}
+
+func (self *certReloader) checkExpiry() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.expiry.IsZero() || time.Until(self.expiry) > certExpiryWarn || time.Since(self.lastWarn) < time.Hour {
+		return
+	}
+	self.lastWarn = time.Now()
+	zlog.Warn("[TLS] certificate will expire soon", 0, zlog.String("name", self.name), zlog.String("expiry", self.expiry.Format(time.RFC3339)))
+}
+
+// 文件修改时间变化时重新加载
+func (self *certReloader) changed() bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for k, v := range self.modTime {
+		info, err := os.Stat(k)
+		if err == nil && !info.ModTime().Equal(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *certReloader) reload() {
+	if err := self.load(); err != nil {
+		zlog.Error("[TLS] certificate reload failed", 0, zlog.String("name", self.name), zlog.AddError(err))
+	}
+}
+
+func (self *certReloader) watch() {
+	ticker := time.NewTicker(time.Duration(self.config.Reload) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if self.changed() {
+			self.reload()
+		} else {
+			self.checkExpiry()
+		}
+	}
+}
+
+func watchCertSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		certReloadersMu.Lock()
+		reloaders := certReloaders
+		certReloadersMu.Unlock()
+		for _, v := range reloaders {
+			v.reload()
+		}
+	}
+}
+
+func (self *certReloader) getCert() *tls.Certificate {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.cert
+}
+
+func (self *certReloader) getPool() *x509.CertPool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.pool
+}
+
+// 服务端凭证, 每次握手读取当前证书及客户端CA
+func (self *certReloader) serverCredentials() credentials.TransportCredentials {
+	config := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return self.getCert(), nil
+		},
+	}
+	if self.config.UseMTLS {
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				Certificates: []tls.Certificate{*self.getCert()},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    self.getPool(),
+				NextProtos:   []string{"h2"},
+			}, nil
+		}
+	}
+	return credentials.NewTLS(config)
+}
+
+// 客户端凭证, 根证书可热更新, 关闭内置校验后在VerifyConnection中按当前根证书及HostName校验服务端证书
+func (self *certReloader) clientCredentials() credentials.TransportCredentials {
+	config := &tls.Config{
+		ServerName:         self.config.HostName,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server certificate is nil")
+			}
+			opts := x509.VerifyOptions{Roots: self.getPool(), DNSName: self.config.HostName, Intermediates: x509.NewCertPool()}
+			for _, v := range state.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(v)
+			}
+			_, err := state.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+	if self.config.UseMTLS {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return self.getCert(), nil
+		}
+	}
+	return credentials.NewTLS(config)
+}
@@ -0,0 +1,95 @@
+package rpcx
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	consulapi "github.com/hashicorp/consul/api"
+	"sync"
+	"time"
+)
+
+// 雪花机器ID租约, 以consul会话锁占用机器ID键, 会话失效时键自动删除由其他实例复用, 续约及重新分配由utils.LeaseSnowflakeWorker处理
+
+const (
+	workerLeaseKey = "snowflake/worker/"
+	workerLeaseTTL = 30 * time.Second
+)
+
+type workerStore struct {
+	mu      sync.Mutex
+	client  *consulapi.Client
+	session string
+}
+
+// LeaseSnowflakeWorker 分配数据中心下空闲的机器ID并设置雪花节点, 返回释放函数, 停机时调用释放租约
+func (self *ConsulManager) LeaseSnowflakeWorker(datacenter int64) (func() error, error) {
+	return utils.LeaseSnowflakeWorker(&workerStore{client: self.Consulx}, datacenter, workerLeaseTTL)
+}
+
+func (self *workerStore) key(datacenter, worker int64) string {
+	return utils.AddStr(workerLeaseKey, datacenter, "/", worker)
+}
+
+// 会话失效后重新创建
+func (self *workerStore) getSession(datacenter int64) (string, error) {
+	if len(self.session) > 0 {
+		return self.session, nil
+	}
+	session, _, err := self.client.Session().Create(&consulapi.SessionEntry{
+		Name:      utils.AddStr("snowflake-worker-", datacenter),
+		TTL:       workerLeaseTTL.String(),
+		Behavior:  consulapi.SessionBehaviorDelete,
+		LockDelay: time.Millisecond, // 宕机实例的机器ID可立即复用
+	}, nil)
+	if err != nil {
+		return "", utils.Error("snowflake worker session create failed: ", err)
+	}
+	self.session = session
+	return session, nil
+}
+
+func (self *workerStore) Acquire(datacenter, worker int64) (bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	session, err := self.getSession(datacenter)
+	if err != nil {
+		return false, err
+	}
+	ok, _, err := self.client.KV().Acquire(&consulapi.KVPair{Key: self.key(datacenter, worker), Session: session}, nil)
+	if err != nil {
+		self.destroy()
+		return false, err
+	}
+	return ok, nil
+}
+
+func (self *workerStore) Renew(datacenter, worker int64) (bool, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if len(self.session) == 0 {
+		return false, nil
+	}
+	entry, _, err := self.client.Session().Renew(self.session, nil)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil { // 会话已失效, 机器ID键已删除
+		self.session = ""
+		return false, nil
+	}
+	return true, nil
+}
+
+func (self *workerStore) Release(datacenter, worker int64) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.destroy()
+}
+
+func (self *workerStore) destroy() error {
+	if len(self.session) == 0 {
+		return nil
+	}
+	_, err := self.client.Session().Destroy(self.session, nil)
+	self.session = ""
+	return err
+}
@@ -9,6 +9,7 @@ import (
 	consulapi "github.com/hashicorp/consul/api"
 	"go.uber.org/zap"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -29,10 +30,11 @@ const (
 )
 
 type ConsulManager struct {
-	Host    string
-	Token   string
-	Consulx *consulapi.Client
-	Config  *ConsulConfig
+	Host      string
+	Token     string
+	Consulx   *consulapi.Client
+	Config    *ConsulConfig
+	checkOnce sync.Once
 }
 
 // Consulx配置参数
@@ -72,6 +74,13 @@ func (self *ConsulManager) InitConfig(input ...ConsulConfig) (*ConsulManager, er
 		manager := getConsulClient(conf)
 		manager.Config = &conf
 		consulSessions[manager.Config.DsName] = manager
+		addRegistry(conf.DsName, manager, RegistryConfig{
+			DsName:   conf.DsName,
+			Type:     REGISTRY_CONSUL,
+			Hosts:    []string{conf.Host},
+			RpcPort:  conf.RpcPort,
+			Protocol: conf.Protocol,
+		})
 		manager.initSlowLog()
 		zlog.Printf("consul service %s【%s】has been started successful", conf.Host, conf.DsName)
 	}
@@ -284,9 +293,95 @@ func (self *ConsulManager) CheckService(services []*consulapi.AgentService, srvN
 	return false
 }
 
+// Register 注册服务实例, 同一地址已存在时跳过, 首次注册时启动HTTP健康检查服务
+func (self *ConsulManager) Register(instance *ServiceInstance) error {
+	services, err := self.GetAllService(instance.Service)
+	if err != nil {
+		return err
+	}
+	self.checkOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc(self.Config.CheckPath, self.HealthCheck)
+		go func() {
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", self.Config.CheckPort), mux); err != nil {
+				panic(err)
+			}
+		}()
+	})
+	if self.CheckService(services, instance.Service, instance.Address) {
+		return ErrServiceExist
+	}
+	registration := &consulapi.AgentServiceRegistration{
+		ID:      instance.ID,
+		Name:    instance.Service,
+		Tags:    instance.Tags,
+		Address: instance.Address,
+		Port:    instance.Port,
+		Meta:    instance.Meta,
+		Check: &consulapi.AgentServiceCheck{
+			HTTP:                           fmt.Sprintf("http://%s:%d%s", instance.Address, self.Config.CheckPort, self.Config.CheckPath),
+			Timeout:                        self.Config.Timeout,
+			Interval:                       self.Config.Interval,
+			DeregisterCriticalServiceAfter: self.Config.DestroyAfter,
+		},
+	}
+	if registration.Meta == nil {
+		registration.Meta = make(map[string]string, 0)
+	}
+	return self.Consulx.Agent().ServiceRegister(registration)
+}
+
+// Deregister 注销服务实例
+func (self *ConsulManager) Deregister(instance *ServiceInstance) error {
+	return self.Consulx.Agent().ServiceDeregister(instance.ID)
+}
+
+// GetService 获取服务实例列表
+func (self *ConsulManager) GetService(service, tag string) ([]*ServiceInstance, error) {
+	serviceEntry, _, err := self.Consulx.Health().Service(service, tag, false, queryOptions)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ServiceInstance, 0, len(serviceEntry))
+	for _, v := range serviceEntry {
+		result = append(result, &ServiceInstance{
+			ID:      v.Service.ID,
+			Service: v.Service.Service,
+			Address: v.Service.Address,
+			Port:    v.Service.Port,
+			Tags:    v.Service.Tags,
+			Meta:    v.Service.Meta,
+		})
+	}
+	return result, nil
+}
+
+// Close consul基于HTTP调用, 无需关闭连接
+func (self *ConsulManager) Close() error {
+	return nil
+}
+
 // 接口服务健康检查
 func (self *ConsulManager) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	if _, err := fmt.Fprintln(w, "consulCheck"); err != nil {
 		zlog.Error("consul check output failed", 0, zlog.AddError(err))
 	}
 }
+
+// PingConsul 检测所有已初始化的consul连接是否存在leader, 返回数据源名称对应的检测结果
+func PingConsul() map[string]error {
+	result := make(map[string]error, len(consulSessions))
+	for k, v := range consulSessions {
+		leader, err := v.Consulx.Status().Leader()
+		if err != nil {
+			result[k] = utils.Error("consul [", k, "] leader query failed: ", err)
+			continue
+		}
+		if len(leader) == 0 {
+			result[k] = utils.Error("consul [", k, "] leader not elected")
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
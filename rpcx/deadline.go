@@ -0,0 +1,69 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/godaddy-x/freego/utils"
+	"time"
+)
+
+var (
+	methodTimeouts = map[string]time.Duration{} // 方法级默认超时, key: /package.Service/Method
+	deadlinePolicy = DeadlinePolicy{}
+)
+
+// DeadlinePolicy 服务端deadline校验规则
+type DeadlinePolicy struct {
+	MaxTimeout int  // 允许的最长剩余超时/毫秒, 0则不限制
+	Required   bool // true: 拒绝未携带deadline的请求
+}
+
+// CreateMethodTimeout 设置方法级超时/毫秒, 与调用方deadline取较早者生效
+// key为完整方法名, 例: /pub_worker.PubWorker/GenerateId
+func (self *GRPCManager) CreateMethodTimeout(timeouts map[string]int) {
+	for method, timeout := range timeouts {
+		if len(method) == 0 || timeout <= 0 {
+			panic("grpc method timeout invalid")
+		}
+		methodTimeouts[method] = time.Duration(timeout) * time.Millisecond
+	}
+}
+
+// CreateDeadlinePolicy 设置服务端deadline校验规则, 用于限制单次请求最长资源占用
+func (self *GRPCManager) CreateDeadlinePolicy(policy DeadlinePolicy) {
+	if policy.MaxTimeout < 0 {
+		panic("grpc deadline max timeout invalid")
+	}
+	deadlinePolicy = policy
+}
+
+// withMethodTimeout 按方法级超时包装context, 调用方deadline更早时保持不变
+func withMethodTimeout(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	timeout, ok := methodTimeouts[method]
+	if !ok {
+		return ctx, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// checkDeadline 校验请求deadline, 缺失或超出上限时拒绝
+func checkDeadline(ctx context.Context, method string) error {
+	if utils.CheckStr(method, unauthorizedUrl...) {
+		return nil
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		if deadlinePolicy.Required {
+			return errors.New(fmt.Sprintf("the method [%s] request deadline is nil", method))
+		}
+		return nil
+	}
+	if deadlinePolicy.MaxTimeout > 0 && time.Until(deadline) > time.Duration(deadlinePolicy.MaxTimeout)*time.Millisecond {
+		return errors.New(fmt.Sprintf("the method [%s] request deadline exceeds %dms", method, deadlinePolicy.MaxTimeout))
+	}
+	return nil
+}
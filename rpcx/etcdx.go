@@ -0,0 +1,178 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultEtcdPrefix = "/freego/services"
+
+// EtcdRegistry 基于etcd v3的注册中心, 实例绑定租约, 按TTL续约, 进程退出或续约失败后自动剔除
+type EtcdRegistry struct {
+	client  *clientv3.Client
+	prefix  string
+	ttl     int64
+	timeout time.Duration
+	mu      sync.Mutex
+	leases  map[string]*etcdLease
+}
+
+type etcdLease struct {
+	id     clientv3.LeaseID
+	cancel context.CancelFunc
+}
+
+func newEtcdRegistry(conf RegistryConfig) (*EtcdRegistry, error) {
+	timeout := time.Duration(conf.Timeout) * time.Millisecond
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   conf.Hosts,
+		Username:    conf.Username,
+		Password:    conf.Password,
+		DialTimeout: timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(conf.Namespace, "/")
+	if len(prefix) == 0 {
+		prefix = defaultEtcdPrefix
+	}
+	return &EtcdRegistry{client: client, prefix: prefix, ttl: conf.TTL, timeout: timeout, leases: make(map[string]*etcdLease)}, nil
+}
+
+// Client 获取etcd原生客户端
+func (self *EtcdRegistry) Client() *clientv3.Client {
+	return self.client
+}
+
+func (self *EtcdRegistry) serviceKey(service string) string {
+	return utils.AddStr(self.prefix, "/", service, "/")
+}
+
+func (self *EtcdRegistry) instanceKey(instance *ServiceInstance) string {
+	return utils.AddStr(self.serviceKey(instance.Service), instance.ID)
+}
+
+func (self *EtcdRegistry) Register(instance *ServiceInstance) error {
+	value, err := utils.JsonMarshal(instance)
+	if err != nil {
+		return err
+	}
+	id, err := self.grant(instance, value)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	self.mu.Lock()
+	if old, b := self.leases[instance.ID]; b {
+		old.cancel()
+	}
+	self.leases[instance.ID] = &etcdLease{id: id, cancel: cancel}
+	self.mu.Unlock()
+	go self.keepAlive(ctx, instance, value, id)
+	return nil
+}
+
+// 创建租约并写入实例
+func (self *EtcdRegistry) grant(instance *ServiceInstance, value []byte) (clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	lease, err := self.client.Grant(ctx, self.ttl)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := self.client.Put(ctx, self.instanceKey(instance), utils.Bytes2Str(value), clientv3.WithLease(lease.ID)); err != nil {
+		return 0, err
+	}
+	return lease.ID, nil
+}
+
+// 续约中断(网络异常/租约过期)时重新注册, 直至注销
+func (self *EtcdRegistry) keepAlive(ctx context.Context, instance *ServiceInstance, value []byte, id clientv3.LeaseID) {
+	for {
+		ch, err := self.client.KeepAlive(ctx, id)
+		if err == nil {
+			for range ch {
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		zlog.Warn("etcd lease keepalive interrupted, re-registering", 0, zlog.String("service", instance.Service), zlog.String("id", instance.ID), zlog.AddError(err))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			newId, err := self.grant(instance, value)
+			if err != nil {
+				zlog.Error("etcd service re-register failed", 0, zlog.String("service", instance.Service), zlog.AddError(err))
+				continue
+			}
+			id = newId
+			self.mu.Lock()
+			if lease, b := self.leases[instance.ID]; b {
+				lease.id = id
+			}
+			self.mu.Unlock()
+			break
+		}
+	}
+}
+
+func (self *EtcdRegistry) Deregister(instance *ServiceInstance) error {
+	self.mu.Lock()
+	lease, b := self.leases[instance.ID]
+	delete(self.leases, instance.ID)
+	self.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	if b {
+		lease.cancel()
+		if _, err := self.client.Revoke(ctx, lease.id); err != nil { // 撤销租约同时删除实例
+			return err
+		}
+		return nil
+	}
+	_, err := self.client.Delete(ctx, self.instanceKey(instance))
+	return err
+}
+
+func (self *EtcdRegistry) GetService(service, tag string) ([]*ServiceInstance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), self.timeout)
+	defer cancel()
+	res, err := self.client.Get(ctx, self.serviceKey(service), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ServiceInstance, 0, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		instance := &ServiceInstance{}
+		if err := utils.JsonUnmarshal(kv.Value, instance); err != nil {
+			zlog.Warn("etcd service instance parse failed", 0, zlog.String("key", utils.Bytes2Str(kv.Key)), zlog.AddError(err))
+			continue
+		}
+		if hasTag(instance.Tags, tag) {
+			result = append(result, instance)
+		}
+	}
+	return result, nil
+}
+
+func (self *EtcdRegistry) Close() error {
+	self.mu.Lock()
+	for _, v := range self.leases {
+		v.cancel()
+	}
+	self.leases = make(map[string]*etcdLease)
+	self.mu.Unlock()
+	return self.client.Close()
+}
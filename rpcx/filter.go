@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"github.com/godaddy-x/freego/cache/limiter"
 	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/ex/errorsx"
 	"github.com/godaddy-x/freego/utils"
-	"github.com/godaddy-x/freego/utils/jwt"
 	"github.com/godaddy-x/freego/zlog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"net/http"
+	"time"
 )
 
 const (
@@ -21,7 +23,7 @@ const (
 )
 
 var (
-	unauthorizedUrl = []string{"/pub_worker.PubWorker/Authorize", "/pub_worker.PubWorker/PublicKey"}
+	unauthorizedUrl = []string{"/pub_worker.PubWorker/Authorize", "/pub_worker.PubWorker/PublicKey", "/grpc.health.v1.Health/Check", "/grpc.health.v1.Health/Watch"}
 )
 
 var defaultLimiter = rate.NewRateLimiter(rate.Option{
@@ -69,14 +71,10 @@ func (self *GRPCManager) checkToken(ctx context.Context, method string) error {
 	if !b || len(token) == 0 {
 		return errors.New("rpc context token is nil")
 	}
-	if len(jwtConfig.TokenKey) == 0 {
+	if jwtConfig == nil {
 		return errors.New("rpc context jwt is nil")
 	}
-	subject := &jwt.Subject{}
-	if err := subject.Verify(token[0], jwtConfig.TokenKey, false); err != nil {
-		return err
-	}
-	return nil
+	return verifyJwtToken(token[0])
 }
 
 func (self *GRPCManager) createToken(ctx context.Context, method string) (context.Context, error) {
@@ -86,25 +84,54 @@ func (self *GRPCManager) createToken(ctx context.Context, method string) (contex
 	if utils.CheckStr(method, unauthorizedUrl...) {
 		return ctx, nil
 	}
-	md := metadata.New(map[string]string{token: accessToken})
-	ctx = metadata.NewOutgoingContext(ctx, md)
-	return ctx, nil
+	return metadata.AppendToOutgoingContext(ctx, token, accessToken), nil
 }
 
 func (self *GRPCManager) ServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 	//if err := self.rateLimit(info.FullMethod); err != nil {
 	//	return nil, err
 	//}
+	start := time.Now()
+	ctx, span := startServerSpan(ctx, info.FullMethod)
+	defer func() {
+		endSpan(span, err)
+		observe(sideServer, info.FullMethod, start, err)
+	}()
+	if err := checkDeadline(ctx, info.FullMethod); err != nil {
+		return nil, errorsx.Wrap(err, ex.BIZ, err.Error()).GRPCStatus().Err()
+	}
 	if err := self.checkToken(ctx, info.FullMethod); err != nil {
-		return nil, status.Error(ex.BIZ, err.Error())
+		return nil, errorsx.Wrap(err, http.StatusUnauthorized, err.Error()).GRPCStatus().Err()
+	}
+	if err := checkReplay(ctx, info.FullMethod, req); err != nil {
+		return nil, errorsx.Wrap(err, http.StatusBadRequest, err.Error()).GRPCStatus().Err()
 	}
+	ctx = withIncomingTrace(ctx)
 	res, err := handler(ctx, req)
 	if err != nil {
-		return nil, status.Error(ex.GRPC, err.Error())
+		return nil, toStatusError(info.FullMethod, err)
 	}
 	return res, nil
 }
 
+// 服务端错误统一转换为gRPC status, ex.Throw等错误保留业务code
+func toStatusError(method string, err error) error {
+	target := errorsx.FromError(err)
+	if errorsx.HTTPStatus(target.Code) >= http.StatusInternalServerError {
+		zlog.Error("grpc handle failed", 0, zlog.String("service", method), zlog.Int("code", target.Code), zlog.AddError(err))
+	}
+	return target.GRPCStatus().Err()
+}
+
+// 客户端解析gRPC status为业务错误
+func fromStatusError(err error) error {
+	st := status.Convert(err)
+	if target := errorsx.FromStatus(st); target != nil {
+		return target
+	}
+	return errorsx.Wrap(err, ex.GRPC, st.Message())
+}
+
 func (self *GRPCManager) ClientInterceptor(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
 	//if err := self.rateLimit(method); err != nil {
 	//	return err
@@ -113,11 +140,16 @@ func (self *GRPCManager) ClientInterceptor(ctx context.Context, method string, r
 	if err != nil {
 		return err
 	}
+	ctx = withReplayNonce(ctx, method, req)
+	ctx, cancel := withMethodTimeout(ctx, method)
+	if cancel != nil {
+		defer cancel()
+	}
 	start := utils.UnixMilli()
 	if err := invoker(ctx, method, req, reply, conn, opts...); err != nil {
 		//rpcErr := status.Convert(err)
 		//zlog.Error("grpc call failed", start, zlog.String("service", method), zlog.AddError(rpcErr.Err()))
-		return utils.Error(status.Convert(err).Message())
+		return fromStatusError(err)
 	}
 	cost := utils.UnixMilli() - start
 	if self.consul != nil && self.consul.Config.SlowQuery > 0 && cost > self.consul.Config.SlowQuery {
@@ -3,11 +3,11 @@ package rpcx
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"fmt"
 	"github.com/godaddy-x/freego/cache/limiter"
 	"github.com/godaddy-x/freego/rpcx/pb"
 	"github.com/godaddy-x/freego/rpcx/pool"
 	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/utils/certx"
 	"github.com/godaddy-x/freego/utils/crypto"
 	"github.com/godaddy-x/freego/utils/jwt"
 	"github.com/godaddy-x/freego/zlog"
@@ -18,7 +18,6 @@ import (
 	"google.golang.org/grpc/keepalive"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"sync"
 	"time"
 )
@@ -28,7 +27,7 @@ var (
 	clientDialTLS   grpc.DialOption
 	jwtConfig       *jwt.JwtConfig
 	rateLimiterCall func(string) (rate.Option, error)
-	selectionCall   func([]*consulapi.ServiceEntry, GRPC) *consulapi.ServiceEntry
+	selectionCall   func([]*ServiceInstance, GRPC) *ServiceInstance
 	appConfigCall   func(string) (AppConfig, error)
 	authorizeTLS    *crypto.RsaObj
 	accessToken     = ""
@@ -45,7 +44,6 @@ type ClientConnPool struct {
 
 type GRPCManager struct {
 	consul       *ConsulManager
-	consulDs     string
 	authenticate bool
 }
 
@@ -57,6 +55,11 @@ type TlsConfig struct {
 	KeyFile   string
 	CrtFile   string
 	HostName  string
+	Reload    int // 证书文件变更检测间隔/秒, 大于0时开启证书热加载及SIGHUP重新加载
+	// 通过ACME自动申请证书, 无需证书文件, 客户端使用系统根证书校验
+	Acme *certx.AcmeConfig
+	// 通过SPIFFE workload API获取证书并进行mTLS, 无需证书文件
+	Spiffe *certx.SpiffeConfig
 }
 
 type AppConfig struct {
@@ -67,7 +70,7 @@ type AppConfig struct {
 }
 
 type GRPC struct {
-	Ds      string                    // consul数据源ds
+	Ds      string                    // 注册中心数据源ds
 	Tags    []string                  // 服务标签名称
 	Address string                    // 服务地址,为空时自动填充内网IP
 	RpcPort int                       // 服务地址端口
@@ -75,7 +78,7 @@ type GRPC struct {
 	Cache   int                       // 服务缓存时间/秒
 	Timeout int                       // context timeout/毫秒
 	AddRPC  func(server *grpc.Server) // grpc注册proto服务
-	Center  bool                      // false: 非注册中心 true: consul注册中心获取
+	Center  bool                      // false: 非注册中心 true: 注册中心获取
 }
 
 type AuthObject struct {
@@ -85,11 +88,22 @@ type AuthObject struct {
 	Signature string
 }
 
+// GetGRPCJwtConfig 返回当前签发密钥对应的jwt配置
 func GetGRPCJwtConfig() (*jwt.JwtConfig, error) {
-	if len(jwtConfig.TokenKey) == 0 {
-		return nil, utils.Error("grpc jwt key is nil")
+	if jwtConfig == nil {
+		return nil, utils.Error("grpc jwt config is nil")
+	}
+	key, err := jwtKeys.Active()
+	if err != nil {
+		return nil, err
+	}
+	config := *jwtConfig
+	if len(key.Secret) > 0 { // RS256/ES256密钥无Secret, 保留配置的TokenKey
+		config.TokenKey = key.Secret
 	}
-	return jwtConfig, nil
+	config.TokenKid = key.Kid
+	config.TokenAlg = key.Alg
+	return &config, nil
 }
 
 func GetAuthorizeTLS() (*crypto.RsaObj, error) {
@@ -106,22 +120,34 @@ func GetGRPCAppConfig(appid string) (AppConfig, error) {
 	return appConfigCall(appid)
 }
 
+// CreateJwtConfig 设置HS256密钥, 已通过CreateJwtSigners创建配置时仅补充TokenKey
 func (self *GRPCManager) CreateJwtConfig(tokenKey string, tokenExp ...int64) {
-	if jwtConfig != nil {
-		return
-	}
 	if len(tokenKey) < 32 {
 		panic("jwt tokenKey length should be >= 32")
 	}
-	var exp = int64(3600)
-	if len(tokenExp) > 0 && tokenExp[0] >= 3600 {
-		exp = tokenExp[0]
+	if jwtConfig == nil {
+		var exp = int64(3600)
+		if len(tokenExp) > 0 && tokenExp[0] >= 3600 {
+			exp = tokenExp[0]
+		}
+		self.createJwtConfig(exp)
+	}
+	if len(jwtConfig.TokenKey) == 0 {
+		jwtConfig.TokenKey = tokenKey
 	}
+	if _, err := jwtKeys.Active(); err != nil {
+		if err := jwtKeys.Add(jwt.Key{Secret: tokenKey}, true); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (self *GRPCManager) createJwtConfig(exp int64) {
 	jwtConfig = &jwt.JwtConfig{
 		TokenTyp: jwt.JWT,
 		TokenAlg: jwt.HS256,
-		TokenKey: tokenKey,
 		TokenExp: exp,
+		Keys:     jwtKeys,
 	}
 }
 
@@ -139,7 +165,35 @@ func (self *GRPCManager) CreateRateLimiterCall(fun func(method string) (rate.Opt
 	rateLimiterCall = fun
 }
 
+// CreateSelectionCall consul服务实例选取规则, 兼容原consul回调, 其他注册中心实例转换为consul结构
 func (self *GRPCManager) CreateSelectionCall(fun func([]*consulapi.ServiceEntry, GRPC) *consulapi.ServiceEntry) {
+	self.CreateInstanceSelectionCall(func(instances []*ServiceInstance, object GRPC) *ServiceInstance {
+		entries := make([]*consulapi.ServiceEntry, 0, len(instances))
+		for _, v := range instances {
+			entries = append(entries, &consulapi.ServiceEntry{Service: &consulapi.AgentService{
+				ID:      v.ID,
+				Service: v.Service,
+				Address: v.Address,
+				Port:    v.Port,
+				Tags:    v.Tags,
+				Meta:    v.Meta,
+			}})
+		}
+		entry := fun(entries, object)
+		if entry == nil || entry.Service == nil {
+			return nil
+		}
+		for i, v := range entries {
+			if v == entry || v.Service.ID == entry.Service.ID {
+				return instances[i]
+			}
+		}
+		return &ServiceInstance{ID: entry.Service.ID, Service: entry.Service.Service, Address: entry.Service.Address, Port: entry.Service.Port, Tags: entry.Service.Tags, Meta: entry.Service.Meta}
+	})
+}
+
+// CreateInstanceSelectionCall 服务实例选取规则, 适用于全部注册中心
+func (self *GRPCManager) CreateInstanceSelectionCall(fun func([]*ServiceInstance, GRPC) *ServiceInstance) {
 	if selectionCall != nil {
 		return
 	}
@@ -166,6 +220,10 @@ func (self *GRPCManager) CreateServerTLS(tlsConfig TlsConfig) {
 	if serverDialTLS != nil {
 		return
 	}
+	if tlsConfig.Acme != nil || tlsConfig.Spiffe != nil {
+		serverDialTLS = grpc.Creds(credentials.NewTLS(autoServerTLS(tlsConfig)))
+		return
+	}
 	if tlsConfig.UseTLS && tlsConfig.UseMTLS {
 		panic("only one UseTLS/UseMTLS can be used")
 	}
@@ -175,6 +233,14 @@ func (self *GRPCManager) CreateServerTLS(tlsConfig TlsConfig) {
 	if len(tlsConfig.KeyFile) == 0 {
 		panic("server.key file is nil")
 	}
+	if tlsConfig.Reload > 0 && (tlsConfig.UseTLS || tlsConfig.UseMTLS) {
+		if tlsConfig.UseMTLS && len(tlsConfig.CACrtFile) == 0 {
+			panic("ca.crt file is nil")
+		}
+		serverDialTLS = grpc.Creds(newCertReloader("grpc-server", tlsConfig, false).serverCredentials())
+		self.CreateAuthorizeTLS(tlsConfig.KeyFile)
+		return
+	}
 	if tlsConfig.UseTLS {
 		creds, err := credentials.NewServerTLSFromFile(tlsConfig.CrtFile, tlsConfig.KeyFile)
 		if err != nil {
@@ -217,12 +283,26 @@ func (self *GRPCManager) CreateClientTLS(tlsConfig TlsConfig) {
 	if clientDialTLS != nil {
 		return
 	}
+	if tlsConfig.Acme != nil || tlsConfig.Spiffe != nil {
+		clientDialTLS = grpc.WithTransportCredentials(autoClientTLS(tlsConfig))
+		return
+	}
 	if tlsConfig.UseTLS && tlsConfig.UseMTLS {
 		panic("only one tls mode can be used")
 	}
 	if len(tlsConfig.CrtFile) == 0 {
 		panic("server.crt file is nil")
 	}
+	if tlsConfig.Reload > 0 && (tlsConfig.UseTLS || tlsConfig.UseMTLS) {
+		if len(tlsConfig.HostName) == 0 {
+			panic("server host name is nil")
+		}
+		if tlsConfig.UseMTLS && (len(tlsConfig.CACrtFile) == 0 || len(tlsConfig.KeyFile) == 0) {
+			panic("ca.crt/client.key file is nil")
+		}
+		clientDialTLS = grpc.WithTransportCredentials(newCertReloader("grpc-client", tlsConfig, true).clientCredentials())
+		return
+	}
 	if tlsConfig.UseTLS {
 		if len(tlsConfig.CrtFile) == 0 {
 			panic("server.crt file is nil")
@@ -272,22 +352,16 @@ func (self *GRPCManager) CreateClientTLS(tlsConfig TlsConfig) {
 	}
 }
 
-func RunServer(consulDs string, authenticate bool, objects ...*GRPC) {
+func RunServer(ds string, authenticate bool, objects ...*GRPC) {
 	if len(objects) == 0 {
 		panic("rpc objects is nil...")
 	}
-	c, err := NewConsul(consulDs)
-	if err != nil {
-		panic(err)
-	}
-	self := &GRPCManager{consul: c, consulDs: consulDs, authenticate: authenticate}
-	services, err := self.consul.GetAllService("")
-	if err != nil {
-		panic(err)
-	}
+	holder, err := getRegistry(ds)
 	if err != nil {
 		panic(err)
 	}
+	self := &GRPCManager{authenticate: authenticate}
+	self.consul, _ = holder.registry.(*ConsulManager)
 	opts := []grpc.ServerOption{
 		grpc.InitialWindowSize(pool.InitialWindowSize),
 		grpc.InitialConnWindowSize(pool.InitialConnWindowSize),
@@ -300,15 +374,17 @@ func RunServer(consulDs string, authenticate bool, objects ...*GRPC) {
 			Time:    pool.KeepAliveTime,
 			Timeout: pool.KeepAliveTimeout,
 		}),
-		grpc.UnaryInterceptor(self.ServerInterceptor),
 	}
+	opts = append(opts, serverInterceptorOpts(self.ServerInterceptor, self.StreamServerInterceptor)...)
 	if serverDialTLS != nil {
 		opts = append(opts, serverDialTLS)
 	}
 	grpcServer := grpc.NewServer(opts...)
+	addGRPCServer(grpcServer)
+	services := make([]string, 0, len(objects))
 	for _, object := range objects {
 		address := utils.GetLocalIP()
-		port := self.consul.Config.RpcPort
+		port := holder.config.RpcPort
 		if object.RpcPort > 0 {
 			port = object.RpcPort
 		}
@@ -321,41 +397,30 @@ func RunServer(consulDs string, authenticate bool, objects ...*GRPC) {
 		if len(object.Service) == 0 || len(object.Service) > 100 {
 			panic("rpc service invalid")
 		}
-		if self.consul.CheckService(services, object.Service, address) {
-			zlog.Println(utils.AddStr("grpc service [", object.Service, "][", address, "] exist, skip..."))
-			object.AddRPC(grpcServer)
-			continue
+		instance := &ServiceInstance{
+			ID:      utils.GetUUID(),
+			Service: object.Service,
+			Address: address,
+			Port:    port,
+			Tags:    object.Tags,
 		}
-		registration := new(consulapi.AgentServiceRegistration)
-		registration.ID = utils.GetUUID()
-		registration.Tags = object.Tags
-		registration.Name = object.Service
-		registration.Address = address
-		registration.Port = port
-		registration.Meta = make(map[string]string, 0)
-		registration.Check = &consulapi.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://%s:%d%s", registration.Address, self.consul.Config.CheckPort, self.consul.Config.CheckPath),
-			Timeout:                        self.consul.Config.Timeout,
-			Interval:                       self.consul.Config.Interval,
-			DeregisterCriticalServiceAfter: self.consul.Config.DestroyAfter,
-		}
-		zlog.Println(utils.AddStr("grpc service [", registration.Name, "][", registration.Address, "] added successful"))
-		if err := self.consul.Consulx.Agent().ServiceRegister(registration); err != nil {
+		if err := holder.registry.Register(instance); err == ErrServiceExist {
+			zlog.Println(utils.AddStr("grpc service [", instance.Service, "][", instance.Address, "] exist, skip..."))
+		} else if err != nil {
 			panic(utils.AddStr("grpc service [", object.Service, "] add failed: ", err.Error()))
+		} else {
+			zlog.Println(utils.AddStr("grpc service [", instance.Service, "][", instance.Address, "] added successful"))
+			addRegistration(holder.registry, instance)
 		}
 		object.AddRPC(grpcServer)
+		services = append(services, object.Service)
 	}
-	go func() {
-		http.HandleFunc(self.consul.Config.CheckPath, self.consul.HealthCheck)
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", self.consul.Config.CheckPort), nil); err != nil {
-			panic(err)
-		}
-	}()
-	l, err := net.Listen(self.consul.Config.Protocol, utils.AddStr(":", utils.AnyToStr(self.consul.Config.RpcPort)))
+	addHealthServer(grpcServer, services...)
+	l, err := net.Listen(holder.config.Protocol, utils.AddStr(":", utils.AnyToStr(holder.config.RpcPort)))
 	if err != nil {
 		panic(err)
 	}
-	zlog.Println(utils.AddStr("grpc server【", utils.AddStr(":", utils.AnyToStr(self.consul.Config.RpcPort)), "】has been started successful"))
+	zlog.Println(utils.AddStr("grpc server【", utils.AddStr(":", utils.AnyToStr(holder.config.RpcPort)), "】has been started successful"))
 	if err := grpcServer.Serve(l); err != nil {
 		panic(err)
 	}
@@ -386,10 +451,13 @@ func RunOnlyServer(param InitParam) {
 		}),
 		//grpc.UnaryInterceptor(self.ServerInterceptor),
 	}
+	opts = append(opts, serverInterceptorOpts(nil, nil)...)
 	if serverDialTLS != nil {
 		opts = append(opts, serverDialTLS)
 	}
 	grpcServer := grpc.NewServer(opts...)
+	addGRPCServer(grpcServer)
+	services := make([]string, 0, len(param.Object))
 	for _, object := range param.Object {
 		address := utils.GetLocalIP()
 		if len(address) == 0 {
@@ -402,7 +470,9 @@ func RunOnlyServer(param InitParam) {
 			panic("rpc service invalid")
 		}
 		object.AddRPC(grpcServer)
+		services = append(services, object.Service)
 	}
+	addHealthServer(grpcServer, services...)
 	l, err := net.Listen("tcp", utils.AddStr(param.Addr, ":", param.Port))
 	if err != nil {
 		panic(err)
@@ -418,11 +488,8 @@ func RunOnlyServer(param InitParam) {
 // The remaining 1200s will be automatically renewed and detected every 15s
 func RunClient(appId ...string) {
 	if len(clientOptions) == 0 {
-		c, err := NewConsul()
-		if err != nil {
-			panic(err)
-		}
-		client := &GRPCManager{consul: c, consulDs: ""}
+		c, _ := NewConsul() // consul仅用于慢调用日志, 使用其他注册中心时可为空
+		client := &GRPCManager{consul: c}
 		clientOptions = append(clientOptions, grpc.WithInitialWindowSize(pool.InitialWindowSize))
 		clientOptions = append(clientOptions, grpc.WithInitialConnWindowSize(pool.InitialConnWindowSize))
 		clientOptions = append(clientOptions, grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(pool.MaxSendMsgSize)))
@@ -432,7 +499,9 @@ func RunClient(appId ...string) {
 			Timeout:             pool.KeepAliveTimeout,
 			PermitWithoutStream: true,
 		}))
-		clientOptions = append(clientOptions, grpc.WithUnaryInterceptor(client.ClientInterceptor))
+		clientOptions = append(clientOptions, clientInterceptorOpts(
+			[]grpc.UnaryClientInterceptor{client.ClientInterceptor, ShadowClientInterceptor, TraceClientInterceptor},
+			[]grpc.StreamClientInterceptor{client.StreamClientInterceptor})...)
 		if clientDialTLS != nil {
 			clientOptions = append(clientOptions, clientDialTLS)
 		} else {
@@ -445,12 +514,14 @@ func RunClient(appId ...string) {
 	var err error
 	var expired int64
 	for {
-		accessToken, expired, err = callLogin(appId[0])
+		var tok, secret string
+		tok, secret, expired, err = callLogin(appId[0])
 		if err != nil {
 			zlog.Error("rpc login failed", 0, zlog.AddError(err))
 			time.Sleep(5 * time.Second)
 			continue
 		}
+		accessToken, accessSecret = tok, secret
 		break
 	}
 	go renewClientToken(appId[0], expired)
@@ -471,9 +542,12 @@ func CreateClientOpts(serverAddr string, interceptor grpc.UnaryClientInterceptor
 			Timeout:             pool.KeepAliveTimeout,
 			PermitWithoutStream: true,
 		}))
+		var interceptors []grpc.UnaryClientInterceptor
 		if interceptor != nil {
-			clientOptions = append(clientOptions, grpc.WithUnaryInterceptor(interceptor))
+			interceptors = append(interceptors, interceptor)
 		}
+		interceptors = append(interceptors, ShadowClientInterceptor, TraceClientInterceptor)
+		clientOptions = append(clientOptions, clientInterceptorOpts(interceptors, nil)...)
 		if clientDialTLS != nil {
 			clientOptions = append(clientOptions, clientDialTLS)
 		} else {
@@ -483,13 +557,14 @@ func CreateClientOpts(serverAddr string, interceptor grpc.UnaryClientInterceptor
 	zlog.Info("GRPC client options init success", 0)
 }
 
-func callLogin(appId string) (string, int64, error) {
+// 返回token、调用签名密钥及过期时间
+func callLogin(appId string) (string, string, int64, error) {
 	appConfig, err := GetGRPCAppConfig(appId)
 	if err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
 	if len(appConfig.AppKey) == 0 {
-		return "", 0, utils.Error("rpc appConfig key is nil")
+		return "", "", 0, utils.Error("rpc appConfig key is nil")
 	}
 	authObject := &AuthObject{
 		AppId: appId,
@@ -499,35 +574,35 @@ func callLogin(appId string) (string, int64, error) {
 	authObject.Signature = utils.HMAC_SHA256(utils.AddStr(authObject.AppId, authObject.Nonce, authObject.Time), appConfig.AppKey, true)
 	b64, err := utils.ToJsonBase64(authObject)
 	if err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
 	conn, err := NewClientConn(GRPC{Service: "PubWorker"})
 	if err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
 	conn.NewContext(60000 * time.Millisecond)
 	defer conn.Close()
 	// load public key
 	pub, err := pb.NewPubWorkerClient(conn.Value()).PublicKey(conn.Context(), &pb.PublicKeyReq{})
 	if err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
 	rsaObj := &crypto.RsaObj{}
 	if err := rsaObj.LoadRsaPemFileBase64(pub.PublicKey); err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
 	content, err := rsaObj.Encrypt(nil, utils.Str2Bytes(b64))
 	if err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
 	req := &pb.AuthorizeReq{
 		Message: content,
 	}
 	res, err := pb.NewPubWorkerClient(conn.Value()).Authorize(conn.Context(), req)
 	if err != nil {
-		return "", 0, err
+		return "", "", 0, err
 	}
-	return res.Token, res.Expired, nil
+	return res.Token, replaySecret(res.Token, appConfig.AppKey), res.Expired, nil
 }
 
 func renewClientToken(appid string, expired int64) {
@@ -548,30 +623,33 @@ func NewClientConn(object GRPC) (pool.Conn, error) {
 		return nil, utils.Error("call service invalid")
 	}
 	var tag string
-	var timeout int
-	if object.Timeout <= 0 {
+	var timeout = object.Timeout
+	if timeout <= 0 {
 		timeout = 60000
 	}
 	if len(object.Tags) > 0 {
 		tag = object.Tags[0]
 	}
-	c, err := NewConsul(object.Ds)
+	registry, err := GetRegistry(object.Ds)
 	if err != nil {
 		return nil, err
 	}
-	services, err := c.GetCacheService(object.Service, tag, object.Cache)
+	services, err := getCacheService(object.Ds, registry, object.Service, tag, object.Cache)
 	if err != nil {
 		return nil, utils.Error("query service [", object.Service, "] failed: ", err)
 	}
-	var service *consulapi.AgentService
+	var service *ServiceInstance
 	if selectionCall == nil { // 选取规则为空则默认随机
 		if len(services) == 1 {
-			service = services[0].Service
+			service = services[0]
 		} else {
-			service = services[utils.ModRand(len(services))].Service
+			service = services[utils.ModRand(len(services))]
 		}
 	} else {
-		service = selectionCall(services, object).Service
+		service = selectionCall(services, object)
+	}
+	if service == nil {
+		return nil, utils.Error("select service [", object.Service, "] failed: instance is nil")
 	}
 	return clientConnPools.getClientConn(utils.AddStr(service.Address, ":", service.Port), timeout)
 }
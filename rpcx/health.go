@@ -0,0 +1,96 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/zlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"sync"
+	"time"
+)
+
+// grpc.health.v1标准健康检查服务, RunServer/RunOnlyServer自动注册, 服务名为空表示整体状态
+// 服务启动后整体及各服务为SERVING, WatchHealth定时执行检测并切换全部状态, Shutdown时置为NOT_SERVING
+
+var (
+	healthServer   = health.NewServer()
+	healthServices = map[string]bool{}
+	healthMu       sync.Mutex
+	healthStop     chan struct{}
+)
+
+// 注册健康检查服务并标记服务可用
+func addHealthServer(server *grpc.Server, services ...string) {
+	healthpb.RegisterHealthServer(server, healthServer)
+	healthMu.Lock()
+	for _, v := range services {
+		healthServices[v] = true
+		healthServer.SetServingStatus(v, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthMu.Unlock()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+}
+
+// SetServingStatus 设置服务健康状态, service为空时设置整体状态
+func SetServingStatus(service string, serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	healthServer.SetServingStatus(service, status)
+}
+
+// WatchHealth 按间隔执行依赖检测, 返回false时整体及全部服务置为NOT_SERVING, 恢复后置为SERVING, 重复调用时替换原检测
+func WatchHealth(interval time.Duration, check func(ctx context.Context) bool) {
+	if check == nil {
+		panic("health check is nil")
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	stop := make(chan struct{})
+	healthMu.Lock()
+	if healthStop != nil {
+		close(healthStop)
+	}
+	healthStop = stop
+	healthMu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		serving := true
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				ok := check(ctx)
+				cancel()
+				if ok == serving {
+					continue
+				}
+				serving = ok
+				healthMu.Lock()
+				for k := range healthServices {
+					SetServingStatus(k, ok)
+				}
+				healthMu.Unlock()
+				SetServingStatus("", ok)
+				zlog.Warn("grpc health status changed", 0, zlog.Bool("serving", ok))
+			}
+		}
+	}()
+}
+
+// 停止检测并将全部服务置为NOT_SERVING, 之后的状态设置不再生效
+func shutdownHealth() {
+	healthMu.Lock()
+	if healthStop != nil {
+		close(healthStop)
+		healthStop = nil
+	}
+	healthMu.Unlock()
+	healthServer.Shutdown()
+}
@@ -57,12 +57,15 @@ func (self *PubWorker) Authorize(ctx context.Context, req *pb.AuthorizeReq) (*pb
 	if len(authObj.Signature) != 44 || utils.HMAC_SHA256(utils.AddStr(authObj.AppId, authObj.Nonce, authObj.Time), appConfig.AppKey, true) != authObj.Signature {
 		return nil, utils.Error("signature invalid")
 	}
+	if err := rpcx.CheckReplay(authObj.Nonce, authObj.Time); err != nil {
+		return nil, err
+	}
 	jwtConfig, err := rpcx.GetGRPCJwtConfig()
 	if err != nil {
 		return nil, err
 	}
 	subject := &jwt.Subject{}
 	subject.Create(authObj.AppId).Dev("GRPC").Expired(jwtConfig.TokenExp)
-	token := subject.Generate(jwt.JwtConfig{TokenTyp: jwtConfig.TokenTyp, TokenAlg: jwtConfig.TokenAlg, TokenKey: jwtConfig.TokenKey})
+	token := subject.Generate(jwt.JwtConfig{TokenTyp: jwtConfig.TokenTyp, TokenAlg: jwtConfig.TokenAlg, TokenKey: jwtConfig.TokenKey, TokenKid: jwtConfig.TokenKid, Keys: jwtConfig.Keys})
 	return &pb.AuthorizeRes{Token: token, Expired: subject.Payload.Exp}, nil
 }
@@ -0,0 +1,252 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/ex/errorsx"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	interceptorMu            sync.Mutex
+	serverInterceptors       []grpc.UnaryServerInterceptor
+	serverStreamInterceptors []grpc.StreamServerInterceptor
+	clientInterceptors       []grpc.UnaryClientInterceptor
+	clientStreamInterceptors []grpc.StreamClientInterceptor
+)
+
+// UseServerInterceptor 添加服务端一元拦截器, 在内置认证拦截器之后按添加顺序执行, 需在RunServer/RunOnlyServer前调用
+func UseServerInterceptor(interceptors ...grpc.UnaryServerInterceptor) {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	serverInterceptors = append(serverInterceptors, interceptors...)
+}
+
+// UseServerStreamInterceptor 添加服务端流拦截器, 在内置认证拦截器之后按添加顺序执行, 需在RunServer/RunOnlyServer前调用
+func UseServerStreamInterceptor(interceptors ...grpc.StreamServerInterceptor) {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	serverStreamInterceptors = append(serverStreamInterceptors, interceptors...)
+}
+
+// UseClientInterceptor 添加客户端一元拦截器, 在内置拦截器之前按添加顺序执行, 需在RunClient/CreateClientOpts前调用
+func UseClientInterceptor(interceptors ...grpc.UnaryClientInterceptor) {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	clientInterceptors = append(clientInterceptors, interceptors...)
+}
+
+// UseClientStreamInterceptor 添加客户端流拦截器, 在内置拦截器之前按添加顺序执行, 需在RunClient/CreateClientOpts前调用
+func UseClientStreamInterceptor(interceptors ...grpc.StreamClientInterceptor) {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	clientStreamInterceptors = append(clientStreamInterceptors, interceptors...)
+}
+
+// 服务端拦截器选项, builtin为内置拦截器, 位于链首
+func serverInterceptorOpts(builtin grpc.UnaryServerInterceptor, builtinStream grpc.StreamServerInterceptor) []grpc.ServerOption {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	if builtin != nil {
+		unary = append(unary, builtin)
+	}
+	if builtinStream != nil {
+		stream = append(stream, builtinStream)
+	}
+	unary = append(unary, serverInterceptors...)
+	stream = append(stream, serverStreamInterceptors...)
+	var opts []grpc.ServerOption
+	if len(unary) > 0 {
+		opts = append(opts, grpc.ChainUnaryInterceptor(unary...))
+	}
+	if len(stream) > 0 {
+		opts = append(opts, grpc.ChainStreamInterceptor(stream...))
+	}
+	return opts
+}
+
+// 客户端拦截器选项, 用户拦截器位于内置拦截器之前, 可获取转换后的业务错误
+func clientInterceptorOpts(builtin []grpc.UnaryClientInterceptor, builtinStream []grpc.StreamClientInterceptor) []grpc.DialOption {
+	interceptorMu.Lock()
+	defer interceptorMu.Unlock()
+	unary := append(append([]grpc.UnaryClientInterceptor{}, clientInterceptors...), builtin...)
+	stream := append(append([]grpc.StreamClientInterceptor{}, clientStreamInterceptors...), builtinStream...)
+	var opts []grpc.DialOption
+	if len(unary) > 0 {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(unary...))
+	}
+	if len(stream) > 0 {
+		opts = append(opts, grpc.WithChainStreamInterceptor(stream...))
+	}
+	return opts
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (self *serverStream) Context() context.Context {
+	return self.ctx
+}
+
+// StreamServerInterceptor 服务端流拦截器, 建立流时执行与一元调用一致的截止时间及令牌校验, 配置限流规则时按流限流
+func (self *GRPCManager) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+	defer func() {
+		endSpan(span, err)
+		observe(sideServer, info.FullMethod, start, err)
+	}()
+	if err := checkDeadline(ctx, info.FullMethod); err != nil {
+		return errorsx.Wrap(err, ex.BIZ, err.Error()).GRPCStatus().Err()
+	}
+	if err := self.checkToken(ctx, info.FullMethod); err != nil {
+		return errorsx.Wrap(err, http.StatusUnauthorized, err.Error()).GRPCStatus().Err()
+	}
+	if err := checkReplay(ctx, info.FullMethod, nil); err != nil {
+		return errorsx.Wrap(err, http.StatusBadRequest, err.Error()).GRPCStatus().Err()
+	}
+	if rateLimiterCall != nil {
+		if err := self.rateLimit(info.FullMethod); err != nil {
+			return errorsx.Wrap(err, http.StatusTooManyRequests, err.Error()).GRPCStatus().Err()
+		}
+	}
+	if err := handler(srv, &serverStream{ServerStream: ss, ctx: withIncomingTrace(ctx)}); err != nil {
+		return toStatusError(info.FullMethod, err)
+	}
+	return nil
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	cancel context.CancelFunc
+	span   trace.Span
+	once   sync.Once
+}
+
+// finish 流结束时释放上下文并结束span, 仅执行一次
+func (self *clientStream) finish(err error) {
+	self.once.Do(func() {
+		self.cancel()
+		endSpan(self.span, err)
+	})
+}
+
+// watch 流未被读尽时(调用方取消/连接关闭/发送失败), grpc结束流后同样释放上下文
+func (self *clientStream) watch() {
+	<-self.ClientStream.Context().Done()
+	self.cancel()
+}
+
+func (self *clientStream) SendMsg(m interface{}) error {
+	if err := self.ClientStream.SendMsg(m); err != nil {
+		if err == io.EOF { // 服务端已结束, 具体错误由RecvMsg返回
+			return err
+		}
+		self.finish(err)
+		return fromStatusError(err)
+	}
+	return nil
+}
+
+func (self *clientStream) RecvMsg(m interface{}) error {
+	if err := self.ClientStream.RecvMsg(m); err != nil {
+		if err == io.EOF {
+			self.finish(nil)
+			return err
+		}
+		self.finish(err)
+		return fromStatusError(err)
+	}
+	return nil
+}
+
+// StreamClientInterceptor 客户端流拦截器, 建立流时附加令牌及trace上下文, 收发错误转换为业务错误
+func (self *GRPCManager) StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, err := self.createToken(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withReplayNonce(ctx, method, nil)
+	ctx, _, _ = withTraceContext(ctx)
+	ctx, span := startClientSpan(ctx, method, cc.Target())
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		cancel()
+		endSpan(span, err)
+		return nil, fromStatusError(err)
+	}
+	cs := &clientStream{ClientStream: stream, cancel: cancel, span: span}
+	go cs.watch()
+	return cs, nil
+}
+
+// ServeBidiStream 双向流服务端循环, 逐条接收请求并发送处理结果(结果为nil时不发送), 客户端结束发送时正常返回
+func ServeBidiStream[Req any, Resp any](stream grpc.ServerStream, handle func(ctx context.Context, req *Req) (*Resp, error)) error {
+	for {
+		req := new(Req)
+		if err := stream.RecvMsg(req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		resp, err := handle(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if resp == nil {
+			continue
+		}
+		if err := stream.SendMsg(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// SendStream 服务端流依次发送next返回的数据, next返回io.EOF时结束, 客户端取消时停止发送
+func SendStream[Resp any](stream grpc.ServerStream, next func(ctx context.Context) (*Resp, error)) error {
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		resp, err := next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.SendMsg(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// RecvStream 客户端循环接收服务端流数据, 服务端结束发送时正常返回, handle返回错误时停止接收
+func RecvStream[Resp any](stream grpc.ClientStream, handle func(resp *Resp) error) error {
+	for {
+		resp := new(Resp)
+		if err := stream.RecvMsg(resp); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := handle(resp); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package rpcx
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/utils/jwt"
+	"github.com/godaddy-x/freego/zlog"
+)
+
+// 签名密钥集合, 支持HS256/RS256/ES256, 非对称密钥可通过GetJwtKeySet().JWKS()发布公钥供其他服务验签
+var jwtKeys = jwt.NewKeySet()
+
+// JwtKey HS256签名密钥, Expired为0时长期有效
+type JwtKey struct {
+	Kid     string
+	Key     string
+	Expired int64 // 失效时间/秒
+}
+
+func (self JwtKey) jwtKey() jwt.Key {
+	return jwt.Key{Kid: self.Kid, Alg: jwt.HS256, Secret: self.Key, Expired: self.Expired}
+}
+
+// GetJwtKeySet 获取签名密钥集合, 用于发布JWKS或通过LoadJWKS/WatchJWKS按签发方导入其他服务公钥
+func GetJwtKeySet() *jwt.KeySet {
+	return jwtKeys
+}
+
+// CreateJwtKeys 设置多个有效密钥, activeKid为签发密钥, 其余密钥仅用于验签
+func (self *GRPCManager) CreateJwtKeys(activeKid string, keys ...JwtKey) {
+	if len(keys) == 0 {
+		panic("jwt keys is nil")
+	}
+	signers := make([]jwt.Key, 0, len(keys))
+	for _, v := range keys {
+		signers = append(signers, v.jwtKey())
+	}
+	self.CreateJwtSigners(activeKid, signers...)
+}
+
+// CreateJwtSigners 设置多个任意算法密钥, activeKid为签发密钥且须包含私钥, 其余密钥仅用于验签
+func (self *GRPCManager) CreateJwtSigners(activeKid string, keys ...jwt.Key) {
+	if len(keys) == 0 {
+		panic("jwt keys is nil")
+	}
+	found := false
+	for _, v := range keys {
+		if v.Kid == activeKid {
+			found = true
+		}
+		if err := jwtKeys.Add(v, v.Kid == activeKid); err != nil {
+			panic(err)
+		}
+	}
+	if !found {
+		panic("jwt active kid not found")
+	}
+	if jwtConfig == nil {
+		self.createJwtConfig(3600)
+	}
+}
+
+// RotateJwtKey 轮换HS256签发密钥, 旧密钥签发的token在overlap秒内继续有效
+func (self *GRPCManager) RotateJwtKey(kid, key string, overlap int64) error {
+	return self.RotateJwtSigner(JwtKey{Kid: kid, Key: key}.jwtKey(), overlap)
+}
+
+// RotateJwtSigner 轮换任意算法签发密钥, 旧密钥签发的token在overlap秒内继续有效
+func (self *GRPCManager) RotateJwtSigner(key jwt.Key, overlap int64) error {
+	if len(key.Kid) == 0 {
+		return utils.Error("jwt kid is nil")
+	}
+	if err := jwtKeys.Rotate(key, overlap); err != nil {
+		return err
+	}
+	zlog.Info("grpc jwt key rotated", 0, zlog.String("kid", key.Kid), zlog.String("alg", key.Alg), zlog.Int64("overlap", overlap))
+	return nil
+}
+
+// verifyJwtToken 根据token头部kid选择密钥验签
+func verifyJwtToken(token string) error {
+	subject := &jwt.Subject{}
+	return subject.VerifyConfig(token, jwt.JwtConfig{Keys: jwtKeys}, false)
+}
@@ -0,0 +1,18 @@
+package rpcx
+
+import (
+	"github.com/godaddy-x/freego/promx"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const (
+	sideServer = "server"
+	sideClient = "client"
+)
+
+// 记录gRPC方法调用耗时及状态码
+func observe(side, method string, start time.Time, err error) {
+	service, name := splitMethod(method)
+	promx.ObserveGRPC(side, service, name, status.Code(err).String(), time.Since(start))
+}
@@ -0,0 +1,150 @@
+package rpcx
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultNacosGroup  = "DEFAULT_GROUP"
+	nacosTagsKey       = "tags"
+	nacosIdKey         = "id"
+	nacosBeatTimeout   = "preserved.heart.beat.timeout" // 心跳超时标记不健康/毫秒
+	nacosDeleteTimeout = "preserved.ip.delete.timeout"  // 心跳超时剔除实例/毫秒
+)
+
+// NacosRegistry 基于nacos的注册中心, 注册为临时实例, 由客户端心跳维持健康状态, 超过TTL未收到心跳自动剔除
+type NacosRegistry struct {
+	client naming_client.INamingClient
+	group  string
+	ttl    int64
+}
+
+func newNacosRegistry(conf RegistryConfig) (*NacosRegistry, error) {
+	serverConfigs := make([]constant.ServerConfig, 0, len(conf.Hosts))
+	for _, host := range conf.Hosts {
+		ip, port, err := net.SplitHostPort(host)
+		if err != nil {
+			return nil, err
+		}
+		p, err := strconv.ParseUint(port, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		serverConfigs = append(serverConfigs, constant.ServerConfig{IpAddr: ip, Port: p})
+	}
+	clientConfig := constant.ClientConfig{
+		NamespaceId:         conf.Namespace,
+		TimeoutMs:           uint64(conf.Timeout),
+		Username:            conf.Username,
+		Password:            conf.Password,
+		NotLoadCacheAtStart: true,
+		LogLevel:            "warn",
+	}
+	client, err := clients.NewNamingClient(vo.NacosClientParam{ClientConfig: &clientConfig, ServerConfigs: serverConfigs})
+	if err != nil {
+		return nil, err
+	}
+	group := conf.Group
+	if len(group) == 0 {
+		group = defaultNacosGroup
+	}
+	return &NacosRegistry{client: client, group: group, ttl: conf.TTL}, nil
+}
+
+// Client 获取nacos原生命名客户端
+func (self *NacosRegistry) Client() naming_client.INamingClient {
+	return self.client
+}
+
+func (self *NacosRegistry) Register(instance *ServiceInstance) error {
+	meta := make(map[string]string, len(instance.Meta)+4)
+	for k, v := range instance.Meta {
+		meta[k] = v
+	}
+	meta[nacosIdKey] = instance.ID
+	meta[nacosTagsKey] = strings.Join(instance.Tags, ",")
+	ttl := utils.AnyToStr(self.ttl * 1000)
+	meta[nacosBeatTimeout] = ttl
+	meta[nacosDeleteTimeout] = ttl
+	b, err := self.client.RegisterInstance(vo.RegisterInstanceParam{
+		Ip:          instance.Address,
+		Port:        uint64(instance.Port),
+		ServiceName: instance.Service,
+		GroupName:   self.group,
+		Weight:      1,
+		Enable:      true,
+		Healthy:     true,
+		Ephemeral:   true,
+		Metadata:    meta,
+	})
+	if err != nil {
+		return err
+	}
+	if !b {
+		return utils.Error("nacos service [", instance.Service, "] register failed")
+	}
+	return nil
+}
+
+func (self *NacosRegistry) Deregister(instance *ServiceInstance) error {
+	b, err := self.client.DeregisterInstance(vo.DeregisterInstanceParam{
+		Ip:          instance.Address,
+		Port:        uint64(instance.Port),
+		ServiceName: instance.Service,
+		GroupName:   self.group,
+		Ephemeral:   true,
+	})
+	if err != nil {
+		return err
+	}
+	if !b {
+		return utils.Error("nacos service [", instance.Service, "] deregister failed")
+	}
+	return nil
+}
+
+func (self *NacosRegistry) GetService(service, tag string) ([]*ServiceInstance, error) {
+	instances, err := self.client.SelectInstances(vo.SelectInstancesParam{
+		ServiceName: service,
+		GroupName:   self.group,
+		HealthyOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ServiceInstance, 0, len(instances))
+	for _, v := range instances {
+		var tags []string
+		if s := v.Metadata[nacosTagsKey]; len(s) > 0 {
+			tags = strings.Split(s, ",")
+		}
+		if !hasTag(tags, tag) {
+			continue
+		}
+		id := v.Metadata[nacosIdKey]
+		if len(id) == 0 {
+			id = v.InstanceId
+		}
+		result = append(result, &ServiceInstance{
+			ID:      id,
+			Service: service,
+			Address: v.Ip,
+			Port:    int(v.Port),
+			Tags:    tags,
+			Meta:    v.Metadata,
+		})
+	}
+	return result, nil
+}
+
+func (self *NacosRegistry) Close() error {
+	self.client.CloseClient()
+	return nil
+}
@@ -0,0 +1,78 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/otelx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC metadata trace上下文读写
+type metadataCarrier metadata.MD
+
+func (self metadataCarrier) Get(key string) string {
+	if v := metadata.MD(self).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (self metadataCarrier) Set(key, value string) {
+	metadata.MD(self).Set(key, value)
+}
+
+func (self metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(self))
+	for k := range self {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// 服务端提取上游trace上下文并创建span, 未启用链路追踪时span为nil
+func startServerSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	if !otelx.Enabled() {
+		return ctx, nil
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otelx.Extract(ctx, metadataCarrier(md))
+	}
+	service, name := splitMethod(method)
+	return otelx.Start(ctx, method, trace.SpanKindServer,
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", name),
+	)
+}
+
+// 客户端创建span并写入outgoing metadata透传至下游
+func startClientSpan(ctx context.Context, method, target string) (context.Context, trace.Span) {
+	if !otelx.Enabled() {
+		return ctx, nil
+	}
+	service, name := splitMethod(method)
+	ctx, span := otelx.Start(ctx, method, trace.SpanKindClient,
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", name),
+		attribute.String("net.peer.name", target),
+	)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otelx.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(status.Code(err))))
+	otelx.End(span, err)
+}
@@ -0,0 +1,234 @@
+package rpcx
+
+import (
+	"fmt"
+	DIC "github.com/godaddy-x/freego/common"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+)
+
+const (
+	REGISTRY_CONSUL = "consul"
+	REGISTRY_ETCD   = "etcd"
+	REGISTRY_NACOS  = "nacos"
+
+	defaultRegistryTTL     = 10   // 实例默认存活时间/秒
+	defaultRegistryTimeout = 5000 // 注册中心默认连接超时/毫秒
+)
+
+// ErrServiceExist 相同服务地址已注册, 注册由原实例维护, 本进程停机时不注销
+var ErrServiceExist = utils.Error("service instance exist")
+
+var (
+	registries  = make(map[string]*registryHolder)
+	registryMu  sync.RWMutex
+	registryKey = "registry.grpc."
+)
+
+// ServiceInstance 注册中心服务实例
+type ServiceInstance struct {
+	ID      string            `json:"id"`
+	Service string            `json:"service"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+}
+
+// Registry 服务注册中心
+type Registry interface {
+	// Register 注册服务实例并维持健康状态(健康检查/TTL续约), 直至注销或进程退出, 跳过已存在的注册时返回ErrServiceExist
+	Register(instance *ServiceInstance) error
+	// Deregister 注销服务实例
+	Deregister(instance *ServiceInstance) error
+	// GetService 获取服务可用实例, tag为空时不过滤
+	GetService(service, tag string) ([]*ServiceInstance, error)
+	// Close 关闭注册中心连接
+	Close() error
+}
+
+// RegistryConfig 注册中心配置参数, Type选择consul/etcd/nacos
+type RegistryConfig struct {
+	DsName       string   // 数据源名
+	Type         string   // 注册中心类型, consul/etcd/nacos, 默认consul
+	Hosts        []string // 注册中心地址, host:port
+	Username     string   // 认证用户名
+	Password     string   // 认证密码
+	Namespace    string   // etcd键前缀/nacos命名空间
+	Group        string   // nacos服务分组, 默认DEFAULT_GROUP
+	TTL          int64    // 实例存活时间/秒, 超时未续约自动剔除, 默认10s
+	Timeout      int      // 连接超时/毫秒, 默认5000
+	RpcPort      int      // RPC调用端口
+	Protocol     string   // RPC协议, tcp
+	CheckPort    int      // consul健康监测端口
+	CheckPath    string   // consul健康检测path /xxx/check
+	Interval     string   // consul健康监测时间, 5s
+	DestroyAfter string   // consul销毁服务时间, 为空时按TTL计算
+}
+
+type registryHolder struct {
+	registry Registry
+	config   RegistryConfig
+}
+
+func addRegistry(dsName string, registry Registry, config RegistryConfig) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if old, b := registries[dsName]; b && old.registry != registry {
+		if err := old.registry.Close(); err != nil {
+			zlog.Error("registry close failed", 0, zlog.String("ds", dsName), zlog.AddError(err))
+		}
+	}
+	registries[dsName] = &registryHolder{registry: registry, config: config}
+}
+
+func getRegistry(ds ...string) (*registryHolder, error) {
+	dsName := DIC.MASTER
+	if len(ds) > 0 && len(ds[0]) > 0 {
+		dsName = ds[0]
+	}
+	registryMu.RLock()
+	holder := registries[dsName]
+	registryMu.RUnlock()
+	if holder == nil {
+		return nil, utils.Error("registry [", dsName, "] not found...")
+	}
+	return holder, nil
+}
+
+// GetRegistry 获取已初始化的注册中心, ds为空使用默认数据源
+func GetRegistry(ds ...string) (Registry, error) {
+	holder, err := getRegistry(ds...)
+	if err != nil {
+		return nil, err
+	}
+	return holder.registry, nil
+}
+
+// InitRegistry 按配置类型初始化注册中心, consul配置同时可通过NewConsul获取
+func InitRegistry(input ...RegistryConfig) {
+	for _, conf := range input {
+		if len(conf.Hosts) == 0 {
+			panic("registry hosts is nil")
+		}
+		if len(conf.DsName) == 0 {
+			conf.DsName = DIC.MASTER
+		}
+		if conf.TTL <= 0 {
+			conf.TTL = defaultRegistryTTL
+		}
+		if conf.Timeout <= 0 {
+			conf.Timeout = defaultRegistryTimeout
+		}
+		if len(conf.Protocol) == 0 {
+			conf.Protocol = "tcp"
+		}
+		switch conf.Type {
+		case "", REGISTRY_CONSUL:
+			consulConfig := ConsulConfig{
+				DsName:       conf.DsName,
+				Host:         conf.Hosts[0],
+				CheckPort:    conf.CheckPort,
+				RpcPort:      conf.RpcPort,
+				Protocol:     conf.Protocol,
+				Timeout:      fmt.Sprintf("%dms", conf.Timeout),
+				Interval:     conf.Interval,
+				DestroyAfter: conf.DestroyAfter,
+				CheckPath:    conf.CheckPath,
+			}
+			if len(consulConfig.Interval) == 0 {
+				consulConfig.Interval = "5s"
+			}
+			if len(consulConfig.DestroyAfter) == 0 { // consul最小剔除时间为1分钟
+				destroy := conf.TTL
+				if destroy < 60 {
+					destroy = 60
+				}
+				consulConfig.DestroyAfter = fmt.Sprintf("%ds", destroy)
+			}
+			if _, err := new(ConsulManager).InitConfig(consulConfig); err != nil {
+				panic(err)
+			}
+			continue
+		case REGISTRY_ETCD:
+			registry, err := newEtcdRegistry(conf)
+			if err != nil {
+				panic(utils.AddStr("etcd registry [", conf.DsName, "] init failed: ", err))
+			}
+			addRegistry(conf.DsName, registry, conf)
+		case REGISTRY_NACOS:
+			registry, err := newNacosRegistry(conf)
+			if err != nil {
+				panic(utils.AddStr("nacos registry [", conf.DsName, "] init failed: ", err))
+			}
+			addRegistry(conf.DsName, registry, conf)
+		default:
+			panic(utils.AddStr("registry type [", conf.Type, "] not supported"))
+		}
+		zlog.Printf("%s registry %v【%s】has been started successful", conf.Type, conf.Hosts, conf.DsName)
+	}
+}
+
+// 按服务名/标签缓存可用实例, cacheSecond<=0时实时查询
+func getCacheService(ds string, registry Registry, service, tag string, cacheSecond int) ([]*ServiceInstance, error) {
+	if cacheSecond <= 0 {
+		return getAvailableService(registry, service, tag)
+	}
+	key := utils.AddStr(registryKey, ds, ".", service, ".", tag)
+	cvl, has, err := localCache.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if has && cvl != nil {
+		return cvl.([]*ServiceInstance), nil
+	}
+	instances, err := getAvailableService(registry, service, tag)
+	if err != nil {
+		return nil, err
+	}
+	if err := localCache.Put(key, instances, cacheSecond); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func getAvailableService(registry Registry, service, tag string) ([]*ServiceInstance, error) {
+	instances, err := registry.GetService(service, tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, utils.Error("no available services found: [", service, "]")
+	}
+	return instances, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	if len(tag) == 0 {
+		return true
+	}
+	for _, v := range tags {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// CloseRegistry 关闭全部注册中心连接, 返回数据源名称对应的关闭结果
+func CloseRegistry() map[string]error {
+	registryMu.Lock()
+	holders := registries
+	registries = make(map[string]*registryHolder)
+	registryMu.Unlock()
+	result := make(map[string]error, len(holders))
+	for k, v := range holders {
+		if err := v.registry.Close(); err != nil {
+			result[k] = utils.Error("registry [", k, "] close failed: ", err)
+			continue
+		}
+		result[k] = nil
+	}
+	return result
+}
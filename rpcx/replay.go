@@ -0,0 +1,121 @@
+package rpcx
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/utils/jwt"
+	"github.com/godaddy-x/freego/zlog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"strconv"
+	"strings"
+)
+
+// 防重放校验, 客户端拦截器为每次调用附加x-nonce、x-timestamp及x-signature, 服务端开启SetReplayGuard后校验签名、时间戳并拒绝重复nonce
+// 签名为HMAC-SHA256(nonce+timestamp+method+请求体摘要), 密钥由token及应用AppKey派生, 服务端按token主体(AppId)通过AppConfigCall获取AppKey
+// 流式调用建立时请求体摘要为空, 未携带token的调用(服务端未开启认证)仅校验nonce及时间戳
+// 免认证方法(Authorize/健康检查)不校验元数据, Authorize请求体中的nonce由CheckReplay校验
+
+const (
+	replayNonce     = "x-nonce"
+	replayTimestamp = "x-timestamp"
+	replaySign      = "x-signature"
+)
+
+var (
+	replayGuard *cache.ReplayGuard
+	// 客户端签名密钥, 随accessToken更新
+	accessSecret = ""
+
+	ErrReplaySign = errors.New("replay signature invalid")
+)
+
+// SetReplayGuard 开启服务端防重放校验, 需在RunServer/RunOnlyServer前调用
+func SetReplayGuard(config cache.ReplayConfig) {
+	replayGuard = cache.NewReplayGuard(config)
+	zlog.Printf("grpc replay guard has been started successful")
+}
+
+// CheckReplay 校验nonce及时间戳/秒, 未开启防重放时直接通过
+func CheckReplay(nonce string, timestamp int64) error {
+	if replayGuard == nil {
+		return nil
+	}
+	return replayGuard.Check("grpc", nonce, timestamp)
+}
+
+// token签名密钥, 客户端及服务端均可由token及AppKey计算
+func replaySecret(token, appKey string) string {
+	return utils.HMAC_SHA256(token, appKey, true)
+}
+
+func replaySignature(secret, nonce string, timestamp int64, method string, req interface{}) string {
+	var digest string
+	if msg, b := req.(proto.Message); b {
+		if bs, err := (proto.MarshalOptions{Deterministic: true}).Marshal(msg); err == nil {
+			digest = utils.SHA256(utils.Bytes2Str(bs), true)
+		}
+	}
+	return utils.HMAC_SHA256(utils.AddStr(nonce, timestamp, method, digest), secret, true)
+}
+
+// 服务端按token主体获取AppKey并计算签名密钥
+func tokenReplaySecret(tok string) (string, error) {
+	part := strings.Split(tok, ".")
+	if len(part) != 3 {
+		return "", ErrReplaySign
+	}
+	payload := &jwt.Payload{}
+	if err := utils.ParseJsonBase64(part[1], payload); err != nil || len(payload.Sub) == 0 {
+		return "", ErrReplaySign
+	}
+	appConfig, err := GetGRPCAppConfig(payload.Sub)
+	if err != nil {
+		return "", err
+	}
+	if len(appConfig.AppKey) == 0 {
+		return "", ErrReplaySign
+	}
+	return replaySecret(tok, appConfig.AppKey), nil
+}
+
+func withReplayNonce(ctx context.Context, method string, req interface{}) context.Context {
+	nonce, timestamp := utils.RandNonce(), utils.UnixSecond()
+	pairs := []string{replayNonce, nonce, replayTimestamp, strconv.FormatInt(timestamp, 10)}
+	if secret := accessSecret; len(secret) > 0 && !utils.CheckStr(method, unauthorizedUrl...) {
+		pairs = append(pairs, replaySign, replaySignature(secret, nonce, timestamp, method, req))
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// 先校验签名再写入nonce, 伪造请求不占用nonce
+func checkReplay(ctx context.Context, method string, req interface{}) error {
+	if replayGuard == nil || utils.CheckStr(method, unauthorizedUrl...) {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var nonce, sign string
+	var timestamp int64
+	if v := md.Get(replayNonce); len(v) > 0 {
+		nonce = v[0]
+	}
+	if v := md.Get(replayTimestamp); len(v) > 0 {
+		timestamp, _ = strconv.ParseInt(v[0], 10, 64)
+	}
+	if v := md.Get(replaySign); len(v) > 0 {
+		sign = v[0]
+	}
+	if v := md.Get(token); len(v) > 0 {
+		secret, err := tokenReplaySecret(v[0])
+		if err != nil {
+			return err
+		}
+		if len(sign) == 0 || !hmac.Equal(utils.Str2Bytes(sign), utils.Str2Bytes(replaySignature(secret, nonce, timestamp, method, req))) {
+			return ErrReplaySign
+		}
+	}
+	return replayGuard.Check("grpc", nonce, timestamp)
+}
@@ -0,0 +1,176 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const shadowKey = "shadow"
+
+var shadowTraffic = &ShadowTraffic{stats: make(map[string]*shadowStat)}
+
+// ShadowConfig 影子流量配置, 按比例将请求异步复制到新版本服务, 响应结果丢弃
+type ShadowConfig struct {
+	Method  string // 完整方法名或服务前缀, 例: /pub_worker.PubWorker/ 为空则匹配所有方法
+	Address string // 影子服务地址 host:port
+	Percent int    // 复制比例 1-100
+	Timeout int    // 影子请求超时/毫秒, 默认3000
+}
+
+// ShadowStat 主调用与影子调用的耗时/错误对比
+type ShadowStat struct {
+	Method        string
+	Address       string
+	Total         int64 // 影子调用总数
+	PrimaryCost   int64 // 主调用累计耗时/毫秒
+	ShadowCost    int64 // 影子调用累计耗时/毫秒
+	PrimaryErrors int64 // 主调用失败数
+	ShadowErrors  int64 // 影子调用失败数
+	Mismatch      int64 // 主调用与影子调用成功/失败结果不一致数
+}
+
+type shadowStat struct {
+	total         int64
+	primaryCost   int64
+	shadowCost    int64
+	primaryErrors int64
+	shadowErrors  int64
+	mismatch      int64
+}
+
+type ShadowTraffic struct {
+	mu      sync.RWMutex
+	configs []ShadowConfig
+	stats   map[string]*shadowStat
+}
+
+// CreateShadowTraffic 设置影子流量规则, 按配置顺序匹配第一条
+func (self *GRPCManager) CreateShadowTraffic(configs ...ShadowConfig) {
+	for i, v := range configs {
+		if len(v.Address) == 0 {
+			panic("shadow address is nil")
+		}
+		if v.Percent <= 0 || v.Percent > 100 {
+			panic("shadow percent invalid [1-100]")
+		}
+		if v.Timeout <= 0 {
+			configs[i].Timeout = 3000
+		}
+	}
+	shadowTraffic.mu.Lock()
+	shadowTraffic.configs = configs
+	shadowTraffic.mu.Unlock()
+}
+
+// GetShadowStats 获取影子流量对比统计
+func GetShadowStats() []ShadowStat {
+	shadowTraffic.mu.RLock()
+	defer shadowTraffic.mu.RUnlock()
+	result := make([]ShadowStat, 0, len(shadowTraffic.stats))
+	for k, v := range shadowTraffic.stats {
+		part := strings.SplitN(k, "|", 2)
+		result = append(result, ShadowStat{
+			Address:       part[0],
+			Method:        part[1],
+			Total:         atomic.LoadInt64(&v.total),
+			PrimaryCost:   atomic.LoadInt64(&v.primaryCost),
+			ShadowCost:    atomic.LoadInt64(&v.shadowCost),
+			PrimaryErrors: atomic.LoadInt64(&v.primaryErrors),
+			ShadowErrors:  atomic.LoadInt64(&v.shadowErrors),
+			Mismatch:      atomic.LoadInt64(&v.mismatch),
+		})
+	}
+	return result
+}
+
+func (self *ShadowTraffic) match(method string) (ShadowConfig, bool) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for _, v := range self.configs {
+		if len(v.Method) == 0 || strings.HasPrefix(method, v.Method) {
+			return v, utils.ModRand(100) < v.Percent
+		}
+	}
+	return ShadowConfig{}, false
+}
+
+func (self *ShadowTraffic) getStat(key string) *shadowStat {
+	self.mu.RLock()
+	stat, b := self.stats[key]
+	self.mu.RUnlock()
+	if b {
+		return stat
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if stat, b = self.stats[key]; !b {
+		stat = &shadowStat{}
+		self.stats[key] = stat
+	}
+	return stat
+}
+
+func (self *ShadowTraffic) mirror(ctx context.Context, config ShadowConfig, method string, req, reply proto.Message, primaryCost int64, primaryErr error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(shadowKey, "1")
+	req = proto.Clone(req)
+	go func() {
+		stat := self.getStat(utils.AddStr(config.Address, "|", method))
+		conn, err := clientConnPools.getClientConn(config.Address, config.Timeout)
+		if err != nil {
+			zlog.Error("grpc shadow conn failed", 0, zlog.String("address", config.Address), zlog.AddError(err))
+			return
+		}
+		defer conn.Close()
+		start := utils.UnixMilli()
+		shadowCtx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), time.Duration(config.Timeout)*time.Millisecond)
+		defer cancel()
+		err = conn.Value().Invoke(shadowCtx, method, req, reply.ProtoReflect().New().Interface())
+		atomic.AddInt64(&stat.total, 1)
+		atomic.AddInt64(&stat.primaryCost, primaryCost)
+		atomic.AddInt64(&stat.shadowCost, utils.UnixMilli()-start)
+		if primaryErr != nil {
+			atomic.AddInt64(&stat.primaryErrors, 1)
+		}
+		if err != nil {
+			atomic.AddInt64(&stat.shadowErrors, 1)
+		}
+		if (err == nil) != (primaryErr == nil) {
+			atomic.AddInt64(&stat.mismatch, 1)
+			zlog.Warn("grpc shadow result mismatch", start, zlog.String("address", config.Address), zlog.String("service", method), zlog.AddError(primaryErr, err))
+		}
+	}()
+}
+
+func isShadowCall(ctx context.Context) bool {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	return ok && len(md.Get(shadowKey)) > 0
+}
+
+// ShadowClientInterceptor 按配置比例异步复制请求到影子服务, 不影响主调用结果
+func ShadowClientInterceptor(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if isShadowCall(ctx) {
+		return invoker(ctx, method, req, reply, conn, opts...)
+	}
+	config, ok := shadowTraffic.match(method)
+	if !ok {
+		return invoker(ctx, method, req, reply, conn, opts...)
+	}
+	start := utils.UnixMilli()
+	err := invoker(ctx, method, req, reply, conn, opts...)
+	reqMsg, b1 := req.(proto.Message)
+	replyMsg, b2 := reply.(proto.Message)
+	if b1 && b2 {
+		shadowTraffic.mirror(ctx, config, method, reqMsg, replyMsg, utils.UnixMilli()-start, err)
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+type registration struct {
+	registry Registry
+	instance *ServiceInstance
+}
+
+var (
+	grpcServers   []*grpc.Server
+	registrations []registration
+	serverMu      sync.Mutex
+)
+
+func addGRPCServer(server *grpc.Server) {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	grpcServers = append(grpcServers, server)
+}
+
+func addRegistration(registry Registry, instance *ServiceInstance) {
+	serverMu.Lock()
+	defer serverMu.Unlock()
+	registrations = append(registrations, registration{registry: registry, instance: instance})
+}
+
+// Shutdown 从注册中心注销服务并优雅停止全部grpc服务, 等待处理中请求完成, ctx超时后强制关闭连接
+func Shutdown(ctx context.Context) error {
+	shutdownHealth() // 健康检查先置为不可用, 探针及负载均衡停止转发
+	serverMu.Lock()
+	servers, regs := grpcServers, registrations
+	grpcServers, registrations = nil, nil
+	serverMu.Unlock()
+	var errs []error
+	for _, v := range regs { // 先注销服务, 避免客户端继续发现本节点
+		if err := v.registry.Deregister(v.instance); err != nil {
+			errs = append(errs, utils.Error("[GRPC.Shutdown] registry deregister failed: ", v.instance.ID, " ", err))
+			continue
+		}
+		zlog.Println("remove grpc service successful: ", v.instance.Service, " - ", v.instance.ID)
+	}
+	for _, server := range servers {
+		done := make(chan struct{})
+		go func(server *grpc.Server) {
+			server.GracefulStop()
+			close(done)
+		}(server)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			server.Stop()
+			errs = append(errs, utils.Error("[GRPC.Shutdown] graceful stop timeout: ", ctx.Err()))
+		}
+	}
+	if len(errs) > 0 {
+		return &utils.MultiError{Errors: errs}
+	}
+	zlog.Println("grpc server has been shutdown successful")
+	return nil
+}
@@ -0,0 +1,173 @@
+package rpcx
+
+import (
+	"context"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	traceId       = "trace-id"
+	spanId        = "span-id"
+	metricsPrefix = "rpc_client"
+)
+
+var callMetrics = &CallMetrics{stats: make(map[string]*callStat)}
+
+// CallStat 下游依赖调用统计, Name格式: rpc_client.{service}.{method}
+type CallStat struct {
+	Name    string // 指标名称
+	Target  string // 下游服务地址
+	Service string // 下游服务名
+	Method  string // 下游方法名
+	Total   int64  // 调用总数
+	Errors  int64  // 失败总数
+	Cost    int64  // 累计耗时/毫秒
+	MaxCost int64  // 最大耗时/毫秒
+}
+
+type callStat struct {
+	total   int64
+	errors  int64
+	cost    int64
+	maxCost int64
+}
+
+// CallMetrics 按target+method维度聚合的下游调用指标
+type CallMetrics struct {
+	mu    sync.RWMutex
+	stats map[string]*callStat
+}
+
+func (self *CallMetrics) get(key string) *callStat {
+	self.mu.RLock()
+	stat, b := self.stats[key]
+	self.mu.RUnlock()
+	if b {
+		return stat
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if stat, b = self.stats[key]; !b {
+		stat = &callStat{}
+		self.stats[key] = stat
+	}
+	return stat
+}
+
+func (self *CallMetrics) record(target, method string, cost int64, err error) {
+	stat := self.get(utils.AddStr(target, "|", method))
+	atomic.AddInt64(&stat.total, 1)
+	atomic.AddInt64(&stat.cost, cost)
+	if err != nil {
+		atomic.AddInt64(&stat.errors, 1)
+	}
+	for {
+		max := atomic.LoadInt64(&stat.maxCost)
+		if cost <= max || atomic.CompareAndSwapInt64(&stat.maxCost, max, cost) {
+			break
+		}
+	}
+}
+
+// Snapshot 获取当前所有下游调用统计
+func (self *CallMetrics) Snapshot() []CallStat {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	result := make([]CallStat, 0, len(self.stats))
+	for k, v := range self.stats {
+		part := strings.SplitN(k, "|", 2)
+		service, method := splitMethod(part[1])
+		result = append(result, CallStat{
+			Name:    utils.AddStr(metricsPrefix, ".", service, ".", method),
+			Target:  part[0],
+			Service: service,
+			Method:  method,
+			Total:   atomic.LoadInt64(&v.total),
+			Errors:  atomic.LoadInt64(&v.errors),
+			Cost:    atomic.LoadInt64(&v.cost),
+			MaxCost: atomic.LoadInt64(&v.maxCost),
+		})
+	}
+	return result
+}
+
+// GetCallMetrics 获取下游调用统计
+func GetCallMetrics() []CallStat {
+	return callMetrics.Snapshot()
+}
+
+// splitMethod /pub_worker.PubWorker/GenerateId => pub_worker.PubWorker, GenerateId
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if index := strings.LastIndex(fullMethod, "/"); index >= 0 {
+		return fullMethod[:index], fullMethod[index+1:]
+	}
+	return "unknown", fullMethod
+}
+
+// withTraceContext 透传或生成trace-id, 每次调用生成新的span-id
+func withTraceContext(ctx context.Context) (context.Context, string, string) {
+	var trace string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(traceId); len(v) > 0 {
+			trace = v[0]
+		}
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(trace) == 0 {
+		if v := md.Get(traceId); len(v) > 0 {
+			trace = v[0]
+		}
+	}
+	if len(trace) == 0 {
+		trace, _ = zlog.TraceFromContext(ctx)
+	}
+	if len(trace) == 0 {
+		trace = utils.NextSID()
+	}
+	span := utils.NextSID()
+	return metadata.AppendToOutgoingContext(ctx, traceId, trace, spanId, span), trace, span
+}
+
+// withIncomingTrace 服务端读取上游透传的trace-id/span-id, 写入zlog上下文
+func withIncomingTrace(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	var trace, span string
+	if v := md.Get(traceId); len(v) > 0 {
+		trace = v[0]
+	}
+	if v := md.Get(spanId); len(v) > 0 {
+		span = v[0]
+	}
+	if len(trace) == 0 {
+		return ctx
+	}
+	return zlog.WithTrace(ctx, trace, span)
+}
+
+// TraceClientInterceptor 记录下游调用耗时/错误指标并透传trace上下文
+func TraceClientInterceptor(ctx context.Context, method string, req, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, trace, span := withTraceContext(ctx)
+	ctx = zlog.WithTrace(ctx, trace, span)
+	ctx, otelSpan := startClientSpan(ctx, method, conn.Target())
+	begin := time.Now()
+	start := utils.UnixMilli()
+	err := invoker(ctx, method, req, reply, conn, opts...)
+	endSpan(otelSpan, err)
+	observe(sideClient, method, begin, err)
+	cost := utils.UnixMilli() - start
+	callMetrics.record(conn.Target(), method, cost, err)
+	if zlog.IsDebug() {
+		zlog.DebugCtx(ctx, "grpc call span", start, zlog.String("target", conn.Target()), zlog.String("service", method), zlog.AddError(err))
+	}
+	return err
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -9,6 +11,7 @@ import (
 	"fmt"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/utils/crypto"
+	"github.com/godaddy-x/freego/utils/jwt"
 	"testing"
 )
 
@@ -166,3 +169,48 @@ func TestRsaSignAndVerify(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestJwtKeySetRotate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	keys := jwt.NewKeySet()
+	if err := keys.Add(jwt.Key{Kid: "rsa1", Alg: jwt.RS256, PrivateKey: rsaKey}, true); err != nil {
+		panic(err)
+	}
+	config := jwt.JwtConfig{TokenTyp: jwt.JWT, TokenExp: 3600, Keys: keys}
+	subject := &jwt.Subject{}
+	token1 := subject.Create(utils.NextSID()).Dev("APP").Iss("auth").Aud("order").Generate(config)
+	if err := keys.Rotate(jwt.Key{Kid: "ec1", Alg: jwt.ES256, PrivateKey: ecKey}, 300); err != nil {
+		panic(err)
+	}
+	subject = &jwt.Subject{}
+	token2 := subject.Create(utils.NextSID()).Dev("APP").Iss("auth").Aud("order").Generate(config)
+	data, err := keys.JWKS()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("JWKS: ", string(data))
+	remote := jwt.NewKeySet()
+	if err := remote.LoadJWKS(jwt.RemoteIssuer{Issuer: "auth", Audience: "order"}, data); err != nil {
+		panic(err)
+	}
+	for _, v := range []string{token1, token2} {
+		if err := (&jwt.Subject{}).VerifyConfig(v, jwt.JwtConfig{Keys: remote}, true); err != nil {
+			panic(err)
+		}
+		fmt.Println("token kid: ", jwt.GetTokenKid(v), " verify ok")
+	}
+	other := jwt.NewKeySet()
+	if err := other.LoadJWKS(jwt.RemoteIssuer{Issuer: "auth", Audience: "user"}, data); err != nil {
+		panic(err)
+	}
+	if err := (&jwt.Subject{}).VerifyConfig(token1, jwt.JwtConfig{Keys: other}, true); err == nil {
+		panic("token for other audience should be rejected")
+	}
+}
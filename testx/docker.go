@@ -0,0 +1,102 @@
+package testx
+
+import (
+	"bytes"
+	"github.com/godaddy-x/freego/utils"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Docker容器管理, 通过docker命令行启动容器, 端口映射到127.0.0.1随机端口
+// 容器使用--rm启动并标记freego.testx标签, 测试进程异常退出时可通过 docker rm -f $(docker ps -q -f label=freego.testx) 清理
+
+type container struct {
+	id    string
+	image string
+	host  string
+	port  int
+}
+
+var (
+	dockerOnce sync.Once
+	dockerOk   bool
+)
+
+// Docker是否可用, FREEGO_TEST_DOCKER=false时禁用
+func dockerAvailable() bool {
+	dockerOnce.Do(func() {
+		if v := os.Getenv(envDocker); len(v) > 0 && !envBool(envDocker) {
+			return
+		}
+		if _, err := exec.LookPath("docker"); err != nil {
+			return
+		}
+		_, err := docker("info", "--format", "{{.ServerVersion}}")
+		dockerOk = err == nil
+	})
+	return dockerOk
+}
+
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", utils.Error("docker ", args[0], " failed: ", err, " ", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// 启动容器并映射端口, env为KEY=VALUE, cmd为容器启动参数
+func runContainer(image, port string, env []string, cmd ...string) (*container, error) {
+	args := []string{"run", "-d", "--rm", "--label", "freego.testx=" + strconv.Itoa(os.Getpid()), "-p", "127.0.0.1::" + port}
+	for _, v := range env {
+		args = append(args, "-e", v)
+	}
+	args = append(args, image)
+	args = append(args, cmd...)
+	id, err := docker(args...)
+	if err != nil {
+		return nil, err
+	}
+	c := &container{id: id, image: image}
+	out, err := docker("port", id, port+"/tcp")
+	if err != nil {
+		return c, err
+	}
+	// 输出如 127.0.0.1:49153, 多行时取第一行
+	addr := strings.SplitN(out, "\n", 2)[0]
+	host, p, err := net.SplitHostPort(strings.TrimSpace(addr))
+	if err != nil {
+		return c, utils.Error("docker port [", out, "] invalid: ", err)
+	}
+	if c.port, err = strconv.Atoi(p); err != nil {
+		return c, utils.Error("docker port [", out, "] invalid: ", err)
+	}
+	c.host = host
+	return c, nil
+}
+
+func (self *container) addr() string {
+	return net.JoinHostPort(self.host, strconv.Itoa(self.port))
+}
+
+// 容器日志, 启动失败时用于排查
+func (self *container) logs() string {
+	out, err := docker("logs", "--tail", "50", self.id)
+	if err != nil {
+		return err.Error()
+	}
+	return out
+}
+
+func (self *container) remove() error {
+	if _, err := docker("rm", "-f", "-v", self.id); err != nil {
+		return utils.Error("remove container [", self.image, "] failed: ", err)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package testx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/go-sql-driver/mysql"
+	"github.com/godaddy-x/freego/amqp"
+	"github.com/godaddy-x/freego/cache"
+	"github.com/godaddy-x/freego/ormx/sqld"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 各服务启动, 优先使用环境变量地址, 未设置时启动容器, 就绪后初始化框架默认数据源
+
+const testPassword = "123456"
+
+var (
+	mysqlConf  sqld.MysqlConfig
+	mongoConf  sqld.MGOConfig
+	redisConf  cache.RedisConfig
+	rabbitConf rabbitmq.AmqpConfig
+)
+
+// MySQL 获取MySQL测试服务并初始化默认数据源, 首次调用时执行迁移脚本及表结构同步
+func MySQL(tb testing.TB) sqld.MysqlConfig {
+	tb.Helper()
+	mysqlSvc.start(tb, "mysql", startMySQL)
+	return mysqlConf
+}
+
+// Mongo 获取MongoDB测试服务并初始化默认数据源
+func Mongo(tb testing.TB) sqld.MGOConfig {
+	tb.Helper()
+	mongoSvc.start(tb, "mongo", startMongo)
+	return mongoConf
+}
+
+// Redis 获取Redis测试服务并初始化默认数据源
+func Redis(tb testing.TB) cache.RedisConfig {
+	tb.Helper()
+	redisSvc.start(tb, "redis", startRedis)
+	return redisConf
+}
+
+// RabbitMQ 获取RabbitMQ测试服务并初始化默认发布/消费数据源
+func RabbitMQ(tb testing.TB) rabbitmq.AmqpConfig {
+	tb.Helper()
+	rabbitMQ.start(tb, "rabbitmq", startRabbitMQ)
+	return rabbitConf
+}
+
+// Truncate 清空MySQL表数据, 用于测试间隔离, 已有服务的库名需包含test或开启FREEGO_TEST_WIPE
+func Truncate(tb testing.TB, tables ...string) {
+	tb.Helper()
+	MySQL(tb)
+	if !mysqlSvc.wipeable(mysqlConf.Database) {
+		tb.Fatalf("mysql database [%s] is not a test target, set %s=true to truncate", mysqlConf.Database, envWipe)
+	}
+	db, err := sqld.NewMysql(sqld.Option{Timeout: 30000})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer db.Close()
+	for _, v := range tables {
+		if _, err := db.Db.Exec("TRUNCATE TABLE `" + v + "`"); err != nil {
+			tb.Fatalf("truncate table [%s] failed: %v", v, err)
+		}
+	}
+}
+
+// FlushRedis 清空Redis当前库数据, 用于测试间隔离, 已有服务需开启FREEGO_TEST_WIPE
+func FlushRedis(tb testing.TB) {
+	tb.Helper()
+	conf := Redis(tb)
+	if !redisSvc.wipeable("") {
+		tb.Fatalf("redis [%s:%d] is not a test target, set %s=true to flush", conf.Host, conf.Port, envWipe)
+	}
+	conn, err := dialRedis(conf)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Do("FLUSHDB"); err != nil {
+		tb.Fatal("redis flushdb failed: ", err)
+	}
+}
+
+func startMySQL() (*container, error) {
+	config := getConfig()
+	var c *container
+	if dsn := os.Getenv(envMySQL); len(dsn) > 0 {
+		dc, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, utils.Error(envMySQL, " invalid: ", err)
+		}
+		host, port, err := splitAddr(dc.Addr, 3306)
+		if err != nil {
+			return nil, err
+		}
+		mysqlConf.Host, mysqlConf.Port, mysqlConf.Username, mysqlConf.Password = host, port, dc.User, dc.Passwd
+		mysqlConf.Database = config.Database
+		if len(dc.DBName) > 0 {
+			mysqlConf.Database = dc.DBName
+		}
+	} else if dockerAvailable() {
+		var err error
+		c, err = runContainer(config.MySQLImage, "3306", []string{"MYSQL_ROOT_PASSWORD=" + testPassword, "MYSQL_DATABASE=" + config.Database},
+			"--character-set-server=utf8mb4", "--collation-server=utf8mb4_general_ci")
+		if err != nil {
+			return c, err
+		}
+		mysqlConf.Host, mysqlConf.Port, mysqlConf.Username, mysqlConf.Password = c.host, c.port, "root", testPassword
+		mysqlConf.Database = config.Database
+	} else {
+		return nil, errUnavailable
+	}
+	mysqlConf.MaxIdleConns, mysqlConf.MaxOpenConns, mysqlConf.ConnMaxLifetime = 10, 50, 60
+	// 不指定数据库连接, 就绪后创建数据库并执行迁移脚本
+	link := fmt.Sprintf("%s:%s@tcp(%s)/?charset=utf8mb4&multiStatements=true", mysqlConf.Username, mysqlConf.Password, net.JoinHostPort(mysqlConf.Host, strconv.Itoa(mysqlConf.Port)))
+	db, err := sql.Open("mysql", link)
+	if err != nil {
+		return c, err
+	}
+	defer db.Close()
+	if err := wait(config.Timeout, db.Ping); err != nil {
+		return c, withLogs(c, err)
+	}
+	if _, err := db.Exec("CREATE DATABASE IF NOT EXISTS `" + mysqlConf.Database + "` DEFAULT CHARACTER SET utf8mb4"); err != nil {
+		return c, err
+	}
+	if len(config.Migrations) > 0 {
+		if err := migrate(db, config.Migrations); err != nil {
+			return c, err
+		}
+	}
+	if err := new(sqld.MysqlManager).InitConfigAndCache(config.Cache, mysqlConf); err != nil {
+		return c, err
+	}
+	if config.SyncSchema {
+		if _, err := sqld.SyncSchema(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// 按文件名顺序执行目录下*.sql迁移脚本, 单个文件可包含多条语句
+func migrate(db *sql.DB, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	conn, err := db.Conn(context.Background()) // USE仅对当前连接生效
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), "USE `"+mysqlConf.Database+"`"); err != nil {
+		return err
+	}
+	for _, v := range files {
+		data, err := os.ReadFile(v)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(context.Background(), string(data)); err != nil {
+			return utils.Error("migration [", filepath.Base(v), "] execute failed: ", err)
+		}
+	}
+	return nil
+}
+
+func startMongo() (*container, error) {
+	config := getConfig()
+	var c *container
+	mongoConf.Database = config.Database
+	if uri := os.Getenv(envMongo); len(uri) > 0 {
+		mongoConf.ConnectionURI = uri
+	} else if dockerAvailable() {
+		var err error
+		if c, err = runContainer(config.MongoImage, "27017", nil); err != nil {
+			return c, err
+		}
+		mongoConf.Addrs = []string{c.addr()}
+		mongoConf.ConnectionURI = "mongodb://" + c.addr()
+	} else {
+		return nil, errUnavailable
+	}
+	mongoConf.Direct, mongoConf.ConnectTimeout, mongoConf.SocketTimeout, mongoConf.PoolLimit = true, 10, 30, 100
+	// MGOManager连接失败会panic, 先确认服务就绪
+	err := wait(config.Timeout, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoConf.ConnectionURI).SetDirect(true))
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect(context.Background())
+		return client.Ping(ctx, readpref.Primary())
+	})
+	if err != nil {
+		return c, withLogs(c, err)
+	}
+	if err := new(sqld.MGOManager).InitConfigAndCache(config.Cache, mongoConf); err != nil {
+		return c, err
+	}
+	if config.MongoIndex {
+		if err := sqld.RebuildMongoDBIndex(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func startRedis() (*container, error) {
+	config := getConfig()
+	var c *container
+	if addr := os.Getenv(envRedis); len(addr) > 0 {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, utils.Error(envRedis, " invalid: ", err)
+		}
+		host, port, err := splitAddr(u.Host, 6379)
+		if err != nil {
+			return nil, err
+		}
+		redisConf.Host, redisConf.Port = host, port
+		if u.User != nil {
+			redisConf.Password, _ = u.User.Password()
+		}
+	} else if dockerAvailable() {
+		var err error
+		if c, err = runContainer(config.RedisImage, "6379", nil); err != nil {
+			return c, err
+		}
+		redisConf.Host, redisConf.Port = c.host, c.port
+	} else {
+		return nil, errUnavailable
+	}
+	redisConf.Network, redisConf.MaxIdle, redisConf.MaxActive, redisConf.IdleTimeout = "tcp", 16, 64, 60
+	err := wait(config.Timeout, func() error {
+		conn, err := dialRedis(redisConf)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Do("PING")
+		return err
+	})
+	if err != nil {
+		return c, withLogs(c, err)
+	}
+	if _, err := new(cache.RedisManager).InitConfig(redisConf); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func dialRedis(conf cache.RedisConfig) (redis.Conn, error) {
+	return redis.Dial("tcp", net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port)),
+		redis.DialPassword(conf.Password), redis.DialConnectTimeout(5*time.Second))
+}
+
+func startRabbitMQ() (*container, error) {
+	config := getConfig()
+	var c *container
+	if addr := os.Getenv(envRabbitMQ); len(addr) > 0 {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, utils.Error(envRabbitMQ, " invalid: ", err)
+		}
+		host, port, err := splitAddr(u.Host, 5672)
+		if err != nil {
+			return nil, err
+		}
+		rabbitConf.Host, rabbitConf.Port = host, port
+		if u.User != nil {
+			rabbitConf.Username = u.User.Username()
+			rabbitConf.Password, _ = u.User.Password()
+		}
+	} else if dockerAvailable() {
+		// guest账号仅允许本机连接, 容器端口映射后需使用其他账号
+		var err error
+		if c, err = runContainer(config.RabbitMQImage, "5672", []string{"RABBITMQ_DEFAULT_USER=admin", "RABBITMQ_DEFAULT_PASS=" + testPassword}); err != nil {
+			return c, err
+		}
+		rabbitConf.Host, rabbitConf.Port, rabbitConf.Username, rabbitConf.Password = c.host, c.port, "admin", testPassword
+	} else {
+		return nil, errUnavailable
+	}
+	err := wait(config.Timeout, func() error {
+		conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s/", url.QueryEscape(rabbitConf.Username), url.QueryEscape(rabbitConf.Password), net.JoinHostPort(rabbitConf.Host, strconv.Itoa(rabbitConf.Port))))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+	if err != nil {
+		return c, withLogs(c, err)
+	}
+	if _, err := new(rabbitmq.PublishManager).InitConfig(rabbitConf); err != nil {
+		return c, err
+	}
+	if _, err := new(rabbitmq.PullManager).InitConfig(rabbitConf); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func splitAddr(addr string, defPort int) (string, int, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil { // 未指定端口
+		return addr, defPort, nil
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", 0, utils.Error("address [", addr, "] port invalid")
+	}
+	return host, port, nil
+}
+
+// 就绪超时附加容器日志
+func withLogs(c *container, err error) error {
+	if c == nil {
+		return err
+	}
+	return utils.Error(err, "\n", c.logs())
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = 0 // 关闭: 正常放行
+	BreakerOpen     = 1 // 开启: 拒绝全部请求
+	BreakerHalfOpen = 2 // 半开: 放行少量探测请求
+)
+
+// ErrBreakerOpen 熔断开启或半开探测数已满时拒绝请求
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig 熔断配置, 滑动窗口内失败率超过阈值时熔断, 熔断时长结束后进入半开状态探测
+type BreakerConfig struct {
+	Window           time.Duration                   // 统计窗口, 默认10s
+	Buckets          int                             // 窗口分桶数, 默认10
+	MinRequests      int64                           // 窗口内最少请求数, 不足时不熔断, 默认20
+	FailureRate      float64                         // 失败率阈值(0, 1], 默认0.5
+	OpenTimeout      time.Duration                   // 熔断持续时间, 默认5s
+	HalfOpenRequests int64                           // 半开状态探测请求数, 全部成功后关闭熔断, 默认1
+	IsFailure        func(err error) bool            // 判断错误是否计入失败, 为空则全部计入
+	OnStateChange    func(name string, from, to int) // 状态变更回调
+}
+
+type breakerBucket struct {
+	index   int64
+	total   int64
+	failure int64
+}
+
+// CircuitBreaker 基于失败率的熔断器
+type CircuitBreaker struct {
+	name     string
+	config   BreakerConfig
+	mu       sync.Mutex
+	state    int
+	openedAt time.Time
+	probes   int64 // 半开状态已放行探测数
+	passed   int64 // 半开状态探测成功数
+	buckets  []breakerBucket
+}
+
+// NewCircuitBreaker 创建熔断器, name用于状态变更回调区分
+func NewCircuitBreaker(name string, config BreakerConfig) *CircuitBreaker {
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.Buckets <= 0 {
+		config.Buckets = 10
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.FailureRate <= 0 || config.FailureRate > 1 {
+		config.FailureRate = 0.5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 5 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{name: name, config: config, buckets: make([]breakerBucket, config.Buckets)}
+}
+
+// State 当前熔断状态
+func (self *CircuitBreaker) State() int {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.checkOpen(time.Now())
+	return self.state
+}
+
+// Allow 申请执行请求, 返回done回调记录执行结果, 熔断时返回ErrBreakerOpen
+func (self *CircuitBreaker) Allow() (func(err error), error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.checkOpen(time.Now())
+	switch self.state {
+	case BreakerOpen:
+		return nil, ErrBreakerOpen
+	case BreakerHalfOpen:
+		if self.probes >= self.config.HalfOpenRequests {
+			return nil, ErrBreakerOpen
+		}
+		self.probes++
+	}
+	return self.done, nil
+}
+
+// Do 熔断保护执行fn
+func (self *CircuitBreaker) Do(fn func() error) error {
+	done, err := self.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+func (self *CircuitBreaker) done(err error) {
+	failure := err != nil && (self.config.IsFailure == nil || self.config.IsFailure(err))
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	now := time.Now()
+	switch self.state {
+	case BreakerHalfOpen:
+		if failure {
+			self.setState(BreakerOpen, now)
+			return
+		}
+		self.passed++
+		if self.passed >= self.config.HalfOpenRequests {
+			self.setState(BreakerClosed, now)
+		}
+		return
+	case BreakerOpen: // 熔断前已放行的请求, 不再计入
+		return
+	}
+	bucket := self.bucket(now)
+	bucket.total++
+	if failure {
+		bucket.failure++
+	}
+	total, failures := self.count(now)
+	if total >= self.config.MinRequests && float64(failures)/float64(total) >= self.config.FailureRate {
+		self.setState(BreakerOpen, now)
+	}
+}
+
+// 熔断时长结束后进入半开状态
+func (self *CircuitBreaker) checkOpen(now time.Time) {
+	if self.state == BreakerOpen && now.Sub(self.openedAt) >= self.config.OpenTimeout {
+		self.setState(BreakerHalfOpen, now)
+	}
+}
+
+func (self *CircuitBreaker) setState(state int, now time.Time) {
+	from := self.state
+	self.state = state
+	self.probes, self.passed = 0, 0
+	switch state {
+	case BreakerOpen:
+		self.openedAt = now
+	case BreakerClosed:
+		for i := range self.buckets {
+			self.buckets[i] = breakerBucket{}
+		}
+	}
+	if self.config.OnStateChange != nil && from != state {
+		go self.config.OnStateChange(self.name, from, state)
+	}
+}
+
+func (self *CircuitBreaker) bucketIndex(now time.Time) int64 {
+	return now.UnixNano() / int64(self.config.Window/time.Duration(self.config.Buckets))
+}
+
+func (self *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	index := self.bucketIndex(now)
+	bucket := &self.buckets[index%int64(len(self.buckets))]
+	if bucket.index != index { // 复用已过期分桶
+		*bucket = breakerBucket{index: index}
+	}
+	return bucket
+}
+
+func (self *CircuitBreaker) count(now time.Time) (int64, int64) {
+	index := self.bucketIndex(now)
+	var total, failures int64
+	for _, v := range self.buckets {
+		if index-v.index < int64(len(self.buckets)) {
+			total += v.total
+			failures += v.failure
+		}
+	}
+	return total, failures
+}
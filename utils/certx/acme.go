@@ -0,0 +1,73 @@
+package certx
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/godaddy-x/freego/zlog"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"net/http"
+	"time"
+)
+
+type AcmeConfig struct {
+	Domains      []string // 允许申请证书的域名
+	Email        string   // 证书到期通知邮箱
+	CacheDir     string   // 证书缓存目录, 默认./cert/acme
+	DirectoryURL string   // ACME目录地址, 为空时使用Let's Encrypt
+	HttpAddr     string   // HTTP-01验证监听地址如:80, 为空时仅支持TLS-ALPN-01, 需服务监听443端口
+}
+
+type Acme struct {
+	manager *autocert.Manager
+}
+
+// NewAcme 创建ACME证书管理, 首次握手时申请证书, 到期前30天自动续期
+func NewAcme(config AcmeConfig) *Acme {
+	if len(config.Domains) == 0 {
+		panic("acme domains is nil")
+	}
+	if len(config.CacheDir) == 0 {
+		config.CacheDir = "./cert/acme"
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.Domains...),
+		Cache:      autocert.DirCache(config.CacheDir),
+		Email:      config.Email,
+	}
+	if len(config.DirectoryURL) > 0 {
+		manager.Client = &acme.Client{DirectoryURL: config.DirectoryURL}
+	}
+	if len(config.HttpAddr) > 0 {
+		server := &http.Server{Addr: config.HttpAddr, Handler: manager.HTTPHandler(nil)}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				zlog.Error("[ACME] http challenge server failed", 0, zlog.String("addr", config.HttpAddr), zlog.AddError(err))
+			}
+		}()
+		addCloser(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return server.Shutdown(ctx)
+		})
+		zlog.Printf("acme http challenge【%s】service has been started successful", config.HttpAddr)
+	}
+	return &Acme{manager: manager}
+}
+
+// ServerTLS 服务端TLS配置, name为证书用途如grpc-server, 过期时间指标按name/域名记录
+func (self *Acme) ServerTLS(name string) *tls.Config {
+	config := self.manager.TLSConfig()
+	getCertificate := config.GetCertificate
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := getCertificate(hello)
+		if err != nil {
+			zlog.Error("[ACME] get certificate failed", 0, zlog.String("name", name), zlog.String("server", hello.ServerName), zlog.AddError(err))
+			return nil, err
+		}
+		observe(name+"/"+hello.ServerName, cert)
+		return cert, nil
+	}
+	return config
+}
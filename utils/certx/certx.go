@@ -0,0 +1,67 @@
+package certx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/godaddy-x/freego/promx"
+	"github.com/godaddy-x/freego/zlog"
+	"sync"
+	"time"
+)
+
+// 证书自动申请及轮换, 无需预先生成证书文件
+// ACME: 通过Let's Encrypt等ACME服务为公网域名自动申请及续期证书, 适用于对外服务端
+// SPIFFE: 通过SPIFFE workload API(如spire-agent)获取并自动轮换X509-SVID, 适用于内部服务间mTLS
+// 用法: rpcx.TlsConfig{Acme/Spiffe}, node.UseACME/UseSPIFFE, 停机时调用Close释放资源
+
+var (
+	closersMu sync.Mutex
+	closers   []func() error
+	expiries  sync.Map // name -> []byte 上次记录过期时间的证书
+)
+
+func addCloser(fn func() error) {
+	closersMu.Lock()
+	defer closersMu.Unlock()
+	closers = append(closers, fn)
+}
+
+// Close 关闭ACME验证服务及SPIFFE workload API连接
+func Close() error {
+	closersMu.Lock()
+	fns := closers
+	closers = nil
+	closersMu.Unlock()
+	var result error
+	for _, fn := range fns {
+		if err := fn(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// 证书变化时记录过期时间指标, 剩余有效期不足7天时记录告警
+func observe(name string, cert *tls.Certificate) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return
+	}
+	raw := cert.Certificate[0]
+	if last, ok := expiries.Load(name); ok && bytes.Equal(last.([]byte), raw) {
+		return
+	}
+	expiries.Store(name, raw)
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(raw); err != nil {
+			return
+		}
+	}
+	promx.SetCertExpiry(name, leaf.NotAfter)
+	zlog.Info("[TLS] certificate rotated", 0, zlog.String("name", name), zlog.String("expiry", leaf.NotAfter.Format(time.RFC3339)))
+	if time.Until(leaf.NotAfter) < 7*24*time.Hour {
+		zlog.Warn("[TLS] certificate will expire soon", 0, zlog.String("name", name), zlog.String("expiry", leaf.NotAfter.Format(time.RFC3339)))
+	}
+}
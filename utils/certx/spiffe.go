@@ -0,0 +1,106 @@
+package certx
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"time"
+)
+
+type SpiffeConfig struct {
+	Socket      string   // workload API地址如unix:///run/spire/sockets/agent.sock, 为空时读取环境变量SPIFFE_ENDPOINT_SOCKET
+	TrustDomain string   // 允许的对端信任域, 为空时使用本身SVID所属信任域
+	IDs         []string // 允许的对端SPIFFE ID, 设置后优先于TrustDomain
+	Timeout     int      // 首次获取SVID超时/秒, 默认10
+}
+
+type Spiffe struct {
+	source     *workloadapi.X509Source
+	authorizer tlsconfig.Authorizer
+}
+
+// NewSpiffe 连接workload API获取SVID及信任包, 之后由agent推送自动轮换, 连接失败时panic
+func NewSpiffe(config SpiffeConfig) *Spiffe {
+	if config.Timeout <= 0 {
+		config.Timeout = 10
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+	var options []workloadapi.X509SourceOption
+	if len(config.Socket) > 0 {
+		options = append(options, workloadapi.WithClientOptions(workloadapi.WithAddr(config.Socket)))
+	}
+	source, err := workloadapi.NewX509Source(ctx, options...)
+	if err != nil {
+		panic(utils.Error("[SPIFFE] create x509 source failed: ", err))
+	}
+	authorizer, err := spiffeAuthorizer(source, config)
+	if err != nil {
+		_ = source.Close()
+		panic(err)
+	}
+	addCloser(source.Close)
+	svid, _ := source.GetX509SVID()
+	if svid != nil {
+		zlog.Printf("spiffe workload【%s】has been connected successful", svid.ID.String())
+	}
+	return &Spiffe{source: source, authorizer: authorizer}
+}
+
+func spiffeAuthorizer(source *workloadapi.X509Source, config SpiffeConfig) (tlsconfig.Authorizer, error) {
+	if len(config.IDs) > 0 {
+		ids := make([]spiffeid.ID, 0, len(config.IDs))
+		for _, v := range config.IDs {
+			id, err := spiffeid.FromString(v)
+			if err != nil {
+				return nil, utils.Error("[SPIFFE] invalid id [", v, "]: ", err)
+			}
+			ids = append(ids, id)
+		}
+		return tlsconfig.AuthorizeOneOf(ids...), nil
+	}
+	if len(config.TrustDomain) > 0 {
+		td, err := spiffeid.TrustDomainFromString(config.TrustDomain)
+		if err != nil {
+			return nil, utils.Error("[SPIFFE] invalid trust domain [", config.TrustDomain, "]: ", err)
+		}
+		return tlsconfig.AuthorizeMemberOf(td), nil
+	}
+	svid, err := source.GetX509SVID()
+	if err != nil {
+		return nil, utils.Error("[SPIFFE] get x509 svid failed: ", err)
+	}
+	return tlsconfig.AuthorizeMemberOf(svid.ID.TrustDomain()), nil
+}
+
+// ServerTLS 服务端mTLS配置, 校验客户端SVID, name为证书用途如grpc-server, 用于过期时间指标
+func (self *Spiffe) ServerTLS(name string) *tls.Config {
+	config := tlsconfig.MTLSServerConfig(self.source, self.source, self.authorizer)
+	getCertificate := config.GetCertificate
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := getCertificate(hello)
+		if err == nil {
+			observe(name, cert)
+		}
+		return cert, err
+	}
+	return config
+}
+
+// ClientTLS 客户端mTLS配置, 校验服务端SVID, name为证书用途如grpc-client, 用于过期时间指标
+func (self *Spiffe) ClientTLS(name string) *tls.Config {
+	config := tlsconfig.MTLSClientConfig(self.source, self.source, self.authorizer)
+	getClientCertificate := config.GetClientCertificate
+	config.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := getClientCertificate(info)
+		if err == nil {
+			observe(name, cert)
+		}
+		return cert, err
+	}
+	return config
+}
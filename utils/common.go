@@ -36,7 +36,6 @@ var (
 	random_byte_sp         = Str2Bytes("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ!@#$%^*+-_=")
 	local_secret_key       = createDefaultLocalSecretKey()
 	local_token_secret_key = createLocalTokenSecretKey()
-	snowflake_node         = GetSnowflakeNode(0)
 )
 
 const (
@@ -160,14 +159,36 @@ func AddStr(input ...interface{}) string {
 	return Bytes2Str(rstr.Bytes())
 }
 
-// 高性能拼接错误对象
+// 高性能拼接错误对象, 参数中包含error时保留原始错误, 支持errors.Is/As
 func Error(input ...interface{}) error {
 	msg := AddStr(input...)
+	for _, v := range input {
+		if err, b := v.(error); b && err != nil {
+			return &wrapError{msg: msg, err: err}
+		}
+	}
 	return errors.New(msg)
 }
 
-// 读取JSON格式配置文件
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (self *wrapError) Error() string {
+	return self.msg
+}
+
+func (self *wrapError) Unwrap() error {
+	return self.err
+}
+
+// 读取JSON格式配置文件, enc:前缀的值通过KeyProvider密钥解密
 func ReadJsonConfig(conf []byte, result interface{}) error {
+	conf, err := DecryptConfig(conf)
+	if err != nil {
+		return err
+	}
 	return JsonUnmarshal(conf, result)
 }
 
@@ -320,19 +341,19 @@ func LowerFirst(str string) string {
 	return upperStr
 }
 
-// NextIID 获取雪花int64 ID,默认为1024区
+// NextIID 获取雪花int64 ID, 节点通过InitSnowflake或租约分配设置
 func NextIID() int64 {
-	return snowflake_node.Generate().Int64()
+	return getSnowflakeNode().Generate().Int64()
 }
 
-// NextSID 获取雪花string ID,默认为1024区
+// NextSID 获取雪花string ID
 func NextSID() string {
-	return snowflake_node.Generate().String()
+	return getSnowflakeNode().Generate().String()
 }
 
-// NextBID 获取雪花string ID,默认为1024区
+// NextBID 获取雪花string ID字节
 func NextBID() []byte {
-	return snowflake_node.Generate().Bytes()
+	return getSnowflakeNode().Generate().Bytes()
 }
 
 func GetUUID(replace ...bool) string {
@@ -363,7 +384,7 @@ func ReadLocalJsonConfig(path string, result interface{}) error {
 	if data, err := ReadFile(path); err != nil {
 		return err
 	} else {
-		return JsonUnmarshal(data, result)
+		return ReadJsonConfig(data, result)
 	}
 }
 
@@ -732,6 +753,9 @@ func Div(a, b interface{}, n int32) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if y.IsZero() {
+		return "", decimal.ErrDivisionByZero
+	}
 	return x.DivRound(y, n).String(), nil
 }
 
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	cr "crypto/rand"
+	"crypto/sha256"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	EncPrefix        = "enc:"              // 配置密文前缀
+	ConfigKeyEnvName = "FREEGO_CONFIG_KEY" // 默认配置密钥环境变量
+)
+
+// KeyProvider 配置解密密钥提供者, 密钥不应随配置文件提交
+type KeyProvider interface {
+	ConfigKey() (string, error)
+}
+
+// EnvKeyProvider 从环境变量读取密钥, Name为空时读取FREEGO_CONFIG_KEY
+type EnvKeyProvider struct {
+	Name string
+}
+
+func (self EnvKeyProvider) ConfigKey() (string, error) {
+	name := self.Name
+	if len(name) == 0 {
+		name = ConfigKeyEnvName
+	}
+	key := os.Getenv(name)
+	if len(key) == 0 {
+		return "", Error("config key env [", name, "] is nil")
+	}
+	return key, nil
+}
+
+// FileKeyProvider 从文件读取密钥, 例: k8s secret挂载文件
+type FileKeyProvider struct {
+	Path string
+}
+
+func (self FileKeyProvider) ConfigKey() (string, error) {
+	b, err := ReadFile(self.Path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(Bytes2Str(b))
+	if len(key) == 0 {
+		return "", Error("config key file [", self.Path, "] is nil")
+	}
+	return key, nil
+}
+
+var (
+	keyProviderMu sync.RWMutex
+	keyProvider   KeyProvider = EnvKeyProvider{}
+)
+
+// SetKeyProvider 设置配置解密密钥提供者, 默认读取环境变量FREEGO_CONFIG_KEY
+func SetKeyProvider(provider KeyProvider) {
+	keyProviderMu.Lock()
+	defer keyProviderMu.Unlock()
+	keyProvider = provider
+}
+
+func getKeyProvider() KeyProvider {
+	keyProviderMu.RLock()
+	defer keyProviderMu.RUnlock()
+	return keyProvider
+}
+
+func configCipher(key string) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, Error("config key is nil")
+	}
+	sum := sha256.Sum256(Str2Bytes(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptConfigValue AES-GCM加密配置值, 返回enc:前缀密文
+func EncryptConfigValue(value, key string) (string, error) {
+	gcm, err := configCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := cr.Read(nonce); err != nil {
+		return "", err
+	}
+	return AddStr(EncPrefix, Base64Encode(gcm.Seal(nonce, nonce, Str2Bytes(value), nil))), nil
+}
+
+// DecryptConfigValue 解密enc:前缀密文, 非密文原样返回
+func DecryptConfigValue(value, key string) (string, error) {
+	if !strings.HasPrefix(value, EncPrefix) {
+		return value, nil
+	}
+	gcm, err := configCipher(key)
+	if err != nil {
+		return "", err
+	}
+	bs := Base64Decode(strings.TrimPrefix(value, EncPrefix))
+	if len(bs) <= gcm.NonceSize() {
+		return "", Error("config value ciphertext invalid")
+	}
+	plain, err := gcm.Open(nil, bs[:gcm.NonceSize()], bs[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", Error("config value decrypt failed: ", err)
+	}
+	return Bytes2Str(plain), nil
+}
+
+// DecryptConfig 解密JSON配置中所有enc:前缀的字符串值, 不含密文时原样返回
+func DecryptConfig(conf []byte) ([]byte, error) {
+	if !strings.Contains(Bytes2Str(conf), `"`+EncPrefix) {
+		return conf, nil
+	}
+	provider := getKeyProvider()
+	if provider == nil {
+		return nil, Error("config key provider is nil")
+	}
+	key, err := provider.ConfigKey()
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := JsonUnmarshal(conf, &data); err != nil {
+		return nil, err
+	}
+	if data, err = decryptConfigNode(data, key); err != nil {
+		return nil, err
+	}
+	return JsonMarshal(data)
+}
+
+func decryptConfigNode(node interface{}, key string) (interface{}, error) {
+	switch v := node.(type) {
+	case string:
+		return DecryptConfigValue(v, key)
+	case map[string]interface{}:
+		for k, item := range v {
+			r, err := decryptConfigNode(item, key)
+			if err != nil {
+				return nil, Error("config field [", k, "] ", err)
+			}
+			v[k] = r
+		}
+	case []interface{}:
+		for i, item := range v {
+			r, err := decryptConfigNode(item, key)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = r
+		}
+	}
+	return node, nil
+}
+
+// FuncKeyProvider 通过回调获取密钥, 例: 从KMS解密数据密钥
+type FuncKeyProvider func() (string, error)
+
+func (self FuncKeyProvider) ConfigKey() (string, error) {
+	if self == nil {
+		return "", Error("key provider func is nil")
+	}
+	return self()
+}
@@ -0,0 +1,219 @@
+package decimal
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// ErrOverflow is returned when a decimal does not fit the requested integer type.
+var ErrOverflow = errors.New("decimal: value overflows int64")
+
+// ErrDivisionByZero is returned by the safe division helpers.
+var ErrDivisionByZero = errors.New("decimal: division by zero")
+
+var maxInt64 = New(math.MaxInt64, 0)
+var minInt64 = New(math.MinInt64, 0)
+
+// Currency describes how amounts of a currency are rounded and displayed.
+type Currency struct {
+	Code     string // ISO 4217 code, e.g. CNY
+	Symbol   string // display symbol, e.g. ¥
+	Places   int32  // minor unit digits, e.g. 2 for cents
+	Grouping string // thousands separator, default ","
+	Point    string // decimal separator, default "."
+}
+
+var (
+	CNY  = Currency{Code: "CNY", Symbol: "¥", Places: 2}
+	USD  = Currency{Code: "USD", Symbol: "$", Places: 2}
+	EUR  = Currency{Code: "EUR", Symbol: "€", Places: 2}
+	JPY  = Currency{Code: "JPY", Symbol: "¥", Places: 0}
+	USDT = Currency{Code: "USDT", Symbol: "₮", Places: 6}
+	BTC  = Currency{Code: "BTC", Symbol: "₿", Places: 8}
+)
+
+// RoundMoney rounds d to the currency minor unit using banker's rounding.
+func (d Decimal) RoundMoney(c Currency) Decimal {
+	return d.RoundBank(c.Places)
+}
+
+// FormatMoney returns d rounded with banker's rounding and formatted with the
+// currency symbol and thousands separators.
+//
+// Example:
+//
+//	NewFromFloat(-1234567.125).FormatMoney(USD) // output: "-$1,234,567.12"
+//	NewFromFloat(1234.5).FormatMoney(JPY)       // output: "¥1,234"
+func (d Decimal) FormatMoney(c Currency) string {
+	grouping := c.Grouping
+	if len(grouping) == 0 {
+		grouping = ","
+	}
+	point := c.Point
+	if len(point) == 0 {
+		point = "."
+	}
+	s := d.RoundBank(c.Places).StringFixed(c.Places)
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	var b strings.Builder
+	if negative {
+		b.WriteString("-")
+	}
+	b.WriteString(c.Symbol)
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(grouping)
+		}
+		b.WriteRune(r)
+	}
+	if len(fracPart) > 0 {
+		b.WriteString(point)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// Allocate splits d into parts proportional to ratios, each part rounded down
+// to places digits. The remainder is distributed one minor unit at a time to
+// the leading parts, so the parts always sum exactly to d rounded to places.
+//
+// Example:
+//
+//	New(100, 0).Allocate(2, 1, 1, 1) // output: [33.34 33.33 33.33]
+func (d Decimal) Allocate(places int32, ratios ...int64) ([]Decimal, error) {
+	if len(ratios) == 0 {
+		return nil, errors.New("decimal: allocate ratios is empty")
+	}
+	total := int64(0)
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, errors.New("decimal: allocate ratio is negative")
+		}
+		if total > math.MaxInt64-r {
+			return nil, ErrOverflow
+		}
+		total += r
+	}
+	if total == 0 {
+		return nil, errors.New("decimal: allocate ratios sum is zero")
+	}
+	// work on integer minor units to avoid any precision loss
+	units := d.RoundBank(places).Shift(places).value
+	sign := units.Sign()
+	units = new(big.Int).Abs(units)
+	totalInt := big.NewInt(total)
+	parts := make([]*big.Int, len(ratios))
+	allocated := new(big.Int)
+	for i, r := range ratios {
+		part := new(big.Int).Mul(units, big.NewInt(r))
+		part.Quo(part, totalInt)
+		parts[i] = part
+		allocated.Add(allocated, part)
+	}
+	remainder := new(big.Int).Sub(units, allocated)
+	for i := 0; remainder.Sign() > 0; i = (i + 1) % len(parts) {
+		if ratios[i] == 0 {
+			continue
+		}
+		parts[i].Add(parts[i], oneInt)
+		remainder.Sub(remainder, oneInt)
+	}
+	result := make([]Decimal, len(parts))
+	for i, part := range parts {
+		if sign < 0 {
+			part.Neg(part)
+		}
+		result[i] = NewFromBigInt(part, -places)
+	}
+	return result, nil
+}
+
+// Split divides d into n parts as equal as possible at places digits, e.g.
+// 100 into 3 parts is [33.34 33.33 33.33].
+func (d Decimal) Split(n int, places int32) ([]Decimal, error) {
+	if n <= 0 {
+		return nil, errors.New("decimal: split parts must be greater than 0")
+	}
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return d.Allocate(places, ratios...)
+}
+
+// IsInteger returns true when d has no fractional part.
+func (d Decimal) IsInteger() bool {
+	d.ensureInitialized()
+	if d.exp >= 0 || d.value.Sign() == 0 {
+		return true
+	}
+	return d.Truncate(0).Equal(d)
+}
+
+// Int64 returns the integer part of d, or ErrOverflow when it does not fit
+// into int64. Unlike IntPart it never silently wraps around.
+func (d Decimal) Int64() (int64, error) {
+	i := d.Truncate(0)
+	if i.GreaterThan(maxInt64) || i.LessThan(minInt64) {
+		return 0, ErrOverflow
+	}
+	return i.IntPart(), nil
+}
+
+// Float64Exact returns d as float64 and an error when the conversion would
+// lose precision.
+func (d Decimal) Float64Exact() (float64, error) {
+	f, exact := d.Float64()
+	if !exact {
+		return f, errors.New("decimal: " + d.String() + " cannot be represented exactly as float64")
+	}
+	return f, nil
+}
+
+// ToMinorUnits converts d to an integer amount of minor units (e.g. cents),
+// returning an error when d has more than places fractional digits or the
+// result overflows int64.
+func (d Decimal) ToMinorUnits(places int32) (int64, error) {
+	shifted := d.Shift(places)
+	if !shifted.IsInteger() {
+		return 0, errors.New("decimal: " + d.String() + " has more fractional digits than allowed")
+	}
+	return shifted.Int64()
+}
+
+// NewFromMinorUnits returns the decimal value of units minor units, e.g.
+// NewFromMinorUnits(12345, 2) is 123.45.
+func NewFromMinorUnits(units int64, places int32) Decimal {
+	return New(units, -places)
+}
+
+// SafeDiv divides d by d2 rounding to precision digits with banker's
+// rounding, returning ErrDivisionByZero instead of panicking.
+func (d Decimal) SafeDiv(d2 Decimal, precision int32) (Decimal, error) {
+	if d2.IsZero() {
+		return Decimal{}, ErrDivisionByZero
+	}
+	q, r := d.QuoRem(d2, precision)
+	// same as DivRound, but a remainder of exactly half rounds to even
+	var rv2 big.Int
+	rv2.Abs(r.value)
+	rv2.Lsh(&rv2, 1)
+	r2 := Decimal{value: &rv2, exp: r.exp + precision}
+	c := r2.Cmp(d2.Abs())
+	if c < 0 || (c == 0 && q.value.Bit(0) == 0) {
+		return q, nil
+	}
+	if d.value.Sign()*d2.value.Sign() < 0 {
+		return q.Sub(New(1, -precision)), nil
+	}
+	return q.Add(New(1, -precision)), nil
+}
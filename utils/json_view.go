@@ -0,0 +1,360 @@
+package utils
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 序列化视图, 字段通过view标签声明所属视图, 如 `view:"public,admin"`
+// 未声明view标签的字段在所有视图中输出, view:"-" 的字段在任何视图中均不输出
+// 示例:
+//
+//	type User struct {
+//		Id       int64  `json:"id"`
+//		Username string `json:"username" view:"public,admin"`
+//		Password string `json:"password" view:"-"`
+//		AuthKey  string `json:"authKey" view:"admin"`
+//	}
+//	utils.MarshalView(user, "public") // {"id":1,"username":"test"}
+//
+// int64/[]int64字段标记 `public_id:"true"` 时输出EncodeID混淆后的字符串
+// json:",string" 与encoding/json一致, 作用于bool/数值/字符串及其指针字段
+
+type viewField struct {
+	index     []int
+	name      string
+	omitempty bool
+	quoted    bool     // json:",string" 标量值按字符串输出
+	views     []string // nil则全部视图输出
+	hidden    bool     // view:"-"
+	publicID  bool     // public_id:"true"
+}
+
+type viewObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// ViewAll 输出除view:"-"外的全部字段
+const ViewAll = "*"
+
+// ViewEntity 按视图序列化的数据包装, 可直接作为响应数据输出
+type ViewEntity struct {
+	Data interface{}
+	View string
+}
+
+var (
+	viewFieldCache   sync.Map // reflect.Type -> []viewField
+	jsonMarshalerTyp = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerTyp = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// NewView 创建按视图序列化的数据包装
+func NewView(data interface{}, view string) *ViewEntity {
+	return &ViewEntity{Data: data, View: view}
+}
+
+func (self *ViewEntity) MarshalJSON() ([]byte, error) {
+	return MarshalView(self.Data, self.View)
+}
+
+// MarshalView 按视图序列化对象, 过滤不属于该视图的字段, 支持嵌套结构体/指针/切片/map
+func MarshalView(v interface{}, view string) ([]byte, error) {
+	if v == nil {
+		return nil, Error("data is nil")
+	}
+	return JsonMarshal(toView(reflect.ValueOf(v), view))
+}
+
+func (self *viewObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range self.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := JsonMarshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		if self.values[i] == nil {
+			buf.WriteString("null")
+			continue
+		}
+		value, err := JsonMarshal(self.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func toView(v reflect.Value, view string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	// 自定义序列化类型保持原样输出
+	if t.Implements(jsonMarshalerTyp) || t.Implements(textMarshalerTyp) {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil
+		}
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return toView(v.Elem(), view)
+	case reflect.Struct:
+		fields := getViewFields(t)
+		obj := &viewObject{keys: make([]string, 0, len(fields)), values: make([]interface{}, 0, len(fields))}
+		for _, f := range fields {
+			if !f.visible(view) {
+				continue
+			}
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok {
+				continue
+			}
+			if f.omitempty && isEmptyValue(fv) {
+				continue
+			}
+			obj.keys = append(obj.keys, f.name)
+			if f.publicID {
+				obj.values = append(obj.values, toPublicID(fv))
+			} else if f.quoted {
+				obj.values = append(obj.values, toQuoted(fv))
+			} else {
+				obj.values = append(obj.values, toView(fv, view))
+			}
+		}
+		return obj
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 { // []byte按base64输出
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		result := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result[i] = toView(v.Index(i), view)
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			if key.Kind() == reflect.String {
+				result[key.String()] = toView(iter.Value(), view)
+			} else {
+				result[AnyToStr(key.Interface())] = toView(iter.Value(), view)
+			}
+		}
+		return result
+	default:
+		return v.Interface()
+	}
+}
+
+// 混淆ID在序列化时编码, 未设置混淆密钥时序列化失败
+type publicID int64
+
+func (self publicID) MarshalJSON() ([]byte, error) {
+	s, err := EncodeID(int64(self))
+	if err != nil {
+		return nil, err
+	}
+	return JsonMarshal(s)
+}
+
+// 混淆int64/[]int64字段, 其他类型原样输出
+func toPublicID(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int64:
+		return publicID(v.Int())
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() != reflect.Int64 {
+			break
+		}
+		result := make([]publicID, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result[i] = publicID(v.Index(i).Int())
+		}
+		return result
+	}
+	return v.Interface()
+}
+
+// json:",string" 字段值序列化后再按字符串输出
+type quotedValue struct {
+	value interface{}
+}
+
+func (self quotedValue) MarshalJSON() ([]byte, error) {
+	bs, err := JsonMarshal(self.value)
+	if err != nil {
+		return nil, err
+	}
+	return JsonMarshal(string(bs))
+}
+
+// nil指针输出null
+func toQuoted(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return quotedValue{value: v.Interface()}
+}
+
+func hasTagOption(opts, name string) bool {
+	for len(opts) > 0 {
+		option := opts
+		if idx := strings.IndexByte(opts, ','); idx >= 0 {
+			option, opts = opts[:idx], opts[idx+1:]
+		} else {
+			opts = ""
+		}
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (self viewField) visible(view string) bool {
+	if self.hidden {
+		return false
+	}
+	if self.views == nil || view == ViewAll {
+		return true
+	}
+	for _, v := range self.views {
+		if v == view {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func getViewFields(t reflect.Type) []viewField {
+	if v, ok := viewFieldCache.Load(t); ok {
+		return v.([]viewField)
+	}
+	fields := make([]viewField, 0, t.NumField())
+	names := make(map[string]bool, t.NumField())
+	parseViewFields(t, nil, names, &fields)
+	viewFieldCache.Store(t, fields)
+	return fields
+}
+
+func parseViewFields(t reflect.Type, parent []int, names map[string]bool, fields *[]viewField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// 匿名结构体字段展开, 与encoding/json一致
+		if sf.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct {
+			parseViewFields(ft, index, names, fields)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = sf.Name
+		}
+		if names[name] {
+			continue
+		}
+		names[name] = true
+		field := viewField{index: index, name: name, omitempty: hasTagOption(opts, "omitempty")}
+		if hasTagOption(opts, "string") {
+			switch ft.Kind() {
+			case reflect.Bool, reflect.String,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+				reflect.Float32, reflect.Float64:
+				field.quoted = true
+			}
+		}
+		field.publicID = sf.Tag.Get("public_id") == "true"
+		if tag, ok := sf.Tag.Lookup("view"); ok {
+			if tag == "-" {
+				field.hidden = true
+			} else {
+				field.views = make([]string, 0, 2)
+				for _, v := range strings.Split(tag, ",") {
+					if v = strings.TrimSpace(v); len(v) > 0 {
+						field.views = append(field.views, v)
+					}
+				}
+			}
+		}
+		*fields = append(*fields, field)
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
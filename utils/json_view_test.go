@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+)
+
+type viewUser struct {
+	Id       int64  `json:"id"`
+	Username string `json:"username" view:"public,admin"`
+	Password string `json:"password" view:"-"`
+	AuthKey  string `json:"authKey" view:"admin"`
+}
+
+type viewQuoted struct {
+	Id      int64   `json:"id,string"`
+	Amount  float64 `json:"amount,omitempty,string"`
+	Enabled *bool   `json:"enabled,string"`
+	Remark  string  `json:"remark,string"`
+	Tags    []int64 `json:"tags,string"` // 非标量类型忽略string选项
+}
+
+func TestMarshalView(t *testing.T) {
+	user := &viewUser{Id: 1, Username: "test", Password: "123456", AuthKey: "abc"}
+	bs, err := MarshalView(user, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != `{"id":1,"username":"test"}` {
+		t.Error("public view invalid: ", string(bs))
+	}
+	bs, err = MarshalView([]*viewUser{user}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != `[{"id":1,"username":"test","authKey":"abc"}]` {
+		t.Error("admin view invalid: ", string(bs))
+	}
+}
+
+func TestMarshalViewQuoted(t *testing.T) {
+	enabled := true
+	bs, err := MarshalView(&viewQuoted{Id: 1693872000000123, Amount: 1.5, Enabled: &enabled, Remark: "ok", Tags: []int64{1}}, ViewAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != `{"id":"1693872000000123","amount":"1.5","enabled":"true","remark":"\"ok\"","tags":[1]}` {
+		t.Error("quoted view invalid: ", string(bs))
+	}
+	bs, err = MarshalView(&viewQuoted{}, ViewAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != `{"id":"0","enabled":null,"remark":"\"\"","tags":null}` {
+		t.Error("quoted empty view invalid: ", string(bs))
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	jsonIterator "github.com/json-iterator/go"
+	"os"
+)
+
+const (
+	JSON_STD      = "std"      // encoding/json
+	JSON_ITERATOR = "jsoniter" // json-iterator, 默认
+	JSON_SONIC    = "sonic"    // bytedance/sonic, 需导入utils/jsonsonic包注册并以-tags sonic编译
+
+	JSON_CODEC_ENV = "FREEGO_JSON_CODEC" // 环境变量指定引擎名称, 启动时自动切换
+)
+
+// JsonCodec JSON编解码引擎, node/amqp/cache等序列化统一经由JsonMarshal/JsonUnmarshal调用
+// 内置std/jsoniter, sonic通过导入utils/jsonsonic注册, 其他引擎实现该接口后通过RegisterJsonCodec或SetJsonCodec替换
+type JsonCodec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	MarshalIndent(v interface{}, prefix, indent string) ([]byte, error)
+	// Unmarshal 数字类型解析为json.Number, 避免int64精度丢失
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	jsonCodec  JsonCodec = defaultJsonCodec
+	jsonCodecs           = map[string]JsonCodec{JSON_STD: StdJsonCodec{}, JSON_ITERATOR: IteratorJsonCodec{}}
+	jsonEnv              = os.Getenv(JSON_CODEC_ENV)
+)
+
+func init() {
+	if codec, ok := jsonCodecs[jsonEnv]; ok {
+		jsonCodec = codec
+	}
+}
+
+// RegisterJsonCodec 注册命名引擎, 需在init中调用, 名称与FREEGO_JSON_CODEC一致时立即启用
+func RegisterJsonCodec(codec JsonCodec) {
+	if codec == nil {
+		panic("json codec is nil")
+	}
+	jsonCodecs[codec.Name()] = codec
+	if codec.Name() == jsonEnv {
+		jsonCodec = codec
+	}
+}
+
+// SetJsonCodec 替换JSON编解码引擎, 需在服务启动前设置
+func SetJsonCodec(codec JsonCodec) {
+	if codec == nil {
+		panic("json codec is nil")
+	}
+	jsonCodec = codec
+}
+
+// SetJsonCodecName 按名称切换已注册引擎, 用于配置文件指定 std/jsoniter/sonic
+func SetJsonCodecName(name string) error {
+	codec, ok := jsonCodecs[name]
+	if !ok {
+		return Error("json codec [", name, "] not registered")
+	}
+	SetJsonCodec(codec)
+	return nil
+}
+
+// GetJsonCodec 获取当前JSON编解码引擎
+func GetJsonCodec() JsonCodec {
+	return jsonCodec
+}
+
+// StdJsonCodec encoding/json引擎
+type StdJsonCodec struct{}
+
+func (StdJsonCodec) Name() string {
+	return JSON_STD
+}
+
+func (StdJsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return stdjson.Marshal(v)
+}
+
+func (StdJsonCodec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return stdjson.MarshalIndent(v, prefix, indent)
+}
+
+func (StdJsonCodec) Unmarshal(data []byte, v interface{}) error {
+	d := stdjson.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+var iterator = jsonIterator.ConfigCompatibleWithStandardLibrary
+
+// IteratorJsonCodec json-iterator引擎, 兼容encoding/json标签与行为
+type IteratorJsonCodec struct{}
+
+func (IteratorJsonCodec) Name() string {
+	return JSON_ITERATOR
+}
+
+func (IteratorJsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return iterator.Marshal(v)
+}
+
+func (IteratorJsonCodec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return iterator.MarshalIndent(v, prefix, indent)
+}
+
+func (IteratorJsonCodec) Unmarshal(data []byte, v interface{}) error {
+	d := iterator.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,7 @@
+//go:build !jsonstd
+// +build !jsonstd
+
+package utils
+
+// 默认使用json-iterator, 编译时指定 -tags jsonstd 切换为encoding/json, 环境变量FREEGO_JSON_CODEC优先
+var defaultJsonCodec JsonCodec = IteratorJsonCodec{}
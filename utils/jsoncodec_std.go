@@ -0,0 +1,6 @@
+//go:build jsonstd
+// +build jsonstd
+
+package utils
+
+var defaultJsonCodec JsonCodec = StdJsonCodec{}
@@ -1,21 +1,17 @@
 package utils
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	jsonIterator "github.com/json-iterator/go"
 	"github.com/valyala/fastjson"
 )
 
-var json = jsonIterator.ConfigCompatibleWithStandardLibrary
-
 // 对象转JSON字符串
 func JsonMarshal(v interface{}) ([]byte, error) {
 	if v == nil {
 		return nil, errors.New("data is nil")
 	}
-	return json.Marshal(v)
+	return jsonCodec.Marshal(v)
 }
 
 // 对象转JSON字符串,格式化
@@ -23,7 +19,7 @@ func JsonMarshalIndent(v interface{}, p, indent string) ([]byte, error) {
 	if v == nil {
 		return nil, errors.New("data is nil")
 	}
-	return json.MarshalIndent(v, p, indent)
+	return jsonCodec.MarshalIndent(v, p, indent)
 }
 
 // 校验JSON格式是否合法
@@ -51,14 +47,7 @@ func JsonUnmarshal(data []byte, v interface{}) error {
 	if !JsonValid(data) {
 		return errors.New("JSON format invalid")
 	}
-	buf := bytes.NewBuffer(data)
-	d := json.NewDecoder(buf)
-	d.UseNumber()
-	if err := d.Decode(v); err != nil {
-		return err
-	}
-	buf.Reset()
-	return nil
+	return jsonCodec.Unmarshal(data, v)
 }
 
 func GetJsonString(b []byte, k string) string {
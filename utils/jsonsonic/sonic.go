@@ -0,0 +1,45 @@
+//go:build sonic
+// +build sonic
+
+package jsonsonic
+
+import (
+	"github.com/bytedance/sonic"
+	"github.com/godaddy-x/freego/utils"
+)
+
+// 导入该包后注册sonic引擎, 通过 utils.SetJsonCodecName("sonic") 或环境变量 FREEGO_JSON_CODEC=sonic 启用
+// 如 import _ "github.com/godaddy-x/freego/utils/jsonsonic", 需以 -tags sonic 编译, sonic依赖运行时内部实现, 仅支持其适配的Go版本
+
+// 与encoding/json行为一致, 数字解析为json.Number避免int64精度丢失
+var api = sonic.Config{
+	EscapeHTML:       true,
+	SortMapKeys:      true,
+	CompactMarshaler: true,
+	CopyString:       true,
+	ValidateString:   true,
+	UseNumber:        true,
+}.Froze()
+
+// Codec sonic引擎
+type Codec struct{}
+
+func (Codec) Name() string {
+	return utils.JSON_SONIC
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return api.Marshal(v)
+}
+
+func (Codec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return api.MarshalIndent(v, prefix, indent)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return api.Unmarshal(data, v)
+}
+
+func init() {
+	utils.RegisterJsonCodec(Codec{})
+}
@@ -0,0 +1,169 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/zlog"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// JWKS公钥发布及导入, 仅包含RS256/ES256公钥, HS256密钥不对外发布
+// 导入时需指定外部签发方及本服务接收方标识, 各签发方公钥独立保存, 刷新时仅替换该签发方的公钥
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKS 输出未过期的本地非对称公钥, 轮换过渡期内的旧公钥同样输出
+func (self *KeySet) JWKS() ([]byte, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	result := jwks{Keys: []jwk{}}
+	now := utils.UnixSecond()
+	for _, v := range self.keys {
+		if v.Expired > 0 && v.Expired <= now {
+			continue
+		}
+		switch pub := v.PublicKey.(type) {
+		case *rsa.PublicKey:
+			result.Keys = append(result.Keys, jwk{Kty: "RSA", Kid: v.Kid, Use: "sig", Alg: RS256,
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			x, y := make([]byte, 32), make([]byte, 32)
+			pub.X.FillBytes(x)
+			pub.Y.FillBytes(y)
+			result.Keys = append(result.Keys, jwk{Kty: "EC", Kid: v.Kid, Use: "sig", Alg: ES256, Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(x),
+				Y: base64.RawURLEncoding.EncodeToString(y),
+			})
+		}
+	}
+	return utils.JsonMarshal(&result)
+}
+
+func parseJwk(v jwk) (*Key, error) {
+	decode := func(s string) *big.Int {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		return new(big.Int).SetBytes(b)
+	}
+	key := &Key{Kid: v.Kid}
+	switch v.Kty {
+	case "RSA":
+		n, e := decode(v.N), decode(v.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return nil, utils.Error("jwks key [", v.Kid, "] rsa n/e invalid")
+		}
+		key.Alg = RS256
+		key.PublicKey = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		x, y := decode(v.X), decode(v.Y)
+		if v.Crv != "P-256" || x == nil || y == nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, utils.Error("jwks key [", v.Kid, "] ec P-256 point invalid")
+		}
+		key.Alg = ES256
+		key.PublicKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	default:
+		return nil, utils.Error("jwks key [", v.Kid, "] kty [", v.Kty, "] unsupported")
+	}
+	if len(v.Alg) > 0 && v.Alg != key.Alg {
+		return nil, utils.Error("jwks key [", v.Kid, "] alg [", v.Alg, "] invalid")
+	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LoadJWKS 导入外部签发方JWKS公钥用于验签, 替换该签发方上次导入的公钥, 不影响本地密钥及其他签发方
+func (self *KeySet) LoadJWKS(issuer RemoteIssuer, data []byte) error {
+	if len(issuer.Issuer) == 0 || len(issuer.Audience) == 0 {
+		return utils.Error("jwks issuer/audience is nil")
+	}
+	result := jwks{}
+	if err := utils.JsonUnmarshal(data, &result); err != nil {
+		return utils.Error("jwks unmarshal failed: ", err)
+	}
+	keys := make(map[string]*Key, len(result.Keys))
+	for _, v := range result.Keys {
+		if len(v.Use) > 0 && v.Use != "sig" {
+			continue
+		}
+		key, err := parseJwk(v)
+		if err != nil {
+			return err
+		}
+		keys[key.Kid] = key
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.remotes[issuer.Issuer] = &remoteKeys{audience: issuer.Audience, keys: keys}
+	return nil
+}
+
+// FetchJWKS 从地址获取外部签发方JWKS并导入
+func (self *KeySet) FetchJWKS(issuer RemoteIssuer, url string) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return utils.Error("jwks fetch failed: ", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return utils.Error("jwks fetch failed: status ", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, 1<<20))
+	if err != nil {
+		return utils.Error("jwks read failed: ", err)
+	}
+	return self.LoadJWKS(issuer, data)
+}
+
+// WatchJWKS 首次同步获取JWKS, 之后按间隔刷新, 刷新失败时保留已导入公钥, 返回停止函数
+func (self *KeySet) WatchJWKS(issuer RemoteIssuer, url string, interval time.Duration) (func(), error) {
+	if err := self.FetchJWKS(issuer, url); err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := self.FetchJWKS(issuer, url); err != nil {
+					zlog.Error("jwks refresh failed", 0, zlog.String("url", url), zlog.AddError(err))
+				}
+			}
+		}
+	}()
+	zlog.Printf("jwks【%s】watch has been started successful", url)
+	return func() { close(stop) }, nil
+}
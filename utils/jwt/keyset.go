@@ -0,0 +1,296 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/godaddy-x/freego/utils"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// 多算法多密钥签名, 支持HS256/RS256/ES256, token头部kid标识签名密钥
+// active密钥用于签发token, 其余未过期密钥仅用于验签; Rotate切换签发密钥后旧密钥在overlap秒内仍可验签
+// 非对称密钥可通过JWKS发布公钥, 其他服务通过LoadJWKS/WatchJWKS导入公钥验签, 无需共享私钥
+// 导入的公钥按签发方(iss)独立保存, 仅用于验签iss为该签发方且aud为指定接收方的token, 不与本地密钥混用
+
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Key 签名密钥, Expired为0时长期有效
+type Key struct {
+	Kid        string
+	Alg        string           // HS256/RS256/ES256, 为空时为HS256
+	Secret     string           // HS256密钥
+	PrivateKey crypto.Signer    // RS256/ES256私钥, 仅验签时为空
+	PublicKey  crypto.PublicKey // RS256/ES256公钥, 为空时使用私钥对应公钥
+	Expired    int64            // 失效时间/秒
+}
+
+// RemoteIssuer 外部签发方, 导入其JWKS公钥后仅验签iss为Issuer且aud为Audience的token
+type RemoteIssuer struct {
+	Issuer   string
+	Audience string // 本服务作为接收方的标识
+}
+
+type remoteKeys struct {
+	audience string
+	keys     map[string]*Key
+}
+
+// KeySet 多密钥管理
+type KeySet struct {
+	mu      sync.RWMutex
+	active  string
+	keys    map[string]*Key
+	remotes map[string]*remoteKeys // 签发方 -> 导入的公钥
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*Key), remotes: make(map[string]*remoteKeys)}
+}
+
+func checkKey(key *Key) error {
+	if len(key.Alg) == 0 {
+		key.Alg = HS256
+	}
+	switch key.Alg {
+	case HS256:
+		if len(key.Secret) < 32 {
+			return utils.Error("jwt key [", key.Kid, "] secret length should be >= 32")
+		}
+	case RS256:
+		if key.PublicKey == nil && key.PrivateKey != nil {
+			key.PublicKey = key.PrivateKey.Public()
+		}
+		pub, ok := key.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return utils.Error("jwt key [", key.Kid, "] rsa public key invalid")
+		}
+		if pub.N.BitLen() < 2048 {
+			return utils.Error("jwt key [", key.Kid, "] rsa key length should be >= 2048")
+		}
+	case ES256:
+		if key.PublicKey == nil && key.PrivateKey != nil {
+			key.PublicKey = key.PrivateKey.Public()
+		}
+		pub, ok := key.PublicKey.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return utils.Error("jwt key [", key.Kid, "] ecdsa P-256 public key invalid")
+		}
+	default:
+		return utils.Error("jwt key [", key.Kid, "] alg [", key.Alg, "] unsupported")
+	}
+	return nil
+}
+
+// Add 添加密钥, active为true时设置为签发密钥, 签发密钥必须包含私钥
+func (self *KeySet) Add(key Key, active bool) error {
+	if err := checkKey(&key); err != nil {
+		return err
+	}
+	if active && key.Alg != HS256 && key.PrivateKey == nil {
+		return utils.Error("jwt key [", key.Kid, "] private key is nil")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.keys[key.Kid] = &key
+	if active {
+		self.active = key.Kid
+	}
+	return nil
+}
+
+// Active 获取当前签发密钥
+func (self *KeySet) Active() (*Key, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	key, b := self.keys[self.active]
+	if !b {
+		return nil, utils.Error("jwt active key is nil")
+	}
+	return key, nil
+}
+
+// Get 根据kid获取验签密钥, 已过期的密钥视为无效
+func (self *KeySet) Get(kid string) (*Key, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	key, b := self.keys[kid]
+	if !b {
+		return nil, utils.Error("jwt key [", kid, "] not found")
+	}
+	if key.Expired > 0 && key.Expired <= utils.UnixSecond() {
+		return nil, utils.Error("jwt key [", kid, "] expired")
+	}
+	return key, nil
+}
+
+// 根据签发方及kid获取导入的公钥及接收方
+func (self *KeySet) getRemote(iss, kid string) (*Key, string, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	remote, b := self.remotes[iss]
+	if !b {
+		return nil, "", utils.Error("jwt issuer [", iss, "] not trusted")
+	}
+	key, b := remote.keys[kid]
+	if !b {
+		return nil, "", utils.Error("jwt issuer [", iss, "] key [", kid, "] not found")
+	}
+	return key, remote.audience, nil
+}
+
+// Rotate 切换签发密钥, 旧签发密钥在overlap秒内仍可验签
+func (self *KeySet) Rotate(key Key, overlap int64) error {
+	if err := checkKey(&key); err != nil {
+		return err
+	}
+	if key.Alg != HS256 && key.PrivateKey == nil {
+		return utils.Error("jwt key [", key.Kid, "] private key is nil")
+	}
+	if overlap < 0 {
+		return utils.Error("jwt key overlap invalid")
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if _, b := self.keys[key.Kid]; b {
+		return utils.Error("jwt key [", key.Kid, "] exist")
+	}
+	now := utils.UnixSecond()
+	if prev, b := self.keys[self.active]; b {
+		expired := *prev
+		expired.Expired = now + overlap
+		self.keys[prev.Kid] = &expired
+	}
+	for kid, v := range self.keys { // 清理已过期密钥
+		if v.Expired > 0 && v.Expired <= now {
+			delete(self.keys, kid)
+		}
+	}
+	self.keys[key.Kid] = &key
+	self.active = key.Kid
+	return nil
+}
+
+// Sign 签名, HS256与Subject.Signature一致, RS256/ES256为base64url编码
+func (self *Key) Sign(text string) (string, error) {
+	if self.Alg == HS256 || len(self.Alg) == 0 {
+		return utils.HMAC_SHA256(text, utils.AddStr(utils.GetLocalSecretKey(), self.Secret), true), nil
+	}
+	if self.PrivateKey == nil {
+		return "", utils.Error("jwt key [", self.Kid, "] private key is nil")
+	}
+	digest := sha256.Sum256(utils.Str2Bytes(text))
+	switch self.Alg {
+	case RS256:
+		sig, err := self.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(sig), nil
+	case ES256:
+		priv, ok := self.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return "", utils.Error("jwt key [", self.Kid, "] ecdsa private key invalid")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+		if err != nil {
+			return "", err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return base64.RawURLEncoding.EncodeToString(sig), nil
+	}
+	return "", utils.Error("jwt key [", self.Kid, "] alg [", self.Alg, "] unsupported")
+}
+
+// Verify 验证签名
+func (self *Key) Verify(text, sign string) bool {
+	if self.Alg == HS256 || len(self.Alg) == 0 {
+		return hmac.Equal(utils.Str2Bytes(utils.HMAC_SHA256(text, utils.AddStr(utils.GetLocalSecretKey(), self.Secret), true)), utils.Str2Bytes(sign))
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(utils.Str2Bytes(text))
+	switch self.Alg {
+	case RS256:
+		pub, ok := self.PublicKey.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		pub, ok := self.PublicKey.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		return ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	}
+	return false
+}
+
+// 配置Keys时返回签发密钥并设置alg/kid
+func (self *JwtConfig) signKey() (*Key, error) {
+	if self.Keys == nil {
+		return nil, nil
+	}
+	key, err := self.Keys.Active()
+	if err != nil {
+		return nil, err
+	}
+	self.TokenAlg = key.Alg
+	self.TokenKid = key.Kid
+	return key, nil
+}
+
+// VerifyConfig 按配置验签, 配置Keys时根据token头部kid选择密钥并校验alg一致, 否则使用TokenKey
+// 本地密钥不存在时按payload中iss选择导入的外部签发方公钥, 验签后校验aud为该签发方配置的接收方
+func (self *Subject) VerifyConfig(token string, config JwtConfig, decode bool) error {
+	if config.Keys == nil {
+		return self.Verify(token, config.TokenKey, decode)
+	}
+	if len(token) == 0 {
+		return utils.Error("token is nil")
+	}
+	part := strings.Split(token, ".")
+	if len(part) != 3 {
+		return utils.Error("token part length invalid")
+	}
+	header := utils.Base64Decode(part[0])
+	if len(header) == 0 {
+		return utils.Error("token header base64 data decode failed")
+	}
+	kid := utils.GetJsonString(header, "kid")
+	key, err := config.Keys.Get(kid)
+	var payload []byte
+	var audience string
+	if err != nil {
+		if payload = utils.Base64Decode(part[1]); len(payload) == 0 {
+			return utils.Error("token part base64 data decode failed")
+		}
+		remote, aud, rerr := config.Keys.getRemote(utils.GetJsonString(payload, "iss"), kid)
+		if rerr != nil {
+			return rerr
+		}
+		key, audience = remote, aud
+	}
+	if alg := utils.GetJsonString(header, "alg"); alg != key.Alg {
+		return utils.Error("token alg [", alg, "] invalid")
+	}
+	if !key.Verify(utils.AddStr(part[0], ".", part[1]), part[2]) {
+		return utils.Error("token signature invalid")
+	}
+	if payload != nil && (len(audience) == 0 || utils.GetJsonString(payload, "aud") != audience) {
+		return utils.Error("token audience invalid")
+	}
+	return self.verifyPayload(part[1], decode)
+}
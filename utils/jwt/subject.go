@@ -33,18 +33,22 @@ type JwtConfig struct {
 	TokenAlg string
 	TokenTyp string
 	TokenExp int64
+	TokenKid string // 密钥标识,多密钥轮换时用于选择验签密钥
+	// 多密钥签名, 设置后按签发密钥签名并覆盖TokenAlg/TokenKid, 按kid选择验签密钥, TokenKey仍用于派生token通信密钥
+	Keys *KeySet
 }
 
 type Header struct {
 	Alg string `json:"alg"`
 	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
 }
 
 type Payload struct {
 	Sub string `json:"sub"` // 用户主体
 	Aud string `json:"aud"` // 接收token主体
 	Iss string `json:"iss"` // 签发token主体
-	Iat int64  `json:"iat"` // 授权token时间
+	Iat int64  `json:"iat"` // 授权token时间/毫秒, 用于按签发时间吊销
 	Exp int64  `json:"exp"` // 授权token过期时间
 	Dev string `json:"dev"` // 设备类型,web/app
 	Jti string `json:"jti"` // 唯一身份标识,主要用来作为一次性token,从而回避重放攻击
@@ -52,13 +56,14 @@ type Payload struct {
 }
 
 func (self *Subject) AddHeader(config JwtConfig) *Subject {
-	self.Header = &Header{Alg: config.TokenAlg, Typ: config.TokenTyp}
+	self.Header = &Header{Alg: config.TokenAlg, Typ: config.TokenTyp, Kid: config.TokenKid}
 	return self
 }
 
 func (self *Subject) Create(sub string) *Subject {
 	self.Payload = &Payload{
 		Sub: sub,
+		Iat: utils.UnixMilli(),
 		Exp: utils.UnixSecond() + TWO_WEEK,
 		Jti: utils.HMAC_MD5(utils.AddStr(utils.NextSID(), utils.RandStr2(16)), utils.GetUUID(), true),
 	}
@@ -69,7 +74,7 @@ func (self *Subject) Create(sub string) *Subject {
 func (self *Subject) Expired(exp int64) *Subject {
 	if exp > 0 {
 		if self.Payload.Iat > 0 {
-			self.Payload.Exp = self.Payload.Iat + exp
+			self.Payload.Exp = self.Payload.Iat/1000 + exp
 		} else {
 			self.Payload.Exp = utils.UnixSecond() + exp
 		}
@@ -99,6 +104,10 @@ func (self *Subject) Aud(aud string) *Subject {
 }
 
 func (self *Subject) Generate(config JwtConfig) string {
+	key, err := config.signKey()
+	if err != nil {
+		return ""
+	}
 	self.AddHeader(config)
 	header, err := utils.ToJsonBase64(self.Header)
 	if err != nil {
@@ -106,7 +115,7 @@ func (self *Subject) Generate(config JwtConfig) string {
 	}
 	if config.TokenExp > 0 {
 		if self.Payload.Iat > 0 {
-			self.Payload.Exp = self.Payload.Iat + config.TokenExp
+			self.Payload.Exp = self.Payload.Iat/1000 + config.TokenExp
 		} else {
 			self.Payload.Exp = utils.UnixSecond() + config.TokenExp
 		}
@@ -116,6 +125,13 @@ func (self *Subject) Generate(config JwtConfig) string {
 		return ""
 	}
 	part1 := utils.AddStr(header, ".", payload)
+	if key != nil {
+		sign, err := key.Sign(part1)
+		if err != nil {
+			return ""
+		}
+		return part1 + "." + sign
+	}
 	return part1 + "." + self.Signature(part1, config.TokenKey)
 }
 
@@ -127,7 +143,7 @@ func (self *Subject) Generate2(config JwtConfig) string {
 	}
 	if config.TokenExp > 0 {
 		if self.Payload.Iat > 0 {
-			self.Payload.Exp = self.Payload.Iat + config.TokenExp
+			self.Payload.Exp = self.Payload.Iat/1000 + config.TokenExp
 		} else {
 			self.Payload.Exp = utils.UnixSecond() + config.TokenExp
 		}
@@ -162,6 +178,10 @@ func (self *Subject) Verify(token, key string, decode bool) error {
 	if self.Signature(utils.AddStr(part0, ".", part1), key) != part2 {
 		return utils.Error("token signature invalid")
 	}
+	return self.verifyPayload(part1, decode)
+}
+
+func (self *Subject) verifyPayload(part1 string, decode bool) error {
 	b64 := utils.Base64Decode(part1)
 	if b64 == nil || len(b64) == 0 {
 		return utils.Error("token part base64 data decode failed")
@@ -268,6 +288,19 @@ func (self *Subject) getInt64Value(k string) int64 {
 	return utils.GetJsonInt64(self.payloadBytes, k)
 }
 
+// 获取token头部的密钥标识kid
+func GetTokenKid(token string) string {
+	index := strings.Index(token, ".")
+	if index <= 0 {
+		return ""
+	}
+	b64 := utils.Base64Decode(token[0:index])
+	if len(b64) == 0 {
+		return ""
+	}
+	return utils.GetJsonString(b64, "kid")
+}
+
 // 获取token的私钥
 func GetTokenSecret(token, secret string) string {
 	if len(token) == 0 {
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// 按时间有序的字符串ID, 前48位为毫秒时间戳, 同一毫秒内递增, 时钟回拨时沿用上次时间, 写入B+树/mongo索引时顺序追加
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu   sync.Mutex
+	ulidTime int64
+	ulidRand [10]byte
+
+	uuidv7Mu   sync.Mutex
+	uuidv7Time int64
+	uuidv7Seq  uint16
+)
+
+// NextULID 获取ULID, 26位Crockford Base32编码, 同一毫秒内随机部分加1保持递增
+func NextULID() string {
+	ulidMu.Lock()
+	now := time.Now().UnixMilli()
+	if now > ulidTime {
+		ulidTime = now
+		if _, err := rand.Read(ulidRand[:]); err != nil {
+			panic(err)
+		}
+	} else if !incrBytes(ulidRand[:]) { // 随机部分溢出时借用下一毫秒
+		ulidTime++
+		if _, err := rand.Read(ulidRand[:]); err != nil {
+			panic(err)
+		}
+	}
+	var id [16]byte
+	putMilli(id[:6], ulidTime)
+	copy(id[6:], ulidRand[:])
+	ulidMu.Unlock()
+	return encodeULID(id)
+}
+
+// NextUUIDv7 获取UUIDv7(RFC 9562), 36位带连字符格式, rand_a 12位作为同一毫秒内的递增序号
+func NextUUIDv7() string {
+	uuidv7Mu.Lock()
+	now := time.Now().UnixMilli()
+	var id [16]byte
+	if _, err := rand.Read(id[6:]); err != nil {
+		uuidv7Mu.Unlock()
+		panic(err)
+	}
+	if now > uuidv7Time {
+		uuidv7Time = now
+		uuidv7Seq = uint16(id[6]&0x07)<<8 | uint16(id[7]) // 随机起始值, 保留一半序号空间用于递增
+	} else {
+		uuidv7Seq++
+		if uuidv7Seq > 0x0fff { // 序号溢出时借用下一毫秒
+			uuidv7Time++
+			uuidv7Seq = 0
+		}
+	}
+	putMilli(id[:6], uuidv7Time)
+	id[6] = 0x70 | byte(uuidv7Seq>>8)
+	id[7] = byte(uuidv7Seq)
+	id[8] = id[8]&0x3f | 0x80
+	uuidv7Mu.Unlock()
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], id[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], id[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], id[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], id[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], id[10:])
+	return Bytes2Str(buf)
+}
+
+func putMilli(b []byte, milli int64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(milli)
+		milli >>= 8
+	}
+}
+
+// 按大端整数加1, 溢出时返回false
+func incrBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 128位按5位分组编码为26位, 首字符仅使用高3位
+func encodeULID(id [16]byte) string {
+	buf := make([]byte, 26)
+	var acc uint64
+	var bits uint
+	pos := 25
+	for i := 15; i >= 0; i-- {
+		acc |= uint64(id[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			buf[pos] = crockfordBase32[acc&0x1f]
+			pos--
+			acc >>= 5
+			bits -= 5
+		}
+	}
+	buf[pos] = crockfordBase32[acc&0x1f]
+	return Bytes2Str(buf)
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+const (
+	FailFast   = 0 // 首个错误即取消其余任务
+	CollectAll = 1 // 执行全部任务并汇总错误
+)
+
+// MultiError 并行任务错误汇总
+type MultiError struct {
+	Errors []error
+}
+
+func (self *MultiError) Error() string {
+	msgs := make([]string, 0, len(self.Errors))
+	for _, v := range self.Errors {
+		msgs = append(msgs, v.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap 返回首个错误, 支持errors.Is/As
+func (self *MultiError) Unwrap() error {
+	if len(self.Errors) == 0 {
+		return nil
+	}
+	return self.Errors[0]
+}
+
+// Parallel 以最大并发数limit执行任务, 首个错误时取消ctx并返回该错误
+func Parallel(ctx context.Context, limit int, tasks ...func(ctx context.Context) error) error {
+	return parallel(ctx, limit, FailFast, len(tasks), func(ctx context.Context, i int) error {
+		return tasks[i](ctx)
+	})
+}
+
+// ParallelAll 以最大并发数limit执行全部任务, 返回汇总的MultiError
+func ParallelAll(ctx context.Context, limit int, tasks ...func(ctx context.Context) error) error {
+	return parallel(ctx, limit, CollectAll, len(tasks), func(ctx context.Context, i int) error {
+		return tasks[i](ctx)
+	})
+}
+
+// ParallelMap 并行转换items, 结果顺序与items一致, mode为FailFast或CollectAll
+func ParallelMap[T any, R any](ctx context.Context, limit, mode int, items []T, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	result := make([]R, len(items))
+	err := parallel(ctx, limit, mode, len(items), func(ctx context.Context, i int) error {
+		r, err := fn(ctx, items[i])
+		if err != nil {
+			return err
+		}
+		result[i] = r
+		return nil
+	})
+	return result, err
+}
+
+func parallel(ctx context.Context, limit, mode, size int, call func(ctx context.Context, i int) error) error {
+	if size == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if limit <= 0 || limit > size {
+		limit = size
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := 0; i < size; i++ {
+		if mode == FailFast && ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					errs = append(errs, Error("parallel task panic: ", r))
+					mu.Unlock()
+					if mode == FailFast {
+						cancel()
+					}
+				}
+				<-sem
+				wg.Done()
+			}()
+			if err := call(ctx, i); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				if mode == FailFast {
+					cancel()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+	if mode == FailFast {
+		return errs[0]
+	}
+	return &MultiError{Errors: errs}
+}
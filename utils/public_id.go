@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+)
+
+// 对外ID混淆, 内部int64 ID经AES单块加密后输出22位URL安全字符串
+// 结果确定且不可枚举, 解码时校验填充位防止伪造, 所有节点需使用相同密钥, 未调用SetIDSecret前编码及解码均返回错误
+
+var (
+	idCipher atomic.Value // cipher.Block
+
+	ErrIDSecretNotSet = errors.New("public id secret not set")
+)
+
+// SetIDSecret 设置ID混淆密钥, 启动时必须设置, 修改后已下发的ID将无法解码
+func SetIDSecret(secret string) {
+	if len(secret) == 0 {
+		panic("id secret is nil")
+	}
+	key := sha256.Sum256(Str2Bytes(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err)
+	}
+	idCipher.Store(block)
+}
+
+func getIDCipher() (cipher.Block, error) {
+	if v := idCipher.Load(); v != nil {
+		return v.(cipher.Block), nil
+	}
+	return nil, ErrIDSecretNotSet
+}
+
+// EncodeID 混淆ID
+func EncodeID(id int64) (string, error) {
+	block, err := getIDCipher()
+	if err != nil {
+		return "", err
+	}
+	var src, dst [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(src[:8], uint64(id))
+	block.Encrypt(dst[:], src[:])
+	return base64.RawURLEncoding.EncodeToString(dst[:]), nil
+}
+
+// DecodeID 还原混淆ID
+func DecodeID(s string) (int64, error) {
+	block, err := getIDCipher()
+	if err != nil {
+		return 0, err
+	}
+	if len(s) != base64.RawURLEncoding.EncodedLen(aes.BlockSize) {
+		return 0, errors.New("public id invalid")
+	}
+	var src, dst [aes.BlockSize]byte
+	if _, err := base64.RawURLEncoding.Decode(src[:], Str2Bytes(s)); err != nil {
+		return 0, errors.New("public id invalid")
+	}
+	block.Decrypt(dst[:], src[:])
+	for _, v := range dst[8:] {
+		if v != 0 {
+			return 0, errors.New("public id invalid")
+		}
+	}
+	return int64(binary.BigEndian.Uint64(dst[:8])), nil
+}
+
+// DecodeIDs 批量还原混淆ID
+func DecodeIDs(list []string) ([]int64, error) {
+	result := make([]int64, 0, len(list))
+	for _, v := range list {
+		id, err := DecodeID(v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	JitterNone  = 0 // 不抖动
+	JitterFull  = 1 // 全抖动: [0, delay)
+	JitterEqual = 2 // 等抖动: [delay/2, delay)
+)
+
+// RetryPolicy 重试策略, 指数退避+随机抖动
+type RetryPolicy struct {
+	MaxAttempts     int                                               // 最大尝试次数, 0则不限制
+	InitialInterval time.Duration                                     // 首次重试间隔, 默认100ms
+	MaxInterval     time.Duration                                     // 最大重试间隔, 默认10s
+	Multiplier      float64                                           // 间隔增长倍数, 默认2, 1则固定间隔
+	Jitter          int                                               // 抖动模式 JitterNone/JitterFull/JitterEqual
+	MaxElapsed      time.Duration                                     // 最长累计耗时, 0则不限制
+	Retryable       func(err error) bool                              // 判断错误是否可重试, 为空则全部重试
+	Budget          *RetryBudget                                      // 重试预算, 为空则不限制
+	OnRetry         func(attempt int, delay time.Duration, err error) // 重试前回调
+}
+
+func (self RetryPolicy) delay(attempt int) time.Duration {
+	interval := self.InitialInterval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	max := self.MaxInterval
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	multiplier := self.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(interval)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	delay := time.Duration(d)
+	switch self.Jitter {
+	case JitterFull:
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	case JitterEqual:
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	return delay
+}
+
+// Retry 按策略重试执行fn, ctx取消/超过最大次数/超过最长耗时/错误不可重试时返回最后一次错误
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := time.Now()
+	if policy.Budget != nil {
+		policy.Budget.deposit()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		delay := policy.delay(attempt)
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			return err
+		}
+		if policy.Budget != nil && !policy.Budget.withdraw() {
+			return err
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, delay, err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// RetryBudget 重试预算, 限制重试次数占请求总数的比例, 避免下游故障时重试放大流量
+// 每次请求存入ratio个令牌, 每次重试消耗1个令牌, 另按每秒minPerSecond个补充保底令牌
+type RetryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	min    float64
+	max    float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRetryBudget 创建重试预算, ratio为重试占比(如0.1), minPerSecond为每秒保底重试数
+func NewRetryBudget(ratio float64, minPerSecond int) *RetryBudget {
+	if ratio < 0 || minPerSecond < 0 {
+		panic("retry budget invalid")
+	}
+	max := float64(minPerSecond) * 10
+	if max < 10 {
+		max = 10
+	}
+	return &RetryBudget{ratio: ratio, min: float64(minPerSecond), max: max, tokens: max, last: time.Now()}
+}
+
+func (self *RetryBudget) refill(now time.Time) {
+	self.tokens += now.Sub(self.last).Seconds() * self.min
+	if self.tokens > self.max {
+		self.tokens = self.max
+	}
+	self.last = now
+}
+
+func (self *RetryBudget) deposit() {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.refill(time.Now())
+	self.tokens += self.ratio
+	if self.tokens > self.max {
+		self.tokens = self.max
+	}
+}
+
+func (self *RetryBudget) withdraw() bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.refill(time.Now())
+	if self.tokens < 1 {
+		return false
+	}
+	self.tokens--
+	return true
+}
@@ -1,29 +1,52 @@
 package sdk
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"github.com/godaddy-x/eccrypto"
 	"github.com/godaddy-x/freego/ex"
+	"github.com/godaddy-x/freego/httpclient"
 	"github.com/godaddy-x/freego/node"
 	"github.com/godaddy-x/freego/utils"
+	"github.com/godaddy-x/freego/utils/jwt"
 	"github.com/valyala/fasthttp"
+	"net/http"
+	"sync"
 	"time"
 )
 
+// freego节点调用客户端, 按node请求信封{d,t,n,p,s}签名及加解密
+// 匿名请求(Plan 2): 服务端ECC公钥加密客户端随机密钥置于RandomCode请求头, 数据AES加密并以公钥签名, 响应以随机密钥验签解密
+// 登录请求(Plan 0/1): Authorization携带token, 以token通信密钥签名, Plan 1时AES加密数据, 设置AuthObject后token将过期时自动重新登录
+// 通过KeyPath获取的公钥须与KeyPin一致, 防止公钥被中间人替换, 也可通过SetPublicKey直接指定公钥
+// SetClient后复用httpclient连接池/超时/熔断, 重试时重发原请求(不重新生成nonce及签名), 仅重试请求未发出的连接错误, ctx设置幂等键时按客户端重试策略重试
+
 type AuthToken struct {
 	Token   string `json:"token"`
 	Secret  string `json:"secret"`
 	Expired int64  `json:"expired"`
 }
 
+type idempotencyKey struct{}
+
+// WithIdempotencyKey 设置请求幂等键(Idempotency-Key请求头), 服务端按幂等键去重时请求可按客户端重试策略重试
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
 type HttpSDK struct {
 	Debug      bool
 	Domain     string
 	AuthDomain string
 	KeyPath    string
 	LoginPath  string
+	KeyPin     string // 服务端公钥摘要, Base64(SHA256(公钥)), 通过KeyPath获取公钥时必须设置
+	mu         sync.RWMutex
+	loginMu    sync.Mutex
+	client     *httpclient.Client
 	publicKey  string
+	remoteKey  string // 已通过KeyPin校验的服务端公钥
 	language   string
 	timeout    int64
 	authObject interface{}
@@ -32,11 +55,31 @@ type HttpSDK struct {
 
 // 请使用指针对象
 func (s *HttpSDK) AuthObject(object interface{}) {
+	s.mu.Lock()
 	s.authObject = object
+	s.mu.Unlock()
 }
 
 func (s *HttpSDK) AuthToken(object AuthToken) {
+	s.mu.Lock()
 	s.authToken = object
+	s.mu.Unlock()
+}
+
+// SignToken 服务间调用时按共享JwtConfig签发token并设置为登录凭证
+func (s *HttpSDK) SignToken(sub string, config jwt.JwtConfig) error {
+	subject := &jwt.Subject{}
+	token := subject.Create(sub).Dev("API").Generate(config)
+	if len(token) == 0 {
+		return ex.Throw{Msg: "sign token failed"}
+	}
+	s.AuthToken(AuthToken{Token: token, Secret: jwt.GetTokenSecret(token, config.TokenKey), Expired: subject.Payload.Exp})
+	return nil
+}
+
+// SetClient 使用httpclient发送请求, 复用连接池/超时/熔断及重试策略
+func (s *HttpSDK) SetClient(client *httpclient.Client) {
+	s.client = client
 }
 
 func (s *HttpSDK) SetTimeout(timeout int64) {
@@ -65,27 +108,83 @@ func (s *HttpSDK) getURI(path string) string {
 	return s.Domain + path
 }
 
+// 发送请求, 重试时请求内容不变
+func (s *HttpSDK) do(ctx context.Context, request *fasthttp.Request, response *fasthttp.Response) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if len(key) > 0 {
+		request.Header.Set("Idempotency-Key", key)
+	}
+	if s.client != nil {
+		if len(key) > 0 {
+			return s.client.Do(ctx, request, response)
+		}
+		return s.client.DoOnce(ctx, request, response)
+	}
+	timeout := 120 * time.Second
+	if s.timeout > 0 {
+		timeout = time.Duration(s.timeout) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	if v, ok := ctx.Deadline(); ok && v.Before(deadline) {
+		deadline = v
+	}
+	if err := fasthttp.DoDeadline(request, response, deadline); err != nil {
+		return ex.Throw{Msg: "post request failed: " + err.Error()}
+	}
+	return nil
+}
+
 func (s *HttpSDK) GetPublicKey() (string, error) {
+	return s.GetPublicKeyContext(context.Background())
+}
+
+// GetPublicKeyContext 获取服务端公钥, 通过KeyPath获取时校验KeyPin
+func (s *HttpSDK) GetPublicKeyContext(ctx context.Context) (string, error) {
 	if len(s.publicKey) > 0 {
 		return s.publicKey, nil
 	}
+	s.mu.RLock()
+	key := s.remoteKey
+	s.mu.RUnlock()
+	if len(key) > 0 {
+		return key, nil
+	}
+	if len(s.KeyPin) == 0 {
+		return "", ex.Throw{Msg: "public key pin is nil"}
+	}
 	request := fasthttp.AcquireRequest()
-	request.Header.SetMethod("GET")
 	defer fasthttp.ReleaseRequest(request)
 	response := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(response)
-	_, b, err := fasthttp.Get(nil, s.getURI(s.KeyPath))
-	if err != nil {
-		return "", ex.Throw{Msg: "request public key failed"}
+	request.Header.SetMethod("GET")
+	request.SetRequestURI(s.getURI(s.KeyPath))
+	if err := s.do(ctx, request, response); err != nil {
+		return "", ex.Throw{Msg: "request public key failed", Err: err}
 	}
+	b := response.Body()
 	if len(b) == 0 {
 		return "", ex.Throw{Msg: "request public key invalid"}
 	}
-	return utils.Bytes2Str(b), nil
+	key = string(b)
+	if utils.SHA256(key, true) != s.KeyPin {
+		return "", ex.Throw{Msg: "public key pin mismatch"}
+	}
+	s.mu.Lock()
+	s.remoteKey = key
+	s.mu.Unlock()
+	return key, nil
 }
 
 // 对象请使用指针
 func (s *HttpSDK) PostByECC(path string, requestObj, responseObj interface{}) error {
+	return s.PostByECCContext(context.Background(), path, requestObj, responseObj)
+}
+
+// PostByECCContext 匿名请求(Plan 2), 对象请使用指针
+func (s *HttpSDK) PostByECCContext(ctx context.Context, path string, requestObj, responseObj interface{}) error {
 	if len(path) == 0 || requestObj == nil || responseObj == nil {
 		return ex.Throw{Msg: "params invalid"}
 	}
@@ -99,7 +198,7 @@ func (s *HttpSDK) PostByECC(path string, requestObj, responseObj interface{}) er
 		Nonce: utils.RandNonce(),
 		Plan:  int64(2),
 	}
-	publicKey, err := s.GetPublicKey()
+	publicKey, err := s.GetPublicKeyContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -135,12 +234,8 @@ func (s *HttpSDK) PostByECC(path string, requestObj, responseObj interface{}) er
 	defer fasthttp.ReleaseRequest(request)
 	response := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(response)
-	timeout := 120 * time.Second
-	if s.timeout > 0 {
-		timeout = time.Duration(s.timeout) * time.Second
-	}
-	if err := fasthttp.DoTimeout(request, response, timeout); err != nil {
-		return ex.Throw{Msg: "post request failed: " + err.Error()}
+	if err := s.do(ctx, request, response); err != nil {
+		return err
 	}
 	respBytes := response.Body()
 	s.debugOut("response data: ")
@@ -179,55 +274,104 @@ func (s *HttpSDK) PostByECC(path string, requestObj, responseObj interface{}) er
 	return nil
 }
 
-func (s *HttpSDK) valid() bool {
-	if len(s.authToken.Token) == 0 {
+// PostByGuest 游客模式请求, 请求及响应为原始JSON, 对象请使用指针
+func (s *HttpSDK) PostByGuest(path string, requestObj, responseObj interface{}) error {
+	return s.PostByGuestContext(context.Background(), path, requestObj, responseObj)
+}
+
+func (s *HttpSDK) PostByGuestContext(ctx context.Context, path string, requestObj, responseObj interface{}) error {
+	if len(path) == 0 || requestObj == nil || responseObj == nil {
+		return ex.Throw{Msg: "params invalid"}
+	}
+	bytesData, err := utils.JsonMarshal(requestObj)
+	if err != nil {
+		return ex.Throw{Msg: "request data JsonMarshal invalid"}
+	}
+	request := fasthttp.AcquireRequest()
+	request.Header.SetContentType("application/json;charset=UTF-8")
+	request.Header.Set("Language", s.language)
+	request.Header.SetMethod("POST")
+	request.SetRequestURI(s.getURI(path))
+	request.SetBody(bytesData)
+	defer fasthttp.ReleaseRequest(request)
+	response := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(response)
+	if err := s.do(ctx, request, response); err != nil {
+		return err
+	}
+	if code := response.StatusCode(); code != http.StatusOK {
+		return ex.Throw{Code: code, Msg: utils.Bytes2Str(response.Body())}
+	}
+	if err := utils.JsonUnmarshal(response.Body(), responseObj); err != nil {
+		return ex.Throw{Msg: "response data JsonUnmarshal invalid"}
+	}
+	return nil
+}
+
+func (s *HttpSDK) valid(token AuthToken) bool {
+	if len(token.Token) == 0 {
 		return false
 	}
-	if len(s.authToken.Secret) == 0 {
+	if len(token.Secret) == 0 {
 		return false
 	}
-	if utils.UnixSecond() > s.authToken.Expired-3600 {
+	if utils.UnixSecond() > token.Expired-3600 {
 		return false
 	}
 	return true
 }
 
-func (s *HttpSDK) checkAuth() error {
-	if s.valid() {
-		return nil
+// 获取有效token, 将过期且已设置授权对象时重新登录, 并发请求仅登录一次
+func (s *HttpSDK) checkAuth(ctx context.Context) (AuthToken, error) {
+	s.mu.RLock()
+	token, authObject := s.authToken, s.authObject
+	s.mu.RUnlock()
+	if s.valid(token) {
+		return token, nil
 	}
-	if s.authObject == nil { // 没授权对象则忽略
-		return nil
+	if authObject == nil { // 没授权对象则忽略
+		return token, nil
 	}
 	if len(s.Domain) == 0 {
-		return ex.Throw{Msg: "domain is nil"}
+		return token, ex.Throw{Msg: "domain is nil"}
 	}
 	if len(s.KeyPath) == 0 {
-		return ex.Throw{Msg: "keyPath is nil"}
+		return token, ex.Throw{Msg: "keyPath is nil"}
 	}
 	if len(s.LoginPath) == 0 {
-		return ex.Throw{Msg: "loginPath is nil"}
+		return token, ex.Throw{Msg: "loginPath is nil"}
 	}
-	if s.authObject == nil {
-		return ex.Throw{Msg: "authObject is nil"}
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	s.mu.RLock()
+	token = s.authToken
+	s.mu.RUnlock()
+	if s.valid(token) { // 其他请求已完成登录
+		return token, nil
 	}
 	responseObj := AuthToken{}
-	if err := s.PostByECC(s.LoginPath, s.authObject, &responseObj); err != nil {
-		return err
+	if err := s.PostByECCContext(ctx, s.LoginPath, authObject, &responseObj); err != nil {
+		return token, err
 	}
 	s.AuthToken(responseObj)
-	return nil
+	return responseObj, nil
 }
 
 // PostByAuth 对象请使用指针
 func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, encrypted ...bool) error {
+	return s.PostByAuthContext(context.Background(), path, requestObj, responseObj, encrypted...)
+}
+
+// PostByAuthContext 登录状态请求, encrypted为true时使用AES加密(Plan 1), 否则Base64(Plan 0), 对象请使用指针
+func (s *HttpSDK) PostByAuthContext(ctx context.Context, path string, requestObj, responseObj interface{}, encrypted ...bool) error {
 	if len(path) == 0 || requestObj == nil || responseObj == nil {
 		return ex.Throw{Msg: "params invalid"}
 	}
-	if err := s.checkAuth(); err != nil {
+	authToken, err := s.checkAuth(ctx)
+	if err != nil {
 		return err
 	}
-	if len(s.authToken.Token) == 0 || len(s.authToken.Secret) == 0 {
+	if len(authToken.Token) == 0 || len(authToken.Secret) == 0 {
 		return ex.Throw{Msg: "token or secret can't be empty"}
 	}
 	jsonData, err := utils.JsonMarshal(requestObj)
@@ -241,7 +385,7 @@ func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, e
 		Plan:  0,
 	}
 	if len(encrypted) > 0 && encrypted[0] {
-		jsonBody.Data = utils.AesEncrypt2(jsonBody.Data.([]byte), s.authToken.Secret)
+		jsonBody.Data = utils.AesEncrypt2(jsonBody.Data.([]byte), authToken.Secret)
 		jsonBody.Plan = 1
 		s.debugOut("request data encrypted: ", jsonBody.Data)
 	} else {
@@ -249,7 +393,7 @@ func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, e
 		jsonBody.Data = d
 		s.debugOut("request data base64: ", jsonBody.Data)
 	}
-	jsonBody.Sign = utils.HMAC_SHA256(utils.AddStr(path, jsonBody.Data.(string), jsonBody.Nonce, jsonBody.Time, jsonBody.Plan), s.authToken.Secret, true)
+	jsonBody.Sign = utils.HMAC_SHA256(utils.AddStr(path, jsonBody.Data.(string), jsonBody.Nonce, jsonBody.Time, jsonBody.Plan), authToken.Secret, true)
 	bytesData, err := utils.JsonMarshal(jsonBody)
 	if err != nil {
 		return ex.Throw{Msg: "jsonBody data JsonMarshal invalid"}
@@ -258,7 +402,7 @@ func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, e
 	s.debugOut(utils.Bytes2Str(bytesData))
 	request := fasthttp.AcquireRequest()
 	request.Header.SetContentType("application/json;charset=UTF-8")
-	request.Header.Set("Authorization", s.authToken.Token)
+	request.Header.Set("Authorization", authToken.Token)
 	request.Header.Set("Language", s.language)
 	request.Header.SetMethod("POST")
 	request.SetRequestURI(s.getURI(path))
@@ -266,12 +410,8 @@ func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, e
 	defer fasthttp.ReleaseRequest(request)
 	response := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(response)
-	timeout := 120 * time.Second
-	if s.timeout > 0 {
-		timeout = time.Duration(s.timeout) * time.Second
-	}
-	if err := fasthttp.DoTimeout(request, response, timeout); err != nil {
-		return ex.Throw{Msg: "post request failed: " + err.Error()}
+	if err := s.do(ctx, request, response); err != nil {
+		return err
 	}
 	respBytes := response.Body()
 	s.debugOut("response data: ")
@@ -292,8 +432,8 @@ func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, e
 		return ex.Throw{Msg: respData.Message}
 	}
 	//fmt.Println(utils.AddStr(path, respData.Data, respData.Nonce, respData.Time, respData.Plan))
-	//fmt.Println(s.authToken.Secret)
-	validSign := utils.HMAC_SHA256(utils.AddStr(path, respData.Data, respData.Nonce, respData.Time, respData.Plan), s.authToken.Secret, true)
+	//fmt.Println(authToken.Secret)
+	validSign := utils.HMAC_SHA256(utils.AddStr(path, respData.Data, respData.Nonce, respData.Time, respData.Plan), authToken.Secret, true)
 	if validSign != respData.Sign {
 		return ex.Throw{Msg: "post response sign verify invalid"}
 	}
@@ -303,7 +443,7 @@ func (s *HttpSDK) PostByAuth(path string, requestObj, responseObj interface{}, e
 		dec = utils.Base64Decode(respData.Data)
 		s.debugOut("response data base64: ", string(dec))
 	} else if respData.Plan == 1 {
-		dec, err = utils.AesDecrypt2(respData.Data.(string), s.authToken.Secret)
+		dec, err = utils.AesDecrypt2(respData.Data.(string), authToken.Secret)
 		if err != nil {
 			return ex.Throw{Msg: "post response data AES decrypt failed"}
 		}
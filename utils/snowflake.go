@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"github.com/godaddy-x/freego/utils/snowflake"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 雪花节点由数据中心ID(高5位)及机器ID(低5位)组成, 同一集群内每个实例须唯一
+// 默认读取环境变量FREEGO_DATACENTER_ID/FREEGO_WORKER_ID, 未设置时为0, 多副本部署时应通过InitSnowflake或租约分配
+// 环境变量无效时使用0并记录错误, 可通过SnowflakeEnvError检查(preflight启动检测包含该项)
+
+const (
+	DatacenterIdEnvName = "FREEGO_DATACENTER_ID" // 数据中心ID环境变量
+	WorkerIdEnvName     = "FREEGO_WORKER_ID"     // 机器ID环境变量
+
+	SnowflakeWorkerBits = 5
+	MaxDatacenterId     = 1<<(10-SnowflakeWorkerBits) - 1 // 数据中心ID最大值
+	MaxWorkerId         = 1<<SnowflakeWorkerBits - 1      // 机器ID最大值
+)
+
+var (
+	snowflakeNode   atomic.Value // *snowflake.Node, nil时暂停生成
+	snowflakeEnvErr error
+)
+
+func init() {
+	datacenter, err := snowflakeEnv(DatacenterIdEnvName)
+	if err == nil {
+		var worker int64
+		if worker, err = snowflakeEnv(WorkerIdEnvName); err == nil {
+			err = InitSnowflake(datacenter, worker)
+		}
+	}
+	if err != nil {
+		snowflakeEnvErr = err
+		log.Println("snowflake env invalid, use default node 0: ", err)
+		_ = InitSnowflake(0, 0)
+	}
+}
+
+func snowflakeEnv(name string) (int64, error) {
+	v := os.Getenv(name)
+	if len(v) == 0 {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, Error(name, " invalid: ", v)
+	}
+	return id, nil
+}
+
+// SnowflakeEnvError 环境变量FREEGO_DATACENTER_ID/FREEGO_WORKER_ID无效时返回错误
+func SnowflakeEnvError() error {
+	return snowflakeEnvErr
+}
+
+// 租约丢失时暂停ID生成, 等待重新分配机器ID后恢复
+func getSnowflakeNode() *snowflake.Node {
+	for {
+		if node := snowflakeNode.Load().(*snowflake.Node); node != nil {
+			return node
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func suspendSnowflake() {
+	snowflakeNode.Store((*snowflake.Node)(nil))
+}
+
+// InitSnowflake 设置雪花节点数据中心ID及机器ID, 运行时可重复调用切换节点
+func InitSnowflake(datacenter, worker int64) error {
+	if datacenter < 0 || datacenter > MaxDatacenterId {
+		return Error("snowflake datacenter id range [0-", MaxDatacenterId, "]: ", datacenter)
+	}
+	if worker < 0 || worker > MaxWorkerId {
+		return Error("snowflake worker id range [0-", MaxWorkerId, "]: ", worker)
+	}
+	node, err := snowflake.NewNode(datacenter<<SnowflakeWorkerBits | worker)
+	if err != nil {
+		return err
+	}
+	snowflakeNode.Store(node)
+	return nil
+}
+
+// SnowflakeWorker 获取当前雪花节点数据中心ID及机器ID
+func SnowflakeWorker() (int64, int64) {
+	node := getSnowflakeNode().Node()
+	return node >> SnowflakeWorkerBits, node & MaxWorkerId
+}
+
+// NextIIDs 批量获取递增的雪花int64 ID, 用于批量写入
+func NextIIDs(n int) []int64 {
+	ids := getSnowflakeNode().GenerateBatch(n)
+	result := make([]int64, len(ids))
+	for i, v := range ids {
+		result[i] = v.Int64()
+	}
+	return result
+}
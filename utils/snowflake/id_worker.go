@@ -25,6 +25,10 @@ var (
 	// Remember, you have a total 22 bits to share between Node/Step
 	StepBits uint8 = 12
 
+	// MaxBackward is the max clock rollback in milliseconds to wait for,
+	// larger rollbacks keep the last timestamp instead of blocking
+	MaxBackward int64 = 10
+
 	nodeMax   int64 = -1 ^ (-1 << NodeBits)
 	nodeMask  int64 = nodeMax << StepBits
 	stepMask  int64 = -1 ^ (-1 << StepBits)
@@ -127,36 +131,60 @@ func (n *Node) GetValidNow() int64 {
 
 // Generate creates and returns a unique snowflake ID
 func (n *Node) Generate() ID {
+	n.mu.Lock()
+	r := n.next()
+	n.mu.Unlock()
+	return r
+}
 
+// GenerateBatch creates count unique snowflake IDs under a single lock,
+// IDs are increasing in the returned order.
+func (n *Node) GenerateBatch(count int) []ID {
+	if count <= 0 {
+		return nil
+	}
+	result := make([]ID, count)
 	n.mu.Lock()
+	for i := range result {
+		result[i] = n.next()
+	}
+	n.mu.Unlock()
+	return result
+}
 
-	now := n.GetNow()
+// Node returns the node number of the generator
+func (n *Node) Node() int64 {
+	return n.node
+}
 
-	if n.time > now {
+// next waits out clock rollbacks up to MaxBackward, larger rollbacks keep
+// the last timestamp and borrow the next millisecond once the step is
+// exhausted, so IDs never repeat and keep increasing. Caller holds n.mu.
+func (n *Node) next() ID {
+	now := n.GetNow()
+	if now < n.time && n.time-now <= MaxBackward {
 		now = n.GetValidNow()
 	}
-
-	if n.time == now {
+	if now > n.time {
+		n.step = 0
+		n.time = now
+	} else {
 		n.step = (n.step + 1) & stepMask
-
 		if n.step == 0 {
-			for now <= n.time {
-				now = n.GetNow()
+			if now == n.time {
+				for now <= n.time {
+					now = n.GetNow()
+				}
+				n.time = now
+			} else {
+				n.time++
 			}
 		}
-	} else {
-		n.step = 0
 	}
-
-	n.time = now
-
-	r := ID((now-Epoch)<<timeShift |
+	return ID((n.time-Epoch)<<timeShift |
 		(n.node << nodeShift) |
 		(n.step),
 	)
-
-	n.mu.Unlock()
-	return r
 }
 
 // Int64 returns an int64 of the snowflake ID
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 雪花机器ID租约, 由redis/consul等实现WorkerLeaseStore, 每个机器ID对应一个带过期时间的租约, 实例定时续约, 宕机后租约过期由其他实例复用
+// 租约丢失或续约持续失败至租约即将过期时暂停ID生成(生成调用阻塞等待), 重新分配机器ID后切换雪花节点并恢复, 避免多副本机器ID冲突
+
+// WorkerLeaseStore 机器ID租约存储
+type WorkerLeaseStore interface {
+	Acquire(datacenter, worker int64) (bool, error) // 抢占机器ID, 已被占用返回false
+	Renew(datacenter, worker int64) (bool, error)   // 续约, 租约已丢失返回false
+	Release(datacenter, worker int64) error         // 释放租约
+}
+
+type workerLease struct {
+	store      WorkerLeaseStore
+	datacenter int64
+	worker     int64
+	ttl        time.Duration
+	interval   time.Duration
+	renewed    time.Time // 最近一次抢占或续约成功的时间
+	suspended  bool
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// LeaseSnowflakeWorker 分配数据中心下空闲的机器ID并设置雪花节点, ttl为租约时间, 按ttl/3续约, 返回释放函数, 停机时调用释放租约
+func LeaseSnowflakeWorker(store WorkerLeaseStore, datacenter int64, ttl time.Duration) (func() error, error) {
+	if datacenter < 0 || datacenter > MaxDatacenterId {
+		return nil, Error("snowflake datacenter id range [0-", MaxDatacenterId, "]: ", datacenter)
+	}
+	if ttl < 3*time.Second {
+		return nil, Error("snowflake worker lease ttl must be >= 3s")
+	}
+	lease := &workerLease{store: store, datacenter: datacenter, ttl: ttl, interval: ttl / 3, stop: make(chan struct{}), done: make(chan struct{})}
+	if err := lease.acquire(); err != nil {
+		return nil, err
+	}
+	go lease.run()
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			close(lease.stop)
+			<-lease.done
+			err = lease.store.Release(lease.datacenter, lease.worker)
+		})
+		return err
+	}, nil
+}
+
+// 从随机位置开始抢占空闲机器ID, 减少多实例同时启动时的冲突
+func (self *workerLease) acquire() error {
+	size := int64(MaxWorkerId + 1)
+	offset := rand.Int63n(size)
+	for i := int64(0); i < size; i++ {
+		worker := (offset + i) % size
+		start := time.Now()
+		ok, err := self.store.Acquire(self.datacenter, worker)
+		if err != nil {
+			return Error("snowflake worker lease failed: ", err)
+		}
+		if !ok {
+			continue
+		}
+		if err := InitSnowflake(self.datacenter, worker); err != nil {
+			_ = self.store.Release(self.datacenter, worker)
+			return err
+		}
+		self.worker, self.renewed, self.suspended = worker, start, false
+		log.Printf("snowflake worker【%d-%d】lease successful", self.datacenter, worker)
+		return nil
+	}
+	return Error("snowflake worker lease failed: datacenter [", self.datacenter, "] no idle worker id")
+}
+
+func (self *workerLease) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(self.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stop:
+			return
+		case <-ticker.C:
+			if err := self.renew(); err != nil {
+				log.Println("snowflake worker lease renew failed: ", err)
+			}
+		}
+	}
+}
+
+// 续约失败(网络异常)且下次续约前租约仍有效时等待下次续约, 否则暂停ID生成并重新分配
+func (self *workerLease) renew() error {
+	start := time.Now()
+	ok, err := self.store.Renew(self.datacenter, self.worker)
+	if ok && err == nil {
+		if self.suspended { // 暂停期间租约未被占用, 恢复原机器ID
+			if err := InitSnowflake(self.datacenter, self.worker); err != nil {
+				return err
+			}
+			self.suspended = false
+		}
+		self.renewed = start
+		return nil
+	}
+	if err != nil && time.Since(self.renewed)+self.interval < self.ttl {
+		return err
+	}
+	if !self.suspended {
+		suspendSnowflake()
+		self.suspended = true
+		log.Printf("snowflake worker【%d-%d】lease lost, id generation suspended, reallocate: %v", self.datacenter, self.worker, err)
+	}
+	return self.acquire()
+}
@@ -0,0 +1,431 @@
+package valid
+
+import (
+	"fmt"
+	"github.com/godaddy-x/freego/utils"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	tagName  = "valid"
+	maxDepth = 8
+)
+
+// Func 自定义校验方法, value为字段值(指针已解引用), param为规则参数, 校验失败返回错误信息
+type Func func(value interface{}, param string) error
+
+// FieldError 单个字段校验失败项
+type FieldError struct {
+	Field string `json:"field"` // 字段名, 优先使用json标签, 嵌套字段以.分隔
+	Rule  string `json:"rule"`
+	Msg   string `json:"msg"`
+}
+
+// Errors 全部字段校验失败项
+type Errors []*FieldError
+
+func (self Errors) Error() string {
+	msgs := make([]string, 0, len(self))
+	for _, v := range self {
+		msgs = append(msgs, utils.AddStr(v.Field, " ", v.Msg))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type rule struct {
+	name  string
+	check func(v reflect.Value) error
+}
+
+// 类型字段解析结果, 标签无效时记录错误
+type typeFields struct {
+	fields []*field
+	err    error
+}
+
+type field struct {
+	index    int
+	name     string
+	required bool
+	dive     bool
+	embedded bool
+	rules    []rule
+}
+
+var (
+	fieldCache sync.Map // reflect.Type -> *typeFields
+	mu         sync.RWMutex
+	customs    = map[string]Func{}
+	patterns   = map[string]*regexp.Regexp{
+		"email":  regexp.MustCompile(utils.EMAIL),
+		"mobile": regexp.MustCompile(utils.MOBILE),
+		"ipv4":   regexp.MustCompile(utils.IPV4),
+		"url":    regexp.MustCompile(utils.URL),
+		"idno":   regexp.MustCompile(utils.IDNO),
+	}
+)
+
+// Register 注册自定义校验规则, 标签中以name或name=param使用, 需在Prepare及首次校验前注册
+func Register(name string, fn Func) {
+	if len(name) == 0 || fn == nil {
+		panic("valid rule name or function is nil")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	customs[name] = fn
+}
+
+// Validate 按valid标签校验结构体, 返回全部校验失败项, 校验通过返回nil
+// 支持规则: required、len=1-64(或len=8)、min=1、max=100、in=a|b|c、email、mobile、ipv4、url、idno、dive、regexp=^\w+$(须为最后一项)及自定义规则
+// 非required字段为零值时跳过全部规则(含min/max), required指针字段零值仍按规则校验, 匿名嵌入结构体自动校验, 命名结构体及切片元素需使用dive
+// 标签无效时返回普通错误而非Errors, 应在启动时通过Prepare提前发现
+func Validate(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	var errs Errors
+	if err := validate(reflect.ValueOf(v), "", &errs, 0); err != nil {
+		return err
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Prepare 预解析结构体及其嵌入/dive字段类型的校验标签, 标签无效时返回错误, 用于路由注册及服务启动时校验
+func Prepare(v ...interface{}) error {
+	for _, item := range v {
+		if item == nil {
+			continue
+		}
+		if err := prepare(reflect.TypeOf(item), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prepare(t reflect.Type, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields, err := getFields(t)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.embedded || f.dive {
+			if err := prepare(t.Field(f.index).Type, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validate(v reflect.Value, prefix string, errs *Errors, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validate(v.Index(i), utils.AddStr(prefix, "[", i, "]"), errs, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+	fields, err := getFields(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if f.embedded {
+			if err := validate(fv, prefix, errs, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		name := f.name
+		if len(prefix) > 0 {
+			name = utils.AddStr(prefix, ".", f.name)
+		}
+		if err := f.check(fv); err != nil {
+			err.Field = name
+			*errs = append(*errs, err)
+			continue
+		}
+		if f.dive {
+			if err := validate(fv, name, errs, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 非required字段零值视为未传值跳过全部规则; required指针字段非nil即为已传值, 零值也按规则校验
+func (self *field) check(v reflect.Value) *FieldError {
+	isPtr := false
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if self.required {
+				return &FieldError{Rule: "required", Msg: "is required"}
+			}
+			return nil
+		}
+		isPtr = true
+		v = v.Elem()
+	}
+	if isZero(v) {
+		if !self.required {
+			return nil
+		}
+		if !isPtr {
+			return &FieldError{Rule: "required", Msg: "is required"}
+		}
+	}
+	for _, r := range self.rules {
+		if err := r.check(v); err != nil {
+			return &FieldError{Rule: r.name, Msg: err.Error()}
+		}
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func getFields(t reflect.Type) ([]*field, error) {
+	if v, b := fieldCache.Load(t); b {
+		result := v.(*typeFields)
+		return result.fields, result.err
+	}
+	var fields []*field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get(tagName)
+		if tag == "-" || (len(sf.PkgPath) > 0 && !sf.Anonymous) {
+			continue
+		}
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if len(tag) == 0 {
+			if sf.Anonymous && ft.Kind() == reflect.Struct {
+				fields = append(fields, &field{index: i, embedded: true})
+			}
+			continue
+		}
+		f, err := parseField(t, sf, ft, i, tag)
+		if err != nil {
+			fieldCache.Store(t, &typeFields{err: err})
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	fieldCache.Store(t, &typeFields{fields: fields})
+	return fields, nil
+}
+
+func parseField(t reflect.Type, sf reflect.StructField, ft reflect.Type, index int, tag string) (*field, error) {
+	f := &field{index: index, name: sf.Name}
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; len(name) > 0 && name != "-" {
+		f.name = name
+	}
+	for len(tag) > 0 {
+		var item string
+		if strings.HasPrefix(tag, "regexp=") { // 正则可能包含逗号, 取剩余全部内容
+			item, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			item, tag = tag[:i], tag[i+1:]
+		} else {
+			item, tag = tag, ""
+		}
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		name, param := item, ""
+		if i := strings.IndexByte(item, '='); i > 0 {
+			name, param = item[:i], item[i+1:]
+		}
+		switch name {
+		case "required":
+			f.required = true
+		case "dive":
+			f.dive = true
+		default:
+			check, err := createRule(name, param, ft)
+			if err != nil {
+				return nil, utils.Error("valid tag invalid [", t.String(), ".", sf.Name, "]: ", err.Error())
+			}
+			f.rules = append(f.rules, rule{name: name, check: check})
+		}
+	}
+	return f, nil
+}
+
+func parseRange(param string) (float64, float64, error) {
+	var min, max string
+	if i := strings.IndexByte(param, '-'); i > 0 {
+		min, max = param[:i], param[i+1:]
+	} else {
+		min, max = param, param
+	}
+	a, err := strconv.ParseFloat(min, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.ParseFloat(max, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if a > b {
+		return 0, 0, utils.Error("range min > max: ", param)
+	}
+	return a, b, nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return float64(v.Int())
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func createRule(name, param string, ft reflect.Type) (func(v reflect.Value) error, error) {
+	switch name {
+	case "len":
+		switch ft.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		default:
+			return nil, utils.Error("len only supports string/slice/map")
+		}
+		min, max, err := parseRange(param)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) error {
+			var n int
+			if v.Kind() == reflect.String {
+				n = utf8.RuneCountInString(v.String())
+			} else {
+				n = v.Len()
+			}
+			if float64(n) < min || float64(n) > max {
+				if min == max {
+					return utils.Error("length must be ", param)
+				}
+				return utils.Error("length must be between ", strconv.FormatFloat(min, 'f', -1, 64), " and ", strconv.FormatFloat(max, 'f', -1, 64))
+			}
+			return nil
+		}, nil
+	case "min", "max":
+		if !isNumber(ft.Kind()) {
+			return nil, utils.Error(name, " only supports number")
+		}
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return nil, err
+		}
+		if name == "min" {
+			return func(v reflect.Value) error {
+				if toFloat(v) < limit {
+					return utils.Error("must be >= ", param)
+				}
+				return nil
+			}, nil
+		}
+		return func(v reflect.Value) error {
+			if toFloat(v) > limit {
+				return utils.Error("must be <= ", param)
+			}
+			return nil
+		}, nil
+	case "in":
+		if len(param) == 0 {
+			return nil, utils.Error("in values is nil")
+		}
+		values := strings.Split(param, "|")
+		return func(v reflect.Value) error {
+			s := fmt.Sprint(v.Interface())
+			for _, value := range values {
+				if value == s {
+					return nil
+				}
+			}
+			return utils.Error("must be one of [", strings.Join(values, ", "), "]")
+		}, nil
+	case "regexp":
+		if ft.Kind() != reflect.String {
+			return nil, utils.Error("regexp only supports string")
+		}
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return nil, err
+		}
+		return matchRule(re), nil
+	}
+	if re, b := patterns[name]; b {
+		if ft.Kind() != reflect.String {
+			return nil, utils.Error(name, " only supports string")
+		}
+		return matchRule(re), nil
+	}
+	mu.RLock()
+	fn, b := customs[name]
+	mu.RUnlock()
+	if !b {
+		return nil, utils.Error("rule not found: ", name)
+	}
+	return func(v reflect.Value) error {
+		return fn(v.Interface(), param)
+	}, nil
+}
+
+func matchRule(re *regexp.Regexp) func(v reflect.Value) error {
+	return func(v reflect.Value) error {
+		if !re.MatchString(v.String()) {
+			return utils.Error("format invalid")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package valid
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"testing"
+)
+
+type validBase struct {
+	Sign string `json:"s" valid:"required"`
+}
+
+type ValidItem struct {
+	Sku   string `json:"sku" valid:"required,regexp=^[A-Z]{2}\\d{2,4}$"`
+	Count int    `json:"count" valid:"min=1,max=99"`
+}
+
+type ValidReq struct {
+	validBase
+	Name   string      `json:"name" valid:"required,len=1-8,regexp=^\\w+$"`
+	Email  string      `json:"email" valid:"email"`
+	Level  *int        `json:"level" valid:"required,in=1|2|3"`
+	Type   string      `json:"type" valid:"even"`
+	Items  []ValidItem `json:"items" valid:"required,len=1-3,dive"`
+	Remark string      `json:"remark"`
+}
+
+type invalidTagReq struct {
+	Name string `json:"name" valid:"min=1"`
+}
+
+type invalidDiveReq struct {
+	Items []invalidTagReq `json:"items" valid:"dive"`
+}
+
+func init() {
+	Register("even", func(value interface{}, param string) error {
+		if len(value.(string))%2 != 0 {
+			return utils.Error("length must be even")
+		}
+		return nil
+	})
+}
+
+func TestValidate(t *testing.T) {
+	level := 4
+	req := &ValidReq{Name: "freego-test", Email: "test", Level: &level, Type: "abc", Items: []ValidItem{{Sku: "AB123", Count: 0}, {Sku: "ab", Count: 100}}}
+	err := Validate(req)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatal("validate result invalid: ", err)
+	}
+	expect := map[string]string{"s": "required", "name": "len", "email": "email", "level": "in", "type": "even", "items[1].sku": "regexp", "items[1].count": "max"}
+	for _, v := range errs {
+		if expect[v.Field] != v.Rule {
+			t.Errorf("unexpected error: %s %s %s", v.Field, v.Rule, v.Msg)
+		}
+		delete(expect, v.Field)
+	}
+	if len(expect) > 0 {
+		t.Error("missing errors: ", expect)
+	}
+	level = 1
+	req = &ValidReq{validBase: validBase{Sign: "x"}, Name: "freego", Level: &level, Items: []ValidItem{{Sku: "AB12"}}}
+	if err := Validate(req); err != nil {
+		t.Error("zero value of optional field should skip min: ", err)
+	}
+	level = 0
+	if err := Validate(req); err == nil {
+		t.Error("required pointer zero value should be validated")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	if err := Prepare(&ValidReq{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Prepare(&invalidDiveReq{}); err == nil {
+		t.Error("invalid tag of dive field should fail")
+	}
+	if err := Validate(&invalidTagReq{Name: "x"}); err == nil {
+		t.Error("invalid tag should fail")
+	} else if _, ok := err.(Errors); ok {
+		t.Error("invalid tag should not be a field error")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"github.com/godaddy-x/freego/node"
 	"github.com/godaddy-x/freego/utils"
 	"github.com/godaddy-x/freego/utils/jwt"
@@ -44,3 +45,36 @@ func TestWsServer(t *testing.T) {
 	}()
 	server.StartWebsocket(":6060")
 }
+
+func TestHttpNodeWS(t *testing.T) {
+	my := &node.HttpNode{}
+	my.AddJwtConfig(jwt.JwtConfig{
+		TokenTyp: jwt.JWT,
+		TokenAlg: jwt.HS256,
+		TokenKey: "123456" + utils.CreateLocalSecretKey(12, 45, 23, 60, 58, 30),
+		TokenExp: jwt.TWO_WEEK,
+	})
+	handle := func(ctx *node.Context, message []byte) (interface{}, error) {
+		return &MsgReply{Id: utils.NextSID(), Ack: true, Type: "ack", Data: string(message)}, nil
+	}
+	my.AddWS("/ws/wallet", handle, nil, node.WSHooks{
+		OnConnect: func(conn *node.WSConn) error {
+			fmt.Println("connect:", conn.Sub, conn.Dev, conn.IP)
+			return nil
+		},
+		OnClose: func(conn *node.WSConn, err error) {
+			fmt.Println("close:", conn.Sub, err)
+		},
+	})
+	go func() {
+		for {
+			reply := MsgReply{Id: utils.NextSID(), Type: "transfer", Data: "我爱中国"}
+			if err := my.Hub().Send("1756510920302919681", &reply, "APP"); err != nil {
+				fmt.Println(err)
+			}
+			fmt.Println("broadcast:", my.Hub().Broadcast(&reply), "online:", my.Hub().Count())
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	my.StartServer(":6061")
+}
@@ -30,8 +30,10 @@ func init() {
 }
 
 type ZapLog struct {
-	l *zap.Logger
-	c *ZapConfig
+	l       *zap.Logger
+	c       *ZapConfig
+	level   zap.AtomicLevel
+	modules *moduleLevels
 }
 
 // 第三方发送对象实现
@@ -73,6 +75,9 @@ type FileConfig struct {
 	MaxBackups int    // 日志文件最多保存多少个备份
 	MaxAge     int    // 文件最多保存多少天
 	Compress   bool   // 是否压缩
+	// 按时间切割间隔, 如24h为每天0点切割, 与MaxSize同时生效, 0则仅按大小切割
+	Rotation  time.Duration
+	LocalTime bool // 备份文件名使用本地时间, 默认UTC
 }
 
 // 日志初始化配置
@@ -83,19 +88,25 @@ type ZapConfig struct {
 	Console    bool               // 是否控制台输出
 	FileConfig *FileConfig        // 输出文件配置
 	Callfunc   func([]byte) error // 回调函数
+	Exporters  []zapcore.Core     // 附加输出, 例: otelx.NewLogExporter创建的OTLP日志导出core, 与默认输出同时生效
+	Sampler    *SamplerConfig     // 日志限流采样, 防止下游抖动时日志风暴
+	Kafka      *KafkaConfig       // kafka输出配置
+	Syslog     *SyslogConfig      // syslog输出配置
+	// 模块日志级别, key为zlog.Module名称, 未设置的模块使用Level
+	ModuleLevels map[string]string
 }
 
 // 通过配置初始化默认日志对象
 func InitDefaultLog(config *ZapConfig) *zap.Logger {
 	zapLog.c = config
-	zapLog.l = buildLog(config)
+	zapLog.l, zapLog.level, zapLog.modules = buildLog(config)
 	return zapLog.l
 }
 
 // 通过配置创建新的日志对象
 func InitNewLog(config *ZapConfig) *zap.Logger {
-	z := &ZapLog{c: config, l: buildLog(config)}
-	return z.l
+	l, _, _ := buildLog(config)
+	return l
 }
 
 func NewTimeEncoder(layout string, location *time.Location) func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
@@ -112,7 +123,7 @@ func NewTimeEncoder(layout string, location *time.Location) func(t time.Time, en
 }
 
 // 通过配置创建日志对象
-func buildLog(config *ZapConfig) *zap.Logger {
+func buildLog(config *ZapConfig) (*zap.Logger, zap.AtomicLevel, *moduleLevels) {
 	// 基础日志配置
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:  "time",
@@ -153,8 +164,30 @@ func buildLog(config *ZapConfig) *zap.Logger {
 			MaxBackups: conf.MaxBackups, // 日志文件最多保存多少个备份
 			MaxAge:     conf.MaxAge,     // 文件最多保存多少天
 			Compress:   conf.Compress,   // 是否压缩
+			LocalTime:  conf.LocalTime,
 		}
 		writer = append(writer, zapcore.AddSync(&outfile))
+		if conf.Rotation > 0 {
+			startRotation(&outfile, conf.Rotation, config.Location)
+		}
+	}
+	// 设置kafka输出模式
+	if config.Kafka != nil {
+		kafka, err := newKafkaWriter(config.Kafka)
+		if err != nil {
+			panic(utils.AddStr("zlog kafka init failed: ", err.Error()))
+		}
+		addSink(kafka)
+		writer = append(writer, zapcore.AddSync(kafka))
+	}
+	// 设置syslog输出模式
+	if config.Syslog != nil {
+		syslog, err := newSyslogWriter(config.Syslog)
+		if err != nil {
+			panic(utils.AddStr("zlog syslog init failed: ", err.Error()))
+		}
+		addSink(syslog)
+		writer = append(writer, zapcore.AddSync(syslog))
 	}
 	// 设置第三方输出模式
 	if config.Callfunc != nil {
@@ -166,6 +199,15 @@ func buildLog(config *ZapConfig) *zap.Logger {
 		zapcore.NewMultiWriteSyncer(writer...), // 输出类型,控制台,文件
 		atomicLevel,                            // 日志级别
 	)
+	// 模块级别作用于默认输出, 附加输出按自身级别过滤
+	modules := newModuleLevels(atomicLevel, config.ModuleLevels)
+	core = &levelCore{Core: core, levels: modules}
+	if len(config.Exporters) > 0 {
+		core = zapcore.NewTee(append([]zapcore.Core{core}, config.Exporters...)...)
+	}
+	if config.Sampler != nil {
+		core = newSamplerCore(core, config.Sampler)
+	}
 	// 开启开发模式，堆栈跟踪
 	caller := zap.AddCaller()
 	// 开启文件及行号
@@ -173,7 +215,7 @@ func buildLog(config *ZapConfig) *zap.Logger {
 	// 设置初始化字段
 	// filed := zap.Fields(zap.String("serviceName", "serviceName"))
 	// 构造日志
-	return zap.New(core, caller, development)
+	return zap.New(core, caller, development), atomicLevel, modules
 }
 
 // debug
@@ -234,10 +276,17 @@ func Fatal(msg string, start int64, fields ...zap.Field) {
 
 // is debug?
 func IsDebug() bool {
-	if zapLog.c.Level == DEBUG {
-		return true
-	}
-	return false
+	return zapLog.level.Enabled(zap.DebugLevel)
+}
+
+// SetLevel 运行时调整默认日志对象级别
+func SetLevel(level string) {
+	zapLog.level.SetLevel(GetLevel(level))
+}
+
+// GetLevelName 获取默认日志对象当前级别
+func GetLevelName() string {
+	return zapLog.level.Level().String()
 }
 
 // 兼容原生log.Print
@@ -0,0 +1,163 @@
+package zlog
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"go.uber.org/zap"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const redactMask = "******"
+
+// AccessLogConfig 访问日志配置, 每个请求输出一行JSON
+type AccessLogConfig struct {
+	Console      bool        // 是否控制台输出
+	FileConfig   *FileConfig // 输出文件配置
+	SampleQPS    int64       // 每秒请求数超过该值后开始采样, 0则始终按SampleRate采样
+	SampleRate   float64     // 采样比例(0, 1], 默认1不采样
+	SlowRequest  int64       // 慢请求阈值/毫秒, 超过时不参与采样
+	RedactFields []string    // 脱敏字段, 不区分大小写, 默认password,keystore
+	WithBody     bool        // 是否记录请求内容, 记录前按RedactFields脱敏
+	MaxBody      int         // 请求内容最大记录长度, 默认1024
+}
+
+// AccessEntry 单条访问记录
+type AccessEntry struct {
+	Method  string
+	Path    string
+	Status  int
+	Latency time.Duration
+	IP      string
+	UserId  string
+	TraceId string
+	Body    []byte
+	Error   error
+}
+
+// AccessLogger 访问日志对象, 错误及慢请求始终输出, 其余请求按配置采样
+type AccessLogger struct {
+	l      *zap.Logger
+	config AccessLogConfig
+	fields map[string]struct{}
+	second int64 // 当前统计秒
+	count  int64 // 当前秒请求数
+}
+
+// NewAccessLogger 创建访问日志对象
+func NewAccessLogger(config AccessLogConfig) *AccessLogger {
+	if !config.Console && config.FileConfig == nil {
+		panic("access log output is nil")
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+	if config.MaxBody <= 0 {
+		config.MaxBody = 1024
+	}
+	if len(config.RedactFields) == 0 {
+		config.RedactFields = []string{"password", "keystore"}
+	}
+	fields := make(map[string]struct{}, len(config.RedactFields))
+	for _, v := range config.RedactFields {
+		fields[strings.ToLower(v)] = struct{}{}
+	}
+	l := InitNewLog(&ZapConfig{Level: INFO, Console: config.Console, FileConfig: config.FileConfig})
+	return &AccessLogger{l: l, config: config, fields: fields}
+}
+
+// Log 输出访问记录
+func (self *AccessLogger) Log(entry AccessEntry) {
+	if !self.sampled(entry) {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("method", entry.Method),
+		zap.String("path", entry.Path),
+		zap.Int("status", entry.Status),
+		zap.Int64("latency", entry.Latency.Milliseconds()),
+		zap.String("ip", entry.IP),
+	}
+	if len(entry.UserId) > 0 {
+		fields = append(fields, zap.String("user_id", entry.UserId))
+	}
+	if len(entry.TraceId) > 0 {
+		fields = append(fields, zap.String(TraceKey, entry.TraceId))
+	}
+	if self.config.WithBody && len(entry.Body) > 0 {
+		body := self.Redact(entry.Body)
+		if len(body) > self.config.MaxBody {
+			body = body[:self.config.MaxBody]
+		}
+		fields = append(fields, zap.ByteString("body", body))
+	}
+	if entry.Error != nil {
+		fields = append(fields, zap.String("error", entry.Error.Error()))
+	}
+	self.l.Info("access", fields...)
+}
+
+// 错误及慢请求始终输出, 当前秒请求数超过SampleQPS后按比例采样
+func (self *AccessLogger) sampled(entry AccessEntry) bool {
+	if entry.Error != nil || entry.Status >= 500 {
+		return true
+	}
+	if self.config.SlowRequest > 0 && entry.Latency.Milliseconds() > self.config.SlowRequest {
+		return true
+	}
+	if self.config.SampleRate >= 1 {
+		return true
+	}
+	if self.config.SampleQPS > 0 {
+		now := time.Now().Unix()
+		if second := atomic.LoadInt64(&self.second); second != now && atomic.CompareAndSwapInt64(&self.second, second, now) {
+			atomic.StoreInt64(&self.count, 0)
+		}
+		if atomic.AddInt64(&self.count, 1) <= self.config.SampleQPS {
+			return true
+		}
+	}
+	return rand.Float64() < self.config.SampleRate
+}
+
+// Redact 按RedactFields脱敏JSON内容, 非JSON内容原样返回
+func (self *AccessLogger) Redact(body []byte) []byte {
+	var data interface{}
+	if err := utils.JsonUnmarshal(body, &data); err != nil {
+		return body
+	}
+	if !redactValue(data, self.fields) {
+		return body
+	}
+	result, err := utils.JsonMarshal(data)
+	if err != nil {
+		return body
+	}
+	return result
+}
+
+// 递归替换脱敏字段值, 返回是否存在脱敏字段
+func redactValue(data interface{}, fields map[string]struct{}) bool {
+	redacted := false
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if _, ok := fields[strings.ToLower(key)]; ok {
+				v[key] = redactMask
+				redacted = true
+				continue
+			}
+			if redactValue(value, fields) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redactValue(value, fields) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
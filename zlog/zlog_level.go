@@ -0,0 +1,109 @@
+package zlog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"sync"
+)
+
+// 模块级别, 按logger名称(zlog.Module)匹配, 子模块a.b未设置时使用父模块a的级别
+type moduleLevels struct {
+	mu     sync.RWMutex
+	global zap.AtomicLevel
+	levels map[string]zapcore.Level
+}
+
+func newModuleLevels(global zap.AtomicLevel, levels map[string]string) *moduleLevels {
+	s := &moduleLevels{global: global, levels: make(map[string]zapcore.Level, len(levels))}
+	for k, v := range levels {
+		s.levels[k] = GetLevel(v)
+	}
+	return s
+}
+
+// 任一模块或全局级别允许即放行, 具体条目由Check按模块判断
+func (self *moduleLevels) Enabled(level zapcore.Level) bool {
+	if self.global.Enabled(level) {
+		return true
+	}
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	for _, v := range self.levels {
+		if level >= v {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *moduleLevels) enabled(module string, level zapcore.Level) bool {
+	self.mu.RLock()
+	for len(self.levels) > 0 && len(module) > 0 {
+		if v, ok := self.levels[module]; ok {
+			self.mu.RUnlock()
+			return level >= v
+		}
+		index := strings.LastIndex(module, ".")
+		if index < 0 {
+			break
+		}
+		module = module[:index]
+	}
+	self.mu.RUnlock()
+	return self.global.Enabled(level)
+}
+
+func (self *moduleLevels) set(module, level string) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if len(level) == 0 {
+		delete(self.levels, module)
+		return
+	}
+	self.levels[module] = GetLevel(level)
+}
+
+func (self *moduleLevels) snapshot() map[string]string {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	result := make(map[string]string, len(self.levels))
+	for k, v := range self.levels {
+		result[k] = v.String()
+	}
+	return result
+}
+
+type levelCore struct {
+	zapcore.Core
+	levels *moduleLevels
+}
+
+func (self *levelCore) Enabled(level zapcore.Level) bool {
+	return self.levels.Enabled(level)
+}
+
+func (self *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: self.Core.With(fields), levels: self.levels}
+}
+
+func (self *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if self.levels.enabled(ent.LoggerName, ent.Level) {
+		return ce.AddCore(ent, self)
+	}
+	return ce
+}
+
+// SetModuleLevel 运行时调整模块日志级别, level为空时移除模块级别, 使用全局级别
+func SetModuleLevel(module, level string) {
+	if len(module) == 0 {
+		SetLevel(level)
+		return
+	}
+	zapLog.modules.set(module, level)
+}
+
+// GetModuleLevels 获取已设置的模块日志级别
+func GetModuleLevels() map[string]string {
+	return zapLog.modules.snapshot()
+}
@@ -0,0 +1,53 @@
+package zlog
+
+import (
+	"gopkg.in/natefinch/lumberjack.v2"
+	"sync"
+	"time"
+)
+
+var (
+	rotatorMu sync.Mutex
+	rotators  = make(map[string]chan struct{}) // 日志文件 -> 停止信号
+)
+
+// 按时间间隔切割日志文件, 切割时间按地区对齐, 如24h为每天0点; 同一文件重复初始化时替换原任务
+func startRotation(file *lumberjack.Logger, interval time.Duration, location *time.Location) {
+	rotatorMu.Lock()
+	defer rotatorMu.Unlock()
+	if stop, ok := rotators[file.Filename]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	rotators[file.Filename] = stop
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(nextRotation(time.Now(), interval, location)))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+				if err := file.Rotate(); err != nil {
+					Error("log file rotate failed", 0, String("file", file.Filename), AddError(err))
+				}
+			}
+		}
+	}()
+}
+
+// 下一个切割时间点, 按地区时区偏移对齐间隔
+func nextRotation(now time.Time, interval time.Duration, location *time.Location) time.Time {
+	_, offset := now.In(location).Zone()
+	shift := time.Duration(offset) * time.Second
+	return now.Add(shift).Truncate(interval).Add(interval).Add(-shift)
+}
+
+func stopRotation() {
+	rotatorMu.Lock()
+	defer rotatorMu.Unlock()
+	for k, v := range rotators {
+		close(v)
+		delete(rotators, k)
+	}
+}
@@ -0,0 +1,148 @@
+package zlog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"time"
+)
+
+const maxSamplerKeys = 10000
+
+// SamplerConfig 日志限流采样配置, 相同级别+模块+消息在时间窗口内超出限额的日志被丢弃
+// 恢复输出时附带suppressed字段记录期间丢弃的条数
+type SamplerConfig struct {
+	Level        string         // 参与采样的最低级别, 默认error
+	Interval     time.Duration  // 时间窗口, 默认1分钟
+	Limit        int            // 每个窗口内相同消息最大输出条数, 默认10
+	ModuleLimits map[string]int // 按模块(zlog.Module名称)单独设置限额, <=0则该模块不限流
+}
+
+type tokenBucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int64
+}
+
+type samplerKey struct {
+	level   zapcore.Level
+	module  string
+	message string
+}
+
+type samplerCore struct {
+	zapcore.Core
+	level    zapcore.Level
+	interval time.Duration
+	limit    int
+	modules  map[string]int
+	state    *samplerState // With派生的core共享限流状态
+}
+
+type samplerState struct {
+	mu      sync.Mutex
+	buckets map[samplerKey]*tokenBucket
+}
+
+func newSamplerCore(core zapcore.Core, conf *SamplerConfig) zapcore.Core {
+	s := &samplerCore{
+		Core:     core,
+		level:    zap.ErrorLevel,
+		interval: conf.Interval,
+		limit:    conf.Limit,
+		modules:  conf.ModuleLimits,
+		state:    &samplerState{buckets: make(map[samplerKey]*tokenBucket)},
+	}
+	if len(conf.Level) > 0 {
+		s.level = GetLevel(conf.Level)
+	}
+	if s.interval <= 0 {
+		s.interval = time.Minute
+	}
+	if s.limit <= 0 {
+		s.limit = 10
+	}
+	return s
+}
+
+func (self *samplerCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *self
+	clone.Core = self.Core.With(fields)
+	return &clone
+}
+
+func (self *samplerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !self.Enabled(ent.Level) {
+		return ce
+	}
+	if ent.Level < self.level {
+		return self.Core.Check(ent, ce)
+	}
+	limit := self.limit
+	if v, b := self.modules[ent.LoggerName]; b {
+		if v <= 0 {
+			return self.Core.Check(ent, ce)
+		}
+		limit = v
+	}
+	allow, suppressed := self.bucket(samplerKey{level: ent.Level, module: ent.LoggerName, message: ent.Message}, limit).take(ent.Time, self.interval, limit)
+	if !allow {
+		return ce
+	}
+	if suppressed > 0 {
+		return ce.AddCore(ent, &suppressedCore{Core: self.Core, suppressed: suppressed})
+	}
+	return self.Core.Check(ent, ce)
+}
+
+func (self *samplerCore) bucket(key samplerKey, limit int) *tokenBucket {
+	state := self.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	b, ok := state.buckets[key]
+	if !ok {
+		if len(state.buckets) >= maxSamplerKeys {
+			state.buckets = make(map[samplerKey]*tokenBucket)
+		}
+		b = &tokenBucket{tokens: float64(limit), last: time.Now()}
+		state.buckets[key] = b
+	}
+	return b
+}
+
+// take 按窗口匀速补充令牌, 返回是否允许输出及此前被丢弃的条数
+func (self *tokenBucket) take(now time.Time, interval time.Duration, limit int) (bool, int64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if elapsed := now.Sub(self.last); elapsed > 0 {
+		self.tokens += float64(elapsed) / float64(interval) * float64(limit)
+		if self.tokens > float64(limit) {
+			self.tokens = float64(limit)
+		}
+		self.last = now
+	}
+	if self.tokens < 1 {
+		self.suppressed++
+		return false, 0
+	}
+	self.tokens--
+	suppressed := self.suppressed
+	self.suppressed = 0
+	return true, suppressed
+}
+
+// suppressedCore 输出时附带被丢弃的条数
+type suppressedCore struct {
+	zapcore.Core
+	suppressed int64
+}
+
+func (self *suppressedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return self.Core.Write(ent, append(fields, zap.Int64("suppressed", self.suppressed)))
+}
+
+// Module 获取模块日志对象, 模块名称用于采样限额及输出logger字段
+func Module(name string) *zap.Logger {
+	return zapLog.l.Named(name)
+}
@@ -0,0 +1,126 @@
+package zlog
+
+import (
+	"github.com/godaddy-x/freego/utils"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// KafkaConfig kafka日志输出配置, 异步发送, 队列满或发送失败时丢弃并计数, 不阻塞日志调用
+type KafkaConfig struct {
+	Topic    string      // 日志主题
+	Buffer   int         // 发送队列长度, 默认4096
+	Producer LogProducer // 消息发送实现, 如kafka.NewLogProducer
+}
+
+// LogProducer 日志消息发送接口, 由kafka包实现, 避免核心日志依赖kafka客户端
+type LogProducer interface {
+	Send(topic string, value []byte) error // 应立即返回, 缓冲区满时返回错误
+	Close() error
+}
+
+// SyslogConfig syslog日志输出配置
+type SyslogConfig struct {
+	Network string // tcp/udp, 为空则连接本机syslog
+	Addr    string // syslog地址, 如127.0.0.1:514
+	Tag     string // 日志标签, 默认进程名
+}
+
+var (
+	sinkMu sync.Mutex
+	sinks  []io.Closer // 需在停机时关闭的输出
+)
+
+var kafkaDropped int64 // kafka输出丢弃的日志数量
+
+// KafkaDropped kafka输出因队列满或发送失败丢弃的日志数量
+func KafkaDropped() int64 {
+	return atomic.LoadInt64(&kafkaDropped)
+}
+
+type kafkaWriter struct {
+	mu       sync.RWMutex
+	producer LogProducer
+	topic    string
+	queue    chan []byte
+	done     chan struct{}
+	closed   bool
+}
+
+func newKafkaWriter(conf *KafkaConfig) (*kafkaWriter, error) {
+	if conf.Producer == nil {
+		return nil, utils.Error("kafka log producer is nil")
+	}
+	if len(conf.Topic) == 0 {
+		return nil, utils.Error("kafka log topic is nil")
+	}
+	if conf.Buffer <= 0 {
+		conf.Buffer = 4096
+	}
+	self := &kafkaWriter{producer: conf.Producer, topic: conf.Topic, queue: make(chan []byte, conf.Buffer), done: make(chan struct{})}
+	go self.run()
+	return self, nil
+}
+
+func (self *kafkaWriter) run() {
+	defer close(self.done)
+	for value := range self.queue {
+		if err := self.producer.Send(self.topic, value); err != nil {
+			atomic.AddInt64(&kafkaDropped, 1)
+		}
+	}
+}
+
+// Write 非阻塞写入发送队列, kafka不可用导致队列满时丢弃, 读锁保证关闭后不再写入
+func (self *kafkaWriter) Write(b []byte) (int, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	if self.closed {
+		return len(b), nil
+	}
+	value := make([]byte, len(b)) // zap复用缓冲区, 异步发送前需复制
+	copy(value, b)
+	select {
+	case self.queue <- value:
+	default:
+		atomic.AddInt64(&kafkaDropped, 1)
+	}
+	return len(b), nil
+}
+
+// Close 停止写入并发送队列中剩余日志后关闭发送实现
+func (self *kafkaWriter) Close() error {
+	self.mu.Lock()
+	if self.closed {
+		self.mu.Unlock()
+		return nil
+	}
+	self.closed = true
+	close(self.queue)
+	self.mu.Unlock()
+	<-self.done
+	return self.producer.Close()
+}
+
+func addSink(sink io.Closer) {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Close 刷新默认日志对象并关闭kafka/syslog输出及按时间切割任务, 停机时最后调用
+func Close() map[string]error {
+	_ = zapLog.l.Sync() // 标准输出不支持Sync, 忽略错误
+	stopRotation()
+	result := make(map[string]error)
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	for i, v := range sinks {
+		if err := v.Close(); err != nil {
+			result[utils.AnyToStr(i)] = err
+		}
+	}
+	sinks = nil
+	return result
+}
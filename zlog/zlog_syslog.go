@@ -0,0 +1,12 @@
+//go:build !windows && !plan9
+
+package zlog
+
+import (
+	"io"
+	"log/syslog"
+)
+
+func newSyslogWriter(conf *SyslogConfig) (io.WriteCloser, error) {
+	return syslog.Dial(conf.Network, conf.Addr, syslog.LOG_INFO|syslog.LOG_LOCAL0, conf.Tag)
+}
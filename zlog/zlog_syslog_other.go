@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package zlog
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogWriter(conf *SyslogConfig) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/godaddy-x/freego/zlog"
 	"testing"
+	"time"
 )
 
 func TestZap(t *testing.T) {
@@ -32,3 +33,29 @@ func TestZap(t *testing.T) {
 	zlog.Println("test")
 
 }
+
+func TestAccessLog(t *testing.T) {
+	l := zlog.NewAccessLogger(zlog.AccessLogConfig{Console: true, WithBody: true, SampleQPS: 1, SampleRate: 0.5})
+	body := []byte(`{"username":"test","password":"123456","items":[{"keystore":"abc"}]}`)
+	fmt.Println(string(l.Redact(body)))
+	for i := 0; i < 5; i++ {
+		l.Log(zlog.AccessEntry{Method: "POST", Path: "/login", Status: 200, Latency: 15 * time.Millisecond, IP: "127.0.0.1", Body: body})
+	}
+	l.Log(zlog.AccessEntry{Method: "POST", Path: "/login", Status: 500, Latency: 5 * time.Millisecond, Error: errors.New("server error")})
+}
+
+func TestModuleLevel(t *testing.T) {
+	zlog.InitDefaultLog(&zlog.ZapConfig{
+		Level:        zlog.INFO,
+		Console:      true,
+		FileConfig:   &zlog.FileConfig{Filename: "./zlog_test.log", MaxSize: 10, MaxBackups: 3, Rotation: 24 * time.Hour, LocalTime: true},
+		ModuleLevels: map[string]string{"sqld": zlog.DEBUG},
+	})
+	defer zlog.Close()
+	zlog.Module("sqld").Debug("sqld debug output")
+	zlog.Module("sqld.mongo").Debug("sqld.mongo debug output")
+	zlog.Module("rpcx").Debug("rpcx debug dropped")
+	zlog.SetModuleLevel("rpcx", zlog.DEBUG)
+	zlog.Module("rpcx").Debug("rpcx debug output")
+	fmt.Println(zlog.GetModuleLevels())
+}
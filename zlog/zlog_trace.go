@@ -0,0 +1,93 @@
+package zlog
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+const (
+	TraceKey = "trace_id"
+	SpanKey  = "span_id"
+)
+
+type traceContextKey struct{}
+
+type traceContext struct {
+	trace string
+	span  string
+}
+
+// TraceExtractor 从上下文提取trace_id/span_id, 接入OpenTelemetry时可替换为读取SpanContext
+type TraceExtractor func(ctx context.Context) (trace string, span string)
+
+var traceExtractor TraceExtractor = defaultTraceExtractor
+
+func defaultTraceExtractor(ctx context.Context) (string, string) {
+	if v, ok := ctx.Value(traceContextKey{}).(traceContext); ok {
+		return v.trace, v.span
+	}
+	return "", ""
+}
+
+// SetTraceExtractor 设置trace提取函数, 需在服务启动前设置, 提取为空时回退读取WithTrace写入的值
+func SetTraceExtractor(extractor TraceExtractor) {
+	if extractor == nil {
+		extractor = defaultTraceExtractor
+	}
+	traceExtractor = extractor
+}
+
+// GetTraceExtractor 当前trace提取函数, 替换时可作为后备提取函数链式调用
+func GetTraceExtractor() TraceExtractor {
+	return traceExtractor
+}
+
+// WithTrace 将trace_id/span_id写入上下文, 后续*Ctx日志自动附带
+func WithTrace(ctx context.Context, trace, span string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, traceContextKey{}, traceContext{trace: trace, span: span})
+}
+
+// TraceFromContext 获取上下文中的trace_id/span_id
+func TraceFromContext(ctx context.Context) (string, string) {
+	if ctx == nil {
+		return "", ""
+	}
+	if trace, span := traceExtractor(ctx); len(trace) > 0 {
+		return trace, span
+	}
+	return defaultTraceExtractor(ctx)
+}
+
+func withTraceFields(ctx context.Context, fields []zap.Field) []zap.Field {
+	trace, span := TraceFromContext(ctx)
+	if len(trace) > 0 {
+		fields = append(fields, zap.String(TraceKey, trace))
+	}
+	if len(span) > 0 {
+		fields = append(fields, zap.String(SpanKey, span))
+	}
+	return fields
+}
+
+// DebugCtx debug, 附带上下文trace_id/span_id
+func DebugCtx(ctx context.Context, msg string, start int64, fields ...zap.Field) {
+	Debug(msg, start, withTraceFields(ctx, fields)...)
+}
+
+// InfoCtx info, 附带上下文trace_id/span_id
+func InfoCtx(ctx context.Context, msg string, start int64, fields ...zap.Field) {
+	Info(msg, start, withTraceFields(ctx, fields)...)
+}
+
+// WarnCtx warn, 附带上下文trace_id/span_id
+func WarnCtx(ctx context.Context, msg string, start int64, fields ...zap.Field) {
+	Warn(msg, start, withTraceFields(ctx, fields)...)
+}
+
+// ErrorCtx error, 附带上下文trace_id/span_id
+func ErrorCtx(ctx context.Context, msg string, start int64, fields ...zap.Field) {
+	Error(msg, start, withTraceFields(ctx, fields)...)
+}